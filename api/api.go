@@ -0,0 +1,44 @@
+// Package api holds what the handler packages of the API domains share: the
+// server they are built on, the user of a request, list parameters and the
+// common response models.
+package api
+
+import (
+	"net/http"
+
+	"github.com/jmoiron/sqlx"
+
+	"maxapi/maxclient"
+)
+
+// UserInfo is the user a request is authenticated as, stored in the request
+// context under "userinfo" by the token middleware
+type UserInfo interface {
+	Get(key string) string
+}
+
+// Server is what every handler package uses of the server
+type Server interface {
+	DB() *sqlx.DB
+
+	// Respond sends a JSON response in the envelope the request asked for
+	Respond(w http.ResponseWriter, r *http.Request, statusCode int, payload interface{})
+	// RespondPayloadError answers a request whose body could not be decoded:
+	// 413 when it exceeds the limit, 400 otherwise
+	RespondPayloadError(w http.ResponseWriter, r *http.Request, err error)
+	// DecodeJSON decodes the request body, rejecting unknown fields when the
+	// request or the server asks for strict decoding
+	DecodeJSON(r *http.Request, v interface{}) error
+
+	// UpdateUserInfo changes a field of the cached user of a request
+	UpdateUserInfo(r *http.Request, field, value string)
+}
+
+// Clients is what the handler packages talking to MAX use of the server
+type Clients interface {
+	// MaxClient returns the MAX client of an instance, nil when it has none
+	MaxClient(userID string) *maxclient.Client
+	// CheckUploadSize rejects media larger than the upload limit of MAX
+	// before it is sent, and writes the response when it does
+	CheckUploadSize(w http.ResponseWriter, r *http.Request, client *maxclient.Client, size int64) bool
+}
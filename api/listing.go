@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// NextCursorHeader carries the cursor of the next page on every list response,
+// also on endpoints whose body is a bare list
+const NextCursorHeader = "X-Next-Cursor"
+
+// ListQuery holds the shared parameters of list endpoints:
+// ?limit=50&cursor=...&sort=name (or -name for descending)&fields=id,name
+type ListQuery struct {
+	Limit  int // 0 when not given
+	Cursor ListCursor
+	Sort   string
+	Desc   bool
+	Fields []string
+}
+
+// ListCursor is the position of the next page, handed to clients as an
+// opaque string. Endpoints use the part that fits their source.
+type ListCursor struct {
+	Offset int   `json:"o,omitempty"`
+	Marker int64 `json:"m,omitempty"`
+	Time   int64 `json:"t,omitempty"`
+}
+
+// ListOptions describes the parameters a list endpoint supports
+type ListOptions struct {
+	MaxLimit int
+	Sorts    []string // sortable fields, none when the source fixes the order
+}
+
+// ParseListQuery reads and validates the list parameters of a request
+func ParseListQuery(r *http.Request, opts ListOptions) (ListQuery, error) {
+	var q ListQuery
+	query := r.URL.Query()
+
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > opts.MaxLimit {
+			return q, fmt.Errorf("limit must be between 1 and %d", opts.MaxLimit)
+		}
+		q.Limit = n
+	}
+
+	if v := query.Get("cursor"); v != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(v)
+		if err != nil || json.Unmarshal(raw, &q.Cursor) != nil || q.Cursor.Offset < 0 {
+			return q, errors.New("invalid cursor")
+		}
+	}
+
+	if v := query.Get("sort"); v != "" {
+		q.Sort, q.Desc = strings.CutPrefix(v, "-")
+		if !slices.Contains(opts.Sorts, q.Sort) {
+			if len(opts.Sorts) == 0 {
+				return q, errors.New("sort is not supported on this endpoint")
+			}
+			return q, fmt.Errorf("sort must be one of %s, with - for descending", strings.Join(opts.Sorts, ", "))
+		}
+	}
+
+	if v := query.Get("fields"); v != "" {
+		for _, field := range strings.Split(v, ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				q.Fields = append(q.Fields, field)
+			}
+		}
+	}
+
+	return q, nil
+}
+
+// Encode returns the cursor as sent to clients
+func (c ListCursor) Encode() string {
+	raw, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// SortSlice sorts a slice stably by less, reversed when desc is set
+func SortSlice(slice interface{}, desc bool, less func(i, j int) bool) {
+	sort.SliceStable(slice, func(i, j int) bool {
+		if desc {
+			return less(j, i)
+		}
+		return less(i, j)
+	})
+}
+
+// OffsetPage returns the range of a page of n items and the cursor of the
+// next page, "" after the last one. Without a limit all items are returned.
+func (q ListQuery) OffsetPage(n int) (start, end int, next string) {
+	start = min(q.Cursor.Offset, n)
+	end = n
+	if q.Limit > 0 && start+q.Limit < n {
+		end = start + q.Limit
+		next = ListCursor{Offset: end}.Encode()
+	}
+	return start, end, next
+}
+
+// SelectFields keeps only the requested top-level fields of each item. Items
+// are returned unchanged when no fields were requested.
+func (q ListQuery) SelectFields(items interface{}) interface{} {
+	if len(q.Fields) == 0 {
+		return items
+	}
+
+	var all []map[string]interface{}
+	raw, _ := json.Marshal(items)
+	json.Unmarshal(raw, &all)
+
+	selected := make([]map[string]interface{}, 0, len(all))
+	for _, item := range all {
+		picked := make(map[string]interface{}, len(q.Fields))
+		for _, field := range q.Fields {
+			if value, ok := item[field]; ok {
+				picked[field] = value
+			}
+		}
+		selected = append(selected, picked)
+	}
+	return selected
+}
+
+// SetNextCursor announces the next page in the X-Next-Cursor header
+func SetNextCursor(w http.ResponseWriter, next string) {
+	if next != "" {
+		w.Header().Set(NextCursorHeader, next)
+	}
+}
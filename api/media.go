@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/base64"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+)
+
+// DecodeMediaData decodes media given in a request as a data URL, an http(s)
+// URL to fetch or base64
+func DecodeMediaData(data string, defaultName string) ([]byte, string, error) {
+	filename := defaultName
+
+	// Check if it's a data URL
+	if strings.HasPrefix(data, "data:") {
+		dataURL, err := dataurl.DecodeString(data)
+		if err != nil {
+			return nil, "", err
+		}
+		return dataURL.Data, filename, nil
+	}
+
+	// Check if it's a URL
+	if strings.HasPrefix(data, "http://") || strings.HasPrefix(data, "https://") {
+		resp, err := http.Get(data)
+		if err != nil {
+			return nil, "", err
+		}
+		defer resp.Body.Close()
+
+		fileData, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, "", err
+		}
+		return fileData, filename, nil
+	}
+
+	// Assume it's base64
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		return nil, "", err
+	}
+	return decoded, filename, nil
+}
@@ -0,0 +1,17 @@
+package api
+
+// ========== BASE RESPONSE ==========
+
+// ErrorResponse represents an error response
+// @Description Error response format
+type ErrorResponse struct {
+	Success bool   `json:"success" example:"false"`
+	Error   string `json:"error" example:"error message"`
+}
+
+// MessageResponse represents a simple success response with message
+// @Description Simple success response with message
+type MessageResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Message string `json:"message" example:"Operation completed"`
+}
@@ -0,0 +1,30 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ValidateWebhookURL checks that a webhook URL is an absolute http(s) URL
+func ValidateWebhookURL(raw string) error {
+	if strings.ContainsAny(raw, " \t\r\n") {
+		return errors.New("webhook URL must not contain whitespace")
+	}
+
+	parsed, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid webhook URL: %v", err)
+	}
+	if parsed.Scheme == "" {
+		return errors.New("webhook URL must start with http:// or https://")
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("webhook URL must use http or https, got %q", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return errors.New("webhook URL has no host")
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	errCodeAuthBanned = "AUTH_BANNED"
+
+	defaultAuthMaxFailures   = 10
+	defaultAuthFailureWindow = 300 // seconds
+	defaultAuthBanDuration   = 900 // seconds
+)
+
+// authGuard counts failed authentications per client address and bans an
+// address for a while once it fails too often
+var authGuard struct {
+	maxFailures int
+	window      time.Duration
+	ban         time.Duration
+	failures    *cache.Cache
+	bans        *cache.Cache
+}
+
+// initAuthGuard reads the brute-force limits: MAXAPI_AUTH_MAX_FAILURES failed
+// attempts (0 = no bans) within MAXAPI_AUTH_FAILURE_WINDOW seconds ban the
+// address for MAXAPI_AUTH_BAN_DURATION seconds
+func initAuthGuard() {
+	authGuard.maxFailures = envInt("MAXAPI_AUTH_MAX_FAILURES", defaultAuthMaxFailures)
+	authGuard.window = time.Duration(envInt("MAXAPI_AUTH_FAILURE_WINDOW", defaultAuthFailureWindow)) * time.Second
+	if authGuard.window <= 0 {
+		authGuard.window = defaultAuthFailureWindow * time.Second
+	}
+	authGuard.ban = time.Duration(envInt("MAXAPI_AUTH_BAN_DURATION", defaultAuthBanDuration)) * time.Second
+	if authGuard.ban <= 0 {
+		authGuard.ban = defaultAuthBanDuration * time.Second
+	}
+	authGuard.failures = cache.New(authGuard.window, time.Minute)
+	authGuard.bans = cache.New(authGuard.ban, time.Minute)
+
+	if authGuard.maxFailures > 0 {
+		log.Info().Int("maxFailures", authGuard.maxFailures).Dur("window", authGuard.window).Dur("ban", authGuard.ban).Msg("Authentication brute-force protection enabled")
+	}
+}
+
+// authBannedUntil returns when the ban of an address ends, false when it is not banned
+func authBannedUntil(addr netip.Addr) (time.Time, bool) {
+	if authGuard.bans == nil {
+		return time.Time{}, false
+	}
+	_, expires, found := authGuard.bans.GetWithExpiration(addr.String())
+	return expires, found
+}
+
+// authFailed counts a failed authentication of an address, banning it when
+// it reached the limit
+func authFailed(addr netip.Addr, credential string) {
+	metrics.authFailure(credential)
+	if authGuard.failures == nil {
+		return
+	}
+
+	key := addr.String()
+	failures := 1
+	if err := authGuard.failures.Add(key, failures, authGuard.window); err != nil {
+		failures, _ = authGuard.failures.IncrementInt(key, 1)
+	}
+	log.Debug().Str("ip", key).Str("credential", credential).Int("failures", failures).Msg("Authentication failed")
+
+	if authGuard.maxFailures <= 0 || failures < authGuard.maxFailures {
+		return
+	}
+	if err := authGuard.bans.Add(key, true, authGuard.ban); err != nil {
+		return
+	}
+	authGuard.failures.Delete(key)
+	metrics.authBan()
+
+	log.Warn().Str("ip", key).Str("credential", credential).Int("failures", failures).Dur("duration", authGuard.ban).Msg("Too many failed authentications, address banned")
+	alertAuthBan(key, credential, failures)
+}
+
+// alertAuthBan emails the operator addresses in ALERT_EMAILS about a ban
+func alertAuthBan(ip, credential string, failures int) {
+	if alertsSent == nil || len(alertEmails) == 0 {
+		return
+	}
+	subject := fmt.Sprintf("[maxapi] Address %s banned after failed authentications", ip)
+	body := fmt.Sprintf("%s failed to authenticate with a %s token %d times within %s and is banned for %s from %s.\r\n",
+		ip, credential, failures, authGuard.window, authGuard.ban, time.Now().UTC().Format(time.RFC3339))
+
+	go func() {
+		if err := sendMail(alertEmails, subject, body); err != nil {
+			log.Error().Err(err).Str("ip", ip).Msg("Failed to send auth ban alert")
+		}
+	}()
+}
+
+// rejectBanned answers a request from a banned address with 429 and a
+// Retry-After header. It returns false when the address is not banned.
+func (s *server) rejectBanned(w http.ResponseWriter, r *http.Request, addr netip.Addr) bool {
+	until, banned := authBannedUntil(addr)
+	if !banned {
+		return false
+	}
+	retryAfter := max(int(time.Until(until).Seconds()), 1)
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	s.Respond(w, r, http.StatusTooManyRequests, map[string]interface{}{
+		"success":    false,
+		"error":      "too many failed authentications",
+		"code":       errCodeAuthBanned,
+		"retryAfter": retryAfter,
+	})
+	return true
+}
+
+// GetAuthBans lists the addresses banned for failed authentications
+// @Summary List authentication bans
+// @Description Returns the client addresses that are banned after too many failed authentications, with the time each ban ends
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} AuthBansResponse
+// @Security AdminAuth
+// @Router /admin/authbans [get]
+func (s *server) GetAuthBans() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		bans := []AuthBan{}
+		if authGuard.bans != nil {
+			for ip, item := range authGuard.bans.Items() {
+				bans = append(bans, AuthBan{IP: ip, Until: time.Unix(0, item.Expiration).Unix()})
+			}
+		}
+		sort.Slice(bans, func(i, j int) bool { return bans[i].Until < bans[j].Until })
+
+		response := map[string]interface{}{
+			"success":     true,
+			"maxFailures": authGuard.maxFailures,
+			"bans":        bans,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteAuthBan lifts the ban of an address
+// @Summary Lift an authentication ban
+// @Description Lets a banned client address authenticate again and resets its failure count
+// @Tags Admin
+// @Produce json
+// @Param ip path string true "Client address"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/authbans/{ip} [delete]
+func (s *server) DeleteAuthBan() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		addr, err := netip.ParseAddr(mux.Vars(r)["ip"])
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("invalid address"))
+			return
+		}
+		key := addr.Unmap().String()
+
+		if _, banned := authBannedUntil(addr.Unmap()); !banned {
+			s.Respond(w, r, http.StatusNotFound, errors.New("address is not banned"))
+			return
+		}
+		authGuard.bans.Delete(key)
+		authGuard.failures.Delete(key)
+
+		log.Info().Str("ip", key).Msg("Authentication ban lifted")
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Ban lifted",
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const (
+	autoMarkReadOff   = "off"
+	autoMarkReadAll   = "all"
+	autoMarkReadChats = "chats"
+
+	maxAutoMarkReadChats = 1000
+)
+
+// autoMarkReadSetting marks incoming messages as read, in every chat or in
+// the listed chats only
+type autoMarkReadSetting struct {
+	Mode  string
+	Chats map[int64]bool
+}
+
+// autoMarkReads caches the setting per user
+var autoMarkReads sync.Map
+
+// parseAutoMarkRead reads the stored form of the setting: "" (off), "all" or
+// a comma-separated list of chat IDs
+func parseAutoMarkRead(raw string) autoMarkReadSetting {
+	switch raw {
+	case "":
+		return autoMarkReadSetting{Mode: autoMarkReadOff}
+	case autoMarkReadAll:
+		return autoMarkReadSetting{Mode: autoMarkReadAll}
+	}
+	setting := autoMarkReadSetting{Mode: autoMarkReadChats, Chats: map[int64]bool{}}
+	for _, item := range splitList(raw, ",") {
+		if chatID, err := strconv.ParseInt(item, 10, 64); err == nil {
+			setting.Chats[chatID] = true
+		}
+	}
+	return setting
+}
+
+// chatIDs returns the listed chats in ascending order
+func (setting autoMarkReadSetting) chatIDs() []int64 {
+	chats := make([]int64, 0, len(setting.Chats))
+	for chatID := range setting.Chats {
+		chats = append(chats, chatID)
+	}
+	slices.Sort(chats)
+	return chats
+}
+
+// getAutoMarkRead returns the auto mark-read setting of a user
+func (s *server) getAutoMarkRead(userID string) (autoMarkReadSetting, error) {
+	if cached, ok := autoMarkReads.Load(userID); ok {
+		return cached.(autoMarkReadSetting), nil
+	}
+
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(auto_mark_read, '') FROM users WHERE id = $1", userID); err != nil {
+		return autoMarkReadSetting{Mode: autoMarkReadOff}, err
+	}
+	setting := parseAutoMarkRead(raw)
+	autoMarkReads.Store(userID, setting)
+	return setting, nil
+}
+
+// autoMarkRead marks an incoming message as read when the user's setting
+// covers its chat. The call to MAX runs in the background, as the receive
+// loop must not wait on it.
+func (mycli *MyClient) autoMarkRead(msg *maxclient.Message) {
+	if msg.Sender == mycli.MaxClient.MaxUserID {
+		return
+	}
+	setting, err := mycli.s.getAutoMarkRead(mycli.userID)
+	if err != nil || setting.Mode == autoMarkReadOff {
+		return
+	}
+	if setting.Mode == autoMarkReadChats && !setting.Chats[msg.ChatID] {
+		return
+	}
+	messageID, err := strconv.ParseInt(msg.ID, 10, 64)
+	if err != nil {
+		return
+	}
+
+	client := mycli.MaxClient
+	goTracked(mycli.userID, func() {
+		if err := client.MarkRead(msg.ChatID, messageID); err != nil {
+			log.Warn().Err(err).Str("userID", mycli.userID).Int64("chatId", msg.ChatID).Msg("Failed to mark message as read automatically")
+		}
+	})
+}
+
+// autoMarkReadResponse renders a setting
+func autoMarkReadResponse(setting autoMarkReadSetting) map[string]interface{} {
+	chats := []int64{}
+	if setting.Mode == autoMarkReadChats {
+		chats = setting.chatIDs()
+	}
+	return map[string]interface{}{
+		"success": true,
+		"mode":    setting.Mode,
+		"chats":   chats,
+	}
+}
+
+// GetAutoMarkRead returns the auto mark-read setting
+// @Summary Get auto mark-read
+// @Description Returns whether incoming messages are marked as read automatically: off, in all chats or in the listed chats
+// @Tags User
+// @Produce json
+// @Success 200 {object} AutoMarkReadResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/automarkread [get]
+func (s *server) GetAutoMarkRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		setting, err := s.getAutoMarkRead(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.Respond(w, r, http.StatusOK, autoMarkReadResponse(setting))
+	}
+}
+
+// SetAutoMarkRead sets the auto mark-read setting
+// @Summary Set auto mark-read
+// @Description Marks incoming messages as read as soon as they arrive, in all chats (mode all) or only in the given chats (mode chats). Mode off turns it off. Messages sent by the instance itself are not marked.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body AutoMarkReadBody true "Auto mark-read setting"
+// @Success 200 {object} AutoMarkReadResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/automarkread [post]
+func (s *server) SetAutoMarkRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg AutoMarkReadBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		var raw string
+		switch strings.ToLower(msg.Mode) {
+		case autoMarkReadOff, "":
+		case autoMarkReadAll:
+			raw = autoMarkReadAll
+		case autoMarkReadChats:
+			if len(msg.Chats) == 0 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("chats are required for mode chats"))
+				return
+			}
+			if len(msg.Chats) > maxAutoMarkReadChats {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d chats", maxAutoMarkReadChats))
+				return
+			}
+			ids := make([]string, 0, len(msg.Chats))
+			for _, chatID := range msg.Chats {
+				if chatID == 0 {
+					s.Respond(w, r, http.StatusBadRequest, errors.New("chat IDs must not be 0"))
+					return
+				}
+				ids = append(ids, strconv.FormatInt(chatID, 10))
+			}
+			raw = strings.Join(ids, ",")
+		default:
+			s.Respond(w, r, http.StatusBadRequest, errors.New("mode must be off, all or chats"))
+			return
+		}
+
+		if _, err := s.db.Exec("UPDATE users SET auto_mark_read = $1 WHERE id = $2", raw, txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		setting := parseAutoMarkRead(raw)
+		autoMarkReads.Store(txtid, setting)
+
+		log.Info().Str("userID", txtid).Str("mode", setting.Mode).Int("chats", len(setting.Chats)).Msg("Auto mark-read updated")
+
+		s.Respond(w, r, http.StatusOK, autoMarkReadResponse(setting))
+	}
+}
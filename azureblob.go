@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const azureAPIVersion = "2021-08-06"
+
+// azureStore stores media in an Azure Blob Storage container using a SAS token
+type azureStore struct {
+	config    *StorageConfig
+	baseURL   string
+	sas       url.Values
+	client    *http.Client
+	publicURL string
+}
+
+// newAzureStore creates an Azure Blob client. The SAS token needs read, write, delete and list permissions on the container.
+func newAzureStore(config *StorageConfig) (*azureStore, error) {
+	sas, err := url.ParseQuery(strings.TrimPrefix(config.AzureSASToken, "?"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid Azure SAS token: %w", err)
+	}
+
+	baseURL := strings.TrimRight(config.Endpoint, "/")
+	if baseURL == "" {
+		baseURL = fmt.Sprintf("https://%s.blob.core.windows.net", config.AzureAccount)
+	}
+	baseURL += "/" + config.AzureContainer
+
+	return &azureStore{
+		config:    config,
+		baseURL:   baseURL,
+		sas:       sas,
+		client:    &http.Client{Timeout: 60 * time.Second},
+		publicURL: strings.TrimRight(config.PublicURL, "/"),
+	}, nil
+}
+
+func (a *azureStore) Backend() string { return storageBackendAzure }
+
+func (a *azureStore) Location() string { return a.config.AzureContainer }
+
+// requestURL builds a signed URL for the container or one of its blobs
+func (a *azureStore) requestURL(key string, params url.Values) string {
+	query := url.Values{}
+	for k, v := range a.sas {
+		query[k] = v
+	}
+	for k, v := range params {
+		query[k] = v
+	}
+
+	u := a.baseURL
+	if key != "" {
+		u += "/" + (&url.URL{Path: key}).EscapedPath()
+	}
+	return u + "?" + query.Encode()
+}
+
+// do sends a request and returns the response body if the status is the expected one
+func (a *azureStore) do(ctx context.Context, method, u string, body []byte, headers map[string]string, expected int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("x-ms-version", azureAPIVersion)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		// Drop the request URL from the error so the SAS signature is not leaked
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			return nil, fmt.Errorf("%s %s: %w", method, a.baseURL, urlErr.Err)
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != expected {
+		return nil, fmt.Errorf("azure returned %d: %s", resp.StatusCode, truncateString(string(data), 200))
+	}
+	return data, nil
+}
+
+func (a *azureStore) Put(ctx context.Context, key string, data []byte, mimeType string) error {
+	contentType := mimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	headers := map[string]string{
+		"x-ms-blob-type":          "BlockBlob",
+		"x-ms-blob-content-type":  contentType,
+		"x-ms-blob-cache-control": "public, max-age=3600",
+	}
+	if strings.HasPrefix(mimeType, "image/") || strings.HasPrefix(mimeType, "video/") || mimeType == "application/pdf" {
+		headers["x-ms-blob-content-disposition"] = "inline"
+	}
+
+	_, err := a.do(ctx, http.MethodPut, a.requestURL(key, nil), data, headers, http.StatusCreated)
+	if err != nil {
+		return fmt.Errorf("failed to upload to Azure: %w", err)
+	}
+	return nil
+}
+
+func (a *azureStore) URL(key string) string {
+	escaped := (&url.URL{Path: key}).EscapedPath()
+	if a.publicURL != "" {
+		return fmt.Sprintf("%s/%s/%s", a.publicURL, a.config.AzureContainer, escaped)
+	}
+	return a.baseURL + "/" + escaped
+}
+
+// azureBlobList is the subset of the List Blobs response we use
+type azureBlobList struct {
+	Blobs struct {
+		Blob []struct {
+			Name string `xml:"Name"`
+		} `xml:"Blob"`
+	} `xml:"Blobs"`
+	NextMarker string `xml:"NextMarker"`
+}
+
+// list returns one page of blob names under prefix
+func (a *azureStore) list(ctx context.Context, prefix, marker string, max int) (*azureBlobList, error) {
+	params := url.Values{"restype": {"container"}, "comp": {"list"}}
+	if prefix != "" {
+		params.Set("prefix", prefix)
+	}
+	if marker != "" {
+		params.Set("marker", marker)
+	}
+	if max > 0 {
+		params.Set("maxresults", fmt.Sprintf("%d", max))
+	}
+
+	data, err := a.do(ctx, http.MethodGet, a.requestURL("", params), nil, nil, http.StatusOK)
+	if err != nil {
+		return nil, err
+	}
+
+	var list azureBlobList
+	if err := xml.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse blob list: %w", err)
+	}
+	return &list, nil
+}
+
+func (a *azureStore) DeletePrefix(ctx context.Context, prefix string) error {
+	marker := ""
+	for {
+		list, err := a.list(ctx, prefix, marker, 0)
+		if err != nil {
+			return fmt.Errorf("failed to list blobs: %w", err)
+		}
+
+		for _, blob := range list.Blobs.Blob {
+			if _, err := a.do(ctx, http.MethodDelete, a.requestURL(blob.Name, nil), nil, nil, http.StatusAccepted); err != nil {
+				return fmt.Errorf("failed to delete blob %s: %w", blob.Name, err)
+			}
+		}
+
+		if list.NextMarker == "" {
+			return nil
+		}
+		marker = list.NextMarker
+	}
+}
+
+func (a *azureStore) Test(ctx context.Context) error {
+	_, err := a.list(ctx, "", "", 1)
+	return err
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// maxBatchMessages caps the messages of one batch request
+	maxBatchMessages = 50
+
+	defaultBatchDelayMs  = 1000
+	defaultBatchJitterMs = 500
+
+	// maxBatchDuration keeps a batch within the server's write timeout
+	maxBatchDuration = 90 * time.Second
+)
+
+// SendBatch sends several text messages with a pause between them
+// @Summary Send message batch
+// @Description Sends up to 50 text messages, each with its own chatId or phone, text and formatting, in order. Between two messages the batch waits delayMs plus a random 0-jitterMs (1000 and 500 by default), so MAX does not see a burst. The whole batch must fit in 90 seconds; larger mailings belong in a campaign. Every message goes through the blocklist like a single send, and results are reported per message. During quiet hours the whole batch is queued.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body BatchSendBody true "Messages"
+// @Success 200 {object} BatchSendResponse
+// @Success 202 {object} chat.QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse "Not connected"
+// @Security ApiKeyAuth
+// @Router /chat/send/batch [post]
+func (s *server) SendBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		token := r.Context().Value("userinfo").(Values).Get("Token")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg BatchSendBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if len(msg.Messages) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("messages is required"))
+			return
+		}
+		if len(msg.Messages) > maxBatchMessages {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d messages per batch", maxBatchMessages))
+			return
+		}
+
+		delayMs, jitterMs := defaultBatchDelayMs, defaultBatchJitterMs
+		if msg.DelayMs != nil {
+			delayMs = *msg.DelayMs
+		}
+		if msg.JitterMs != nil {
+			jitterMs = *msg.JitterMs
+		}
+		if delayMs < 0 || jitterMs < 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("delayMs and jitterMs must not be negative"))
+			return
+		}
+		longest := time.Duration(len(msg.Messages)-1) * time.Duration(delayMs+jitterMs) * time.Millisecond
+		if longest > maxBatchDuration {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("the batch could take %s, more than %s; lower the delay or use a campaign", longest, maxBatchDuration))
+			return
+		}
+
+		for i, m := range msg.Messages {
+			if m.Text == "" {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("message %d: text is required", i))
+				return
+			}
+		}
+
+		results := make([]BatchSendResult, 0, len(msg.Messages))
+		sent := 0
+		for i, m := range msg.Messages {
+			result := BatchSendResult{Index: i, ChatID: m.ChatID, Phone: m.Phone}
+
+			if i > 0 {
+				pause := time.Duration(delayMs) * time.Millisecond
+				if jitterMs > 0 {
+					pause += time.Duration(rand.Intn(jitterMs+1)) * time.Millisecond
+				}
+				select {
+				case <-r.Context().Done():
+				case <-time.After(pause):
+				}
+			}
+			if r.Context().Err() != nil {
+				// The caller went away; what was not sent yet is reported as such
+				result.Error = "batch canceled"
+				results = append(results, result)
+				continue
+			}
+
+			body, _ := json.Marshal(m)
+			rec := s.InternalSend(token, "/chat/send/text", string(body))
+
+			var reply struct {
+				MessageID json.RawMessage `json:"messageId"`
+				ChatID    int64           `json:"chatId"`
+				Error     string          `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &reply)
+
+			result.Status = rec.Code
+			if rec.Code == http.StatusOK {
+				result.Success = true
+				result.ChatID = reply.ChatID
+				result.MessageID = strings.Trim(string(reply.MessageID), `"`)
+				sent++
+			} else if reply.Error != "" {
+				result.Error = reply.Error
+			} else {
+				result.Error = fmt.Sprintf("status %d", rec.Code)
+			}
+			results = append(results, result)
+		}
+
+		log.Info().Str("userID", txtid).Int("sent", sent).Int("failed", len(results)-sent).Msg("Sent message batch")
+
+		response := map[string]interface{}{
+			"success": true,
+			"sent":    sent,
+			"failed":  len(results) - sent,
+			"results": results,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"maxapi/maxclient"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	blockTypePhone = "phone"
+	blockTypeUser  = "user"
+
+	// errCodeRecipientBlocked is returned when a send targets a blocklisted recipient
+	errCodeRecipientBlocked = "RECIPIENT_BLOCKED"
+
+	// Inbound messages longer than this are never treated as opt-out keywords
+	maxOptOutKeywordLength = 64
+)
+
+// BlocklistEntry represents a recipient that must not receive outgoing messages
+type BlocklistEntry struct {
+	Type      string `json:"type" db:"recipient_type" example:"phone"`
+	Recipient string `json:"recipient" db:"recipient" example:"79001234567"`
+	Reason    string `json:"reason" db:"reason" example:"optout"`
+	CreatedAt int64  `json:"createdAt" db:"created_at" example:"1700000000"`
+}
+
+// normalizePhone keeps only the digits of a phone number
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (s *server) addToBlocklist(txtid, recipientType, recipient, reason string) (bool, error) {
+	res, err := s.db.Exec(`INSERT INTO blocklist (user_id, recipient_type, recipient, reason, created_at)
+		VALUES ($1, $2, $3, $4, $5) ON CONFLICT (user_id, recipient_type, recipient) DO NOTHING`,
+		txtid, recipientType, recipient, reason, time.Now().Unix())
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+func (s *server) isBlocked(txtid, recipientType, recipient string) (bool, error) {
+	var count int
+	err := s.db.Get(&count, "SELECT COUNT(*) FROM blocklist WHERE user_id=$1 AND recipient_type=$2 AND recipient=$3",
+		txtid, recipientType, recipient)
+	return count > 0, err
+}
+
+// isRecipientBlocked checks the target of an outgoing request against the blocklist.
+// Dialog chat IDs and phones are resolved to the peer user ID when user entries exist.
+func (s *server) isRecipientBlocked(txtid string, req outboundRequest) (bool, error) {
+	if req.Phone != "" {
+		blocked, err := s.isBlocked(txtid, blockTypePhone, normalizePhone(req.Phone))
+		if err != nil || blocked {
+			return blocked, err
+		}
+	}
+
+	var userEntries int
+	if err := s.db.Get(&userEntries, "SELECT COUNT(*) FROM blocklist WHERE user_id=$1 AND recipient_type=$2", txtid, blockTypeUser); err != nil {
+		return false, err
+	}
+	if userEntries == 0 {
+		return false, nil
+	}
+
+	client := clientManager.GetMaxClient(txtid)
+	if client == nil || !client.IsConnected() {
+		// The handler responds with "not connected"
+		return false, nil
+	}
+
+	chatID := req.ChatID
+	if req.Phone != "" && chatID == 0 {
+		user, err := client.SearchByPhone(req.Phone)
+		if err != nil {
+			// Unknown phone, the handler reports the lookup error
+			return false, nil
+		}
+		return s.isBlocked(txtid, blockTypeUser, strconv.FormatInt(user.ID, 10))
+	}
+
+	// Only dialogs have a peer; group chats and channels are never user entries
+	chat, err := client.GetChat(chatID)
+	if err != nil || chat.Type != maxclient.ChatTypeDialog {
+		// Unknown chat, the handler reports the send error
+		return false, nil
+	}
+	peerID := maxclient.GetDialogID(chatID, client.MaxUserID)
+	return s.isBlocked(txtid, blockTypeUser, strconv.FormatInt(peerID, 10))
+}
+
+func (s *server) getOptOutKeywords(txtid string) ([]string, error) {
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(optout_keywords, '') FROM users WHERE id=$1", txtid); err != nil {
+		return nil, err
+	}
+	keywords := []string{}
+	for _, kw := range strings.Split(raw, ",") {
+		if kw = strings.TrimSpace(kw); kw != "" {
+			keywords = append(keywords, kw)
+		}
+	}
+	return keywords, nil
+}
+
+// handleOptOut adds the sender to the blocklist when an inbound message matches
+// one of the configured opt-out keywords and emits an OptOut event
+func (mycli *MyClient) handleOptOut(msg *maxclient.Message) {
+	text := strings.TrimSpace(msg.Text)
+	if text == "" || len(text) > maxOptOutKeywordLength || msg.Sender == mycli.MaxClient.MaxUserID {
+		return
+	}
+
+	keywords, err := mycli.s.getOptOutKeywords(mycli.userID)
+	if err != nil {
+		log.Error().Err(err).Str("userID", mycli.userID).Msg("Failed to load opt-out keywords")
+		return
+	}
+
+	for _, kw := range keywords {
+		if !strings.EqualFold(text, kw) {
+			continue
+		}
+
+		sender := strconv.FormatInt(msg.Sender, 10)
+		added, err := mycli.s.addToBlocklist(mycli.userID, blockTypeUser, sender, "optout")
+		if err != nil {
+			log.Error().Err(err).Str("userID", mycli.userID).Msg("Failed to add sender to blocklist")
+			return
+		}
+
+		log.Info().Str("userID", mycli.userID).Int64("sender", msg.Sender).Str("keyword", kw).Msg("Recipient opted out")
+
+		postmap := map[string]interface{}{
+			"type": "OptOut",
+			"event": map[string]interface{}{
+				"chatId":    msg.ChatID,
+				"userId":    msg.Sender,
+				"messageId": msg.ID,
+				"keyword":   kw,
+				"added":     added,
+			},
+		}
+		sendEventWithWebHook(mycli, postmap, "")
+		return
+	}
+}
+
+// ========== BLOCKLIST ENDPOINTS ==========
+
+// GetBlocklist lists blocked recipients
+// @Summary Get blocklist
+// @Description Returns blocked recipients and the configured opt-out keywords
+// @Tags Blocklist
+// @Produce json
+// @Success 200 {object} BlocklistResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/blocklist [get]
+func (s *server) GetBlocklist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		entries := []BlocklistEntry{}
+		err := s.db.Select(&entries, "SELECT recipient_type, recipient, reason, created_at FROM blocklist WHERE user_id=$1 ORDER BY created_at, id", txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		keywords, err := s.getOptOutKeywords(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"entries":  entries,
+			"keywords": keywords,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// AddToBlocklist blocks recipients
+// @Summary Add to blocklist
+// @Description Blocks phones and/or user IDs. Sends to blocked recipients are rejected with code RECIPIENT_BLOCKED.
+// @Tags Blocklist
+// @Accept json
+// @Produce json
+// @Param request body BlocklistBody true "Recipients to block"
+// @Success 200 {object} BlocklistChangeResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/blocklist [post]
+func (s *server) AddToBlocklist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg BlocklistBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if len(msg.Phones) == 0 && len(msg.UserIDs) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("missing phones or userIds"))
+			return
+		}
+
+		reason := msg.Reason
+		if reason == "" {
+			reason = "manual"
+		}
+
+		count := 0
+		for _, phone := range msg.Phones {
+			normalized := normalizePhone(phone)
+			if normalized == "" {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid phone %q", phone))
+				return
+			}
+			added, err := s.addToBlocklist(txtid, blockTypePhone, normalized, reason)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			if added {
+				count++
+			}
+		}
+		for _, userID := range msg.UserIDs {
+			added, err := s.addToBlocklist(txtid, blockTypeUser, strconv.FormatInt(userID, 10), reason)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			if added {
+				count++
+			}
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"count":   count,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// RemoveFromBlocklist unblocks recipients
+// @Summary Remove from blocklist
+// @Description Unblocks phones and/or user IDs
+// @Tags Blocklist
+// @Accept json
+// @Produce json
+// @Param request body BlocklistBody true "Recipients to unblock"
+// @Success 200 {object} BlocklistChangeResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/blocklist [delete]
+func (s *server) RemoveFromBlocklist() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg BlocklistBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		var count int64
+		remove := func(recipientType, recipient string) error {
+			res, err := s.db.Exec("DELETE FROM blocklist WHERE user_id=$1 AND recipient_type=$2 AND recipient=$3",
+				txtid, recipientType, recipient)
+			if err != nil {
+				return err
+			}
+			n, _ := res.RowsAffected()
+			count += n
+			return nil
+		}
+
+		for _, phone := range msg.Phones {
+			if err := remove(blockTypePhone, normalizePhone(phone)); err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+		for _, userID := range msg.UserIDs {
+			if err := remove(blockTypeUser, strconv.FormatInt(userID, 10)); err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"count":   count,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetOptOutKeywords sets the inbound opt-out keywords
+// @Summary Set opt-out keywords
+// @Description Sets keywords (e.g. STOP) that, when received as a whole message, add the sender to the blocklist and emit an OptOut event. An empty list disables detection.
+// @Tags Blocklist
+// @Accept json
+// @Produce json
+// @Param request body OptOutKeywordsBody true "Opt-out keywords"
+// @Success 200 {object} OptOutKeywordsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/blocklist/keywords [post]
+func (s *server) SetOptOutKeywords() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg OptOutKeywordsBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		keywords := []string{}
+		for _, kw := range msg.Keywords {
+			kw = strings.TrimSpace(kw)
+			if kw == "" {
+				continue
+			}
+			if strings.Contains(kw, ",") || len(kw) > maxOptOutKeywordLength {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid keyword %q", kw))
+				return
+			}
+			keywords = append(keywords, kw)
+		}
+
+		_, err := s.db.Exec("UPDATE users SET optout_keywords=$1 WHERE id=$2", strings.Join(keywords, ","), txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"keywords": keywords,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	errCodeBodyTooLarge = "BODY_TOO_LARGE"
+
+	// strictJSONHeader turns strict decoding on or off for one request
+	strictJSONHeader = "X-MaxAPI-Strict-JSON"
+
+	defaultMaxBodyKB      = 2048
+	defaultMaxMediaBodyMB = 100
+)
+
+var (
+	// maxBodyBytes caps the body of most requests, 0 means no limit
+	maxBodyBytes int64 = defaultMaxBodyKB << 10
+	// maxMediaBodyBytes caps the body of requests that carry a file
+	maxMediaBodyBytes int64 = defaultMaxMediaBodyMB << 20
+	// strictJSON rejects unknown fields in request bodies without an
+	// X-MaxAPI-Strict-JSON header
+	strictJSON bool
+)
+
+// initBodyLimits reads MAXAPI_MAX_BODY_KB, MAXAPI_MAX_MEDIA_BODY_MB (0 means no
+// limit) and MAXAPI_STRICT_JSON
+func initBodyLimits() {
+	maxBodyBytes = int64(envInt("MAXAPI_MAX_BODY_KB", defaultMaxBodyKB)) << 10
+	maxMediaBodyBytes = int64(envInt("MAXAPI_MAX_MEDIA_BODY_MB", defaultMaxMediaBodyMB)) << 20
+	strictJSON = parseStrictJSON(os.Getenv("MAXAPI_STRICT_JSON"), false)
+
+	log.Info().Int64("maxBody", maxBodyBytes).Int64("maxMediaBody", maxMediaBodyBytes).Bool("strictJSON", strictJSON).Msg("Request body limits")
+}
+
+// parseStrictJSON reads a boolean setting, def when it is empty or unknown
+func parseStrictJSON(v string, def bool) bool {
+	switch strings.ToLower(v) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	}
+	return def
+}
+
+// bodyLimit returns the largest body accepted on the matched route. Media
+// routes may carry a file, as base64 or as a multipart upload.
+func bodyLimit(r *http.Request) int64 {
+	if rt, ok := currentRoute(r); ok && rt.Media {
+		return maxMediaBodyBytes
+	}
+	return maxBodyBytes
+}
+
+// limitBody rejects bodies larger than the route's limit. A declared
+// Content-Length is checked up front; otherwise reading past the limit fails
+// and the handler answers 413.
+func (s *server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit := bodyLimit(r)
+		if limit > 0 && r.Body != nil && r.Body != http.NoBody {
+			if r.ContentLength > limit {
+				s.respondBodyTooLarge(w, r, limit)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeJSON decodes a JSON request body into v. Unknown fields are rejected
+// when strict decoding is on for the request.
+func decodeJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(r.Body)
+	if parseStrictJSON(r.Header.Get(strictJSONHeader), strictJSON) {
+		decoder.DisallowUnknownFields()
+	}
+	return decoder.Decode(v)
+}
+
+// RespondPayloadError answers a request whose body could not be decoded: 413
+// when it exceeds the limit, 400 otherwise
+func (s *server) RespondPayloadError(w http.ResponseWriter, r *http.Request, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		s.respondBodyTooLarge(w, r, tooLarge.Limit)
+		return
+	}
+	s.Respond(w, r, http.StatusBadRequest, payloadError(err))
+}
+
+// respondBodyTooLarge answers 413 for a body over limit bytes
+func (s *server) respondBodyTooLarge(w http.ResponseWriter, r *http.Request, limit int64) {
+	log.Info().Str("path", r.URL.Path).Int64("contentLength", r.ContentLength).Int64("limit", limit).Msg("Request body exceeds size limit")
+	w.Header().Set("Connection", "close")
+	s.Respond(w, r, http.StatusRequestEntityTooLarge, map[string]interface{}{
+		"success": false,
+		"error":   fmt.Sprintf("request body is larger than %d bytes", limit),
+		"code":    errCodeBodyTooLarge,
+	})
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+	"maxapi/handlers/admin"
+)
+
+const (
+	// maxBulkOperations caps the operations of one bulk request
+	maxBulkOperations = 100
+
+	// fleetStopWorkers bounds how many instances are stopped at the same time
+	fleetStopWorkers = 20
+
+	// fleetStopSettle lets the stopped connection goroutines finish their
+	// cleanup before the instances are started again
+	fleetStopSettle = 500 * time.Millisecond
+)
+
+// CreateUser adds an instance and returns its ID and token
+func (s *server) CreateUser(msg admin.AddUserBody) (string, string, error) {
+	id := uuid.New().String()
+	token := uuid.New().String()
+
+	_, err := s.db.Exec(`INSERT INTO users (id, name, token, webhook, events, connected)
+		VALUES ($1, $2, $3, $4, $5, 0)`, id, msg.Name, storedToken(token), msg.Webhook, msg.Events)
+	if err != nil {
+		return "", "", err
+	}
+	s.recordChange(id, changeEntityUser, "created", id, map[string]interface{}{
+		"name":    msg.Name,
+		"webhook": msg.Webhook,
+		"events":  msg.Events,
+	})
+	return id, token, nil
+}
+
+// UpdateUser changes the name, webhook and events of an instance. It returns
+// false when the instance does not exist.
+func (s *server) UpdateUser(userID string, msg admin.EditUserBody) (bool, error) {
+	res, err := s.db.Exec("UPDATE users SET name=$1, webhook=$2, events=$3 WHERE id=$4",
+		msg.Name, msg.Webhook, msg.Events, userID)
+	if err != nil {
+		return false, err
+	}
+	invalidateUserID(userID)
+
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		s.recordChange(userID, changeEntityUser, "updated", userID, map[string]interface{}{
+			"name":    msg.Name,
+			"webhook": msg.Webhook,
+			"events":  msg.Events,
+		})
+	}
+	return n > 0, nil
+}
+
+// DeleteUser disconnects and deletes an instance. It returns false when the
+// instance does not exist.
+func (s *server) DeleteUser(userID string) (bool, error) {
+	// Disconnect if connected (non-blocking send)
+	if ch := killchannel[userID]; ch != nil {
+		select {
+		case ch <- true:
+			// Signal sent successfully
+		default:
+			// Channel not ready, clean up anyway
+			delete(killchannel, userID)
+		}
+	}
+
+	res, err := s.db.Exec("DELETE FROM users WHERE id=$1", userID)
+	if err != nil {
+		return false, err
+	}
+	invalidateUserID(userID)
+	userConfigs.Delete(userID)
+	featureOverrides.Delete(userID)
+	userAllowlists.Delete(userID)
+	autoMarkReads.Delete(userID)
+	webhookDispatchers.Delete(userID)
+	restrictions.Delete(userID)
+	warmupStates.Delete(userID)
+	contentPolicies.Delete(userID)
+	recipientWindows.Delete(userID)
+	windowStopped.Delete(userID)
+	eventStreams.closeUser(userID)
+
+	n, _ := res.RowsAffected()
+	if n > 0 {
+		s.recordChange(userID, changeEntityUser, "deleted", userID, nil)
+	}
+	return n > 0, nil
+}
+
+// bulkUserOperation applies one operation of a bulk request
+func (s *server) bulkUserOperation(op BulkUserOperation) (BulkUserResult, error) {
+	result := BulkUserResult{Action: op.Action, ID: op.ID}
+
+	if op.Webhook != "" && (op.Action == "create" || op.Action == "update") {
+		if err := api.ValidateWebhookURL(op.Webhook); err != nil {
+			return result, err
+		}
+	}
+
+	switch op.Action {
+	case "create":
+		id, token, err := s.CreateUser(admin.AddUserBody{Name: op.Name, Webhook: op.Webhook, Events: op.Events})
+		if err != nil {
+			return result, err
+		}
+		result.ID, result.Token = id, token
+	case "update", "delete":
+		if op.ID == "" {
+			return result, errors.New("id is required")
+		}
+		var found bool
+		var err error
+		if op.Action == "update" {
+			found, err = s.UpdateUser(op.ID, admin.EditUserBody{Name: op.Name, Webhook: op.Webhook, Events: op.Events})
+		} else {
+			found, err = s.DeleteUser(op.ID)
+		}
+		if err != nil {
+			return result, err
+		}
+		if !found {
+			return result, errors.New("user not found")
+		}
+	default:
+		return result, errors.New("action must be create, update or delete")
+	}
+
+	result.Success = true
+	return result, nil
+}
+
+// stopAllInstances stops every running instance, a few at a time, and
+// returns how many were stopped
+func (s *server) stopAllInstances() int {
+	userIDs := clientManager.UserIDs()
+
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, fleetStopWorkers)
+	for _, userID := range userIDs {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(userID string) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			stopInstance(userID)
+			if _, err := s.db.Exec("UPDATE users SET connected=0 WHERE id=$1", userID); err != nil {
+				log.Error().Err(err).Str("userID", userID).Msg("Failed to update disconnected status")
+			}
+		}(userID)
+	}
+	wg.Wait()
+
+	return len(userIDs)
+}
+
+// ========== BULK ADMIN ENDPOINTS ==========
+
+// BulkUsers creates, updates and deletes several users in one call
+// @Summary Bulk user operations
+// @Description Applies up to 100 operations in order. Each operation has an action: create (name, webhook, events), update (id plus the same fields as PUT /admin/users/{userid}) or delete (id). Operations are independent: a failed one does not stop the others, and the result of each is reported with its index. Tokens of created users are only returned here.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body BulkUsersBody true "Operations"
+// @Success 200 {object} BulkUsersResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/bulk [post]
+func (s *server) BulkUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg BulkUsersBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if len(msg.Operations) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("operations is required"))
+			return
+		}
+		if len(msg.Operations) > maxBulkOperations {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d operations per request", maxBulkOperations))
+			return
+		}
+
+		results := make([]BulkUserResult, 0, len(msg.Operations))
+		succeeded := 0
+		for i, op := range msg.Operations {
+			result, err := s.bulkUserOperation(op)
+			result.Index = i
+			if err != nil {
+				result.Error = err.Error()
+			} else {
+				succeeded++
+			}
+			results = append(results, result)
+		}
+
+		log.Info().Int("succeeded", succeeded).Int("failed", len(results)-succeeded).Msg("Applied bulk user operations")
+
+		response := map[string]interface{}{
+			"success":   true,
+			"succeeded": succeeded,
+			"failed":    len(results) - succeeded,
+			"results":   results,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DisconnectAll disconnects every instance from MAX
+// @Summary Disconnect all instances
+// @Description Stops the MAX connection of every running instance, like POST /session/disconnect for each. Auth tokens are kept, so POST /admin/users/reconnect-all or a restart connects them again.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} FleetOperationResponse
+// @Security AdminAuth
+// @Router /admin/users/disconnect-all [post]
+func (s *server) DisconnectAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stopped := s.stopAllInstances()
+		log.Info().Int("instances", stopped).Msg("Disconnected all instances")
+
+		response := map[string]interface{}{
+			"success": true,
+			"stopped": stopped,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ReconnectAll reconnects every instance that has an auth token
+// @Summary Reconnect all instances
+// @Description Stops every running instance and logs in again every instance that has an auth token, like after a restart. The logins are tracked as a session reconciliation; poll GET /admin/reconciliation for the result. In lazy connect mode the instances connect again on first use.
+// @Tags Admin
+// @Produce json
+// @Success 202 {object} FleetOperationResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/reconnect-all [post]
+func (s *server) ReconnectAll() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if running, _ := reconciler.summary()["running"].(bool); running {
+			s.Respond(w, r, http.StatusConflict, errors.New("reconciliation already running"))
+			return
+		}
+
+		stopped := s.stopAllInstances()
+		time.Sleep(fleetStopSettle)
+		s.connectOnStartup()
+		log.Info().Int("instances", stopped).Msg("Reconnecting all instances")
+
+		response := map[string]interface{}{
+			"success": true,
+			"stopped": stopped,
+			"message": "Reconnecting, see GET /admin/reconciliation",
+		}
+
+		s.Respond(w, r, http.StatusAccepted, response)
+	}
+}
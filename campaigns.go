@@ -0,0 +1,683 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"maxapi/maxclient"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	campaignStatusRunning   = "running"
+	campaignStatusPaused    = "paused"
+	campaignStatusCompleted = "completed"
+	campaignStatusCancelled = "cancelled"
+
+	recipientStatusPending   = "pending"
+	recipientStatusSending   = "sending"
+	recipientStatusSent      = "sent"
+	recipientStatusDelivered = "delivered"
+	recipientStatusRead      = "read"
+	recipientStatusFailed    = "failed"
+
+	maxCampaignRecipients = 10000
+	campaignRetryInterval = 30 * time.Second
+)
+
+// Campaign represents a bulk send job
+type Campaign struct {
+	ID          string `json:"id" db:"id"`
+	UserID      string `json:"-" db:"user_id"`
+	Name        string `json:"name" db:"name"`
+	Template    string `json:"template" db:"template"`
+	Status      string `json:"status" db:"status"`
+	MinDelay    int    `json:"minDelay" db:"min_delay"`
+	MaxDelay    int    `json:"maxDelay" db:"max_delay"`
+	Notify      bool   `json:"notify" db:"notify"`
+	CreatedAt   int64  `json:"createdAt" db:"created_at"`
+	CompletedAt int64  `json:"completedAt,omitempty" db:"completed_at"`
+}
+
+// CampaignRecipient represents a single recipient of a campaign and its delivery status
+type CampaignRecipient struct {
+	ID        int64  `json:"-" db:"id"`
+	Phone     string `json:"phone" db:"phone"`
+	ChatID    int64  `json:"chatId" db:"chat_id"`
+	Variables string `json:"-" db:"variables"`
+	Status    string `json:"status" db:"status"`
+	MessageID string `json:"messageId" db:"message_id"`
+	Error     string `json:"error" db:"error"`
+	SentAt    int64  `json:"sentAt" db:"sent_at"`
+	UpdatedAt int64  `json:"updatedAt" db:"updated_at"`
+}
+
+// campaignRunners tracks the running send loop of each campaign
+var campaignRunners = struct {
+	sync.Mutex
+	stop map[string]chan struct{}
+}{stop: make(map[string]chan struct{})}
+
+// renderTemplate replaces {{key}} placeholders with recipient variables
+func renderTemplate(template string, variables map[string]string) string {
+	pairs := make([]string, 0, len(variables)*2)
+	for k, v := range variables {
+		pairs = append(pairs, "{{"+k+"}}", v)
+	}
+	return strings.NewReplacer(pairs...).Replace(template)
+}
+
+// startCampaigns resumes campaigns that were running when the server stopped
+func (s *server) startCampaigns() {
+	// Sends interrupted by a shutdown are retried
+	s.db.Exec("UPDATE campaign_recipients SET status=$1 WHERE status=$2", recipientStatusPending, recipientStatusSending)
+
+	var ids []string
+	if err := s.db.Select(&ids, "SELECT id FROM campaigns WHERE status=$1", campaignStatusRunning); err != nil {
+		log.Error().Err(err).Msg("Failed to load running campaigns")
+		return
+	}
+	for _, id := range ids {
+		s.startCampaignRunner(id)
+	}
+}
+
+func (s *server) startCampaignRunner(campaignID string) {
+	campaignRunners.Lock()
+	defer campaignRunners.Unlock()
+
+	if _, running := campaignRunners.stop[campaignID]; running {
+		return
+	}
+	stop := make(chan struct{})
+	campaignRunners.stop[campaignID] = stop
+	go s.runCampaign(campaignID, stop)
+}
+
+func stopCampaignRunner(campaignID string) {
+	campaignRunners.Lock()
+	defer campaignRunners.Unlock()
+
+	if stop, running := campaignRunners.stop[campaignID]; running {
+		close(stop)
+		delete(campaignRunners.stop, campaignID)
+	}
+}
+
+// runCampaign drip-sends pending recipients until the campaign is finished or stopped
+func (s *server) runCampaign(campaignID string, stop chan struct{}) {
+	defer func() {
+		campaignRunners.Lock()
+		if campaignRunners.stop[campaignID] == stop {
+			delete(campaignRunners.stop, campaignID)
+		}
+		campaignRunners.Unlock()
+	}()
+
+	wait := func(d time.Duration) bool {
+		select {
+		case <-stop:
+			return false
+		case <-time.After(d):
+			return true
+		}
+	}
+
+	for {
+		var campaign Campaign
+		err := s.db.Get(&campaign, "SELECT id, user_id, name, template, status, min_delay, max_delay, notify, created_at, completed_at FROM campaigns WHERE id=$1", campaignID)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Error().Err(err).Str("campaign", campaignID).Msg("Failed to load campaign")
+			}
+			return
+		}
+		if campaign.Status != campaignStatusRunning {
+			return
+		}
+
+		if !SafeMaxClientStatus(campaign.UserID) {
+			if !wait(campaignRetryInterval) {
+				return
+			}
+			continue
+		}
+
+		if inMaintenance() || s.accountRestriction(campaign.UserID) != nil {
+			if !wait(campaignRetryInterval) {
+				return
+			}
+			continue
+		}
+
+		if until, quiet := s.quietHoursUntil(campaign.UserID, time.Now()); quiet {
+			log.Info().Str("campaign", campaignID).Time("until", until).Msg("Campaign waiting for quiet hours to end")
+			if !wait(time.Until(until)) {
+				return
+			}
+			continue
+		}
+
+		if until, capped := s.warmupUntil(campaign.UserID, time.Now()); capped {
+			log.Info().Str("campaign", campaignID).Time("until", until).Msg("Campaign waiting for the warm-up cap")
+			if !wait(time.Until(until)) {
+				return
+			}
+			continue
+		}
+
+		var recipient CampaignRecipient
+		err = s.db.Get(&recipient, "SELECT id, phone, chat_id, variables, status, message_id, error, sent_at, updated_at FROM campaign_recipients WHERE campaign_id=$1 AND status=$2 ORDER BY id LIMIT 1",
+			campaignID, recipientStatusPending)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.db.Exec("UPDATE campaigns SET status=$1, completed_at=$2 WHERE id=$3 AND status=$4",
+				campaignStatusCompleted, time.Now().Unix(), campaignID, campaignStatusRunning)
+			log.Info().Str("campaign", campaignID).Msg("Campaign completed")
+			return
+		}
+		if err != nil {
+			log.Error().Err(err).Str("campaign", campaignID).Msg("Failed to load campaign recipient")
+			if !wait(campaignRetryInterval) {
+				return
+			}
+			continue
+		}
+
+		if !s.sendCampaignMessage(campaign, recipient) {
+			// Not connected, keep the recipient pending and retry later
+			if !wait(campaignRetryInterval) {
+				return
+			}
+			continue
+		}
+
+		delay := campaign.MinDelay
+		if campaign.MaxDelay > campaign.MinDelay {
+			delay += rand.Intn(campaign.MaxDelay - campaign.MinDelay + 1)
+		}
+		if !wait(time.Duration(delay) * time.Second) {
+			return
+		}
+	}
+}
+
+// sendCampaignMessage sends to a single recipient and records the outcome.
+// It returns false when the send should be retried later.
+func (s *server) sendCampaignMessage(campaign Campaign, recipient CampaignRecipient) bool {
+	var token string
+	if err := s.db.Get(&token, "SELECT token FROM users WHERE id=$1", campaign.UserID); err != nil {
+		log.Error().Err(err).Str("campaign", campaign.ID).Msg("Failed to load campaign owner")
+		return false
+	}
+
+	// Claim the recipient so a runner restarted by pause/resume cannot send it twice
+	res, err := s.db.Exec("UPDATE campaign_recipients SET status=$1 WHERE id=$2 AND status=$3",
+		recipientStatusSending, recipient.ID, recipientStatusPending)
+	if err != nil {
+		return false
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return true
+	}
+
+	variables := map[string]string{}
+	if recipient.Variables != "" {
+		json.Unmarshal([]byte(recipient.Variables), &variables)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"chatId": recipient.ChatID,
+		"phone":  recipient.Phone,
+		"text":   renderTemplate(campaign.Template, variables),
+		"notify": campaign.Notify,
+	})
+
+	rec := s.InternalSend(token, "/chat/send/text", string(body))
+	if rec.Code == http.StatusServiceUnavailable {
+		s.db.Exec("UPDATE campaign_recipients SET status=$1 WHERE id=$2", recipientStatusPending, recipient.ID)
+		return false
+	}
+
+	var result struct {
+		MessageID json.RawMessage `json:"messageId"`
+		ChatID    int64           `json:"chatId"`
+		Error     string          `json:"error"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &result)
+
+	now := time.Now().Unix()
+	if rec.Code == http.StatusOK {
+		chatID := recipient.ChatID
+		if result.ChatID != 0 {
+			chatID = result.ChatID
+		}
+		s.db.Exec("UPDATE campaign_recipients SET status=$1, chat_id=$2, message_id=$3, sent_at=$4, updated_at=$4 WHERE id=$5",
+			recipientStatusSent, chatID, strings.Trim(string(result.MessageID), `"`), now, recipient.ID)
+		return true
+	}
+
+	if result.Error == "" {
+		result.Error = fmt.Sprintf("status %d", rec.Code)
+	}
+	s.db.Exec("UPDATE campaign_recipients SET status=$1, error=$2, updated_at=$3 WHERE id=$4",
+		recipientStatusFailed, result.Error, now, recipient.ID)
+	return true
+}
+
+// trackCampaignReply marks sent campaign messages in a chat as delivered when the recipient writes back.
+// MAX has no explicit delivery receipts, so activity from the recipient is used instead.
+func (mycli *MyClient) trackCampaignReply(msg *maxclient.Message) {
+	if msg.Sender == mycli.MaxClient.MaxUserID {
+		return
+	}
+	_, err := mycli.db.Exec("UPDATE campaign_recipients SET status=$1, updated_at=$2 WHERE user_id=$3 AND chat_id=$4 AND status=$5",
+		recipientStatusDelivered, time.Now().Unix(), mycli.userID, msg.ChatID, recipientStatusSent)
+	if err != nil {
+		log.Error().Err(err).Str("userID", mycli.userID).Msg("Failed to update campaign delivery status")
+	}
+}
+
+// trackCampaignRead marks campaign messages covered by a read mark as read
+func (mycli *MyClient) trackCampaignRead(event maxclient.Event) {
+	receipt, err := maxclient.ParseReadReceiptEvent(event.PayloadMap())
+	if err != nil || receipt.ChatID == 0 {
+		return
+	}
+
+	var candidates []CampaignRecipient
+	err = mycli.db.Select(&candidates, "SELECT id, phone, chat_id, variables, status, message_id, error, sent_at, updated_at FROM campaign_recipients WHERE user_id=$1 AND chat_id=$2 AND status IN ($3, $4)",
+		mycli.userID, receipt.ChatID, recipientStatusSent, recipientStatusDelivered)
+	if err != nil || len(candidates) == 0 {
+		return
+	}
+
+	now := time.Now().Unix()
+	for _, c := range candidates {
+		messageID, _ := strconv.ParseInt(c.MessageID, 10, 64)
+		if receipt.MessageID != 0 && messageID > receipt.MessageID {
+			continue
+		}
+		mycli.db.Exec("UPDATE campaign_recipients SET status=$1, updated_at=$2 WHERE id=$3", recipientStatusRead, now, c.ID)
+	}
+}
+
+// getCampaign loads a campaign owned by the user
+func (s *server) getCampaign(txtid, campaignID string) (*Campaign, error) {
+	var campaign Campaign
+	err := s.db.Get(&campaign, "SELECT id, user_id, name, template, status, min_delay, max_delay, notify, created_at, completed_at FROM campaigns WHERE id=$1 AND user_id=$2",
+		campaignID, txtid)
+	if err != nil {
+		return nil, err
+	}
+	return &campaign, nil
+}
+
+func (s *server) campaignCounts(campaignID string) (map[string]int, int, error) {
+	var rows []struct {
+		Status string `db:"status"`
+		Count  int    `db:"count"`
+	}
+	err := s.db.Select(&rows, "SELECT status, COUNT(*) AS count FROM campaign_recipients WHERE campaign_id=$1 GROUP BY status", campaignID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counts := map[string]int{
+		recipientStatusPending:   0,
+		recipientStatusSent:      0,
+		recipientStatusDelivered: 0,
+		recipientStatusRead:      0,
+		recipientStatusFailed:    0,
+	}
+	total := 0
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+		total += row.Count
+	}
+	return counts, total, nil
+}
+
+// respondCampaign writes the campaign with its progress counters
+func (s *server) respondCampaign(w http.ResponseWriter, r *http.Request, campaign *Campaign) {
+	counts, total, err := s.campaignCounts(campaign.ID)
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":  true,
+		"campaign": campaign,
+		"total":    total,
+		"counts":   counts,
+	}
+
+	s.Respond(w, r, http.StatusOK, response)
+}
+
+// setCampaignStatus moves a campaign to a new status if it is in one of the allowed states
+func (s *server) setCampaignStatus(w http.ResponseWriter, r *http.Request, status string, from ...string) (*Campaign, bool) {
+	txtid := r.Context().Value("userinfo").(Values).Get("Id")
+	campaignID := mux.Vars(r)["campaignid"]
+
+	campaign, err := s.getCampaign(txtid, campaignID)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.Respond(w, r, http.StatusNotFound, errors.New("campaign not found"))
+		return nil, false
+	}
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	if !Find(from, campaign.Status) {
+		s.Respond(w, r, http.StatusConflict, fmt.Errorf("campaign is %s", campaign.Status))
+		return nil, false
+	}
+
+	if _, err := s.db.Exec("UPDATE campaigns SET status=$1 WHERE id=$2", status, campaign.ID); err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	campaign.Status = status
+	return campaign, true
+}
+
+// ========== CAMPAIGN ENDPOINTS ==========
+
+// CreateCampaign creates and starts a campaign
+// @Summary Create campaign
+// @Description Creates a campaign from a recipient list and a text template and starts sending. Placeholders like {{name}} are replaced with recipient variables. Messages are sent one at a time with a random delay between minDelay and maxDelay seconds, respecting quiet hours and the blocklist.
+// @Tags Campaigns
+// @Accept json
+// @Produce json
+// @Param request body CreateCampaignBody true "Campaign data"
+// @Success 200 {object} CampaignResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns [post]
+func (s *server) CreateCampaign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg CreateCampaignBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if strings.TrimSpace(msg.Template) == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("missing template"))
+			return
+		}
+		if len(msg.Recipients) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("missing recipients"))
+			return
+		}
+		if len(msg.Recipients) > maxCampaignRecipients {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("too many recipients, maximum is %d", maxCampaignRecipients))
+			return
+		}
+		for i, rcpt := range msg.Recipients {
+			if rcpt.Phone == "" && rcpt.ChatID == 0 {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("recipient %d: missing phone or chatId", i))
+				return
+			}
+		}
+
+		if msg.MinDelay <= 0 {
+			msg.MinDelay = 5
+		}
+		if msg.MaxDelay < msg.MinDelay {
+			msg.MaxDelay = msg.MinDelay
+		}
+		notify := s.defaultNotify(txtid)
+		if msg.Notify != nil {
+			notify = *msg.Notify
+		}
+
+		campaign := Campaign{
+			ID:        uuid.New().String(),
+			UserID:    txtid,
+			Name:      msg.Name,
+			Template:  msg.Template,
+			Status:    campaignStatusRunning,
+			MinDelay:  msg.MinDelay,
+			MaxDelay:  msg.MaxDelay,
+			Notify:    notify,
+			CreatedAt: time.Now().Unix(),
+		}
+
+		tx, err := s.db.Beginx()
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		defer tx.Rollback()
+
+		_, err = tx.Exec(`INSERT INTO campaigns (id, user_id, name, template, status, min_delay, max_delay, notify, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+			campaign.ID, campaign.UserID, campaign.Name, campaign.Template, campaign.Status,
+			campaign.MinDelay, campaign.MaxDelay, campaign.Notify, campaign.CreatedAt)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		for _, rcpt := range msg.Recipients {
+			variables := ""
+			if len(rcpt.Variables) > 0 {
+				data, _ := json.Marshal(rcpt.Variables)
+				variables = string(data)
+			}
+			_, err = tx.Exec(`INSERT INTO campaign_recipients (campaign_id, user_id, phone, chat_id, variables, status, updated_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				campaign.ID, txtid, rcpt.Phone, rcpt.ChatID, variables, recipientStatusPending, campaign.CreatedAt)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+		}
+
+		if err := tx.Commit(); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.startCampaignRunner(campaign.ID)
+		log.Info().Str("userID", txtid).Str("campaign", campaign.ID).Int("recipients", len(msg.Recipients)).Msg("Campaign created")
+
+		s.respondCampaign(w, r, &campaign)
+	}
+}
+
+// ListCampaigns lists campaigns
+// @Summary List campaigns
+// @Description Returns all campaigns of the instance
+// @Tags Campaigns
+// @Produce json
+// @Success 200 {object} CampaignListResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns [get]
+func (s *server) ListCampaigns() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		campaigns := []Campaign{}
+		err := s.db.Select(&campaigns, "SELECT id, user_id, name, template, status, min_delay, max_delay, notify, created_at, completed_at FROM campaigns WHERE user_id=$1 ORDER BY created_at DESC", txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"campaigns": campaigns,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetCampaign returns campaign progress
+// @Summary Get campaign
+// @Description Returns a campaign with per-status recipient counters
+// @Tags Campaigns
+// @Produce json
+// @Param campaignid path string true "Campaign ID"
+// @Success 200 {object} CampaignResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns/{campaignid} [get]
+func (s *server) GetCampaign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		campaign, err := s.getCampaign(txtid, mux.Vars(r)["campaignid"])
+		if errors.Is(err, sql.ErrNoRows) {
+			s.Respond(w, r, http.StatusNotFound, errors.New("campaign not found"))
+			return
+		}
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.respondCampaign(w, r, campaign)
+	}
+}
+
+// PauseCampaign pauses a running campaign
+// @Summary Pause campaign
+// @Description Stops sending until the campaign is resumed
+// @Tags Campaigns
+// @Produce json
+// @Param campaignid path string true "Campaign ID"
+// @Success 200 {object} CampaignResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns/{campaignid}/pause [post]
+func (s *server) PauseCampaign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := s.setCampaignStatus(w, r, campaignStatusPaused, campaignStatusRunning)
+		if !ok {
+			return
+		}
+		stopCampaignRunner(campaign.ID)
+		s.respondCampaign(w, r, campaign)
+	}
+}
+
+// ResumeCampaign resumes a paused campaign
+// @Summary Resume campaign
+// @Description Continues sending to pending recipients
+// @Tags Campaigns
+// @Produce json
+// @Param campaignid path string true "Campaign ID"
+// @Success 200 {object} CampaignResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns/{campaignid}/resume [post]
+func (s *server) ResumeCampaign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := s.setCampaignStatus(w, r, campaignStatusRunning, campaignStatusPaused)
+		if !ok {
+			return
+		}
+		s.startCampaignRunner(campaign.ID)
+		s.respondCampaign(w, r, campaign)
+	}
+}
+
+// CancelCampaign cancels a campaign
+// @Summary Cancel campaign
+// @Description Stops the campaign permanently. Pending recipients are not sent.
+// @Tags Campaigns
+// @Produce json
+// @Param campaignid path string true "Campaign ID"
+// @Success 200 {object} CampaignResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns/{campaignid}/cancel [post]
+func (s *server) CancelCampaign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		campaign, ok := s.setCampaignStatus(w, r, campaignStatusCancelled, campaignStatusRunning, campaignStatusPaused)
+		if !ok {
+			return
+		}
+		stopCampaignRunner(campaign.ID)
+		s.respondCampaign(w, r, campaign)
+	}
+}
+
+// ExportCampaign exports per-recipient status as CSV
+// @Summary Export campaign report
+// @Description Returns a CSV report with the status of every recipient. sentAt and updatedAt are Unix times; sentAtLocal and updatedAtLocal repeat them as RFC 3339 in the timezone of /user/settings.
+// @Tags Campaigns
+// @Produce text/csv
+// @Param campaignid path string true "Campaign ID"
+// @Success 200 {string} string "CSV report"
+// @Failure 404 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /campaigns/{campaignid}/export [get]
+func (s *server) ExportCampaign() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		campaign, err := s.getCampaign(txtid, mux.Vars(r)["campaignid"])
+		if errors.Is(err, sql.ErrNoRows) {
+			s.Respond(w, r, http.StatusNotFound, errors.New("campaign not found"))
+			return
+		}
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		var recipients []CampaignRecipient
+		err = s.db.Select(&recipients, "SELECT id, phone, chat_id, variables, status, message_id, error, sent_at, updated_at FROM campaign_recipients WHERE campaign_id=$1 ORDER BY id", campaign.ID)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		loc := s.userLocation(txtid)
+
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"campaign-%s.csv\"", campaign.ID))
+
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"phone", "chatId", "status", "messageId", "error", "sentAt", "updatedAt", "sentAtLocal", "updatedAtLocal"})
+		for _, rcpt := range recipients {
+			cw.Write([]string{
+				rcpt.Phone,
+				strconv.FormatInt(rcpt.ChatID, 10),
+				rcpt.Status,
+				rcpt.MessageID,
+				rcpt.Error,
+				strconv.FormatInt(rcpt.SentAt, 10),
+				strconv.FormatInt(rcpt.UpdatedAt, 10),
+				formatLocalTime(rcpt.SentAt, loc),
+				formatLocalTime(rcpt.UpdatedAt, loc),
+			})
+		}
+		cw.Flush()
+	}
+}
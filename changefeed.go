@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	changeEntityMessage = "message"
+	changeEntityChat    = "chat"
+	changeEntityUser    = "user"
+
+	defaultChangefeedRetentionDays = 7
+	changefeedTrimInterval         = time.Hour
+	defaultChangefeedLimit         = 100
+	maxChangefeedLimit             = 1000
+	changefeedColumns              = 6
+
+	// changefeedSettle holds back recent changes. Concurrent inserts may commit
+	// out of cursor order, so a change is served once all before it committed.
+	changefeedSettle = 2 * time.Second
+)
+
+// changefeedRetention is how long changes are kept, 0 when the changefeed is disabled
+var changefeedRetention time.Duration
+
+// Change is an entry of the changefeed. Cursor grows with every change, so a
+// consumer that stores the last cursor it applied never misses or repeats one.
+type Change struct {
+	Cursor    int64           `json:"cursor" db:"id" example:"1042"`
+	UserID    string          `json:"userId" db:"user_id" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
+	Entity    string          `json:"entity" db:"entity" example:"message"`
+	Action    string          `json:"action" db:"action" example:"stored"`
+	EntityID  string          `json:"entityId" db:"entity_id" example:"115234567890123456"`
+	Data      json.RawMessage `json:"data" db:"-" swaggertype:"object"`
+	RawData   string          `json:"-" db:"data"`
+	CreatedAt int64           `json:"createdAt" db:"created_at" example:"1700000000"`
+	// Undecryptable is set, and data is null, when the stored data could not be decrypted
+	Undecryptable bool `json:"undecryptable,omitempty" db:"-"`
+}
+
+// startChangefeed reads the retention (CHANGEFEED_RETENTION_DAYS, 0 disables
+// the changefeed) and removes expired changes periodically
+func (s *server) startChangefeed() {
+	days := envInt("CHANGEFEED_RETENTION_DAYS", defaultChangefeedRetentionDays)
+	if days == 0 {
+		log.Info().Msg("Changefeed disabled")
+		return
+	}
+	changefeedRetention = time.Duration(days) * 24 * time.Hour
+
+	go func() {
+		ticker := time.NewTicker(changefeedTrimInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			cutoff := time.Now().Add(-changefeedRetention).Unix()
+			if _, err := s.db.Exec("DELETE FROM changefeed WHERE created_at < $1", cutoff); err != nil {
+				log.Error().Err(err).Msg("Failed to trim changefeed")
+			}
+		}
+	}()
+}
+
+// changeRow is a change waiting to be written to the changefeed
+type changeRow struct {
+	userID    string
+	entity    string
+	action    string
+	entityID  string
+	data      string
+	createdAt int64
+	attempts  int
+}
+
+// recordChange appends a state change to the changefeed. The data is encrypted
+// like message history when HISTORY_ENCRYPTION_KEY is set.
+func (s *server) recordChange(userID, entity, action, entityID string, data map[string]interface{}) {
+	row, ok := newChangeRow(userID, entity, action, entityID, data)
+	if !ok {
+		return
+	}
+	if err := s.insertChanges([]changeRow{row}); err != nil {
+		log.Error().Err(err).Str("userID", userID).Str("entity", entity).Str("action", action).Msg("Failed to record change")
+	}
+}
+
+// newChangeRow encodes and encrypts a change, false when the changefeed is
+// disabled or the data could not be encrypted
+func newChangeRow(userID, entity, action, entityID string, data map[string]interface{}) (changeRow, bool) {
+	if changefeedRetention == 0 {
+		return changeRow{}, false
+	}
+
+	raw, _ := json.Marshal(data)
+	stored, err := encryptField(userID, string(raw))
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to encrypt change")
+		return changeRow{}, false
+	}
+	return changeRow{
+		userID:    userID,
+		entity:    entity,
+		action:    action,
+		entityID:  entityID,
+		data:      stored,
+		createdAt: time.Now().Unix(),
+	}, true
+}
+
+// insertChanges writes changes with a single multi-row INSERT
+func (s *server) insertChanges(rows []changeRow) error {
+	var query strings.Builder
+	query.WriteString(`INSERT INTO changefeed (user_id, entity, action, entity_id, data, created_at) VALUES `)
+
+	args := make([]interface{}, 0, len(rows)*changefeedColumns)
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for c := 1; c <= changefeedColumns; c++ {
+			if c > 1 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", i*changefeedColumns+c)
+		}
+		query.WriteString(")")
+		args = append(args, row.userID, row.entity, row.action, row.entityID, row.data, row.createdAt)
+	}
+
+	_, err := s.db.Exec(query.String(), args...)
+	return err
+}
+
+// chatChange keeps the fields of a MAX chat that a ChatUpdate change records.
+// The chat object also carries the last message, which is content and must
+// not outlive an erase of the stored messages.
+func chatChange(chat map[string]interface{}) map[string]interface{} {
+	data := map[string]interface{}{"chatId": chat["id"]}
+	for _, field := range []string{"type", "status", "title", "participantsCount", "modified"} {
+		if value, ok := chat[field]; ok {
+			data[field] = value
+		}
+	}
+	return data
+}
+
+// listChanges returns up to limit changes after cursor, of one user when userID is set
+func (s *server) listChanges(userID, entity string, cursor int64, limit int) ([]Change, error) {
+	query := "SELECT * FROM changefeed WHERE id > $1 AND created_at <= $2"
+	args := []interface{}{cursor, time.Now().Add(-changefeedSettle).Unix()}
+	if userID != "" {
+		args = append(args, userID)
+		query += fmt.Sprintf(" AND user_id = $%d", len(args))
+	}
+	if entity != "" {
+		args = append(args, entity)
+		query += fmt.Sprintf(" AND entity = $%d", len(args))
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY id LIMIT $%d", len(args))
+
+	changes := []Change{}
+	if err := s.db.Select(&changes, query, args...); err != nil {
+		return nil, err
+	}
+	for i := range changes {
+		data, err := decryptField(changes[i].UserID, changes[i].RawData)
+		if err != nil || !json.Valid([]byte(data)) {
+			// The cursor moves past it, so a bad row does not stall the feed
+			log.Error().Err(err).Str("userID", changes[i].UserID).Int64("cursor", changes[i].Cursor).Msg("Failed to decrypt change")
+			changes[i].Data, changes[i].Undecryptable = json.RawMessage("null"), true
+			continue
+		}
+		changes[i].Data = json.RawMessage(data)
+	}
+	return changes, nil
+}
+
+// respondChanges serves a page of the changefeed
+func (s *server) respondChanges(w http.ResponseWriter, r *http.Request, userID string) {
+	if changefeedRetention == 0 {
+		s.Respond(w, r, http.StatusServiceUnavailable, errors.New("changefeed is disabled"))
+		return
+	}
+
+	var cursor int64
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("invalid cursor"))
+			return
+		}
+		cursor = n
+	}
+
+	limit := defaultChangefeedLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxChangefeedLimit {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxChangefeedLimit))
+			return
+		}
+		limit = n
+	}
+
+	entity := r.URL.Query().Get("entity")
+	switch entity {
+	case "", changeEntityMessage, changeEntityChat, changeEntityUser:
+	default:
+		s.Respond(w, r, http.StatusBadRequest, errors.New("entity must be message, chat or user"))
+		return
+	}
+
+	// One more than asked tells whether another page follows
+	changes, err := s.listChanges(userID, entity, cursor, limit+1)
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return
+	}
+	hasMore := len(changes) > limit
+	if hasMore {
+		changes = changes[:limit]
+	}
+	next := cursor
+	if len(changes) > 0 {
+		next = changes[len(changes)-1].Cursor
+	}
+
+	response := map[string]interface{}{
+		"success":    true,
+		"changes":    changes,
+		"count":      len(changes),
+		"nextCursor": next,
+		"hasMore":    hasMore,
+	}
+
+	s.Respond(w, r, http.StatusOK, response)
+}
+
+// ========== CHANGEFEED ENDPOINTS ==========
+
+// GetChangefeed lists the state changes of the instance
+// @Summary Get changefeed
+// @Description Returns the state changes of the instance in the order they happened: messages stored in history, chat updates and changes of the instance itself. Pass the returned nextCursor as cursor to get the following changes; it stays the same while nothing new happened. entity (message, chat or user) limits the changes to one kind. Changes are served about two seconds after they happen, once their order is final, and kept for CHANGEFEED_RETENTION_DAYS days.
+// @Tags Changefeed
+// @Produce json
+// @Param cursor query int false "Cursor of the last applied change (default 0, from the start)"
+// @Param limit query int false "Changes per page (default 100, max 1000)"
+// @Param entity query string false "Only changes of message, chat or user"
+// @Success 200 {object} ChangefeedResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /changefeed [get]
+func (s *server) GetChangefeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		s.respondChanges(w, r, txtid)
+	}
+}
+
+// GetAdminChangefeed lists the state changes of all instances
+// @Summary Get changefeed of all users
+// @Description Returns the changefeed of every instance, or of the instance userId, including the creation, changes and deletion of instances. Paging works like GET /changefeed.
+// @Tags Admin
+// @Produce json
+// @Param userId query string false "Only changes of this user"
+// @Param cursor query int false "Cursor of the last applied change (default 0, from the start)"
+// @Param limit query int false "Changes per page (default 100, max 1000)"
+// @Param entity query string false "Only changes of message, chat or user"
+// @Success 200 {object} ChangefeedResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/changefeed [get]
+func (s *server) GetAdminChangefeed() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.respondChanges(w, r, r.URL.Query().Get("userId"))
+	}
+}
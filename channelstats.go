@@ -0,0 +1,140 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"maxapi/maxclient"
+)
+
+// ChannelPostStats holds the reach of one channel post. The protocol reports
+// reactions per message but no view counts.
+type ChannelPostStats struct {
+	MessageID string                      `json:"messageId" example:"115234567890123456"`
+	Timestamp int64                       `json:"timestamp" example:"1700000000"`
+	Reactions int                         `json:"reactions" example:"42"`
+	Counters  []maxclient.ReactionCounter `json:"counters"`
+}
+
+// isChatAdmin reports whether a MAX user owns or administers a chat
+func isChatAdmin(chat *maxclient.Chat, maxUserID int64) bool {
+	if maxUserID == 0 {
+		return false
+	}
+	if chat.Owner == maxUserID {
+		return true
+	}
+	for _, id := range chat.Admins {
+		if id == maxUserID {
+			return true
+		}
+	}
+	_, ok := chat.AdminParticipants[strconv.FormatInt(maxUserID, 10)]
+	return ok
+}
+
+// GetChannelStats returns subscriber and post statistics of a channel
+// @Summary Channel statistics
+// @Description Returns the subscriber and message counts of a channel the account owns or administers, and the reactions on its most recent posts stored in the message history. MAX does not report post views, so no view counts are returned.
+// @Tags Channel
+// @Produce json
+// @Param chatId query int true "Channel chat ID"
+// @Param posts query int false "Number of recent posts (default 20, max 100, 0 for none)"
+// @Success 200 {object} ChannelStatsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /channel/stats [get]
+func (s *server) GetChannelStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		chatID, err := strconv.ParseInt(r.URL.Query().Get("chatId"), 10, 64)
+		if err != nil || chatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("missing or invalid chatId"))
+			return
+		}
+
+		posts := 20
+		if v := r.URL.Query().Get("posts"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 || n > 100 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("posts must be between 0 and 100"))
+				return
+			}
+			posts = n
+		}
+
+		chat, err := client.GetChat(chatID)
+		if err != nil {
+			s.Respond(w, r, http.StatusNotFound, fmt.Errorf("chat not found: %v", err))
+			return
+		}
+		if chat.Type != maxclient.ChatTypeChannel {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("chat is not a channel"))
+			return
+		}
+		if !isChatAdmin(chat, client.MaxUserID) {
+			s.Respond(w, r, http.StatusForbidden, errors.New("the account does not administer this channel"))
+			return
+		}
+
+		postStats := []ChannelPostStats{}
+		if posts > 0 {
+			history, err := s.getMessageHistory(txtid, strconv.FormatInt(chatID, 10), posts)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+
+			ids := make([]string, 0, len(history))
+			for _, msg := range history {
+				ids = append(ids, msg.MessageID)
+			}
+
+			reactions := map[string]*maxclient.ReactionInfo{}
+			if len(ids) > 0 {
+				if reactions, err = client.GetReactions(chatID, ids); err != nil {
+					s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get reactions: %v", err))
+					return
+				}
+			}
+
+			for _, msg := range history {
+				post := ChannelPostStats{
+					MessageID: msg.MessageID,
+					Timestamp: msg.Timestamp.Unix(),
+					Counters:  []maxclient.ReactionCounter{},
+				}
+				if info := reactions[msg.MessageID]; info != nil {
+					post.Reactions = info.TotalCount
+					if info.Counters != nil {
+						post.Counters = info.Counters
+					}
+				}
+				postStats = append(postStats, post)
+			}
+		}
+
+		response := map[string]interface{}{
+			"success":       true,
+			"chatId":        chat.ID,
+			"title":         chat.Title,
+			"subscribers":   chat.ParticipantsCount,
+			"messagesCount": chat.MessagesCount,
+			"posts":         postStats,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+// sendChatUpdate notifies the webhook of a chat deleted or cleared through the API,
+// since MAX does not send a notification to the session that made the change
+func sendChatUpdate(txtid string, chatID int64, action string) {
+	mycli := clientManager.GetMyClient(txtid)
+	if mycli == nil {
+		return
+	}
+	postmap := map[string]interface{}{
+		"type":   "ChatUpdate",
+		"manual": true,
+		"event": map[string]interface{}{
+			"chatId": chatID,
+			"action": action,
+		},
+	}
+	sendEventWithWebHook(mycli, postmap, "")
+}
+
+// DeleteChat deletes a chat
+// @Summary Delete chat
+// @Description Deletes a chat or dialog from the chat list of the account, together with its history. Requires confirm=true. A ChatUpdate event with action delete is sent when it is done.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ChatConfirmBody true "Chat ID and confirmation"
+// @Success 200 {object} ChatActionResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/deletechat [post]
+func (s *server) DeleteChat() http.HandlerFunc {
+	return s.chatAction("delete", "deleted", (*maxclient.Client).DeleteChat)
+}
+
+// ClearChatHistory clears the history of a chat
+// @Summary Clear chat history
+// @Description Deletes all messages of a chat for the account while keeping the chat. Requires confirm=true. A ChatUpdate event with action clear is sent when it is done.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ChatConfirmBody true "Chat ID and confirmation"
+// @Success 200 {object} ChatActionResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/clearhistory [post]
+func (s *server) ClearChatHistory() http.HandlerFunc {
+	return s.chatAction("clear", "cleared", (*maxclient.Client).ClearChatHistory)
+}
+
+// chatAction runs a destructive chat operation after checking the confirmation.
+// change is the action recorded in the changefeed.
+func (s *server) chatAction(action, change string, run func(client *maxclient.Client, chatID int64) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ChatConfirmBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+		if !msg.Confirm {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("confirm must be true"))
+			return
+		}
+
+		if err := run(client, msg.ChatID); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("%s chat failed: %v", action, err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Str("action", action).Msg("Chat changed")
+		sendChatUpdate(txtid, msg.ChatID, action)
+		s.recordChange(txtid, changeEntityChat, change, strconv.FormatInt(msg.ChatID, 10), map[string]interface{}{"chatId": msg.ChatID})
+
+		response := map[string]interface{}{
+			"success": true,
+			"chatId":  msg.ChatID,
+			"action":  action,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
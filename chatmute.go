@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/handlers/chat"
+	"maxapi/handlers/group"
+	"maxapi/maxclient"
+)
+
+// MuteChat turns off notifications of a chat
+// @Summary Mute chat
+// @Description Turns off notifications of a chat, until the Unix time until or, when until is 0 or left out, until the chat is unmuted. Chat listings report the mute in muted and muteUntil.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body MuteChatBody true "Chat and mute end"
+// @Success 200 {object} ChatMuteResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/mute [post]
+func (s *server) MuteChat() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg MuteChatBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+
+		until := maxclient.MuteForever
+		if msg.Until != 0 {
+			if msg.Until <= time.Now().Unix() {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("until must be in the future"))
+				return
+			}
+			until = msg.Until * 1000
+		}
+
+		if err := client.MuteChat(msg.ChatID, until); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("mute failed: %v", err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Int64("until", msg.Until).Msg("Chat muted")
+		s.recordChange(txtid, changeEntityChat, "muted", strconv.FormatInt(msg.ChatID, 10), map[string]interface{}{
+			"chatId":    msg.ChatID,
+			"muteUntil": chat.MuteUntilSeconds(until),
+		})
+
+		response := map[string]interface{}{
+			"success":   true,
+			"chatId":    msg.ChatID,
+			"muted":     true,
+			"muteUntil": chat.MuteUntilSeconds(until),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// UnmuteChat turns notifications of a chat back on
+// @Summary Unmute chat
+// @Description Turns notifications of a muted chat back on
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body group.GroupInfoBody true "Chat ID"
+// @Success 200 {object} ChatMuteResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/unmute [post]
+func (s *server) UnmuteChat() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg group.GroupInfoBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+
+		if err := client.UnmuteChat(msg.ChatID); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("unmute failed: %v", err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Msg("Chat unmuted")
+		s.recordChange(txtid, changeEntityChat, "unmuted", strconv.FormatInt(msg.ChatID, 10), map[string]interface{}{"chatId": msg.ChatID})
+
+		response := map[string]interface{}{
+			"success":   true,
+			"chatId":    msg.ChatID,
+			"muted":     false,
+			"muteUntil": 0,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
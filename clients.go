@@ -5,8 +5,19 @@ import (
 	"sync"
 
 	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog"
 )
 
+// maxEndpoint overrides the MAX WebSocket URL, e.g. with the load test mock server
+var maxEndpoint string
+
+// newMaxClient creates a MAX client for the configured endpoint
+func newMaxClient(deviceID string, logger zerolog.Logger) *maxclient.Client {
+	client := maxclient.NewClient(deviceID, logger)
+	client.Endpoint = maxEndpoint
+	return client
+}
+
 // ClientManager manages MAX API clients
 type ClientManager struct {
 	sync.RWMutex
@@ -96,6 +107,30 @@ func (cm *ClientManager) UpdateMyClientSubscriptions(userID string, subscription
 	}
 }
 
+// ConnectionCounts returns the number of MAX clients and how many of them are connected
+func (cm *ClientManager) ConnectionCounts() (clients int, connected int) {
+	cm.RLock()
+	defer cm.RUnlock()
+	for _, client := range cm.maxClients {
+		clients++
+		if client.IsConnected() {
+			connected++
+		}
+	}
+	return clients, connected
+}
+
+// UserIDs returns the users that have a MAX client
+func (cm *ClientManager) UserIDs() []string {
+	cm.RLock()
+	defer cm.RUnlock()
+	userIDs := make([]string, 0, len(cm.maxClients))
+	for userID := range cm.maxClients {
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs
+}
+
 // IsConnected checks if a user has an active MAX connection
 func (cm *ClientManager) IsConnected(userID string) bool {
 	cm.RLock()
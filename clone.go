@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// clonedUserColumns are the settings copied to a cloned instance. MAX
+// credentials, the webhook secret, restrictions and settings that refer to
+// chats or contacts of the account are not copied.
+var clonedUserColumns = []string{
+	"webhook", "events", "proxy_url", "history",
+	"s3_enabled", "s3_endpoint", "s3_region", "s3_bucket", "s3_access_key", "s3_secret_key",
+	"s3_path_style", "s3_public_url", "media_delivery", "s3_retention_days", "s3_presign_ttl",
+	"storage_backend", "azure_account", "azure_container", "azure_sas_token",
+	"quiet_hours_enabled", "quiet_hours_start", "quiet_hours_end", "quiet_hours_timezone",
+	"optout_keywords", "redaction", "user_config", "features", "allowed_ips",
+	"content_policy", "connection_window", "locale", "timezone",
+}
+
+// cloneUser creates an instance with the settings of another one. It returns
+// false when the source instance does not exist.
+func (s *server) cloneUser(sourceID, name string) (string, string, bool, error) {
+	id := uuid.New().String()
+	token := uuid.New().String()
+
+	columns := strings.Join(clonedUserColumns, ", ")
+	res, err := s.db.Exec(`INSERT INTO users (id, name, token, connected, `+columns+`)
+		SELECT $1, $2, $3, 0, `+columns+` FROM users WHERE id = $4`, id, name, storedToken(token), sourceID)
+	if err != nil {
+		return "", "", false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return "", "", false, nil
+	}
+	s.recordChange(id, changeEntityUser, "created", id, map[string]interface{}{
+		"name":     name,
+		"sourceId": sourceID,
+	})
+	return id, token, true, nil
+}
+
+// CloneUser creates a user with the settings of another one
+// @Summary Clone user
+// @Description Creates a new instance with the settings of an existing one: webhook, events, proxy, history, media storage (S3 or Azure), quiet hours, opt-out keywords, redaction, per-user config, feature overrides, IP allowlist, content policy, connection window, locale and timezone. The MAX login, webhook secret, blocklist and settings tied to chats or contacts of the account are not copied, so the new instance has to be authenticated. name defaults to the name of the source with " (copy)" appended.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userid path string true "User ID of the source instance"
+// @Param request body CloneUserBody false "Name of the new instance"
+// @Success 200 {object} CloneUserResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/clone [post]
+func (s *server) CloneUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sourceID := mux.Vars(r)["userid"]
+
+		var msg CloneUserBody
+		if r.ContentLength != 0 {
+			if err := decodeJSON(r, &msg); err != nil {
+				s.RespondPayloadError(w, r, err)
+				return
+			}
+		}
+
+		var sourceName string
+		if err := s.db.Get(&sourceName, "SELECT name FROM users WHERE id = $1", sourceID); err != nil {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		name := strings.TrimSpace(msg.Name)
+		if name == "" {
+			name = sourceName + " (copy)"
+		}
+
+		id, token, found, err := s.cloneUser(sourceID, name)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if !found {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		log.Info().Str("sourceID", sourceID).Str("userID", id).Msg("User cloned")
+
+		response := map[string]interface{}{
+			"success":  true,
+			"id":       id,
+			"token":    token,
+			"name":     name,
+			"sourceId": sourceID,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
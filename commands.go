@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+	"maxapi/handlers/chat"
+	"maxapi/maxclient"
+)
+
+const (
+	defaultCommandPrefix  = "/"
+	defaultCommandTimeout = 10 // seconds
+	maxCommandTimeout     = 30 // seconds
+	maxCommandPrefixLen   = 16
+)
+
+// CommandsConfig routes incoming messages that start with Prefix to a handler
+// URL and sends its reply back to the chat. Timeout is in seconds (0 = 10).
+// @Description Posts incoming messages that start with prefix (/ by default) to url and sends the JSON reply (text, attachments, buttons) back to the chat. An empty url turns commands off.
+type CommandsConfig struct {
+	URL     string `json:"url" example:"https://bot.example.com/commands"`
+	Prefix  string `json:"prefix" example:"/"`
+	Timeout int    `json:"timeout" example:"10"`
+}
+
+// CommandRequest is posted to the command handler for a matching message
+type CommandRequest struct {
+	UserID    string `json:"userID" example:"a1b2c3"`
+	ChatID    int64  `json:"chatId" example:"123456789"`
+	Sender    int64  `json:"sender" example:"987654321"`
+	MessageID string `json:"messageId" example:"115234567890123456"`
+	Text      string `json:"text" example:"/weather Moscow"`
+	Command   string `json:"command" example:"weather"`
+	Args      string `json:"args" example:"Moscow"`
+	Time      int64  `json:"time" example:"1700000000"`
+}
+
+// CommandReply is the response of a command handler. Buttons are appended to
+// the text as lines, as MAX user accounts cannot send keyboards.
+type CommandReply struct {
+	Text        string                `json:"text" example:"Sunny, +21°C"`
+	Format      string                `json:"format" example:"markdown" enums:"plain,markdown"`
+	Elements    []chat.MessageElement `json:"elements"`
+	Reply       bool                  `json:"reply" example:"true"`
+	Attachments []CommandAttachment   `json:"attachments"`
+	Buttons     []string              `json:"buttons" example:"Today,Tomorrow"`
+}
+
+// CommandAttachment is a file sent with a command reply, as data URL, URL or base64
+type CommandAttachment struct {
+	Type     string `json:"type" example:"image" enums:"image,document,video,audio"`
+	Data     string `json:"data" example:"https://example.com/forecast.png"`
+	Caption  string `json:"caption" example:"Forecast"`
+	FileName string `json:"fileName" example:"forecast.png"`
+}
+
+var commandClient = resty.New()
+
+// validateCommands checks command routing settings and fills in defaults
+func validateCommands(config *CommandsConfig) error {
+	if config.URL == "" {
+		*config = CommandsConfig{}
+		return nil
+	}
+	if err := api.ValidateWebhookURL(config.URL); err != nil {
+		return fmt.Errorf("commands: %w", err)
+	}
+	if config.Prefix == "" {
+		config.Prefix = defaultCommandPrefix
+	}
+	if len(config.Prefix) > maxCommandPrefixLen {
+		return fmt.Errorf("commands: prefix must be at most %d bytes", maxCommandPrefixLen)
+	}
+	if config.Timeout < 0 || config.Timeout > maxCommandTimeout {
+		return fmt.Errorf("commands: timeout must be between 0 and %d seconds", maxCommandTimeout)
+	}
+	return nil
+}
+
+// parseCommand splits a message text into the command and its arguments. It
+// returns false when the text does not start with the prefix.
+func parseCommand(text, prefix string) (string, string, bool) {
+	if prefix == "" || !strings.HasPrefix(text, prefix) {
+		return "", "", false
+	}
+	command, args, _ := strings.Cut(strings.TrimPrefix(text, prefix), " ")
+	if command == "" {
+		return "", "", false
+	}
+	return command, strings.TrimSpace(args), true
+}
+
+// routeCommand posts an incoming command to the user's command handler and
+// sends the reply to the chat. The handler is called in the background, as the
+// receive loop must not wait on it.
+func (mycli *MyClient) routeCommand(msg *maxclient.Message) {
+	if msg.Text == "" || msg.Sender == mycli.MaxClient.MaxUserID {
+		return
+	}
+	config, err := mycli.s.getUserConfig(mycli.userID)
+	if err != nil || config.Commands.URL == "" {
+		return
+	}
+	command, args, ok := parseCommand(msg.Text, config.Commands.Prefix)
+	if !ok {
+		return
+	}
+
+	request := CommandRequest{
+		UserID:    mycli.userID,
+		ChatID:    msg.ChatID,
+		Sender:    msg.Sender,
+		MessageID: msg.ID,
+		Text:      msg.Text,
+		Command:   command,
+		Args:      args,
+		Time:      time.Now().Unix(),
+	}
+	goTracked(mycli.userID, func() {
+		reply, err := mycli.callCommandHandler(config.Commands, request)
+		if err != nil {
+			log.Warn().Err(err).Str("userID", mycli.userID).Str("command", command).Msg("Command handler failed")
+			return
+		}
+		if reply == nil {
+			return
+		}
+		mycli.sendCommandReply(request, reply)
+	})
+}
+
+// callCommandHandler posts a command and decodes the reply, nil when the
+// handler has nothing to send
+func (mycli *MyClient) callCommandHandler(config CommandsConfig, request CommandRequest) (*CommandReply, error) {
+	body, _ := json.Marshal(request)
+	timeout := time.Duration(config.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout * time.Second
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	req := commandClient.R().
+		SetContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body)
+	signWebhook(req, mycli.s.WebhookSecret(mycli.userID), body)
+
+	resp, err := req.Post(config.URL)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode() >= 300 {
+		return nil, fmt.Errorf("handler returned status %d", resp.StatusCode())
+	}
+	if len(strings.TrimSpace(string(resp.Body()))) == 0 {
+		return nil, nil
+	}
+
+	var reply CommandReply
+	if err := json.Unmarshal(resp.Body(), &reply); err != nil {
+		return nil, errors.New("handler returned invalid JSON")
+	}
+	if reply.Text == "" && len(reply.Attachments) == 0 && len(reply.Buttons) == 0 {
+		return nil, nil
+	}
+	return &reply, nil
+}
+
+// sendCommandReply sends a handler's reply through the send endpoints, text
+// first and then each attachment
+func (mycli *MyClient) sendCommandReply(request CommandRequest, reply *CommandReply) {
+	text := reply.Text
+	if len(reply.Buttons) > 0 {
+		lines := make([]string, 0, len(reply.Buttons)+1)
+		if text != "" {
+			lines = append(lines, text, "")
+		}
+		for _, button := range reply.Buttons {
+			lines = append(lines, "• "+button)
+		}
+		text = strings.Join(lines, "\n")
+	}
+
+	if text != "" {
+		body := chat.MessageBody{ChatID: request.ChatID, Text: text, Format: reply.Format, Elements: reply.Elements}
+		if reply.Reply {
+			body.ReplyTo = maxclient.MessageID(request.MessageID)
+		}
+		mycli.sendCommandPart(request, "/chat/send/text", body)
+	}
+
+	for _, attachment := range reply.Attachments {
+		switch attachment.Type {
+		case "image":
+			mycli.sendCommandPart(request, "/chat/send/image", chat.ImageBody{ChatID: request.ChatID, Image: attachment.Data, Caption: attachment.Caption})
+		case "document":
+			mycli.sendCommandPart(request, "/chat/send/document", chat.DocumentBody{ChatID: request.ChatID, Document: attachment.Data, FileName: attachment.FileName, Caption: attachment.Caption})
+		case "video":
+			mycli.sendCommandPart(request, "/chat/send/video", chat.VideoBody{ChatID: request.ChatID, Video: attachment.Data, FileName: attachment.FileName, Caption: attachment.Caption})
+		case "audio":
+			mycli.sendCommandPart(request, "/chat/send/audio", chat.AudioBody{ChatID: request.ChatID, Audio: attachment.Data, FileName: attachment.FileName})
+		default:
+			log.Warn().Str("userID", mycli.userID).Str("type", attachment.Type).Msg("Unknown command reply attachment type")
+		}
+	}
+}
+
+// sendCommandPart sends one part of a command reply as the instance
+func (mycli *MyClient) sendCommandPart(request CommandRequest, path string, body interface{}) {
+	raw, _ := json.Marshal(body)
+	rec := mycli.s.InternalSend(mycli.token, path, string(raw))
+	if rec.Code >= 300 {
+		log.Warn().Str("userID", mycli.userID).Str("command", request.Command).Str("path", path).Int("status", rec.Code).Str("response", truncateString(rec.Body.String(), 200)).Msg("Failed to send command reply")
+		return
+	}
+	log.Info().Str("userID", mycli.userID).Str("command", request.Command).Str("path", path).Msg("Command reply sent")
+}
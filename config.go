@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+)
+
+// Config holds settings loaded from the optional JSON configuration file.
+// Settings left out keep the value from the command line or the environment.
+type Config struct {
+	LogLevel       string                   `json:"logLevel"`      // trace, debug, info, warn or error
+	GlobalWebhook  *string                  `json:"globalWebhook"` // "" disables the global webhook
+	ResourceLimits *ResourceLimitsConfig    `json:"resourceLimits"`
+	Reconnect      *ReconnectConfig         `json:"reconnect"`
+	RabbitMQ       RabbitMQConfig           `json:"rabbitmq"`
+	Features       map[string]FeatureConfig `json:"features"`
+}
+
+// FeatureConfig sets a feature flag for the whole deployment
+type FeatureConfig struct {
+	Enabled bool `json:"enabled"` // on for every user
+	Rollout int  `json:"rollout"` // otherwise on for this percentage of users (0-100)
+}
+
+// ResourceLimitsConfig overrides the per-instance resource caps (0 = unlimited)
+type ResourceLimitsConfig struct {
+	Goroutines     *int `json:"goroutines"`
+	PendingEvents  *int `json:"pendingEvents"`
+	PendingMediaMB *int `json:"pendingMediaMB"`
+}
+
+// ReconnectConfig overrides how a lost MAX connection is retried
+type ReconnectConfig struct {
+	MaxAttempts  *int `json:"maxAttempts"`
+	DelaySeconds *int `json:"delaySeconds"`
+}
+
+// RabbitMQConfig holds the RabbitMQ sink definitions
+// @Description RabbitMQ sinks of the user's events. They replace the sinks of the configuration file and the default queue; an empty list restores the global routing. Exchanges and queues are declared on the broker before they are saved, and when RABBITMQ_USER_PREFIX is set their names must start with it.
+type RabbitMQConfig struct {
+	Sinks []RabbitSink `json:"sinks"`
+}
+
+// appConfig is replaced as a whole when the configuration file is reloaded
+var appConfig atomic.Pointer[Config]
+
+func init() {
+	appConfig.Store(&Config{})
+}
+
+// currentConfig returns the loaded configuration file
+func currentConfig() *Config {
+	return appConfig.Load()
+}
+
+// readConfig reads and validates the configuration file at path
+func readConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var cfg Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config file: %w", err)
+	}
+
+	if cfg.LogLevel != "" {
+		if _, err := zerolog.ParseLevel(cfg.LogLevel); err != nil {
+			return nil, fmt.Errorf("logLevel: unknown level %q", cfg.LogLevel)
+		}
+	}
+	if cfg.GlobalWebhook != nil && *cfg.GlobalWebhook != "" {
+		if err := api.ValidateWebhookURL(*cfg.GlobalWebhook); err != nil {
+			return nil, fmt.Errorf("globalWebhook: %w", err)
+		}
+	}
+	if l := cfg.ResourceLimits; l != nil {
+		for _, v := range []*int{l.Goroutines, l.PendingEvents, l.PendingMediaMB} {
+			if v != nil && *v < 0 {
+				return nil, errors.New("resourceLimits: values must not be negative")
+			}
+		}
+	}
+	if rc := cfg.Reconnect; rc != nil {
+		if rc.MaxAttempts != nil && *rc.MaxAttempts < 1 {
+			return nil, errors.New("reconnect: maxAttempts must be at least 1")
+		}
+		if rc.DelaySeconds != nil && *rc.DelaySeconds < 1 {
+			return nil, errors.New("reconnect: delaySeconds must be at least 1")
+		}
+	}
+	for name, feature := range cfg.Features {
+		if !knownFeature(name) {
+			return nil, fmt.Errorf("features: unknown feature %q", name)
+		}
+		if feature.Rollout < 0 || feature.Rollout > 100 {
+			return nil, fmt.Errorf("features: %s rollout must be between 0 and 100", name)
+		}
+	}
+	for i := range cfg.RabbitMQ.Sinks {
+		if err := cfg.RabbitMQ.Sinks[i].validate(); err != nil {
+			return nil, fmt.Errorf("rabbitmq sink %d: %w", i, err)
+		}
+	}
+
+	return &cfg, nil
+}
+
+// loadConfig reads the configuration file at path and applies it. An empty path leaves the defaults.
+func loadConfig(path string) error {
+	if path == "" {
+		applyConfig(currentConfig())
+		return nil
+	}
+
+	cfg, err := readConfig(path)
+	if err != nil {
+		return err
+	}
+
+	applyConfig(cfg)
+	log.Info().Str("path", path).Int("rabbitSinks", len(cfg.RabbitMQ.Sinks)).Msg("Configuration file loaded")
+	return nil
+}
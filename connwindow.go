@@ -0,0 +1,210 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// ConnectionWindow holds the daily hours an instance stays connected to MAX.
+// Outside them the scheduler disconnects it, and it is connected again when
+// the window opens. Windows where start is after end span midnight.
+type ConnectionWindow struct {
+	Enabled  bool   `json:"enabled" example:"true"`
+	Start    string `json:"start" example:"08:00"`
+	End      string `json:"end" example:"20:00"`
+	Timezone string `json:"timezone" example:"Europe/Moscow"`
+}
+
+// windowStopped holds the instances the scheduler disconnected outside their window
+var windowStopped sync.Map
+
+// validate checks the window settings
+func (cw ConnectionWindow) validate() error {
+	if !cw.Enabled {
+		return nil
+	}
+	start, err := parseClock(cw.Start)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(cw.End)
+	if err != nil {
+		return err
+	}
+	if start == end {
+		return errors.New("start and end must differ")
+	}
+	_, err = loadQuietHoursLocation(cw.Timezone)
+	return err
+}
+
+// state reports whether now falls inside the window and when that changes.
+// A disabled window is always open.
+func (cw ConnectionWindow) state(now time.Time) (open bool, next time.Time) {
+	if !cw.Enabled {
+		return true, time.Time{}
+	}
+	// Quiet hours give the same answer for a window: inside it until its end,
+	// and outside it until its start
+	if closes, inside := (quietHoursConfig{Enabled: true, Start: cw.Start, End: cw.End, Timezone: cw.Timezone}).windowEnd(now); inside {
+		return true, closes
+	}
+	if opens, outside := (quietHoursConfig{Enabled: true, Start: cw.End, End: cw.Start, Timezone: cw.Timezone}).windowEnd(now); outside {
+		return false, opens
+	}
+	return true, time.Time{}
+}
+
+// getConnectionWindow reads the connection window of a user
+func (s *server) getConnectionWindow(userID string) (ConnectionWindow, error) {
+	var cw ConnectionWindow
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(connection_window, '') FROM users WHERE id = $1", userID); err != nil {
+		return cw, err
+	}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &cw); err != nil {
+			return cw, err
+		}
+	}
+	return cw, nil
+}
+
+// applyConnectionWindows disconnects the instances outside their connection
+// window and connects again the ones it disconnected once the window opens.
+// Instances waiting for their first use in lazy connect mode are left alone.
+func (s *server) applyConnectionWindows() {
+	var users []struct {
+		ID        string `db:"id"`
+		Token     string `db:"token"`
+		Events    string `db:"events"`
+		AuthToken string `db:"auth_token"`
+		DeviceID  string `db:"device_id"`
+		Window    string `db:"connection_window"`
+	}
+	err := s.db.Select(&users, `SELECT id, token, COALESCE(events, '') AS events, COALESCE(auth_token, '') AS auth_token,
+		COALESCE(device_id, '') AS device_id, connection_window
+		FROM users WHERE connection_window IS NOT NULL AND connection_window != '' AND auth_token IS NOT NULL AND auth_token != ''`)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load connection windows")
+		return
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		var cw ConnectionWindow
+		if err := json.Unmarshal([]byte(user.Window), &cw); err != nil {
+			continue
+		}
+		open, _ := cw.state(now)
+		_, stopped := windowStopped.Load(user.ID)
+		running := clientManager.GetMaxClient(user.ID) != nil
+
+		switch {
+		case !open && running:
+			log.Info().Str("userID", user.ID).Msg("Outside the connection window, disconnecting")
+			windowStopped.Store(user.ID, true)
+			stopInstance(user.ID)
+		case open && stopped:
+			windowStopped.Delete(user.ID)
+			if running || hasDeferred(user.ID) {
+				continue
+			}
+			subscribedEvents := []string{}
+			for _, arg := range strings.Split(user.Events, ",") {
+				arg = strings.TrimSpace(arg)
+				if arg != "" && Find(supportedEventTypes, arg) && !Find(subscribedEvents, arg) {
+					subscribedEvents = append(subscribedEvents, arg)
+				}
+			}
+			log.Info().Str("userID", user.ID).Msg("Connection window opened, connecting")
+			killchannel[user.ID] = make(chan bool)
+			go s.startClient(user.ID, user.AuthToken, user.DeviceID, user.Token, subscribedEvents)
+		}
+	}
+}
+
+// connectionWindowResponse is the response body of the connection window endpoints
+func connectionWindowResponse(cw ConnectionWindow) map[string]interface{} {
+	open, next := cw.state(time.Now())
+	var nextChange int64
+	if !next.IsZero() {
+		nextChange = next.Unix()
+	}
+	return map[string]interface{}{
+		"success":    true,
+		"enabled":    cw.Enabled,
+		"start":      cw.Start,
+		"end":        cw.End,
+		"timezone":   cw.Timezone,
+		"open":       open,
+		"nextChange": nextChange,
+	}
+}
+
+// GetConnectionWindow returns the connection window of the instance
+// @Summary Get connection window
+// @Description Returns the daily hours the instance stays connected to MAX, whether the window is open now and when that changes next
+// @Tags Session
+// @Produce json
+// @Success 200 {object} ConnectionWindowResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/window [get]
+func (s *server) GetConnectionWindow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		cw, err := s.getConnectionWindow(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.Respond(w, r, http.StatusOK, connectionWindowResponse(cw))
+	}
+}
+
+// SetConnectionWindow sets the connection window of the instance
+// @Summary Set connection window
+// @Description Sets the daily hours, in local time of timezone, the instance stays connected to MAX, so the account only appears online during them. Outside the window the scheduler disconnects the instance within a few seconds, also after POST /session/connect, and connects it again when the window opens. Windows where start is after end span midnight (e.g. 22:00-06:00). Sends outside the window fail with 503 like for any disconnected instance.
+// @Tags Session
+// @Accept json
+// @Produce json
+// @Param request body ConnectionWindow true "Connection window"
+// @Success 200 {object} ConnectionWindowResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/window [post]
+func (s *server) SetConnectionWindow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg ConnectionWindow
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if err := msg.validate(); err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		raw, _ := json.Marshal(msg)
+		if _, err := s.db.Exec("UPDATE users SET connection_window = $1 WHERE id = $2", string(raw), txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		log.Info().Str("userID", txtid).Bool("enabled", msg.Enabled).Str("start", msg.Start).Str("end", msg.End).Msg("Connection window updated")
+
+		s.Respond(w, r, http.StatusOK, connectionWindowResponse(msg))
+	}
+}
@@ -16,14 +16,16 @@ var supportedEventTypes = []string{
 	"Reconnecting", // Attempting to reconnect
 	"Sync",         // Synchronization data on connect/reconnect
 	"LoggedOut",    // Session terminated (from MAX app or API)
+	"Heartbeat",    // Periodic instance status (HEARTBEAT_INTERVAL)
 
 	// Authentication
 	"AuthCodeSent", // Auth code sent (new)
 	"AuthExpired",  // Auth token expired/invalid - need to re-authenticate
 
 	// Chats and groups
-	"ChatUpdate", // NOTIF_CHAT (135)
-	"Typing",     // NOTIF_TYPING (129)
+	"ChatUpdate",  // NOTIF_CHAT (135)
+	"JoinRequest", // NOTIF_CHAT (135) with a join request
+	"Typing",      // NOTIF_TYPING (129)
 
 	// Reactions
 	"ReactionChange", // NOTIF_MSG_REACTIONS_CHANGED (155)
@@ -38,6 +40,15 @@ var supportedEventTypes = []string{
 	// Synchronization
 	"HistorySync", // After CHAT_HISTORY
 
+	// Blocklist
+	"OptOut", // Inbound opt-out keyword, sender added to blocklist
+
+	// Media scanning
+	"MediaBlocked", // Media rejected by the virus scanner
+
+	// Account
+	"AccountRestricted", // MAX restricted the account, sending is paused
+
 	// Special - receives all events
 	"All",
 }
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// errCodeContentBlocked is returned for sends with a banned word or pattern
+	errCodeContentBlocked = "CONTENT_BLOCKED"
+	// errCodeDomainBlocked is returned for sends linking to a blocked domain
+	errCodeDomainBlocked = "DOMAIN_BLOCKED"
+	// errCodeRecipientLimit is returned for sends over the hourly recipient cap
+	errCodeRecipientLimit = "RECIPIENT_LIMIT"
+
+	recipientLimitReject = "reject"
+	recipientLimitQueue  = "queue"
+
+	maxPolicyEntries = 1000
+)
+
+// policyDomainPattern finds host names in message text, with or without a scheme
+var policyDomainPattern = regexp.MustCompile(`(?i)(?:[\p{L}\p{N}](?:[\p{L}\p{N}-]*[\p{L}\p{N}])?\.)+\p{L}{2,}`)
+
+// ContentPolicy is the outbound acceptable-use policy of a user, set by the operator
+type ContentPolicy struct {
+	BannedWords          []string `json:"bannedWords" example:"casino"`
+	BannedPatterns       []string `json:"bannedPatterns" example:"(?i)free\\s+money"`
+	BlockedDomains       []string `json:"blockedDomains" example:"spam.example"`
+	MaxRecipientsPerHour int      `json:"maxRecipientsPerHour" example:"100"`
+	RecipientLimitAction string   `json:"recipientLimitAction" example:"queue" enums:"reject,queue"`
+}
+
+// contentPolicy is a compiled content policy
+type contentPolicy struct {
+	policy   ContentPolicy
+	words    *regexp.Regexp
+	patterns []*regexp.Regexp
+}
+
+// recipientWindow holds the recipients a user sent to in the last hour
+type recipientWindow struct {
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+var (
+	// contentPolicies caches the compiled policy per user
+	contentPolicies sync.Map
+	// recipientWindows holds the recent recipients per user
+	recipientWindows sync.Map
+)
+
+// compileContentPolicy validates a policy and compiles its words and patterns.
+// Banned words match whole words, ignoring case.
+func compileContentPolicy(policy ContentPolicy) (*contentPolicy, error) {
+	if len(policy.BannedWords) > maxPolicyEntries || len(policy.BannedPatterns) > maxPolicyEntries || len(policy.BlockedDomains) > maxPolicyEntries {
+		return nil, fmt.Errorf("at most %d entries per list", maxPolicyEntries)
+	}
+	if policy.MaxRecipientsPerHour < 0 {
+		return nil, errors.New("maxRecipientsPerHour must not be negative")
+	}
+	switch policy.RecipientLimitAction {
+	case "":
+		policy.RecipientLimitAction = recipientLimitReject
+	case recipientLimitReject, recipientLimitQueue:
+	default:
+		return nil, fmt.Errorf("recipientLimitAction must be %s or %s", recipientLimitReject, recipientLimitQueue)
+	}
+
+	p := &contentPolicy{policy: policy}
+
+	words := []string{}
+	for _, word := range policy.BannedWords {
+		words = append(words, regexp.QuoteMeta(word))
+	}
+	if len(words) > 0 {
+		p.words = regexp.MustCompile(`(?i)(?:^|[^\p{L}\p{N}_])(?:` + strings.Join(words, "|") + `)(?:$|[^\p{L}\p{N}_])`)
+	}
+
+	for i, pattern := range policy.BannedPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("banned pattern %d: %w", i, err)
+		}
+		p.patterns = append(p.patterns, re)
+	}
+
+	return p, nil
+}
+
+// normalizeContentPolicy trims the entries of a policy and drops empty ones
+func normalizeContentPolicy(policy ContentPolicy) ContentPolicy {
+	clean := func(values []string, lower bool) []string {
+		out := []string{}
+		for _, v := range values {
+			v = strings.TrimSpace(v)
+			if lower {
+				v = strings.TrimPrefix(strings.ToLower(v), "*.")
+			}
+			if v != "" {
+				out = append(out, v)
+			}
+		}
+		return out
+	}
+	policy.BannedWords = clean(policy.BannedWords, false)
+	policy.BannedPatterns = clean(policy.BannedPatterns, false)
+	policy.BlockedDomains = clean(policy.BlockedDomains, true)
+	policy.RecipientLimitAction = strings.ToLower(strings.TrimSpace(policy.RecipientLimitAction))
+	return policy
+}
+
+// getContentPolicyConfig reads the content policy of a user
+func (s *server) getContentPolicyConfig(userID string) (ContentPolicy, error) {
+	policy := ContentPolicy{BannedWords: []string{}, BannedPatterns: []string{}, BlockedDomains: []string{}, RecipientLimitAction: recipientLimitReject}
+
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(content_policy, '') FROM users WHERE id = $1", userID); err != nil {
+		return policy, err
+	}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+			return policy, err
+		}
+	}
+	return policy, nil
+}
+
+// getContentPolicy returns the compiled content policy of a user
+func (s *server) getContentPolicy(userID string) *contentPolicy {
+	if cached, ok := contentPolicies.Load(userID); ok {
+		return cached.(*contentPolicy)
+	}
+
+	config, err := s.getContentPolicyConfig(userID)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to load content policy")
+		return &contentPolicy{}
+	}
+	p, err := compileContentPolicy(config)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Invalid stored content policy")
+		p = &contentPolicy{}
+	}
+	contentPolicies.Store(userID, p)
+	return p
+}
+
+// violation returns the error code and reason when text breaks the policy
+func (p *contentPolicy) violation(text string) (string, string) {
+	if text == "" {
+		return "", ""
+	}
+	if p.words != nil && p.words.MatchString(text) {
+		return errCodeContentBlocked, "message contains a banned word"
+	}
+	for _, re := range p.patterns {
+		if re.MatchString(text) {
+			return errCodeContentBlocked, "message matches a banned pattern"
+		}
+	}
+	if len(p.policy.BlockedDomains) > 0 {
+		for _, host := range policyDomainPattern.FindAllString(text, -1) {
+			host = strings.ToLower(host)
+			for _, domain := range p.policy.BlockedDomains {
+				if host == domain || strings.HasSuffix(host, "."+domain) {
+					return errCodeDomainBlocked, "message links to a blocked domain: " + domain
+				}
+			}
+		}
+	}
+	return "", ""
+}
+
+// recipientKey identifies the recipient of a send, "" when there is none
+func recipientKey(req outboundRequest) string {
+	if req.ChatID != 0 {
+		return strconv.FormatInt(req.ChatID, 10)
+	}
+	if req.Phone != "" {
+		return "phone:" + req.Phone
+	}
+	return ""
+}
+
+// reserveRecipient counts a recipient against the hourly cap of a user.
+// Recipients sent to in the last hour are always allowed; a new recipient
+// over the cap is refused, with the time a slot frees up.
+func reserveRecipient(userID string, key string, limit int, now time.Time) (time.Time, bool) {
+	value, _ := recipientWindows.LoadOrStore(userID, &recipientWindow{sent: map[string]time.Time{}})
+	window := value.(*recipientWindow)
+	window.mu.Lock()
+	defer window.mu.Unlock()
+
+	var oldest time.Time
+	for k, at := range window.sent {
+		if !at.After(now.Add(-time.Hour)) {
+			delete(window.sent, k)
+			continue
+		}
+		if oldest.IsZero() || at.Before(oldest) {
+			oldest = at
+		}
+	}
+
+	if _, known := window.sent[key]; !known && len(window.sent) >= limit {
+		return oldest.Add(time.Hour), true
+	}
+	window.sent[key] = now
+	return time.Time{}, false
+}
+
+// checkContentPolicy rejects sends whose text breaks the user's policy. It
+// responds and returns false when the request must not reach its handler.
+func (s *server) checkContentPolicy(w http.ResponseWriter, r *http.Request, txtid string, req outboundRequest) bool {
+	p := s.getContentPolicy(txtid)
+	for _, text := range []string{req.Text, req.Caption} {
+		if code, reason := p.violation(text); code != "" {
+			log.Info().Str("userID", txtid).Str("code", code).Str("path", r.URL.Path).Msg("Send rejected by content policy")
+			s.Respond(w, r, http.StatusUnprocessableEntity, map[string]interface{}{
+				"success": false,
+				"error":   reason,
+				"code":    code,
+			})
+			return false
+		}
+	}
+	return true
+}
+
+// checkRecipientLimit enforces the hourly recipient cap of the user's policy.
+// Sends over the cap are rejected with 429 or queued; sends of the deferred
+// queue, schedules and campaigns get 503 so they are retried later.
+func (s *server) checkRecipientLimit(w http.ResponseWriter, r *http.Request, txtid string, req outboundRequest, body func() ([]byte, error)) bool {
+	p := s.getContentPolicy(txtid)
+	key := recipientKey(req)
+	if p.policy.MaxRecipientsPerHour == 0 || key == "" {
+		return true
+	}
+
+	until, capped := reserveRecipient(txtid, key, p.policy.MaxRecipientsPerHour, time.Now())
+	if !capped {
+		return true
+	}
+
+	retryAfter := int(time.Until(until).Seconds()) + 1
+	switch {
+	case isInternalSend(r):
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		s.Respond(w, r, http.StatusServiceUnavailable, map[string]interface{}{
+			"success":    false,
+			"error":      "hourly recipient limit reached",
+			"code":       errCodeRecipientLimit,
+			"retryAfter": retryAfter,
+		})
+	case p.policy.RecipientLimitAction == recipientLimitQueue:
+		payload, err := body()
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("could not read payload"))
+			return false
+		}
+		s.respondDeferred(w, r, txtid, payload, until, "recipient_limit")
+	default:
+		w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+		s.Respond(w, r, http.StatusTooManyRequests, map[string]interface{}{
+			"success":    false,
+			"error":      "hourly recipient limit reached",
+			"code":       errCodeRecipientLimit,
+			"retryAfter": retryAfter,
+		})
+	}
+	return false
+}
+
+// contentPolicyResponse is the response body of the policy endpoints
+func contentPolicyResponse(userID string, policy ContentPolicy) map[string]interface{} {
+	return map[string]interface{}{
+		"success":              true,
+		"userID":               userID,
+		"bannedWords":          policy.BannedWords,
+		"bannedPatterns":       policy.BannedPatterns,
+		"blockedDomains":       policy.BlockedDomains,
+		"maxRecipientsPerHour": policy.MaxRecipientsPerHour,
+		"recipientLimitAction": policy.RecipientLimitAction,
+	}
+}
+
+// GetContentPolicy returns the outbound content policy of the user
+// @Summary Get content policy
+// @Description Returns the outbound content policy the operator set for this user: banned words and patterns, blocked link domains and the hourly recipient cap
+// @Tags User
+// @Produce json
+// @Success 200 {object} ContentPolicyResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/policy [get]
+func (s *server) GetContentPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		policy, err := s.getContentPolicyConfig(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.Respond(w, r, http.StatusOK, contentPolicyResponse(txtid, policy))
+	}
+}
+
+// GetUserContentPolicy returns the outbound content policy of a user
+// @Summary Get user content policy
+// @Description Returns the outbound content policy of a user
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 200 {object} ContentPolicyResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/policy [get]
+func (s *server) GetUserContentPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var exists bool
+		if err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID); err != nil || !exists {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		policy, err := s.getContentPolicyConfig(userID)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.Respond(w, r, http.StatusOK, contentPolicyResponse(userID, policy))
+	}
+}
+
+// SetUserContentPolicy replaces the outbound content policy of a user
+// @Summary Set user content policy
+// @Description Replaces the outbound content policy of a user. Sends with a banned word (whole word, any case) or matching a banned pattern are rejected with 422 and code CONTENT_BLOCKED, and sends linking to a blocked domain or its subdomains with 422 and code DOMAIN_BLOCKED. Sends to a new recipient once maxRecipientsPerHour different recipients were sent to in the last hour are rejected with 429 and code RECIPIENT_LIMIT, or queued when recipientLimitAction is queue. Empty lists and 0 turn a check off.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userid path string true "User ID"
+// @Param request body ContentPolicy true "Content policy"
+// @Success 200 {object} ContentPolicyResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/policy [post]
+func (s *server) SetUserContentPolicy() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var exists bool
+		if err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID); err != nil || !exists {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		var msg ContentPolicy
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		policy := normalizeContentPolicy(msg)
+		compiled, err := compileContentPolicy(policy)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+		policy = compiled.policy
+
+		raw, _ := json.Marshal(policy)
+		if _, err := s.db.Exec("UPDATE users SET content_policy = $1 WHERE id = $2", string(raw), userID); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		contentPolicies.Store(userID, compiled)
+
+		log.Info().Str("userID", userID).Int("bannedWords", len(policy.BannedWords)).Int("bannedPatterns", len(policy.BannedPatterns)).Int("blockedDomains", len(policy.BlockedDomains)).Int("maxRecipientsPerHour", policy.MaxRecipientsPerHour).Msg("Content policy updated")
+
+		s.Respond(w, r, http.StatusOK, contentPolicyResponse(userID, policy))
+	}
+}
@@ -157,7 +157,7 @@ func initializeSQLite(config DatabaseConfig) (*sqlx.DB, error) {
 	}
 
 	dbPath := filepath.Join(config.Path, "users.db")
-	db, err := sqlx.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_busy_timeout=3000")
+	db, err := sqlx.Open("sqlite", dbPath+"?_pragma=foreign_keys(1)&_pragma=busy_timeout(3000)")
 	if err != nil {
 		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
 	}
@@ -181,16 +181,27 @@ type HistoryMessage struct {
 	TextContent string    `json:"text_content" db:"text_content"`
 	MediaLink   string    `json:"media_link" db:"media_link"`
 	ReplyToID   string    `json:"reply_to_id,omitempty" db:"reply_to_id"`
+	// Undecryptable is set when the stored text could not be decrypted
+	Undecryptable bool `json:"undecryptable,omitempty" db:"-"`
 }
 
 func (s *server) saveMessageToHistory(userID, chatID, senderID, messageID, messageType, textContent, mediaLink, replyToID string) error {
+	textContent, err := encryptField(userID, textContent)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+	mediaLink, err = encryptField(userID, mediaLink)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
 	query := `INSERT INTO message_history (user_id, chat_id, sender_id, message_id, timestamp, message_type, text_content, media_link, reply_to_id)
               VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`
 	if s.db.DriverName() == "sqlite" {
 		query = `INSERT INTO message_history (user_id, chat_id, sender_id, message_id, timestamp, message_type, text_content, media_link, reply_to_id)
                  VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
 	}
-	_, err := s.db.Exec(query, userID, chatID, senderID, messageID, time.Now(), messageType, textContent, mediaLink, replyToID)
+	_, err = s.db.Exec(query, userID, chatID, senderID, messageID, time.Now(), messageType, textContent, mediaLink, replyToID)
 	if err != nil {
 		return fmt.Errorf("failed to save message to history: %w", err)
 	}
@@ -256,5 +267,6 @@ func (s *server) getMessageHistory(userID, chatID string, limit int) ([]HistoryM
 	if err != nil {
 		return nil, fmt.Errorf("failed to get message history: %w", err)
 	}
+	decryptHistory(messages)
 	return messages, nil
 }
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+// uploadCacheTTL bounds how long an uploaded MAX attachment is reused. Upload tokens
+// are not documented to be permanent, so entries expire and a failed send with a
+// cached token falls back to a fresh upload.
+const uploadCacheTTL = 6 * time.Hour
+
+// uploadCache maps userID/type/checksum to the attachment returned by the MAX upload
+var uploadCache = cache.New(uploadCacheTTL, 30*time.Minute)
+
+func uploadCacheKey(userID, mediaType, checksum string) string {
+	return userID + "/" + mediaType + "/" + checksum
+}
+
+// forgetUserUploads drops the cached uploads of a user
+func forgetUserUploads(userID string) {
+	prefix := userID + "/"
+	for key := range uploadCache.Items() {
+		if strings.HasPrefix(key, prefix) {
+			uploadCache.Delete(key)
+		}
+	}
+}
+
+// uploadAttachment uploads media to MAX for the given media type
+func uploadAttachment(client *maxclient.Client, mediaType string, data []byte, filename string) (*maxclient.Attachment, error) {
+	switch mediaType {
+	case "image":
+		return client.UploadPhoto(data, filename)
+	case "video":
+		return client.UploadVideo(data, filename)
+	case "audio":
+		return client.UploadAudio(data, filename)
+	default:
+		return client.UploadFile(data, filename)
+	}
+}
+
+// uploadAttachmentStream uploads size bytes read from r to MAX for the given
+// media type without buffering them. Photos have no streaming upload.
+func uploadAttachmentStream(client *maxclient.Client, mediaType string, r io.Reader, size int64, filename string) (*maxclient.Attachment, error) {
+	switch mediaType {
+	case "video":
+		return client.UploadVideoStream(r, size, filename)
+	case "image":
+		return nil, fmt.Errorf("%s uploads can't be streamed", mediaType)
+	default:
+		// Audio is uploaded as a file in MAX
+		return client.UploadFileStream(r, size, filename)
+	}
+}
+
+// SendMediaMessage uploads media and sends it, reusing a previous upload of identical content
+func (s *server) SendMediaMessage(client *maxclient.Client, userID string, chatID int64, caption string,
+	mediaType string, data []byte, filename string, notify bool) (*maxclient.Message, error) {
+
+	upload := func() (*maxclient.Attachment, error) {
+		return uploadAttachment(client, mediaType, data, filename)
+	}
+	return s.sendCachedUpload(client, userID, chatID, caption, mediaType, mediaChecksum(data), filename, notify, upload)
+}
+
+// sendMediaStream is sendMediaMessage for size bytes read from f. The content is
+// read twice, for the checksum and for the upload, and never held in memory.
+// It returns the checksum along with the sent message.
+func (s *server) sendMediaStream(client *maxclient.Client, userID string, chatID int64, caption string,
+	mediaType string, f io.ReadSeeker, size int64, filename string, notify bool) (*maxclient.Message, string, error) {
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, "", err
+	}
+	checksum := hex.EncodeToString(hash.Sum(nil))
+
+	upload := func() (*maxclient.Attachment, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return uploadAttachmentStream(client, mediaType, f, size, filename)
+	}
+	result, err := s.sendCachedUpload(client, userID, chatID, caption, mediaType, checksum, filename, notify, upload)
+	return result, checksum, err
+}
+
+// sendCachedUpload sends an attachment, taken from the upload cache when content
+// with the same checksum was uploaded before and uploaded otherwise
+func (s *server) sendCachedUpload(client *maxclient.Client, userID string, chatID int64, caption string,
+	mediaType string, checksum string, filename string, notify bool, upload func() (*maxclient.Attachment, error)) (*maxclient.Message, error) {
+
+	key := uploadCacheKey(userID, mediaType, checksum)
+
+	send := func(attachment maxclient.Attachment) (*maxclient.Message, error) {
+		// File attachments carry the name shown to the recipient
+		if attachment.Type == maxclient.AttachTypeFile {
+			attachment.Name = filename
+		}
+		return client.SendMessage(maxclient.SendMessageOptions{
+			ChatID:      chatID,
+			Text:        caption,
+			Notify:      notify,
+			Attachments: []maxclient.Attachment{attachment},
+		})
+	}
+
+	if cached, found := uploadCache.Get(key); found {
+		result, err := send(cached.(maxclient.Attachment))
+		if err == nil {
+			log.Debug().Str("userID", userID).Str("type", mediaType).Msg("Reused uploaded media")
+			return result, nil
+		}
+		log.Warn().Err(err).Str("userID", userID).Msg("Send with cached upload failed, uploading again")
+		uploadCache.Delete(key)
+	}
+
+	attachment, err := upload()
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := send(*attachment)
+	if err != nil {
+		return nil, err
+	}
+
+	uploadCache.Set(key, *attachment, cache.DefaultExpiration)
+	return result, nil
+}
+
+// storeMedia copies media to the user's store. If identical content was stored
+// before on the same backend, the existing object is referenced instead of uploading it again.
+func storeMedia(ctx context.Context, db *sqlx.DB, userID, contactJID, messageID string,
+	data []byte, mimeType string, fileName string, isIncoming bool) (map[string]interface{}, error) {
+
+	manager := GetStorageManager()
+	store, _, ok := manager.GetStore(userID)
+	if !ok {
+		return nil, fmt.Errorf("media store not initialized for user %s", userID)
+	}
+
+	var existing string
+	err := db.Get(&existing, `SELECT storage_key FROM media
+		WHERE user_id = $1 AND checksum = $2 AND storage_backend = $3 AND storage_key != '' LIMIT 1`,
+		userID, mediaChecksum(data), store.Backend())
+	if err == nil && existing != "" {
+		mediaData, err := manager.DescribeMedia(ctx, userID, existing, len(data), mimeType, fileName)
+		if err != nil {
+			return nil, err
+		}
+		mediaData["deduplicated"] = true
+		return mediaData, nil
+	}
+
+	return manager.ProcessMedia(ctx, userID, contactJID, messageID, data, mimeType, fileName, isIncoming)
+}
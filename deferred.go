@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	deferredPollInterval = 30 * time.Second
+	deferredSendSpacing  = 1 * time.Second
+	deferredBatchSize    = 100
+	deferredMaxAttempts  = 10
+	deferredMaxBackoff   = 1 * time.Hour
+)
+
+// DeferredMessage represents a send request waiting in the deferred queue
+type DeferredMessage struct {
+	ID        int64  `json:"id" db:"id"`
+	UserID    string `json:"-" db:"user_id"`
+	Path      string `json:"path" db:"path"`
+	Body      string `json:"-" db:"body"`
+	Reason    string `json:"reason" db:"reason"`
+	DeliverAt int64  `json:"deliverAt" db:"deliver_at"`
+	CreatedAt int64  `json:"createdAt" db:"created_at"`
+	Attempts  int    `json:"attempts" db:"attempts"`
+	LastError string `json:"lastError,omitempty" db:"last_error"`
+}
+
+// deferSend stores a send request to be replayed through the router at deliverAt
+func (s *server) deferSend(userID, path string, body []byte, deliverAt time.Time, reason string) (int64, error) {
+	var id int64
+	err := s.db.QueryRow(`INSERT INTO deferred_messages (user_id, path, body, reason, deliver_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+		userID, path, string(body), reason, deliverAt.Unix(), time.Now().Unix()).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to queue message: %w", err)
+	}
+	return id, nil
+}
+
+// listDeferred returns the pending deferred sends for a user
+func (s *server) listDeferred(userID string) ([]DeferredMessage, error) {
+	messages := []DeferredMessage{}
+	err := s.db.Select(&messages, `SELECT id, user_id, path, body, reason, deliver_at, created_at, attempts, COALESCE(last_error, '') AS last_error
+		FROM deferred_messages WHERE user_id = $1 ORDER BY deliver_at, id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list queued messages: %w", err)
+	}
+	return messages, nil
+}
+
+// startDeferredDispatcher periodically delivers deferred sends that are due
+func (s *server) startDeferredDispatcher() {
+	go func() {
+		ticker := time.NewTicker(deferredPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			// Queued messages wait until maintenance mode ends
+			if !inMaintenance() {
+				s.dispatchDeferred()
+			}
+		}
+	}()
+}
+
+func (s *server) dispatchDeferred() {
+	var due []struct {
+		DeferredMessage
+		Token string `db:"token"`
+	}
+	err := s.db.Select(&due, `SELECT d.id, d.user_id, d.path, d.body, d.reason, d.deliver_at, d.created_at, d.attempts,
+			COALESCE(d.last_error, '') AS last_error, u.token
+		FROM deferred_messages d JOIN users u ON u.id = d.user_id
+		WHERE d.deliver_at <= $1 ORDER BY d.deliver_at, d.id LIMIT $2`, time.Now().Unix(), deferredBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load deferred messages")
+		return
+	}
+
+	for _, msg := range due {
+		// Messages of a restricted account wait until sending is resumed
+		if s.accountRestriction(msg.UserID) != nil {
+			s.db.Exec("UPDATE deferred_messages SET deliver_at=$1 WHERE id=$2", time.Now().Add(restrictionRetryInterval).Unix(), msg.ID)
+			continue
+		}
+		if until, capped := s.warmupUntil(msg.UserID, time.Now()); capped {
+			s.db.Exec("UPDATE deferred_messages SET deliver_at=$1 WHERE id=$2", until.Unix(), msg.ID)
+			continue
+		}
+
+		rec := s.InternalSend(msg.Token, msg.Path, msg.Body)
+
+		switch {
+		case rec.Code < 300:
+			log.Info().Str("userID", msg.UserID).Int64("id", msg.ID).Str("reason", msg.Reason).Msg("Deferred message delivered")
+			s.db.Exec("DELETE FROM deferred_messages WHERE id=$1", msg.ID)
+		case rec.Code >= 500 && msg.Attempts+1 < deferredMaxAttempts:
+			// Not connected or MAX-side failure, try again later
+			backoff := deferredPollInterval << uint(msg.Attempts)
+			if backoff > deferredMaxBackoff {
+				backoff = deferredMaxBackoff
+			}
+			log.Warn().Str("userID", msg.UserID).Int64("id", msg.ID).Int("status", rec.Code).Dur("retryIn", backoff).Msg("Deferred message failed, will retry")
+			s.db.Exec("UPDATE deferred_messages SET attempts=$1, last_error=$2, deliver_at=$3 WHERE id=$4",
+				msg.Attempts+1, rec.Body.String(), time.Now().Add(backoff).Unix(), msg.ID)
+		default:
+			log.Error().Str("userID", msg.UserID).Int64("id", msg.ID).Int("status", rec.Code).Str("response", rec.Body.String()).Msg("Dropping deferred message")
+			s.db.Exec("DELETE FROM deferred_messages WHERE id=$1", msg.ID)
+		}
+
+		time.Sleep(deferredSendSpacing)
+	}
+}
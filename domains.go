@@ -0,0 +1,260 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/handlers/admin"
+	"maxapi/handlers/auth"
+	"maxapi/handlers/chat"
+	"maxapi/handlers/group"
+	"maxapi/handlers/session"
+	"maxapi/handlers/user"
+	"maxapi/handlers/webhook"
+	"maxapi/maxclient"
+)
+
+// The domain packages under handlers/ reach the server through the Server
+// interface of their package, which *server implements below. Their
+// handlers are bound to the server when the routes are registered.
+
+func authRoute(handler func(*auth.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(auth.New(s)) }
+}
+
+func sessionRoute(handler func(*session.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(session.New(s)) }
+}
+
+func chatRoute(handler func(*chat.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(chat.New(s)) }
+}
+
+func groupRoute(handler func(*group.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(group.New(s)) }
+}
+
+func userRoute(handler func(*user.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(user.New(s)) }
+}
+
+func adminRoute(handler func(*admin.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(admin.New(s)) }
+}
+
+func webhookRoute(handler func(*webhook.Handlers) http.HandlerFunc) func(*server) http.HandlerFunc {
+	return func(s *server) http.HandlerFunc { return handler(webhook.New(s)) }
+}
+
+// ========== SHARED ==========
+
+func (s *server) DB() *sqlx.DB {
+	return s.db
+}
+
+func (s *server) DecodeJSON(r *http.Request, v interface{}) error {
+	return decodeJSON(r, v)
+}
+
+// UpdateUserInfo changes a field of the userinfo of a request and caches it
+// under the token of the request
+func (s *server) UpdateUserInfo(r *http.Request, field, value string) {
+	token := r.Context().Value("userinfo").(Values).Get("Token")
+	cacheUserInfo(token, updateUserInfo(r.Context().Value("userinfo"), field, value))
+}
+
+func (s *server) InvalidateUserToken(token string) {
+	invalidateUserToken(token)
+}
+
+// ========== CLIENTS ==========
+
+func (s *server) MaxClient(userID string) *maxclient.Client {
+	return clientManager.GetMaxClient(userID)
+}
+
+func (s *server) SetMaxClient(userID string, client *maxclient.Client) {
+	clientManager.SetMaxClient(userID, client)
+}
+
+func (s *server) DeleteMaxClient(userID string) {
+	clientManager.DeleteMaxClient(userID)
+}
+
+func (s *server) IsConnected(userID string) bool {
+	return clientManager.IsConnected(userID)
+}
+
+func (s *server) NewMaxClient(deviceID string, logger zerolog.Logger) *maxclient.Client {
+	return newMaxClient(deviceID, logger)
+}
+
+func (s *server) UserLocale(userID string) (string, error) {
+	settings, err := s.getUserSettings(userID)
+	return settings.Locale, err
+}
+
+func (s *server) SendEvent(userID string, postmap map[string]interface{}) {
+	if mycli := clientManager.GetMyClient(userID); mycli != nil {
+		sendEventWithWebHook(mycli, postmap, "")
+	}
+}
+
+// ========== SESSION ==========
+
+func (s *server) SupportsEvent(eventType string) bool {
+	return slices.Contains(supportedEventTypes, eventType)
+}
+
+func (s *server) StartInstance(userID, authToken, deviceID, token string, subscriptions []string) {
+	dropDeferred(userID)
+	killchannel[userID] = make(chan bool)
+	go s.startClient(userID, authToken, deviceID, token, subscriptions)
+}
+
+func (s *server) StopInstance(userID string) {
+	if ch := killchannel[userID]; ch != nil {
+		select {
+		case ch <- true:
+			// Signal sent successfully
+		default:
+			// Channel not ready, clean up anyway
+			delete(killchannel, userID)
+		}
+	}
+
+	_, err := s.db.Exec("UPDATE users SET connected=0 WHERE id=$1", userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update disconnected status")
+	}
+	s.logConnection(userID, connectionDown, "stopped")
+}
+
+func (s *server) ResyncInstance(userID, authToken, deviceID, token string) (int64, map[string]interface{}, error) {
+	// Stop existing client goroutine and disconnect
+	if ch := killchannel[userID]; ch != nil {
+		select {
+		case ch <- true:
+		default:
+		}
+	}
+	if oldClient := clientManager.GetMaxClient(userID); oldClient != nil {
+		oldClient.Disconnect()
+	}
+	// Small delay to let old goroutine clean up
+	time.Sleep(100 * time.Millisecond)
+
+	// Create new client and connect
+	logger := log.With().Str("userID", userID).Logger()
+	client := newMaxClient(deviceID, logger)
+
+	syncData, err := client.ConnectAndLogin(authToken, s.UserAgent(userID))
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// Update client manager
+	clientManager.SetMaxClient(userID, client)
+
+	// Update MyClient wrapper
+	mycli := clientManager.GetMyClient(userID)
+	if mycli != nil {
+		mycli.MaxClient = client
+	} else {
+		// Create new MyClient if not exists
+		mycli = &MyClient{
+			MaxClient:     client,
+			userID:        userID,
+			token:         token,
+			subscriptions: []string{},
+			db:            s.db,
+			s:             s,
+		}
+		clientManager.SetMyClient(userID, mycli)
+	}
+
+	// Set event handler
+	client.SetEventHandler(func(event maxclient.Event) {
+		mycli.handleEvent(event)
+	})
+
+	// Update DB
+	_, err = s.db.Exec("UPDATE users SET connected=1, max_user_id=$1 WHERE id=$2", client.MaxUserID, userID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update connected status")
+	}
+
+	// Create new kill channel and start background goroutine for reconnects
+	killchannel[userID] = make(chan bool)
+	go s.maintainConnection(userID, authToken, deviceID, token, mycli)
+
+	// Send Sync event to webhook
+	postmap := map[string]interface{}{
+		"type":      "Sync",
+		"reconnect": false,
+		"manual":    true,
+		"maxUserID": client.MaxUserID,
+	}
+	for key, value := range syncData {
+		if key != "type" {
+			postmap[key] = value
+		}
+	}
+	sendEventWithWebHook(mycli, postmap, "")
+
+	return client.MaxUserID, syncData, nil
+}
+
+// ========== CHAT ==========
+
+func (s *server) ResolveMentions(client *maxclient.Client, msg chat.MessageBody) (string, []chat.MessageElement, error) {
+	return resolveMentions(client, msg)
+}
+
+func (s *server) FormatText(text, format string, elements []chat.MessageElement) (string, []maxclient.Element, error) {
+	return formatText(text, format, elements)
+}
+
+func (s *server) LinkPreviewAttachment(client *maxclient.Client, text string, elements []maxclient.Element) []maxclient.Attachment {
+	return linkPreviewAttachment(client, text, elements)
+}
+
+func (s *server) DecodeMediaRequest(r *http.Request, msg interface{}, field string) (chat.Upload, error) {
+	return decodeMediaRequest(r, msg, field)
+}
+
+func (s *server) SendUpload(w http.ResponseWriter, r *http.Request, client *maxclient.Client, chatID int64, caption string,
+	mediaType, recordType string, upload chat.Upload, filename string, notify bool) {
+	s.sendUpload(w, r, client, chatID, caption, mediaType, recordType, upload.(*mediaUpload), filename, notify)
+}
+
+func (s *server) CheckOutgoingMedia(w http.ResponseWriter, r *http.Request, chatID int64, fileName string, data []byte) bool {
+	return s.checkMedia(w, r, mediaDirectionOutbox, chatID, fileName, data)
+}
+
+func (s *server) CheckIncomingMedia(w http.ResponseWriter, r *http.Request, chatID int64, fileName string, data []byte) bool {
+	return s.checkMedia(w, r, mediaDirectionInbox, chatID, fileName, data)
+}
+
+func (s *server) DownloadMedia(url string) ([]byte, error) {
+	return downloadMedia(url)
+}
+
+// ========== WEBHOOK ==========
+
+func (s *server) ProbeWebhook(webhookURL, token, userID, secret, format string) error {
+	return probeWebhook(webhookURL, token, userID, secret, format)
+}
+
+// ========== ADMIN ==========
+
+// TokenVisible lets only superadmin keys see user tokens. Hashed tokens
+// cannot be shown at all.
+func (s *server) TokenVisible(r *http.Request, token string) bool {
+	return requestAdminRole(r) >= roleSuperadmin && !isHashedToken(token)
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	alertKindLoggedOut     = "LoggedOut"
+	alertKindAuthExpired   = "AuthExpired"
+	alertKindMaxReconnects = "MaxReconnectAttempts"
+	alertKindRestricted    = "AccountRestricted"
+
+	defaultAlertSubject = "[maxapi] {{event}} on {{instanceName}}"
+	defaultAlertBody    = "Instance {{instanceName}} ({{instanceId}}) reported {{event}} at {{time}}.\r\n\r\nReason: {{reason}}\r\n"
+)
+
+// AlertsConfig lists the addresses a user's critical events are emailed to,
+// on top of the operator addresses in ALERT_EMAILS
+// @Description Addresses that LoggedOut, AuthExpired, AccountRestricted and max reconnect attempts events are emailed to when SMTP is configured
+type AlertsConfig struct {
+	Emails []string `json:"emails" example:"ops@example.com"`
+}
+
+var (
+	smtpAddr       string
+	smtpHost       string
+	smtpFrom       string
+	smtpAuth       smtp.Auth
+	alertEmails    []string
+	alertSubject   string
+	alertBody      string
+	alertsSent     *cache.Cache
+	alertsInterval time.Duration
+)
+
+// initEmailAlerts configures the critical event emails from SMTP_HOST; without
+// it no emails are sent
+func initEmailAlerts() error {
+	smtpHost = os.Getenv("SMTP_HOST")
+	if smtpHost == "" {
+		return nil
+	}
+
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = "587"
+	}
+	smtpAddr = net.JoinHostPort(smtpHost, port)
+
+	smtpFrom = os.Getenv("SMTP_FROM")
+	if _, err := mail.ParseAddress(smtpFrom); err != nil {
+		return fmt.Errorf("invalid SMTP_FROM: %w", err)
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		smtpAuth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), smtpHost)
+	}
+
+	emails, err := parseAlertEmails(strings.Split(os.Getenv("ALERT_EMAILS"), ","))
+	if err != nil {
+		return fmt.Errorf("invalid ALERT_EMAILS: %w", err)
+	}
+	alertEmails = emails
+
+	alertSubject = os.Getenv("ALERT_EMAIL_SUBJECT")
+	if alertSubject == "" {
+		alertSubject = defaultAlertSubject
+	}
+	alertBody = os.Getenv("ALERT_EMAIL_BODY")
+	if alertBody == "" {
+		alertBody = defaultAlertBody
+	}
+
+	alertsInterval = time.Duration(envInt("ALERT_EMAIL_INTERVAL", 900)) * time.Second
+	alertsSent = cache.New(alertsInterval, time.Minute)
+
+	log.Info().Str("smtp", smtpAddr).Int("recipients", len(alertEmails)).Dur("interval", alertsInterval).Msg("Email alerts enabled")
+	return nil
+}
+
+// parseAlertEmails validates addresses and drops empty entries
+func parseAlertEmails(values []string) ([]string, error) {
+	emails := []string{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		addr, err := mail.ParseAddress(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", value, err)
+		}
+		emails = append(emails, addr.Address)
+	}
+	return emails, nil
+}
+
+// alertKind returns the alert an event raises, or "" for events that are not critical
+func alertKind(postmap map[string]interface{}) string {
+	switch eventType, _ := postmap["type"].(string); eventType {
+	case "LoggedOut":
+		return alertKindLoggedOut
+	case "AuthExpired":
+		return alertKindAuthExpired
+	case "AccountRestricted":
+		return alertKindRestricted
+	case "Disconnected":
+		if reason, _ := postmap["reason"].(string); reason == "max_reconnect_attempts" {
+			return alertKindMaxReconnects
+		}
+	}
+	return ""
+}
+
+// sendEmailAlert emails the operator and the user's addresses about a critical
+// event, at most once per instance and kind every ALERT_EMAIL_INTERVAL
+func sendEmailAlert(mycli *MyClient, postmap map[string]interface{}) {
+	if alertsSent == nil {
+		return
+	}
+	kind := alertKind(postmap)
+	if kind == "" {
+		return
+	}
+
+	// The settings are read now: a LoggedOut instance is deleted right after its event
+	recipients := append([]string{}, alertEmails...)
+	if config, err := mycli.s.getUserConfig(mycli.userID); err == nil {
+		for _, email := range config.Alerts.Emails {
+			if !slices.Contains(recipients, email) {
+				recipients = append(recipients, email)
+			}
+		}
+	}
+	if len(recipients) == 0 {
+		return
+	}
+
+	if err := alertsSent.Add(mycli.userID+":"+kind, true, alertsInterval); err != nil {
+		log.Debug().Str("userID", mycli.userID).Str("alert", kind).Msg("Email alert already sent recently")
+		return
+	}
+
+	instanceName := ""
+	if userinfo, found := userinfocache.Get(mycli.token); found {
+		instanceName = userinfo.(Values).Get("Name")
+	}
+	reason, _ := postmap["reason"].(string)
+	variables := map[string]string{
+		"event":        kind,
+		"instanceId":   mycli.userID,
+		"instanceName": instanceName,
+		"reason":       reason,
+		"time":         time.Now().UTC().Format(time.RFC3339),
+	}
+	subject := renderTemplate(alertSubject, variables)
+	body := renderTemplate(alertBody, variables)
+
+	go func() {
+		if err := sendMail(recipients, subject, body); err != nil {
+			log.Error().Err(err).Str("userID", mycli.userID).Str("alert", kind).Msg("Failed to send email alert")
+			return
+		}
+		log.Info().Str("userID", mycli.userID).Str("alert", kind).Int("recipients", len(recipients)).Msg("Email alert sent")
+	}()
+}
+
+// sendMail sends a plain text email through the configured SMTP server,
+// upgrading to TLS when the server offers STARTTLS
+func sendMail(to []string, subject, body string) error {
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", smtpFrom)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	msg.WriteString(body)
+
+	from := smtpFrom
+	if addr, err := mail.ParseAddress(smtpFrom); err == nil {
+		from = addr.Address
+	}
+	return smtp.SendMail(smtpAddr, smtpAuth, from, to, []byte(msg.String()))
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// encryptedPrefix marks values encrypted with AES-256-GCM. Values without it are
+// plaintext written before encryption was enabled.
+const encryptedPrefix = "enc:v1:"
+
+// plainPrefix escapes plaintext that starts with one of the prefixes, e.g. a
+// message whose text starts with enc:v1:, so it is not taken for ciphertext
+const plainPrefix = "enc:plain:"
+
+const historyEncryptionBatch = 500
+
+// historyCipher encrypts message_history text and media links when HISTORY_ENCRYPTION_KEY is set
+var historyCipher cipher.AEAD
+
+var errHistoryKeyMissing = errors.New("message history is encrypted but HISTORY_ENCRYPTION_KEY is not set")
+
+// initHistoryEncryption configures at-rest encryption from HISTORY_ENCRYPTION_KEY,
+// a 32-byte key encoded as base64 or hex
+func initHistoryEncryption() error {
+	raw := strings.TrimSpace(os.Getenv("HISTORY_ENCRYPTION_KEY"))
+	if raw == "" {
+		return nil
+	}
+
+	key, err := hex.DecodeString(raw)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(raw)
+	}
+	if err != nil || len(key) != 32 {
+		return errors.New("HISTORY_ENCRYPTION_KEY must be 32 bytes encoded as hex or base64")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+	historyCipher, err = cipher.NewGCM(block)
+	if err != nil {
+		return err
+	}
+
+	log.Info().Msg("Message history encryption enabled")
+	return nil
+}
+
+// encryptField encrypts a value for storage. The user ID is bound as additional
+// data, so a value copied to another user's row does not decrypt. Values are
+// always encrypted, even when they already look encrypted: message text is
+// chosen by whoever sends the message. Without a key, plaintext that looks
+// encrypted is escaped with plainPrefix.
+func encryptField(userID, value string) (string, error) {
+	if historyCipher == nil || value == "" {
+		if strings.HasPrefix(value, encryptedPrefix) || strings.HasPrefix(value, plainPrefix) {
+			return plainPrefix + value, nil
+		}
+		return value, nil
+	}
+
+	nonce := make([]byte, historyCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := historyCipher.Seal(nonce, nonce, []byte(value), []byte(userID))
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField reverses encryptField. Plaintext values are returned unchanged.
+func decryptField(userID, value string) (string, error) {
+	if escaped, ok := strings.CutPrefix(value, plainPrefix); ok {
+		return escaped, nil
+	}
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	if historyCipher == nil {
+		return "", errHistoryKeyMissing
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil || len(sealed) < historyCipher.NonceSize() {
+		return "", errors.New("malformed encrypted value")
+	}
+	nonce, ciphertext := sealed[:historyCipher.NonceSize()], sealed[historyCipher.NonceSize():]
+	plain, err := historyCipher.Open(nil, nonce, ciphertext, []byte(userID))
+	if err != nil {
+		return "", errors.New("failed to decrypt value, check HISTORY_ENCRYPTION_KEY")
+	}
+	return string(plain), nil
+}
+
+// decryptHistory decrypts the text and media links of messages in place. A
+// message that does not decrypt is logged and returned empty with
+// undecryptable set, so one bad row does not fail the whole page.
+func decryptHistory(messages []HistoryMessage) {
+	for i := range messages {
+		msg := &messages[i]
+		text, textErr := decryptField(msg.UserID, msg.TextContent)
+		link, linkErr := decryptField(msg.UserID, msg.MediaLink)
+		if err := errors.Join(textErr, linkErr); err != nil {
+			log.Error().Err(err).Str("userID", msg.UserID).Int("id", msg.ID).Msg("Failed to decrypt history message")
+			text, link, msg.Undecryptable = "", "", true
+		}
+		msg.TextContent, msg.MediaLink = text, link
+	}
+}
+
+// encryptLegacyField encrypts a value stored before encryption was enabled and
+// leaves values that are already encrypted alone. Stored plaintext that only
+// looks encrypted does not decrypt, so it is encrypted too.
+func encryptLegacyField(userID, value string) (string, error) {
+	if strings.HasPrefix(value, encryptedPrefix) {
+		if _, err := decryptField(userID, value); err == nil {
+			return value, nil
+		}
+		return encryptField(userID, value)
+	}
+	plain, _ := decryptField(userID, value)
+	return encryptField(userID, plain)
+}
+
+// encryptStoredHistory encrypts history rows written before encryption was enabled.
+// It runs in the background in batches so startup is not delayed.
+func (s *server) encryptStoredHistory() {
+	if historyCipher == nil {
+		return
+	}
+
+	go func() {
+		total := 0
+		lastID := 0
+		for {
+			var rows []struct {
+				ID        int    `db:"id"`
+				UserID    string `db:"user_id"`
+				Text      string `db:"text_content"`
+				MediaLink string `db:"media_link"`
+			}
+			err := s.db.Select(&rows, fmt.Sprintf(`SELECT id, user_id, COALESCE(text_content, '') AS text_content, COALESCE(media_link, '') AS media_link
+				FROM message_history
+				WHERE id > $1 AND ((text_content != '' AND text_content NOT LIKE '%s%%') OR (media_link != '' AND media_link NOT LIKE '%s%%'))
+				ORDER BY id LIMIT %d`, encryptedPrefix, encryptedPrefix, historyEncryptionBatch), lastID)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to load history for encryption")
+				return
+			}
+			if len(rows) == 0 {
+				break
+			}
+
+			for _, row := range rows {
+				lastID = row.ID
+				text, err := encryptLegacyField(row.UserID, row.Text)
+				if err != nil {
+					log.Error().Err(err).Msg("Failed to encrypt history")
+					return
+				}
+				link, err := encryptLegacyField(row.UserID, row.MediaLink)
+				if err != nil {
+					log.Error().Err(err).Msg("Failed to encrypt history")
+					return
+				}
+				if _, err := s.db.Exec("UPDATE message_history SET text_content = $1, media_link = $2 WHERE id = $3", text, link, row.ID); err != nil {
+					log.Error().Err(err).Int("id", row.ID).Msg("Failed to store encrypted history")
+					return
+				}
+				total++
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if total > 0 {
+			log.Info().Int("rows", total).Msg("Encrypted existing message history")
+		}
+	}()
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"strings"
+	"testing"
+)
+
+// withHistoryKey enables history encryption with a fixed key for one test
+func withHistoryKey(t *testing.T) {
+	t.Helper()
+	block, err := aes.NewCipher([]byte("0123456789abcdef0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		t.Fatal(err)
+	}
+	was := historyCipher
+	historyCipher = aead
+	t.Cleanup(func() { historyCipher = was })
+}
+
+func TestEncryptFieldRoundTrip(t *testing.T) {
+	values := []string{"", "hello", encryptedPrefix + "not base64", plainPrefix + "x", "enc:other"}
+
+	t.Run("plaintext", func(t *testing.T) {
+		for _, value := range values {
+			stored, err := encryptField("u1", value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := decryptField("u1", stored)
+			if err != nil || got != value {
+				t.Errorf("%q: stored %q, decrypted %q, %v", value, stored, got, err)
+			}
+		}
+	})
+
+	t.Run("encrypted", func(t *testing.T) {
+		withHistoryKey(t)
+		for _, value := range values {
+			stored, err := encryptField("u1", value)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if value != "" && !strings.HasPrefix(stored, encryptedPrefix) {
+				t.Errorf("%q stored unencrypted as %q", value, stored)
+			}
+			got, err := decryptField("u1", stored)
+			if err != nil || got != value {
+				t.Errorf("%q: decrypted %q, %v", value, got, err)
+			}
+			if value != "" {
+				if _, err := decryptField("u2", stored); err == nil {
+					t.Errorf("%q decrypted for another user", value)
+				}
+			}
+		}
+	})
+}
+
+func TestEncryptLegacyField(t *testing.T) {
+	withHistoryKey(t)
+	encrypted, err := encryptField("u1", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		stored string
+		want   string
+	}{
+		{"plaintext", "hello", "hello"},
+		{"escaped plaintext", plainPrefix + encryptedPrefix + "x", encryptedPrefix + "x"},
+		{"plaintext that looks encrypted", encryptedPrefix + "x", encryptedPrefix + "x"},
+		{"encrypted", encrypted, "hello"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored, err := encryptLegacyField("u1", tt.stored)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.stored == encrypted && stored != encrypted {
+				t.Errorf("encrypted value encrypted again")
+			}
+			got, err := decryptField("u1", stored)
+			if err != nil || got != tt.want {
+				t.Errorf("decrypted %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+// TestDecryptHistoryMarksRows checks that a row that does not decrypt is
+// marked instead of failing the others
+func TestDecryptHistoryMarksRows(t *testing.T) {
+	withHistoryKey(t)
+	encrypted, _ := encryptField("u1", "secret")
+	messages := []HistoryMessage{
+		{ID: 1, UserID: "u1", TextContent: encrypted},
+		{ID: 2, UserID: "u1", TextContent: encryptedPrefix + "spoofed"},
+		{ID: 3, UserID: "u1", TextContent: "plain"},
+	}
+	decryptHistory(messages)
+
+	if messages[0].TextContent != "secret" || messages[0].Undecryptable {
+		t.Errorf("row 1 = %+v", messages[0])
+	}
+	if messages[1].TextContent != "" || !messages[1].Undecryptable {
+		t.Errorf("row 2 = %+v", messages[1])
+	}
+	if messages[2].TextContent != "plain" || messages[2].Undecryptable {
+		t.Errorf("row 3 = %+v", messages[2])
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// envelopeWrapped is {"code", "success", "data", "error"} for every response
+	envelopeWrapped = "wrapped"
+	// envelopeLegacy keeps the shapes of earlier releases: fields at the top
+	// level, or {"success", "data"} for lists
+	envelopeLegacy = "legacy"
+
+	envelopeHeader = "X-MaxAPI-Envelope"
+)
+
+// defaultEnvelope is the response shape of requests without an X-MaxAPI-Envelope header
+var defaultEnvelope = envelopeWrapped
+
+// initResponseEnvelope reads MAXAPI_RESPONSE_ENVELOPE (wrapped or legacy)
+func initResponseEnvelope() {
+	switch v := strings.ToLower(os.Getenv("MAXAPI_RESPONSE_ENVELOPE")); v {
+	case "":
+	case envelopeWrapped, envelopeLegacy:
+		defaultEnvelope = v
+	default:
+		log.Warn().Str("value", v).Msg("Unknown MAXAPI_RESPONSE_ENVELOPE, using wrapped")
+	}
+}
+
+// requestEnvelope returns the response shape a request asked for
+func requestEnvelope(r *http.Request) string {
+	switch v := strings.ToLower(r.Header.Get(envelopeHeader)); v {
+	case envelopeWrapped, envelopeLegacy:
+		return v
+	}
+	return defaultEnvelope
+}
+
+// wrapResponse puts a handler payload into the envelope
+func wrapResponse(statusCode int, payload interface{}) map[string]interface{} {
+	response := map[string]interface{}{
+		"code":    statusCode,
+		"success": statusCode < http.StatusBadRequest,
+	}
+
+	switch v := payload.(type) {
+	case error:
+		response["success"] = false
+		response["error"] = v.Error()
+	case map[string]interface{}:
+		data := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			switch key {
+			case "success":
+				if ok, isBool := value.(bool); isBool && !ok {
+					response["success"] = false
+				}
+			case "error":
+				response["error"] = value
+			default:
+				data[key] = value
+			}
+		}
+		// Failures only carry data when the handler added context, like retryAfter
+		if len(data) > 0 || response["success"] == true {
+			response["data"] = data
+		}
+	default:
+		response["data"] = v
+	}
+
+	return response
+}
+
+// legacyResponse returns the shape of earlier releases
+func legacyResponse(payload interface{}) map[string]interface{} {
+	switch v := payload.(type) {
+	case error:
+		return map[string]interface{}{
+			"success": false,
+			"error":   v.Error(),
+		}
+	case map[string]interface{}:
+		return v
+	default:
+		return map[string]interface{}{
+			"success": true,
+			"data":    v,
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
@@ -16,7 +17,6 @@ import (
 	"github.com/go-resty/resty/v2"
 	"github.com/google/uuid"
 	"github.com/jmoiron/sqlx"
-	"github.com/patrickmn/go-cache"
 	"github.com/rs/zerolog/log"
 )
 
@@ -40,20 +40,20 @@ func sendToGlobalWebHook(jsonData []byte, token string, userID string) {
 		instanceName = userinfo.(Values).Get("Name")
 	}
 
-	if *globalWebhook != "" {
-		log.Info().Str("url", *globalWebhook).Msg("Calling global webhook")
+	if webhook := globalWebhookURL(); webhook != "" {
+		log.Info().Str("url", webhook).Msg("Calling global webhook")
 		globalData := map[string]string{
 			"jsonData":     jsonDataStr,
 			"token":        token,
 			"userID":       userID,
 			"instanceName": instanceName,
 		}
-		callHook(*globalWebhook, globalData, userID)
+		callHook(webhook, globalData, userID, "", globalWebhookFormat())
 	}
 }
 
 // sendToUserWebHook sends event data to the user's webhook
-func sendToUserWebHook(webhookurl string, path string, jsonData []byte, userID string, token string) {
+func sendToUserWebHook(webhookurl string, path string, jsonData []byte, userID string, token string, chatID int64, inLane bool) {
 	instanceName := ""
 	userinfo, found := userinfocache.Get(token)
 	if found {
@@ -69,8 +69,17 @@ func sendToUserWebHook(webhookurl string, path string, jsonData []byte, userID s
 
 	if webhookurl != "" {
 		log.Info().Str("url", webhookurl).Msg("Calling user webhook")
-		if path == "" {
-			go callHook(webhookurl, data, userID)
+		if path == "" && webhookOrdered {
+			deliver := func() {
+				callHookOrdered(webhookurl, data, userID, userWebhookSecret(userID), userWebhookFormat(userID))
+			}
+			if inLane {
+				deliver()
+			} else {
+				dispatcherFor(userID).dispatch(userID, chatID, deliver)
+			}
+		} else if path == "" {
+			goTracked(userID, func() { callHook(webhookurl, data, userID, userWebhookSecret(userID), userWebhookFormat(userID)) })
 		} else {
 			errChan := make(chan error, 1)
 			go func() {
@@ -118,20 +127,36 @@ func updateAndGetUserSubscriptions(mycli *MyClient) ([]string, error) {
 }
 
 // getUserWebhookUrl returns the webhook URL for a user
-func getUserWebhookUrl(token string) string {
+func getUserWebhookUrl(s *server, token string) string {
 	webhookurl := ""
-	myuserinfo, found := userinfocache.Get(token)
-	if !found {
-		log.Warn().Str("token", token).Msg("Could not call webhook as there is no user for this token")
+	myuserinfo, found, err := s.userInfo(token)
+	if err != nil || !found {
+		log.Warn().Err(err).Str("token", token).Msg("Could not call webhook as there is no user for this token")
 	} else {
-		webhookurl = myuserinfo.(Values).Get("Webhook")
+		webhookurl = myuserinfo.Get("Webhook")
 	}
 	return webhookurl
 }
 
 // sendEventWithWebHook sends an event through webhook
 func sendEventWithWebHook(mycli *MyClient, postmap map[string]interface{}, path string) {
-	webhookurl := getUserWebhookUrl(mycli.token)
+	sendEvent(mycli, postmap, path, false)
+}
+
+// sendEventInLane sends an event from the ordered delivery lane of its chat, where
+// its slot was reserved when it arrived. The user webhook is called in place
+// instead of being queued behind the events of the chat that arrived since.
+func sendEventInLane(mycli *MyClient, postmap map[string]interface{}, path string) {
+	sendEvent(mycli, postmap, path, true)
+}
+
+// sendEvent delivers an event to the webhooks, event streams and queues of the user
+func sendEvent(mycli *MyClient, postmap map[string]interface{}, path string, inLane bool) {
+	sendEmailAlert(mycli, postmap)
+	mycli.s.logConnectionEvent(mycli.userID, postmap)
+	mycli.restorePresenceSubscriptions(postmap)
+
+	webhookurl := getUserWebhookUrl(mycli.s, mycli.token)
 
 	subscribedEvents, err := updateAndGetUserSubscriptions(mycli)
 	if err != nil {
@@ -150,19 +175,40 @@ func sendEventWithWebHook(mycli *MyClient, postmap map[string]interface{}, path
 		Strs("subscribedEvents", subscribedEvents).
 		Msg("Checking event subscription")
 
-	if !checkIfSubscribedToEvent(subscribedEvents, eventType, mycli.userID) {
+	// Event streams have their own filter, so they get events the webhook is not subscribed to
+	streaming := eventStreams.active(mycli.userID)
+	subscribed := checkIfSubscribedToEvent(subscribedEvents, eventType, mycli.userID)
+	if !subscribed && !streaming {
 		return
 	}
 
+	// Ordered delivery is keyed by the chat, read before redaction rewrites the payload
+	var chatID int64
+	if webhookOrdered {
+		chatID = eventChatID(postmap)
+	}
+
+	postmap = mycli.s.redactWebhookPayload(mycli.userID, postmap)
+
 	jsonData, err := json.Marshal(postmap)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to marshal postmap to JSON")
 		return
 	}
 
-	sendToUserWebHook(webhookurl, path, jsonData, mycli.userID, mycli.token)
-	go sendToGlobalWebHook(jsonData, mycli.token, mycli.userID)
-	go sendToGlobalRabbit(jsonData, mycli.token, mycli.userID)
+	if streaming {
+		eventStreams.publish(mycli.userID, eventType, jsonData)
+	}
+	if !subscribed {
+		return
+	}
+
+	sendToUserWebHook(webhookurl, path, jsonData, mycli.userID, mycli.token, chatID, inLane)
+	goTracked(mycli.userID, func() {
+		sendToGlobalWebHook(jsonData, mycli.token, mycli.userID)
+		sendToGlobalRabbit(jsonData, mycli.token, mycli.userID)
+		sendToNATS(jsonData, mycli.token, mycli.userID)
+	})
 }
 
 // checkIfSubscribedToEvent checks if user is subscribed to an event type
@@ -180,6 +226,9 @@ func checkIfSubscribedToEvent(subscribedEvents []string, eventType string, userI
 
 // connectOnStartup connects all authenticated users to MAX on server startup
 func (s *server) connectOnStartup() {
+	// The connected flag is only trusted after a successful login
+	stale := s.clearStaleConnections()
+
 	// Connect ALL users with auth_token (not just connected=1)
 	rows, err := s.db.Queryx(`SELECT id, name, token, max_user_id, webhook, events, proxy_url, 
 		CASE WHEN s3_enabled THEN 'true' ELSE 'false' END AS s3_enabled, 
@@ -191,6 +240,9 @@ func (s *server) connectOnStartup() {
 	}
 	defer rows.Close()
 
+	accounts := map[string]string{}
+	starts := map[string]func(){}
+
 	for rows.Next() {
 		var (
 			txtid         string
@@ -218,6 +270,11 @@ func (s *server) connectOnStartup() {
 			continue
 		}
 
+		// Accounts with a running client are already connected or reconnecting
+		if clientManager.GetMaxClient(txtid) != nil {
+			continue
+		}
+
 		log.Info().Str("token", token).Msg("Connect to MAX on startup")
 
 		v := Values{map[string]string{
@@ -232,7 +289,7 @@ func (s *server) connectOnStartup() {
 			"MediaDelivery": mediaDelivery,
 			"History":       fmt.Sprintf("%d", history),
 		}}
-		userinfocache.Set(token, v, cache.NoExpiration)
+		cacheUserInfo(token, v)
 
 		eventarray := strings.Split(events, ",")
 		var subscribedEvents []string
@@ -250,60 +307,36 @@ func (s *server) connectOnStartup() {
 		eventstring := strings.Join(subscribedEvents, ",")
 		log.Info().Str("events", eventstring).Int64("maxUserID", safeInt64(maxUserID)).Msg("Attempt to connect")
 
-		killchannel[txtid] = make(chan bool)
-		go s.startClient(txtid, *authToken, safeString(deviceID), token, subscribedEvents)
-
-		// Initialize S3 client if configured
+		// Initialize media store if configured
 		go func(userID string) {
-			var s3Config struct {
-				Enabled       bool   `db:"s3_enabled"`
-				Endpoint      string `db:"s3_endpoint"`
-				Region        string `db:"s3_region"`
-				Bucket        string `db:"s3_bucket"`
-				AccessKey     string `db:"s3_access_key"`
-				SecretKey     string `db:"s3_secret_key"`
-				PathStyle     bool   `db:"s3_path_style"`
-				PublicURL     string `db:"s3_public_url"`
-				RetentionDays int    `db:"s3_retention_days"`
-			}
-
-			err := s.db.Get(&s3Config, `
-					SELECT s3_enabled, s3_endpoint, s3_region, s3_bucket, 
-						   s3_access_key, s3_secret_key, s3_path_style, 
-						   s3_public_url, s3_retention_days
-					FROM users WHERE id = $1`, userID)
-
-			if err != nil {
-				log.Error().Err(err).Str("userID", userID).Msg("Failed to get S3 config")
-				return
-			}
-
-			if s3Config.Enabled {
-				config := &S3Config{
-					Enabled:       s3Config.Enabled,
-					Endpoint:      s3Config.Endpoint,
-					Region:        s3Config.Region,
-					Bucket:        s3Config.Bucket,
-					AccessKey:     s3Config.AccessKey,
-					SecretKey:     s3Config.SecretKey,
-					PathStyle:     s3Config.PathStyle,
-					PublicURL:     s3Config.PublicURL,
-					RetentionDays: s3Config.RetentionDays,
-				}
-
-				err = GetS3Manager().InitializeS3Client(userID, config)
-				if err != nil {
-					log.Error().Err(err).Str("userID", userID).Msg("Failed to initialize S3 client on startup")
-				} else {
-					log.Info().Str("userID", userID).Msg("S3 client initialized on startup")
-				}
+			if err := s.loadUserStorage(userID); err != nil {
+				log.Error().Err(err).Str("userID", userID).Msg("Failed to initialize media store on startup")
 			}
 		}(txtid)
+
+		accounts[txtid] = name
+		userID, auth, device := txtid, *authToken, safeString(deviceID)
+		starts[userID] = func() {
+			killchannel[userID] = make(chan bool)
+			go s.startClient(userID, auth, device, token, subscribedEvents)
+		}
 	}
 
 	if err = rows.Err(); err != nil {
 		log.Error().Err(err).Msg("DB Problem iterating rows")
 	}
+
+	if *lazyConnect {
+		s.deferStartups(starts)
+		reconciler.begin(map[string]string{}, stale)
+		return
+	}
+
+	// Track the logins before starting them so no result is missed
+	reconciler.begin(accounts, stale)
+	for _, start := range starts {
+		start()
+	}
 }
 
 // startClient starts a MAX client for a user
@@ -322,7 +355,7 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 
 	// Create MAX client
 	logger := log.With().Str("userID", userID).Logger()
-	client := maxclient.NewClient(deviceID, logger)
+	client := newMaxClient(deviceID, logger)
 
 	clientManager.SetMaxClient(userID, client)
 
@@ -363,12 +396,16 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 	clientManager.SetHTTPClient(userID, httpClient)
 
 	// Connect and login
-	syncData, err := client.ConnectAndLogin(authToken, nil)
+	acquireStartupSlot()
+	syncData, err := client.ConnectAndLogin(authToken, s.UserAgent(userID))
+	releaseStartupSlot()
+	loginFinished(userID)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to connect to MAX")
 
 		// Check if auth error (token expired/invalid)
 		if maxclient.IsAuthError(err) {
+			reconciler.report(userID, reconcileNeedsReauth, err)
 			log.Warn().Str("userID", userID).Msg("Auth token expired or invalid, clearing auth and notifying")
 			// Clear auth token in DB
 			_, dbErr := s.db.Exec("UPDATE users SET auth_token=NULL, connected=0 WHERE id=$1", userID)
@@ -381,6 +418,11 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 				"reason": err.Error(),
 			}
 			sendEventWithWebHook(mycli, postmap, "")
+		} else {
+			reconciler.report(userID, reconcileFailed, err)
+			if _, dbErr := s.db.Exec("UPDATE users SET connected=0 WHERE id=$1", userID); dbErr != nil {
+				log.Error().Err(dbErr).Msg("Failed to update connected status")
+			}
 		}
 
 		cleanupClient(userID)
@@ -392,6 +434,7 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to update connected status")
 	}
+	reconciler.report(userID, reconcileReconnected, nil)
 
 	// Send Sync event with raw data from MAX server
 	postmap := map[string]interface{}{
@@ -409,10 +452,8 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 
 	log.Info().Int64("maxUserID", client.MaxUserID).Msg("Connected to MAX")
 
-	// Keep connection alive with auto-reconnect
+	// Keep connection alive with auto-reconnect; the policy is read on every attempt so a reload applies
 	reconnectAttempts := 0
-	maxReconnectAttempts := 120
-	reconnectDelay := 5 * time.Second
 
 	for {
 		select {
@@ -420,6 +461,7 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 			log.Info().Str("userid", userID).Msg("Received kill signal")
 			client.Disconnect()
 			cleanupClient(userID)
+			s.logConnection(userID, connectionDown, "stopped")
 			_, err := s.db.Exec("UPDATE users SET connected=0 WHERE id=$1", userID)
 			if err != nil {
 				log.Error().Err(err).Msg("Failed to update disconnected status")
@@ -435,6 +477,8 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 
 			if !client.IsConnected() {
 				reconnectAttempts++
+				policy := currentReconnectPolicy()
+				maxReconnectAttempts := policy.maxAttempts
 
 				if reconnectAttempts > maxReconnectAttempts {
 					log.Error().Str("userid", userID).Int("attempts", reconnectAttempts).Msg("Max reconnect attempts reached, giving up")
@@ -465,7 +509,7 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 					sendEventWithWebHook(mycli, postmap, "")
 				}
 
-				time.Sleep(reconnectDelay)
+				time.Sleep(policy.delay)
 
 				// Check again if client was replaced during the delay
 				currentClient := clientManager.GetMaxClient(userID)
@@ -478,7 +522,7 @@ func (s *server) startClient(userID string, authToken string, deviceID string, t
 				client.Close()
 
 				// Reconnect using Login (Sync opcode 21 has server-side bugs)
-				syncData, err := client.ConnectAndLogin(authToken, nil)
+				syncData, err := client.ConnectAndLogin(authToken, s.UserAgent(userID))
 				if err != nil {
 					log.Error().Err(err).Int("attempt", reconnectAttempts).Msg("Reconnect failed")
 
@@ -544,8 +588,6 @@ func (s *server) maintainConnection(userID string, authToken string, deviceID st
 	}
 
 	reconnectAttempts := 0
-	maxReconnectAttempts := 120
-	reconnectDelay := 5 * time.Second
 
 	for {
 		select {
@@ -553,6 +595,7 @@ func (s *server) maintainConnection(userID string, authToken string, deviceID st
 			log.Info().Str("userid", userID).Msg("Received kill signal (maintainConnection)")
 			client.Disconnect()
 			cleanupClient(userID)
+			s.logConnection(userID, connectionDown, "stopped")
 			s.db.Exec("UPDATE users SET connected=0 WHERE id=$1", userID)
 			return
 		default:
@@ -566,6 +609,8 @@ func (s *server) maintainConnection(userID string, authToken string, deviceID st
 
 			if !client.IsConnected() {
 				reconnectAttempts++
+				policy := currentReconnectPolicy()
+				maxReconnectAttempts := policy.maxAttempts
 
 				if reconnectAttempts > maxReconnectAttempts {
 					log.Error().Str("userid", userID).Int("attempts", reconnectAttempts).Msg("Max reconnect attempts reached")
@@ -589,7 +634,7 @@ func (s *server) maintainConnection(userID string, authToken string, deviceID st
 					sendEventWithWebHook(mycli, postmap, "")
 				}
 
-				time.Sleep(reconnectDelay)
+				time.Sleep(policy.delay)
 
 				// Check if client was replaced during the delay
 				currentClient := clientManager.GetMaxClient(userID)
@@ -601,7 +646,7 @@ func (s *server) maintainConnection(userID string, authToken string, deviceID st
 				// Close old dead connection before creating new one
 				client.Close()
 
-				syncData, err := client.ConnectAndLogin(authToken, nil)
+				syncData, err := client.ConnectAndLogin(authToken, s.UserAgent(userID))
 				if err != nil {
 					log.Error().Err(err).Int("attempt", reconnectAttempts).Msg("Reconnect failed")
 
@@ -652,10 +697,11 @@ func cleanupClient(userID string) {
 	clientManager.DeleteMyClient(userID)
 	clientManager.DeleteHTTPClient(userID)
 	delete(killchannel, userID)
+	dropDeferred(userID)
 }
 
-// safeDeleteUser deletes a user safely, idempotent for repeated calls
-func (s *server) safeDeleteUser(userID string, sendWebhook bool) {
+// SafeDeleteUser deletes a user safely, idempotent for repeated calls
+func (s *server) SafeDeleteUser(userID string, sendWebhook bool) {
 	log.Info().Str("userID", userID).Bool("sendWebhook", sendWebhook).Msg("Safe delete user")
 
 	// 1. Check if user exists in DB
@@ -686,10 +732,28 @@ func (s *server) safeDeleteUser(userID string, sendWebhook bool) {
 		log.Error().Err(err).Str("userID", userID).Msg("Failed to delete user from DB")
 	} else {
 		log.Info().Str("userID", userID).Msg("User deleted from DB")
+		s.recordChange(userID, changeEntityUser, "deleted", userID, map[string]interface{}{"loggedOut": true})
 	}
 
 	// 4. Cleanup clients (idempotent)
 	cleanupClient(userID)
+	instanceResourceMap.Delete(userID)
+	webhookSecrets.Delete(userID)
+	userConfigs.Delete(userID)
+	featureOverrides.Delete(userID)
+	userAllowlists.Delete(userID)
+	autoMarkReads.Delete(userID)
+	webhookDispatchers.Delete(userID)
+	restrictions.Delete(userID)
+	warmupStates.Delete(userID)
+	contentPolicies.Delete(userID)
+	recipientWindows.Delete(userID)
+	windowStopped.Delete(userID)
+	invalidateUserID(userID)
+	eventStreams.closeUser(userID)
+	if historyWriter != nil {
+		historyWriter.drop(userID)
+	}
 
 	// 5. Non-blocking signal to killchannel
 	if ch := killchannel[userID]; ch != nil {
@@ -705,20 +769,31 @@ func (mycli *MyClient) handleEvent(event maxclient.Event) {
 	postmap := make(map[string]interface{})
 	postmap["type"] = event.Type
 	postmap["opcode"] = int(event.Opcode)
-	postmap["event"] = event.Payload
+	// The payload is forwarded as received; it is only decoded where it has to be inspected
+	postmap["event"] = event.RawPayload()
 	path := ""
 
 	switch event.Type {
 	case maxclient.EventTypeMessage:
-		mycli.handleMessageEvent(event, postmap)
+		metrics.messageReceived(mycli.userID)
+		msg := mycli.handleMessageEvent(event, postmap)
+		if mycli.withReplyPreview(msg, postmap, path) {
+			return // Sent with the quoted message
+		}
 	case maxclient.EventTypeMessageEdit:
 		postmap["type"] = "MessageEdit"
 	case maxclient.EventTypeMessageDelete:
 		postmap["type"] = "MessageDelete"
 	case maxclient.EventTypeReadReceipt:
 		postmap["type"] = "ReadReceipt"
+		mycli.trackCampaignRead(event)
 	case maxclient.EventTypeChatUpdate:
 		postmap["type"] = "ChatUpdate"
+		if chat, ok := event.PayloadMap()["chat"].(map[string]interface{}); ok {
+			mycli.s.recordChange(mycli.userID, changeEntityChat, "updated", fmt.Sprint(chat["id"]), chatChange(chat))
+		}
+	case maxclient.EventTypeJoinRequest:
+		postmap["type"] = "JoinRequest"
 	case maxclient.EventTypeTyping:
 		postmap["type"] = "Typing"
 	case maxclient.EventTypeReactionChange:
@@ -727,12 +802,19 @@ func (mycli *MyClient) handleEvent(event maxclient.Event) {
 		postmap["type"] = "ContactUpdate"
 	case maxclient.EventTypePresenceUpdate:
 		postmap["type"] = "PresenceUpdate"
+	case maxclient.EventTypeAccountRestricted:
+		if !mycli.restrictAccount(event, postmap) {
+			return
+		}
 	case maxclient.EventTypeDisconnected:
 		postmap["type"] = "Disconnected"
 		log.Info().Str("userID", mycli.userID).Msg("Received disconnect notification")
 	case "LoggedOut":
 		log.Info().Str("userID", mycli.userID).Msg("Received LoggedOut event from MAX")
-		mycli.s.safeDeleteUser(mycli.userID, true)
+		if _, resetting := resettingInstances.Load(mycli.userID); resetting {
+			return // The instance is kept by /session/reset
+		}
+		mycli.s.SafeDeleteUser(mycli.userID, true)
 		return // Don't continue processing
 	default:
 		log.Debug().Str("type", event.Type).Msg("Unhandled event type")
@@ -742,16 +824,16 @@ func (mycli *MyClient) handleEvent(event maxclient.Event) {
 	sendEventWithWebHook(mycli, postmap, path)
 }
 
-// handleMessageEvent handles incoming message events
-func (mycli *MyClient) handleMessageEvent(event maxclient.Event, postmap map[string]interface{}) {
-	msgEvent, err := maxclient.ParseMessageEvent(event.Payload)
+// handleMessageEvent handles incoming message events and returns the parsed message
+func (mycli *MyClient) handleMessageEvent(event maxclient.Event, postmap map[string]interface{}) *maxclient.Message {
+	msgEvent, err := maxclient.ParseMessageEventJSON(event.RawPayload())
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to parse message event")
-		return
+		return nil
 	}
 
 	if msgEvent.Message == nil {
-		return
+		return nil
 	}
 
 	msg := msgEvent.Message
@@ -761,6 +843,18 @@ func (mycli *MyClient) handleMessageEvent(event maxclient.Event, postmap map[str
 		Str("text", truncateString(msg.Text, 50)).
 		Msg("Message received")
 
+	// Opt-out keyword detection
+	mycli.handleOptOut(msg)
+
+	// Command routing to the user's handler
+	mycli.routeCommand(msg)
+
+	// Automatic read receipts
+	mycli.autoMarkRead(msg)
+
+	// Campaign delivery tracking
+	mycli.trackCampaignReply(msg)
+
 	// Process media attachments
 	if len(msg.Attaches) > 0 && !*skipMedia {
 		mycli.processAttachments(msg, postmap)
@@ -768,32 +862,26 @@ func (mycli *MyClient) handleMessageEvent(event maxclient.Event, postmap map[str
 
 	// Save to history if enabled
 	var historyLimit int
-	userinfo, found := userinfocache.Get(mycli.token)
-	if found {
-		historyStr := userinfo.(Values).Get("History")
-		historyLimit, _ = strconv.Atoi(historyStr)
+	if userinfo, found, _ := mycli.s.userInfo(mycli.token); found {
+		historyLimit, _ = strconv.Atoi(userinfo.Get("History"))
 	}
 
 	if historyLimit > 0 && msg.Text != "" {
-		err := mycli.s.saveMessageToHistory(
+		err := mycli.s.storeHistory(
 			mycli.userID,
 			fmt.Sprintf("%d", msg.ChatID),
 			fmt.Sprintf("%d", msg.Sender),
 			msg.ID,
 			string(msg.Type),
-			msg.Text,
-			"",
-			"",
+			mycli.s.redactHistoryText(mycli.userID, msg.Text),
+			historyLimit,
 		)
 		if err != nil {
 			log.Error().Err(err).Msg("Failed to save message to history")
-		} else {
-			err = mycli.s.trimMessageHistory(mycli.userID, fmt.Sprintf("%d", msg.ChatID), historyLimit)
-			if err != nil {
-				log.Error().Err(err).Msg("Failed to trim message history")
-			}
 		}
 	}
+
+	return msg
 }
 
 // processAttachments processes media attachments in a message
@@ -816,7 +904,24 @@ func (mycli *MyClient) processAttachments(msg *maxclient.Message, postmap map[st
 		s3Config.MediaDelivery = userinfo.(Values).Get("MediaDelivery")
 	}
 
+	direction := mediaDirectionOutbox
+	if msg.Sender != mycli.MaxClient.MaxUserID {
+		direction = mediaDirectionInbox
+	}
+
 	for _, attach := range msg.Attaches {
+		mediaType, remoteID := attachmentMediaType(attach)
+		rec := &MediaRecord{
+			UserID:    mycli.userID,
+			ChatID:    msg.ChatID,
+			MessageID: msg.ID,
+			Direction: direction,
+			MediaType: mediaType,
+			RemoteID:  remoteID,
+			FileName:  attach.Name,
+			Size:      attach.Size,
+		}
+
 		switch attach.Type {
 		case maxclient.AttachTypePhoto:
 			// Photo has direct URL
@@ -824,16 +929,28 @@ func (mycli *MyClient) processAttachments(msg *maxclient.Message, postmap map[st
 				postmap["mediaUrl"] = attach.BaseURL
 				postmap["mediaType"] = "image"
 
-				if s3Config.Enabled == "true" || s3Config.MediaDelivery == "base64" {
+				// With a scanner configured the photo is downloaded even when it is only
+				// delivered by URL, so blocked content never reaches the webhook
+				if s3Config.Enabled == "true" || s3Config.MediaDelivery == "base64" || scanner != nil {
 					data, err := downloadMedia(attach.BaseURL)
 					if err != nil {
 						log.Error().Err(err).Msg("Failed to download photo")
+						mycli.indexAttachment(rec)
+						continue
+					}
+					rec.MimeType = "image/jpeg"
+					rec.Size = int64(len(data))
+					rec.Checksum = mediaChecksum(data)
+
+					if !mycli.scanIncomingMedia(msg, attach, rec, data, postmap) {
+						mycli.indexAttachment(rec)
 						continue
 					}
 
 					if s3Config.Enabled == "true" && (s3Config.MediaDelivery == "s3" || s3Config.MediaDelivery == "both") {
-						s3Data, err := GetS3Manager().ProcessMediaForS3(
+						s3Data, err := storeMedia(
 							context.Background(),
+							mycli.db,
 							mycli.userID,
 							fmt.Sprintf("%d", msg.ChatID),
 							msg.ID,
@@ -843,9 +960,10 @@ func (mycli *MyClient) processAttachments(msg *maxclient.Message, postmap map[st
 							msg.Sender != mycli.MaxClient.MaxUserID,
 						)
 						if err != nil {
-							log.Error().Err(err).Msg("Failed to upload to S3")
+							log.Error().Err(err).Msg("Failed to upload to media store")
 						} else {
 							postmap["s3"] = s3Data
+							rec.applyStoredMedia(s3Data)
 						}
 					}
 
@@ -877,6 +995,92 @@ func (mycli *MyClient) processAttachments(msg *maxclient.Message, postmap map[st
 				postmap["audioUrl"] = attach.URL
 			}
 		}
+
+		if mediaType != "" {
+			mycli.indexAttachment(rec)
+		}
+	}
+}
+
+// scanIncomingMedia runs the virus scanner on downloaded media. Blocked content is
+// removed from the webhook payload and a MediaBlocked event is emitted.
+// Only photos are downloaded on receipt; video, file and audio content is
+// scanned when it is fetched through /chat/download*.
+func (mycli *MyClient) scanIncomingMedia(msg *maxclient.Message, attach maxclient.Attachment, rec *MediaRecord, data []byte, postmap map[string]interface{}) bool {
+	signature, err := scanMedia(context.Background(), data)
+	if err == nil && signature == "" {
+		return true
+	}
+
+	reason := "infected"
+	if err != nil {
+		reason = "scan_failed"
+	}
+	log.Warn().Str("userID", mycli.userID).Str("messageId", msg.ID).Str("reason", reason).Str("signature", signature).Msg("Incoming media blocked")
+
+	delete(postmap, "mediaUrl")
+	postmap["mediaBlocked"] = true
+	stripBlockedAttachment(postmap, attach.PhotoID)
+
+	emitMediaBlocked(mycli.userID, map[string]interface{}{
+		"direction": rec.Direction,
+		"chatId":    msg.ChatID,
+		"messageId": msg.ID,
+		"sender":    msg.Sender,
+		"type":      rec.MediaType,
+		"size":      len(data),
+		"checksum":  rec.Checksum,
+		"reason":    reason,
+		"signature": signature,
+	})
+	return false
+}
+
+// blockedAttachmentFields are the attachment fields that point to the content
+var blockedAttachmentFields = []string{"baseUrl", "url", "previewData", "photoToken"}
+
+// stripBlockedAttachment removes the content references of a blocked photo from
+// the MAX payload forwarded in postmap["event"], which still carries them
+func stripBlockedAttachment(postmap map[string]interface{}, photoID int64) {
+	raw, ok := postmap["event"].(json.RawMessage)
+	if !ok {
+		return
+	}
+
+	var event map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&event); err != nil {
+		// The payload can't be rewritten, so it is not forwarded at all
+		delete(postmap, "event")
+		return
+	}
+
+	message, _ := event["message"].(map[string]interface{})
+	attaches, _ := message["attaches"].([]interface{})
+	for _, item := range attaches {
+		attach, ok := item.(map[string]interface{})
+		if !ok || attach["_type"] != string(maxclient.AttachTypePhoto) || fmt.Sprint(attach["photoId"]) != strconv.FormatInt(photoID, 10) {
+			continue
+		}
+		for _, field := range blockedAttachmentFields {
+			delete(attach, field)
+		}
+		attach["blocked"] = true
+	}
+
+	stripped, err := json.Marshal(event)
+	if err != nil {
+		delete(postmap, "event")
+		return
+	}
+	postmap["event"] = json.RawMessage(stripped)
+}
+
+// indexAttachment adds an attachment to the media index
+func (mycli *MyClient) indexAttachment(rec *MediaRecord) {
+	if err := mycli.s.indexMedia(rec); err != nil {
+		log.Error().Err(err).Str("messageId", rec.MessageID).Msg("Failed to index media")
 	}
 }
 
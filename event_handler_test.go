@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog"
+
+	"maxapi/maxclient"
+)
+
+// roundTripFunc answers webhook requests without a network round trip
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
+
+// BenchmarkHandleEvent measures an incoming text message from the WebSocket
+// frame to the encoded deliveries: the frame is decoded, the message parsed,
+// and the webhook and RabbitMQ payloads built and handed to their senders.
+// The webhook is answered by a stub transport and RabbitMQ messages are
+// dropped by a full buffer, so the network is not part of the measurement.
+func BenchmarkHandleEvent(b *testing.B) {
+	s := newTestServer(b)
+	zerolog.SetGlobalLevel(zerolog.Disabled)
+	b.Cleanup(func() { zerolog.SetGlobalLevel(zerolog.ErrorLevel) })
+
+	const (
+		userID    = "bench-user"
+		token     = "bench-token"
+		webhook   = "http://webhook.invalid/events"
+		maxUserID = 7100001
+		sender    = 7100002
+	)
+
+	_, err := s.db.Exec(`INSERT INTO users (id, name, token, webhook, events, connected, auth_token)
+		VALUES ($1, $2, $3, $4, $5, 1, $6)`, userID, userID, token, webhook, "All", "auth-"+userID)
+	if err != nil {
+		b.Fatal(err)
+	}
+	cacheUserInfo(token, Values{map[string]string{
+		"Id":            userID,
+		"Name":          userID,
+		"Webhook":       webhook,
+		"Token":         token,
+		"Events":        "All",
+		"S3Enabled":     "false",
+		"MediaDelivery": "base64",
+		"History":       "0",
+	}})
+
+	var delivered atomic.Int64
+	httpClient := resty.New().SetTransport(roundTripFunc(func(r *http.Request) (*http.Response, error) {
+		io.Copy(io.Discard, r.Body)
+		delivered.Add(1)
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader("")), Header: http.Header{}, Request: r}, nil
+	}))
+	clientManager.SetHTTPClient(userID, httpClient)
+
+	client := maxclient.NewClient("bench-device", zerolog.Nop())
+	client.MaxUserID = maxUserID
+	mycli := &MyClient{
+		MaxClient:     client,
+		userID:        userID,
+		token:         token,
+		subscriptions: []string{"All"},
+		db:            s.db,
+		s:             s,
+	}
+	clientManager.SetMyClient(userID, mycli)
+
+	wasEnabled, wasBuffer := rabbitEnabled, rabbitBuffer
+	rabbitEnabled, rabbitBuffer = true, &rabbitDiskBuffer{dir: b.TempDir()}
+	b.Cleanup(func() {
+		rabbitEnabled, rabbitBuffer = wasEnabled, wasBuffer
+		cleanupClient(userID)
+	})
+
+	frame, _ := json.Marshal(map[string]interface{}{
+		"ver":    maxclient.ProtocolVersion,
+		"cmd":    0,
+		"seq":    0,
+		"opcode": int(maxclient.OpNotifMessage),
+		"payload": map[string]interface{}{
+			"chatId": maxclient.GetDialogID(maxUserID, sender),
+			"message": map[string]interface{}{
+				"id":     "115000000000000001",
+				"sender": sender,
+				"text":   "Hello, how are you?",
+				"time":   time.Now().UnixMilli(),
+				"type":   "USER",
+			},
+		},
+	})
+
+	dropped := rabbitStats.Dropped.Load()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		var msg maxclient.BaseMessage
+		if err := json.Unmarshal(frame, &msg); err != nil {
+			b.Fatal(err)
+		}
+		mycli.handleEvent(maxclient.Event{
+			Type:   maxclient.EventTypeMessage,
+			Opcode: maxclient.Opcode(msg.Opcode),
+			Raw:    msg.Payload,
+		})
+	}
+
+	// Deliveries run in the background, so the run ends once all are done
+	deadline := time.Now().Add(30 * time.Second)
+	for delivered.Load() < int64(b.N) || rabbitStats.Dropped.Load()-dropped < int64(b.N) {
+		if time.Now().After(deadline) {
+			b.Fatalf("%d of %d webhooks and %d RabbitMQ messages handed over", delivered.Load(), b.N, rabbitStats.Dropped.Load()-dropped)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	streamSendBuffer   = 256
+	streamWriteWait    = 10 * time.Second
+	streamPongWait     = 60 * time.Second
+	streamPingInterval = 30 * time.Second
+	streamMaxPerUser   = 10
+	streamMaxFrame     = 4096
+)
+
+var streamUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	// Streams authenticate with the user token, not with cookies, so any origin may connect
+	CheckOrigin: func(*http.Request) bool { return true },
+}
+
+// streamEvent is an event queued for a stream; control frames have no id
+type streamEvent struct {
+	id   int64
+	data []byte
+}
+
+// eventStream is one WebSocket or SSE consumer of a user's events
+type eventStream struct {
+	userID  string
+	conn    *websocket.Conn // nil for SSE
+	send    chan streamEvent
+	done    chan struct{}
+	once    sync.Once
+	dropped atomic.Int64
+
+	mu     sync.RWMutex
+	events []string
+}
+
+// streamControl is a frame sent by a stream consumer to change its event filter
+type streamControl struct {
+	Subscribe []string `json:"subscribe"`
+}
+
+// eventStreamHub tracks the open event streams of every user and the
+// buffers of recent events that SSE streams resume from
+type eventStreamHub struct {
+	mu      sync.RWMutex
+	streams map[string]map[*eventStream]struct{}
+	buffers map[string]*eventBuffer
+	lastID  int64
+}
+
+var eventStreams = &eventStreamHub{
+	streams: map[string]map[*eventStream]struct{}{},
+	buffers: map[string]*eventBuffer{},
+	// Ids follow the clock so they keep increasing across restarts
+	lastID: time.Now().UnixMicro(),
+}
+
+// active reports whether a user has an open stream or an event buffer
+func (h *eventStreamHub) active(userID string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.streams[userID]) > 0 || h.buffers[userID] != nil
+}
+
+// add registers a stream. With buffered set, the user's event buffer is created
+// if needed and the buffered events after lastEventID are returned, so the
+// stream continues without a gap.
+func (h *eventStreamHub) add(st *eventStream, buffered bool, lastEventID int64) ([]bufferedEvent, bool, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if len(h.streams[st.userID]) >= streamMaxPerUser {
+		return nil, false, errors.New("too many open event streams")
+	}
+	if h.streams[st.userID] == nil {
+		h.streams[st.userID] = map[*eventStream]struct{}{}
+	}
+	h.streams[st.userID][st] = struct{}{}
+
+	if !buffered || eventBufferSize == 0 {
+		return nil, lastEventID == 0, nil
+	}
+	buf := h.buffers[st.userID]
+	if buf == nil {
+		buf = &eventBuffer{since: h.lastID}
+		h.buffers[st.userID] = buf
+	}
+	events, complete := buf.after(lastEventID)
+	return events, complete, nil
+}
+
+func (h *eventStreamHub) remove(st *eventStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	delete(h.streams[st.userID], st)
+	if len(h.streams[st.userID]) == 0 {
+		delete(h.streams, st.userID)
+		if buf := h.buffers[st.userID]; buf != nil {
+			buf.idleSince = time.Now()
+		}
+	}
+}
+
+// publish assigns the event an id, adds it to the user's event buffer and
+// queues it for the streams that subscribed to its type. A stream that does not
+// keep up loses events instead of blocking the event loop.
+func (h *eventStreamHub) publish(userID, eventType string, data []byte) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.lastID++
+	ev := streamEvent{id: h.lastID, data: data}
+	if buf := h.buffers[userID]; buf != nil {
+		buf.add(bufferedEvent{streamEvent: ev, eventType: eventType})
+	}
+
+	for st := range h.streams[userID] {
+		if !st.subscribed(eventType) {
+			continue
+		}
+		select {
+		case st.send <- ev:
+		default:
+			if st.dropped.Add(1) == 1 {
+				log.Warn().Str("userID", userID).Msg("Event stream consumer too slow, dropping events")
+			}
+		}
+	}
+}
+
+// closeUser closes all streams of a user and drops its event buffer, e.g. when the user is deleted
+func (h *eventStreamHub) closeUser(userID string) {
+	h.mu.Lock()
+	streams := make([]*eventStream, 0, len(h.streams[userID]))
+	for st := range h.streams[userID] {
+		streams = append(streams, st)
+	}
+	delete(h.buffers, userID)
+	h.mu.Unlock()
+
+	for _, st := range streams {
+		st.close()
+	}
+}
+
+// expireBuffers drops the event buffers of users without streams for longer than the retention
+func (h *eventStreamHub) expireBuffers() {
+	for range time.Tick(time.Minute) {
+		h.mu.Lock()
+		for userID, buf := range h.buffers {
+			if len(h.streams[userID]) == 0 && time.Since(buf.idleSince) > eventBufferRetention {
+				delete(h.buffers, userID)
+			}
+		}
+		h.mu.Unlock()
+	}
+}
+
+func (st *eventStream) subscribed(eventType string) bool {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	return Find(st.events, eventType) || Find(st.events, "All")
+}
+
+func (st *eventStream) setEvents(events []string) {
+	st.mu.Lock()
+	st.events = events
+	st.mu.Unlock()
+}
+
+func (st *eventStream) close() {
+	st.once.Do(func() { close(st.done) })
+}
+
+// parseStreamEvents validates a list of event types; an empty list means all events
+func parseStreamEvents(events []string) ([]string, error) {
+	parsed := []string{}
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if event == "" {
+			continue
+		}
+		if !isValidEventType(event) {
+			return nil, errors.New("invalid event type: " + event)
+		}
+		parsed = append(parsed, event)
+	}
+	if len(parsed) == 0 {
+		parsed = []string{"All"}
+	}
+	return parsed, nil
+}
+
+// EventStream streams the user's events over a WebSocket
+// @Summary Event stream
+// @Description Upgrades to a WebSocket that pushes the same event payloads as the webhook in real time. The token can be passed as the token query parameter, since browsers cannot set headers on WebSocket requests. The events query parameter (comma separated) limits the stream to some event types, and a {"subscribe": [...]} frame changes the filter of an open stream. Events are streamed independently of the webhook subscription.
+// @Tags Webhook
+// @Param token query string false "User token"
+// @Param events query string false "Comma separated event types (default All)"
+// @Success 101 "Switching Protocols"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 429 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /ws [get]
+func (s *server) EventStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		events, err := parseStreamEvents(strings.Split(r.URL.Query().Get("events"), ","))
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		st := &eventStream{
+			userID: txtid,
+			send:   make(chan streamEvent, streamSendBuffer),
+			done:   make(chan struct{}),
+			events: events,
+		}
+		if _, _, err := eventStreams.add(st, false, 0); err != nil {
+			s.Respond(w, r, http.StatusTooManyRequests, err)
+			return
+		}
+		defer eventStreams.remove(st)
+
+		conn, err := streamUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// The upgrader has already answered the request
+			log.Warn().Err(err).Str("userID", txtid).Msg("Event stream upgrade failed")
+			return
+		}
+		st.conn = conn
+		defer conn.Close()
+
+		log.Info().Str("userID", txtid).Strs("events", events).Msg("Event stream opened")
+		go st.readLoop()
+		st.writeLoop(events)
+		log.Info().Str("userID", txtid).Int64("dropped", st.dropped.Load()).Msg("Event stream closed")
+	}
+}
+
+// readLoop handles filter changes and pongs until the consumer goes away
+func (st *eventStream) readLoop() {
+	defer st.close()
+
+	st.conn.SetReadLimit(streamMaxFrame)
+	st.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	st.conn.SetPongHandler(func(string) error {
+		return st.conn.SetReadDeadline(time.Now().Add(streamPongWait))
+	})
+
+	for {
+		_, frame, err := st.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var ctrl streamControl
+		if err := json.Unmarshal(frame, &ctrl); err != nil {
+			st.reply(map[string]interface{}{"type": "Error", "error": "could not decode payload"})
+			continue
+		}
+		events, err := parseStreamEvents(ctrl.Subscribe)
+		if err != nil {
+			st.reply(map[string]interface{}{"type": "Error", "error": err.Error()})
+			continue
+		}
+		st.setEvents(events)
+		st.reply(map[string]interface{}{"type": "Subscribed", "events": events})
+	}
+}
+
+// reply queues a control frame for the consumer
+func (st *eventStream) reply(frame map[string]interface{}) {
+	data, _ := json.Marshal(frame)
+	select {
+	case st.send <- streamEvent{data: data}:
+	default:
+	}
+}
+
+// writeLoop sends queued events and keepalive pings until the stream is closed
+func (st *eventStream) writeLoop(events []string) {
+	ping := time.NewTicker(streamPingInterval)
+	defer ping.Stop()
+
+	ready, _ := json.Marshal(map[string]interface{}{"type": "Subscribed", "events": events})
+	if st.write(websocket.TextMessage, ready) != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-st.done:
+			st.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			st.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		case ev := <-st.send:
+			if st.write(websocket.TextMessage, ev.data) != nil {
+				return
+			}
+		case <-ping.C:
+			if st.write(websocket.PingMessage, nil) != nil {
+				return
+			}
+		}
+	}
+}
+
+func (st *eventStream) write(messageType int, data []byte) error {
+	st.conn.SetWriteDeadline(time.Now().Add(streamWriteWait))
+	return st.conn.WriteMessage(messageType, data)
+}
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// Feature flags gate experimental behaviour. They are set for the deployment
+// in the configuration file and can be overridden per user by an admin.
+const (
+	featureWebhookV2 = "webhookV2"
+)
+
+// featureFlags lists the known flags; unknown names are rejected
+var featureFlags = []FeatureFlagInfo{
+	{Name: featureWebhookV2, Description: "Send the user webhook as a JSON body, as with WEBHOOK_FORMAT=json"},
+}
+
+// FeatureState is the effective state of a flag for a user. Source is
+// override, config, rollout or default.
+type FeatureState struct {
+	Enabled bool   `json:"enabled" example:"true"`
+	Source  string `json:"source" example:"rollout"`
+}
+
+// featureOverrides caches the per-user overrides
+var featureOverrides sync.Map
+
+func knownFeature(name string) bool {
+	for _, flag := range featureFlags {
+		if flag.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// featureSettings returns the deployment settings of every known flag
+func featureSettings() map[string]FeatureConfig {
+	features := currentConfig().Features
+	settings := make(map[string]FeatureConfig, len(featureFlags))
+	for _, flag := range featureFlags {
+		settings[flag.Name] = features[flag.Name]
+	}
+	return settings
+}
+
+// rolloutBucket places a user in 0-99 for a flag. The bucket is stable, so
+// raising the rollout percentage only adds users.
+func rolloutBucket(name, userID string) int {
+	h := fnv.New32a()
+	h.Write([]byte(name + "/" + userID))
+	return int(h.Sum32() % 100)
+}
+
+// featureFor resolves a flag: a user override wins, then the deployment setting
+func featureFor(name, userID string, overrides map[string]bool) FeatureState {
+	if enabled, ok := overrides[name]; ok {
+		return FeatureState{Enabled: enabled, Source: "override"}
+	}
+	feature := currentConfig().Features[name]
+	if feature.Enabled {
+		return FeatureState{Enabled: true, Source: "config"}
+	}
+	if feature.Rollout > 0 && rolloutBucket(name, userID) < feature.Rollout {
+		return FeatureState{Enabled: true, Source: "rollout"}
+	}
+	return FeatureState{Enabled: false, Source: "default"}
+}
+
+// getFeatureOverrides reads the flag overrides of a user
+func (s *server) getFeatureOverrides(userID string) (map[string]bool, error) {
+	if cached, ok := featureOverrides.Load(userID); ok {
+		return cached.(map[string]bool), nil
+	}
+
+	overrides := map[string]bool{}
+
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(features, '') FROM users WHERE id = $1", userID); err != nil {
+		return overrides, err
+	}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+			return overrides, err
+		}
+	}
+	featureOverrides.Store(userID, overrides)
+	return overrides, nil
+}
+
+// userFeatures returns the effective state of every known flag for a user
+func (s *server) userFeatures(userID string) (map[string]FeatureState, error) {
+	overrides, err := s.getFeatureOverrides(userID)
+	if err != nil {
+		return nil, err
+	}
+	features := make(map[string]FeatureState, len(featureFlags))
+	for _, flag := range featureFlags {
+		features[flag.Name] = featureFor(flag.Name, userID, overrides)
+	}
+	return features, nil
+}
+
+// featureEnabled reports whether a flag is on for a user. If the overrides
+// cannot be read, the deployment setting applies.
+func (s *server) featureEnabled(userID, name string) bool {
+	overrides, err := s.getFeatureOverrides(userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Str("feature", name).Msg("Could not load feature overrides")
+	}
+	return featureFor(name, userID, overrides).Enabled
+}
+
+// userFeatureEnabled reports whether a flag is on for a connected user
+func userFeatureEnabled(userID, name string) bool {
+	mycli := clientManager.GetMyClient(userID)
+	if mycli == nil {
+		return featureFor(name, userID, nil).Enabled
+	}
+	return mycli.s.featureEnabled(userID, name)
+}
+
+// GetFeatureFlags lists the feature flags
+// @Summary List feature flags
+// @Description Returns the known feature flags with their deployment settings from the configuration file: enabled turns a flag on for every user, rollout for that percentage of users
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} FeatureFlagsResponse
+// @Security AdminAuth
+// @Router /admin/features [get]
+func (s *server) GetFeatureFlags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		settings := featureSettings()
+		flags := make([]FeatureFlagInfo, 0, len(featureFlags))
+		for _, flag := range featureFlags {
+			flag.Enabled = settings[flag.Name].Enabled
+			flag.Rollout = settings[flag.Name].Rollout
+			flags = append(flags, flag)
+		}
+		sort.Slice(flags, func(i, j int) bool { return flags[i].Name < flags[j].Name })
+
+		response := map[string]interface{}{
+			"success":  true,
+			"features": flags,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetUserFeatureFlags returns the feature flags of a user
+// @Summary Get user feature flags
+// @Description Returns the effective state of every feature flag for a user and where it comes from: override, config, rollout or default
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 200 {object} UserFeaturesResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/features [get]
+func (s *server) GetUserFeatureFlags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var exists bool
+		if err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID); err != nil || !exists {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		features, err := s.userFeatures(userID)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"userID":   userID,
+			"features": features,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetUserFeatureFlags overrides feature flags for a user
+// @Summary Override user feature flags
+// @Description Turns feature flags on or off for one user regardless of the deployment settings. A null value removes the override, so the deployment setting applies again; flags left out are not changed.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userid path string true "User ID"
+// @Param request body UserFeaturesBody true "Flag overrides"
+// @Success 200 {object} UserFeaturesResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/features [post]
+func (s *server) SetUserFeatureFlags() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var exists bool
+		if err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID); err != nil || !exists {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		var msg UserFeaturesBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		for name := range msg.Features {
+			if !knownFeature(name) {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("unknown feature %q", name))
+				return
+			}
+		}
+
+		current, err := s.getFeatureOverrides(userID)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		overrides := make(map[string]bool, len(current))
+		for name, enabled := range current {
+			overrides[name] = enabled
+		}
+		for name, enabled := range msg.Features {
+			if enabled == nil {
+				delete(overrides, name)
+			} else {
+				overrides[name] = *enabled
+			}
+		}
+
+		raw, _ := json.Marshal(overrides)
+		if _, err := s.db.Exec("UPDATE users SET features = $1 WHERE id = $2", string(raw), userID); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		featureOverrides.Store(userID, overrides)
+
+		log.Info().Str("userID", userID).Interface("overrides", overrides).Msg("Feature flag overrides updated")
+
+		features, err := s.userFeatures(userID)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"userID":   userID,
+			"features": features,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetFeatures returns the feature flags in effect for the user
+// @Summary Get feature flags
+// @Description Returns which experimental features are on for this instance and why: override, config, rollout or default
+// @Tags User
+// @Produce json
+// @Success 200 {object} UserFeaturesResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/features [get]
+func (s *server) GetFeatures() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		features, err := s.userFeatures(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"userID":   txtid,
+			"features": features,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"maxapi/maxclient"
+)
+
+// folderFromBody validates a folder body and converts it for maxclient
+func folderFromBody(id string, body FolderBody) (maxclient.Folder, error) {
+	folder := maxclient.Folder{
+		ID:      id,
+		Title:   strings.TrimSpace(body.Title),
+		Include: body.Include,
+	}
+	if folder.Title == "" {
+		return folder, errors.New("title is required")
+	}
+	for _, filter := range body.Filters {
+		folder.Filters = append(folder.Filters, filter)
+	}
+	return folder, nil
+}
+
+// GetFolders lists the chat folders
+// @Summary List folders
+// @Description Returns the chat folders of the account in display order
+// @Tags Folders
+// @Produce json
+// @Success 200 {object} FoldersResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /folders [get]
+func (s *server) GetFolders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		folders, err := client.GetFolders()
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get folders failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"folders": folders,
+			"count":   len(folders),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// CreateFolder creates a chat folder
+// @Summary Create folder
+// @Description Creates a chat folder with the given chats and filters. The folder ID is generated by the gateway.
+// @Tags Folders
+// @Accept json
+// @Produce json
+// @Param request body FolderBody true "Folder"
+// @Success 200 {object} FolderResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /folders [post]
+func (s *server) CreateFolder() http.HandlerFunc {
+	return s.saveFolder(func(r *http.Request) string { return "" })
+}
+
+// UpdateFolder replaces a chat folder
+// @Summary Update folder
+// @Description Replaces the title, chats and filters of a folder
+// @Tags Folders
+// @Accept json
+// @Produce json
+// @Param folderid path string true "Folder ID"
+// @Param request body FolderBody true "Folder"
+// @Success 200 {object} FolderResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /folders/{folderid} [put]
+func (s *server) UpdateFolder() http.HandlerFunc {
+	return s.saveFolder(func(r *http.Request) string { return mux.Vars(r)["folderid"] })
+}
+
+func (s *server) saveFolder(folderID func(r *http.Request) string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg FolderBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		folder, err := folderFromBody(folderID(r), msg)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		saved, err := client.CreateOrUpdateFolder(folder)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("save folder failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"folder":  saved,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ReorderFolders sets the order of the chat folders
+// @Summary Reorder folders
+// @Description Sets the display order of the folders. List every folder ID in the new order.
+// @Tags Folders
+// @Accept json
+// @Produce json
+// @Param request body FolderReorderBody true "Folder IDs in order"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /folders/reorder [post]
+func (s *server) ReorderFolders() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg FolderReorderBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if len(msg.FolderIDs) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("folderIds is required"))
+			return
+		}
+
+		if err := client.ReorderFolders(msg.FolderIDs); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("reorder folders failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Folders reordered",
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteFolder deletes a chat folder
+// @Summary Delete folder
+// @Description Deletes a folder. The chats in it are kept.
+// @Tags Folders
+// @Produce json
+// @Param folderid path string true "Folder ID"
+// @Success 200 {object} api.MessageResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /folders/{folderid} [delete]
+func (s *server) DeleteFolder() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		if err := client.DeleteFolder(mux.Vars(r)["folderid"]); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("delete folder failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Folder deleted",
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"maxapi/handlers/chat"
+	"maxapi/maxclient"
+)
+
+const (
+	formatPlain    = "plain"
+	formatMarkdown = "markdown"
+
+	// mentionURLPrefix marks markdown links that mention a MAX user: [Anna](max://user/123)
+	mentionURLPrefix = "max://user/"
+)
+
+// elementTypes maps the element types of the REST API to MAX formatting
+var elementTypes = map[string]maxclient.FormattingType{
+	"bold":          maxclient.FormattingStrong,
+	"italic":        maxclient.FormattingEmphasized,
+	"underline":     maxclient.FormattingUnderline,
+	"strikethrough": maxclient.FormattingStrikethrough,
+	"link":          maxclient.FormattingLink,
+	"mention":       maxclient.FormattingUserMention,
+}
+
+// markdownMarkers maps the markdown delimiters to MAX formatting, longest first
+var markdownMarkers = []struct {
+	marker string
+	kind   maxclient.FormattingType
+}{
+	{"**", maxclient.FormattingStrong},
+	{"__", maxclient.FormattingUnderline},
+	{"~~", maxclient.FormattingStrikethrough},
+	{"*", maxclient.FormattingEmphasized},
+	{"_", maxclient.FormattingEmphasized},
+}
+
+// formatText resolves the formatting of a text send: markdown is converted to
+// plain text and elements, explicit elements are validated and converted
+func formatText(text, format string, elements []chat.MessageElement) (string, []maxclient.Element, error) {
+	switch format {
+	case "", formatPlain:
+		result, err := convertElements(text, elements)
+		return text, result, err
+	case formatMarkdown:
+		if len(elements) > 0 {
+			return "", nil, errors.New("elements cannot be combined with markdown")
+		}
+		plain, result, err := parseMarkdown(text)
+		if err != nil {
+			return "", nil, err
+		}
+		return plain, toUTF16Elements(plain, result), nil
+	default:
+		return "", nil, fmt.Errorf("unsupported format %q (use plain or markdown)", format)
+	}
+}
+
+// convertElements validates elements given in characters of text and converts them to MAX elements
+func convertElements(text string, elements []chat.MessageElement) ([]maxclient.Element, error) {
+	length := len([]rune(text))
+	result := make([]maxclient.Element, 0, len(elements))
+
+	for i, el := range elements {
+		kind, ok := elementTypes[el.Type]
+		if !ok {
+			return nil, fmt.Errorf("element %d: unknown type %q", i, el.Type)
+		}
+		if el.From < 0 || el.Length <= 0 || el.From+el.Length > length {
+			return nil, fmt.Errorf("element %d: range %d+%d is outside the text", i, el.From, el.Length)
+		}
+
+		element := maxclient.Element{Type: kind, From: el.From, Length: el.Length}
+		switch kind {
+		case maxclient.FormattingLink:
+			if !isHTTPURL(el.URL) {
+				return nil, fmt.Errorf("element %d: link needs an http(s) url", i)
+			}
+			element.Attributes = map[string]string{"url": el.URL}
+		case maxclient.FormattingUserMention:
+			if el.UserID <= 0 {
+				return nil, fmt.Errorf("element %d: mention needs a userId", i)
+			}
+			element.EntityID = el.UserID
+		}
+		result = append(result, element)
+	}
+
+	return toUTF16Elements(text, result), nil
+}
+
+// toUTF16Elements converts element ranges from characters to the UTF-16 code units MAX counts
+func toUTF16Elements(text string, elements []maxclient.Element) []maxclient.Element {
+	runes := []rune(text)
+	offsets := make([]int, len(runes)+1)
+	for i, r := range runes {
+		offsets[i+1] = offsets[i] + len(utf16.Encode([]rune{r}))
+	}
+
+	for i := range elements {
+		from, end := elements[i].From, elements[i].From+elements[i].Length
+		elements[i].From = offsets[from]
+		elements[i].Length = offsets[end] - offsets[from]
+	}
+	return elements
+}
+
+// mdToken is a piece of markdown source: text, a delimiter or a link
+type mdToken struct {
+	text     []rune
+	marker   string
+	kind     maxclient.FormattingType
+	canOpen  bool
+	canClose bool
+	closes   int // index of the closing delimiter, -1 when unmatched
+	closed   bool
+
+	link     bool
+	url      string
+	elements []maxclient.Element // formatting inside the link text
+}
+
+// parseMarkdown converts **bold**, *italic* or _italic_, __underline__,
+// ~~strikethrough~~, [text](https://...) links and [name](max://user/ID)
+// mentions to plain text and elements with ranges in characters. A backslash
+// escapes a delimiter, and delimiters without a partner stay in the text.
+func parseMarkdown(src string) (string, []maxclient.Element, error) {
+	tokens, err := tokenizeMarkdown([]rune(src))
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Pair every opening delimiter with the next one that can close it
+	for i := range tokens {
+		open := &tokens[i]
+		open.closes = -1
+		if open.marker == "" || open.closed || !open.canOpen {
+			continue
+		}
+		for j := i + 1; j < len(tokens); j++ {
+			t := &tokens[j]
+			if t.marker == open.marker && !t.closed && t.canClose {
+				open.closes = j
+				t.closed = true
+				break
+			}
+		}
+	}
+
+	var out []rune
+	var elements []maxclient.Element
+	starts := map[int]int{}
+	for i, t := range tokens {
+		switch {
+		case t.link:
+			from := len(out)
+			for _, el := range t.elements {
+				el.From += from
+				elements = append(elements, el)
+			}
+			out = append(out, t.text...)
+			element := maxclient.Element{Type: maxclient.FormattingLink, From: from, Length: len(t.text)}
+			if id, ok := strings.CutPrefix(t.url, mentionURLPrefix); ok {
+				userID, _ := strconv.ParseInt(id, 10, 64)
+				element.Type = maxclient.FormattingUserMention
+				element.EntityID = userID
+			} else {
+				element.Attributes = map[string]string{"url": t.url}
+			}
+			elements = append(elements, element)
+		case t.marker != "" && t.closes >= 0:
+			starts[t.closes] = len(out)
+		case t.marker != "" && t.closed:
+			if from, ok := starts[i]; ok && len(out) > from {
+				elements = append(elements, maxclient.Element{Type: t.kind, From: from, Length: len(out) - from})
+			}
+		default:
+			// Text, and delimiters without a partner
+			out = append(out, t.text...)
+		}
+	}
+
+	return string(out), elements, nil
+}
+
+// tokenizeMarkdown splits markdown into text, delimiters and links
+func tokenizeMarkdown(src []rune) ([]mdToken, error) {
+	var tokens []mdToken
+	var text []rune
+	flush := func() {
+		if len(text) > 0 {
+			tokens = append(tokens, mdToken{text: text})
+			text = nil
+		}
+	}
+
+	for i := 0; i < len(src); i++ {
+		r := src[i]
+
+		if r == '\\' && i+1 < len(src) && strings.ContainsRune(`\*_~[]()`, src[i+1]) {
+			text = append(text, src[i+1])
+			i++
+			continue
+		}
+
+		if r == '[' {
+			if label, url, end, ok := markdownLink(src, i); ok {
+				if err := checkMarkdownLink(url); err != nil {
+					return nil, err
+				}
+				label, elements, err := parseMarkdown(string(label))
+				if err != nil {
+					return nil, err
+				}
+				flush()
+				tokens = append(tokens, mdToken{text: []rune(label), link: true, url: url, elements: elements})
+				i = end
+				continue
+			}
+		}
+
+		if marker, kind, ok := markdownMarker(src, i); ok {
+			n := len([]rune(marker))
+			var prev, next rune = ' ', ' '
+			if i > 0 {
+				prev = src[i-1]
+			}
+			if i+n < len(src) {
+				next = src[i+n]
+			}
+			t := mdToken{text: src[i : i+n], marker: marker, kind: kind}
+			t.canOpen = !unicode.IsSpace(next)
+			t.canClose = !unicode.IsSpace(prev)
+			// Underscores inside words (snake_case) are not delimiters
+			if marker[0] == '_' {
+				t.canOpen = t.canOpen && !isWordRune(prev)
+				t.canClose = t.canClose && !isWordRune(next)
+			}
+			if t.canOpen || t.canClose {
+				flush()
+				tokens = append(tokens, t)
+				i += n - 1
+				continue
+			}
+		}
+
+		text = append(text, r)
+	}
+	flush()
+
+	return tokens, nil
+}
+
+// markdownMarker returns the delimiter starting at src[i]
+func markdownMarker(src []rune, i int) (string, maxclient.FormattingType, bool) {
+	for _, m := range markdownMarkers {
+		marker := []rune(m.marker)
+		if i+len(marker) <= len(src) && string(src[i:i+len(marker)]) == m.marker {
+			return m.marker, m.kind, true
+		}
+	}
+	return "", "", false
+}
+
+// markdownLink parses [label](url) starting at src[i] and returns the index of the closing parenthesis
+func markdownLink(src []rune, i int) ([]rune, string, int, bool) {
+	closeLabel := -1
+	for j := i + 1; j < len(src); j++ {
+		if src[j] == '\\' {
+			j++
+			continue
+		}
+		if src[j] == ']' {
+			closeLabel = j
+			break
+		}
+	}
+	if closeLabel < 0 || closeLabel+1 >= len(src) || src[closeLabel+1] != '(' {
+		return nil, "", 0, false
+	}
+	for j := closeLabel + 2; j < len(src); j++ {
+		if src[j] == ')' {
+			if closeLabel == i+1 || j == closeLabel+2 {
+				return nil, "", 0, false
+			}
+			return src[i+1 : closeLabel], string(src[closeLabel+2 : j]), j, true
+		}
+	}
+	return nil, "", 0, false
+}
+
+// checkMarkdownLink validates the target of a markdown link
+func checkMarkdownLink(target string) error {
+	if id, ok := strings.CutPrefix(target, mentionURLPrefix); ok {
+		if userID, err := strconv.ParseInt(id, 10, 64); err != nil || userID <= 0 {
+			return fmt.Errorf("invalid mention %q (use %sUSER_ID)", target, mentionURLPrefix)
+		}
+		return nil
+	}
+	if !isHTTPURL(target) {
+		return fmt.Errorf("invalid link %q: links need an http(s) url", target)
+	}
+	return nil
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
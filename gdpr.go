@@ -0,0 +1,422 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	gdprActionExport = "export"
+	gdprActionErase  = "erase"
+)
+
+// GDPRAuditEntry is a record of an export or erasure request
+type GDPRAuditEntry struct {
+	ID        int64  `json:"id" db:"id" example:"1"`
+	UserID    string `json:"-" db:"user_id"`
+	Action    string `json:"action" db:"action" example:"erase"`
+	IP        string `json:"ip" db:"ip" example:"203.0.113.10:52344"`
+	Details   string `json:"details" db:"details" example:"{\"history\":120,\"media\":14}"`
+	CreatedAt int64  `json:"createdAt" db:"created_at" example:"1700000000"`
+}
+
+// recordGDPRAudit appends an entry to the audit trail. Entries are kept after
+// erasure and after the instance is deleted.
+func (s *server) recordGDPRAudit(userID, action, ip string, details map[string]interface{}) {
+	raw, _ := json.Marshal(details)
+	_, err := s.db.Exec(`INSERT INTO gdpr_audit (user_id, action, ip, details, created_at) VALUES ($1, $2, $3, $4, $5)`,
+		userID, action, ip, string(raw), time.Now().Unix())
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Str("action", action).Msg("Failed to record GDPR audit entry")
+	}
+}
+
+// listGDPRAudit returns the audit trail of a user, newest first
+func (s *server) listGDPRAudit(userID string) ([]GDPRAuditEntry, error) {
+	entries := []GDPRAuditEntry{}
+	err := s.db.Select(&entries, "SELECT * FROM gdpr_audit WHERE user_id = $1 ORDER BY created_at DESC, id DESC", userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit trail: %w", err)
+	}
+	return entries, nil
+}
+
+// gdprSettings collects the instance configuration without credentials
+func (s *server) gdprSettings(userID string) (map[string]interface{}, error) {
+	var user struct {
+		Name    string `db:"name"`
+		Webhook string `db:"webhook"`
+		Events  string `db:"events"`
+		History int    `db:"history"`
+	}
+	err := s.db.Get(&user, "SELECT name, webhook, events, COALESCE(history, 0) AS history FROM users WHERE id = $1", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	quiet, err := s.getQuietHours(userID)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := s.getUserSettings(userID)
+	if err != nil {
+		return nil, err
+	}
+	keywords, err := s.getOptOutKeywords(userID)
+	if err != nil {
+		return nil, err
+	}
+	redaction, err := s.getRedactionConfig(userID)
+	if err != nil {
+		return nil, err
+	}
+	storage, err := s.getStorageConfig(userID)
+	if err != nil {
+		return nil, err
+	}
+	storageSettings := storageResponse(storage)
+	delete(storageSettings, "success")
+
+	return map[string]interface{}{
+		"name":     user.Name,
+		"webhook":  user.Webhook,
+		"events":   user.Events,
+		"history":  user.History,
+		"locale":   settings.Locale,
+		"timezone": settings.Timezone,
+		"quietHours": map[string]interface{}{
+			"enabled":  quiet.Enabled,
+			"start":    quiet.Start,
+			"end":      quiet.End,
+			"timezone": quiet.Timezone,
+		},
+		"optOutKeywords": keywords,
+		"redaction":      redaction,
+		"storage":        storageSettings,
+	}, nil
+}
+
+// gdprCampaign is a campaign together with its recipients
+type gdprCampaign struct {
+	Campaign
+	Recipients []gdprCampaignRecipient `json:"recipients"`
+}
+
+// gdprCampaignRecipient includes the template variables hidden from the campaign report
+type gdprCampaignRecipient struct {
+	CampaignRecipient
+	Variables string `json:"variables"`
+}
+
+// gdprExportFiles loads every table holding data of the user, keyed by archive file name,
+// along with the number of exported records per file
+func (s *server) gdprExportFiles(userID string) (map[string]interface{}, map[string]interface{}, error) {
+	settings, err := s.gdprSettings(userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load settings: %w", err)
+	}
+
+	history := []HistoryMessage{}
+	err = s.db.Select(&history, `SELECT id, user_id, chat_id, sender_id, message_id, timestamp, message_type,
+			COALESCE(text_content, '') AS text_content, COALESCE(media_link, '') AS media_link, COALESCE(reply_to_id, '') AS reply_to_id
+		FROM message_history WHERE user_id = $1 ORDER BY timestamp, id`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load history: %w", err)
+	}
+	decryptHistory(history)
+
+	media := []MediaRecord{}
+	if err := s.db.Select(&media, "SELECT * FROM media WHERE user_id = $1 ORDER BY created_at, id", userID); err != nil {
+		return nil, nil, fmt.Errorf("failed to load media index: %w", err)
+	}
+
+	blocklist := []BlocklistEntry{}
+	err = s.db.Select(&blocklist, "SELECT recipient_type, recipient, reason, created_at FROM blocklist WHERE user_id = $1 ORDER BY created_at, id", userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load blocklist: %w", err)
+	}
+
+	deferred, err := s.listDeferred(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+	queued := make([]map[string]interface{}, 0, len(deferred))
+	for _, msg := range deferred {
+		queued = append(queued, map[string]interface{}{
+			"id":        msg.ID,
+			"path":      msg.Path,
+			"body":      json.RawMessage(msg.Body),
+			"reason":    msg.Reason,
+			"deliverAt": msg.DeliverAt,
+			"createdAt": msg.CreatedAt,
+		})
+	}
+
+	scheduled := []ScheduledMessage{}
+	if err := s.db.Select(&scheduled, "SELECT "+scheduledColumns+" FROM scheduled_messages WHERE user_id = $1 ORDER BY send_at, id", userID); err != nil {
+		return nil, nil, fmt.Errorf("failed to load scheduled messages: %w", err)
+	}
+	for i := range scheduled {
+		scheduled[i].prepare()
+	}
+
+	var campaigns []Campaign
+	if err := s.db.Select(&campaigns, "SELECT * FROM campaigns WHERE user_id = $1 ORDER BY created_at", userID); err != nil {
+		return nil, nil, fmt.Errorf("failed to load campaigns: %w", err)
+	}
+	exported := make([]gdprCampaign, 0, len(campaigns))
+	for _, campaign := range campaigns {
+		var recipients []CampaignRecipient
+		err := s.db.Select(&recipients, "SELECT id, phone, chat_id, variables, status, message_id, error, sent_at, updated_at FROM campaign_recipients WHERE campaign_id = $1 ORDER BY id", campaign.ID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load campaign recipients: %w", err)
+		}
+		item := gdprCampaign{Campaign: campaign, Recipients: make([]gdprCampaignRecipient, 0, len(recipients))}
+		for _, rcpt := range recipients {
+			item.Recipients = append(item.Recipients, gdprCampaignRecipient{CampaignRecipient: rcpt, Variables: rcpt.Variables})
+		}
+		exported = append(exported, item)
+	}
+
+	audit, err := s.listGDPRAudit(userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counts := map[string]interface{}{
+		"history":   len(history),
+		"media":     len(media),
+		"blocklist": len(blocklist),
+		"queue":     len(queued),
+		"scheduled": len(scheduled),
+		"campaigns": len(exported),
+		"audit":     len(audit),
+	}
+
+	return map[string]interface{}{
+		"settings.json":  settings,
+		"history.json":   history,
+		"media.json":     media,
+		"blocklist.json": blocklist,
+		"queue.json":     queued,
+		"scheduled.json": scheduled,
+		"campaigns.json": exported,
+		"audit.json":     audit,
+	}, counts, nil
+}
+
+// gdprExportOrder fixes the order of files in the archive
+var gdprExportOrder = []string{"settings.json", "history.json", "media.json", "blocklist.json", "queue.json", "scheduled.json", "campaigns.json", "audit.json"}
+
+// eraseUserContent deletes stored content of a user and returns the number of removed rows per kind.
+// The account, its credentials and settings are kept.
+func (s *server) eraseUserContent(ctx context.Context, userID string, blocklist bool) (map[string]interface{}, error) {
+	var campaignIDs []string
+	if err := s.db.Select(&campaignIDs, "SELECT id FROM campaigns WHERE user_id = $1", userID); err != nil {
+		return nil, fmt.Errorf("failed to load campaigns: %w", err)
+	}
+	for _, id := range campaignIDs {
+		stopCampaignRunner(id)
+	}
+
+	if historyWriter != nil {
+		historyWriter.drop(userID)
+	}
+
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	statements := []struct {
+		name  string
+		query string
+	}{
+		{"history", "DELETE FROM message_history WHERE user_id = $1"},
+		{"media", "DELETE FROM media WHERE user_id = $1"},
+		{"queue", "DELETE FROM deferred_messages WHERE user_id = $1"},
+		{"scheduled", "DELETE FROM scheduled_messages WHERE user_id = $1"},
+		{"webhooks", "DELETE FROM webhook_queue WHERE user_id = $1"},
+		{"campaignRecipients", "DELETE FROM campaign_recipients WHERE user_id = $1"},
+		{"campaigns", "DELETE FROM campaigns WHERE user_id = $1"},
+		{"changefeed", "DELETE FROM changefeed WHERE user_id = $1 AND entity = 'message'"},
+	}
+	if blocklist {
+		statements = append(statements, struct {
+			name  string
+			query string
+		}{"blocklist", "DELETE FROM blocklist WHERE user_id = $1"})
+	}
+
+	removed := map[string]interface{}{}
+	for _, stmt := range statements {
+		res, err := tx.Exec(stmt.query, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase %s: %w", stmt.name, err)
+		}
+		n, _ := res.RowsAffected()
+		removed[stmt.name] = n
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	forgetUserUploads(userID)
+	// Replicas drop the stored messages, whose changes were removed above
+	s.recordChange(userID, changeEntityUser, "erased", userID, map[string]interface{}{"blocklist": blocklist})
+
+	// Stored objects are removed after the index, so a failure here leaves no dangling references
+	removed["storedObjects"] = false
+	manager := GetStorageManager()
+	if _, _, ok := manager.GetStore(userID); ok {
+		if err := manager.DeleteAllUserObjects(ctx, userID); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to erase stored media")
+			removed["storedObjectsError"] = err.Error()
+		} else {
+			removed["storedObjects"] = true
+		}
+	}
+
+	return removed, nil
+}
+
+// ========== GDPR ENDPOINTS ==========
+
+// ExportUserData streams all stored data of the instance as a zip archive
+// @Summary Export stored data
+// @Description Returns a zip archive with settings (without credentials), message history, media index, blocklist, queued and scheduled messages, campaigns and the GDPR audit trail. Media files are referenced by their storage key and URL.
+// @Tags GDPR
+// @Produce application/zip
+// @Success 200 {file} file "Zip archive"
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/gdpr/export [get]
+func (s *server) ExportUserData() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		files, counts, err := s.gdprExportFiles(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		now := time.Now().In(s.userLocation(txtid))
+		s.recordGDPRAudit(txtid, gdprActionExport, r.RemoteAddr, counts)
+
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"maxapi-export-%s-%s.zip\"", txtid, now.Format("20060102-150405")))
+
+		zw := zip.NewWriter(w)
+		manifest := map[string]interface{}{
+			"userId":          txtid,
+			"exportedAt":      now.Unix(),
+			"exportedAtLocal": now.Format(time.RFC3339),
+			"files":           gdprExportOrder,
+			"counts":          counts,
+		}
+		write := func(name string, v interface{}) error {
+			f, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+			if err != nil {
+				return err
+			}
+			enc := json.NewEncoder(f)
+			enc.SetIndent("", "  ")
+			return enc.Encode(v)
+		}
+
+		if err := write("manifest.json", manifest); err != nil {
+			log.Error().Err(err).Str("userID", txtid).Msg("Failed to write export archive")
+			return
+		}
+		for _, name := range gdprExportOrder {
+			if err := write(name, files[name]); err != nil {
+				log.Error().Err(err).Str("userID", txtid).Msg("Failed to write export archive")
+				return
+			}
+		}
+		if err := zw.Close(); err != nil {
+			log.Error().Err(err).Str("userID", txtid).Msg("Failed to write export archive")
+		}
+	}
+}
+
+// EraseUserData wipes stored content while keeping the account
+// @Summary Erase stored data
+// @Description Deletes message history, the media index and stored media objects, queued and scheduled messages, campaigns and the message changes of the changefeed. The account, session and settings are kept. The blocklist is kept unless blocklist is true, so opt-outs stay honored. Requires confirm=true.
+// @Tags GDPR
+// @Accept json
+// @Produce json
+// @Param request body GDPREraseBody true "Erase confirmation"
+// @Success 200 {object} GDPREraseResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/gdpr/erase [post]
+func (s *server) EraseUserData() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg GDPREraseBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if !msg.Confirm {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("confirm must be true"))
+			return
+		}
+
+		removed, err := s.eraseUserContent(r.Context(), txtid, msg.Blocklist)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		s.recordGDPRAudit(txtid, gdprActionErase, r.RemoteAddr, removed)
+		log.Info().Str("userID", txtid).Interface("removed", removed).Msg("User data erased")
+
+		response := map[string]interface{}{
+			"success": true,
+			"removed": removed,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetGDPRAudit lists export and erasure requests
+// @Summary Get GDPR audit trail
+// @Description Returns every export and erasure of the instance, newest first
+// @Tags GDPR
+// @Produce json
+// @Success 200 {object} GDPRAuditResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/gdpr/audit [get]
+func (s *server) GetGDPRAudit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		entries, err := s.listGDPRAudit(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"entries": entries,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxGroupAdminsPerRequest caps the users promoted or demoted in one request
+const maxGroupAdminsPerRequest = 100
+
+// PromoteGroupAdmins makes group members administrators
+// @Summary Promote group admins
+// @Description Makes members of a group or channel administrators. permissions is the MAX permission bitmask of the new admins; 0 or left out gives the MAX default admin rights. Returns the owner and admins of the chat after the change.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupAdminsBody true "Chat, users and permissions"
+// @Success 200 {object} GroupAdminsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/promote [post]
+func (s *server) PromoteGroupAdmins() http.HandlerFunc {
+	return s.updateGroupAdmins("add")
+}
+
+// DemoteGroupAdmins takes the administrator rights of group members
+// @Summary Demote group admins
+// @Description Takes the administrator rights of admins of a group or channel; they stay members. permissions is ignored. Returns the owner and admins of the chat after the change.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupAdminsBody true "Chat and users"
+// @Success 200 {object} GroupAdminsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/demote [post]
+func (s *server) DemoteGroupAdmins() http.HandlerFunc {
+	return s.updateGroupAdmins("remove")
+}
+
+// updateGroupAdmins promotes ("add") or demotes ("remove") group admins
+func (s *server) updateGroupAdmins(operation string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupAdminsBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+		if len(msg.UserIDs) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("userIds is required"))
+			return
+		}
+		if len(msg.UserIDs) > maxGroupAdminsPerRequest {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d users per request", maxGroupAdminsPerRequest))
+			return
+		}
+		if msg.Permissions < 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("permissions must not be negative"))
+			return
+		}
+
+		chat, err := client.UpdateChatAdmins(msg.ChatID, msg.UserIDs, operation, msg.Permissions)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("update failed: %v", err))
+			return
+		}
+		// The response does not always carry the updated chat
+		if chat == nil {
+			if chat, err = client.GetChat(msg.ChatID); err != nil {
+				log.Warn().Err(err).Str("userID", txtid).Int64("chatId", msg.ChatID).Msg("Could not reload chat admins")
+			}
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Str("operation", operation).Int("users", len(msg.UserIDs)).Msg("Group admins updated")
+
+		response := map[string]interface{}{
+			"success": true,
+			"chatId":  msg.ChatID,
+		}
+		if chat != nil {
+			response["admins"] = chat.AdminList()
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
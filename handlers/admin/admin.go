@@ -0,0 +1,245 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"maxapi/api"
+)
+
+// ========== ADMIN ENDPOINTS ==========
+
+// adminUserRow is a user as returned by the admin user endpoints
+type adminUserRow struct {
+	ID            string `json:"id" db:"id"`
+	Name          string `json:"name" db:"name"`
+	Token         string `json:"token" db:"token"`
+	MaxUserID     *int64 `json:"maxUserId" db:"max_user_id"`
+	Webhook       string `json:"webhook" db:"webhook"`
+	Events        string `json:"events" db:"events"`
+	Connected     int    `json:"connected" db:"connected"`
+	AuthToken     string `json:"-" db:"auth_token"`
+	Authenticated bool   `json:"authenticated"`
+}
+
+const adminUserColumns = "id, name, token, max_user_id, webhook, events, connected, COALESCE(auth_token, '') as auth_token"
+
+// present sets authenticated based on auth_token and hides the token unless
+// showToken is set
+func (u *adminUserRow) present(showToken bool) {
+	u.Authenticated = u.AuthToken != ""
+	if !showToken {
+		u.Token = ""
+	}
+}
+
+// ListUsers lists all users
+// @Summary List all users
+// @Description Returns the users of the system, all of them unless limit is given. Follows the list conventions: limit and cursor page through the users, sort orders them and fields selects the returned fields. As the body is the list itself, the next page is announced in the X-Next-Cursor header.
+// @Tags Admin
+// @Produce json
+// @Param limit query int false "Page size, 1-1000 (default all)"
+// @Param cursor query string false "X-Next-Cursor of the previous page"
+// @Param sort query string false "id or name, prefixed with - for descending"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,name,connected"
+// @Success 200 {object} ListUsersResponse
+// @Header 200 {string} X-Next-Cursor "Cursor of the next page, missing after the last page"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users [get]
+func (h *Handlers) ListUsers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q, err := api.ParseListQuery(r, api.ListOptions{MaxLimit: 1000, Sorts: []string{"id", "name"}})
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// The sort field is one of the allowed columns, so it can go into the query
+		dir := "ASC"
+		if q.Desc {
+			dir = "DESC"
+		}
+		order := "id " + dir
+		if q.Sort == "name" {
+			order = "name " + dir + ", id " + dir
+		}
+		query := "SELECT " + adminUserColumns + " FROM users ORDER BY " + order
+		args := []interface{}{}
+		if q.Limit > 0 {
+			// One extra row tells whether there is a next page
+			query += " LIMIT $1 OFFSET $2"
+			args = append(args, q.Limit+1, q.Cursor.Offset)
+		}
+
+		var users []adminUserRow
+		err = h.DB().Select(&users, query, args...)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if q.Limit > 0 && len(users) > q.Limit {
+			users = users[:q.Limit]
+			api.SetNextCursor(w, api.ListCursor{Offset: q.Cursor.Offset + q.Limit}.Encode())
+		}
+
+		for i := range users {
+			users[i].present(h.TokenVisible(r, users[i].Token))
+		}
+
+		h.Respond(w, r, http.StatusOK, q.SelectFields(users))
+	}
+}
+
+// GetAdminUser returns one user
+// @Summary Get user
+// @Description Returns one user. The token is only included for superadmin keys and when it is not stored hashed.
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 200 {object} AdminUserResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid} [get]
+func (h *Handlers) GetAdminUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var user adminUserRow
+		err := h.DB().Get(&user, "SELECT "+adminUserColumns+" FROM users WHERE id = $1", userID)
+		if errors.Is(err, sql.ErrNoRows) {
+			h.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		user.present(h.TokenVisible(r, user.Token))
+
+		h.Respond(w, r, http.StatusOK, user)
+	}
+}
+
+// AddUser creates a new user
+// @Summary Create user
+// @Description Creates a new user in the system
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body AddUserBody true "User data"
+// @Success 200 {object} AddUserResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users [post]
+func (h *Handlers) AddUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg AddUserBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.Webhook != "" {
+			if err := api.ValidateWebhookURL(msg.Webhook); err != nil {
+				h.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		id, token, err := h.CreateUser(msg)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"id":      id,
+			"token":   token,
+			"name":    msg.Name,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// EditUser updates a user
+// @Summary Update user
+// @Description Updates an existing user
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userid path string true "User ID"
+// @Param request body EditUserBody true "User data"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid} [put]
+func (h *Handlers) EditUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID := vars["userid"]
+
+		var msg EditUserBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.Webhook != "" {
+			if err := api.ValidateWebhookURL(msg.Webhook); err != nil {
+				h.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		if _, err := h.UpdateUser(userID, msg); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "User updated",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteUser deletes a user
+// @Summary Delete user
+// @Description Deletes a user from the system
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 200 {object} api.MessageResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid} [delete]
+func (h *Handlers) DeleteUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		userID := vars["userid"]
+
+		if _, err := h.Server.DeleteUser(userID); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "User deleted",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,51 @@
+package admin
+
+// ========== ADMIN RESPONSES ==========
+
+// AddUserResponse represents the response for adding a user
+// @Description Response after creating a new user
+type AddUserResponse struct {
+	Success bool   `json:"success" example:"true"`
+	ID      string `json:"id" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
+	Token   string `json:"token" example:"abc123def456"`
+	Name    string `json:"name" example:"John Doe"`
+}
+
+// ListUsersResponse represents the response for listing users
+// @Description Response with list of users
+type ListUsersResponse struct {
+	Success bool           `json:"success" example:"true"`
+	Data    []UserResponse `json:"data"`
+}
+
+// AdminUserResponse represents the response for getting one user
+type AdminUserResponse struct {
+	Success bool         `json:"success" example:"true"`
+	Data    UserResponse `json:"data"`
+}
+
+// UserResponse represents a user in the system
+type UserResponse struct {
+	ID            string `json:"id" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
+	Name          string `json:"name" example:"John Doe"`
+	Token         string `json:"token" example:"abc123def456"`
+	MaxUserID     *int64 `json:"maxUserId" example:"123456789"`
+	Webhook       string `json:"webhook" example:"https://example.com/webhook"`
+	Events        string `json:"events" example:"All"`
+	Connected     int    `json:"connected" example:"1"`
+	Authenticated bool   `json:"authenticated" example:"true"`
+}
+
+// AddUserBody represents the request body for adding a user
+type AddUserBody struct {
+	Name    string `json:"name" example:"John Doe"`
+	Webhook string `json:"webhook" example:"https://example.com/webhook"`
+	Events  string `json:"events" example:"All"`
+}
+
+// EditUserBody represents the request body for editing a user
+type EditUserBody struct {
+	Name    string `json:"name" example:"John Doe"`
+	Webhook string `json:"webhook" example:"https://example.com/webhook"`
+	Events  string `json:"events" example:"All"`
+}
@@ -0,0 +1,35 @@
+// Package admin serves the endpoints that manage the users of the gateway.
+package admin
+
+import (
+	"net/http"
+
+	"maxapi/api"
+)
+
+// Server is what the admin handlers use of the server
+type Server interface {
+	api.Server
+
+	// CreateUser adds an instance and returns its ID and token
+	CreateUser(msg AddUserBody) (string, string, error)
+	// UpdateUser changes the name, webhook and events of an instance. It
+	// returns false when the instance does not exist.
+	UpdateUser(userID string, msg EditUserBody) (bool, error)
+	// DeleteUser disconnects and deletes an instance. It returns false when
+	// the instance does not exist.
+	DeleteUser(userID string) (bool, error)
+	// TokenVisible reports whether the admin key of a request may see a user
+	// token, which grants full access to the instance
+	TokenVisible(r *http.Request, token string) bool
+}
+
+// Handlers serves the admin user endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the admin handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
@@ -0,0 +1,384 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+)
+
+// authTimeouts stores timers for auto-closing auth sessions after 5 minutes
+var authTimeouts = make(map[string]*time.Timer)
+var authTimeoutsMu sync.Mutex
+
+// ========== AUTH ENDPOINTS ==========
+
+// AuthRequest handles SMS code request
+// @Summary Request SMS verification code
+// @Description Sends an SMS verification code to the specified phone number
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body AuthRequestBody true "Phone number and language"
+// @Success 200 {object} AuthRequestResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/auth/request [post]
+func (h *Handlers) AuthRequest() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		var body AuthRequestBody
+		if err := h.DecodeJSON(r, &body); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if body.Phone == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("phone number is required"))
+			return
+		}
+
+		// Create device ID if not exists
+		deviceID := uuid.New().String()
+
+		// Create temporary MAX client for auth
+		logger := log.With().Str("userID", txtid).Logger()
+		client := h.NewMaxClient(deviceID, logger)
+
+		if err := client.Connect(); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("connection failed: %v", err))
+			return
+		}
+
+		if err := client.SessionInit(h.UserAgent(txtid)); err != nil {
+			client.Close()
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("session init failed: %v", err))
+			return
+		}
+
+		if body.Language == "" {
+			if locale, err := h.UserLocale(txtid); err == nil {
+				body.Language = locale
+			}
+		}
+
+		tempToken, err := client.RequestAuthCode(body.Phone, body.Language)
+		if err != nil {
+			client.Close()
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("auth request failed: %v", err))
+			return
+		}
+
+		// Store temp token and device ID
+		_, err = h.DB().Exec("UPDATE users SET temp_token=$1, device_id=$2 WHERE id=$3", tempToken, deviceID, txtid)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to store temp token")
+		}
+
+		// Store client temporarily for auth flow
+		h.SetMaxClient(txtid, client)
+
+		// Start ping loop to keep connection alive during auth flow
+		client.StartPingLoop()
+
+		// Set 5-minute timeout to auto-close auth session
+		authTimeoutsMu.Lock()
+		if oldTimer := authTimeouts[txtid]; oldTimer != nil {
+			oldTimer.Stop()
+		}
+		authTimeouts[txtid] = time.AfterFunc(5*time.Minute, func() {
+			log.Info().Str("userID", txtid).Msg("Auth session timed out after 5 minutes")
+			if c := h.MaxClient(txtid); c != nil {
+				c.Close()
+				h.DeleteMaxClient(txtid)
+			}
+			authTimeoutsMu.Lock()
+			delete(authTimeouts, txtid)
+			authTimeoutsMu.Unlock()
+		})
+		authTimeoutsMu.Unlock()
+
+		// Send webhook event
+		h.SendEvent(txtid, map[string]interface{}{
+			"type":  "AuthCodeSent",
+			"phone": body.Phone,
+		})
+
+		response := map[string]interface{}{
+			"success":   true,
+			"message":   "Verification code sent",
+			"tempToken": tempToken,
+		}
+
+		// Update cache
+		h.UpdateUserInfo(r, "TempToken", tempToken)
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// AuthConfirm handles SMS code verification
+// @Summary Confirm SMS verification code
+// @Description Verifies the SMS code and returns auth token
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body AuthConfirmBody true "SMS code"
+// @Success 200 {object} AuthConfirmResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/auth/confirm [post]
+func (h *Handlers) AuthConfirm() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		// Cancel auth timeout
+		authTimeoutsMu.Lock()
+		if timer := authTimeouts[txtid]; timer != nil {
+			timer.Stop()
+			delete(authTimeouts, txtid)
+		}
+		authTimeoutsMu.Unlock()
+
+		var body AuthConfirmBody
+		if err := h.DecodeJSON(r, &body); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if body.Code == "" || len(body.Code) != 6 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("valid 6-digit code is required"))
+			return
+		}
+
+		// Get temp token from DB
+		var tempToken string
+		if err := h.DB().Get(&tempToken, "SELECT temp_token FROM users WHERE id=$1", txtid); err != nil {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("no pending auth request"))
+			return
+		}
+
+		client := h.MaxClient(txtid)
+		if client == nil {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("no active auth session"))
+			return
+		}
+
+		authToken, registerToken, err := client.SubmitAuthCode(body.Code, tempToken)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("code verification failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+		}
+
+		if authToken != "" {
+			// Existing user - save auth token
+			_, err = h.DB().Exec("UPDATE users SET auth_token=$1, temp_token='' WHERE id=$2", authToken, txtid)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to save auth token")
+			}
+			h.MarkAuthenticated(txtid)
+
+			// Close the temporary auth client so /session/connect can create a proper one
+			client.Close()
+			h.DeleteMaxClient(txtid)
+
+			response["message"] = "Login successful"
+			response["authToken"] = authToken
+			response["requiresRegistration"] = false
+
+			h.UpdateUserInfo(r, "AuthToken", authToken)
+		} else if registerToken != "" {
+			// New user - needs registration (keep client open for registration)
+			_, err = h.DB().Exec("UPDATE users SET temp_token=$1 WHERE id=$2", registerToken, txtid)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to save register token")
+			}
+
+			response["message"] = "Registration required"
+			response["registerToken"] = registerToken
+			response["requiresRegistration"] = true
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// AuthRegister handles new user registration
+// @Summary Register new user
+// @Description Registers a new user with first and last name
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body AuthRegisterBody true "User registration data"
+// @Success 200 {object} AuthRegisterResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/auth/register [post]
+func (h *Handlers) AuthRegister() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		// Cancel auth timeout
+		authTimeoutsMu.Lock()
+		if timer := authTimeouts[txtid]; timer != nil {
+			timer.Stop()
+			delete(authTimeouts, txtid)
+		}
+		authTimeoutsMu.Unlock()
+
+		var body AuthRegisterBody
+		if err := h.DecodeJSON(r, &body); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if body.FirstName == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("firstName is required"))
+			return
+		}
+
+		// Get register token from DB
+		var registerToken string
+		if err := h.DB().Get(&registerToken, "SELECT temp_token FROM users WHERE id=$1", txtid); err != nil {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("no pending registration"))
+			return
+		}
+
+		client := h.MaxClient(txtid)
+		if client == nil {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("no active auth session"))
+			return
+		}
+
+		authToken, err := client.Register(body.FirstName, body.LastName, registerToken)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("registration failed: %v", err))
+			return
+		}
+
+		// Save auth token
+		_, err = h.DB().Exec("UPDATE users SET auth_token=$1, temp_token='' WHERE id=$2", authToken, txtid)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to save auth token")
+		}
+		h.MarkAuthenticated(txtid)
+
+		// Close the temporary auth client so /session/connect can create a proper one
+		client.Close()
+		h.DeleteMaxClient(txtid)
+
+		h.UpdateUserInfo(r, "AuthToken", authToken)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"message":   "Registration successful",
+			"authToken": authToken,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// AuthToken attaches an existing MAX session
+// @Summary Sign in with a session token
+// @Description Attaches an account with the auth token of an existing MAX session instead of an SMS code. The token is checked by logging in once; on success it is saved and /session/connect can be called. MAX web sign-in by QR code is not available in the protocol used by this gateway.
+// @Tags Auth
+// @Accept json
+// @Produce json
+// @Param request body AuthTokenBody true "Session token"
+// @Success 200 {object} AuthTokenResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 401 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse "Already connected"
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/auth/token [post]
+func (h *Handlers) AuthToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		var body AuthTokenBody
+		if err := h.DecodeJSON(r, &body); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		body.AuthToken = strings.TrimSpace(body.AuthToken)
+		if body.AuthToken == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("authToken is required"))
+			return
+		}
+
+		if h.IsConnected(txtid) {
+			h.Respond(w, r, http.StatusConflict, errors.New("already connected"))
+			return
+		}
+
+		// Drop a pending SMS auth session
+		authTimeoutsMu.Lock()
+		if timer := authTimeouts[txtid]; timer != nil {
+			timer.Stop()
+			delete(authTimeouts, txtid)
+		}
+		authTimeoutsMu.Unlock()
+		if client := h.MaxClient(txtid); client != nil {
+			client.Close()
+			h.DeleteMaxClient(txtid)
+		}
+
+		deviceID := body.DeviceID
+		if deviceID == "" {
+			deviceID = uuid.New().String()
+		}
+
+		// Log in once with a temporary client to check the token
+		logger := log.With().Str("userID", txtid).Logger()
+		client := h.NewMaxClient(deviceID, logger)
+		if err := client.Connect(); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("connection failed: %v", err))
+			return
+		}
+		defer client.Close()
+
+		if err := client.SessionInit(h.UserAgent(txtid)); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("session init failed: %v", err))
+			return
+		}
+		if _, err := client.Login(body.AuthToken); err != nil {
+			h.Respond(w, r, http.StatusUnauthorized, fmt.Errorf("login with token failed: %v", err))
+			return
+		}
+		maxUserID := client.MaxUserID
+
+		if _, err := h.DB().Exec("UPDATE users SET auth_token=$1, device_id=$2, temp_token='' WHERE id=$3", body.AuthToken, deviceID, txtid); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to save auth token: %v", err))
+			return
+		}
+		h.MarkAuthenticated(txtid)
+
+		h.UpdateUserInfo(r, "AuthToken", body.AuthToken)
+
+		log.Info().Str("userID", txtid).Int64("maxUserID", maxUserID).Msg("Account attached with a session token")
+
+		response := map[string]interface{}{
+			"success":   true,
+			"message":   "Login successful",
+			"maxUserID": maxUserID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
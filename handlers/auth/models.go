@@ -0,0 +1,62 @@
+package auth
+
+// ========== AUTH RESPONSES ==========
+
+// AuthRequestResponse represents the response for auth code request
+// @Description Response after requesting SMS verification code
+type AuthRequestResponse struct {
+	Success   bool   `json:"success" example:"true"`
+	Message   string `json:"message" example:"Verification code sent"`
+	TempToken string `json:"tempToken" example:"temp_token_value"`
+}
+
+// AuthConfirmResponse represents the response for auth code confirmation
+// @Description Response after confirming SMS verification code
+type AuthConfirmResponse struct {
+	Success              bool   `json:"success" example:"true"`
+	Message              string `json:"message" example:"Login successful"`
+	AuthToken            string `json:"authToken,omitempty" example:"auth_token_value"`
+	RegisterToken        string `json:"registerToken,omitempty" example:"register_token_value"`
+	RequiresRegistration bool   `json:"requiresRegistration" example:"false"`
+}
+
+// AuthRegisterResponse represents the response for user registration
+// @Description Response after successful registration
+type AuthRegisterResponse struct {
+	Success   bool   `json:"success" example:"true"`
+	Message   string `json:"message" example:"Registration successful"`
+	AuthToken string `json:"authToken" example:"auth_token_value"`
+}
+
+// AuthTokenResponse represents the response for signing in with a session token
+// @Description Response after attaching an account with an existing session token
+type AuthTokenResponse struct {
+	Success   bool   `json:"success" example:"true"`
+	Message   string `json:"message" example:"Login successful"`
+	MaxUserID int64  `json:"maxUserID" example:"123456789"`
+}
+
+// ========== ADMIN RESPONSES ==========
+
+// AuthRequestBody represents the request body for SMS code request
+type AuthRequestBody struct {
+	Phone    string `json:"phone" example:"79001234567"`
+	Language string `json:"language" example:"ru"`
+}
+
+// AuthConfirmBody represents the request body for SMS code confirmation
+type AuthConfirmBody struct {
+	Code string `json:"code" example:"123456"`
+}
+
+// AuthTokenBody represents the request body for signing in with a session token
+type AuthTokenBody struct {
+	AuthToken string `json:"authToken" example:"auth_token_value"`
+	DeviceID  string `json:"deviceId,omitempty" example:"3f1e7c0a-8d2b-4c55-9a61-0b7d2e4f9c13"`
+}
+
+// AuthRegisterBody represents the request body for user registration
+type AuthRegisterBody struct {
+	FirstName string `json:"firstName" example:"John"`
+	LastName  string `json:"lastName" example:"Doe"`
+}
@@ -0,0 +1,43 @@
+// Package auth serves the endpoints that sign an instance in to MAX.
+package auth
+
+import (
+	"github.com/rs/zerolog"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// Server is what the auth handlers use of the server
+type Server interface {
+	api.Server
+	api.Clients
+
+	// NewMaxClient returns a MAX client for the device
+	NewMaxClient(deviceID string, logger zerolog.Logger) *maxclient.Client
+	// SetMaxClient and DeleteMaxClient keep the client of an instance while
+	// it signs in
+	SetMaxClient(userID string, client *maxclient.Client)
+	DeleteMaxClient(userID string)
+	// IsConnected reports whether the instance is connected to MAX
+	IsConnected(userID string) bool
+	// UserAgent returns the user agent sent to MAX for the instance
+	UserAgent(userID string) *maxclient.UserAgent
+	// UserLocale returns the default language of the instance, "" when none is set
+	UserLocale(userID string) (string, error)
+	// MarkAuthenticated records when the instance signed in, which starts its warm-up
+	MarkAuthenticated(userID string)
+	// SendEvent sends an event to the webhook and queues of an instance that
+	// has a connection
+	SendEvent(userID string, postmap map[string]interface{})
+}
+
+// Handlers serves the auth endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the auth handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
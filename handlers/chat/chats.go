@@ -0,0 +1,524 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// ========== CHAT HISTORY ENDPOINTS ==========
+
+// GetChatList lists the chats of the account
+// @Summary List chats
+// @Description Returns a page of chats, dialogs and channels, most recent activity first, without reconnecting like /session/sync. Pass the returned nextCursor (or the older marker) to get the next page; both are empty after the last page. limit cuts the pages MAX returns into smaller ones, and fields selects the returned fields. The order is fixed by MAX, so sort is not supported. muted and muteUntil (Unix time, -1 until unmuted, 0 when not muted) report the notification state of each chat.
+// @Tags Chat
+// @Produce json
+// @Param limit query int false "Page size, 1-100 (default the page MAX returns)"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,type,title"
+// @Param marker query int false "Marker returned by the previous page"
+// @Success 200 {object} ChatListResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/list [get]
+func (h *Handlers) GetChatList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		q, err := api.ParseListQuery(r, api.ListOptions{MaxLimit: 100})
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		marker := q.Cursor.Marker
+		if v := r.URL.Query().Get("marker"); v != "" && marker == 0 {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				h.Respond(w, r, http.StatusBadRequest, errors.New("invalid marker"))
+				return
+			}
+			marker = n
+		}
+		if marker == 0 && q.Limit > 0 {
+			// Later parts of the first page must come from the same page
+			marker = time.Now().UnixMilli()
+		}
+
+		list, next, err := client.GetChatsList(marker)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get chats: %v", err))
+			return
+		}
+
+		// A limit below the size of the MAX page is served in parts of that page
+		start, end, nextPart := q.OffsetPage(len(list))
+		list = list[start:end]
+		nextCursor := ""
+		if nextPart != "" {
+			nextCursor = api.ListCursor{Marker: marker, Offset: end}.Encode()
+		} else if next != 0 {
+			nextCursor = api.ListCursor{Marker: next}.Encode()
+		}
+		api.SetNextCursor(w, nextCursor)
+
+		chats := []map[string]interface{}{}
+		dialogs := []map[string]interface{}{}
+		channels := []map[string]interface{}{}
+		for _, chat := range list {
+			if id, ok := chat["id"].(float64); ok {
+				until := client.ChatMuteUntil(int64(id))
+				chat["muted"] = until != 0
+				chat["muteUntil"] = MuteUntilSeconds(until)
+			}
+			switch maxclient.ChatType(fmt.Sprint(chat["type"])) {
+			case maxclient.ChatTypeDialog:
+				dialogs = append(dialogs, chat)
+			case maxclient.ChatTypeChannel:
+				channels = append(channels, chat)
+			default:
+				chats = append(chats, chat)
+			}
+		}
+
+		response := map[string]interface{}{
+			"success":    true,
+			"chats":      q.SelectFields(chats),
+			"dialogs":    q.SelectFields(dialogs),
+			"channels":   q.SelectFields(channels),
+			"count":      len(list),
+			"marker":     next,
+			"nextCursor": nextCursor,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetChatHistory gets chat history
+// @Summary Get chat history
+// @Description Gets message history for a chat, going back from fromTime (now by default). Follows the list conventions: limit overrides count, the returned nextCursor continues with older messages, sort orders the page by time and fields selects the returned fields.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ChatHistoryBody true "History parameters"
+// @Param limit query int false "Page size, 1-200 (default count, then 50)"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "time or -time (newest first)"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,sender,text"
+// @Success 200 {object} ChatHistoryResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/history [post]
+func (h *Handlers) GetChatHistory() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ChatHistoryBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		q, err := api.ParseListQuery(r, api.ListOptions{MaxLimit: 200, Sorts: []string{"time"}})
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		count := msg.Count
+		if q.Limit > 0 {
+			count = q.Limit
+		}
+		if count == 0 {
+			count = 50
+		}
+		fromTime := msg.FromTime
+		if q.Cursor.Time > 0 {
+			fromTime = q.Cursor.Time
+		}
+
+		messages, err := client.GetChatHistory(msg.ChatID, fromTime, 0, count)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get history failed: %v", err))
+			return
+		}
+
+		// A full page may have older messages before it
+		next := ""
+		if len(messages) >= count {
+			oldest := messages[0].Time
+			for _, m := range messages {
+				oldest = min(oldest, m.Time)
+			}
+			next = api.ListCursor{Time: oldest - 1}.Encode()
+		}
+		api.SetNextCursor(w, next)
+
+		if q.Sort == "time" {
+			api.SortSlice(messages, q.Desc, func(i, j int) bool { return messages[i].Time < messages[j].Time })
+		}
+
+		response := map[string]interface{}{
+			"success":    true,
+			"messages":   q.SelectFields(messages),
+			"nextCursor": next,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// galleryTypes maps the media types of /chat/media to attachment types
+var galleryTypes = map[string]maxclient.AttachType{
+	"photo": maxclient.AttachTypePhoto,
+	"video": maxclient.AttachTypeVideo,
+	"file":  maxclient.AttachTypeFile,
+	"audio": maxclient.AttachTypeAudio,
+	"link":  maxclient.AttachTypeShare,
+}
+
+// GetChatMedia lists media messages of a chat
+// @Summary List chat media
+// @Description Lists the messages of a chat with photos, videos, files, audio or links, newest first, without paging the full history. Pass the returned marker to get the next page; it is empty after the last page.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ChatMediaBody true "Media query"
+// @Success 200 {object} ChatMediaResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/media [post]
+func (h *Handlers) GetChatMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ChatMediaBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		attachType, ok := galleryTypes[strings.ToLower(msg.Type)]
+		if !ok {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("type must be photo, video, file, audio or link"))
+			return
+		}
+
+		count := msg.Count
+		if count == 0 {
+			count = 50
+		}
+		if count < 0 || count > 100 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("count must be between 1 and 100"))
+			return
+		}
+
+		messages, next, err := client.GetChatMedia(msg.ChatID, attachType, msg.Marker, count)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get chat media failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"messages": messages,
+			"count":    len(messages),
+			"marker":   next,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// maxSearchResults caps the results of a message search
+const maxSearchResults = 100
+
+// SearchMessages searches messages of a chat
+// @Summary Search messages
+// @Description Searches the text of messages in a chat on the MAX server, without downloading the history
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body SearchMessagesBody true "Search parameters"
+// @Success 200 {object} SearchMessagesResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/search [post]
+func (h *Handlers) SearchMessages() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg SearchMessagesBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		msg.Query = strings.TrimSpace(msg.Query)
+		if msg.Query == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("query is required"))
+			return
+		}
+
+		limit := msg.Limit
+		if limit == 0 {
+			limit = 50
+		}
+		if limit < 0 || limit > maxSearchResults {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxSearchResults))
+			return
+		}
+
+		messages, err := client.SearchMessages(msg.ChatID, msg.Query, limit)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("search failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"messages": messages,
+			"count":    len(messages),
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SearchPublic searches public channels and groups
+// @Summary Search public chats
+// @Description Searches public channels and groups by name. Results carry the chat metadata and the public link used to join.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body SearchPublicBody true "Search query"
+// @Success 200 {object} SearchPublicResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/searchpublic [post]
+func (h *Handlers) SearchPublic() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg SearchPublicBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		msg.Query = strings.TrimSpace(msg.Query)
+		if msg.Query == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("query is required"))
+			return
+		}
+
+		chats, err := client.SearchPublic(msg.Query)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("search failed: %v", err))
+			return
+		}
+
+		results := make([]PublicChatResult, 0, len(chats))
+		for _, chat := range chats {
+			results = append(results, PublicChatResult{
+				ChatID:            chat.ID,
+				Type:              string(chat.Type),
+				Title:             chat.Title,
+				Description:       chat.Description,
+				ParticipantsCount: chat.ParticipantsCount,
+				Link:              chat.Link,
+				IconURL:           chat.BaseIconURL,
+			})
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"chats":   results,
+			"count":   len(results),
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ========== REACTIONS ==========
+
+// React adds reaction to message
+// @Summary Add reaction
+// @Description Adds or removes a reaction to a message
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ReactBody true "Reaction data"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/react [post]
+func (h *Handlers) React() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ReactBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.MessageID == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("messageId is required"))
+			return
+		}
+
+		var err error
+		if msg.Reaction == "" {
+			_, err = client.RemoveReaction(msg.ChatID, msg.MessageID.String())
+		} else {
+			_, err = client.AddReaction(msg.ChatID, msg.MessageID.String(), msg.Reaction)
+		}
+
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("react failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Reaction updated",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// maxDetailedReactions caps the reactions returned in one page
+const maxDetailedReactions = 100
+
+// GetDetailedReactions lists who reacted to a message
+// @Summary List who reacted
+// @Description Returns the users who reacted to a message and their reaction, for example to measure engagement on channel posts. reaction limits the list to one reaction. count (1-100, default 50) sets the page size; pass the returned marker to get the next page, it is 0 after the last.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body DetailedReactionsBody true "Message and page"
+// @Success 200 {object} DetailedReactionsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/reactions/detailed [post]
+func (h *Handlers) GetDetailedReactions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg DetailedReactionsBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.ChatID == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+		if msg.MessageID == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("messageId is required"))
+			return
+		}
+		if msg.Marker < 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("invalid marker"))
+			return
+		}
+
+		count := msg.Count
+		if count == 0 {
+			count = 50
+		}
+		if count < 0 || count > maxDetailedReactions {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("count must be between 1 and %d", maxDetailedReactions))
+			return
+		}
+
+		reactions, next, err := client.GetDetailedReactions(msg.ChatID, msg.MessageID.String(), msg.Reaction, msg.Marker, count)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get reactions failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"reactions": reactions,
+			"count":     len(reactions),
+			"marker":    next,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// MuteUntilSeconds converts the mute end MAX reports in milliseconds to Unix
+// seconds, keeping -1 for muted until unmuted and 0 for not muted
+func MuteUntilSeconds(until int64) int64 {
+	if until > 0 {
+		return until / 1000
+	}
+	return until
+}
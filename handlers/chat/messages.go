@@ -0,0 +1,1166 @@
+package chat
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// ========== MESSAGE ENDPOINTS ==========
+
+// SendMessage sends a text message
+// @Summary Send text message
+// @Description Sends a text message to a chat. Formatting is given either with format "markdown" (**bold**, *italic*, __underline__, ~~strikethrough~~, [text](https://...) links and [name](max://user/ID) mentions) or as an elements array with ranges counted in characters. Users are mentioned with a mentions array (userId or phone, ranges in characters) or with @+phone placeholders, which are replaced by the user's name. With simulateTyping (or the typing setting of POST /user/config) the typing indicator is shown first and the send waits for a time proportional to the text length. Messages carry no link preview unless linkPreview is true, which attaches the preview of the first link (see POST /chat/linkpreview).
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body MessageBody true "Message data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse "Not connected"
+// @Security ApiKeyAuth
+// @Router /chat/send/text [post]
+func (h *Handlers) SendMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg MessageBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		// Get chat ID (chatId=0 is valid for "Favorites/Saved Messages")
+		chatID := msg.ChatID
+
+		// If phone provided and no explicit chatId, search by phone
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		text, msgElements, err := h.ResolveMentions(client, msg)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		text, elements, err := h.FormatText(text, msg.Format, msgElements)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if !h.SimulateTyping(r.Context(), txtid, client, chatID, text, msg.SimulateTyping) {
+			h.Respond(w, r, http.StatusRequestTimeout, errors.New("request canceled while typing"))
+			return
+		}
+
+		// MAX attaches no preview to API messages unless asked for one
+		var attachments []maxclient.Attachment
+		if msg.LinkPreview {
+			attachments = h.LinkPreviewAttachment(client, text, elements)
+		}
+
+		result, err := client.SendMessage(maxclient.SendMessageOptions{
+			ChatID:      chatID,
+			Text:        text,
+			Elements:    elements,
+			Attachments: attachments,
+			ReplyTo:     msg.ReplyTo,
+			Notify:      h.NotifyFor(txtid, msg.Notify),
+		})
+
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+			"chatId":    chatID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendEditMessage edits an existing message
+// @Summary Edit message
+// @Description Edits an existing message
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body EditMessageBody true "Edit data"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/edit [post]
+func (h *Handlers) SendEditMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg EditMessageBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		messageID, err := msg.MessageID.Int64()
+		if msg.ChatID == 0 || err != nil {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("chatId and messageId are required"))
+			return
+		}
+
+		_, err = client.EditMessage(msg.ChatID, messageID, msg.Text, nil)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("edit failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Message edited",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// MarkRead marks messages as read
+// @Summary Mark messages as read
+// @Description Marks messages as read in a chat
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body MarkReadBody true "Mark read data"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/markread [post]
+func (h *Handlers) MarkRead() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg MarkReadBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		messageID, err := msg.MessageID.Int64()
+		if msg.ChatID == 0 || err != nil {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("chatId and messageId are required"))
+			return
+		}
+
+		err = client.MarkRead(msg.ChatID, messageID)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("mark read failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Marked as read",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteMessage deletes messages
+// @Summary Delete messages
+// @Description Deletes messages from a chat
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body DeleteMessageBody true "Delete data"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/delete [post]
+func (h *Handlers) DeleteMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg DeleteMessageBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		messageIDs, err := maxclient.Int64MessageIDs(msg.MessageIDs)
+		if err != nil || len(messageIDs) == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("messageIds is required"))
+			return
+		}
+
+		err = client.DeleteMessage(msg.ChatID, messageIDs, msg.ForMe)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("delete failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Messages deleted",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ========== MEDIA ENDPOINTS ==========
+
+// SendImage sends an image message
+// @Summary Send image
+// @Description Sends an image message to a chat. Accepts JSON, or multipart/form-data with the file in the "image" part and the other fields as form values.
+// @Tags Chat
+// @Accept json,mpfd
+// @Produce json
+// @Param request body ImageBody true "Image data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 413 {object} api.ErrorResponse "Media larger than the upload limit"
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/image [post]
+func (h *Handlers) SendImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ImageBody
+		upload, err := h.DecodeMediaRequest(r, &msg, "image")
+		if err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		// Decode image
+		imageData, filename, err := upload.Decode(msg.Image, "image.jpg")
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid image data: %v", err))
+			return
+		}
+
+		if !h.CheckUploadSize(w, r, client, int64(len(imageData))) {
+			return
+		}
+
+		release, ok := h.HoldSendMedia(w, r, imageData)
+		if !ok {
+			return
+		}
+		defer release()
+
+		if !h.CheckOutgoingMedia(w, r, chatID, filename, imageData) {
+			return
+		}
+
+		result, err := h.SendMediaMessage(client, txtid, chatID, msg.Caption, "image", imageData, filename, h.NotifyFor(txtid, msg.Notify))
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		h.RecordOutgoingMedia(txtid, chatID, result, "image", filename, imageData)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendDocument sends a document
+// @Summary Send document
+// @Description Sends a document to a chat. Accepts JSON, or multipart/form-data with the file in the "document" part and the other fields as form values.
+// @Tags Chat
+// @Accept json,mpfd
+// @Produce json
+// @Param request body DocumentBody true "Document data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 413 {object} api.ErrorResponse "Media larger than the upload limit"
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/document [post]
+func (h *Handlers) SendDocument() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg DocumentBody
+		upload, err := h.DecodeMediaRequest(r, &msg, "document")
+		if err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		filename := msg.FileName
+		if filename == "" {
+			filename = upload.Name("document")
+		}
+
+		if upload.Streamable(r) {
+			h.SendUpload(w, r, client, chatID, msg.Caption, "file", "file", upload, filename, h.NotifyFor(txtid, msg.Notify))
+			return
+		}
+
+		docData, _, err := upload.Decode(msg.Document, filename)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid document data: %v", err))
+			return
+		}
+
+		if !h.CheckUploadSize(w, r, client, int64(len(docData))) {
+			return
+		}
+
+		release, ok := h.HoldSendMedia(w, r, docData)
+		if !ok {
+			return
+		}
+		defer release()
+
+		if !h.CheckOutgoingMedia(w, r, chatID, filename, docData) {
+			return
+		}
+
+		result, err := h.SendMediaMessage(client, txtid, chatID, msg.Caption, "file", docData, filename, h.NotifyFor(txtid, msg.Notify))
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		h.RecordOutgoingMedia(txtid, chatID, result, "file", filename, docData)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendAudio sends an audio file
+// @Summary Send audio
+// @Description Sends an audio file to a chat. Accepts JSON, or multipart/form-data with the file in the "audio" part and the other fields as form values.
+// @Tags Chat
+// @Accept json,mpfd
+// @Produce json
+// @Param request body AudioBody true "Audio data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 413 {object} api.ErrorResponse "Media larger than the upload limit"
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/audio [post]
+func (h *Handlers) SendAudio() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg AudioBody
+		upload, err := h.DecodeMediaRequest(r, &msg, "audio")
+		if err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		filename := msg.FileName
+		if filename == "" {
+			filename = upload.Name("audio.mp3")
+		}
+
+		if upload.Streamable(r) {
+			h.SendUpload(w, r, client, chatID, "", "audio", "file", upload, filename, h.NotifyFor(txtid, msg.Notify))
+			return
+		}
+
+		audioData, _, err := upload.Decode(msg.Audio, filename)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid audio data: %v", err))
+			return
+		}
+
+		if !h.CheckUploadSize(w, r, client, int64(len(audioData))) {
+			return
+		}
+
+		release, ok := h.HoldSendMedia(w, r, audioData)
+		if !ok {
+			return
+		}
+		defer release()
+
+		if !h.CheckOutgoingMedia(w, r, chatID, filename, audioData) {
+			return
+		}
+
+		result, err := h.SendMediaMessage(client, txtid, chatID, "", "audio", audioData, filename, h.NotifyFor(txtid, msg.Notify))
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		h.RecordOutgoingMedia(txtid, chatID, result, "file", filename, audioData)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendVoice sends a voice message
+// @Summary Send voice message
+// @Description Sends audio as a voice message, shown with a waveform and its duration instead of as a file. Accepts JSON, or multipart/form-data with the file in the "voice" part and the other fields as form values (waveform as comma-separated samples). MAX plays Ogg/Opus voice messages.
+// @Tags Chat
+// @Accept json,mpfd
+// @Produce json
+// @Param request body VoiceBody true "Voice data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 413 {object} api.ErrorResponse "Media larger than the upload limit"
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/voice [post]
+func (h *Handlers) SendVoice() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg VoiceBody
+		upload, err := h.DecodeMediaRequest(r, &msg, "voice")
+		if err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.Duration <= 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("duration is required"))
+			return
+		}
+
+		wave := make([]byte, len(msg.Waveform))
+		for i, sample := range msg.Waveform {
+			if sample < 0 || sample > 255 {
+				h.Respond(w, r, http.StatusBadRequest, errors.New("waveform samples must be between 0 and 255"))
+				return
+			}
+			wave[i] = byte(sample)
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		filename := msg.FileName
+		if filename == "" {
+			filename = upload.Name("voice.ogg")
+		}
+
+		voiceData, _, err := upload.Decode(msg.Voice, filename)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid voice data: %v", err))
+			return
+		}
+
+		if !h.CheckUploadSize(w, r, client, int64(len(voiceData))) {
+			return
+		}
+
+		release, ok := h.HoldSendMedia(w, r, voiceData)
+		if !ok {
+			return
+		}
+		defer release()
+
+		if !h.CheckOutgoingMedia(w, r, chatID, filename, voiceData) {
+			return
+		}
+
+		opts := maxclient.VoiceOptions{
+			Duration:   msg.Duration * 1000,
+			Wave:       wave,
+			Transcribe: msg.Transcribe,
+		}
+		result, err := client.SendVoiceMessage(chatID, voiceData, filename, opts, h.NotifyFor(txtid, msg.Notify))
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		h.RecordOutgoingMedia(txtid, chatID, result, "audio", filename, voiceData)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendVideo sends a video
+// @Summary Send video
+// @Description Sends a video to a chat. Accepts JSON, or multipart/form-data with the file in the "video" part and the other fields as form values.
+// @Tags Chat
+// @Accept json,mpfd
+// @Produce json
+// @Param request body VideoBody true "Video data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 413 {object} api.ErrorResponse "Media larger than the upload limit"
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/video [post]
+func (h *Handlers) SendVideo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg VideoBody
+		upload, err := h.DecodeMediaRequest(r, &msg, "video")
+		if err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		filename := msg.FileName
+		if filename == "" {
+			filename = upload.Name("video.mp4")
+		}
+
+		if upload.Streamable(r) {
+			h.SendUpload(w, r, client, chatID, msg.Caption, "video", "video", upload, filename, h.NotifyFor(txtid, msg.Notify))
+			return
+		}
+
+		videoData, _, err := upload.Decode(msg.Video, filename)
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid video data: %v", err))
+			return
+		}
+
+		if !h.CheckUploadSize(w, r, client, int64(len(videoData))) {
+			return
+		}
+
+		release, ok := h.HoldSendMedia(w, r, videoData)
+		if !ok {
+			return
+		}
+		defer release()
+
+		if !h.CheckOutgoingMedia(w, r, chatID, filename, videoData) {
+			return
+		}
+
+		result, err := h.SendMediaMessage(client, txtid, chatID, msg.Caption, "video", videoData, filename, h.NotifyFor(txtid, msg.Notify))
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		h.RecordOutgoingMedia(txtid, chatID, result, "video", filename, videoData)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendSticker sends a sticker
+// @Summary Send sticker
+// @Description Sends a sticker by its ID to a chat
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body StickerBody true "Sticker data"
+// @Success 200 {object} SendMessageResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/sticker [post]
+func (h *Handlers) SendSticker() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg StickerBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.StickerID == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("stickerId is required"))
+			return
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		result, err := client.SendMessageWithSticker(chatID, msg.StickerID, msg.ReplyTo, h.NotifyFor(txtid, msg.Notify))
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"messageId": result.ID,
+			"chatId":    chatID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// maxForwardMessages caps the messages forwarded by one request
+const maxForwardMessages = 100
+
+// ForwardMessages forwards messages to a chat
+// @Summary Forward messages
+// @Description Forwards messages of one chat to another chat or to a phone number. Messages are forwarded one by one in the given order; the result of each is reported and a failure does not stop the rest.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ForwardBody true "Forward data"
+// @Success 200 {object} ForwardResponse
+// @Success 202 {object} QueuedMessageResponse "Queued during quiet hours"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 403 {object} api.ErrorResponse "Recipient blocked"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/send/forward [post]
+func (h *Handlers) ForwardMessages() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ForwardBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if len(msg.MessageIDs) == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("messageIds is required"))
+			return
+		}
+		if len(msg.MessageIDs) > maxForwardMessages {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d messages can be forwarded at once", maxForwardMessages))
+			return
+		}
+
+		chatID := msg.ChatID
+		if msg.Phone != "" && chatID == 0 {
+			user, err := client.SearchByPhone(msg.Phone)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("user not found: %v", err))
+				return
+			}
+			chatID = maxclient.GetDialogID(client.MaxUserID, user.ID)
+		}
+
+		notify := h.NotifyFor(txtid, msg.Notify)
+		results := make([]ForwardResult, 0, len(msg.MessageIDs))
+		forwarded := 0
+		for _, messageID := range msg.MessageIDs {
+			item := ForwardResult{MessageID: messageID.String()}
+			result, err := client.ForwardMessage(chatID, msg.FromChatID, messageID, notify)
+			if err != nil {
+				item.Error = err.Error()
+			} else {
+				item.Success = true
+				item.ForwardedID = result.ID
+				forwarded++
+			}
+			results = append(results, item)
+		}
+
+		response := map[string]interface{}{
+			"success":   forwarded > 0,
+			"chatId":    chatID,
+			"forwarded": forwarded,
+			"failed":    len(results) - forwarded,
+			"results":   results,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetStickerSets lists the sticker packs of the account
+// @Summary List sticker sets
+// @Description Returns the sticker packs available to the account. Pass the returned marker to get the next page.
+// @Tags Chat
+// @Produce json
+// @Param count query int false "Page size (default 50, max 100)"
+// @Param marker query int false "Marker returned by the previous page"
+// @Success 200 {object} StickerSetsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/stickers [get]
+func (h *Handlers) GetStickerSets() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		count := 50
+		if v := r.URL.Query().Get("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 100 {
+				h.Respond(w, r, http.StatusBadRequest, errors.New("count must be between 1 and 100"))
+				return
+			}
+			count = n
+		}
+
+		var marker int64
+		if v := r.URL.Query().Get("marker"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, errors.New("invalid marker"))
+				return
+			}
+			marker = n
+		}
+
+		sets, next, err := client.GetStickerSets(count, marker)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get sticker sets: %v", err))
+			return
+		}
+		if sets == nil {
+			sets = []maxclient.StickerSet{}
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"sets":    sets,
+			"marker":  next,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetStickers returns stickers by ID
+// @Summary Get stickers
+// @Description Returns sticker details (image URLs, size, set) for the given sticker IDs
+// @Tags Chat
+// @Produce json
+// @Param ids query string true "Comma-separated sticker IDs"
+// @Success 200 {object} StickersResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/stickers/info [get]
+func (h *Handlers) GetStickers() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var ids []int64
+		for _, v := range strings.Split(r.URL.Query().Get("ids"), ",") {
+			if v = strings.TrimSpace(v); v == "" {
+				continue
+			}
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid sticker id: %s", v))
+				return
+			}
+			ids = append(ids, id)
+		}
+		if len(ids) == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("ids is required"))
+			return
+		}
+
+		stickers, err := client.GetStickers(ids)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get stickers: %v", err))
+			return
+		}
+		if stickers == nil {
+			stickers = []maxclient.Sticker{}
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"stickers": stickers,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DownloadImage downloads an image
+// @Summary Download image
+// @Description Downloads an image from URL
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body DownloadBody true "URL"
+// @Success 200 {object} DownloadMediaResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/downloadimage [post]
+func (h *Handlers) DownloadImage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg DownloadBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.URL == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("url is required"))
+			return
+		}
+
+		data, err := h.DownloadMedia(msg.URL)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("download failed: %v", err))
+			return
+		}
+
+		if !h.CheckIncomingMedia(w, r, 0, "", data) {
+			return
+		}
+
+		mimeType := http.DetectContentType(data)
+
+		response := map[string]interface{}{
+			"success":  true,
+			"data":     base64.StdEncoding.EncodeToString(data),
+			"mimeType": mimeType,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DownloadDocument downloads a document by fileId
+// @Summary Download document
+// @Description Downloads a document by file ID
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body DownloadFileBody true "File info"
+// @Success 200 {object} DownloadMediaResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/downloaddocument [post]
+func (h *Handlers) DownloadDocument() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg DownloadFileBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		messageID, err := msg.MessageID.Int64()
+		if err != nil || messageID == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("messageId is required"))
+			return
+		}
+
+		fileInfo, err := client.GetFileDownloadURL(msg.ChatID, messageID, msg.FileID)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get download url failed: %v", err))
+			return
+		}
+
+		data, err := client.DownloadFile(fileInfo.URL)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("download failed: %v", err))
+			return
+		}
+
+		if !h.CheckIncomingMedia(w, r, msg.ChatID, "", data) {
+			return
+		}
+
+		mimeType := http.DetectContentType(data)
+
+		response := map[string]interface{}{
+			"success":  true,
+			"data":     base64.StdEncoding.EncodeToString(data),
+			"mimeType": mimeType,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DownloadVideo downloads a video by videoId
+// @Summary Download video
+// @Description Downloads a video by video ID. With stream=true the video is returned as the raw response body with its Content-Type and Content-Length instead of base64 JSON, and Range requests are supported.
+// @Tags Chat
+// @Accept json
+// @Produce json,octet-stream
+// @Param request body DownloadFileBody true "Video info"
+// @Param stream query bool false "Return the raw video instead of base64 JSON"
+// @Success 200 {object} DownloadVideoResponse
+// @Success 206 {file} binary "Partial content (stream mode with a Range header)"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/downloadvideo [post]
+func (h *Handlers) DownloadVideo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg DownloadFileBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		messageID, err := msg.MessageID.Int64()
+		if err != nil || messageID == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("messageId is required"))
+			return
+		}
+
+		videoInfo, err := client.GetVideoDownloadURL(msg.ChatID, messageID, msg.VideoID)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get download url failed: %v", err))
+			return
+		}
+
+		if stream, _ := strconv.ParseBool(r.URL.Query().Get("stream")); stream {
+			h.StreamDownload(w, r, client, msg.ChatID, videoInfo.URL)
+			return
+		}
+
+		data, err := client.DownloadFile(videoInfo.URL)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("download failed: %v", err))
+			return
+		}
+
+		if !h.CheckIncomingMedia(w, r, msg.ChatID, "", data) {
+			return
+		}
+
+		mimeType := http.DetectContentType(data)
+
+		response := map[string]interface{}{
+			"success":  true,
+			"data":     base64.StdEncoding.EncodeToString(data),
+			"mimeType": mimeType,
+			"url":      videoInfo.URL,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DownloadAudio downloads audio by fileId (same as document)
+// @Summary Download audio
+// @Description Downloads audio by file ID
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body DownloadBody true "URL"
+// @Success 200 {object} DownloadMediaResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 422 {object} api.ErrorResponse "Media blocked by virus scan"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/downloadaudio [post]
+func (h *Handlers) DownloadAudio() http.HandlerFunc {
+	return h.DownloadImage()
+}
@@ -0,0 +1,347 @@
+package chat
+
+import "maxapi/maxclient"
+
+// ========== CHAT RESPONSES ==========
+
+// SendMessageResponse represents the response after sending a message
+// @Description Response after sending a message
+type SendMessageResponse struct {
+	Success   bool   `json:"success" example:"true"`
+	MessageID string `json:"messageId" example:"115234567890123456"`
+	ChatID    int64  `json:"chatId,omitempty" example:"123456789"`
+}
+
+// StickerSetInfo represents a sticker pack
+type StickerSetInfo struct {
+	ID       int64   `json:"id" example:"1001"`
+	Name     string  `json:"name" example:"Cats"`
+	IconURL  string  `json:"iconUrl,omitempty" example:"https://st.max.ru/..."`
+	Stickers []int64 `json:"stickers,omitempty" example:"272821,272822"`
+}
+
+// StickerInfo represents a sticker
+type StickerInfo struct {
+	ID        int64    `json:"id" example:"272821"`
+	SetID     int64    `json:"setId,omitempty" example:"1001"`
+	URL       string   `json:"url,omitempty" example:"https://st.max.ru/..."`
+	LottieURL string   `json:"lottieUrl,omitempty"`
+	Width     int      `json:"width,omitempty" example:"512"`
+	Height    int      `json:"height,omitempty" example:"512"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
+// ChatListResponse represents a page of the chat list
+// @Description Response with chats, dialogs and channels. Marker is 0 and nextCursor empty after the last page.
+type ChatListResponse struct {
+	Success    bool                     `json:"success" example:"true"`
+	Chats      []map[string]interface{} `json:"chats"`
+	Dialogs    []map[string]interface{} `json:"dialogs"`
+	Channels   []map[string]interface{} `json:"channels"`
+	Count      int                      `json:"count" example:"40"`
+	Marker     int64                    `json:"marker" example:"1699999999999"`
+	NextCursor string                   `json:"nextCursor" example:"eyJtIjoxNjk5OTk5OTk5OTk5fQ"`
+}
+
+// StickerSetsResponse represents a page of sticker packs
+// @Description Response with sticker sets
+type StickerSetsResponse struct {
+	Success bool             `json:"success" example:"true"`
+	Sets    []StickerSetInfo `json:"sets"`
+	Marker  int64            `json:"marker" example:"0"`
+}
+
+// StickersResponse represents sticker details
+// @Description Response with stickers
+type StickersResponse struct {
+	Success  bool          `json:"success" example:"true"`
+	Stickers []StickerInfo `json:"stickers"`
+}
+
+// DownloadMediaResponse represents the response for downloading media
+// @Description Response with downloaded media data
+type DownloadMediaResponse struct {
+	Success  bool   `json:"success" example:"true"`
+	Data     string `json:"data" example:"base64_encoded_data"`
+	MimeType string `json:"mimeType" example:"image/jpeg"`
+}
+
+// DownloadVideoResponse represents the response for downloading video
+// @Description Response with downloaded video data
+type DownloadVideoResponse struct {
+	Success  bool   `json:"success" example:"true"`
+	Data     string `json:"data" example:"base64_encoded_data"`
+	MimeType string `json:"mimeType" example:"video/mp4"`
+	URL      string `json:"url" example:"https://example.com/video.mp4"`
+}
+
+// ChatHistoryResponse represents the response for chat history
+// @Description Response with chat history messages
+type ChatHistoryResponse struct {
+	Success    bool                     `json:"success" example:"true"`
+	Messages   []map[string]interface{} `json:"messages"`
+	NextCursor string                   `json:"nextCursor" example:"eyJ0IjoxNjk5OTk5OTk5OTk4fQ"`
+}
+
+// ChatMediaResponse represents a page of chat media
+// @Description Response with media messages. Marker is empty after the last page.
+type ChatMediaResponse struct {
+	Success  bool                     `json:"success" example:"true"`
+	Messages []map[string]interface{} `json:"messages"`
+	Count    int                      `json:"count" example:"50"`
+	Marker   string                   `json:"marker" example:"115234567890123456"`
+}
+
+// SearchMessagesResponse represents the response for a message search
+// @Description Response with the messages matching the query
+type SearchMessagesResponse struct {
+	Success  bool                     `json:"success" example:"true"`
+	Messages []map[string]interface{} `json:"messages"`
+	Count    int                      `json:"count" example:"3"`
+}
+
+// PublicChatResult represents a public channel or group found by search
+type PublicChatResult struct {
+	ChatID            int64  `json:"chatId" example:"-68123456789"`
+	Type              string `json:"type" example:"CHANNEL"`
+	Title             string `json:"title" example:"Company News"`
+	Description       string `json:"description,omitempty" example:"Official announcements"`
+	ParticipantsCount int    `json:"participantsCount" example:"1520"`
+	Link              string `json:"link,omitempty" example:"https://max.ru/company_news"`
+	IconURL           string `json:"iconUrl,omitempty" example:"https://i.oneme.ru/i?r=abc"`
+}
+
+// SearchPublicResponse represents the response for a public chat search
+// @Description Response with the public channels and groups matching the query. The link can be passed to /group/join, or to /user/resolve-link for the full chat.
+type SearchPublicResponse struct {
+	Success bool               `json:"success" example:"true"`
+	Chats   []PublicChatResult `json:"chats"`
+	Count   int                `json:"count" example:"2"`
+}
+
+// ========== GROUP RESPONSES ==========
+
+// ForwardResult represents the outcome of forwarding one message
+type ForwardResult struct {
+	MessageID   string `json:"messageId" example:"115234567890123456"`
+	Success     bool   `json:"success" example:"true"`
+	ForwardedID string `json:"forwardedId,omitempty" example:"115234567890123999"`
+	Error       string `json:"error,omitempty" example:"message_not_found: Message not found"`
+}
+
+// ForwardResponse represents the results of forwarding messages
+// @Description Response with the outcome per message. Success is false only when no message was forwarded.
+type ForwardResponse struct {
+	Success   bool            `json:"success" example:"true"`
+	ChatID    int64           `json:"chatId" example:"123456789"`
+	Forwarded int             `json:"forwarded" example:"2"`
+	Failed    int             `json:"failed" example:"0"`
+	Results   []ForwardResult `json:"results"`
+}
+
+// ========== QUIET HOURS RESPONSES ==========
+
+// QueuedMessageResponse represents the response when a send is deferred
+// @Description Response when a message is queued instead of sent
+type QueuedMessageResponse struct {
+	Success   bool   `json:"success" example:"true"`
+	Queued    bool   `json:"queued" example:"true"`
+	QueueID   int64  `json:"queueId" example:"42"`
+	DeliverAt int64  `json:"deliverAt" example:"1700000000"`
+	Reason    string `json:"reason" example:"quiet_hours"`
+}
+
+// ========== ADMIN RESPONSES ==========
+
+// MessageBody represents the request body for sending a text message
+type MessageBody struct {
+	ChatID         int64               `json:"chatId" example:"123456789"`
+	Phone          string              `json:"phone" example:"79001234567"`
+	Text           string              `json:"text" example:"Hello, **World**!"`
+	Format         string              `json:"format" example:"markdown" enums:"plain,markdown"`
+	Elements       []MessageElement    `json:"elements"`
+	Mentions       []Mention           `json:"mentions"`
+	ReplyTo        maxclient.MessageID `json:"replyTo" example:"115234567890123456"`
+	Notify         *bool               `json:"notify" example:"true"`
+	Urgent         bool                `json:"urgent" example:"false"`
+	SimulateTyping *bool               `json:"simulateTyping" example:"true"`
+	LinkPreview    bool                `json:"linkPreview" example:"false"`
+}
+
+// MessageElement formats a range of the message text, counted in characters
+type MessageElement struct {
+	Type   string `json:"type" example:"bold" enums:"bold,italic,underline,strikethrough,link,mention"`
+	From   int    `json:"from" example:"7"`
+	Length int    `json:"length" example:"5"`
+	URL    string `json:"url,omitempty" example:"https://example.com"`
+	UserID int64  `json:"userId,omitempty" example:"987654321"`
+}
+
+// Mention mentions a user on a range of the message text, counted in
+// characters. The user is given by userId or by phone.
+type Mention struct {
+	UserID int64  `json:"userId,omitempty" example:"987654321"`
+	Phone  string `json:"phone,omitempty" example:"79001234567"`
+	Offset int    `json:"offset" example:"0"`
+	Length int    `json:"length" example:"5"`
+}
+
+// EditMessageBody represents the request body for editing a message
+type EditMessageBody struct {
+	ChatID    int64               `json:"chatId" example:"123456789"`
+	MessageID maxclient.MessageID `json:"messageId" example:"115234567890123456"`
+	Text      string              `json:"text" example:"Updated message"`
+}
+
+// MarkReadBody represents the request body for marking messages as read
+type MarkReadBody struct {
+	ChatID    int64               `json:"chatId" example:"123456789"`
+	MessageID maxclient.MessageID `json:"messageId" example:"115234567890123456"`
+}
+
+// DeleteMessageBody represents the request body for deleting messages
+type DeleteMessageBody struct {
+	ChatID     int64                 `json:"chatId" example:"123456789"`
+	MessageIDs []maxclient.MessageID `json:"messageIds" example:"115234567890123456"`
+	ForMe      bool                  `json:"forMe" example:"false"`
+}
+
+// ImageBody represents the request body for sending an image
+type ImageBody struct {
+	ChatID  int64  `json:"chatId" example:"123456789"`
+	Phone   string `json:"phone" example:"79001234567"`
+	Image   string `json:"image" example:"data:image/jpeg;base64,..."`
+	Caption string `json:"caption" example:"Image caption"`
+	Notify  *bool  `json:"notify" example:"true"`
+	Urgent  bool   `json:"urgent" example:"false"`
+}
+
+// DocumentBody represents the request body for sending a document
+type DocumentBody struct {
+	ChatID   int64  `json:"chatId" example:"123456789"`
+	Phone    string `json:"phone" example:"79001234567"`
+	Document string `json:"document" example:"data:application/pdf;base64,..."`
+	FileName string `json:"fileName" example:"document.pdf"`
+	Caption  string `json:"caption" example:"Document caption"`
+	Notify   *bool  `json:"notify" example:"true"`
+	Urgent   bool   `json:"urgent" example:"false"`
+}
+
+// AudioBody represents the request body for sending audio
+type AudioBody struct {
+	ChatID   int64  `json:"chatId" example:"123456789"`
+	Phone    string `json:"phone" example:"79001234567"`
+	Audio    string `json:"audio" example:"data:audio/mp3;base64,..."`
+	FileName string `json:"fileName" example:"audio.mp3"`
+	Notify   *bool  `json:"notify" example:"true"`
+	Urgent   bool   `json:"urgent" example:"false"`
+}
+
+// VoiceBody represents the request body for sending a voice message
+type VoiceBody struct {
+	ChatID     int64  `json:"chatId" example:"123456789"`
+	Phone      string `json:"phone" example:"79001234567"`
+	Voice      string `json:"voice" example:"data:audio/ogg;base64,..."`
+	FileName   string `json:"fileName" example:"voice.ogg"`
+	Duration   int    `json:"duration" example:"7"`
+	Waveform   []int  `json:"waveform" example:"0,12,80,255,140,30"`
+	Transcribe bool   `json:"transcribe" example:"false"`
+	Notify     *bool  `json:"notify" example:"true"`
+	Urgent     bool   `json:"urgent" example:"false"`
+}
+
+// VideoBody represents the request body for sending a video
+type VideoBody struct {
+	ChatID   int64  `json:"chatId" example:"123456789"`
+	Phone    string `json:"phone" example:"79001234567"`
+	Video    string `json:"video" example:"data:video/mp4;base64,..."`
+	Caption  string `json:"caption" example:"Video caption"`
+	FileName string `json:"fileName" example:"video.mp4"`
+	Notify   *bool  `json:"notify" example:"true"`
+	Urgent   bool   `json:"urgent" example:"false"`
+}
+
+// StickerBody represents the request body for sending a sticker
+type StickerBody struct {
+	ChatID    int64               `json:"chatId" example:"123456789"`
+	Phone     string              `json:"phone" example:"79001234567"`
+	StickerID int64               `json:"stickerId" example:"272821"`
+	ReplyTo   maxclient.MessageID `json:"replyTo" example:"115234567890123456"`
+	Notify    *bool               `json:"notify" example:"true"`
+	Urgent    bool                `json:"urgent" example:"false"`
+}
+
+// ForwardBody represents the request body for forwarding messages
+type ForwardBody struct {
+	ChatID     int64                 `json:"chatId" example:"123456789"`
+	Phone      string                `json:"phone" example:"79001234567"`
+	FromChatID int64                 `json:"fromChatId" example:"-68123456789"`
+	MessageIDs []maxclient.MessageID `json:"messageIds" example:"115234567890123456"`
+	Notify     *bool                 `json:"notify" example:"true"`
+	Urgent     bool                  `json:"urgent" example:"false"`
+}
+
+// ChatHistoryBody represents the request body for getting chat history
+type ChatHistoryBody struct {
+	ChatID   int64 `json:"chatId" example:"123456789"`
+	Count    int   `json:"count" example:"50"`
+	FromTime int64 `json:"fromTime" example:"0"`
+}
+
+// ChatMediaBody represents the request body for listing chat media
+type ChatMediaBody struct {
+	ChatID int64               `json:"chatId" example:"123456789"`
+	Type   string              `json:"type" example:"photo"`
+	Marker maxclient.MessageID `json:"marker" example:""`
+	Count  int                 `json:"count" example:"50"`
+}
+
+// SearchMessagesBody represents the request body for searching messages
+type SearchMessagesBody struct {
+	ChatID int64  `json:"chatId" example:"123456789"`
+	Query  string `json:"query" example:"invoice"`
+	Limit  int    `json:"limit" example:"50"`
+}
+
+// SearchPublicBody represents the request body for searching public chats
+type SearchPublicBody struct {
+	Query string `json:"query" example:"news"`
+}
+
+// ReactBody represents the request body for adding a reaction
+type ReactBody struct {
+	ChatID    int64               `json:"chatId" example:"123456789"`
+	MessageID maxclient.MessageID `json:"messageId" example:"115234567890123456"`
+	Reaction  string              `json:"reaction" example:"👍"`
+}
+
+// DetailedReactionsBody represents the request body for listing who reacted to a message
+type DetailedReactionsBody struct {
+	ChatID    int64               `json:"chatId" example:"-68123456789"`
+	MessageID maxclient.MessageID `json:"messageId" example:"115234567890123456"`
+	Reaction  string              `json:"reaction" example:"👍"`
+	Marker    int64               `json:"marker" example:"0"`
+	Count     int                 `json:"count" example:"50"`
+}
+
+// DetailedReactionsResponse represents the users who reacted to a message
+// @Description Response with one entry per user and reaction. Marker is 0 after the last page.
+type DetailedReactionsResponse struct {
+	Success   bool                     `json:"success" example:"true"`
+	Reactions []maxclient.UserReaction `json:"reactions"`
+	Count     int                      `json:"count" example:"2"`
+	Marker    int64                    `json:"marker" example:"0"`
+}
+
+// DownloadBody represents the request body for downloading media
+type DownloadBody struct {
+	URL string `json:"url" example:"https://example.com/image.jpg"`
+}
+
+// DownloadFileBody represents the request body for downloading files
+type DownloadFileBody struct {
+	ChatID    int64               `json:"chatId" example:"123456789"`
+	MessageID maxclient.MessageID `json:"messageId" example:"115234567890123456"`
+	FileID    int64               `json:"fileId" example:"111222333"`
+	VideoID   int64               `json:"videoId" example:"111222333"`
+}
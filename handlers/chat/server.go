@@ -0,0 +1,84 @@
+// Package chat serves the endpoints that send, read and search messages and
+// list chats.
+package chat
+
+import (
+	"context"
+	"net/http"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// Server is what the chat handlers use of the server
+type Server interface {
+	api.Server
+	api.Clients
+
+	// ResolveMentions replaces @+phone placeholders and turns mentions into
+	// elements of the text as sent
+	ResolveMentions(client *maxclient.Client, msg MessageBody) (string, []MessageElement, error)
+	// FormatText converts markdown or explicit elements of a text send to
+	// plain text and MAX elements
+	FormatText(text, format string, elements []MessageElement) (string, []maxclient.Element, error)
+	// LinkPreviewAttachment fetches the preview of the first link of a
+	// message, none when MAX has no preview
+	LinkPreviewAttachment(client *maxclient.Client, text string, elements []maxclient.Element) []maxclient.Attachment
+	// SimulateTyping shows the typing indicator before a text send when the
+	// request or the user's config asks for it. It returns false when the
+	// request is canceled while typing.
+	SimulateTyping(ctx context.Context, userID string, client *maxclient.Client, chatID int64, text string, requested *bool) bool
+	// NotifyFor resolves the notify flag of a send
+	NotifyFor(userID string, notify *bool) bool
+
+	// DecodeMediaRequest decodes a media send given as JSON or as
+	// multipart/form-data into msg and returns the file part named field
+	DecodeMediaRequest(r *http.Request, msg interface{}, field string) (Upload, error)
+	// HoldSendMedia accounts decoded media against the resource cap of the
+	// instance. It responds and returns false when the instance is over it;
+	// otherwise release must be called once the media is no longer buffered.
+	HoldSendMedia(w http.ResponseWriter, r *http.Request, data []byte) (release func(), ok bool)
+	// CheckOutgoingMedia and CheckIncomingMedia scan media passing through
+	// the API. They respond and return false when it must not be passed on.
+	CheckOutgoingMedia(w http.ResponseWriter, r *http.Request, chatID int64, fileName string, data []byte) bool
+	CheckIncomingMedia(w http.ResponseWriter, r *http.Request, chatID int64, fileName string, data []byte) bool
+	// SendMediaMessage uploads media and sends it, reusing a previous upload
+	// of identical content
+	SendMediaMessage(client *maxclient.Client, userID string, chatID int64, caption string,
+		mediaType string, data []byte, filename string, notify bool) (*maxclient.Message, error)
+	// SendUpload sends a streamable upload without reading it into memory and
+	// writes the response. recordType is the media index type.
+	SendUpload(w http.ResponseWriter, r *http.Request, client *maxclient.Client, chatID int64, caption string,
+		mediaType, recordType string, upload Upload, filename string, notify bool)
+	// RecordOutgoingMedia adds sent media to the media index of the instance
+	RecordOutgoingMedia(userID string, chatID int64, result *maxclient.Message, mediaType, fileName string, data []byte)
+
+	// DownloadMedia downloads the media file at url
+	DownloadMedia(url string) ([]byte, error)
+	// StreamDownload streams a media file from MAX to the response
+	StreamDownload(w http.ResponseWriter, r *http.Request, client *maxclient.Client, chatID int64, url string)
+}
+
+// Upload is the file of a media send given as a multipart form part. Sends
+// with the media in the JSON body get an upload without a part, whose methods
+// fall back to the body.
+type Upload interface {
+	// Name returns the uploaded file name, or def
+	Name(def string) string
+	// Decode returns the uploaded file read into memory, or decodes value
+	// (data URL, URL or base64) for JSON requests
+	Decode(value string, def string) ([]byte, string, error)
+	// Streamable reports whether the upload can be sent to MAX straight from
+	// the form part
+	Streamable(r *http.Request) bool
+}
+
+// Handlers serves the chat and message endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the chat handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
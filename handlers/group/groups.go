@@ -0,0 +1,784 @@
+package group
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// ========== GROUP ENDPOINTS ==========
+
+// CreateGroup creates a new group
+// @Summary Create group
+// @Description Creates a new group with specified participants and optionally a description, PUBLIC or PRIVATE access (PRIVATE by default) and an icon (base64, data URL or http(s) URL). The group is created in one step; when MAX rejects that, it is created with a control message and the description and icon are set afterwards, which method reports as "control". A PUBLIC group is only created in one step.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body CreateGroupBody true "Group data"
+// @Success 200 {object} CreateGroupResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/create [post]
+func (h *Handlers) CreateGroup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg CreateGroupBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		access := maxclient.AccessType(strings.ToUpper(msg.Access))
+		switch access {
+		case "", maxclient.AccessTypePrivate, maxclient.AccessTypePublic:
+		default:
+			h.Respond(w, r, http.StatusBadRequest, errors.New("access must be PUBLIC or PRIVATE"))
+			return
+		}
+
+		opts := maxclient.CreateChatOptions{
+			Title:          msg.Name,
+			Description:    msg.Description,
+			ParticipantIDs: msg.Participants,
+			Access:         access,
+			Notify:         true,
+		}
+		if msg.Image != "" {
+			imageData, filename, err := api.DecodeMediaData(msg.Image, "photo.jpg")
+			if err != nil || len(imageData) == 0 {
+				h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid image data: %v", err))
+				return
+			}
+			if !h.CheckUploadSize(w, r, client, int64(len(imageData))) {
+				return
+			}
+			photo, err := client.UploadPhoto(imageData, filename)
+			if err != nil {
+				h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("image upload failed: %v", err))
+				return
+			}
+			opts.PhotoToken = photo.PhotoToken
+		}
+
+		method := "create"
+		var warnings []string
+		chat, err := client.CreateChat(opts)
+		if err != nil && canCreateWithControl(err, access) {
+			log.Warn().Err(err).Str("userID", txtid).Msg("Chat create rejected, creating group with a control message")
+			method = "control"
+			chat, warnings, err = createGroupWithControl(client, opts)
+		}
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("create group failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"chat":    chat,
+			"method":  method,
+		}
+		if len(warnings) > 0 {
+			response["warnings"] = warnings
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// canCreateWithControl reports whether a failed chat create may be retried
+// with a control message: MAX rejected the request, so no chat was made,
+// and the group is private, the only access the control message creates.
+// Timeouts, answers without a chat, rate limits and restrictions are not
+// retried.
+func canCreateWithControl(err error, access maxclient.AccessType) bool {
+	var maxErr *maxclient.Error
+	if !errors.As(err, &maxErr) || access == maxclient.AccessTypePublic {
+		return false
+	}
+	switch maxErr.Code {
+	case maxclient.ErrTimeout.Code, maxclient.ErrNotConnected.Code, maxclient.ErrInvalidResponse.Code:
+		return false
+	}
+	return !maxclient.IsRateLimitError(maxErr) && !maxclient.IsRestrictionError(maxErr)
+}
+
+// createGroupWithControl creates a group with a control message, then sets
+// the description and icon, which that message cannot carry. The group
+// exists once the message is sent, so failures of the later updates are
+// returned as warnings.
+func createGroupWithControl(client *maxclient.Client, opts maxclient.CreateChatOptions) (*maxclient.Chat, []string, error) {
+	chat, _, err := client.CreateGroup(opts.Title, opts.ParticipantIDs, opts.Notify)
+	if err != nil {
+		return nil, nil, err
+	}
+	if chat == nil {
+		return nil, nil, nil
+	}
+
+	var warnings []string
+	if opts.Description != "" {
+		if updated, err := client.UpdateChatProfile(chat.ID, "", opts.Description); err != nil {
+			warnings = append(warnings, fmt.Sprintf("description not set: %v", err))
+		} else if updated != nil {
+			chat = updated
+		}
+	}
+	if opts.PhotoToken != "" {
+		if updated, err := client.SetChatPhoto(chat.ID, opts.PhotoToken); err != nil {
+			warnings = append(warnings, fmt.Sprintf("icon not set: %v", err))
+		} else if updated != nil {
+			chat = updated
+		}
+	}
+	return chat, warnings, nil
+}
+
+// GetGroupInfo gets group info
+// @Summary Get group info
+// @Description Gets group information by chat ID, with the owner and admins and their permissions in admins
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupInfoBody true "Chat ID"
+// @Success 200 {object} GroupInfoResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/info [post]
+func (h *Handlers) GetGroupInfo() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupInfoBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chat, err := client.GetChat(msg.ChatID)
+		if err != nil {
+			h.Respond(w, r, http.StatusNotFound, fmt.Errorf("chat not found: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"chat":    chat,
+			"admins":  chat.AdminList(),
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetGroupInviteLink gets group invite link
+// @Summary Get group invite link
+// @Description Gets invite link for a group. With create set, a link is generated when the chat has none; created reports whether that happened.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupInviteLinkBody true "Chat ID"
+// @Success 200 {object} InviteLinkResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/invitelink [post]
+func (h *Handlers) GetGroupInviteLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupInviteLinkBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chat, err := client.GetChat(msg.ChatID)
+		if err != nil {
+			h.Respond(w, r, http.StatusNotFound, fmt.Errorf("chat not found: %v", err))
+			return
+		}
+
+		link := chat.Link
+		created := false
+		if link == "" && msg.Create {
+			// MAX generates a link when the current one is revoked
+			if link, err = regenerateInviteLink(client, msg.ChatID); err != nil {
+				h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("create link failed: %v", err))
+				return
+			}
+			created = true
+			log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Msg("Group invite link created")
+		}
+
+		response := map[string]interface{}{
+			"success":    true,
+			"inviteLink": link,
+			"created":    created,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// RevokeGroupInviteLink revokes the invite link of a group
+// @Summary Revoke group invite link
+// @Description Revokes the invite link of a group or channel and returns the new one. The old link stops working.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupInfoBody true "Chat ID"
+// @Success 200 {object} InviteLinkResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/invitelink/revoke [post]
+func (h *Handlers) RevokeGroupInviteLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupInfoBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+
+		link, err := regenerateInviteLink(client, msg.ChatID)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("revoke failed: %v", err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Msg("Group invite link revoked")
+
+		response := map[string]interface{}{
+			"success":    true,
+			"inviteLink": link,
+			"created":    false,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// regenerateInviteLink revokes the invite link of a chat and returns the new one
+func regenerateInviteLink(client *maxclient.Client, chatID int64) (string, error) {
+	chat, err := client.RevokeInviteLink(chatID)
+	if err != nil {
+		return "", err
+	}
+	// The response does not always carry the updated chat
+	if chat == nil || chat.Link == "" {
+		if chat, err = client.GetChat(chatID); err != nil {
+			return "", err
+		}
+	}
+	if chat.Link == "" {
+		return "", errors.New("no invite link returned")
+	}
+	return chat.Link, nil
+}
+
+// maxInviteRecipients caps the recipients of one invite-send request
+const maxInviteRecipients = 100
+
+// SendGroupInvite sends the invite link of a group to several recipients
+// @Summary Send group invite link
+// @Description Sends the invite link of a group as a text message to each phone and user ID, opening dialogs as needed. The text may use {{link}} and {{title}}; without {{link}} the link is added on a new line. Every recipient goes through the blocklist like a regular send, and results are reported per recipient.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupInviteSendBody true "Group and recipients"
+// @Success 200 {object} GroupInviteSendResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/invite-send [post]
+func (h *Handlers) SendGroupInvite() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+		token := r.Context().Value("userinfo").(api.UserInfo).Get("Token")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupInviteSendBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		total := len(msg.Phones) + len(msg.UserIDs)
+		if total == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("phones or userIds is required"))
+			return
+		}
+		if total > maxInviteRecipients {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d recipients per request", maxInviteRecipients))
+			return
+		}
+
+		chat, err := client.GetChat(msg.ChatID)
+		if err != nil {
+			h.Respond(w, r, http.StatusNotFound, fmt.Errorf("chat not found: %v", err))
+			return
+		}
+		if chat.Link == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("the group has no invite link"))
+			return
+		}
+
+		text := msg.Text
+		if text == "" {
+			text = "{{title}}"
+		}
+		if !strings.Contains(text, "{{link}}") {
+			text += "\n{{link}}"
+		}
+		text = strings.NewReplacer("{{link}}", chat.Link, "{{title}}", chat.Title).Replace(text)
+
+		results := make([]GroupInviteResult, 0, total)
+		send := func(result GroupInviteResult, chatID int64, phone string) {
+			body, _ := json.Marshal(map[string]interface{}{
+				"chatId": chatID,
+				"phone":  phone,
+				"text":   text,
+				"notify": msg.Notify,
+			})
+			rec := h.InternalSend(token, "/chat/send/text", string(body))
+
+			var sent struct {
+				MessageID json.RawMessage `json:"messageId"`
+				ChatID    int64           `json:"chatId"`
+				Error     string          `json:"error"`
+			}
+			json.Unmarshal(rec.Body.Bytes(), &sent)
+
+			if rec.Code == http.StatusOK {
+				result.Success = true
+				result.ChatID = sent.ChatID
+				result.MessageID = strings.Trim(string(sent.MessageID), `"`)
+			} else if sent.Error != "" {
+				result.Error = sent.Error
+			} else {
+				result.Error = fmt.Sprintf("status %d", rec.Code)
+			}
+			results = append(results, result)
+		}
+
+		for _, phone := range msg.Phones {
+			send(GroupInviteResult{Phone: phone}, 0, phone)
+		}
+		for _, userID := range msg.UserIDs {
+			send(GroupInviteResult{UserID: userID}, maxclient.GetDialogID(client.MaxUserID, userID), "")
+		}
+
+		sent := 0
+		for _, result := range results {
+			if result.Success {
+				sent++
+			}
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", chat.ID).Int("sent", sent).Int("failed", len(results)-sent).Msg("Sent group invite link")
+
+		response := map[string]interface{}{
+			"success":    true,
+			"chatId":     chat.ID,
+			"inviteLink": chat.Link,
+			"sent":       sent,
+			"failed":     len(results) - sent,
+			"results":    results,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// CheckGroupLink previews the group an invite link leads to
+// @Summary Check invite link
+// @Description Returns the title, type, access type and member count of the group or channel an invite link leads to, without joining it. Use it to preview a group before POST /group/join.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupJoinBody true "Invite link"
+// @Success 200 {object} GroupCheckLinkResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse "Invalid or expired link"
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/checklink [post]
+func (h *Handlers) CheckGroupLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupJoinBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+		msg.Link = strings.TrimSpace(msg.Link)
+		if msg.Link == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("link is required"))
+			return
+		}
+
+		chat, err := client.CheckChatLink(msg.Link)
+		if err != nil {
+			h.Respond(w, r, http.StatusNotFound, fmt.Errorf("link not found: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":           true,
+			"chatId":            chat.ID,
+			"type":              chat.Type,
+			"title":             chat.Title,
+			"description":       chat.Description,
+			"access":            chat.Access,
+			"participantsCount": chat.ParticipantsCount,
+			"baseIconUrl":       chat.BaseIconURL,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GroupJoin joins a group via invite link
+// @Summary Join group
+// @Description Joins a group via invite link
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupJoinBody true "Invite link"
+// @Success 200 {object} GroupChatResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/join [post]
+func (h *Handlers) GroupJoin() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupJoinBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		chat, err := client.JoinGroup(msg.Link)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("join failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"chat":    chat,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GroupLeave leaves a group
+// @Summary Leave group
+// @Description Leaves a group
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupInfoBody true "Chat ID"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/leave [post]
+func (h *Handlers) GroupLeave() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupInfoBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		err := client.LeaveChat(msg.ChatID)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("leave failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Left group",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// UpdateGroupParticipants adds or removes group members
+// @Summary Update group participants
+// @Description Adds or removes participants from a group
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body UpdateParticipantsBody true "Participants data"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/updateparticipants [post]
+func (h *Handlers) UpdateGroupParticipants() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg UpdateParticipantsBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		var err error
+		if msg.Operation == "add" {
+			_, err = client.AddGroupMembers(msg.ChatID, msg.UserIDs, true)
+		} else {
+			_, err = client.RemoveGroupMembers(msg.ChatID, msg.UserIDs, 0)
+		}
+
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("update failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Participants updated",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetGroupName sets group name
+// @Summary Set group name
+// @Description Sets the name of a group
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupNameBody true "Group name"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/name [post]
+func (h *Handlers) SetGroupName() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupNameBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		_, err := client.UpdateChatProfile(msg.ChatID, msg.Name, "")
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("update failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Group name updated",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetGroupTopic sets group description
+// @Summary Set group topic
+// @Description Sets the topic/description of a group
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupTopicBody true "Group topic"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/topic [post]
+func (h *Handlers) SetGroupTopic() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupTopicBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		_, err := client.UpdateChatProfile(msg.ChatID, "", msg.Topic)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("update failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Group topic updated",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetGroupPhoto sets the group icon
+// @Summary Set group photo
+// @Description Uploads an image and sets it as the icon of a group or channel. image is a data URL, an http(s) URL or plain base64.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body GroupPhotoBody true "Group photo"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 413 {object} api.ErrorResponse "Image larger than the upload limit"
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/photo [post]
+func (h *Handlers) SetGroupPhoto() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg GroupPhotoBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+		if msg.Image == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("image is required"))
+			return
+		}
+
+		imageData, filename, err := api.DecodeMediaData(msg.Image, "photo.jpg")
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid image data: %v", err))
+			return
+		}
+		if len(imageData) == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("image is empty"))
+			return
+		}
+
+		if !h.CheckUploadSize(w, r, client, int64(len(imageData))) {
+			return
+		}
+
+		if _, err := client.UpdateChatPhoto(msg.ChatID, imageData, filename); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("update failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Group photo updated",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
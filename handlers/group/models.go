@@ -0,0 +1,132 @@
+package group
+
+import "maxapi/maxclient"
+
+// ========== GROUP RESPONSES ==========
+
+// GroupChatResponse represents the response with group/chat info
+// @Description Response with group or chat information
+type GroupChatResponse struct {
+	Success bool                   `json:"success" example:"true"`
+	Chat    map[string]interface{} `json:"chat"`
+}
+
+// CreateGroupResponse represents the response with the created group
+// @Description Response with the created group. method is create when the group was made in one step and control when it was made with a control message, in which case warnings lists the settings that could not be applied.
+type CreateGroupResponse struct {
+	Success  bool                   `json:"success" example:"true"`
+	Chat     map[string]interface{} `json:"chat"`
+	Method   string                 `json:"method" example:"create" enums:"create,control"`
+	Warnings []string               `json:"warnings,omitempty"`
+}
+
+// GroupCheckLinkResponse represents the group an invite link leads to
+// @Description Response with the group or channel behind an invite link. access is PUBLIC, PRIVATE or SECRET; private groups may need their join request approved.
+type GroupCheckLinkResponse struct {
+	Success           bool   `json:"success" example:"true"`
+	ChatID            int64  `json:"chatId" example:"-68123456789"`
+	Type              string `json:"type" example:"CHAT" enums:"CHAT,CHANNEL"`
+	Title             string `json:"title" example:"Project team"`
+	Description       string `json:"description" example:"Team chat"`
+	Access            string `json:"access" example:"PRIVATE" enums:"PUBLIC,PRIVATE,SECRET"`
+	ParticipantsCount int    `json:"participantsCount" example:"42"`
+	BaseIconURL       string `json:"baseIconUrl" example:"https://i.oneme.ru/i?r=..."`
+}
+
+// GroupInfoResponse represents the response with group info
+// @Description Response with group information and its owner and admins
+type GroupInfoResponse struct {
+	Success bool                   `json:"success" example:"true"`
+	Chat    map[string]interface{} `json:"chat"`
+	Admins  []maxclient.ChatAdmin  `json:"admins"`
+}
+
+// InviteLinkResponse represents the response with invite link
+// @Description Response with group invite link
+type InviteLinkResponse struct {
+	Success    bool   `json:"success" example:"true"`
+	InviteLink string `json:"inviteLink" example:"https://max.ru/join/abc123"`
+	Created    bool   `json:"created" example:"false"`
+}
+
+// GroupInviteResult represents the outcome of an invite for one recipient
+type GroupInviteResult struct {
+	Phone     string `json:"phone,omitempty" example:"+79001234567"`
+	UserID    int64  `json:"userId,omitempty" example:"123456789"`
+	Success   bool   `json:"success" example:"true"`
+	ChatID    int64  `json:"chatId,omitempty" example:"246913578"`
+	MessageID string `json:"messageId,omitempty" example:"115234567890123456"`
+	Error     string `json:"error,omitempty" example:"recipient is blocked"`
+}
+
+// GroupInviteSendResponse represents the results of sending a group invite link
+// @Description Response with the invite link and the outcome per recipient
+type GroupInviteSendResponse struct {
+	Success    bool                `json:"success" example:"true"`
+	ChatID     int64               `json:"chatId" example:"-68123456789"`
+	InviteLink string              `json:"inviteLink" example:"https://max.ru/join/abc123"`
+	Sent       int                 `json:"sent" example:"2"`
+	Failed     int                 `json:"failed" example:"1"`
+	Results    []GroupInviteResult `json:"results"`
+}
+
+// ========== ADMIN RESPONSES ==========
+
+// CreateGroupBody represents the request body for creating a group
+type CreateGroupBody struct {
+	Name         string  `json:"name" example:"My Group"`
+	Participants []int64 `json:"participants"`
+	Description  string  `json:"description" example:"Team chat"`
+	Access       string  `json:"access" example:"PRIVATE" enums:"PUBLIC,PRIVATE"`
+	Image        string  `json:"image" example:"data:image/jpeg;base64,..."`
+}
+
+// GroupInfoBody represents the request body for group operations
+type GroupInfoBody struct {
+	ChatID int64 `json:"chatId" example:"123456789"`
+}
+
+// GroupInviteLinkBody represents the request body for getting a group invite link
+type GroupInviteLinkBody struct {
+	ChatID int64 `json:"chatId" example:"123456789"`
+	Create bool  `json:"create" example:"true"`
+}
+
+// GroupInviteSendBody represents the request body for sending a group invite link
+type GroupInviteSendBody struct {
+	ChatID  int64    `json:"chatId" example:"-68123456789"`
+	Phones  []string `json:"phones" example:"+79001234567"`
+	UserIDs []int64  `json:"userIds" example:"123456789"`
+	Text    string   `json:"text,omitempty" example:"Join {{title}}: {{link}}"`
+	Notify  *bool    `json:"notify" example:"true"`
+}
+
+// GroupJoinBody represents the request body for joining a group
+type GroupJoinBody struct {
+	Link string `json:"link" example:"https://max.ru/join/abc123"`
+}
+
+// UpdateParticipantsBody represents the request body for updating group participants
+type UpdateParticipantsBody struct {
+	ChatID    int64   `json:"chatId" example:"123456789"`
+	UserIDs   []int64 `json:"userIds"`
+	Operation string  `json:"operation" example:"add" enums:"add,remove"`
+}
+
+// GroupNameBody represents the request body for setting group name
+type GroupNameBody struct {
+	ChatID int64  `json:"chatId" example:"123456789"`
+	Name   string `json:"name" example:"New Group Name"`
+}
+
+// GroupTopicBody represents the request body for setting group topic
+type GroupTopicBody struct {
+	ChatID int64  `json:"chatId" example:"123456789"`
+	Topic  string `json:"topic" example:"Group description"`
+}
+
+// GroupPhotoBody represents the request body for setting a group photo
+type GroupPhotoBody struct {
+	ChatID int64  `json:"chatId" example:"123456789"`
+	Image  string `json:"image" example:"data:image/jpeg;base64,..."`
+}
@@ -0,0 +1,29 @@
+// Package group serves the endpoints that create and manage groups and
+// channels.
+package group
+
+import (
+	"net/http/httptest"
+
+	"maxapi/api"
+)
+
+// Server is what the group handlers use of the server
+type Server interface {
+	api.Server
+	api.Clients
+
+	// InternalSend sends a request through the router as the user with the
+	// given stored token
+	InternalSend(token, path, body string) *httptest.ResponseRecorder
+}
+
+// Handlers serves the group endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the group handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
@@ -0,0 +1,31 @@
+package session
+
+import "maxapi/maxclient"
+
+// ========== SESSION RESPONSES ==========
+
+// StatusResponse represents the connection status response
+// @Description Connection and authentication status
+type StatusResponse struct {
+	Success       bool  `json:"success" example:"true"`
+	Connected     bool  `json:"connected" example:"true"`
+	Authenticated bool  `json:"authenticated" example:"true"`
+	LoggedIn      bool  `json:"loggedIn" example:"true"`
+	MaxUserID     int64 `json:"maxUserID" example:"123456789"`
+}
+
+// SessionsResponse represents the active sessions of the MAX account
+// @Description Response with the sessions of the account on devices and apps
+type SessionsResponse struct {
+	Success  bool                `json:"success" example:"true"`
+	Sessions []maxclient.Session `json:"sessions"`
+	Count    int                 `json:"count" example:"2"`
+}
+
+// ========== ADMIN RESPONSES ==========
+
+// ConnectBody represents the request body for connect
+type ConnectBody struct {
+	Subscribe []string `json:"subscribe" example:"Message,ReadReceipt"`
+	Immediate bool     `json:"immediate" example:"false"`
+}
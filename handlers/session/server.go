@@ -0,0 +1,40 @@
+// Package session serves the endpoints that connect an instance to MAX and
+// manage its sessions.
+package session
+
+import "maxapi/api"
+
+// Server is what the session handlers use of the server
+type Server interface {
+	api.Server
+	api.Clients
+
+	// IsConnected reports whether the instance is connected to MAX
+	IsConnected(userID string) bool
+	// SupportsEvent reports whether an instance can subscribe to an event type
+	SupportsEvent(eventType string) bool
+
+	// StartInstance connects an instance to MAX in the background
+	StartInstance(userID, authToken, deviceID, token string, subscriptions []string)
+	// StopInstance disconnects an instance and marks it disconnected
+	StopInstance(userID string)
+	// ResyncInstance replaces the connection of an instance with a new one,
+	// sends its Sync event and returns the sync data of the login
+	ResyncInstance(userID, authToken, deviceID, token string) (maxUserID int64, syncData map[string]interface{}, err error)
+
+	// InvalidateUserToken drops a token from the user cache
+	InvalidateUserToken(token string)
+	// SafeDeleteUser deletes an instance and its data, sending a LoggedOut
+	// event first when sendWebhook is set
+	SafeDeleteUser(userID string, sendWebhook bool)
+}
+
+// Handlers serves the session endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the session handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
@@ -0,0 +1,304 @@
+package session
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// ========== SESSION ENDPOINTS ==========
+
+// Connect connects to MAX with saved auth token
+// @Summary Connect to MAX servers
+// @Description Initiates connection to MAX servers using saved auth token
+// @Tags Session
+// @Accept json
+// @Produce json
+// @Param request body ConnectBody true "Connection options"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse "Already connected"
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/connect [post]
+func (h *Handlers) Connect() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+		token := r.Context().Value("userinfo").(api.UserInfo).Get("Token")
+
+		var t ConnectBody
+		if err := h.DecodeJSON(r, &t); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		// Check if already connected
+		if h.IsConnected(txtid) {
+			h.Respond(w, r, http.StatusConflict, errors.New("already connected"))
+			return
+		}
+
+		// Get auth token from DB
+		var authToken, deviceID string
+		err := h.DB().QueryRow("SELECT auth_token, device_id FROM users WHERE id=$1", txtid).Scan(&authToken, &deviceID)
+		if err != nil || authToken == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("no auth token found, please authenticate first"))
+			return
+		}
+
+		// Process subscriptions
+		var subscribedEvents []string
+		for _, arg := range t.Subscribe {
+			if h.SupportsEvent(arg) && !slices.Contains(subscribedEvents, arg) {
+				subscribedEvents = append(subscribedEvents, arg)
+			}
+		}
+
+		eventstring := strings.Join(subscribedEvents, ",")
+		_, err = h.DB().Exec("UPDATE users SET events=$1 WHERE id=$2", eventstring, txtid)
+		if err != nil {
+			log.Warn().Err(err).Msg("Could not set events in users table")
+		}
+
+		h.UpdateUserInfo(r, "Events", eventstring)
+
+		log.Info().Str("userID", txtid).Msg("Connecting to MAX")
+		h.StartInstance(txtid, authToken, deviceID, token, subscribedEvents)
+
+		if !t.Immediate {
+			time.Sleep(5 * time.Second)
+
+			if !h.IsConnected(txtid) {
+				h.Respond(w, r, http.StatusInternalServerError, errors.New("failed to connect"))
+				return
+			}
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Connected to MAX",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// Disconnect disconnects from MAX
+// @Summary Disconnect from MAX servers
+// @Description Closes connection to MAX servers
+// @Tags Session
+// @Produce json
+// @Success 200 {object} api.MessageResponse
+// @Security ApiKeyAuth
+// @Router /session/disconnect [post]
+func (h *Handlers) Disconnect() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		h.StopInstance(txtid)
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Disconnected",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// Logout logs out from MAX and deletes user
+// @Summary Logout from MAX
+// @Description Logs out from MAX and deletes the user from the system
+// @Tags Session
+// @Produce json
+// @Success 200 {object} api.MessageResponse
+// @Security ApiKeyAuth
+// @Router /session/logout [post]
+func (h *Handlers) Logout() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+		token := r.Context().Value("userinfo").(api.UserInfo).Get("Token")
+
+		client := h.MaxClient(txtid)
+		if client != nil && client.IsConnected() {
+			client.Logout() // Sends opcode 20, server may send LoggedOut back
+		}
+
+		// Clear cache before delete
+		h.InvalidateUserToken(token)
+
+		// Delete user immediately, don't wait for LoggedOut event
+		// sendWebhook=false because LoggedOut event will send it (if received)
+		h.SafeDeleteUser(txtid, false)
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Logged out",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetStatus returns connection status
+// @Summary Get connection status
+// @Description Returns connection and authentication status
+// @Tags Session
+// @Produce json
+// @Success 200 {object} StatusResponse
+// @Security ApiKeyAuth
+// @Router /session/status [get]
+func (h *Handlers) GetStatus() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		connected := h.IsConnected(txtid)
+
+		var maxUserID int64
+		client := h.MaxClient(txtid)
+		if client != nil && client.Me != nil {
+			maxUserID = client.MaxUserID
+		}
+
+		// Check if user has auth_token (authenticated)
+		var authToken string
+		h.DB().QueryRow("SELECT COALESCE(auth_token, '') FROM users WHERE id=$1", txtid).Scan(&authToken)
+		authenticated := authToken != ""
+
+		response := map[string]interface{}{
+			"success":       true,
+			"connected":     connected,
+			"authenticated": authenticated,
+			"loggedIn":      connected && authenticated,
+			"maxUserID":     maxUserID,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// RequestSync reconnects and returns fresh sync data
+// @Summary Request sync
+// @Description Reconnects to MAX server and returns fresh profile, chats, contacts data. Also sends Sync event to webhook
+// @Tags Session
+// @Produce json
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} api.ErrorResponse "No auth token"
+// @Failure 500 {object} api.ErrorResponse "Sync failed"
+// @Security ApiKeyAuth
+// @Router /session/sync [post]
+func (h *Handlers) RequestSync() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+		token := r.Context().Value("userinfo").(api.UserInfo).Get("Token")
+
+		// Get auth token and device ID from DB
+		var authToken, deviceID string
+		err := h.DB().QueryRow("SELECT auth_token, device_id FROM users WHERE id=$1", txtid).Scan(&authToken, &deviceID)
+		if err != nil || authToken == "" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("no auth token found, please authenticate first"))
+			return
+		}
+
+		// Reconnect with a new client
+		maxUserID, syncData, err := h.ResyncInstance(txtid, authToken, deviceID, token)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("sync failed: %v", err))
+			return
+		}
+
+		// Build response with raw sync data
+		response := map[string]interface{}{
+			"success":   true,
+			"maxUserID": maxUserID,
+		}
+		for key, value := range syncData {
+			response[key] = value
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetSessions lists the active MAX sessions
+// @Summary List sessions
+// @Description Returns the sessions of the MAX account on other devices and apps, with the current one marked
+// @Tags Session
+// @Produce json
+// @Success 200 {object} SessionsResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/sessions [get]
+func (h *Handlers) GetSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		sessions, err := client.GetSessions()
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get sessions: %v", err))
+			return
+		}
+		if sessions == nil {
+			sessions = []maxclient.Session{}
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"sessions": sessions,
+			"count":    len(sessions),
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// CloseSessions terminates the other MAX sessions
+// @Summary Close other sessions
+// @Description Signs the MAX account out on every other device and app; the session of this gateway stays open. MAX closes all other sessions at once, a single session cannot be chosen.
+// @Tags Session
+// @Produce json
+// @Success 200 {object} api.MessageResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/sessions/close [post]
+func (h *Handlers) CloseSessions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		if err := client.CloseSessions(); err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to close sessions: %v", err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Msg("Closed other MAX sessions")
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Other sessions closed",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
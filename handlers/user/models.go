@@ -0,0 +1,66 @@
+package user
+
+// ========== USER RESPONSES ==========
+
+// CheckUserResultItem represents a single user check result
+// @Description Single user check result
+type CheckUserResultItem struct {
+	Phone     string `json:"phone" example:"79001234567"`
+	Exists    bool   `json:"exists" example:"true"`
+	MaxUserID int64  `json:"maxUserId" example:"123456789"`
+	Name      string `json:"name,omitempty" example:"John Doe"`
+}
+
+// CheckUserResponse represents the response for checking users
+// @Description Response with user existence check results
+type CheckUserResponse struct {
+	Success bool                  `json:"success" example:"true"`
+	Users   []CheckUserResultItem `json:"users"`
+}
+
+// UserInfoResponse represents the response for getting user info
+// @Description Response with user information (always returns array)
+type UserInfoResponse struct {
+	Success bool                     `json:"success" example:"true"`
+	Users   []map[string]interface{} `json:"users"`
+	Count   int                      `json:"count" example:"1"`
+}
+
+// ResolveLinkResponse represents a resolved username or link
+// @Description Response with the user or chat a public link points to. Type is user or chat; userId and user, or chatId and chat, are set accordingly.
+type ResolveLinkResponse struct {
+	Success bool                   `json:"success" example:"true"`
+	Link    string                 `json:"link" example:"https://max.ru/company_news"`
+	Type    string                 `json:"type" example:"chat"`
+	UserID  int64                  `json:"userId,omitempty" example:"123456789"`
+	ChatID  int64                  `json:"chatId,omitempty" example:"-68123456789"`
+	User    map[string]interface{} `json:"user,omitempty"`
+	Chat    map[string]interface{} `json:"chat,omitempty"`
+}
+
+// ContactsResponse represents the response for getting contacts
+// @Description Response with list of contacts
+type ContactsResponse struct {
+	Success    bool                     `json:"success" example:"true"`
+	Contacts   []map[string]interface{} `json:"contacts"`
+	Count      int                      `json:"count" example:"42"`
+	Total      int                      `json:"total" example:"42"`
+	NextCursor string                   `json:"nextCursor" example:"eyJvIjo1MH0"`
+}
+
+// ========== ADMIN RESPONSES ==========
+
+// CheckUserBody represents the request body for checking users
+type CheckUserBody struct {
+	Phone []string `json:"phone"`
+}
+
+// UserInfoBody represents the request body for getting user info
+type UserInfoBody struct {
+	UserIDs []int64 `json:"userIds"`
+}
+
+// PresenceBody represents the request body for sending presence
+type PresenceBody struct {
+	ChatID int64 `json:"chatId" example:"123456789"`
+}
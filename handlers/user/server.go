@@ -0,0 +1,20 @@
+// Package user serves the endpoints that look up MAX users and contacts.
+package user
+
+import "maxapi/api"
+
+// Server is what the user handlers use of the server
+type Server interface {
+	api.Server
+	api.Clients
+}
+
+// Handlers serves the user endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the user handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
@@ -0,0 +1,312 @@
+package user
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// ========== USER ENDPOINTS ==========
+
+// CheckUser checks if a phone number exists in MAX
+// @Summary Check user existence
+// @Description Checks if phone numbers exist in MAX
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body CheckUserBody true "Phone numbers"
+// @Success 200 {object} CheckUserResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/check [post]
+func (h *Handlers) CheckUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg CheckUserBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		results := make([]map[string]interface{}, 0)
+
+		for _, phone := range msg.Phone {
+			user, err := client.SearchByPhone(phone)
+			result := map[string]interface{}{
+				"phone":     phone,
+				"exists":    false,
+				"maxUserId": int64(0),
+			}
+			if err == nil && user != nil {
+				result["exists"] = true
+				result["maxUserId"] = user.ID
+				if len(user.Names) > 0 {
+					result["name"] = user.Names[0].Name
+				}
+			}
+			results = append(results, result)
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"users":   results,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetContacts returns all contacts
+// @Summary Get contacts
+// @Description Returns the contacts from MAX, all of them unless limit is given. Follows the list conventions: limit and cursor page through the contacts, sort orders them and fields selects the returned fields.
+// @Tags User
+// @Produce json
+// @Param limit query int false "Page size, 1-500 (default all)"
+// @Param cursor query string false "nextCursor of the previous page"
+// @Param sort query string false "id or name, prefixed with - for descending"
+// @Param fields query string false "Comma-separated fields to return, e.g. id,names"
+// @Success 200 {object} ContactsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/contacts [get]
+func (h *Handlers) GetContacts() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		q, err := api.ParseListQuery(r, api.ListOptions{MaxLimit: 500, Sorts: []string{"id", "name"}})
+		if err != nil {
+			h.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		// Direct request to MAX without caching
+		contacts, err := client.GetContacts()
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get contacts: %v", err))
+			return
+		}
+
+		switch q.Sort {
+		case "id":
+			api.SortSlice(contacts, q.Desc, func(i, j int) bool { return contacts[i].ID < contacts[j].ID })
+		case "name":
+			api.SortSlice(contacts, q.Desc, func(i, j int) bool {
+				return strings.ToLower(maxclient.DisplayName(contacts[i].Names)) < strings.ToLower(maxclient.DisplayName(contacts[j].Names))
+			})
+		}
+
+		start, end, next := q.OffsetPage(len(contacts))
+		api.SetNextCursor(w, next)
+
+		response := map[string]interface{}{
+			"success":    true,
+			"contacts":   q.SelectFields(contacts[start:end]),
+			"count":      end - start,
+			"total":      len(contacts),
+			"nextCursor": next,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetUser gets user info by ID or multiple IDs
+// @Summary Get user info
+// @Description Gets user information by MAX user ID. Supports single userId or batch request with userIds array (max 100)
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body UserInfoBody true "User ID or IDs array"
+// @Success 200 {object} UserInfoResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/info [post]
+func (h *Handlers) GetUser() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg UserInfoBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if len(msg.UserIDs) == 0 {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("userIds is required"))
+			return
+		}
+
+		users, err := client.GetUsers(msg.UserIDs)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to get users: %v", err))
+			return
+		}
+
+		// Convert to response format with avatar URLs
+		usersResponse := make([]map[string]interface{}, 0, len(users))
+		for _, user := range users {
+			usersResponse = append(usersResponse, map[string]interface{}{
+				"id":            user.ID,
+				"accountStatus": user.AccountStatus,
+				"names":         user.Names,
+				"options":       user.Options,
+				"baseUrl":       user.BaseURL,
+				"baseRawUrl":    user.BaseRawURL,
+				"photoId":       user.PhotoID,
+				"description":   user.Description,
+				"gender":        user.Gender,
+				"link":          user.Link,
+				"updateTime":    user.UpdateTime,
+				"webApp":        user.WebApp,
+				"avatarUrl":     maxclient.GetUserAvatarURL(&user),
+			})
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"users":   usersResponse,
+			"count":   len(usersResponse),
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ResolveLink resolves a public username or link
+// @Summary Resolve username or link
+// @Description Resolves a public @username or max.ru link of a user, group or channel to its ID, so integrations can start from a shared link instead of a phone number
+// @Tags User
+// @Produce json
+// @Param link query string true "@username, username or https://max.ru/... link"
+// @Success 200 {object} ResolveLinkResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/resolve-link [get]
+func (h *Handlers) ResolveLink() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		link := strings.TrimSpace(r.URL.Query().Get("link"))
+		if link == "" || link == "@" {
+			h.Respond(w, r, http.StatusBadRequest, errors.New("link is required"))
+			return
+		}
+
+		info, err := client.ResolveLink(link)
+		if err != nil {
+			h.Respond(w, r, http.StatusNotFound, fmt.Errorf("link not found: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"link":    info.Link,
+		}
+
+		if info.Chat != nil {
+			response["type"] = "chat"
+			response["chatId"] = info.Chat.ID
+			response["chat"] = map[string]interface{}{
+				"id":                info.Chat.ID,
+				"type":              info.Chat.Type,
+				"title":             info.Chat.Title,
+				"description":       info.Chat.Description,
+				"access":            info.Chat.Access,
+				"link":              info.Chat.Link,
+				"participantsCount": info.Chat.ParticipantsCount,
+				"baseIconUrl":       info.Chat.BaseIconURL,
+			}
+		} else {
+			response["type"] = "user"
+			response["userId"] = info.User.ID
+			response["user"] = map[string]interface{}{
+				"id":          info.User.ID,
+				"names":       info.User.Names,
+				"description": info.User.Description,
+				"link":        info.User.Link,
+				"avatarUrl":   maxclient.GetUserAvatarURL(info.User),
+			}
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SendPresence sets presence status
+// @Summary Send presence
+// @Description Sends typing indicator to a chat
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body PresenceBody true "Chat ID"
+// @Success 200 {object} api.MessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/presence [post]
+func (h *Handlers) SendPresence() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		client := h.MaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			h.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg PresenceBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		// Send typing indicator
+		err := client.SendTyping(msg.ChatID)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("presence failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Presence sent",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,18 @@
+package webhook
+
+// ========== WEBHOOK RESPONSES ==========
+
+// WebhookResponse represents the response for webhook operations
+// @Description Response with webhook URL
+type WebhookResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Webhook string `json:"webhook" example:"https://example.com/webhook"`
+}
+
+// ========== ADMIN RESPONSES ==========
+
+// WebhookBody represents the request body for setting webhook
+type WebhookBody struct {
+	Webhook string `json:"webhook" example:"https://example.com/webhook"`
+	Force   bool   `json:"force" example:"false"`
+}
@@ -0,0 +1,26 @@
+// Package webhook serves the endpoints that set the webhook of a user.
+package webhook
+
+import "maxapi/api"
+
+// Server is what the webhook handlers use of the server
+type Server interface {
+	api.Server
+
+	// WebhookSecret returns the secret the webhook requests of a user are signed with
+	WebhookSecret(userID string) string
+	// WebhookFormat returns the body format of the webhook requests of a user
+	WebhookFormat(userID string) string
+	// ProbeWebhook sends a WebhookTest event to the URL and fails if it cannot be delivered
+	ProbeWebhook(webhookURL, token, userID, secret, format string) error
+}
+
+// Handlers serves the webhook endpoints
+type Handlers struct {
+	Server
+}
+
+// New returns the webhook handlers of s
+func New(s Server) *Handlers {
+	return &Handlers{Server: s}
+}
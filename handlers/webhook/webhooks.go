@@ -0,0 +1,127 @@
+package webhook
+
+import (
+	"fmt"
+	"net/http"
+
+	"maxapi/api"
+)
+
+// ========== WEBHOOK ENDPOINTS ==========
+
+// GetWebhook returns current webhook
+// @Summary Get webhook
+// @Description Returns current webhook URL
+// @Tags Webhook
+// @Produce json
+// @Success 200 {object} WebhookResponse
+// @Security ApiKeyAuth
+// @Router /webhook [get]
+func (h *Handlers) GetWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		webhook := r.Context().Value("userinfo").(api.UserInfo).Get("Webhook")
+
+		response := map[string]interface{}{
+			"success": true,
+			"webhook": webhook,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetWebhook sets webhook URL
+// @Summary Set webhook
+// @Description Sets webhook URL for receiving events. The URL must be http(s) and is probed with a WebhookTest event before saving unless force is set.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param request body WebhookBody true "Webhook URL"
+// @Success 200 {object} WebhookResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook [post]
+func (h *Handlers) SetWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+		token := r.Context().Value("userinfo").(api.UserInfo).Get("Token")
+
+		var msg WebhookBody
+		if err := h.DecodeJSON(r, &msg); err != nil {
+			h.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.Webhook != "" {
+			if err := api.ValidateWebhookURL(msg.Webhook); err != nil {
+				h.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			if !msg.Force {
+				if err := h.ProbeWebhook(msg.Webhook, token, txtid, h.WebhookSecret(txtid), h.WebhookFormat(txtid)); err != nil {
+					h.Respond(w, r, http.StatusBadRequest, fmt.Errorf("%v (set force to save anyway)", err))
+					return
+				}
+			}
+		}
+
+		_, err := h.DB().Exec("UPDATE users SET webhook=$1 WHERE id=$2", msg.Webhook, txtid)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		h.UpdateUserInfo(r, "Webhook", msg.Webhook)
+
+		response := map[string]interface{}{
+			"success": true,
+			"webhook": msg.Webhook,
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// UpdateWebhook is alias for SetWebhook
+// @Summary Update webhook
+// @Description Updates webhook URL
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param request body WebhookBody true "Webhook URL"
+// @Success 200 {object} WebhookResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook [put]
+func (h *Handlers) UpdateWebhook() http.HandlerFunc {
+	return h.SetWebhook()
+}
+
+// DeleteWebhook removes webhook
+// @Summary Delete webhook
+// @Description Removes the webhook URL
+// @Tags Webhook
+// @Produce json
+// @Success 200 {object} api.MessageResponse
+// @Security ApiKeyAuth
+// @Router /webhook [delete]
+func (h *Handlers) DeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(api.UserInfo).Get("Id")
+
+		_, err := h.DB().Exec("UPDATE users SET webhook='' WHERE id=$1", txtid)
+		if err != nil {
+			h.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		h.UpdateUserInfo(r, "Webhook", "")
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Webhook deleted",
+		}
+
+		h.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	healthCheckTimeout = 3 * time.Second
+	// storageCheckTTL limits how often media stores are contacted by probes
+	storageCheckTTL = 30 * time.Second
+
+	checkOK       = "ok"
+	checkFail     = "fail"
+	checkDisabled = "disabled"
+)
+
+var (
+	processStarted = time.Now()
+
+	storageCheck struct {
+		sync.Mutex
+		checked time.Time
+		result  HealthCheck
+	}
+)
+
+// HealthCheck is the result of one readiness check
+type HealthCheck map[string]interface{}
+
+func (c HealthCheck) failed() bool {
+	return c["status"] == checkFail
+}
+
+// Healthz reports that the process is alive
+// @Summary Liveness probe
+// @Description Returns 200 while the process is running. Dependencies are not checked, so an outage of the database or a broker does not get the gateway restarted; use /readyz for those.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} HealthResponse
+// @Router /healthz [get]
+func (s *server) Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{
+			"status":        checkOK,
+			"uptimeSeconds": int64(time.Since(processStarted).Seconds()),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// Readyz checks the dependencies of the gateway
+// @Summary Readiness probe
+// @Description Checks the database, the configured media stores, RabbitMQ and NATS when enabled, and the MAX connections. Returns 503 when a check fails. The MAX check only fails readiness with READYZ_REQUIRE_MAX=true, when no instance is connected.
+// @Tags Health
+// @Produce json
+// @Success 200 {object} ReadinessResponse
+// @Failure 503 {object} ReadinessResponse
+// @Router /readyz [get]
+func (s *server) Readyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), healthCheckTimeout)
+		defer cancel()
+
+		checks := map[string]HealthCheck{
+			"database": s.checkDatabase(ctx),
+			"storage":  checkStorage(ctx),
+			"rabbitmq": checkRabbitMQ(),
+			"nats":     checkNATS(),
+			"max":      checkMAX(),
+		}
+
+		status, code := checkOK, http.StatusOK
+		for name, check := range checks {
+			if check.failed() {
+				status, code = checkFail, http.StatusServiceUnavailable
+				log.Warn().Str("check", name).Interface("result", check).Msg("Readiness check failed")
+			}
+		}
+
+		response := map[string]interface{}{
+			"status": status,
+			"checks": checks,
+		}
+
+		s.Respond(w, r, code, response)
+	}
+}
+
+func (s *server) checkDatabase(ctx context.Context) HealthCheck {
+	start := time.Now()
+	if err := s.db.PingContext(ctx); err != nil {
+		return HealthCheck{"status": checkFail, "error": err.Error()}
+	}
+	return HealthCheck{"status": checkOK, "latencyMs": time.Since(start).Milliseconds()}
+}
+
+// checkStorage tests every distinct media store. Results are reused for
+// storageCheckTTL, since a store test is a request to the storage provider.
+func checkStorage(ctx context.Context) HealthCheck {
+	storageCheck.Lock()
+	defer storageCheck.Unlock()
+
+	if storageCheck.result != nil && time.Since(storageCheck.checked) < storageCheckTTL {
+		return storageCheck.result
+	}
+
+	stores := storageManager.distinctStores()
+	if len(stores) == 0 {
+		return HealthCheck{"status": checkDisabled}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	failures := []map[string]string{}
+	for _, store := range stores {
+		wg.Add(1)
+		go func(store BlobStore) {
+			defer wg.Done()
+			if err := store.Test(ctx); err != nil {
+				mu.Lock()
+				failures = append(failures, map[string]string{
+					"backend":  store.Backend(),
+					"location": store.Location(),
+					"error":    err.Error(),
+				})
+				mu.Unlock()
+			}
+		}(store)
+	}
+	wg.Wait()
+
+	result := HealthCheck{"status": checkOK, "stores": len(stores)}
+	if len(failures) > 0 {
+		result["status"] = checkFail
+		result["failures"] = failures
+	}
+	storageCheck.result, storageCheck.checked = result, time.Now()
+	return result
+}
+
+func checkRabbitMQ() HealthCheck {
+	if !rabbitEnabled {
+		return HealthCheck{"status": checkDisabled}
+	}
+	check := HealthCheck{"status": checkOK}
+	if rabbitBuffer != nil {
+		check["buffered"] = rabbitBuffer.count.Load()
+	}
+	if !rabbitConnected.Load() {
+		check["status"] = checkFail
+		check["error"] = "not connected to RabbitMQ"
+	}
+	return check
+}
+
+func checkNATS() HealthCheck {
+	if !natsEnabled {
+		return HealthCheck{"status": checkDisabled}
+	}
+	if !natsConn.IsConnected() {
+		return HealthCheck{"status": checkFail, "error": "not connected to NATS"}
+	}
+	if !natsStreamReady.Load() {
+		return HealthCheck{"status": checkFail, "error": "stream " + natsStreamName + " is not available"}
+	}
+	return HealthCheck{"status": checkOK}
+}
+
+// checkMAX reports the MAX connections. With READYZ_REQUIRE_MAX=true the
+// gateway is only ready while at least one instance is connected.
+func checkMAX() HealthCheck {
+	required, _ := strconv.ParseBool(os.Getenv("READYZ_REQUIRE_MAX"))
+	clients, connected := clientManager.ConnectionCounts()
+
+	check := HealthCheck{"status": checkOK, "clients": clients, "connected": connected, "required": required}
+	if required && connected == 0 {
+		check["status"] = checkFail
+		check["error"] = "no MAX connection is up"
+	}
+	return check
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// heartbeatSeq numbers the heartbeats since the process started, so receivers
+// can tell missed heartbeats from a restarted gateway
+var heartbeatSeq int64
+
+// startHeartbeats sends a Heartbeat event for every running instance each
+// HEARTBEAT_INTERVAL seconds (0, the default, disables them)
+func (s *server) startHeartbeats() {
+	interval := time.Duration(envInt("HEARTBEAT_INTERVAL", 0)) * time.Second
+	if interval <= 0 {
+		return
+	}
+	log.Info().Dur("interval", interval).Msg("Heartbeat events enabled")
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.sendHeartbeats(interval)
+		}
+	}()
+}
+
+// sendHeartbeats sends the current status of every running instance
+func (s *server) sendHeartbeats(interval time.Duration) {
+	heartbeatSeq++
+
+	clientManager.RLock()
+	clients := make([]*MyClient, 0, len(clientManager.myClients))
+	for _, mycli := range clientManager.myClients {
+		clients = append(clients, mycli)
+	}
+	clientManager.RUnlock()
+
+	now := time.Now()
+	for _, mycli := range clients {
+		connected := false
+		var maxUserID int64
+		if client := clientManager.GetMaxClient(mycli.userID); client != nil {
+			connected = client.IsConnected()
+			maxUserID = client.MaxUserID
+		}
+
+		postmap := map[string]interface{}{
+			"type":          "Heartbeat",
+			"seq":           heartbeatSeq,
+			"timestamp":     now.Unix(),
+			"interval":      int64(interval.Seconds()),
+			"connected":     connected,
+			"loggedIn":      connected && maxUserID != 0,
+			"maxUserID":     maxUserID,
+			"uptimeSeconds": int64(now.Sub(processStarted).Seconds()),
+		}
+		sendEventWithWebHook(mycli, postmap, "")
+	}
+}
@@ -3,14 +3,19 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"time"
 
+	"github.com/go-resty/resty/v2"
 	"github.com/jmoiron/sqlx"
 	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
 )
 
 func Find(slice []string, val string) bool {
@@ -32,25 +37,15 @@ func SafeMaxClientStatus(userID string) (isConnected bool) {
 	return client.IsConnected()
 }
 
-// Respond sends a JSON response
+// Respond sends a JSON response in the envelope the request asked for (see envelope.go)
 func (s *server) Respond(w http.ResponseWriter, r *http.Request, statusCode int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 
 	var response map[string]interface{}
-
-	switch v := payload.(type) {
-	case error:
-		response = map[string]interface{}{
-			"success": false,
-			"error":   v.Error(),
-		}
-	case map[string]interface{}:
-		response = v
-	default:
-		response = map[string]interface{}{
-			"success": true,
-			"data":    v,
-		}
+	if requestEnvelope(r) == envelopeLegacy {
+		response = legacyResponse(payload)
+	} else {
+		response = wrapResponse(statusCode, payload)
 	}
 
 	w.WriteHeader(statusCode)
@@ -59,6 +54,14 @@ func (s *server) Respond(w http.ResponseWriter, r *http.Request, statusCode int,
 	}
 }
 
+// payloadError reports invalid message IDs and hides other decoder errors
+func payloadError(err error) error {
+	if errors.Is(err, maxclient.ErrInvalidMessageID) {
+		return errors.New("invalid message ID: message IDs are numeric strings")
+	}
+	return errors.New("could not decode payload")
+}
+
 func isHTTPURL(input string) bool {
 	parsed, err := url.ParseRequestURI(input)
 	if err != nil {
@@ -108,7 +111,7 @@ func updateUserInfo(values interface{}, field string, value string) interface{}
 }
 
 // webhook for regular messages
-func callHook(myurl string, payload map[string]string, id string) {
+func callHook(myurl string, payload map[string]string, id string, secret string, format string) {
 	log.Info().Str("url", myurl).Msg("Sending POST to client " + id)
 
 	// Log the payload map
@@ -123,34 +126,138 @@ func callHook(myurl string, payload map[string]string, id string) {
 		return
 	}
 
-	format := os.Getenv("WEBHOOK_FORMAT")
+	err := postHook(client, myurl, payload, secret, format)
+	metrics.webhookDelivery(id, err)
+	if err != nil {
+		log.Warn().Err(err).Str("url", myurl).Str("userID", id).Msg("Webhook delivery failed, queueing retry")
+		queueWebhookRetry(id, myurl, payload, err)
+	}
+}
+
+// postHook delivers a webhook payload. Transport errors and non-2xx responses are returned as errors.
+// When secret is set, the body is signed (see signWebhook).
+func postHook(client *resty.Client, myurl string, payload map[string]string, secret string, format string) error {
+	body, contentType := webhookBody(payload, format)
+
+	req := client.R().SetHeader("Content-Type", contentType).SetBody(body)
+	signWebhook(req, secret, body)
+
+	resp, err := req.Post(myurl)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode() < 200 || resp.StatusCode() >= 300 {
+		return fmt.Errorf("webhook returned status %d", resp.StatusCode())
+	}
+	return nil
+}
+
+// globalWebhookFormat returns the body format set by WEBHOOK_FORMAT, "json" or "form"
+func globalWebhookFormat() string {
+	if os.Getenv("WEBHOOK_FORMAT") == "json" {
+		return "json"
+	}
+	return "form"
+}
+
+// WebhookFormat returns the body format of a user's webhook; the webhookV2 feature switches it to JSON
+func (s *server) WebhookFormat(userID string) string {
+	if s.featureEnabled(userID, featureWebhookV2) {
+		return "json"
+	}
+	return globalWebhookFormat()
+}
+
+// userWebhookFormat returns the body format of a connected user's webhook
+func userWebhookFormat(userID string) string {
+	if userFeatureEnabled(userID, featureWebhookV2) {
+		return "json"
+	}
+	return globalWebhookFormat()
+}
+
+// webhookBody encodes a webhook payload as JSON or form data
+func webhookBody(payload map[string]string, format string) ([]byte, string) {
 	if format == "json" {
-		// Send as pure JSON
-		// The original payload is a map[string]string, but we want to send the postmap (map[string]interface{})
-		// So we try to decode the jsonData field if it exists, otherwise we send the original payload
-		var body interface{} = payload
+		// Send as pure JSON: the event in jsonData with the token added at the top level.
+		// Payloads without a decodable jsonData are sent as they are.
 		if jsonStr, ok := payload["jsonData"]; ok {
-			var postmap map[string]interface{}
-			err := json.Unmarshal([]byte(jsonStr), &postmap)
-			if err == nil {
-				postmap["token"] = payload["token"]
-				body = postmap
+			if body, err := addJSONFields([]byte(jsonStr), map[string]string{"token": payload["token"]}); err == nil {
+				return body, "application/json"
 			}
 		}
-		_, err := client.R().
-			SetHeader("Content-Type", "application/json").
-			SetBody(body).
-			Post(myurl)
-		if err != nil {
-			log.Debug().Str("error", err.Error())
-		}
-	} else {
-		// Default: send as form-urlencoded
-		_, err := client.R().SetFormData(payload).Post(myurl)
+		body, _ := json.Marshal(payload)
+		return body, "application/json"
+	}
+
+	// Default: send as form-urlencoded
+	form := url.Values{}
+	for key, value := range payload {
+		form.Set(key, value)
+	}
+	return []byte(form.Encode()), "application/x-www-form-urlencoded"
+}
+
+// addJSONFields sets top-level string fields of a JSON object. Only the top
+// level is decoded; nested values are copied through as raw JSON.
+func addJSONFields(data []byte, fields map[string]string) ([]byte, error) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(data, &object); err != nil {
+		return nil, err
+	}
+	if object == nil {
+		object = map[string]json.RawMessage{}
+	}
+	for key, value := range fields {
+		raw, err := json.Marshal(value)
 		if err != nil {
-			log.Debug().Str("error", err.Error())
+			return nil, err
 		}
+		object[key] = raw
+	}
+	return json.Marshal(object)
+}
+
+// jsonEventType returns the type field of an encoded event
+func jsonEventType(data []byte) string {
+	var event struct {
+		Type string `json:"type"`
 	}
+	json.Unmarshal(data, &event)
+	return event.Type
+}
+
+// probeWebhook sends a WebhookTest event to the URL and fails if it cannot be delivered
+func probeWebhook(webhookURL string, token string, id string, secret string, format string) error {
+	client := clientManager.GetHTTPClient(id)
+	if client == nil {
+		client = resty.New()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	event := map[string]interface{}{
+		"type":  "WebhookTest",
+		"event": map[string]interface{}{"timestamp": time.Now().Unix()},
+	}
+	jsonData, _ := json.Marshal(event)
+	body, contentType := webhookBody(map[string]string{
+		"jsonData": string(jsonData),
+		"token":    token,
+	}, format)
+
+	req := client.R().SetContext(ctx).SetHeader("Content-Type", contentType).SetBody(body)
+	signWebhook(req, secret, body)
+
+	resp, err := req.Post(webhookURL)
+	if err != nil {
+		return fmt.Errorf("webhook is not reachable: %v", err)
+	}
+	if resp.StatusCode() >= 400 {
+		return fmt.Errorf("webhook test returned status %d", resp.StatusCode())
+	}
+	return nil
 }
 
 // webhook for messages with file attachments
@@ -199,7 +306,7 @@ func (s *server) respondWithJSON(w http.ResponseWriter, statusCode int, payload
 	}
 }
 
-// ProcessOutgoingMedia handles media processing for outgoing messages with S3 support
+// ProcessOutgoingMedia handles media processing for outgoing messages with media store support
 func ProcessOutgoingMedia(userID string, contactJID string, messageID string, data []byte, mimeType string, fileName string, db *sqlx.DB) (map[string]interface{}, error) {
 	// Check if S3 is enabled for this user
 	var s3Config struct {
@@ -216,8 +323,9 @@ func ProcessOutgoingMedia(userID string, contactJID string, messageID string, da
 	// Process S3 upload if enabled
 	if s3Config.Enabled && (s3Config.MediaDelivery == "s3" || s3Config.MediaDelivery == "both") {
 		// Process S3 upload (outgoing messages are always in outbox)
-		s3Data, err := GetS3Manager().ProcessMediaForS3(
+		s3Data, err := storeMedia(
 			context.Background(),
+			db,
 			userID,
 			contactJID,
 			messageID,
@@ -227,8 +335,8 @@ func ProcessOutgoingMedia(userID string, contactJID string, messageID string, da
 			false, // isIncoming = false for sent messages
 		)
 		if err != nil {
-			log.Error().Err(err).Msg("Failed to upload media to S3")
-			// Continue even if S3 upload fails
+			log.Error().Err(err).Msg("Failed to upload media to media store")
+			// Continue even if the upload fails
 		} else {
 			return s3Data, nil
 		}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultHistoryBatchSize = 200
+	defaultHistoryFlushMs   = 1000
+	historyTrimInterval     = 30 * time.Second
+
+	// historyMaxPending bounds the rows kept in memory while the database is failing
+	historyMaxPending = 50000
+	// historyMaxAttempts is the number of flushes a row is tried in before it is dropped
+	historyMaxAttempts = 3
+
+	historyColumns = 9
+)
+
+// historyRow is a message waiting to be written to message_history
+type historyRow struct {
+	userID      string
+	chatID      string
+	senderID    string
+	messageID   string
+	timestamp   time.Time
+	messageType string
+	textContent string
+	mediaLink   string
+	replyToID   string
+	attempts    int
+}
+
+// historyBuffer batches message_history inserts and the changefeed entries of
+// the stored messages. Rows are written when the buffer reaches the batch size
+// or when the flush interval elapses, and chats that received messages are
+// trimmed to their limit periodically instead of after every insert.
+type historyBuffer struct {
+	s         *server
+	batchSize int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	rows    []historyRow
+	changes []changeRow
+	dirty   map[[2]string]int // userID/chatID -> history limit
+	full    chan struct{}
+	flushMu sync.Mutex
+}
+
+// historyWriter is nil when batching is disabled (HISTORY_BATCH_SIZE=0)
+var historyWriter *historyBuffer
+
+// startHistoryWriter reads the batching settings and starts the background writer
+func (s *server) startHistoryWriter() {
+	batchSize := envInt("HISTORY_BATCH_SIZE", defaultHistoryBatchSize)
+	if batchSize == 0 {
+		log.Info().Msg("History write batching disabled")
+		return
+	}
+	interval := time.Duration(envInt("HISTORY_FLUSH_MS", defaultHistoryFlushMs)) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultHistoryFlushMs * time.Millisecond
+	}
+
+	historyWriter = &historyBuffer{
+		s:         s,
+		batchSize: batchSize,
+		interval:  interval,
+		dirty:     map[[2]string]int{},
+		full:      make(chan struct{}, 1),
+	}
+	go historyWriter.run()
+
+	log.Info().Int("batchSize", batchSize).Dur("interval", interval).Msg("History write batching enabled")
+}
+
+// storeHistory saves a message to history, through the batch writer when it is enabled
+func (s *server) storeHistory(userID, chatID, senderID, messageID, messageType, textContent string, limit int) error {
+	change := map[string]interface{}{
+		"chatId":    chatID,
+		"senderId":  senderID,
+		"messageId": messageID,
+		"type":      messageType,
+		"text":      textContent,
+	}
+
+	if historyWriter == nil {
+		s.recordChange(userID, changeEntityMessage, "stored", messageID, change)
+		if err := s.saveMessageToHistory(userID, chatID, senderID, messageID, messageType, textContent, "", ""); err != nil {
+			return err
+		}
+		return s.trimMessageHistory(userID, chatID, limit)
+	}
+
+	textContent, err := encryptField(userID, textContent)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt message: %w", err)
+	}
+
+	historyWriter.add(historyRow{
+		userID:      userID,
+		chatID:      chatID,
+		senderID:    senderID,
+		messageID:   messageID,
+		timestamp:   time.Now(),
+		messageType: messageType,
+		textContent: textContent,
+	}, limit)
+	if row, ok := newChangeRow(userID, changeEntityMessage, "stored", messageID, change); ok {
+		historyWriter.addChange(row)
+	}
+	return nil
+}
+
+// add queues a row and marks its chat for trimming
+func (b *historyBuffer) add(row historyRow, limit int) {
+	b.mu.Lock()
+	if len(b.rows) >= historyMaxPending {
+		b.mu.Unlock()
+		log.Error().Str("userID", row.userID).Int("pending", historyMaxPending).Msg("History buffer full, message not saved")
+		return
+	}
+	b.rows = append(b.rows, row)
+	b.dirty[[2]string{row.userID, row.chatID}] = limit
+	n := len(b.rows)
+	b.mu.Unlock()
+
+	if n >= b.batchSize {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// addChange queues a changefeed entry
+func (b *historyBuffer) addChange(row changeRow) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if len(b.changes) >= historyMaxPending {
+		log.Error().Str("userID", row.userID).Int("pending", historyMaxPending).Msg("Changefeed buffer full, change not recorded")
+		return
+	}
+	b.changes = append(b.changes, row)
+}
+
+// drop discards the buffered rows of a user, e.g. when the user is deleted or erased
+func (b *historyBuffer) drop(userID string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	kept := b.rows[:0]
+	for _, row := range b.rows {
+		if row.userID != userID {
+			kept = append(kept, row)
+		}
+	}
+	b.rows = kept
+	keptChanges := b.changes[:0]
+	for _, row := range b.changes {
+		if row.userID != userID {
+			keptChanges = append(keptChanges, row)
+		}
+	}
+	b.changes = keptChanges
+	for key := range b.dirty {
+		if key[0] == userID {
+			delete(b.dirty, key)
+		}
+	}
+}
+
+func (b *historyBuffer) run() {
+	flush := time.NewTicker(b.interval)
+	defer flush.Stop()
+	trim := time.NewTicker(historyTrimInterval)
+	defer trim.Stop()
+
+	for {
+		select {
+		case <-flush.C:
+			b.flush()
+		case <-b.full:
+			b.flush()
+		case <-trim.C:
+			b.flush()
+			b.trim()
+		}
+	}
+}
+
+// flush writes all buffered rows, the messages before their changes
+func (b *historyBuffer) flush() {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	rows, changes := b.rows, b.changes
+	b.rows, b.changes = nil, nil
+	b.mu.Unlock()
+
+	for start := 0; start < len(rows); start += b.batchSize {
+		end := min(start+b.batchSize, len(rows))
+		if err := b.insert(rows[start:end]); err != nil {
+			log.Warn().Err(err).Int("rows", end-start).Msg("Batched history insert failed, writing rows one by one")
+			b.insertEach(rows[start:end])
+		}
+	}
+	for start := 0; start < len(changes); start += b.batchSize {
+		end := min(start+b.batchSize, len(changes))
+		if err := b.s.insertChanges(changes[start:end]); err != nil {
+			log.Warn().Err(err).Int("rows", end-start).Msg("Batched changefeed insert failed, writing changes one by one")
+			b.insertChangesEach(changes[start:end])
+		}
+	}
+}
+
+// insert writes rows with a single multi-row INSERT
+func (b *historyBuffer) insert(rows []historyRow) error {
+	var query strings.Builder
+	query.WriteString(`INSERT INTO message_history (user_id, chat_id, sender_id, message_id, timestamp, message_type, text_content, media_link, reply_to_id) VALUES `)
+
+	args := make([]interface{}, 0, len(rows)*historyColumns)
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for c := 1; c <= historyColumns; c++ {
+			if c > 1 {
+				query.WriteString(", ")
+			}
+			fmt.Fprintf(&query, "$%d", i*historyColumns+c)
+		}
+		query.WriteString(")")
+		args = append(args, row.userID, row.chatID, row.senderID, row.messageID, row.timestamp,
+			row.messageType, row.textContent, row.mediaLink, row.replyToID)
+	}
+
+	_, err := b.s.db.Exec(query.String(), args...)
+	return err
+}
+
+// insertEach writes rows individually so one bad row (e.g. of a deleted user) does not lose the batch
+func (b *historyBuffer) insertEach(rows []historyRow) {
+	failed := []historyRow{}
+	for _, row := range rows {
+		if err := b.insert([]historyRow{row}); err != nil {
+			var exists bool
+			if qerr := b.s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", row.userID); qerr == nil && !exists {
+				continue
+			}
+			log.Error().Err(err).Str("userID", row.userID).Str("messageId", row.messageID).Msg("Failed to save message to history")
+			if row.attempts++; row.attempts < historyMaxAttempts {
+				failed = append(failed, row)
+			}
+		}
+	}
+
+	// Keep rows that failed for a transient reason for the next flush
+	if len(failed) > 0 {
+		b.mu.Lock()
+		if len(b.rows)+len(failed) <= historyMaxPending {
+			b.rows = append(failed, b.rows...)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// insertChangesEach writes changes individually, like insertEach
+func (b *historyBuffer) insertChangesEach(rows []changeRow) {
+	failed := []changeRow{}
+	for _, row := range rows {
+		if err := b.s.insertChanges([]changeRow{row}); err != nil {
+			log.Error().Err(err).Str("userID", row.userID).Str("entity", row.entity).Str("action", row.action).Msg("Failed to record change")
+			if row.attempts++; row.attempts < historyMaxAttempts {
+				failed = append(failed, row)
+			}
+		}
+	}
+
+	if len(failed) > 0 {
+		b.mu.Lock()
+		if len(b.changes)+len(failed) <= historyMaxPending {
+			b.changes = append(failed, b.changes...)
+		}
+		b.mu.Unlock()
+	}
+}
+
+// trim applies the history limit to the chats that received messages since the last pass
+func (b *historyBuffer) trim() {
+	b.mu.Lock()
+	dirty := b.dirty
+	b.dirty = map[[2]string]int{}
+	b.mu.Unlock()
+
+	for key, limit := range dirty {
+		if err := b.s.trimMessageHistory(key[0], key[1], limit); err != nil {
+			log.Error().Err(err).Str("userID", key[0]).Msg("Failed to trim message history")
+		}
+	}
+}
+
+// close writes the buffered rows and trims their chats, used on shutdown
+func (b *historyBuffer) close() {
+	b.flush()
+	b.trim()
+}
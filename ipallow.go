@@ -0,0 +1,225 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// trustedProxies are the reverse proxies whose X-Forwarded-For header gives
+// the client address. Without them the connection address is used.
+var trustedProxies []netip.Prefix
+
+// userAllowlists caches the allowed source networks per user
+var userAllowlists sync.Map
+
+// initTrustedProxies reads MAXAPI_TRUSTED_PROXIES, a comma-separated list of
+// addresses and CIDR ranges
+func initTrustedProxies() error {
+	prefixes, err := parseAllowlist(splitList(os.Getenv("MAXAPI_TRUSTED_PROXIES"), ","))
+	if err != nil {
+		return fmt.Errorf("MAXAPI_TRUSTED_PROXIES: %w", err)
+	}
+	trustedProxies = prefixes
+	return nil
+}
+
+// splitList splits a separated list, dropping empty entries
+func splitList(v, sep string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseAllowlist parses addresses and CIDR ranges. A plain address allows
+// only itself.
+func parseAllowlist(entries []string) ([]netip.Prefix, error) {
+	prefixes := make([]netip.Prefix, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address %q", entry)
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CIDR range %q", entry)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// allowedFrom reports whether addr is in one of the prefixes. An empty list
+// allows every address.
+func allowedFrom(prefixes []netip.Prefix, addr netip.Addr) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientAddr returns the address of the client. Behind a trusted proxy it is
+// the last X-Forwarded-For entry that is not a trusted proxy itself.
+func clientAddr(r *http.Request) netip.Addr {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, _ := netip.ParseAddr(host)
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || len(trustedProxies) == 0 || !allowedFrom(trustedProxies, addr) {
+		return addr
+	}
+	hops := splitList(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop, err := netip.ParseAddr(hops[i])
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+		if !allowedFrom(trustedProxies, addr) {
+			break
+		}
+	}
+	return addr
+}
+
+// userAllowlist returns the networks a user's token may be used from, none
+// when it may be used from anywhere
+func (s *server) userAllowlist(userID string) ([]netip.Prefix, error) {
+	if cached, ok := userAllowlists.Load(userID); ok {
+		return cached.([]netip.Prefix), nil
+	}
+
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(allowed_ips, '') FROM users WHERE id = $1", userID); err != nil {
+		return nil, err
+	}
+	prefixes, err := parseAllowlist(splitList(raw, ","))
+	if err != nil {
+		return nil, err
+	}
+	userAllowlists.Store(userID, prefixes)
+	return prefixes, nil
+}
+
+// validateAllowedIPs checks an allowlist and returns it in its stored form
+func validateAllowedIPs(entries []string) (string, error) {
+	entries = splitList(strings.Join(entries, ","), ",")
+	if _, err := parseAllowlist(entries); err != nil {
+		return "", fmt.Errorf("allowedIps: %w", err)
+	}
+	return strings.Join(entries, ","), nil
+}
+
+// rejectSource answers a request whose source address is not allowed
+func (s *server) rejectSource(w http.ResponseWriter, r *http.Request, addr netip.Addr, who string) {
+	log.Warn().Str("ip", addr.String()).Str("credential", who).Str("path", r.URL.Path).Msg("Request from a source address that is not allowed")
+	s.Respond(w, r, http.StatusForbidden, fmt.Errorf("access from %s is not allowed", addr))
+}
+
+// GetUserAllowedIPs returns the networks a user's token may be used from
+// @Summary Get user IP allowlist
+// @Description Returns the addresses and CIDR ranges the user's token is accepted from. An empty list accepts every address.
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 200 {object} AllowedIPsResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/allowed-ips [get]
+func (s *server) GetUserAllowedIPs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var raw string
+		if err := s.db.Get(&raw, "SELECT COALESCE(allowed_ips, '') FROM users WHERE id = $1", userID); err != nil {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":    true,
+			"userID":     userID,
+			"allowedIps": splitList(raw, ","),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetUserAllowedIPs replaces the networks a user's token may be used from
+// @Summary Set user IP allowlist
+// @Description Replaces the addresses and CIDR ranges the user's token is accepted from. Requests from other addresses are rejected with 403. An empty list removes the restriction.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userid path string true "User ID"
+// @Param request body AllowedIPsBody true "Allowed addresses and CIDR ranges"
+// @Success 200 {object} AllowedIPsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/allowed-ips [post]
+func (s *server) SetUserAllowedIPs() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var exists bool
+		if err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID); err != nil || !exists {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		var msg AllowedIPsBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		allowed, err := validateAllowedIPs(msg.AllowedIPs)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if _, err := s.db.Exec("UPDATE users SET allowed_ips = $1 WHERE id = $2", allowed, userID); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		userAllowlists.Delete(userID)
+
+		log.Info().Str("userID", userID).Str("allowedIps", allowed).Msg("IP allowlist updated")
+
+		response := map[string]interface{}{
+			"success":    true,
+			"userID":     userID,
+			"allowedIps": splitList(allowed, ","),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"net/netip"
+	"testing"
+)
+
+func TestUserAllowlist(t *testing.T) {
+	s := newTestServer(t)
+	userID, token := newTestUser(t, s, "allowlisted")
+	if _, err := s.db.Exec("UPDATE users SET allowed_ips = $1 WHERE id = $2", "10.0.0.0/8,2001:db8::/32,203.0.113.7", userID); err != nil {
+		t.Fatal(err)
+	}
+	userAllowlists.Delete(userID)
+	t.Cleanup(func() { userAllowlists.Delete(userID) })
+
+	was := trustedProxies
+	trustedProxies = []netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}
+	t.Cleanup(func() { trustedProxies = was })
+
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		want      int
+	}{
+		{"inside a range", "10.1.2.3:4321", "", http.StatusOK},
+		{"single address", "203.0.113.7:4321", "", http.StatusOK},
+		{"next to a single address", "203.0.113.8:4321", "", http.StatusForbidden},
+		{"outside", "192.0.2.1:4321", "", http.StatusForbidden},
+		{"IPv6 range", "[2001:db8::1]:4321", "", http.StatusOK},
+		{"IPv4-mapped IPv6", "[::ffff:10.0.0.1]:4321", "", http.StatusOK},
+		{"behind a trusted proxy", "127.0.0.1:4321", "10.0.0.5", http.StatusOK},
+		{"outside behind a trusted proxy", "127.0.0.1:4321", "192.0.2.1", http.StatusForbidden},
+		{"spoofed by the client", "127.0.0.1:4321", "10.0.0.5, 192.0.2.1", http.StatusForbidden},
+		{"forwarded by an untrusted client", "192.0.2.1:4321", "10.0.0.5", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{"token": token}
+			if tt.forwarded != "" {
+				header["X-Forwarded-For"] = tt.forwarded
+			}
+			if rec := serve(s, "GET", "/user/blocklist", tt.remote, header, ""); rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// TestInternalSendSkipsAllowlist checks that sends issued by the server itself,
+// which have no client address, are not rejected by the allowlist of the user
+func TestInternalSendSkipsAllowlist(t *testing.T) {
+	s := newTestServer(t)
+	userID, token := newTestUser(t, s, "allowlisted")
+	if _, err := s.db.Exec("UPDATE users SET allowed_ips = $1 WHERE id = $2", "10.0.0.0/8", userID); err != nil {
+		t.Fatal(err)
+	}
+	userAllowlists.Delete(userID)
+	t.Cleanup(func() { userAllowlists.Delete(userID) })
+
+	body := `{"userIds": [123456789]}`
+	if rec := serve(s, "POST", "/user/blocklist", "192.0.2.1:4321", map[string]string{"token": token}, body); rec.Code != http.StatusForbidden {
+		t.Fatalf("request from outside the allowlist: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	if rec := s.InternalSend(storedToken(token), "/user/blocklist", body); rec.Code != http.StatusOK {
+		t.Fatalf("internal send: status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body)
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/rs/zerolog/log"
+)
+
+// maxJoinRequestsPage caps the join requests returned or decided in one request
+const maxJoinRequestsPage = 100
+
+// GetJoinRequests lists the pending requests to join a group
+// @Summary List join requests
+// @Description Returns the pending requests to join a group or channel where new members need approval. count (1-100, default 50) sets the page size; pass the returned marker to get the next page, it is 0 after the last. New requests are also sent as JoinRequest events.
+// @Tags Group
+// @Produce json
+// @Param chatId query int true "Chat ID"
+// @Param count query int false "Requests per page (default 50, max 100)"
+// @Param marker query int false "Marker returned by the previous page"
+// @Success 200 {object} JoinRequestsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/joinrequests [get]
+func (s *server) GetJoinRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		chatID, err := strconv.ParseInt(r.URL.Query().Get("chatId"), 10, 64)
+		if err != nil || chatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("missing or invalid chatId"))
+			return
+		}
+
+		count := 50
+		if v := r.URL.Query().Get("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxJoinRequestsPage {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("count must be between 1 and %d", maxJoinRequestsPage))
+				return
+			}
+			count = n
+		}
+
+		var marker int64
+		if v := r.URL.Query().Get("marker"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("invalid marker"))
+				return
+			}
+			marker = n
+		}
+
+		requests, next, err := client.GetJoinRequests(chatID, marker, count)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get join requests failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"chatId":   chatID,
+			"requests": requests,
+			"count":    len(requests),
+			"marker":   next,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DecideJoinRequests approves or declines requests to join a group
+// @Summary Approve or decline join requests
+// @Description Approves (action approve) or declines (action decline) pending requests to join a group or channel. Approved users become members.
+// @Tags Group
+// @Accept json
+// @Produce json
+// @Param request body JoinRequestsDecideBody true "Chat, users and action"
+// @Success 200 {object} JoinRequestsDecideResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/joinrequests/decide [post]
+func (s *server) DecideJoinRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg JoinRequestsDecideBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.ChatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("chatId is required"))
+			return
+		}
+		if len(msg.UserIDs) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("userIds is required"))
+			return
+		}
+		if len(msg.UserIDs) > maxJoinRequestsPage {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d users per request", maxJoinRequestsPage))
+			return
+		}
+
+		var operation string
+		switch msg.Action {
+		case "approve":
+			operation = "add"
+		case "decline":
+			operation = "remove"
+		default:
+			s.Respond(w, r, http.StatusBadRequest, errors.New("action must be approve or decline"))
+			return
+		}
+
+		if err := client.DecideJoinRequests(msg.ChatID, msg.UserIDs, operation); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("%s failed: %v", msg.Action, err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int64("chatId", msg.ChatID).Str("action", msg.Action).Int("users", len(msg.UserIDs)).Msg("Join requests decided")
+
+		response := map[string]interface{}{
+			"success": true,
+			"chatId":  msg.ChatID,
+			"action":  msg.Action,
+			"userIds": msg.UserIDs,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const (
+	errCodeUploadTooLarge = "UPLOAD_TOO_LARGE"
+
+	uploadLimitMAX    = "max"
+	uploadLimitConfig = "config"
+	uploadLimitNone   = "none"
+)
+
+// uploadLimit returns the largest upload accepted for a client in bytes and
+// where the limit comes from. The limit reported by MAX wins; otherwise
+// MAXAPI_MAX_UPLOAD_MB applies, and 0 means no limit.
+func uploadLimit(client *maxclient.Client) (int64, string) {
+	if size := client.Limits().MaxUploadSize; size > 0 {
+		return size, uploadLimitMAX
+	}
+	if mb := envInt("MAXAPI_MAX_UPLOAD_MB", 0); mb > 0 {
+		return int64(mb) << 20, uploadLimitConfig
+	}
+	return 0, uploadLimitNone
+}
+
+// CheckUploadSize rejects media larger than the upload limit before it is
+// sent to MAX, and writes the response when it does
+func (s *server) CheckUploadSize(w http.ResponseWriter, r *http.Request, client *maxclient.Client, size int64) bool {
+	limit, source := uploadLimit(client)
+	if limit == 0 || size <= limit {
+		return true
+	}
+
+	txtid := r.Context().Value("userinfo").(Values).Get("Id")
+	log.Info().Str("userID", txtid).Int64("size", size).Int64("limit", limit).Str("source", source).Msg("Upload exceeds size limit")
+	s.Respond(w, r, http.StatusRequestEntityTooLarge, map[string]interface{}{
+		"success": false,
+		"error":   fmt.Sprintf("media is %d bytes, the upload limit is %d bytes", size, limit),
+		"code":    errCodeUploadTooLarge,
+	})
+	return false
+}
+
+// GetLimits returns the account limits
+// @Summary Get account limits
+// @Description Returns the limits MAX reported for the account at login: the maximum upload size, message length, chat participants and favorite chats, the last rate limit error, and the raw config they were read from. Limits MAX did not report are omitted. uploadLimit is the size enforced by the media endpoints; uploadLimitSource is max, config (MAXAPI_MAX_UPLOAD_MB) or none.
+// @Tags Session
+// @Produce json
+// @Success 200 {object} LimitsResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/limits [get]
+func (s *server) GetLimits() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		limit, source := uploadLimit(client)
+
+		response := map[string]interface{}{
+			"success":           true,
+			"limits":            client.Limits(),
+			"uploadLimit":       limit,
+			"uploadLimitSource": source,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+// textLinkPattern finds plain http(s) links in message text
+var textLinkPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// firstLink returns the first link of a message: a link element target or,
+// failing that, the first URL in the text
+func firstLink(text string, elements []maxclient.Element) string {
+	for _, el := range elements {
+		if el.Type == maxclient.FormattingLink && el.Attributes["url"] != "" {
+			return el.Attributes["url"]
+		}
+	}
+	return textLinkPattern.FindString(text)
+}
+
+// linkPreviewAttachment fetches the preview of the first link of a message.
+// A missing preview is not an error: the message is then sent without one.
+func linkPreviewAttachment(client *maxclient.Client, text string, elements []maxclient.Element) []maxclient.Attachment {
+	link := firstLink(text, elements)
+	if link == "" {
+		return nil
+	}
+	preview, err := client.GetLinkInfo(link)
+	if err != nil {
+		log.Debug().Err(err).Str("url", link).Msg("No link preview, sending without")
+		return nil
+	}
+	return []maxclient.Attachment{preview.Attachment()}
+}
+
+// GetLinkPreview fetches the preview MAX generates for a link
+// @Summary Get link preview
+// @Description Returns the preview (title, description, image) MAX generates for a link. Messages sent with POST /chat/send/text carry no preview unless linkPreview is true, in which case this preview of the first link is attached.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body LinkPreviewBody true "Link"
+// @Success 200 {object} LinkPreviewResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 404 {object} api.ErrorResponse "No preview for the link"
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/linkpreview [post]
+func (s *server) GetLinkPreview() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg LinkPreviewBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		u, err := url.Parse(msg.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("url must be an http or https link"))
+			return
+		}
+
+		preview, err := client.GetLinkInfo(msg.URL)
+		if errors.Is(err, maxclient.ErrNoLinkPreview) {
+			s.Respond(w, r, http.StatusNotFound, err)
+			return
+		}
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("link preview failed: %v", err))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"preview": preview,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const (
+	loadTestUserPrefix = "loadtest-"
+	loadTestTextPrefix = "loadtest "
+	loadTestDrainTime  = 5 * time.Second
+)
+
+// loadTest holds the counters of a load test run
+type loadTest struct {
+	instances int
+	rate      float64
+
+	sent      atomic.Int64
+	received  atomic.Int64
+	messages  atomic.Int64
+	connected atomic.Int64
+
+	latencyMu sync.Mutex
+	latencies []time.Duration
+
+	peakGoroutines atomic.Int64
+}
+
+// LoadTestReport summarises a load test run
+type LoadTestReport struct {
+	Instances       int     `json:"instances"`
+	Connected       int64   `json:"connected"`
+	DurationSeconds float64 `json:"durationSeconds"`
+	EventsSent      int64   `json:"eventsSent"`
+	EventsPerSecond float64 `json:"eventsPerSecond"`
+	WebhooksTotal   int64   `json:"webhooksReceived"`
+	MessageWebhooks int64   `json:"messageWebhooks"`
+	LatencyP50Ms    float64 `json:"webhookLatencyP50Ms"`
+	LatencyP95Ms    float64 `json:"webhookLatencyP95Ms"`
+	LatencyP99Ms    float64 `json:"webhookLatencyP99Ms"`
+	LatencyMaxMs    float64 `json:"webhookLatencyMaxMs"`
+	HistoryRows     int64   `json:"historyRows"`
+	DBWritesPerSec  float64 `json:"dbWritesPerSecond"`
+	PeakGoroutines  int64   `json:"peakGoroutines"`
+	HeapAllocBytes  uint64  `json:"heapAllocBytes"`
+	AllocsPerEvent  float64 `json:"allocsPerEvent"`
+	BytesPerEvent   float64 `json:"allocBytesPerEvent"`
+}
+
+// runLoadTest connects synthetic instances to an in-process mock of the MAX
+// WebSocket API, feeds each of them incoming messages at the given rate and
+// measures event throughput, webhook latency and history write rate. The
+// synthetic users are removed from the database afterwards.
+func (s *server) runLoadTest(instances int, duration time.Duration, rate float64) (*LoadTestReport, error) {
+	lt := &loadTest{instances: instances, rate: rate}
+
+	mock := httptest.NewServer(http.HandlerFunc(lt.serveMockMAX))
+	defer mock.Close()
+	receiver := httptest.NewServer(http.HandlerFunc(lt.receiveWebhook))
+	defer receiver.Close()
+
+	maxEndpoint = "ws" + strings.TrimPrefix(mock.URL, "http")
+
+	s.cleanupLoadTestUsers()
+	defer s.cleanupLoadTestUsers()
+
+	log.Info().Int("instances", instances).Dur("duration", duration).Float64("rate", rate).Msg("Starting load test")
+
+	for i := 0; i < instances; i++ {
+		if err := s.startLoadTestInstance(i, receiver.URL); err != nil {
+			return nil, err
+		}
+	}
+
+	// Sample the process while the test runs
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if n := int64(runtime.NumGoroutine()); n > lt.peakGoroutines.Load() {
+					lt.peakGoroutines.Store(n)
+				}
+			}
+		}
+	}()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	started := time.Now()
+	time.Sleep(duration)
+	elapsed := time.Since(started)
+	sent := lt.sent.Load()
+	runtime.ReadMemStats(&after)
+
+	// Stop the instances so the mock stops generating events, then let deliveries drain.
+	// The client loop polls its kill channel, so the signal is sent without dropping it.
+	for i := 0; i < instances; i++ {
+		if ch := killchannel[loadTestUserID(i)]; ch != nil {
+			go func() { ch <- true }()
+		}
+	}
+	time.Sleep(loadTestDrainTime)
+	close(stop)
+	if historyWriter != nil {
+		historyWriter.close()
+	}
+
+	var historyRows int64
+	if err := s.db.Get(&historyRows, "SELECT COUNT(*) FROM message_history WHERE user_id LIKE $1", loadTestUserPrefix+"%"); err != nil {
+		log.Warn().Err(err).Msg("Failed to count load test history")
+	}
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	report := &LoadTestReport{
+		Instances:       instances,
+		Connected:       lt.connected.Load(),
+		DurationSeconds: elapsed.Seconds(),
+		EventsSent:      sent,
+		EventsPerSecond: float64(sent) / elapsed.Seconds(),
+		WebhooksTotal:   lt.received.Load(),
+		MessageWebhooks: lt.messages.Load(),
+		HistoryRows:     historyRows,
+		DBWritesPerSec:  float64(historyRows) / elapsed.Seconds(),
+		PeakGoroutines:  lt.peakGoroutines.Load(),
+		HeapAllocBytes:  mem.HeapAlloc,
+	}
+	if sent > 0 {
+		// Allocations of the whole process, including the mock server and the webhook receiver
+		report.AllocsPerEvent = float64(after.Mallocs-before.Mallocs) / float64(sent)
+		report.BytesPerEvent = float64(after.TotalAlloc-before.TotalAlloc) / float64(sent)
+	}
+	report.LatencyP50Ms, report.LatencyP95Ms, report.LatencyP99Ms, report.LatencyMaxMs = lt.latencyPercentiles()
+
+	return report, nil
+}
+
+func loadTestUserID(i int) string {
+	return fmt.Sprintf("%s%04d", loadTestUserPrefix, i)
+}
+
+// startLoadTestInstance creates a synthetic user and starts its client
+func (s *server) startLoadTestInstance(i int, webhook string) error {
+	userID := loadTestUserID(i)
+	token := userID + "-token"
+	history := 1000000 // keep every message so writes can be counted
+
+	_, err := s.db.Exec(`INSERT INTO users (id, name, token, webhook, events, connected, history, auth_token)
+		VALUES ($1, $2, $3, $4, $5, 0, $6, $7)`, userID, userID, token, webhook, "All", history, "auth-"+userID)
+	if err != nil {
+		return fmt.Errorf("failed to create load test user: %w", err)
+	}
+
+	v := Values{map[string]string{
+		"Id":            userID,
+		"Name":          userID,
+		"Webhook":       webhook,
+		"Token":         token,
+		"Events":        "All",
+		"S3Enabled":     "false",
+		"MediaDelivery": "base64",
+		"History":       strconv.Itoa(history),
+	}}
+	cacheUserInfo(token, v)
+
+	killchannel[userID] = make(chan bool)
+	go s.startClient(userID, "auth-"+userID, "", token, []string{"All"})
+	return nil
+}
+
+// cleanupLoadTestUsers removes synthetic users left by this or an earlier run
+func (s *server) cleanupLoadTestUsers() {
+	var ids []string
+	if err := s.db.Select(&ids, "SELECT id FROM users WHERE id LIKE $1", loadTestUserPrefix+"%"); err != nil {
+		log.Warn().Err(err).Msg("Failed to list load test users")
+		return
+	}
+	for _, id := range ids {
+		cleanupClient(id)
+		instanceResourceMap.Delete(id)
+	}
+
+	s.db.Exec("DELETE FROM message_history WHERE user_id LIKE $1", loadTestUserPrefix+"%")
+	s.db.Exec("DELETE FROM media WHERE user_id LIKE $1", loadTestUserPrefix+"%")
+	s.db.Exec("DELETE FROM users WHERE id LIKE $1", loadTestUserPrefix+"%")
+}
+
+// serveMockMAX answers the MAX WebSocket protocol well enough for a session:
+// session init, login and pings are acknowledged, and after login incoming
+// messages are pushed at the configured rate.
+func (lt *loadTest) serveMockMAX(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	var writeMu sync.Mutex
+	send := func(seq int, opcode maxclient.Opcode, payload map[string]interface{}) error {
+		frame, _ := json.Marshal(map[string]interface{}{
+			"ver":     maxclient.ProtocolVersion,
+			"cmd":     1,
+			"seq":     seq,
+			"opcode":  int(opcode),
+			"payload": payload,
+		})
+		writeMu.Lock()
+		defer writeMu.Unlock()
+		return conn.WriteMessage(websocket.TextMessage, frame)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+
+		var req maxclient.BaseMessage
+		if err := json.Unmarshal(raw, &req); err != nil {
+			continue
+		}
+
+		payload := map[string]interface{}{}
+		if maxclient.Opcode(req.Opcode) == maxclient.OpLogin {
+			userID := lt.connected.Add(1)
+			payload["profile"] = map[string]interface{}{
+				"contact": map[string]interface{}{"id": 1000000 + userID},
+			}
+			payload["chats"] = []interface{}{}
+			go lt.generateMessages(1000000+userID, send, done)
+		}
+
+		if err := send(req.Seq, maxclient.Opcode(req.Opcode), payload); err != nil {
+			return
+		}
+	}
+}
+
+// generateMessages pushes incoming message notifications to one session
+func (lt *loadTest) generateMessages(maxUserID int64, send func(int, maxclient.Opcode, map[string]interface{}) error, done chan struct{}) {
+	if lt.rate <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / lt.rate))
+	defer ticker.Stop()
+
+	sender := maxUserID + 500000
+	for n := 1; ; n++ {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			payload := map[string]interface{}{
+				"chatId": maxclient.GetDialogID(maxUserID, sender),
+				"message": map[string]interface{}{
+					"id":     fmt.Sprintf("%d-%d", maxUserID, n),
+					"sender": sender,
+					"text":   loadTestTextPrefix + strconv.FormatInt(now.UnixNano(), 10),
+					"time":   now.UnixMilli(),
+					"type":   "USER",
+				},
+			}
+			if err := send(0, maxclient.OpNotifMessage, payload); err != nil {
+				return
+			}
+			lt.sent.Add(1)
+		}
+	}
+}
+
+// receiveWebhook counts deliveries and records the latency of message events
+func (lt *loadTest) receiveWebhook(w http.ResponseWriter, r *http.Request) {
+	lt.received.Add(1)
+	received := time.Now()
+
+	var raw []byte
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		raw, _ = io.ReadAll(r.Body)
+	} else {
+		r.ParseForm()
+		raw = []byte(r.FormValue("jsonData"))
+	}
+	w.WriteHeader(http.StatusOK)
+
+	var event struct {
+		Type  string `json:"type"`
+		Event struct {
+			Message struct {
+				Text string `json:"text"`
+			} `json:"message"`
+		} `json:"event"`
+	}
+	if err := json.Unmarshal(raw, &event); err != nil || event.Type != "Message" {
+		return
+	}
+
+	text := strings.TrimPrefix(event.Event.Message.Text, loadTestTextPrefix)
+	sentAt, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return
+	}
+
+	lt.messages.Add(1)
+	lt.latencyMu.Lock()
+	lt.latencies = append(lt.latencies, received.Sub(time.Unix(0, sentAt)))
+	lt.latencyMu.Unlock()
+}
+
+// latencyPercentiles returns p50, p95, p99 and max webhook latency in milliseconds
+func (lt *loadTest) latencyPercentiles() (float64, float64, float64, float64) {
+	lt.latencyMu.Lock()
+	defer lt.latencyMu.Unlock()
+
+	if len(lt.latencies) == 0 {
+		return 0, 0, 0, 0
+	}
+	sort.Slice(lt.latencies, func(i, j int) bool { return lt.latencies[i] < lt.latencies[j] })
+
+	at := func(p float64) float64 {
+		i := int(p * float64(len(lt.latencies)-1))
+		return float64(lt.latencies[i]) / float64(time.Millisecond)
+	}
+	return at(0.50), at(0.95), at(0.99), at(1)
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"flag"
 	"fmt"
 	"math/rand"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
 	"syscall"
@@ -29,7 +31,7 @@ import (
 // @description
 // @description ## Authentication
 // @description - **Standard Endpoints**: Include the `token` header with a valid user token
-// @description - **Admin Endpoints**: Use the `Authorization` header with the admin token (set in .env as MAXAPI_ADMIN_TOKEN)
+// @description - **Admin Endpoints**: Use the `Authorization` header with the admin token (set in .env as MAXAPI_ADMIN_TOKEN) or a role-bound key from MAXAPI_ADMIN_KEYS
 // @description
 // @description ## Phone number format
 // @description - Required: Country code (e.g. **79001234567** for Russia)
@@ -65,7 +67,14 @@ var (
 	sslprivkey    = flag.String("sslprivatekey", "", "SSL Certificate Private Key File")
 	adminToken    = flag.String("admintoken", "", "Security Token to authorize admin actions (list/create/remove users)")
 	globalWebhook = flag.String("globalwebhook", "", "Global webhook URL to receive all events from all users")
+	configFile    = flag.String("config", "", "Path to JSON configuration file")
+	lazyConnect   = flag.Bool("lazyconnect", false, "Connect instances on first API use instead of at startup")
+	maxStartups   = flag.Int("maxconcurrentstartups", 0, "Maximum number of instances logging in to MAX at the same time (0 = unlimited)")
+	loadTestN     = flag.Int("loadtest", 0, "Run a load test with this many synthetic instances against a mock MAX server and exit")
+	loadTestTime  = flag.Duration("loadtestduration", 30*time.Second, "Duration of the load test")
+	loadTestRate  = flag.Float64("loadtestrate", 5, "Incoming messages per second per synthetic instance")
 	versionFlag   = flag.Bool("version", false, "Display version information and exit")
+	hashTokenFlag = flag.String("hashtoken", "", "Print the hash of a token for MAXAPI_ADMIN_TOKEN or MAXAPI_ADMIN_KEYS, keyed with MAXAPI_TOKEN_SALT, and exit")
 
 	clientManager    = NewClientManager()
 	killchannel      = make(map[string](chan bool))
@@ -76,12 +85,9 @@ var (
 
 const version = "2.0.0-max"
 
-func init() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Warn().Err(err).Msg("It was not possible to load the .env file (it may not exist).")
-	}
-
+// configure parses the flags and sets up logging and the subsystems configured
+// by the environment. Tests call it directly, without loading .env.
+func configure() {
 	flag.Parse()
 
 	// Support MAXAPI_PORT environment variable
@@ -91,6 +97,17 @@ func init() {
 		}
 	}
 
+	// Support MAXAPI_LAZY_CONNECT and MAXAPI_MAX_CONCURRENT_STARTUPS environment variables
+	if !*lazyConnect {
+		*lazyConnect, _ = strconv.ParseBool(os.Getenv("MAXAPI_LAZY_CONNECT"))
+	}
+	if *maxStartups == 0 {
+		if v, err := strconv.Atoi(os.Getenv("MAXAPI_MAX_CONCURRENT_STARTUPS")); err == nil && v > 0 {
+			*maxStartups = v
+		}
+	}
+	initStartupSlots(*maxStartups)
+
 	if *versionFlag {
 		fmt.Printf("MaxAPI version %s\n", version)
 		os.Exit(0)
@@ -146,6 +163,17 @@ func init() {
 			Logger()
 	}
 
+	if err := initTokenHashing(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure token hashing")
+	}
+	if *hashTokenFlag != "" {
+		if tokenSalt == nil {
+			log.Fatal().Msg("-hashtoken needs MAXAPI_TOKEN_SALT")
+		}
+		fmt.Println(hashToken(*hashTokenFlag))
+		os.Exit(0)
+	}
+
 	if *adminToken == "" {
 		if v := os.Getenv("MAXAPI_ADMIN_TOKEN"); v != "" {
 			*adminToken = v
@@ -161,6 +189,14 @@ func init() {
 		}
 	}
 
+	if err := initAdminKeys(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure admin keys")
+	}
+	if err := initTrustedProxies(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure trusted proxies")
+	}
+	initAuthGuard()
+
 	// Check for global webhook in environment variable
 	if *globalWebhook == "" {
 		if v := os.Getenv("MAXAPI_GLOBAL_WEBHOOK"); v != "" {
@@ -171,10 +207,47 @@ func init() {
 		log.Info().Str("global_webhook", *globalWebhook).Msg("Global webhook configured from command line")
 	}
 
+	initResourceLimits()
+	initReloadableSettings()
+
+	if *configFile == "" {
+		*configFile = os.Getenv("MAXAPI_CONFIG")
+	}
+	if err := loadConfig(*configFile); err != nil {
+		log.Fatal().Err(err).Msg("Failed to load configuration")
+	}
+
+	initUserCache()
+	initMaintenance()
+	initWebhookQueue()
+	initWebhookOrdering()
+	initWarmup()
+	initMetrics()
+	initResponseEnvelope()
+	initBodyLimits()
+
+	if err := initMediaScanner(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure media scanner")
+	}
+
+	if err := initEmailAlerts(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure email alerts")
+	}
+
+	if err := initHistoryEncryption(); err != nil {
+		log.Fatal().Err(err).Msg("Failed to configure history encryption")
+	}
+
 	InitRabbitMQ()
+	InitNATS()
 }
 
 func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Warn().Err(err).Msg("It was not possible to load the .env file (it may not exist).")
+	}
+	configure()
+
 	ex, err := os.Executable()
 	if err != nil {
 		log.Fatal().Err(err).Msg("Failed to get executable path")
@@ -204,14 +277,39 @@ func main() {
 		os.Exit(1)
 	}
 
+	if err = rehashTokens(db); err != nil {
+		log.Fatal().Err(err).Msg("Failed to hash stored user tokens")
+	}
+
 	s := &server{
 		router: mux.NewRouter(),
 		db:     db,
 		exPath: exPath,
 	}
 	s.routes()
+	s.startHistoryWriter()
 
+	if *loadTestN > 0 {
+		report, err := s.runLoadTest(*loadTestN, *loadTestTime, *loadTestRate)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Load test failed")
+		}
+		out, _ := json.MarshalIndent(report, "", "  ")
+		fmt.Println(string(out))
+		return
+	}
+
+	s.encryptStoredHistory()
+	s.startConnectionLog()
 	s.connectOnStartup()
+	s.startDeferredDispatcher()
+	s.startScheduler()
+	s.startWebhookRetries()
+	s.startCampaigns()
+	s.startHeartbeats()
+	s.startChangefeed()
+	watchConfigReload()
+	initEventBuffers()
 
 	srv := &http.Server{
 		Addr:              *address + ":" + *port,
@@ -242,6 +340,11 @@ func main() {
 					log.Error().Err(err).Msg("Failed to stop server")
 					os.Exit(1)
 				}
+				s.closeConnectionLog()
+				if historyWriter != nil {
+					historyWriter.close()
+				}
+				closeNATS()
 
 				log.Info().Msg("Server Exited Properly")
 				os.Exit(0)
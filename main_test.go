@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog"
+
+	"maxapi/handlers/admin"
+)
+
+// TestMain configures the gateway like main does, but without loading .env, so
+// tests never pick up the database of a local installation
+func TestMain(m *testing.M) {
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+	flag.Parse()
+	configure()
+	os.Exit(m.Run())
+}
+
+// newTestServer returns a server on a new SQLite database in a temporary directory
+func newTestServer(tb testing.TB) *server {
+	tb.Helper()
+	for _, name := range []string{"DB_USER", "DB_PASSWORD", "DB_NAME", "DB_HOST", "DB_PORT"} {
+		tb.Setenv(name, "")
+	}
+	return newTestServerAt(tb, tb.TempDir())
+}
+
+// newTestServerAt returns a server on the database configured by the DB_*
+// variables, or on SQLite in exPath when they are not set
+func newTestServerAt(tb testing.TB, exPath string) *server {
+	tb.Helper()
+
+	db, err := InitializeDatabase(exPath)
+	if err != nil {
+		tb.Fatalf("initialize database: %v", err)
+	}
+	tb.Cleanup(func() { db.Close() })
+
+	if err := initializeSchema(db); err != nil {
+		tb.Fatalf("initialize schema: %v", err)
+	}
+
+	s := &server{
+		router: mux.NewRouter(),
+		db:     db,
+		exPath: exPath,
+	}
+	s.routes()
+	return s
+}
+
+// newTestUser creates a user and returns its ID and token
+func newTestUser(tb testing.TB, s *server, name string) (string, string) {
+	tb.Helper()
+	id, token, err := s.CreateUser(admin.AddUserBody{Name: name, Events: "All"})
+	if err != nil {
+		tb.Fatalf("create user: %v", err)
+	}
+	return id, token
+}
+
+// serve sends a request through the router of s from the client address remote
+func serve(s *server, method, path, remote string, header map[string]string, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = remote
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range header {
+		req.Header.Set(name, value)
+	}
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
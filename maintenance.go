@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// errCodeMaintenance is returned for sends rejected while maintenance mode is on
+	errCodeMaintenance = "MAINTENANCE"
+
+	defaultMaintenanceRetryAfter = 300 // seconds
+	defaultMaintenanceMessage    = "sending is paused for maintenance"
+)
+
+// maintenanceState is the maintenance mode of the gateway. While it is enabled,
+// sends are rejected and queued sends wait; MAX connections and event delivery continue.
+type maintenanceState struct {
+	Enabled    bool
+	Message    string
+	RetryAfter int
+	Since      int64
+}
+
+var maintenance = struct {
+	sync.RWMutex
+	state maintenanceState
+}{}
+
+// initMaintenance starts the gateway in maintenance mode when MAXAPI_MAINTENANCE is set,
+// so sends stay paused across a restart during a migration
+func initMaintenance() {
+	if enabled, _ := strconv.ParseBool(os.Getenv("MAXAPI_MAINTENANCE")); enabled {
+		setMaintenance(maintenanceState{Enabled: true})
+	}
+}
+
+// currentMaintenance returns the maintenance mode in effect
+func currentMaintenance() maintenanceState {
+	maintenance.RLock()
+	defer maintenance.RUnlock()
+	return maintenance.state
+}
+
+// inMaintenance reports whether sends are paused
+func inMaintenance() bool {
+	return currentMaintenance().Enabled
+}
+
+func setMaintenance(state maintenanceState) {
+	if state.Enabled {
+		if state.Message == "" {
+			state.Message = defaultMaintenanceMessage
+		}
+		if state.RetryAfter <= 0 {
+			state.RetryAfter = defaultMaintenanceRetryAfter
+		}
+		state.Since = time.Now().Unix()
+	}
+
+	maintenance.Lock()
+	maintenance.state = state
+	maintenance.Unlock()
+
+	log.Warn().Bool("enabled", state.Enabled).Str("message", state.Message).Msg("Maintenance mode changed")
+}
+
+// respondMaintenance rejects a send with 503 and a Retry-After header
+func (s *server) respondMaintenance(w http.ResponseWriter, r *http.Request, state maintenanceState) {
+	w.Header().Set("Retry-After", strconv.Itoa(state.RetryAfter))
+	s.Respond(w, r, http.StatusServiceUnavailable, map[string]interface{}{
+		"success":    false,
+		"error":      state.Message,
+		"code":       errCodeMaintenance,
+		"retryAfter": state.RetryAfter,
+	})
+}
+
+// GetMaintenance returns the maintenance mode
+// @Summary Get maintenance mode
+// @Description Reports whether sends are paused for maintenance
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} MaintenanceResponse
+// @Security AdminAuth
+// @Router /admin/maintenance [get]
+func (s *server) GetMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Respond(w, r, http.StatusOK, maintenanceResponse(currentMaintenance()))
+	}
+}
+
+// SetMaintenance enables maintenance mode
+// @Summary Enable maintenance mode
+// @Description Pauses sending: /chat/send/* requests are rejected with 503, code MAINTENANCE and a Retry-After header, and queued and campaign messages wait. MAX connections and event delivery continue. The mode is kept until it is disabled; set MAXAPI_MAINTENANCE=true to keep it across a restart.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param request body MaintenanceBody false "Message and Retry-After (optional)"
+// @Success 200 {object} MaintenanceResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/maintenance [post]
+func (s *server) SetMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var msg MaintenanceBody
+		if r.ContentLength != 0 {
+			if err := decodeJSON(r, &msg); err != nil {
+				s.RespondPayloadError(w, r, err)
+				return
+			}
+		}
+		if msg.RetryAfter < 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("retryAfter must not be negative"))
+			return
+		}
+
+		setMaintenance(maintenanceState{Enabled: true, Message: msg.Message, RetryAfter: msg.RetryAfter})
+		s.Respond(w, r, http.StatusOK, maintenanceResponse(currentMaintenance()))
+	}
+}
+
+// DeleteMaintenance disables maintenance mode
+// @Summary Disable maintenance mode
+// @Description Resumes sending; queued and campaign messages continue
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} MaintenanceResponse
+// @Security AdminAuth
+// @Router /admin/maintenance [delete]
+func (s *server) DeleteMaintenance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		setMaintenance(maintenanceState{})
+		s.Respond(w, r, http.StatusOK, maintenanceResponse(currentMaintenance()))
+	}
+}
+
+func maintenanceResponse(state maintenanceState) map[string]interface{} {
+	response := map[string]interface{}{
+		"success": true,
+		"enabled": state.Enabled,
+	}
+	if state.Enabled {
+		response["message"] = state.Message
+		response["retryAfter"] = state.RetryAfter
+		response["since"] = state.Since
+	}
+	return response
+}
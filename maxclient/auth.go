@@ -12,14 +12,19 @@ func ValidatePhone(phone string) bool {
 	return phoneRegex.MatchString(phone)
 }
 
+// DefaultUserAgent returns the user agent sent when none is given
+func DefaultUserAgent() *UserAgent {
+	return &UserAgent{
+		DeviceType: DeviceTypeWeb,
+		Locale:     "ru",
+		AppVersion: "25.10.13",
+	}
+}
+
 // SessionInit initializes a session with the MAX server
 func (c *Client) SessionInit(userAgent *UserAgent) error {
 	if userAgent == nil {
-		userAgent = &UserAgent{
-			DeviceType: DeviceTypeWeb,
-			Locale:     "ru",
-			AppVersion: "25.10.13",
-		}
+		userAgent = DefaultUserAgent()
 	}
 
 	payload := map[string]interface{}{
@@ -172,6 +177,8 @@ func (c *Client) Login(authToken string) (map[string]interface{}, error) {
 		c.Logger.Info().Int("count", len(chatsRaw)).Msg("Got chats from login")
 	}
 
+	c.setServerConfig(resp.Payload)
+
 	// Parse profile to set c.Me and c.MaxUserID
 	if profile, ok := resp.Payload["profile"].(map[string]interface{}); ok {
 		if contact, ok := profile["contact"].(map[string]interface{}); ok {
@@ -228,6 +235,8 @@ func (c *Client) Sync() (map[string]interface{}, error) {
 		c.Logger.Info().Int("count", len(chatsRaw)).Msg("Got chats from sync")
 	}
 
+	c.setServerConfig(resp.Payload)
+
 	// Extract participant IDs from chats and fetch their full contact data
 	contactIDs := c.extractParticipantIDsFromPayload(resp.Payload)
 	if len(contactIDs) > 0 {
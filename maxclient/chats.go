@@ -2,33 +2,52 @@ package maxclient
 
 import (
 	"encoding/json"
+	"strings"
 	"time"
 )
 
-// GetChatsList gets list of chats with marker for pagination
-func (c *Client) GetChatsList(marker float64) ([]map[string]interface{}, error) {
+// GetChatsList gets a page of chats, dialogs and channels ordered by their
+// last event, newest first. The marker is a time in milliseconds; 0 starts
+// from now. The returned marker fetches the next page and is 0 after the last.
+func (c *Client) GetChatsList(marker int64) ([]map[string]interface{}, int64, error) {
+	if marker == 0 {
+		marker = time.Now().UnixMilli()
+	}
+
 	payload := map[string]interface{}{
 		"marker": marker,
 	}
 
-	c.Logger.Info().Float64("marker", marker).Msg("Fetching chats list")
+	c.Logger.Info().Int64("marker", marker).Msg("Fetching chats list")
 
 	resp, err := c.sendAndWait(OpChatsList, payload)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	var chats []map[string]interface{}
+	var oldest int64
 	if chatsRaw, ok := resp.Payload["chats"].([]interface{}); ok {
 		for _, chatRaw := range chatsRaw {
 			if chat, ok := chatRaw.(map[string]interface{}); ok {
 				chats = append(chats, chat)
+				if t, ok := chat["lastEventTime"].(float64); ok && (oldest == 0 || int64(t) < oldest) {
+					oldest = int64(t)
+				}
 			}
 		}
 	}
 
+	// Without a marker from the server, continue before the oldest chat
+	var next int64
+	if m, ok := resp.Payload["marker"].(float64); ok {
+		next = int64(m)
+	} else if oldest > 0 && oldest < marker {
+		next = oldest
+	}
+
 	c.Logger.Info().Int("count", len(chats)).Msg("Fetched chats")
-	return chats, nil
+	return chats, next, nil
 }
 
 // GetChatHistory gets message history for a chat
@@ -77,6 +96,67 @@ func (c *Client) GetChatHistory(chatID int64, fromTime int64, forward int, backw
 	return messages, nil
 }
 
+// GetChatMedia gets messages of a chat with attachments of one type, newest
+// first. The marker is the ID of the message to continue before; empty starts
+// from the newest. The returned marker is empty after the last page.
+func (c *Client) GetChatMedia(chatID int64, attachType AttachType, marker MessageID, count int) ([]Message, MessageID, error) {
+	if count <= 0 {
+		count = 50
+	}
+
+	payload := map[string]interface{}{
+		"chatId":      chatID,
+		"attachTypes": []AttachType{attachType},
+		"forward":     0,
+		"backward":    count,
+	}
+	if !marker.IsZero() {
+		messageID, err := marker.Int64()
+		if err != nil {
+			return nil, "", err
+		}
+		payload["messageId"] = messageID
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Str("type", string(attachType)).Int("count", count).Msg("Fetching chat media")
+
+	resp, err := c.sendAndWait(OpChatMedia, payload)
+	if err != nil {
+		return nil, "", err
+	}
+
+	messages := []Message{}
+	if msgsRaw, ok := resp.Payload["messages"].([]interface{}); ok {
+		for _, msgRaw := range msgsRaw {
+			msgMap, ok := msgRaw.(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			msgBytes, _ := json.Marshal(msgMap)
+			var msg Message
+			if err := json.Unmarshal(msgBytes, &msg); err == nil && msg.ID != marker.String() {
+				messages = append(messages, msg)
+			}
+		}
+	}
+
+	// A full page may be followed by older media
+	var next MessageID
+	if len(messages) >= count {
+		oldest := messages[0]
+		for _, msg := range messages[1:] {
+			if msg.Time < oldest.Time {
+				oldest = msg
+			}
+		}
+		next = MessageID(oldest.ID)
+	}
+
+	c.Logger.Info().Int("count", len(messages)).Msg("Fetched chat media")
+	return messages, next, nil
+}
+
 // GetChatInfo gets information about chats by IDs
 func (c *Client) GetChatInfo(chatIDs []int64) ([]Chat, error) {
 	payload := map[string]interface{}{
@@ -124,6 +204,60 @@ func (c *Client) GetChat(chatID int64) (*Chat, error) {
 	return &chats[0], nil
 }
 
+// CreateChatOptions contains options for creating a group chat
+type CreateChatOptions struct {
+	Title          string
+	Description    string
+	ParticipantIDs []int64
+	// Access is AccessTypePublic or AccessTypePrivate, private when empty
+	Access AccessType
+	// PhotoToken is the token of an icon uploaded with UploadPhoto
+	PhotoToken string
+	Notify     bool
+}
+
+// CreateChat creates a group chat with OpChatCreate, which unlike
+// CreateGroup also sets the description, access and icon
+func (c *Client) CreateChat(opts CreateChatOptions) (*Chat, error) {
+	if opts.Title == "" {
+		return nil, NewError("invalid_name", "Group name is required", "Validation Error")
+	}
+
+	payload := map[string]interface{}{
+		"cid":      c.nextCID(),
+		"chatType": string(ChatTypeChat),
+		"title":    opts.Title,
+		"userIds":  opts.ParticipantIDs,
+		"notify":   opts.Notify,
+	}
+	if opts.Description != "" {
+		payload["description"] = opts.Description
+	}
+	if opts.Access != "" {
+		payload["access"] = string(opts.Access)
+	}
+	if opts.PhotoToken != "" {
+		payload["photoToken"] = opts.PhotoToken
+	}
+
+	c.Logger.Info().Str("name", opts.Title).Ints64("participants", opts.ParticipantIDs).Str("access", string(opts.Access)).Msg("Creating chat")
+
+	resp, err := c.sendAndWait(OpChatCreate, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if chatRaw, ok := resp.Payload["chat"].(map[string]interface{}); ok {
+		chatBytes, _ := json.Marshal(chatRaw)
+		var chat Chat
+		if err := json.Unmarshal(chatBytes, &chat); err == nil {
+			return &chat, nil
+		}
+	}
+
+	return nil, ErrInvalidResponse
+}
+
 // CreateGroup creates a new group chat
 func (c *Client) CreateGroup(name string, participantIDs []int64, notify bool) (*Chat, *Message, error) {
 	if name == "" {
@@ -132,7 +266,7 @@ func (c *Client) CreateGroup(name string, participantIDs []int64, notify bool) (
 
 	// In MAX, groups are created by sending a special message with CONTROL attachment
 	message := map[string]interface{}{
-		"cid": time.Now().UnixMilli(),
+		"cid": c.nextCID(),
 		"attaches": []map[string]interface{}{
 			{
 				"_type":    string(AttachTypeControl),
@@ -174,16 +308,43 @@ func (c *Client) CreateGroup(name string, participantIDs []int64, notify bool) (
 	return chat, msg, nil
 }
 
-// JoinGroup joins a group by invite link
-func (c *Client) JoinGroup(link string) (*Chat, error) {
-	// Process link to get the join path
-	joinPath := link
+// joinLinkPath returns the join/... path of an invite link, which is what
+// MAX expects instead of the full URL
+func joinLinkPath(link string) string {
 	if idx := findSubstring(link, "join/"); idx != -1 {
-		joinPath = link[idx:]
+		return link[idx:]
+	}
+	return link
+}
+
+// CheckChatLink returns the chat an invite link leads to without joining it
+func (c *Client) CheckChatLink(link string) (*Chat, error) {
+	payload := map[string]interface{}{
+		"link": joinLinkPath(link),
+	}
+
+	c.Logger.Info().Str("link", link).Msg("Checking invite link")
+
+	resp, err := c.sendAndWait(OpChatCheckLink, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if chatRaw, ok := resp.Payload["chat"].(map[string]interface{}); ok {
+		chatBytes, _ := json.Marshal(chatRaw)
+		var chat Chat
+		if err := json.Unmarshal(chatBytes, &chat); err == nil {
+			return &chat, nil
+		}
 	}
 
+	return nil, ErrChatNotFound
+}
+
+// JoinGroup joins a group by invite link
+func (c *Client) JoinGroup(link string) (*Chat, error) {
 	payload := map[string]interface{}{
-		"link": joinPath,
+		"link": joinLinkPath(link),
 	}
 
 	c.Logger.Info().Str("link", link).Msg("Joining group")
@@ -204,6 +365,102 @@ func (c *Client) JoinGroup(link string) (*Chat, error) {
 	return nil, ErrChatNotFound
 }
 
+// LinkInfo is what a public link points to: a chat, a channel or a user
+type LinkInfo struct {
+	Link string `json:"link"`
+	Chat *Chat  `json:"chat,omitempty"`
+	User *User  `json:"user,omitempty"`
+}
+
+// NormalizePublicLink turns @name, name or max.ru/name into https://max.ru/name
+func NormalizePublicLink(link string) string {
+	link = strings.TrimSpace(link)
+	link = strings.TrimPrefix(link, "@")
+	link = strings.TrimPrefix(strings.TrimPrefix(link, "https://"), "http://")
+	link = strings.TrimPrefix(strings.TrimPrefix(link, "www."), "max.ru/")
+	return "https://max.ru/" + strings.TrimPrefix(link, "/")
+}
+
+// ResolveLink resolves a public username or max.ru link
+func (c *Client) ResolveLink(link string) (*LinkInfo, error) {
+	link = NormalizePublicLink(link)
+
+	payload := map[string]interface{}{
+		"link": link,
+	}
+
+	c.Logger.Info().Str("link", link).Msg("Resolving link")
+
+	resp, err := c.sendAndWait(OpLinkInfo, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	info := &LinkInfo{Link: link}
+	if chatRaw, ok := resp.Payload["chat"].(map[string]interface{}); ok {
+		chatBytes, _ := json.Marshal(chatRaw)
+		var chat Chat
+		if err := json.Unmarshal(chatBytes, &chat); err == nil {
+			info.Chat = &chat
+		}
+	}
+	for _, key := range []string{"contact", "user"} {
+		if userRaw, ok := resp.Payload[key].(map[string]interface{}); ok && info.User == nil {
+			userBytes, _ := json.Marshal(userRaw)
+			var user User
+			if err := json.Unmarshal(userBytes, &user); err == nil {
+				info.User = &user
+			}
+		}
+	}
+
+	if info.Chat == nil && info.User == nil {
+		return nil, ErrChatNotFound
+	}
+	return info, nil
+}
+
+// SearchPublic searches public channels and groups by name
+func (c *Client) SearchPublic(query string) ([]Chat, error) {
+	payload := map[string]interface{}{
+		"query": query,
+	}
+
+	c.Logger.Info().Str("query", query).Msg("Searching public chats")
+
+	resp, err := c.sendAndWait(OpPublicSearch, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results come either as plain chats or wrapped in {"chat": {...}}
+	itemsRaw, ok := resp.Payload["result"].([]interface{})
+	if !ok {
+		itemsRaw, _ = resp.Payload["chats"].([]interface{})
+	}
+
+	chats := []Chat{}
+	for _, itemRaw := range itemsRaw {
+		item, ok := itemRaw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if chatRaw, ok := item["chat"].(map[string]interface{}); ok {
+			item = chatRaw
+		}
+
+		chatBytes, _ := json.Marshal(item)
+		var chat Chat
+		if err := json.Unmarshal(chatBytes, &chat); err != nil || chat.ID == 0 {
+			continue
+		}
+		chats = append(chats, chat)
+	}
+
+	c.Logger.Info().Int("count", len(chats)).Msg("Found public chats")
+	return chats, nil
+}
+
 // LeaveChat leaves a chat/group
 func (c *Client) LeaveChat(chatID int64) error {
 	payload := map[string]interface{}{
@@ -248,6 +505,102 @@ func (c *Client) UpdateGroupMembers(chatID int64, userIDs []int64, operation str
 	return nil, nil
 }
 
+// UpdateChatAdmins promotes members to administrators ("add") or demotes
+// them ("remove"). Permissions is the MAX permission bitmask of promoted
+// admins; 0 leaves the MAX default.
+func (c *Client) UpdateChatAdmins(chatID int64, userIDs []int64, operation string, permissions int64) (*Chat, error) {
+	payload := map[string]interface{}{
+		"chatId":    chatID,
+		"userIds":   userIDs,
+		"type":      "ADMIN",
+		"operation": operation, // "add" or "remove"
+	}
+
+	if operation == "add" && permissions != 0 {
+		payload["permissions"] = permissions
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Str("operation", operation).Ints64("userIds", userIDs).Msg("Updating chat admins")
+
+	resp, err := c.sendAndWait(OpChatMembersUpdate, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if chatRaw, ok := resp.Payload["chat"].(map[string]interface{}); ok {
+		chatBytes, _ := json.Marshal(chatRaw)
+		var chat Chat
+		if err := json.Unmarshal(chatBytes, &chat); err == nil {
+			return &chat, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// GetJoinRequests lists the pending requests to join a chat that needs
+// approval, count at a time. The returned marker is 0 after the last page.
+func (c *Client) GetJoinRequests(chatID int64, marker int64, count int) ([]JoinRequest, int64, error) {
+	payload := map[string]interface{}{
+		"chatId": chatID,
+		"type":   "JOIN_REQUEST",
+		"count":  count,
+	}
+	if marker > 0 {
+		payload["marker"] = marker
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Msg("Getting join requests")
+
+	resp, err := c.sendAndWait(OpChatMembers, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	requests := []JoinRequest{}
+	var next int64
+
+	requestsRaw, ok := resp.Payload["requests"].([]interface{})
+	if !ok {
+		requestsRaw, _ = resp.Payload["members"].([]interface{})
+	}
+	for _, requestRaw := range requestsRaw {
+		requestBytes, _ := json.Marshal(requestRaw)
+		var request JoinRequest
+		if err := json.Unmarshal(requestBytes, &request); err != nil {
+			continue
+		}
+		if request.UserID == 0 && request.Contact != nil {
+			request.UserID = request.Contact.ID
+		}
+		if request.UserID != 0 {
+			requests = append(requests, request)
+		}
+	}
+
+	if m, ok := resp.Payload["marker"].(float64); ok {
+		next = int64(m)
+	}
+
+	return requests, next, nil
+}
+
+// DecideJoinRequests approves ("add") or declines ("remove") pending
+// requests to join a chat
+func (c *Client) DecideJoinRequests(chatID int64, userIDs []int64, operation string) error {
+	payload := map[string]interface{}{
+		"chatId":    chatID,
+		"userIds":   userIDs,
+		"type":      "JOIN_REQUEST",
+		"operation": operation, // "add" or "remove"
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Str("operation", operation).Ints64("userIds", userIDs).Msg("Deciding join requests")
+
+	_, err := c.sendAndWait(OpChatMembersUpdate, payload)
+	return err
+}
+
 // AddGroupMembers adds members to a group
 func (c *Client) AddGroupMembers(chatID int64, userIDs []int64, showHistory bool) (*Chat, error) {
 	return c.UpdateGroupMembers(chatID, userIDs, "add", showHistory, 0)
@@ -289,6 +642,40 @@ func (c *Client) UpdateChatProfile(chatID int64, name string, description string
 	return nil, nil
 }
 
+// UpdateChatPhoto uploads a photo and sets it as the chat icon
+func (c *Client) UpdateChatPhoto(chatID int64, data []byte, filename string) (*Chat, error) {
+	attachment, err := c.UploadPhoto(data, filename)
+	if err != nil {
+		return nil, err
+	}
+	return c.SetChatPhoto(chatID, attachment.PhotoToken)
+}
+
+// SetChatPhoto sets a photo uploaded with UploadPhoto as the chat icon
+func (c *Client) SetChatPhoto(chatID int64, photoToken string) (*Chat, error) {
+	payload := map[string]interface{}{
+		"chatId":     chatID,
+		"photoToken": photoToken,
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Msg("Updating chat photo")
+
+	resp, err := c.sendAndWait(OpChatUpdate, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if chatRaw, ok := resp.Payload["chat"].(map[string]interface{}); ok {
+		chatBytes, _ := json.Marshal(chatRaw)
+		var chat Chat
+		if err := json.Unmarshal(chatBytes, &chat); err == nil {
+			return &chat, nil
+		}
+	}
+
+	return nil, nil
+}
+
 // GetChatMembers gets members of a chat
 func (c *Client) GetChatMembers(chatID int64, marker int64, count int) ([]Member, *int64, error) {
 	if count == 0 {
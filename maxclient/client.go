@@ -37,6 +37,9 @@ type Client struct {
 	conn   *websocket.Conn
 	connMu sync.RWMutex
 
+	// Endpoint is the WebSocket URL to connect to (WebSocketURI when empty)
+	Endpoint string
+
 	// Authentication
 	DeviceID  string
 	AuthToken string
@@ -45,6 +48,7 @@ type Client struct {
 
 	// State
 	seq           int32
+	lastCID       atomic.Int64
 	isConnected   bool
 	isConnectedMu sync.RWMutex
 
@@ -60,6 +64,15 @@ type Client struct {
 	users   map[int64]*User
 	usersMu sync.RWMutex
 
+	// Limits reported by the server
+	serverConfig  map[string]interface{}
+	lastRateLimit *RateLimit
+	limitsMu      sync.RWMutex
+
+	// Chat mutes reported by the server or set through MuteChat
+	chatMutes map[int64]int64
+	mutesMu   sync.RWMutex
+
 	// Event handling
 	eventHandler func(Event)
 
@@ -136,7 +149,12 @@ func (c *Client) Connect() error {
 	default:
 	}
 
-	c.Logger.Info().Str("uri", WebSocketURI).Msg("Connecting to MAX WebSocket")
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = WebSocketURI
+	}
+
+	c.Logger.Info().Str("uri", endpoint).Msg("Connecting to MAX WebSocket")
 
 	dialer := websocket.Dialer{
 		HandshakeTimeout: DefaultTimeout,
@@ -146,7 +164,7 @@ func (c *Client) Connect() error {
 	header.Set("Origin", WebSocketOrigin)
 	header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
 
-	conn, _, err := dialer.Dial(WebSocketURI, header)
+	conn, _, err := dialer.Dial(endpoint, header)
 	if err != nil {
 		c.Logger.Error().Err(err).Msg("Failed to connect to WebSocket")
 		return err
@@ -204,6 +222,19 @@ func (c *Client) nextSeq() int {
 	return int(atomic.AddInt32(&c.seq, 1))
 }
 
+// nextCID returns a client message ID. CIDs are send times in milliseconds,
+// bumped when several messages go out within the same millisecond, since
+// MAX treats messages with the same CID as one.
+func (c *Client) nextCID() int64 {
+	for {
+		last := c.lastCID.Load()
+		cid := max(time.Now().UnixMilli(), last+1)
+		if c.lastCID.CompareAndSwap(last, cid) {
+			return cid
+		}
+	}
+}
+
 // sendAndWait sends a message and waits for response
 func (c *Client) sendAndWait(opcode Opcode, payload interface{}) (*Response, error) {
 	return c.sendAndWaitWithTimeout(opcode, payload, DefaultTimeout)
@@ -283,6 +314,12 @@ func (c *Client) sendAndWaitWithTimeout(opcode Opcode, payload interface{}, time
 				Int("seq", resp.Seq).
 				Interface("payload", resp.Payload).
 				Msg("Server returned error")
+			if e, ok := err.(*Error); ok && IsRateLimitError(e) {
+				c.recordRateLimit(resp.Opcode, e)
+			}
+			if e, ok := err.(*Error); ok && IsRestrictionError(e) {
+				c.reportRestriction(resp.Opcode, e)
+			}
 			return resp, err
 		}
 
@@ -324,58 +361,71 @@ func (c *Client) receiveLoop() {
 			return
 		}
 
-		var resp Response
-		if err := json.Unmarshal(message, &resp); err != nil {
+		// Only the envelope is decoded here. Notifications keep their payload as raw
+		// JSON, so events that are forwarded unchanged are never decoded into maps.
+		var frame BaseMessage
+		if err := json.Unmarshal(message, &frame); err != nil {
 			c.Logger.Warn().Err(err).Msg("Failed to parse message")
 			continue
 		}
 
 		c.Logger.Debug().
-			Int("seq", resp.Seq).
-			Int("opcode", resp.Opcode).
+			Int("seq", frame.Seq).
+			Int("opcode", frame.Opcode).
 			Msg("Received message")
 
 		// Check if this is a response to a pending request
 		c.pendingMu.RLock()
-		respCh, ok := c.pending[resp.Seq]
+		respCh, ok := c.pending[frame.Seq]
 		c.pendingMu.RUnlock()
 
 		if ok {
+			resp := frame.response()
 			select {
-			case respCh <- &resp:
+			case respCh <- resp:
 			default:
 			}
 		} else {
 			// Handle notification
-			c.handleNotification(&resp)
+			c.handleNotification(&frame)
 		}
 	}
 }
 
 // handleNotification handles server-initiated notifications
-func (c *Client) handleNotification(resp *Response) {
-	opcode := Opcode(resp.Opcode)
+func (c *Client) handleNotification(frame *BaseMessage) {
+	opcode := Opcode(frame.Opcode)
 
 	// Handle file upload notifications
 	if opcode == OpNotifAttach {
-		c.handleFileAttachNotification(resp)
+		c.handleFileAttachNotification(frame.response())
 		return
 	}
 
+	// Settings changed on another device
+	if opcode == OpNotifConfig {
+		var payload map[string]interface{}
+		if json.Unmarshal(frame.Payload, &payload) == nil {
+			if config, ok := payload["config"].(map[string]interface{}); ok {
+				c.setChatMutes(config)
+			}
+		}
+	}
+
 	// Build event
 	event := Event{
-		Opcode:  opcode,
-		Payload: resp.Payload,
+		Opcode: opcode,
+		Raw:    frame.Payload,
 	}
 
 	// Determine event type
 	switch opcode {
 	case OpNotifMessage:
-		event.Type = c.determineMessageEventType(resp.Payload)
+		event.Type = c.determineMessageEventType(frame.Payload)
 	case OpNotifMark:
 		event.Type = "ReadReceipt"
 	case OpNotifChat:
-		event.Type = "ChatUpdate"
+		event.Type = c.determineChatEventType(frame.Payload)
 	case OpNotifTyping:
 		event.Type = "Typing"
 	case OpNotifMsgReactionsChanged:
@@ -390,6 +440,14 @@ func (c *Client) handleNotification(resp *Response) {
 		event.Type = "LoggedOut"
 	default:
 		event.Type = "Unknown"
+		// Restriction notices arrive as error payloads on their own opcodes
+		var payload map[string]interface{}
+		if json.Unmarshal(frame.Payload, &payload) == nil {
+			if e, ok := ParseError(payload).(*Error); ok && IsRestrictionError(e) {
+				c.reportRestriction(frame.Opcode, e)
+				return
+			}
+		}
 	}
 
 	if c.eventHandler != nil {
@@ -397,15 +455,51 @@ func (c *Client) handleNotification(resp *Response) {
 	}
 }
 
+// reportRestriction emits an AccountRestricted event for a restriction error
+func (c *Client) reportRestriction(opcode int, err *Error) {
+	c.Logger.Warn().Str("code", err.Code).Str("message", err.Message).Int("opcode", opcode).Msg("Account restricted by MAX")
+	if c.eventHandler == nil {
+		return
+	}
+	raw, _ := json.Marshal(AccountRestrictedEvent{
+		Code:    err.Code,
+		Message: err.Message,
+		Title:   err.Title,
+		Opcode:  opcode,
+	})
+	c.eventHandler(Event{
+		Opcode: Opcode(opcode),
+		Type:   EventTypeAccountRestricted,
+		Raw:    raw,
+	})
+}
+
+// determineChatEventType tells join requests apart from other chat notifications
+func (c *Client) determineChatEventType(payload json.RawMessage) string {
+	var probe struct {
+		JoinRequest *JoinRequest `json:"joinRequest"`
+	}
+	if json.Unmarshal(payload, &probe) == nil && probe.JoinRequest != nil {
+		return EventTypeJoinRequest
+	}
+	return EventTypeChatUpdate
+}
+
 // determineMessageEventType determines the type of message event
-func (c *Client) determineMessageEventType(payload map[string]interface{}) string {
-	message, ok := payload["message"].(map[string]interface{})
-	if !ok {
-		message = payload
+func (c *Client) determineMessageEventType(payload json.RawMessage) string {
+	var probe struct {
+		Status  MessageStatus `json:"status"`
+		Message *struct {
+			Status MessageStatus `json:"status"`
+		} `json:"message"`
 	}
+	json.Unmarshal(payload, &probe)
 
-	status, _ := message["status"].(string)
-	switch MessageStatus(status) {
+	status := probe.Status
+	if probe.Message != nil {
+		status = probe.Message.Status
+	}
+	switch status {
 	case MessageStatusEdited:
 		return "MessageEdit"
 	case MessageStatusRemoved:
@@ -443,6 +537,18 @@ func (c *Client) handleFileAttachNotification(resp *Response) {
 			c.Logger.Debug().Int64("videoId", int64(videoID)).Msg("Video upload completed")
 		}
 	}
+
+	// Check for audioId
+	if audioID, ok := resp.Payload["audioId"].(float64); ok {
+		if ch, exists := c.fileWaiters[int64(audioID)]; exists {
+			select {
+			case ch <- resp:
+			default:
+			}
+			delete(c.fileWaiters, int64(audioID))
+			c.Logger.Debug().Int64("audioId", int64(audioID)).Msg("Audio upload completed")
+		}
+	}
 }
 
 // registerFileWaiter registers a waiter for file upload completion
@@ -41,6 +41,8 @@ var (
 	ErrChatNotFound         = NewError("chat_not_found", "Chat not found", "Chat Error")
 	ErrUserNotFound         = NewError("user_not_found", "User not found", "User Error")
 	ErrMessageNotFound      = NewError("message_not_found", "Message not found", "Message Error")
+	ErrInvalidMessageID     = NewError("invalid_message_id", "Message ID must be a numeric string", "Validation Error")
+	ErrNoLinkPreview        = NewError("no_link_preview", "No preview available for link", "Link Error")
 )
 
 // Auth error codes that indicate token is expired/invalid
@@ -51,6 +53,23 @@ var authErrorCodes = map[string]bool{
 	"auth.expired":  true, // Auth expired
 }
 
+// Error codes returned when requests are throttled
+var rateLimitCodes = map[string]bool{
+	"too.many.requests": true,
+	"limit.violate":     true,
+	"flood":             true,
+}
+
+// Error codes returned when MAX restricts or blocks the account
+var restrictionCodes = map[string]bool{
+	"account.blocked":    true,
+	"account.banned":     true,
+	"account.frozen":     true,
+	"account.restricted": true,
+	"account.suspended":  true,
+	"spam.restricted":    true,
+}
+
 // ParseError parses an error from response payload
 func ParseError(payload map[string]interface{}) error {
 	if payload == nil {
@@ -90,3 +109,18 @@ func IsAuthError(err error) bool {
 	return false
 }
 
+// IsRateLimitError checks if the error reports that requests are throttled
+func IsRateLimitError(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return rateLimitCodes[e.Code]
+	}
+	return false
+}
+
+// IsRestrictionError checks if the error reports that the account is restricted or blocked
+func IsRestrictionError(err error) bool {
+	if e, ok := err.(*Error); ok {
+		return restrictionCodes[e.Code]
+	}
+	return false
+}
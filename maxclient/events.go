@@ -6,19 +6,21 @@ import (
 
 // EventType constants for webhook events
 const (
-	EventTypeMessage        = "Message"
-	EventTypeMessageEdit    = "MessageEdit"
-	EventTypeMessageDelete  = "MessageDelete"
-	EventTypeReadReceipt    = "ReadReceipt"
-	EventTypeConnected      = "Connected"
-	EventTypeDisconnected   = "Disconnected"
-	EventTypeAuthCodeSent   = "AuthCodeSent"
-	EventTypeChatUpdate     = "ChatUpdate"
-	EventTypeTyping         = "Typing"
-	EventTypeReactionChange = "ReactionChange"
-	EventTypeContactUpdate  = "ContactUpdate"
-	EventTypePresenceUpdate = "PresenceUpdate"
-	EventTypeFileReady      = "FileReady"
+	EventTypeMessage           = "Message"
+	EventTypeMessageEdit       = "MessageEdit"
+	EventTypeMessageDelete     = "MessageDelete"
+	EventTypeReadReceipt       = "ReadReceipt"
+	EventTypeConnected         = "Connected"
+	EventTypeDisconnected      = "Disconnected"
+	EventTypeAuthCodeSent      = "AuthCodeSent"
+	EventTypeChatUpdate        = "ChatUpdate"
+	EventTypeTyping            = "Typing"
+	EventTypeReactionChange    = "ReactionChange"
+	EventTypeContactUpdate     = "ContactUpdate"
+	EventTypePresenceUpdate    = "PresenceUpdate"
+	EventTypeFileReady         = "FileReady"
+	EventTypeAccountRestricted = "AccountRestricted"
+	EventTypeJoinRequest       = "JoinRequest"
 )
 
 // MessageEvent represents a message event
@@ -39,6 +41,12 @@ type ChatUpdateEvent struct {
 	Chat *Chat `json:"chat"`
 }
 
+// JoinRequestEvent represents a request to join a chat that needs approval
+type JoinRequestEvent struct {
+	ChatID      int64        `json:"chatId"`
+	JoinRequest *JoinRequest `json:"joinRequest"`
+}
+
 // TypingEvent represents a typing indicator event
 type TypingEvent struct {
 	ChatID int64 `json:"chatId"`
@@ -71,6 +79,14 @@ type FileReadyEvent struct {
 	VideoID int64 `json:"videoId,omitempty"`
 }
 
+// AccountRestrictedEvent reports that MAX restricted or blocked the account
+type AccountRestrictedEvent struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Title   string `json:"title,omitempty"`
+	Opcode  int    `json:"opcode"`
+}
+
 // ParseMessageEvent parses a message event from payload
 func ParseMessageEvent(payload map[string]interface{}) (*MessageEvent, error) {
 	event := &MessageEvent{}
@@ -102,6 +118,30 @@ func ParseMessageEvent(payload map[string]interface{}) (*MessageEvent, error) {
 	return event, nil
 }
 
+// ParseMessageEventJSON parses a message event from a raw payload. Unlike
+// ParseMessageEvent it decodes straight into the typed structs, without an
+// intermediate map.
+func ParseMessageEventJSON(payload json.RawMessage) (*MessageEvent, error) {
+	event := &MessageEvent{}
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+
+	// Some notifications carry the message fields at the top level
+	if event.Message == nil {
+		var message Message
+		if err := json.Unmarshal(payload, &message); err != nil {
+			return nil, err
+		}
+		event.Message = &message
+	}
+
+	if event.Message.ChatID == 0 {
+		event.Message.ChatID = event.ChatID
+	}
+	return event, nil
+}
+
 // ParseReadReceiptEvent parses a read receipt event from payload
 func ParseReadReceiptEvent(payload map[string]interface{}) (*ReadReceiptEvent, error) {
 	event := &ReadReceiptEvent{}
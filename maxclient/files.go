@@ -2,6 +2,8 @@ package maxclient
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -91,6 +93,16 @@ func (c *Client) UploadPhoto(data []byte, filename string) (*Attachment, error)
 
 // UploadFile uploads a file and returns the attachment for sending
 func (c *Client) UploadFile(data []byte, filename string) (*Attachment, error) {
+	return c.UploadFileStream(bytes.NewReader(data), int64(len(data)), filename)
+}
+
+// UploadFileStream uploads size bytes read from r as a file, without buffering
+// the content in memory, and returns the attachment for sending
+func (c *Client) UploadFileStream(r io.Reader, size int64, filename string) (*Attachment, error) {
+	if size <= 0 {
+		return nil, NewError("empty_upload", "Upload size must be positive", "Upload Error")
+	}
+	
 	// Request upload URL
 	payload := map[string]interface{}{
 		"count": 1,
@@ -125,14 +137,11 @@ func (c *Client) UploadFile(data []byte, filename string) (*Attachment, error) {
 	defer c.unregisterFileWaiter(int64(fileID))
 	
 	// Upload file via HTTP POST
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	req, err := newUploadRequest(url, r, size, filename)
 	if err != nil {
 		return nil, err
 	}
 	
-	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(filename)))
-	req.Header.Set("Content-Range", fmt.Sprintf("0-%d/%d", len(data)-1, len(data)))
-	
 	client := &http.Client{Timeout: DefaultTimeout}
 	httpResp, err := client.Do(req)
 	if err != nil {
@@ -156,12 +165,22 @@ func (c *Client) UploadFile(data []byte, filename string) (*Attachment, error) {
 		Type:   AttachTypeFile,
 		FileID: int64(fileID),
 		Name:   filename,
-		Size:   int64(len(data)),
+		Size:   size,
 	}, nil
 }
 
 // UploadVideo uploads a video and returns the attachment for sending
 func (c *Client) UploadVideo(data []byte, filename string) (*Attachment, error) {
+	return c.UploadVideoStream(bytes.NewReader(data), int64(len(data)), filename)
+}
+
+// UploadVideoStream uploads size bytes read from r as a video, without buffering
+// the content in memory, and returns the attachment for sending
+func (c *Client) UploadVideoStream(r io.Reader, size int64, filename string) (*Attachment, error) {
+	if size <= 0 {
+		return nil, NewError("empty_upload", "Upload size must be positive", "Upload Error")
+	}
+	
 	// Request upload URL
 	payload := map[string]interface{}{
 		"count": 1,
@@ -197,14 +216,11 @@ func (c *Client) UploadVideo(data []byte, filename string) (*Attachment, error)
 	defer c.unregisterFileWaiter(int64(videoID))
 	
 	// Upload video via HTTP POST
-	req, err := http.NewRequest("POST", url, bytes.NewReader(data))
+	req, err := newUploadRequest(url, r, size, filename)
 	if err != nil {
 		return nil, err
 	}
 	
-	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(filename)))
-	req.Header.Set("Content-Range", fmt.Sprintf("0-%d/%d", len(data)-1, len(data)))
-	
 	client := &http.Client{Timeout: 120 * time.Second} // Longer timeout for videos
 	httpResp, err := client.Do(req)
 	if err != nil {
@@ -231,12 +247,113 @@ func (c *Client) UploadVideo(data []byte, filename string) (*Attachment, error)
 	}, nil
 }
 
-// UploadAudio uploads an audio file (treated as FILE type in MAX)
+// newUploadRequest builds the POST of size bytes from r to a file or video upload URL.
+// The length is set explicitly so the body is streamed instead of chunked.
+func newUploadRequest(url string, r io.Reader, size int64, filename string) (*http.Request, error) {
+	req, err := http.NewRequest("POST", url, io.LimitReader(r, size))
+	if err != nil {
+		return nil, err
+	}
+	
+	req.ContentLength = size
+	req.Header.Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filepath.Base(filename)))
+	req.Header.Set("Content-Range", fmt.Sprintf("0-%d/%d", size-1, size))
+	
+	return req, nil
+}
+
+// UploadAudio uploads an audio file (treated as FILE type in MAX). Use
+// UploadVoice for audio shown as a voice message.
 func (c *Client) UploadAudio(data []byte, filename string) (*Attachment, error) {
 	// Audio is uploaded as file in MAX
 	return c.UploadFile(data, filename)
 }
 
+// VoiceOptions describes a voice message
+type VoiceOptions struct {
+	Duration   int    // Length in milliseconds
+	Wave       []byte // Amplitude samples (0-255) drawn as the waveform
+	Transcribe bool   // Ask MAX to transcribe the message
+}
+
+// UploadVoice uploads audio as a voice message and returns the AUDIO attachment for sending
+func (c *Client) UploadVoice(data []byte, filename string, opts VoiceOptions) (*Attachment, error) {
+	if len(data) == 0 {
+		return nil, NewError("empty_upload", "Upload size must be positive", "Upload Error")
+	}
+
+	// Request upload URL
+	payload := map[string]interface{}{
+		"count": 1,
+	}
+
+	c.Logger.Info().Str("filename", filename).Msg("Requesting audio upload URL")
+
+	resp, err := c.sendAndWait(OpAudioUpload, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	info, ok := resp.Payload["info"].([]interface{})
+	if !ok || len(info) == 0 {
+		return nil, NewError("no_upload_info", "No upload info in response", "Upload Error")
+	}
+
+	uploadInfo, ok := info[0].(map[string]interface{})
+	if !ok {
+		return nil, NewError("invalid_upload_info", "Invalid upload info format", "Upload Error")
+	}
+
+	url, _ := uploadInfo["url"].(string)
+	audioID, _ := uploadInfo["audioId"].(float64)
+	token, _ := uploadInfo["token"].(string)
+
+	if url == "" || audioID == 0 {
+		return nil, NewError("no_upload_url", "No upload URL or audio ID", "Upload Error")
+	}
+
+	// Register waiter for audio processing completion
+	waiterCh := c.registerFileWaiter(int64(audioID))
+	defer c.unregisterFileWaiter(int64(audioID))
+
+	// Upload audio via HTTP POST
+	req, err := newUploadRequest(url, bytes.NewReader(data), int64(len(data)), filename)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Timeout: DefaultTimeout}
+	httpResp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, NewError("upload_failed", fmt.Sprintf("Upload failed with status %d", httpResp.StatusCode), "Upload Error")
+	}
+
+	// Wait for audio processing notification
+	select {
+	case <-waiterCh:
+		c.Logger.Info().Int64("audioId", int64(audioID)).Msg("Audio processed")
+	case <-time.After(DefaultTimeout):
+		c.Logger.Warn().Int64("audioId", int64(audioID)).Msg("Timeout waiting for audio processing")
+	}
+
+	attachment := &Attachment{
+		Type:       AttachTypeAudio,
+		AudioID:    int64(audioID),
+		Token:      token,
+		Duration:   opts.Duration,
+		Transcribe: opts.Transcribe,
+	}
+	if len(opts.Wave) > 0 {
+		attachment.Wave = base64.StdEncoding.EncodeToString(opts.Wave)
+	}
+	return attachment, nil
+}
+
 // GetVideoDownloadURL gets the download URL for a video
 func (c *Client) GetVideoDownloadURL(chatID int64, messageID int64, videoID int64) (*VideoRequest, error) {
 	payload := map[string]interface{}{
@@ -321,6 +438,31 @@ func (c *Client) DownloadFile(url string) ([]byte, error) {
 	return io.ReadAll(resp.Body)
 }
 
+// OpenDownload starts a download from a URL and returns the response for the
+// caller to stream and close. A non-empty rangeHeader is forwarded as the Range
+// header, in which case the server may answer 206 Partial Content.
+func (c *Client) OpenDownload(ctx context.Context, url string, rangeHeader string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if rangeHeader != "" {
+		req.Header.Set("Range", rangeHeader)
+	}
+	
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, NewError("download_failed", fmt.Sprintf("Download failed with status %d", resp.StatusCode), "Download Error")
+	}
+	
+	return resp, nil
+}
+
 // SendMessageWithPhoto sends a message with a photo attachment
 func (c *Client) SendMessageWithPhoto(chatID int64, text string, photoData []byte, filename string, notify bool) (*Message, error) {
 	attachment, err := c.UploadPhoto(photoData, filename)
@@ -338,7 +480,12 @@ func (c *Client) SendMessageWithPhoto(chatID int64, text string, photoData []byt
 
 // SendMessageWithFile sends a message with a file attachment
 func (c *Client) SendMessageWithFile(chatID int64, text string, fileData []byte, filename string, notify bool) (*Message, error) {
-	attachment, err := c.UploadFile(fileData, filename)
+	return c.SendMessageWithFileStream(chatID, text, bytes.NewReader(fileData), int64(len(fileData)), filename, notify)
+}
+
+// SendMessageWithFileStream sends a message with a file attachment read from r
+func (c *Client) SendMessageWithFileStream(chatID int64, text string, r io.Reader, size int64, filename string, notify bool) (*Message, error) {
+	attachment, err := c.UploadFileStream(r, size, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -353,7 +500,12 @@ func (c *Client) SendMessageWithFile(chatID int64, text string, fileData []byte,
 
 // SendMessageWithVideo sends a message with a video attachment
 func (c *Client) SendMessageWithVideo(chatID int64, text string, videoData []byte, filename string, notify bool) (*Message, error) {
-	attachment, err := c.UploadVideo(videoData, filename)
+	return c.SendMessageWithVideoStream(chatID, text, bytes.NewReader(videoData), int64(len(videoData)), filename, notify)
+}
+
+// SendMessageWithVideoStream sends a message with a video attachment read from r
+func (c *Client) SendMessageWithVideoStream(chatID int64, text string, r io.Reader, size int64, filename string, notify bool) (*Message, error) {
+	attachment, err := c.UploadVideoStream(r, size, filename)
 	if err != nil {
 		return nil, err
 	}
@@ -366,3 +518,17 @@ func (c *Client) SendMessageWithVideo(chatID int64, text string, videoData []byt
 	})
 }
 
+// SendVoiceMessage sends audio as a voice message
+func (c *Client) SendVoiceMessage(chatID int64, data []byte, filename string, opts VoiceOptions, notify bool) (*Message, error) {
+	attachment, err := c.UploadVoice(data, filename, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.SendMessage(SendMessageOptions{
+		ChatID:      chatID,
+		Notify:      notify,
+		Attachments: []Attachment{*attachment},
+	})
+}
+
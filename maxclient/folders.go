@@ -0,0 +1,99 @@
+package maxclient
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// GetFolders returns the chat folders of the account in display order
+func (c *Client) GetFolders() ([]Folder, error) {
+	payload := map[string]interface{}{
+		"folderSync": 0,
+	}
+
+	c.Logger.Info().Msg("Getting folders")
+
+	resp, err := c.sendAndWait(OpFoldersGet, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := []Folder{}
+	if foldersRaw, ok := resp.Payload["folders"].([]interface{}); ok {
+		for _, folderRaw := range foldersRaw {
+			folderBytes, _ := json.Marshal(folderRaw)
+			var folder Folder
+			if err := json.Unmarshal(folderBytes, &folder); err == nil {
+				folders = append(folders, folder)
+			}
+		}
+	}
+
+	return folders, nil
+}
+
+// CreateOrUpdateFolder saves a folder. A folder without an ID is created
+// with a new one; otherwise the folder with that ID is replaced.
+func (c *Client) CreateOrUpdateFolder(folder Folder) (*Folder, error) {
+	if folder.ID == "" {
+		folder.ID = uuid.New().String()
+	}
+	if folder.Include == nil {
+		folder.Include = []int64{}
+	}
+	if folder.Filters == nil {
+		folder.Filters = []interface{}{}
+	}
+
+	payload := map[string]interface{}{
+		"id":      folder.ID,
+		"title":   folder.Title,
+		"include": folder.Include,
+		"filters": folder.Filters,
+	}
+	if len(folder.Options) > 0 {
+		payload["options"] = folder.Options
+	}
+
+	c.Logger.Info().Str("folderId", folder.ID).Str("title", folder.Title).Msg("Saving folder")
+
+	resp, err := c.sendAndWait(OpFoldersUpdate, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	if folderRaw, ok := resp.Payload["folder"].(map[string]interface{}); ok {
+		folderBytes, _ := json.Marshal(folderRaw)
+		var saved Folder
+		if err := json.Unmarshal(folderBytes, &saved); err == nil {
+			return &saved, nil
+		}
+	}
+
+	return &folder, nil
+}
+
+// ReorderFolders sets the display order of the folders
+func (c *Client) ReorderFolders(folderIDs []string) error {
+	payload := map[string]interface{}{
+		"folderIds": folderIDs,
+	}
+
+	c.Logger.Info().Strs("folderIds", folderIDs).Msg("Reordering folders")
+
+	_, err := c.sendAndWait(OpFoldersReorder, payload)
+	return err
+}
+
+// DeleteFolder deletes a folder. The chats in it are not affected.
+func (c *Client) DeleteFolder(folderID string) error {
+	payload := map[string]interface{}{
+		"folderIds": []string{folderID},
+	}
+
+	c.Logger.Info().Str("folderId", folderID).Msg("Deleting folder")
+
+	_, err := c.sendAndWait(OpFoldersDelete, payload)
+	return err
+}
@@ -0,0 +1,78 @@
+package maxclient
+
+import (
+	"strconv"
+	"time"
+)
+
+// Config keys MAX uses for account limits. Key names differ between
+// protocol versions, so each limit lists its known spellings.
+var (
+	uploadSizeKeys    = []string{"file-upload-max-size", "max-file-size", "upload-max-size"}
+	messageLengthKeys = []string{"max-msg-length", "max-message-length"}
+	participantsKeys  = []string{"max-participants", "chat-max-participants"}
+	favoriteChatsKeys = []string{"max-favorite-chats"}
+)
+
+// setServerConfig keeps the config sent with the login or sync response
+func (c *Client) setServerConfig(payload map[string]interface{}) {
+	config, ok := payload["config"].(map[string]interface{})
+	if !ok {
+		return
+	}
+	c.limitsMu.Lock()
+	c.serverConfig = config
+	c.limitsMu.Unlock()
+	c.setChatMutes(config)
+}
+
+// recordRateLimit remembers the last throttling error returned by MAX
+func (c *Client) recordRateLimit(opcode int, err *Error) {
+	c.limitsMu.Lock()
+	c.lastRateLimit = &RateLimit{
+		Code:    err.Code,
+		Message: err.Message,
+		Opcode:  opcode,
+		Time:    time.Now().Unix(),
+	}
+	c.limitsMu.Unlock()
+}
+
+// Limits returns the limits MAX reported for the account. Limits the
+// server did not send are left zero.
+func (c *Client) Limits() Limits {
+	c.limitsMu.RLock()
+	defer c.limitsMu.RUnlock()
+
+	limits := Limits{
+		Config:    c.serverConfig,
+		RateLimit: c.lastRateLimit,
+	}
+
+	// Limits are either at the top level or in the "server" section
+	sections := []map[string]interface{}{c.serverConfig}
+	if server, ok := c.serverConfig["server"].(map[string]interface{}); ok {
+		sections = append(sections, server)
+	}
+	lookup := func(keys []string) int64 {
+		for _, section := range sections {
+			for _, key := range keys {
+				switch v := section[key].(type) {
+				case float64:
+					return int64(v)
+				case string:
+					if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+						return n
+					}
+				}
+			}
+		}
+		return 0
+	}
+
+	limits.MaxUploadSize = lookup(uploadSizeKeys)
+	limits.MaxMessageLength = int(lookup(messageLengthKeys))
+	limits.MaxChatParticipants = int(lookup(participantsKeys))
+	limits.MaxFavoriteChats = int(lookup(favoriteChatsKeys))
+	return limits
+}
@@ -0,0 +1,78 @@
+package maxclient
+
+import (
+	"strings"
+)
+
+// LinkPreview is the preview MAX generates for a URL in a message
+type LinkPreview struct {
+	ShareID     int64  `json:"shareId"`
+	URL         string `json:"url"`
+	Host        string `json:"host,omitempty"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+}
+
+// Attachment returns the SHARE attachment that attaches the preview to a message
+func (p *LinkPreview) Attachment() Attachment {
+	return Attachment{
+		Type:    AttachTypeShare,
+		ShareID: p.ShareID,
+		URL:     p.URL,
+	}
+}
+
+// GetLinkInfo fetches the preview MAX would generate for a URL.
+// Returns ErrNoLinkPreview if the server has no preview for it.
+func (c *Client) GetLinkInfo(url string) (*LinkPreview, error) {
+	url = strings.TrimSpace(url)
+
+	payload := map[string]interface{}{
+		"link": url,
+	}
+
+	c.Logger.Info().Str("url", url).Msg("Fetching link preview")
+
+	resp, err := c.sendAndWait(OpLinkInfo, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// The preview comes as a share attachment, older servers call it preview
+	var raw map[string]interface{}
+	for _, key := range []string{"share", "preview"} {
+		if m, ok := resp.Payload[key].(map[string]interface{}); ok {
+			raw = m
+			break
+		}
+	}
+	if raw == nil {
+		return nil, ErrNoLinkPreview
+	}
+
+	preview := &LinkPreview{URL: url}
+	for _, key := range []string{"shareId", "id"} {
+		if id, ok := raw[key].(float64); ok && preview.ShareID == 0 {
+			preview.ShareID = int64(id)
+		}
+	}
+	if u, ok := raw["url"].(string); ok && u != "" {
+		preview.URL = u
+	}
+	preview.Host, _ = raw["host"].(string)
+	preview.Title, _ = raw["title"].(string)
+	preview.Description, _ = raw["description"].(string)
+	if image, ok := raw["image"].(map[string]interface{}); ok {
+		for _, key := range []string{"url", "baseUrl"} {
+			if u, ok := image[key].(string); ok && preview.ImageURL == "" {
+				preview.ImageURL = u
+			}
+		}
+	}
+
+	if preview.ShareID == 0 && preview.Title == "" {
+		return nil, ErrNoLinkPreview
+	}
+	return preview, nil
+}
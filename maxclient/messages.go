@@ -2,7 +2,6 @@ package maxclient
 
 import (
 	"encoding/json"
-	"time"
 )
 
 // SendMessageOptions contains options for sending a message
@@ -10,7 +9,8 @@ type SendMessageOptions struct {
 	ChatID      int64
 	Text        string
 	Notify      bool
-	ReplyTo     int64
+	ReplyTo     MessageID
+	Forward     *MessageLink
 	Attachments []Attachment
 	Elements    []Element
 }
@@ -20,7 +20,7 @@ type SendMessageOptions struct {
 func (c *Client) SendMessage(opts SendMessageOptions) (*Message, error) {
 	message := map[string]interface{}{
 		"text": opts.Text,
-		"cid":  time.Now().UnixMilli(),
+		"cid":  c.nextCID(),
 	}
 
 	if len(opts.Elements) > 0 {
@@ -31,10 +31,19 @@ func (c *Client) SendMessage(opts SendMessageOptions) (*Message, error) {
 		message["attaches"] = opts.Attachments
 	}
 
-	if opts.ReplyTo > 0 {
+	// Replies reference the message by its native string ID
+	if !opts.ReplyTo.IsZero() {
 		message["link"] = map[string]interface{}{
-			"type":      "REPLY",
-			"messageId": opts.ReplyTo,
+			"type":      LinkTypeReply,
+			"messageId": opts.ReplyTo.String(),
+		}
+	}
+
+	if opts.Forward != nil {
+		message["link"] = map[string]interface{}{
+			"type":      LinkTypeForward,
+			"chatId":    opts.Forward.ChatID,
+			"messageId": opts.Forward.MessageID,
 		}
 	}
 
@@ -64,7 +73,7 @@ func (c *Client) SendTextMessage(chatID int64, text string, notify bool) (*Messa
 }
 
 // SendReply sends a reply to a message
-func (c *Client) SendReply(chatID int64, text string, replyToID int64, notify bool) (*Message, error) {
+func (c *Client) SendReply(chatID int64, text string, replyToID MessageID, notify bool) (*Message, error) {
 	return c.SendMessage(SendMessageOptions{
 		ChatID:  chatID,
 		Text:    text,
@@ -73,6 +82,31 @@ func (c *Client) SendReply(chatID int64, text string, replyToID int64, notify bo
 	})
 }
 
+// ForwardMessage forwards a message of the source chat to the target chat
+func (c *Client) ForwardMessage(targetChatID int64, sourceChatID int64, messageID MessageID, notify bool) (*Message, error) {
+	return c.SendMessage(SendMessageOptions{
+		ChatID: targetChatID,
+		Notify: notify,
+		Forward: &MessageLink{
+			ChatID:    sourceChatID,
+			MessageID: messageID.String(),
+		},
+	})
+}
+
+// SendMessageWithSticker sends a sticker by its ID
+func (c *Client) SendMessageWithSticker(chatID int64, stickerID int64, replyToID MessageID, notify bool) (*Message, error) {
+	return c.SendMessage(SendMessageOptions{
+		ChatID:  chatID,
+		ReplyTo: replyToID,
+		Notify:  notify,
+		Attachments: []Attachment{{
+			Type:      AttachTypeSticker,
+			StickerID: stickerID,
+		}},
+	})
+}
+
 // EditMessage edits an existing message
 func (c *Client) EditMessage(chatID int64, messageID int64, text string, attachments []Attachment) (*Message, error) {
 	payload := map[string]interface{}{
@@ -215,6 +249,70 @@ func (c *Client) GetReactions(chatID int64, messageIDs []string) (map[string]*Re
 	return result, nil
 }
 
+// GetDetailedReactions lists who reacted to a message, count at a time. An
+// empty reaction lists every reaction, otherwise only that one. The marker
+// continues after the previous page; the returned marker is 0 after the last.
+func (c *Client) GetDetailedReactions(chatID int64, messageID string, reaction string, marker int64, count int) ([]UserReaction, int64, error) {
+	payload := map[string]interface{}{
+		"chatId":    chatID,
+		"messageId": messageID,
+		"count":     count,
+	}
+	if reaction != "" {
+		payload["reaction"] = map[string]interface{}{
+			"reactionType": "EMOJI",
+			"id":           reaction,
+		}
+	}
+	if marker > 0 {
+		payload["marker"] = marker
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Str("messageId", messageID).Int("count", count).Msg("Getting detailed reactions")
+
+	resp, err := c.sendAndWait(OpMsgGetDetailedReactions, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	reactions := []UserReaction{}
+	var next int64
+
+	usersRaw, ok := resp.Payload["reactions"].([]interface{})
+	if !ok {
+		usersRaw, _ = resp.Payload["users"].([]interface{})
+	}
+	for _, userRaw := range usersRaw {
+		userMap, ok := userRaw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		var userReaction UserReaction
+		if id, ok := userMap["userId"].(float64); ok {
+			userReaction.UserID = int64(id)
+		} else if id, ok := userMap["id"].(float64); ok {
+			userReaction.UserID = int64(id)
+		}
+		// The reaction is either the emoji itself or a {reactionType, id} object
+		switch v := userMap["reaction"].(type) {
+		case string:
+			userReaction.Reaction = v
+		case map[string]interface{}:
+			userReaction.Reaction, _ = v["id"].(string)
+		}
+		if userReaction.UserID != 0 {
+			reactions = append(reactions, userReaction)
+		}
+	}
+
+	if m, ok := resp.Payload["marker"].(float64); ok {
+		next = int64(m)
+	}
+
+	return reactions, next, nil
+}
+
 // PinMessage pins a message in a chat
 func (c *Client) PinMessage(chatID int64, messageID int64, notifyPin bool) error {
 	payload := map[string]interface{}{
@@ -271,3 +369,49 @@ func (c *Client) GetMessage(chatID int64, messageID int64) (*Message, error) {
 
 	return c.parseMessageFromResponse(resp.Payload)
 }
+
+// SearchMessages searches the text of messages in a chat on the server
+func (c *Client) SearchMessages(chatID int64, query string, limit int) ([]Message, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	payload := map[string]interface{}{
+		"chatId": chatID,
+		"query":  query,
+		"count":  limit,
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Int("count", limit).Msg("Searching messages")
+
+	resp, err := c.sendAndWait(OpMsgSearch, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	// Results come either as plain messages or wrapped with their chat ID
+	itemsRaw, ok := resp.Payload["result"].([]interface{})
+	if !ok {
+		itemsRaw, _ = resp.Payload["messages"].([]interface{})
+	}
+
+	messages := []Message{}
+	for _, itemRaw := range itemsRaw {
+		item, ok := itemRaw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		msg, err := c.parseMessageFromResponse(item)
+		if err != nil {
+			continue
+		}
+		if msg.ChatID == 0 {
+			msg.ChatID = chatID
+		}
+		messages = append(messages, *msg)
+	}
+
+	c.Logger.Info().Int("count", len(messages)).Msg("Found messages")
+	return messages, nil
+}
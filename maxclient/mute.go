@@ -0,0 +1,86 @@
+package maxclient
+
+import (
+	"strconv"
+	"time"
+)
+
+// MuteForever mutes a chat until it is unmuted
+const MuteForever int64 = -1
+
+// chatMuteKey is the chat setting holding the end of the mute in
+// milliseconds; -1 mutes until unmuted and 0 unmutes
+const chatMuteKey = "dontDisturbUntil"
+
+// setChatMutes reads the mute settings from the chats section of a config
+func (c *Client) setChatMutes(config map[string]interface{}) {
+	chats, ok := config["chats"].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	c.mutesMu.Lock()
+	defer c.mutesMu.Unlock()
+	if c.chatMutes == nil {
+		c.chatMutes = make(map[int64]int64)
+	}
+	for key, raw := range chats {
+		chatID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			continue
+		}
+		settings, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if until, ok := settings[chatMuteKey].(float64); ok {
+			c.chatMutes[chatID] = int64(until)
+		}
+	}
+}
+
+// MuteChat turns off notifications of a chat until a time in milliseconds,
+// or until it is unmuted with MuteForever
+func (c *Client) MuteChat(chatID int64, until int64) error {
+	payload := map[string]interface{}{
+		"settings": map[string]interface{}{
+			"chats": map[string]interface{}{
+				strconv.FormatInt(chatID, 10): map[string]interface{}{
+					chatMuteKey: until,
+				},
+			},
+		},
+	}
+
+	c.Logger.Info().Int64("chatId", chatID).Int64("until", until).Msg("Updating chat mute")
+
+	if _, err := c.sendAndWait(OpConfig, payload); err != nil {
+		return err
+	}
+
+	c.mutesMu.Lock()
+	if c.chatMutes == nil {
+		c.chatMutes = make(map[int64]int64)
+	}
+	c.chatMutes[chatID] = until
+	c.mutesMu.Unlock()
+	return nil
+}
+
+// UnmuteChat turns notifications of a chat back on
+func (c *Client) UnmuteChat(chatID int64) error {
+	return c.MuteChat(chatID, 0)
+}
+
+// ChatMuteUntil returns until when a chat is muted: a time in milliseconds,
+// MuteForever, or 0 when it is not muted
+func (c *Client) ChatMuteUntil(chatID int64) int64 {
+	c.mutesMu.RLock()
+	until := c.chatMutes[chatID]
+	c.mutesMu.RUnlock()
+
+	if until > 0 && until <= time.Now().UnixMilli() {
+		return 0
+	}
+	return until
+}
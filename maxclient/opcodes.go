@@ -21,6 +21,10 @@ const (
 	OpConfig      Opcode = 22
 	OpAuthConfirm Opcode = 23
 
+	// Asset Operations (stickers)
+	OpAssetsGet      Opcode = 26
+	OpAssetsGetByIds Opcode = 28
+
 	// Contact Operations
 	OpContactInfo        Opcode = 32
 	OpContactAdd         Opcode = 33
@@ -59,6 +63,7 @@ const (
 	OpPhotoUpload  Opcode = 80
 	OpVideoUpload  Opcode = 82
 	OpVideoPlay    Opcode = 83
+	OpAudioUpload  Opcode = 84
 	OpFileUpload   Opcode = 87
 	OpFileDownload Opcode = 88
 	OpLinkInfo     Opcode = 89
@@ -143,6 +148,13 @@ const (
 	AttachTypeSticker AttachType = "STICKER"
 	AttachTypeAudio   AttachType = "AUDIO"
 	AttachTypeControl AttachType = "CONTROL"
+	AttachTypeShare   AttachType = "SHARE" // Link preview
+)
+
+// Link types of MessageLink
+const (
+	LinkTypeReply   = "REPLY"
+	LinkTypeForward = "FORWARD"
 )
 
 // FormattingType represents text formatting types
@@ -153,6 +165,8 @@ const (
 	FormattingEmphasized    FormattingType = "EMPHASIZED"
 	FormattingUnderline     FormattingType = "UNDERLINE"
 	FormattingStrikethrough FormattingType = "STRIKETHROUGH"
+	FormattingLink          FormattingType = "LINK"         // Attributes["url"] holds the target
+	FormattingUserMention   FormattingType = "USER_MENTION" // EntityID holds the user ID
 )
 
 // DeviceType represents device types
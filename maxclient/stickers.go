@@ -0,0 +1,75 @@
+package maxclient
+
+import (
+	"encoding/json"
+)
+
+// GetStickerSets returns the sticker packs of the account, starting after marker
+func (c *Client) GetStickerSets(count int, marker int64) ([]StickerSet, int64, error) {
+	payload := map[string]interface{}{
+		"type":  "STICKER_SET",
+		"count": count,
+	}
+	if marker > 0 {
+		payload["marker"] = marker
+	}
+
+	c.Logger.Info().Int("count", count).Msg("Getting sticker sets")
+
+	resp, err := c.sendAndWait(OpAssetsGet, payload)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var sets []StickerSet
+	var next int64
+
+	setsRaw, ok := resp.Payload["stickerSets"].([]interface{})
+	if !ok {
+		setsRaw, _ = resp.Payload["sets"].([]interface{})
+	}
+	for _, setRaw := range setsRaw {
+		setBytes, _ := json.Marshal(setRaw)
+		var set StickerSet
+		if err := json.Unmarshal(setBytes, &set); err == nil {
+			sets = append(sets, set)
+		}
+	}
+
+	if m, ok := resp.Payload["marker"].(float64); ok {
+		next = int64(m)
+	}
+
+	return sets, next, nil
+}
+
+// GetStickers returns stickers by their IDs
+func (c *Client) GetStickers(stickerIDs []int64) ([]Sticker, error) {
+	payload := map[string]interface{}{
+		"type": "STICKER",
+		"ids":  stickerIDs,
+	}
+
+	c.Logger.Info().Ints64("stickerIds", stickerIDs).Msg("Getting stickers")
+
+	resp, err := c.sendAndWait(OpAssetsGetByIds, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	var stickers []Sticker
+
+	stickersRaw, ok := resp.Payload["stickers"].([]interface{})
+	if !ok {
+		stickersRaw, _ = resp.Payload["assets"].([]interface{})
+	}
+	for _, stickerRaw := range stickersRaw {
+		stickerBytes, _ := json.Marshal(stickerRaw)
+		var sticker Sticker
+		if err := json.Unmarshal(stickerBytes, &sticker); err == nil {
+			stickers = append(stickers, sticker)
+		}
+	}
+
+	return stickers, nil
+}
@@ -2,6 +2,8 @@ package maxclient
 
 import (
 	"encoding/json"
+	"strconv"
+	"strings"
 )
 
 // BaseMessage represents the base structure for all WebSocket messages
@@ -22,6 +24,15 @@ type Response struct {
 	Payload map[string]interface{} `json:"payload"`
 }
 
+// response decodes the payload of a received frame into a Response
+func (m *BaseMessage) response() *Response {
+	resp := &Response{Ver: m.Ver, Cmd: m.Cmd, Seq: m.Seq, Opcode: m.Opcode}
+	if len(m.Payload) > 0 {
+		json.Unmarshal(m.Payload, &resp.Payload)
+	}
+	return resp
+}
+
 // UserAgent represents user agent information for connection
 type UserAgent struct {
 	DeviceType   DeviceType `json:"deviceType"`
@@ -42,6 +53,19 @@ type Name struct {
 	Type      string `json:"type,omitempty"`
 }
 
+// DisplayName returns the first usable name of a user or contact
+func DisplayName(names []Name) string {
+	for _, n := range names {
+		if n.Name != "" {
+			return n.Name
+		}
+		if name := strings.TrimSpace(n.FirstName + " " + n.LastName); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
 // User represents a MAX user
 type User struct {
 	ID            int64    `json:"id"`
@@ -58,7 +82,8 @@ type User struct {
 	WebApp        string   `json:"webApp,omitempty"`
 }
 
-// Me represents the current authenticated user
+// Me represents the current authenticated user. Description and Link are
+// the only profile extras MAX has; there is no emoji status or birthday.
 type Me struct {
 	ID            int64    `json:"id"`
 	AccountStatus int      `json:"accountStatus"`
@@ -66,6 +91,12 @@ type Me struct {
 	Names         []Name   `json:"names"`
 	UpdateTime    int64    `json:"updateTime"`
 	Options       []string `json:"options,omitempty"`
+	BaseURL       string   `json:"baseUrl,omitempty"`
+	BaseRawURL    string   `json:"baseRawUrl,omitempty"`
+	PhotoID       int64    `json:"photoId,omitempty"`
+	Description   string   `json:"description,omitempty"`
+	Gender        int      `json:"gender,omitempty"`
+	Link          string   `json:"link,omitempty"`
 }
 
 // Contact represents a contact
@@ -93,10 +124,13 @@ type Member struct {
 }
 
 // Element represents a formatting element in a message
+// From and Length count UTF-16 code units of the message text.
 type Element struct {
-	Type   FormattingType `json:"type"`
-	From   int            `json:"from"`
-	Length int            `json:"length"`
+	Type       FormattingType    `json:"type"`
+	From       int               `json:"from"`
+	Length     int               `json:"length"`
+	EntityID   int64             `json:"entityId,omitempty"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 // ReactionCounter represents a reaction counter
@@ -112,6 +146,19 @@ type ReactionInfo struct {
 	Counters     []ReactionCounter `json:"counters,omitempty"`
 }
 
+// JoinRequest is a pending request to join a chat that needs approval
+type JoinRequest struct {
+	UserID  int64    `json:"userId"`
+	Time    int64    `json:"time,omitempty"`
+	Contact *Contact `json:"contact,omitempty"`
+}
+
+// UserReaction is the reaction of one user to a message
+type UserReaction struct {
+	UserID   int64  `json:"userId"`
+	Reaction string `json:"reaction"`
+}
+
 // MessageLink represents a reply/forward link
 type MessageLink struct {
 	Type      string   `json:"type"`
@@ -181,6 +228,8 @@ type Attachment struct {
 	VideoID     int64      `json:"videoId,omitempty"`
 	FileID      int64      `json:"fileId,omitempty"`
 	AudioID     int64      `json:"audioId,omitempty"`
+	StickerID   int64      `json:"stickerId,omitempty"`
+	ShareID     int64      `json:"shareId,omitempty"`
 	Token       string     `json:"token,omitempty"`
 	BaseURL     string     `json:"baseUrl,omitempty"`
 	URL         string     `json:"url,omitempty"`
@@ -189,6 +238,8 @@ type Attachment struct {
 	Width       int        `json:"width,omitempty"`
 	Height      int        `json:"height,omitempty"`
 	Duration    int        `json:"duration,omitempty"`
+	Wave        string     `json:"wave,omitempty"`
+	Transcribe  bool       `json:"transcription,omitempty"`
 	PreviewData string     `json:"previewData,omitempty"`
 	Event       string     `json:"event,omitempty"`
 	ChatType    string     `json:"chatType,omitempty"`
@@ -196,6 +247,85 @@ type Attachment struct {
 	UserIDs     []int64    `json:"userIds,omitempty"`
 }
 
+// MessageID is a MAX message ID. MAX sends message IDs as numeric strings,
+// which is also the form used in REST bodies and responses. IDs exceed the
+// integer precision of JavaScript, so JSON numbers are only accepted for
+// compatibility with older clients.
+type MessageID string
+
+// ParseMessageID validates a message ID given as a string
+func ParseMessageID(s string) (MessageID, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", ErrInvalidMessageID
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return "", ErrInvalidMessageID
+		}
+	}
+	return MessageID(s), nil
+}
+
+// MessageIDFromInt converts a numeric message ID
+func MessageIDFromInt(id int64) MessageID {
+	return MessageID(strconv.FormatInt(id, 10))
+}
+
+// Int64 returns the numeric form used by opcodes that take integer IDs
+func (id MessageID) Int64() (int64, error) {
+	n, err := strconv.ParseInt(string(id), 10, 64)
+	if err != nil {
+		return 0, ErrInvalidMessageID
+	}
+	return n, nil
+}
+
+func (id MessageID) String() string {
+	return string(id)
+}
+
+// IsZero reports whether no message is referenced. Older clients send 0
+// for "no reply", so it counts as empty.
+func (id MessageID) IsZero() bool {
+	return id == "" || id == "0"
+}
+
+// UnmarshalJSON accepts a numeric string or, for compatibility, a JSON number
+func (id *MessageID) UnmarshalJSON(data []byte) error {
+	raw := string(data)
+	if raw == "null" {
+		*id = ""
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(raw); err == nil {
+		if unquoted == "" {
+			*id = ""
+			return nil
+		}
+		raw = unquoted
+	}
+	parsed, err := ParseMessageID(raw)
+	if err != nil {
+		return err
+	}
+	*id = parsed
+	return nil
+}
+
+// Int64MessageIDs converts message IDs for opcodes that take integer IDs
+func Int64MessageIDs(ids []MessageID) ([]int64, error) {
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		n, err := id.Int64()
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, n)
+	}
+	return out, nil
+}
+
 // Message represents a MAX message
 type Message struct {
 	ID           string        `json:"id"`
@@ -250,6 +380,38 @@ type Chat struct {
 	LastFireDelayedErrorTime int64                  `json:"lastFireDelayedErrorTime,omitempty"`
 }
 
+// ChatAdmin is an administrator of a group or channel. Permissions is the
+// MAX permission bitmask; the owner has all permissions.
+type ChatAdmin struct {
+	UserID      int64 `json:"userId"`
+	Permissions int64 `json:"permissions,omitempty"`
+	Owner       bool  `json:"owner,omitempty"`
+}
+
+// AdminList returns the owner and the administrators of a chat
+func (c *Chat) AdminList() []ChatAdmin {
+	admins := []ChatAdmin{}
+	seen := map[int64]bool{}
+	if c.Owner != 0 {
+		admins = append(admins, ChatAdmin{UserID: c.Owner, Owner: true})
+		seen[c.Owner] = true
+	}
+	for _, userID := range c.Admins {
+		if seen[userID] {
+			continue
+		}
+		seen[userID] = true
+		admin := ChatAdmin{UserID: userID}
+		if info, ok := c.AdminParticipants[strconv.FormatInt(userID, 10)].(map[string]interface{}); ok {
+			if permissions, ok := info["permissions"].(float64); ok {
+				admin.Permissions = int64(permissions)
+			}
+		}
+		admins = append(admins, admin)
+	}
+	return admins
+}
+
 // Dialog represents a direct message conversation
 type Dialog struct {
 	ID                       int64            `json:"id"`
@@ -279,6 +441,44 @@ type Session struct {
 	Current  bool   `json:"current,omitempty"`
 }
 
+// Limits holds the account limits reported by MAX. MaxUploadSize is in bytes;
+// Config is the raw config the limits were read from.
+type Limits struct {
+	MaxUploadSize       int64                  `json:"maxUploadSize,omitempty"`
+	MaxMessageLength    int                    `json:"maxMessageLength,omitempty"`
+	MaxChatParticipants int                    `json:"maxChatParticipants,omitempty"`
+	MaxFavoriteChats    int                    `json:"maxFavoriteChats,omitempty"`
+	RateLimit           *RateLimit             `json:"rateLimit,omitempty"`
+	Config              map[string]interface{} `json:"config,omitempty"`
+}
+
+// RateLimit is the last throttling error returned by MAX
+type RateLimit struct {
+	Code    string `json:"code"`
+	Message string `json:"message,omitempty"`
+	Opcode  int    `json:"opcode"`
+	Time    int64  `json:"time"`
+}
+
+// StickerSet represents a sticker pack
+type StickerSet struct {
+	ID       int64   `json:"id"`
+	Name     string  `json:"name"`
+	IconURL  string  `json:"iconUrl,omitempty"`
+	Stickers []int64 `json:"stickers,omitempty"`
+}
+
+// Sticker represents a single sticker
+type Sticker struct {
+	ID        int64    `json:"id"`
+	SetID     int64    `json:"setId,omitempty"`
+	URL       string   `json:"url,omitempty"`
+	LottieURL string   `json:"lottieUrl,omitempty"`
+	Width     int      `json:"width,omitempty"`
+	Height    int      `json:"height,omitempty"`
+	Tags      []string `json:"tags,omitempty"`
+}
+
 // Folder represents a chat folder
 type Folder struct {
 	ID         string        `json:"id"`
@@ -318,11 +518,31 @@ type FileRequest struct {
 	Unsafe bool   `json:"unsafe"`
 }
 
-// Event represents a notification event from the server
+// Event represents a notification event from the server.
+// Raw holds the payload as received; Payload is only decoded from it on demand (see PayloadMap).
 type Event struct {
 	Type    string                 `json:"type"`
 	Opcode  Opcode                 `json:"opcode"`
 	Payload map[string]interface{} `json:"payload"`
+	Raw     json.RawMessage        `json:"-"`
+}
+
+// PayloadMap returns the payload as a map, decoding Raw on first use
+func (e *Event) PayloadMap() map[string]interface{} {
+	if e.Payload == nil && len(e.Raw) > 0 {
+		if err := json.Unmarshal(e.Raw, &e.Payload); err != nil {
+			e.Payload = map[string]interface{}{}
+		}
+	}
+	return e.Payload
+}
+
+// RawPayload returns the payload as JSON, encoding Payload if the event was built without Raw
+func (e *Event) RawPayload() json.RawMessage {
+	if len(e.Raw) == 0 && e.Payload != nil {
+		e.Raw, _ = json.Marshal(e.Payload)
+	}
+	return e.Raw
 }
 
 // SyncResponse represents the response from LOGIN/sync operation
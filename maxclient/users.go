@@ -2,6 +2,7 @@ package maxclient
 
 import (
 	"encoding/json"
+	"strconv"
 )
 
 // GetUsers gets information about users by IDs
@@ -184,6 +185,53 @@ func (c *Client) GetPresence(userID int64) (*Presence, error) {
 	return nil, nil
 }
 
+// SubscribePresence subscribes to the presence of users. MAX then sends
+// presence notifications for them for the rest of the session; the current
+// presence of each user is returned, keyed by user ID.
+func (c *Client) SubscribePresence(userIDs []int64) (map[int64]Presence, error) {
+	payload := map[string]interface{}{
+		"contactIds": userIDs,
+		"subscribe":  true,
+	}
+	
+	c.Logger.Debug().Int("users", len(userIDs)).Msg("Subscribing to presence")
+	
+	resp, err := c.sendAndWait(OpContactPresence, payload)
+	if err != nil {
+		return nil, err
+	}
+	
+	presences := make(map[int64]Presence)
+	if presenceRaw, ok := resp.Payload["presence"].(map[string]interface{}); ok {
+		for key, value := range presenceRaw {
+			userID, err := strconv.ParseInt(key, 10, 64)
+			if err != nil {
+				continue
+			}
+			presenceBytes, _ := json.Marshal(value)
+			var presence Presence
+			if err := json.Unmarshal(presenceBytes, &presence); err == nil {
+				presences[userID] = presence
+			}
+		}
+	}
+	
+	return presences, nil
+}
+
+// UnsubscribePresence stops the presence notifications for users
+func (c *Client) UnsubscribePresence(userIDs []int64) error {
+	payload := map[string]interface{}{
+		"contactIds": userIDs,
+		"subscribe":  false,
+	}
+	
+	c.Logger.Debug().Int("users", len(userIDs)).Msg("Unsubscribing from presence")
+	
+	_, err := c.sendAndWait(OpContactPresence, payload)
+	return err
+}
+
 // GetSessions gets active sessions for the current user
 func (c *Client) GetSessions() ([]Session, error) {
 	c.Logger.Info().Msg("Getting sessions")
@@ -213,8 +261,17 @@ func (c *Client) GetSessions() ([]Session, error) {
 	return sessions, nil
 }
 
-// UpdateProfile updates the current user's profile
-func (c *Client) UpdateProfile(firstName string, lastName string, description string) error {
+// CloseSessions terminates every session of the account except the current
+// one. Sessions carry no ID, so they cannot be closed one by one.
+func (c *Client) CloseSessions() error {
+	c.Logger.Info().Msg("Closing other sessions")
+	
+	_, err := c.sendAndWait(OpSessionsClose, map[string]interface{}{})
+	return err
+}
+
+// UpdateProfile updates the current user's profile and returns it as updated by MAX
+func (c *Client) UpdateProfile(firstName string, lastName string, description string) (*Me, error) {
 	payload := map[string]interface{}{
 		"firstName": firstName,
 	}
@@ -228,8 +285,53 @@ func (c *Client) UpdateProfile(firstName string, lastName string, description st
 	
 	c.Logger.Info().Str("firstName", firstName).Msg("Updating profile")
 	
-	_, err := c.sendAndWait(OpProfile, payload)
-	return err
+	resp, err := c.sendAndWait(OpProfile, payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateMe(resp.Payload), nil
+}
+
+// UpdateAvatar uploads a photo and sets it as the profile picture
+func (c *Client) UpdateAvatar(data []byte, filename string) (*Me, error) {
+	attachment, err := c.UploadPhoto(data, filename)
+	if err != nil {
+		return nil, err
+	}
+	
+	payload := map[string]interface{}{
+		"photoToken": attachment.PhotoToken,
+		"avatarType": "USER_AVATAR",
+	}
+	
+	c.Logger.Info().Msg("Updating profile picture")
+	
+	resp, err := c.sendAndWait(OpProfile, payload)
+	if err != nil {
+		return nil, err
+	}
+	return c.updateMe(resp.Payload), nil
+}
+
+// updateMe keeps the profile returned by a profile update. The current
+// profile is returned when the response does not carry one.
+func (c *Client) updateMe(payload map[string]interface{}) *Me {
+	profile, ok := payload["profile"].(map[string]interface{})
+	if !ok {
+		return c.Me
+	}
+	contact, ok := profile["contact"].(map[string]interface{})
+	if !ok {
+		return c.Me
+	}
+	
+	contactBytes, _ := json.Marshal(contact)
+	var me Me
+	if err := json.Unmarshal(contactBytes, &me); err != nil {
+		return c.Me
+	}
+	c.Me = &me
+	return c.Me
 }
 
 // GetContacts gets the contact list
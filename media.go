@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const (
+	mediaDirectionInbox  = "inbox"
+	mediaDirectionOutbox = "outbox"
+
+	defaultMediaListLimit = 50
+	maxMediaListLimit     = 500
+)
+
+// MediaRecord is an entry of the media index
+type MediaRecord struct {
+	ID             int64  `json:"id" db:"id"`
+	UserID         string `json:"-" db:"user_id"`
+	ChatID         int64  `json:"chatId" db:"chat_id"`
+	MessageID      string `json:"messageId" db:"message_id"`
+	Direction      string `json:"direction" db:"direction"`
+	MediaType      string `json:"type" db:"media_type"`
+	RemoteID       string `json:"remoteId,omitempty" db:"remote_id"`
+	FileName       string `json:"fileName,omitempty" db:"file_name"`
+	MimeType       string `json:"mimeType,omitempty" db:"mime_type"`
+	Size           int64  `json:"size" db:"size"`
+	Checksum       string `json:"checksum,omitempty" db:"checksum"`
+	StorageBackend string `json:"storageBackend,omitempty" db:"storage_backend"`
+	StorageKey     string `json:"storageKey,omitempty" db:"storage_key"`
+	URL            string `json:"url,omitempty" db:"url"`
+	CreatedAt      int64  `json:"createdAt" db:"created_at"`
+}
+
+// mediaChecksum returns the hex SHA-256 of data
+func mediaChecksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// attachmentMediaType maps a MAX attachment to the media index type and remote ID
+func attachmentMediaType(attach maxclient.Attachment) (string, string) {
+	switch attach.Type {
+	case maxclient.AttachTypePhoto:
+		return "image", strconv.FormatInt(attach.PhotoID, 10)
+	case maxclient.AttachTypeVideo:
+		return "video", strconv.FormatInt(attach.VideoID, 10)
+	case maxclient.AttachTypeFile:
+		return "file", strconv.FormatInt(attach.FileID, 10)
+	case maxclient.AttachTypeAudio:
+		return "audio", strconv.FormatInt(attach.AudioID, 10)
+	}
+	return "", ""
+}
+
+// applyStoredMedia copies the result of a media store upload onto the record
+func (rec *MediaRecord) applyStoredMedia(stored map[string]interface{}) {
+	if stored == nil {
+		return
+	}
+	rec.StorageBackend, _ = stored["backend"].(string)
+	rec.StorageKey, _ = stored["key"].(string)
+	rec.URL, _ = stored["url"].(string)
+}
+
+// indexMedia records an attachment. When the message is seen again (e.g. the echo
+// of an API send), fields missing from the first record are filled in.
+func (s *server) indexMedia(rec *MediaRecord) error {
+	if rec.CreatedAt == 0 {
+		rec.CreatedAt = time.Now().Unix()
+	}
+
+	_, err := s.db.Exec(`INSERT INTO media (user_id, chat_id, message_id, direction, media_type, remote_id, file_name,
+			mime_type, size, checksum, storage_backend, storage_key, url, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (user_id, message_id, media_type, remote_id) DO UPDATE SET
+			file_name = CASE WHEN media.file_name = '' THEN excluded.file_name ELSE media.file_name END,
+			mime_type = CASE WHEN media.mime_type = '' THEN excluded.mime_type ELSE media.mime_type END,
+			size = CASE WHEN media.size = 0 THEN excluded.size ELSE media.size END,
+			checksum = CASE WHEN media.checksum = '' THEN excluded.checksum ELSE media.checksum END,
+			storage_backend = CASE WHEN media.storage_key = '' THEN excluded.storage_backend ELSE media.storage_backend END,
+			url = CASE WHEN media.storage_key = '' THEN excluded.url ELSE media.url END,
+			storage_key = CASE WHEN media.storage_key = '' THEN excluded.storage_key ELSE media.storage_key END`,
+		rec.UserID, rec.ChatID, rec.MessageID, rec.Direction, rec.MediaType, rec.RemoteID, rec.FileName,
+		rec.MimeType, rec.Size, rec.Checksum, rec.StorageBackend, rec.StorageKey, rec.URL, rec.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to index media: %w", err)
+	}
+	return nil
+}
+
+// RecordOutgoingMedia stores media sent through the API and adds it to the index.
+// It runs in the background so the send response is not delayed by the upload.
+func (s *server) RecordOutgoingMedia(userID string, chatID int64, result *maxclient.Message, mediaType, fileName string, data []byte) {
+	// The copy to the media store keeps the data buffered after the send returns
+	res := resourcesFor(userID)
+	res.media.Add(int64(len(data)))
+
+	goTracked(userID, func() {
+		defer res.releaseMedia(int64(len(data)))
+
+		mimeType := http.DetectContentType(data)
+		rec := outgoingMediaRecord(userID, chatID, result, mediaType, fileName, mimeType, int64(len(data)), mediaChecksum(data))
+
+		stored, _ := ProcessOutgoingMedia(userID, strconv.FormatInt(chatID, 10), result.ID, data, mimeType, fileName, s.db)
+		rec.applyStoredMedia(stored)
+
+		if err := s.indexMedia(rec); err != nil {
+			log.Error().Err(err).Str("userID", userID).Str("messageId", result.ID).Msg("Failed to record outgoing media")
+		}
+	})
+}
+
+// recordOutgoingStream adds media sent from a stream to the index. The content is
+// not at hand any more, so it is not copied to the media store.
+func (s *server) recordOutgoingStream(userID string, chatID int64, result *maxclient.Message, mediaType, fileName, mimeType string, size int64, checksum string) {
+	rec := outgoingMediaRecord(userID, chatID, result, mediaType, fileName, mimeType, size, checksum)
+	if err := s.indexMedia(rec); err != nil {
+		log.Error().Err(err).Str("userID", userID).Str("messageId", result.ID).Msg("Failed to record outgoing media")
+	}
+}
+
+// outgoingMediaRecord describes media sent through the API for the index
+func outgoingMediaRecord(userID string, chatID int64, result *maxclient.Message, mediaType, fileName, mimeType string, size int64, checksum string) *MediaRecord {
+	rec := &MediaRecord{
+		UserID:    userID,
+		ChatID:    chatID,
+		MessageID: result.ID,
+		Direction: mediaDirectionOutbox,
+		MediaType: mediaType,
+		FileName:  fileName,
+		MimeType:  mimeType,
+		Size:      size,
+		Checksum:  checksum,
+	}
+	for _, attach := range result.Attaches {
+		if t, remoteID := attachmentMediaType(attach); t == mediaType {
+			rec.RemoteID = remoteID
+			break
+		}
+	}
+	return rec
+}
+
+// StreamDownload passes a MAX download through to the caller as the raw response
+// body. Range requests are forwarded so players can seek. When a media scanner is
+// configured the content is buffered and scanned first, as it cannot be checked
+// while it is passed through.
+func (s *server) StreamDownload(w http.ResponseWriter, r *http.Request, client *maxclient.Client, chatID int64, url string) {
+	// Large videos take longer than the server write timeout to transfer
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	if scanner != nil {
+		data, err := client.DownloadFile(url)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("download failed: %v", err))
+			return
+		}
+		if !s.checkMedia(w, r, mediaDirectionInbox, chatID, "", data) {
+			return
+		}
+
+		w.Header().Set("Content-Type", http.DetectContentType(data))
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+
+	resp, err := client.OpenDownload(r.Context(), url, r.Header.Get("Range"))
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("download failed: %v", err))
+		return
+	}
+	defer resp.Body.Close()
+
+	body := bufio.NewReader(resp.Body)
+	contentType := resp.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		head, _ := body.Peek(512)
+		contentType = http.DetectContentType(head)
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	for _, h := range []string{"Content-Length", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"} {
+		if v := resp.Header.Get(h); v != "" {
+			w.Header().Set(h, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+
+	if _, err := io.Copy(w, body); err != nil {
+		log.Debug().Err(err).Int64("chatId", chatID).Msg("Media stream interrupted")
+	}
+}
+
+// mediaFilter holds the query parameters for listing media
+type mediaFilter struct {
+	ChatID    int64
+	MessageID string
+	MediaType string
+	Direction string
+	Since     int64
+	Until     int64
+	Limit     int
+	Offset    int
+}
+
+// parseMediaFilter reads media list filters from the query string
+func parseMediaFilter(r *http.Request) (mediaFilter, error) {
+	q := r.URL.Query()
+	f := mediaFilter{
+		MessageID: q.Get("messageId"),
+		MediaType: q.Get("type"),
+		Direction: q.Get("direction"),
+		Limit:     defaultMediaListLimit,
+	}
+
+	ints := map[string]*int64{"chatId": &f.ChatID, "since": &f.Since, "until": &f.Until}
+	for name, dst := range ints {
+		if v := q.Get(name); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", name)
+			}
+			*dst = n
+		}
+	}
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxMediaListLimit {
+			return f, fmt.Errorf("limit must be between 1 and %d", maxMediaListLimit)
+		}
+		f.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, errors.New("invalid offset")
+		}
+		f.Offset = n
+	}
+
+	if f.Direction != "" && f.Direction != mediaDirectionInbox && f.Direction != mediaDirectionOutbox {
+		return f, errors.New("direction must be inbox or outbox")
+	}
+
+	return f, nil
+}
+
+// listMedia returns the matching index entries and the total number of matches
+func (s *server) listMedia(userID string, f mediaFilter) ([]MediaRecord, int, error) {
+	where := []string{"user_id = $1"}
+	args := []interface{}{userID}
+	add := func(cond string, v interface{}) {
+		args = append(args, v)
+		where = append(where, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.ChatID != 0 {
+		add("chat_id = $%d", f.ChatID)
+	}
+	if f.MessageID != "" {
+		add("message_id = $%d", f.MessageID)
+	}
+	if f.MediaType != "" {
+		add("media_type = $%d", f.MediaType)
+	}
+	if f.Direction != "" {
+		add("direction = $%d", f.Direction)
+	}
+	if f.Since > 0 {
+		add("created_at >= $%d", f.Since)
+	}
+	if f.Until > 0 {
+		add("created_at < $%d", f.Until)
+	}
+	cond := strings.Join(where, " AND ")
+
+	var total int
+	if err := s.db.Get(&total, "SELECT COUNT(*) FROM media WHERE "+cond, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to count media: %w", err)
+	}
+
+	media := []MediaRecord{}
+	query := fmt.Sprintf("SELECT * FROM media WHERE %s ORDER BY created_at DESC, id DESC LIMIT %d OFFSET %d", cond, f.Limit, f.Offset)
+	if err := s.db.Select(&media, query, args...); err != nil {
+		return nil, 0, fmt.Errorf("failed to list media: %w", err)
+	}
+
+	return media, total, nil
+}
+
+// ListMedia lists indexed media
+// @Summary List media
+// @Description Returns media attachments recorded from incoming and outgoing messages, newest first
+// @Tags Media
+// @Produce json
+// @Param chatId query int false "Filter by chat ID"
+// @Param messageId query string false "Filter by message ID"
+// @Param type query string false "Filter by type (image, video, file, audio)"
+// @Param direction query string false "Filter by direction (inbox, outbox)"
+// @Param since query int false "Only media recorded at or after this unix time"
+// @Param until query int false "Only media recorded before this unix time"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {object} MediaListResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /media [get]
+func (s *server) ListMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		filter, err := parseMediaFilter(r)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		media, total, err := s.listMedia(txtid, filter)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"media":   media,
+			"total":   total,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetMedia returns a single media index entry
+// @Summary Get media
+// @Description Returns one recorded media attachment
+// @Tags Media
+// @Produce json
+// @Param mediaid path int true "Media ID"
+// @Success 200 {object} MediaItemResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /media/{mediaid} [get]
+func (s *server) GetMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var rec MediaRecord
+		err := s.db.Get(&rec, "SELECT * FROM media WHERE id = $1 AND user_id = $2", mux.Vars(r)["mediaid"], txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusNotFound, errors.New("media not found"))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"media":   rec,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
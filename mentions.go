@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"maxapi/handlers/chat"
+	"maxapi/maxclient"
+)
+
+// maxMentions caps the mentions of one message, as each phone costs a lookup
+const maxMentions = 50
+
+// phonePlaceholder is a @+79001234567 placeholder found in the message text
+type phonePlaceholder struct {
+	start, end int // rune range of the placeholder
+	phone      string
+}
+
+// mentionResolver looks up mentioned phones, once per phone
+type mentionResolver struct {
+	client *maxclient.Client
+	users  map[string]*maxclient.User
+}
+
+func (m *mentionResolver) user(phone string) (*maxclient.User, error) {
+	if user, ok := m.users[phone]; ok {
+		return user, nil
+	}
+	user, err := m.client.SearchByPhone(phone)
+	if err != nil {
+		return nil, fmt.Errorf("mention %s: user not found: %v", phone, err)
+	}
+	m.users[phone] = user
+	return user, nil
+}
+
+// resolveMentions replaces @+phone placeholders in the text with the name of
+// the user and turns mentions into mention elements. The ranges of mentions
+// and elements refer to the text as sent and are moved past the replaced
+// placeholders. With markdown, placeholders become [name](max://user/ID) links.
+func resolveMentions(client *maxclient.Client, msg chat.MessageBody) (string, []chat.MessageElement, error) {
+	runes := []rune(msg.Text)
+	placeholders := findPhonePlaceholders(runes)
+	if len(msg.Mentions) == 0 && len(placeholders) == 0 {
+		return msg.Text, msg.Elements, nil
+	}
+	if len(msg.Mentions)+len(placeholders) > maxMentions {
+		return "", nil, fmt.Errorf("too many mentions (max %d)", maxMentions)
+	}
+	if msg.Format == formatMarkdown && len(msg.Mentions) > 0 {
+		return "", nil, errors.New("mentions cannot be combined with markdown (use [name](max://user/ID) or @+phone)")
+	}
+
+	resolver := &mentionResolver{client: client, users: map[string]*maxclient.User{}}
+
+	elements := append([]chat.MessageElement{}, msg.Elements...)
+	for i, mention := range msg.Mentions {
+		if mention.Offset < 0 || mention.Length <= 0 || mention.Offset+mention.Length > len(runes) {
+			return "", nil, fmt.Errorf("mention %d: range %d+%d is outside the text", i, mention.Offset, mention.Length)
+		}
+		userID := mention.UserID
+		if userID == 0 {
+			if mention.Phone == "" {
+				return "", nil, fmt.Errorf("mention %d: userId or phone is required", i)
+			}
+			user, err := resolver.user(mention.Phone)
+			if err != nil {
+				return "", nil, err
+			}
+			userID = user.ID
+		}
+		elements = append(elements, chat.MessageElement{Type: "mention", From: mention.Offset, Length: mention.Length, UserID: userID})
+	}
+
+	var out []rune
+	var mentioned []chat.MessageElement
+	// shifts[i] is how much text after placeholder i moved
+	shifts := make([]int, len(placeholders))
+	last := 0
+	for i, p := range placeholders {
+		user, err := resolver.user(p.phone)
+		if err != nil {
+			return "", nil, err
+		}
+		name := []rune(mentionName(user, p.phone))
+
+		out = append(out, runes[last:p.start]...)
+		if msg.Format == formatMarkdown {
+			out = append(out, '[')
+			out = append(out, []rune(escapeMarkdown(string(name)))...)
+			out = append(out, []rune(fmt.Sprintf("](%s%d)", mentionURLPrefix, user.ID))...)
+		} else {
+			mentioned = append(mentioned, chat.MessageElement{Type: "mention", From: len(out), Length: len(name), UserID: user.ID})
+			out = append(out, name...)
+		}
+		last = p.end
+		shifts[i] = len(out) - p.end
+	}
+	out = append(out, runes[last:]...)
+
+	// Move the given ranges to the rewritten text
+	moved := func(pos int) (int, bool) {
+		delta := 0
+		for i, p := range placeholders {
+			if pos <= p.start {
+				break
+			}
+			if pos < p.end {
+				return 0, false
+			}
+			delta = shifts[i]
+		}
+		return pos + delta, true
+	}
+	for i := range elements {
+		from, okFrom := moved(elements[i].From)
+		end, okEnd := moved(elements[i].From + elements[i].Length)
+		if !okFrom || !okEnd {
+			return "", nil, fmt.Errorf("element %d: range %d+%d cuts through a @+phone placeholder", i, elements[i].From, elements[i].Length)
+		}
+		elements[i].From, elements[i].Length = from, end-from
+	}
+
+	return string(out), append(elements, mentioned...), nil
+}
+
+// findPhonePlaceholders returns the @+phone placeholders of a text. The @ must
+// not follow a letter or digit, so e-mail addresses are left alone.
+func findPhonePlaceholders(runes []rune) []phonePlaceholder {
+	var found []phonePlaceholder
+	for i := 0; i+1 < len(runes); i++ {
+		if runes[i] != '@' || runes[i+1] != '+' || (i > 0 && isWordRune(runes[i-1])) {
+			continue
+		}
+		j := i + 2
+		for j < len(runes) && unicode.IsDigit(runes[j]) {
+			j++
+		}
+		digits := string(runes[i+2 : j])
+		if !maxclient.ValidatePhone(digits) || (j < len(runes) && isWordRune(runes[j])) {
+			continue
+		}
+		found = append(found, phonePlaceholder{start: i, end: j, phone: digits})
+		i = j - 1
+	}
+	return found
+}
+
+// mentionName returns the name a mention is shown with
+func mentionName(user *maxclient.User, phone string) string {
+	if name := userDisplayName(user); name != "" {
+		return name
+	}
+	return "+" + phone
+}
+
+// userDisplayName returns the name of a user, or "" when MAX has none
+func userDisplayName(user *maxclient.User) string {
+	return maxclient.DisplayName(user.Names)
+}
+
+// escapeMarkdown escapes the characters parseMarkdown treats as delimiters
+func escapeMarkdown(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if strings.ContainsRune(`\*_~[]()`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
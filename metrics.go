@@ -0,0 +1,270 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	metricsLabelsOff  = "off"
+	metricsLabelsID   = "id"
+	metricsLabelsHash = "hash"
+
+	// metricsOtherInstance collects instances beyond METRICS_MAX_INSTANCES
+	metricsOtherInstance = "other"
+)
+
+// instanceCounters are the counters of one instance label
+type instanceCounters struct {
+	sent          atomic.Int64
+	received      atomic.Int64
+	webhookOK     atomic.Int64
+	webhookFailed atomic.Int64
+}
+
+// metricsRegistry holds the global counters and the per-instance series
+type metricsRegistry struct {
+	labels    string
+	allowed   map[string]bool
+	maxSeries int
+	token     string
+
+	global instanceCounters
+
+	authFailedUser  atomic.Int64
+	authFailedAdmin atomic.Int64
+	authBans        atomic.Int64
+
+	mu        sync.Mutex
+	instances map[string]*instanceCounters
+}
+
+var metrics = &metricsRegistry{labels: metricsLabelsOff, instances: make(map[string]*instanceCounters)}
+
+// initMetrics reads the per-instance label settings: METRICS_INSTANCE_LABELS
+// (off, id or hash), METRICS_INSTANCES to label only some instances and
+// METRICS_MAX_INSTANCES to cap the number of labeled series
+func initMetrics() {
+	m := &metricsRegistry{
+		labels:    strings.ToLower(os.Getenv("METRICS_INSTANCE_LABELS")),
+		maxSeries: envInt("METRICS_MAX_INSTANCES", 500),
+		token:     os.Getenv("METRICS_TOKEN"),
+		instances: make(map[string]*instanceCounters),
+	}
+	if m.labels != metricsLabelsID && m.labels != metricsLabelsHash {
+		m.labels = metricsLabelsOff
+	}
+	for _, id := range strings.Split(os.Getenv("METRICS_INSTANCES"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			if m.allowed == nil {
+				m.allowed = make(map[string]bool)
+			}
+			m.allowed[id] = true
+		}
+	}
+	metrics = m
+
+	if m.labels != metricsLabelsOff {
+		log.Info().Str("labels", m.labels).Int("instances", len(m.allowed)).Int("maxSeries", m.maxSeries).Msg("Per-instance metrics enabled")
+	}
+}
+
+// label returns the label value of an instance, or "" when it gets no series of its own
+func (m *metricsRegistry) label(userID string) string {
+	if m.labels == metricsLabelsOff || userID == "" {
+		return ""
+	}
+	if m.allowed != nil && !m.allowed[userID] {
+		return ""
+	}
+	if m.labels == metricsLabelsHash {
+		sum := sha256.Sum256([]byte(userID))
+		return hex.EncodeToString(sum[:8])
+	}
+	return userID
+}
+
+// instance returns the series label and counters of an instance, or nil when it is not labeled
+func (m *metricsRegistry) instance(userID string) (string, *instanceCounters) {
+	label := m.label(userID)
+	if label == "" {
+		return "", nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if c, ok := m.instances[label]; ok {
+		return label, c
+	}
+	// Past the cap new instances share one series, so a large fleet cannot blow up cardinality
+	if m.maxSeries > 0 && len(m.instances) >= m.maxSeries {
+		label = metricsOtherInstance
+		if c, ok := m.instances[label]; ok {
+			return label, c
+		}
+	}
+	c := &instanceCounters{}
+	m.instances[label] = c
+	return label, c
+}
+
+func (m *metricsRegistry) add(userID string, counter func(*instanceCounters) *atomic.Int64) {
+	counter(&m.global).Add(1)
+	if _, c := m.instance(userID); c != nil {
+		counter(c).Add(1)
+	}
+}
+
+func (m *metricsRegistry) messageSent(userID string) {
+	m.add(userID, func(c *instanceCounters) *atomic.Int64 { return &c.sent })
+}
+
+func (m *metricsRegistry) messageReceived(userID string) {
+	m.add(userID, func(c *instanceCounters) *atomic.Int64 { return &c.received })
+}
+
+func (m *metricsRegistry) webhookDelivery(userID string, err error) {
+	if err != nil {
+		m.add(userID, func(c *instanceCounters) *atomic.Int64 { return &c.webhookFailed })
+		return
+	}
+	m.add(userID, func(c *instanceCounters) *atomic.Int64 { return &c.webhookOK })
+}
+
+func (m *metricsRegistry) authFailure(credential string) {
+	if credential == "admin" {
+		m.authFailedAdmin.Add(1)
+		return
+	}
+	m.authFailedUser.Add(1)
+}
+
+func (m *metricsRegistry) authBan() {
+	m.authBans.Add(1)
+}
+
+// statusRecorder keeps the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// Metrics serves the metrics in the Prometheus text format
+// @Summary Prometheus metrics
+// @Description Returns gateway metrics in the Prometheus text format. With METRICS_INSTANCE_LABELS set to id or hash, per-instance series with a user label are added, limited to METRICS_INSTANCES when set and to METRICS_MAX_INSTANCES series (the rest are counted under user="other"). When METRICS_TOKEN is set it must be sent as a bearer token.
+// @Tags Health
+// @Produce plain
+// @Success 200 {string} string "Metrics"
+// @Failure 401 {object} api.ErrorResponse
+// @Router /metrics [get]
+func (s *server) Metrics() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if metrics.token != "" && r.Header.Get("Authorization") != "Bearer "+metrics.token {
+			s.Respond(w, r, http.StatusUnauthorized, fmt.Errorf("unauthorized"))
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		metrics.write(w)
+	}
+}
+
+// write renders all series
+func (m *metricsRegistry) write(w io.Writer) {
+	clients, connected := clientManager.ConnectionCounts()
+
+	gauge(w, "maxapi_uptime_seconds", "Seconds since the gateway started", int64(time.Since(processStarted).Seconds()))
+	gauge(w, "maxapi_goroutines", "Number of goroutines", int64(runtime.NumGoroutine()))
+	gauge(w, "maxapi_instances", "Running instances", int64(clients))
+	gauge(w, "maxapi_instances_connected", "Instances connected to MAX", int64(connected))
+
+	counter(w, "maxapi_messages_sent_total", "Messages sent through the API", m.global.sent.Load())
+	counter(w, "maxapi_messages_received_total", "Messages received from MAX", m.global.received.Load())
+	fmt.Fprintf(w, "# HELP maxapi_webhook_deliveries_total Webhook delivery attempts by result\n# TYPE maxapi_webhook_deliveries_total counter\n")
+	fmt.Fprintf(w, "maxapi_webhook_deliveries_total{result=\"ok\"} %d\n", m.global.webhookOK.Load())
+	fmt.Fprintf(w, "maxapi_webhook_deliveries_total{result=\"failed\"} %d\n", m.global.webhookFailed.Load())
+	fmt.Fprintf(w, "# HELP maxapi_auth_failures_total Failed authentications by credential\n# TYPE maxapi_auth_failures_total counter\n")
+	fmt.Fprintf(w, "maxapi_auth_failures_total{credential=\"user\"} %d\n", m.authFailedUser.Load())
+	fmt.Fprintf(w, "maxapi_auth_failures_total{credential=\"admin\"} %d\n", m.authFailedAdmin.Load())
+	counter(w, "maxapi_auth_bans_total", "Client addresses banned after failed authentications", m.authBans.Load())
+
+	if m.labels == metricsLabelsOff {
+		return
+	}
+
+	// Connection state of the labeled instances
+	states := map[string]int64{}
+	clientManager.RLock()
+	for userID, client := range clientManager.maxClients {
+		label, c := m.instance(userID)
+		if c == nil {
+			continue
+		}
+		if client.IsConnected() {
+			states[label]++
+		} else if _, ok := states[label]; !ok {
+			states[label] = 0
+		}
+	}
+	clientManager.RUnlock()
+
+	m.mu.Lock()
+	labels := make([]string, 0, len(m.instances))
+	series := make(map[string]*instanceCounters, len(m.instances))
+	for label, c := range m.instances {
+		labels = append(labels, label)
+		series[label] = c
+	}
+	m.mu.Unlock()
+	sort.Strings(labels)
+
+	fmt.Fprintf(w, "# HELP maxapi_instance_connected Connected instances per user label\n# TYPE maxapi_instance_connected gauge\n")
+	stateLabels := make([]string, 0, len(states))
+	for label := range states {
+		stateLabels = append(stateLabels, label)
+	}
+	sort.Strings(stateLabels)
+	for _, label := range stateLabels {
+		fmt.Fprintf(w, "maxapi_instance_connected{user=%q} %d\n", label, states[label])
+	}
+
+	fmt.Fprintf(w, "# HELP maxapi_instance_messages_sent_total Messages sent per user label\n# TYPE maxapi_instance_messages_sent_total counter\n")
+	for _, label := range labels {
+		fmt.Fprintf(w, "maxapi_instance_messages_sent_total{user=%q} %d\n", label, series[label].sent.Load())
+	}
+	fmt.Fprintf(w, "# HELP maxapi_instance_messages_received_total Messages received per user label\n# TYPE maxapi_instance_messages_received_total counter\n")
+	for _, label := range labels {
+		fmt.Fprintf(w, "maxapi_instance_messages_received_total{user=%q} %d\n", label, series[label].received.Load())
+	}
+	fmt.Fprintf(w, "# HELP maxapi_instance_webhook_deliveries_total Webhook delivery attempts per user label and result\n# TYPE maxapi_instance_webhook_deliveries_total counter\n")
+	for _, label := range labels {
+		fmt.Fprintf(w, "maxapi_instance_webhook_deliveries_total{user=%q,result=\"ok\"} %d\n", label, series[label].webhookOK.Load())
+		fmt.Fprintf(w, "maxapi_instance_webhook_deliveries_total{user=%q,result=\"failed\"} %d\n", label, series[label].webhookFailed.Load())
+	}
+}
+
+func gauge(w io.Writer, name, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s gauge\n%s %d\n", name, help, name, name, value)
+}
+
+func counter(w io.Writer, name, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n", name, help, name, name, value)
+}
@@ -32,6 +32,126 @@ var migrations = []Migration{
 		Name:  "add_message_history",
 		UpSQL: addMessageHistorySQL,
 	},
+	{
+		ID:    4,
+		Name:  "add_quiet_hours",
+		UpSQL: addQuietHoursSQL,
+	},
+	{
+		ID:    5,
+		Name:  "add_blocklist",
+		UpSQL: addBlocklistSQL,
+	},
+	{
+		ID:    6,
+		Name:  "add_campaigns",
+		UpSQL: addCampaignsSQL,
+	},
+	{
+		ID:    7,
+		Name:  "add_storage_backends",
+		UpSQL: addStorageBackendsSQL,
+	},
+	{
+		ID:    8,
+		Name:  "add_presigned_urls",
+		UpSQL: addPresignedURLsSQL,
+	},
+	{
+		ID:    9,
+		Name:  "add_media_index",
+		UpSQL: addMediaIndexSQL,
+	},
+	{
+		ID:    10,
+		Name:  "add_redaction",
+		UpSQL: addRedactionSQL,
+	},
+	{
+		ID:    11,
+		Name:  "add_gdpr_audit",
+		UpSQL: addGDPRAuditSQL,
+	},
+	{
+		ID:    12,
+		Name:  "add_webhook_queue",
+		UpSQL: addWebhookQueueSQL,
+	},
+	{
+		ID:    13,
+		Name:  "add_webhook_secret",
+		UpSQL: addWebhookSecretSQL,
+	},
+	{
+		ID:    14,
+		Name:  "add_user_config",
+		UpSQL: addUserConfigSQL,
+	},
+	{
+		ID:    15,
+		Name:  "add_feature_flags",
+		UpSQL: addFeatureFlagsSQL,
+	},
+	{
+		ID:    16,
+		Name:  "add_connection_log",
+		UpSQL: addConnectionLogSQL,
+	},
+	{
+		ID:    17,
+		Name:  "add_scheduled_messages",
+		UpSQL: addScheduledMessagesSQL,
+	},
+	{
+		ID:    18,
+		Name:  "add_allowed_ips",
+		UpSQL: addAllowedIPsSQL,
+	},
+	{
+		ID:    19,
+		Name:  "add_auto_mark_read",
+		UpSQL: addAutoMarkReadSQL,
+	},
+	{
+		ID:    20,
+		Name:  "add_presence_subscriptions",
+		UpSQL: addPresenceSubscriptionsSQL,
+	},
+	{
+		ID:    21,
+		Name:  "add_restriction",
+		UpSQL: addRestrictionSQL,
+	},
+	{
+		ID:    22,
+		Name:  "add_authenticated_at",
+		UpSQL: addAuthenticatedAtSQL,
+	},
+	{
+		ID:    23,
+		Name:  "add_content_policy",
+		UpSQL: addContentPolicySQL,
+	},
+	{
+		ID:    24,
+		Name:  "add_connection_window",
+		UpSQL: addConnectionWindowSQL,
+	},
+	{
+		ID:    25,
+		Name:  "add_locale_timezone",
+		UpSQL: addLocaleTimezoneSQL,
+	},
+	{
+		ID:    26,
+		Name:  "add_viewer_token",
+		UpSQL: addViewerTokenSQL,
+	},
+	{
+		ID:    27,
+		Name:  "add_changefeed",
+		UpSQL: addChangefeedSQL,
+	},
 }
 
 // Initial schema for MaxAPI
@@ -131,6 +251,415 @@ BEGIN
 END $$;
 `
 
+const addQuietHoursSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'quiet_hours_enabled') THEN
+        ALTER TABLE users ADD COLUMN quiet_hours_enabled BOOLEAN DEFAULT FALSE;
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'quiet_hours_start') THEN
+        ALTER TABLE users ADD COLUMN quiet_hours_start TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'quiet_hours_end') THEN
+        ALTER TABLE users ADD COLUMN quiet_hours_end TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'quiet_hours_timezone') THEN
+        ALTER TABLE users ADD COLUMN quiet_hours_timezone TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'deferred_messages') THEN
+        CREATE TABLE deferred_messages (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            path TEXT NOT NULL,
+            body TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            deliver_at BIGINT NOT NULL,
+            created_at BIGINT NOT NULL,
+            attempts INTEGER NOT NULL DEFAULT 0,
+            last_error TEXT DEFAULT ''
+        );
+        CREATE INDEX idx_deferred_messages_deliver_at ON deferred_messages (deliver_at);
+    END IF;
+END $$;
+`
+
+const addBlocklistSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'optout_keywords') THEN
+        ALTER TABLE users ADD COLUMN optout_keywords TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'blocklist') THEN
+        CREATE TABLE blocklist (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            recipient_type TEXT NOT NULL,
+            recipient TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL,
+            UNIQUE (user_id, recipient_type, recipient)
+        );
+    END IF;
+END $$;
+`
+
+const addCampaignsSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'campaigns') THEN
+        CREATE TABLE campaigns (
+            id TEXT PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            name TEXT NOT NULL DEFAULT '',
+            template TEXT NOT NULL,
+            status TEXT NOT NULL,
+            min_delay INTEGER NOT NULL DEFAULT 5,
+            max_delay INTEGER NOT NULL DEFAULT 15,
+            notify BOOLEAN NOT NULL DEFAULT TRUE,
+            created_at BIGINT NOT NULL,
+            completed_at BIGINT NOT NULL DEFAULT 0
+        );
+        CREATE INDEX idx_campaigns_user_id ON campaigns (user_id);
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'campaign_recipients') THEN
+        CREATE TABLE campaign_recipients (
+            id SERIAL PRIMARY KEY,
+            campaign_id TEXT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+            user_id TEXT NOT NULL,
+            phone TEXT NOT NULL DEFAULT '',
+            chat_id BIGINT NOT NULL DEFAULT 0,
+            variables TEXT NOT NULL DEFAULT '',
+            status TEXT NOT NULL DEFAULT 'pending',
+            message_id TEXT NOT NULL DEFAULT '',
+            error TEXT NOT NULL DEFAULT '',
+            sent_at BIGINT NOT NULL DEFAULT 0,
+            updated_at BIGINT NOT NULL DEFAULT 0
+        );
+        CREATE INDEX idx_campaign_recipients_campaign ON campaign_recipients (campaign_id, status);
+        CREATE INDEX idx_campaign_recipients_chat ON campaign_recipients (user_id, chat_id, status);
+    END IF;
+END $$;
+`
+
+const addStorageBackendsSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'storage_backend') THEN
+        ALTER TABLE users ADD COLUMN storage_backend TEXT DEFAULT 's3';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'azure_account') THEN
+        ALTER TABLE users ADD COLUMN azure_account TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'azure_container') THEN
+        ALTER TABLE users ADD COLUMN azure_container TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'azure_sas_token') THEN
+        ALTER TABLE users ADD COLUMN azure_sas_token TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+const addPresignedURLsSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 's3_presign_ttl') THEN
+        ALTER TABLE users ADD COLUMN s3_presign_ttl INTEGER DEFAULT 0;
+    END IF;
+END $$;
+`
+
+const addMediaIndexSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'media') THEN
+        CREATE TABLE media (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            chat_id BIGINT NOT NULL DEFAULT 0,
+            message_id TEXT NOT NULL DEFAULT '',
+            direction TEXT NOT NULL,
+            media_type TEXT NOT NULL,
+            remote_id TEXT NOT NULL DEFAULT '',
+            file_name TEXT NOT NULL DEFAULT '',
+            mime_type TEXT NOT NULL DEFAULT '',
+            size BIGINT NOT NULL DEFAULT 0,
+            checksum TEXT NOT NULL DEFAULT '',
+            storage_backend TEXT NOT NULL DEFAULT '',
+            storage_key TEXT NOT NULL DEFAULT '',
+            url TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL,
+            UNIQUE (user_id, message_id, media_type, remote_id)
+        );
+        CREATE INDEX idx_media_user_chat ON media (user_id, chat_id, created_at);
+        CREATE INDEX idx_media_user_checksum ON media (user_id, checksum);
+    END IF;
+END $$;
+`
+
+const addRedactionSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'redaction') THEN
+        ALTER TABLE users ADD COLUMN redaction TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+const addGDPRAuditSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'gdpr_audit') THEN
+        CREATE TABLE gdpr_audit (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL,
+            action TEXT NOT NULL,
+            ip TEXT NOT NULL DEFAULT '',
+            details TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL
+        );
+        CREATE INDEX idx_gdpr_audit_user ON gdpr_audit (user_id, created_at);
+    END IF;
+END $$;
+`
+
+const addWebhookQueueSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'webhook_queue') THEN
+        CREATE TABLE webhook_queue (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            url TEXT NOT NULL,
+            payload TEXT NOT NULL,
+            status TEXT NOT NULL DEFAULT 'pending',
+            attempts INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at BIGINT NOT NULL,
+            last_error TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL
+        );
+        CREATE INDEX idx_webhook_queue_due ON webhook_queue (status, next_attempt_at);
+        CREATE INDEX idx_webhook_queue_user ON webhook_queue (user_id, status);
+    END IF;
+END $$;
+`
+
+const addWebhookSecretSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'webhook_secret') THEN
+        ALTER TABLE users ADD COLUMN webhook_secret TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Per-user integration settings (RabbitMQ routing) as JSON
+const addUserConfigSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'user_config') THEN
+        ALTER TABLE users ADD COLUMN user_config TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Per-user feature flag overrides as JSON
+const addFeatureFlagsSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'features') THEN
+        ALTER TABLE users ADD COLUMN features TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Connection state transitions for uptime reporting
+const addConnectionLogSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'connection_log') THEN
+        CREATE TABLE connection_log (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            state TEXT NOT NULL,
+            reason TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL
+        );
+        CREATE INDEX idx_connection_log_user ON connection_log (user_id, created_at);
+    END IF;
+END $$;
+`
+
+const addScheduledMessagesSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'scheduled_messages') THEN
+        CREATE TABLE scheduled_messages (
+            id SERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+            body TEXT NOT NULL,
+            send_at BIGINT NOT NULL,
+            status TEXT NOT NULL DEFAULT 'pending',
+            attempts INTEGER NOT NULL DEFAULT 0,
+            next_attempt_at BIGINT NOT NULL,
+            message_id TEXT NOT NULL DEFAULT '',
+            last_error TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL,
+            sent_at BIGINT NOT NULL DEFAULT 0
+        );
+        CREATE INDEX idx_scheduled_messages_due ON scheduled_messages (status, next_attempt_at);
+        CREATE INDEX idx_scheduled_messages_user ON scheduled_messages (user_id, send_at);
+    END IF;
+END $$;
+`
+
+// Per-user source address allowlist as a comma-separated list
+const addAllowedIPsSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'allowed_ips') THEN
+        ALTER TABLE users ADD COLUMN allowed_ips TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Per-user auto mark-read setting: ” (off), 'all' or comma-separated chat IDs
+const addAutoMarkReadSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'auto_mark_read') THEN
+        ALTER TABLE users ADD COLUMN auto_mark_read TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Presence subscriptions restored on every connect: comma-separated MAX user IDs
+const addPresenceSubscriptionsSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'presence_subscriptions') THEN
+        ALTER TABLE users ADD COLUMN presence_subscriptions TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Account restriction reported by MAX, stored as JSON while sending is paused
+const addRestrictionSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'restriction') THEN
+        ALTER TABLE users ADD COLUMN restriction TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Time of the last authentication in Unix seconds, the start of the warm-up
+const addAuthenticatedAtSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'authenticated_at') THEN
+        ALTER TABLE users ADD COLUMN authenticated_at BIGINT DEFAULT 0;
+    END IF;
+END $$;
+`
+
+// Outbound content policy set by the operator, as JSON
+const addContentPolicySQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'content_policy') THEN
+        ALTER TABLE users ADD COLUMN content_policy TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Daily hours the instance stays connected, as JSON
+const addConnectionWindowSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'connection_window') THEN
+        ALTER TABLE users ADD COLUMN connection_window TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Default language and timezone of the instance
+const addLocaleTimezoneSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'locale') THEN
+        ALTER TABLE users ADD COLUMN locale TEXT DEFAULT '';
+    END IF;
+
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'timezone') THEN
+        ALTER TABLE users ADD COLUMN timezone TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Read-only token of the instance, stored like the user token
+const addViewerTokenSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'viewer_token') THEN
+        ALTER TABLE users ADD COLUMN viewer_token TEXT DEFAULT '';
+    END IF;
+END $$;
+`
+
+// Outbox of state changes for external replicas. It has no foreign key so
+// the deletion of a user stays in the feed.
+const addChangefeedSQL = `
+-- PostgreSQL version
+DO $$
+BEGIN
+    IF NOT EXISTS (SELECT 1 FROM information_schema.tables WHERE table_name = 'changefeed') THEN
+        CREATE TABLE changefeed (
+            id BIGSERIAL PRIMARY KEY,
+            user_id TEXT NOT NULL,
+            entity TEXT NOT NULL,
+            action TEXT NOT NULL,
+            entity_id TEXT NOT NULL DEFAULT '',
+            data TEXT NOT NULL DEFAULT '',
+            created_at BIGINT NOT NULL
+        );
+        CREATE INDEX idx_changefeed_user ON changefeed (user_id, id);
+        CREATE INDEX idx_changefeed_created ON changefeed (created_at);
+    END IF;
+END $$;
+`
+
 // GenerateRandomID creates a random string ID
 func GenerateRandomID() (string, error) {
 	bytes := make([]byte, 16) // 128 bits
@@ -238,7 +767,7 @@ func applyMigration(db *sqlx.DB, migration Migration) error {
 	}()
 
 	// Apply migration based on database type
-		if db.DriverName() == "sqlite" {
+	if db.DriverName() == "sqlite" {
 		err = applySQLiteMigration(tx, migration)
 	} else {
 		_, err = tx.Exec(migration.UpSQL)
@@ -265,7 +794,7 @@ func applySQLiteMigration(tx *sqlx.Tx, migration Migration) error {
 	switch migration.ID {
 	case 1:
 		// Initial schema for SQLite
-			err = createTableIfNotExistsSQLite(tx, "users", `
+		err = createTableIfNotExistsSQLite(tx, "users", `
                 CREATE TABLE users (
                     id TEXT PRIMARY KEY,
                     name TEXT NOT NULL,
@@ -290,38 +819,38 @@ func applySQLiteMigration(tx *sqlx.Tx, migration Migration) error {
 
 	case 2:
 		// S3 support columns for SQLite
-			err = addColumnIfNotExistsSQLite(tx, "users", "s3_enabled", "BOOLEAN DEFAULT 0")
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_endpoint", "TEXT DEFAULT ''")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_region", "TEXT DEFAULT ''")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_bucket", "TEXT DEFAULT ''")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_access_key", "TEXT DEFAULT ''")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_secret_key", "TEXT DEFAULT ''")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_path_style", "BOOLEAN DEFAULT 1")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_public_url", "TEXT DEFAULT ''")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "media_delivery", "TEXT DEFAULT 'base64'")
-			}
-			if err == nil {
-				err = addColumnIfNotExistsSQLite(tx, "users", "s3_retention_days", "INTEGER DEFAULT 30")
-			}
+		err = addColumnIfNotExistsSQLite(tx, "users", "s3_enabled", "BOOLEAN DEFAULT 0")
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_endpoint", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_region", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_bucket", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_access_key", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_secret_key", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_path_style", "BOOLEAN DEFAULT 1")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_public_url", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "media_delivery", "TEXT DEFAULT 'base64'")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "s3_retention_days", "INTEGER DEFAULT 30")
+		}
 
 	case 3:
 		// Message history table for SQLite
-			err = createTableIfNotExistsSQLite(tx, "message_history", `
+		err = createTableIfNotExistsSQLite(tx, "message_history", `
 				CREATE TABLE message_history (
 					id INTEGER PRIMARY KEY AUTOINCREMENT,
 					user_id TEXT NOT NULL,
@@ -335,11 +864,290 @@ func applySQLiteMigration(tx *sqlx.Tx, migration Migration) error {
 				reply_to_id TEXT,
 					UNIQUE(user_id, message_id)
 				)`)
-			if err == nil {
-				_, err = tx.Exec(`
+		if err == nil {
+			_, err = tx.Exec(`
 					CREATE INDEX IF NOT EXISTS idx_message_history_user_chat_timestamp 
 				ON message_history (user_id, chat_id, timestamp DESC)`)
-			}
+		}
+
+	case 4:
+		// Quiet hours columns and deferred send queue for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "quiet_hours_enabled", "BOOLEAN DEFAULT 0")
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "quiet_hours_start", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "quiet_hours_end", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "quiet_hours_timezone", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = createTableIfNotExistsSQLite(tx, "deferred_messages", `
+				CREATE TABLE deferred_messages (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					path TEXT NOT NULL,
+					body TEXT NOT NULL,
+					reason TEXT NOT NULL DEFAULT '',
+					deliver_at INTEGER NOT NULL,
+					created_at INTEGER NOT NULL,
+					attempts INTEGER NOT NULL DEFAULT 0,
+					last_error TEXT DEFAULT ''
+				)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_deferred_messages_deliver_at ON deferred_messages (deliver_at)`)
+		}
+
+	case 5:
+		// Recipient blocklist and opt-out keywords for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "optout_keywords", "TEXT DEFAULT ''")
+		if err == nil {
+			err = createTableIfNotExistsSQLite(tx, "blocklist", `
+				CREATE TABLE blocklist (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+					recipient_type TEXT NOT NULL,
+					recipient TEXT NOT NULL,
+					reason TEXT NOT NULL DEFAULT '',
+					created_at INTEGER NOT NULL,
+					UNIQUE (user_id, recipient_type, recipient)
+				)`)
+		}
+
+	case 6:
+		// Campaign tables for SQLite
+		err = createTableIfNotExistsSQLite(tx, "campaigns", `
+			CREATE TABLE campaigns (
+				id TEXT PRIMARY KEY,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL DEFAULT '',
+				template TEXT NOT NULL,
+				status TEXT NOT NULL,
+				min_delay INTEGER NOT NULL DEFAULT 5,
+				max_delay INTEGER NOT NULL DEFAULT 15,
+				notify BOOLEAN NOT NULL DEFAULT 1,
+				created_at INTEGER NOT NULL,
+				completed_at INTEGER NOT NULL DEFAULT 0
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_campaigns_user_id ON campaigns (user_id)`)
+		}
+		if err == nil {
+			err = createTableIfNotExistsSQLite(tx, "campaign_recipients", `
+				CREATE TABLE campaign_recipients (
+					id INTEGER PRIMARY KEY AUTOINCREMENT,
+					campaign_id TEXT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+					user_id TEXT NOT NULL,
+					phone TEXT NOT NULL DEFAULT '',
+					chat_id INTEGER NOT NULL DEFAULT 0,
+					variables TEXT NOT NULL DEFAULT '',
+					status TEXT NOT NULL DEFAULT 'pending',
+					message_id TEXT NOT NULL DEFAULT '',
+					error TEXT NOT NULL DEFAULT '',
+					sent_at INTEGER NOT NULL DEFAULT 0,
+					updated_at INTEGER NOT NULL DEFAULT 0
+				)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_campaign_recipients_campaign ON campaign_recipients (campaign_id, status)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_campaign_recipients_chat ON campaign_recipients (user_id, chat_id, status)`)
+		}
+
+	case 7:
+		// Storage backend selection for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "storage_backend", "TEXT DEFAULT 's3'")
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "azure_account", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "azure_container", "TEXT DEFAULT ''")
+		}
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "azure_sas_token", "TEXT DEFAULT ''")
+		}
+
+	case 8:
+		// Presigned URL TTL for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "s3_presign_ttl", "INTEGER DEFAULT 0")
+
+	case 9:
+		// Media index for SQLite
+		err = createTableIfNotExistsSQLite(tx, "media", `
+			CREATE TABLE media (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				chat_id INTEGER NOT NULL DEFAULT 0,
+				message_id TEXT NOT NULL DEFAULT '',
+				direction TEXT NOT NULL,
+				media_type TEXT NOT NULL,
+				remote_id TEXT NOT NULL DEFAULT '',
+				file_name TEXT NOT NULL DEFAULT '',
+				mime_type TEXT NOT NULL DEFAULT '',
+				size INTEGER NOT NULL DEFAULT 0,
+				checksum TEXT NOT NULL DEFAULT '',
+				storage_backend TEXT NOT NULL DEFAULT '',
+				storage_key TEXT NOT NULL DEFAULT '',
+				url TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL,
+				UNIQUE (user_id, message_id, media_type, remote_id)
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_media_user_chat ON media (user_id, chat_id, created_at)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_media_user_checksum ON media (user_id, checksum)`)
+		}
+
+	case 10:
+		// PII redaction settings for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "redaction", "TEXT DEFAULT ''")
+
+	case 11:
+		// GDPR audit trail for SQLite. It has no foreign key so entries outlive the user.
+		err = createTableIfNotExistsSQLite(tx, "gdpr_audit", `
+			CREATE TABLE gdpr_audit (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL,
+				action TEXT NOT NULL,
+				ip TEXT NOT NULL DEFAULT '',
+				details TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_gdpr_audit_user ON gdpr_audit (user_id, created_at)`)
+		}
+
+	case 12:
+		// Webhook retry queue for SQLite
+		err = createTableIfNotExistsSQLite(tx, "webhook_queue", `
+			CREATE TABLE webhook_queue (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				url TEXT NOT NULL,
+				payload TEXT NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at INTEGER NOT NULL,
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_queue_due ON webhook_queue (status, next_attempt_at)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_queue_user ON webhook_queue (user_id, status)`)
+		}
+
+	case 13:
+		// Webhook signing secret for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "webhook_secret", "TEXT DEFAULT ''")
+
+	case 14:
+		// Per-user integration settings for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "user_config", "TEXT DEFAULT ''")
+
+	case 15:
+		// Feature flag overrides for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "features", "TEXT DEFAULT ''")
+
+	case 16:
+		// Connection log for SQLite
+		err = createTableIfNotExistsSQLite(tx, "connection_log", `
+			CREATE TABLE connection_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				state TEXT NOT NULL,
+				reason TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_connection_log_user ON connection_log (user_id, created_at)`)
+		}
+
+	case 17:
+		// Scheduled messages for SQLite
+		err = createTableIfNotExistsSQLite(tx, "scheduled_messages", `
+			CREATE TABLE scheduled_messages (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+				body TEXT NOT NULL,
+				send_at INTEGER NOT NULL,
+				status TEXT NOT NULL DEFAULT 'pending',
+				attempts INTEGER NOT NULL DEFAULT 0,
+				next_attempt_at INTEGER NOT NULL,
+				message_id TEXT NOT NULL DEFAULT '',
+				last_error TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL,
+				sent_at INTEGER NOT NULL DEFAULT 0
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_scheduled_messages_due ON scheduled_messages (status, next_attempt_at)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_scheduled_messages_user ON scheduled_messages (user_id, send_at)`)
+		}
+
+	case 18:
+		// Source address allowlist for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "allowed_ips", "TEXT DEFAULT ''")
+
+	case 19:
+		// Auto mark-read setting for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "auto_mark_read", "TEXT DEFAULT ''")
+
+	case 20:
+		// Presence subscriptions for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "presence_subscriptions", "TEXT DEFAULT ''")
+
+	case 21:
+		// Account restriction for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "restriction", "TEXT DEFAULT ''")
+
+	case 22:
+		// Authentication time for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "authenticated_at", "INTEGER DEFAULT 0")
+
+	case 23:
+		// Content policy for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "content_policy", "TEXT DEFAULT ''")
+
+	case 24:
+		// Connection window for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "connection_window", "TEXT DEFAULT ''")
+
+	case 25:
+		// Locale and timezone for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "locale", "TEXT DEFAULT ''")
+		if err == nil {
+			err = addColumnIfNotExistsSQLite(tx, "users", "timezone", "TEXT DEFAULT ''")
+		}
+
+	case 26:
+		// Viewer token for SQLite
+		err = addColumnIfNotExistsSQLite(tx, "users", "viewer_token", "TEXT DEFAULT ''")
+
+	case 27:
+		// Changefeed for SQLite. AUTOINCREMENT keeps cursors from being reused after trimming.
+		err = createTableIfNotExistsSQLite(tx, "changefeed", `
+			CREATE TABLE changefeed (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id TEXT NOT NULL,
+				entity TEXT NOT NULL,
+				action TEXT NOT NULL,
+				entity_id TEXT NOT NULL DEFAULT '',
+				data TEXT NOT NULL DEFAULT '',
+				created_at INTEGER NOT NULL
+			)`)
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_changefeed_user ON changefeed (user_id, id)`)
+		}
+		if err == nil {
+			_, err = tx.Exec(`CREATE INDEX IF NOT EXISTS idx_changefeed_created ON changefeed (created_at)`)
+		}
 
 	default:
 		// For any future migrations, try to execute the SQL directly
@@ -1,368 +1,889 @@
 package main
 
+import (
+	"maxapi/handlers/chat"
+	"maxapi/maxclient"
+)
+
 // Swagger model definitions for API documentation
 
-// ========== BASE RESPONSE ==========
+// ========== CHAT RESPONSES ==========
 
-// ErrorResponse represents an error response
-// @Description Error response format
-type ErrorResponse struct {
-	Success bool   `json:"success" example:"false"`
-	Error   string `json:"error" example:"error message"`
+// FoldersResponse represents the list of chat folders
+type FoldersResponse struct {
+	Success bool               `json:"success" example:"true"`
+	Folders []maxclient.Folder `json:"folders"`
+	Count   int                `json:"count" example:"2"`
 }
 
-// MessageResponse represents a simple success response with message
-// @Description Simple success response with message
-type MessageResponse struct {
-	Success bool   `json:"success" example:"true"`
-	Message string `json:"message" example:"Operation completed"`
+// FolderResponse represents a saved chat folder
+type FolderResponse struct {
+	Success bool             `json:"success" example:"true"`
+	Folder  maxclient.Folder `json:"folder"`
 }
 
-// ========== AUTH RESPONSES ==========
+// LimitsResponse represents the account limits
+// @Description Response with the limits reported by MAX and the upload limit enforced by the gateway
+type LimitsResponse struct {
+	Success           bool             `json:"success" example:"true"`
+	Limits            maxclient.Limits `json:"limits"`
+	UploadLimit       int64            `json:"uploadLimit" example:"4294967296"`
+	UploadLimitSource string           `json:"uploadLimitSource" example:"max"`
+}
 
-// AuthRequestResponse represents the response for auth code request
-// @Description Response after requesting SMS verification code
-type AuthRequestResponse struct {
-	Success   bool   `json:"success" example:"true"`
-	Message   string `json:"message" example:"Verification code sent"`
-	TempToken string `json:"tempToken" example:"temp_token_value"`
+// RestrictionResponse represents the account restriction
+// @Description Response with the restriction MAX reported for the account, null when sending is allowed
+type RestrictionResponse struct {
+	Success     bool                `json:"success" example:"true"`
+	Restricted  bool                `json:"restricted" example:"true"`
+	Restriction *AccountRestriction `json:"restriction"`
 }
 
-// AuthConfirmResponse represents the response for auth code confirmation
-// @Description Response after confirming SMS verification code
-type AuthConfirmResponse struct {
-	Success              bool   `json:"success" example:"true"`
-	Message              string `json:"message" example:"Login successful"`
-	AuthToken            string `json:"authToken,omitempty" example:"auth_token_value"`
-	RegisterToken        string `json:"registerToken,omitempty" example:"register_token_value"`
-	RequiresRegistration bool   `json:"requiresRegistration" example:"false"`
+// UptimeResponse represents the availability history of an instance
+// @Description Response with daily availability and recent disconnects
+type UptimeResponse struct {
+	Success           bool          `json:"success" example:"true"`
+	Current           string        `json:"current" example:"up"`
+	Availability      float64       `json:"availability" example:"99.87"`
+	Days              []DailyUptime `json:"days"`
+	RecentDisconnects []Disconnect  `json:"recentDisconnects"`
+}
+
+// ========== GROUP RESPONSES ==========
+
+// GroupAdminsResponse represents the admins of a group after a change
+// @Description Response with the owner and admins of a group
+type GroupAdminsResponse struct {
+	Success bool                  `json:"success" example:"true"`
+	ChatID  int64                 `json:"chatId" example:"123456789"`
+	Admins  []maxclient.ChatAdmin `json:"admins"`
+}
+
+// JoinRequestsResponse represents the pending requests to join a group
+// @Description Response with pending join requests. Marker is 0 after the last page.
+type JoinRequestsResponse struct {
+	Success  bool                    `json:"success" example:"true"`
+	ChatID   int64                   `json:"chatId" example:"123456789"`
+	Requests []maxclient.JoinRequest `json:"requests"`
+	Count    int                     `json:"count" example:"1"`
+	Marker   int64                   `json:"marker" example:"0"`
+}
+
+// JoinRequestsDecideResponse represents the outcome of a join request decision
+// @Description Response with the decided join requests
+type JoinRequestsDecideResponse struct {
+	Success bool    `json:"success" example:"true"`
+	ChatID  int64   `json:"chatId" example:"123456789"`
+	Action  string  `json:"action" example:"approve"`
+	UserIDs []int64 `json:"userIds"`
 }
 
-// AuthRegisterResponse represents the response for user registration
-// @Description Response after successful registration
-type AuthRegisterResponse struct {
+// ChannelStatsResponse represents the statistics of a channel
+// @Description Response with subscriber count and recent post reactions of a channel
+type ChannelStatsResponse struct {
+	Success       bool               `json:"success" example:"true"`
+	ChatID        int64              `json:"chatId" example:"-68123456789"`
+	Title         string             `json:"title" example:"Company News"`
+	Subscribers   int                `json:"subscribers" example:"15230"`
+	MessagesCount int                `json:"messagesCount" example:"412"`
+	Posts         []ChannelPostStats `json:"posts"`
+}
+
+// ReadMarksResponse represents the read marks of chat members
+// @Description Response with the last-read position of each member. Marker is 0 after the last page.
+type ReadMarksResponse struct {
+	Success bool             `json:"success" example:"true"`
+	ChatID  int64            `json:"chatId" example:"-68123456789"`
+	Members []MemberReadMark `json:"members"`
+	Count   int              `json:"count" example:"50"`
+	Marker  int64            `json:"marker" example:"0"`
+}
+
+// BatchSendResult represents the outcome of one message of a batch
+type BatchSendResult struct {
+	Index     int    `json:"index" example:"0"`
+	Phone     string `json:"phone,omitempty" example:"+79001234567"`
+	ChatID    int64  `json:"chatId,omitempty" example:"246913578"`
 	Success   bool   `json:"success" example:"true"`
-	Message   string `json:"message" example:"Registration successful"`
-	AuthToken string `json:"authToken" example:"auth_token_value"`
+	Status    int    `json:"status,omitempty" example:"200"`
+	MessageID string `json:"messageId,omitempty" example:"115234567890123456"`
+	Error     string `json:"error,omitempty" example:"recipient is blocked"`
 }
 
-// ========== SESSION RESPONSES ==========
+// BatchSendResponse represents the result of a message batch
+type BatchSendResponse struct {
+	Success bool              `json:"success" example:"true"`
+	Sent    int               `json:"sent" example:"9"`
+	Failed  int               `json:"failed" example:"1"`
+	Results []BatchSendResult `json:"results"`
+}
 
-// StatusResponse represents the connection status response
-// @Description Connection and authentication status
-type StatusResponse struct {
-	Success       bool  `json:"success" example:"true"`
-	Connected     bool  `json:"connected" example:"true"`
-	Authenticated bool  `json:"authenticated" example:"true"`
-	LoggedIn      bool  `json:"loggedIn" example:"true"`
-	MaxUserID     int64 `json:"maxUserID" example:"123456789"`
+// ScheduledMessageResponse represents a scheduled message
+type ScheduledMessageResponse struct {
+	Success   bool             `json:"success" example:"true"`
+	Scheduled ScheduledMessage `json:"scheduled"`
 }
 
-// ========== CHAT RESPONSES ==========
+// ScheduledListResponse represents a page of scheduled messages
+type ScheduledListResponse struct {
+	Success    bool               `json:"success" example:"true"`
+	Scheduled  []ScheduledMessage `json:"scheduled"`
+	NextCursor string             `json:"nextCursor" example:"eyJvIjo1MH0"`
+}
 
-// SendMessageResponse represents the response after sending a message
-// @Description Response after sending a message
-type SendMessageResponse struct {
-	Success   bool  `json:"success" example:"true"`
-	MessageID int64 `json:"messageId" example:"987654321"`
-	ChatID    int64 `json:"chatId,omitempty" example:"123456789"`
+// ========== WEBHOOK RESPONSES ==========
+
+// WebhookSecretResponse represents the webhook signing settings
+// @Description Response with the signing status; the secret is only included when it was just set
+type WebhookSecretResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Enabled bool   `json:"enabled" example:"true"`
+	Secret  string `json:"secret,omitempty" example:"9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"`
+}
+
+// WebhookDeliveriesResponse represents queued or dead-lettered webhook deliveries
+// @Description Response with webhook deliveries and the total matching the status filter
+type WebhookDeliveriesResponse struct {
+	Success    bool                     `json:"success" example:"true"`
+	Deliveries []map[string]interface{} `json:"deliveries"`
+	Total      int                      `json:"total" example:"3"`
+}
+
+// WebhookFailedResponse represents the result of a replay or delete of failed webhooks
+// @Description Response with the number of affected deliveries
+type WebhookFailedResponse struct {
+	Success bool  `json:"success" example:"true"`
+	Count   int64 `json:"count" example:"3"`
 }
 
-// DownloadMediaResponse represents the response for downloading media
-// @Description Response with downloaded media data
-type DownloadMediaResponse struct {
+// ========== QUIET HOURS RESPONSES ==========
+
+// QuietHoursResponse represents the quiet hours settings
+// @Description Response with quiet hours settings
+type QuietHoursResponse struct {
 	Success  bool   `json:"success" example:"true"`
-	Data     string `json:"data" example:"base64_encoded_data"`
-	MimeType string `json:"mimeType" example:"image/jpeg"`
+	Enabled  bool   `json:"enabled" example:"true"`
+	Start    string `json:"start" example:"21:00"`
+	End      string `json:"end" example:"09:00"`
+	Timezone string `json:"timezone" example:"Europe/Moscow"`
+	Active   bool   `json:"active" example:"false"`
 }
 
-// DownloadVideoResponse represents the response for downloading video
-// @Description Response with downloaded video data
-type DownloadVideoResponse struct {
+// UserSettingsResponse represents the language and timezone of an instance
+// @Description Response with the default language and timezone; empty values use the defaults
+type UserSettingsResponse struct {
 	Success  bool   `json:"success" example:"true"`
-	Data     string `json:"data" example:"base64_encoded_data"`
-	MimeType string `json:"mimeType" example:"video/mp4"`
-	URL      string `json:"url" example:"https://example.com/video.mp4"`
+	Locale   string `json:"locale" example:"en"`
+	Timezone string `json:"timezone" example:"Europe/Moscow"`
 }
 
-// ChatHistoryResponse represents the response for chat history
-// @Description Response with chat history messages
-type ChatHistoryResponse struct {
-	Success  bool                     `json:"success" example:"true"`
-	Messages []map[string]interface{} `json:"messages"`
+// ViewerTokenResponse represents the viewer token of an instance
+// @Description Response with whether a viewer token is set; token is only returned when it is created
+type ViewerTokenResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Enabled bool   `json:"enabled" example:"true"`
+	Token   string `json:"token,omitempty" example:"0c6b4f0e-2f3a-4d5b-9e8c-7a1b2c3d4e5f"`
 }
 
-// ========== USER RESPONSES ==========
+// ConnectionWindowResponse represents the connection window of an instance
+// @Description Response with the connection window, whether it is open and when that changes next
+type ConnectionWindowResponse struct {
+	Success    bool   `json:"success" example:"true"`
+	Enabled    bool   `json:"enabled" example:"true"`
+	Start      string `json:"start" example:"08:00"`
+	End        string `json:"end" example:"20:00"`
+	Timezone   string `json:"timezone" example:"Europe/Moscow"`
+	Open       bool   `json:"open" example:"true"`
+	NextChange int64  `json:"nextChange" example:"1700046000"`
+}
+
+// DeferredQueueResponse represents the list of queued messages
+// @Description Response with messages waiting for delivery
+type DeferredQueueResponse struct {
+	Success  bool              `json:"success" example:"true"`
+	Messages []DeferredMessage `json:"messages"`
+}
+
+// ========== BLOCKLIST RESPONSES ==========
+
+// BlocklistResponse represents the blocklist and opt-out keywords
+// @Description Response with blocked recipients
+type BlocklistResponse struct {
+	Success  bool             `json:"success" example:"true"`
+	Entries  []BlocklistEntry `json:"entries"`
+	Keywords []string         `json:"keywords" example:"STOP,СТОП"`
+}
+
+// BlocklistChangeResponse represents the result of a blocklist change
+// @Description Response with number of changed entries
+type BlocklistChangeResponse struct {
+	Success bool `json:"success" example:"true"`
+	Count   int  `json:"count" example:"1"`
+}
+
+// OptOutKeywordsResponse represents the configured opt-out keywords
+// @Description Response with opt-out keywords
+type OptOutKeywordsResponse struct {
+	Success  bool     `json:"success" example:"true"`
+	Keywords []string `json:"keywords" example:"STOP,СТОП"`
+}
+
+// ========== STORAGE RESPONSES ==========
+
+// StorageResponse represents the media storage settings
+// @Description Response with media storage settings. Credentials are never returned.
+type StorageResponse struct {
+	Success        bool   `json:"success" example:"true"`
+	Enabled        bool   `json:"enabled" example:"true"`
+	Backend        string `json:"backend" example:"s3"`
+	MediaDelivery  string `json:"mediaDelivery" example:"both"`
+	RetentionDays  int    `json:"retentionDays" example:"30"`
+	PublicURL      string `json:"publicUrl" example:""`
+	Endpoint       string `json:"endpoint,omitempty" example:"https://s3.amazonaws.com"`
+	Region         string `json:"region,omitempty" example:"us-east-1"`
+	Bucket         string `json:"bucket,omitempty" example:"maxapi-media"`
+	PathStyle      bool   `json:"pathStyle,omitempty" example:"false"`
+	PresignTTL     int    `json:"presignTtl,omitempty" example:"3600"`
+	AzureAccount   string `json:"azureAccount,omitempty" example:""`
+	AzureContainer string `json:"azureContainer,omitempty" example:""`
+	HasCredentials bool   `json:"hasCredentials,omitempty" example:"true"`
+}
+
+// PresignResponse represents a signed media link
+// @Description Response with a short-lived signed GET URL
+type PresignResponse struct {
+	Success   bool   `json:"success" example:"true"`
+	URL       string `json:"url" example:"https://maxapi-media.s3.us-east-1.amazonaws.com/users/abc/inbox/...?X-Amz-Signature=..."`
+	Key       string `json:"key" example:"users/abc/inbox/123/2025/01/15/images/msg1.jpg"`
+	ExpiresAt int64  `json:"expiresAt" example:"1700003600"`
+}
 
-// CheckUserResultItem represents a single user check result
-// @Description Single user check result
-type CheckUserResultItem struct {
-	Phone     string `json:"phone" example:"79001234567"`
-	Exists    bool   `json:"exists" example:"true"`
-	MaxUserID int64  `json:"maxUserId" example:"123456789"`
-	Name      string `json:"name,omitempty" example:"John Doe"`
+// ========== REDACTION RESPONSES ==========
+
+// RedactionResponse represents the PII redaction settings
+// @Description Response with redaction settings
+type RedactionResponse struct {
+	Success  bool            `json:"success" example:"true"`
+	History  bool            `json:"history" example:"true"`
+	Webhooks bool            `json:"webhooks" example:"false"`
+	Rules    []string        `json:"rules" example:"phone,card,email"`
+	Custom   []RedactionRule `json:"custom"`
 }
 
-// CheckUserResponse represents the response for checking users
-// @Description Response with user existence check results
-type CheckUserResponse struct {
-	Success bool                  `json:"success" example:"true"`
-	Users   []CheckUserResultItem `json:"users"`
+// AutoMarkReadResponse represents the auto mark-read setting
+// @Description Response with the auto mark-read mode and chats
+type AutoMarkReadResponse struct {
+	Success bool    `json:"success" example:"true"`
+	Mode    string  `json:"mode" example:"chats" enums:"off,all,chats"`
+	Chats   []int64 `json:"chats" example:"123456789"`
 }
 
-// UserInfoResponse represents the response for getting user info
-// @Description Response with user information (always returns array)
-type UserInfoResponse struct {
-	Success bool                     `json:"success" example:"true"`
-	Users   []map[string]interface{} `json:"users"`
-	Count   int                      `json:"count" example:"1"`
+// PresenceSubscriptionsResponse represents the presence subscriptions
+// @Description Response with the subscribed users and, after subscribing, their current presence keyed by user ID
+type PresenceSubscriptionsResponse struct {
+	Success  bool                          `json:"success" example:"true"`
+	UserIDs  []int64                       `json:"userIds" example:"987654321"`
+	Presence map[string]maxclient.Presence `json:"presence,omitempty"`
 }
 
-// ContactsResponse represents the response for getting contacts
-// @Description Response with list of contacts
-type ContactsResponse struct {
-	Success  bool                     `json:"success" example:"true"`
-	Contacts []map[string]interface{} `json:"contacts"`
-	Count    int                      `json:"count" example:"42"`
+// ProfileBody represents the request body for updating the profile
+type ProfileBody struct {
+	FirstName   string `json:"firstName" example:"Ivan"`
+	LastName    string `json:"lastName" example:"Petrov"`
+	Description string `json:"description" example:"Support team"`
 }
 
-// ========== GROUP RESPONSES ==========
+// AvatarBody represents the request body for setting the profile picture
+type AvatarBody struct {
+	Image string `json:"image" example:"data:image/jpeg;base64,..."`
+}
 
-// GroupChatResponse represents the response with group/chat info
-// @Description Response with group or chat information
-type GroupChatResponse struct {
+// ProfileResponse represents the profile of the MAX account
+// @Description Response with the profile of the MAX account
+type ProfileResponse struct {
+	Success bool         `json:"success" example:"true"`
+	Profile maxclient.Me `json:"profile"`
+}
+
+// UserPresenceResponse represents the presence of a user
+// @Description Response with the last-seen time of a user in Unix seconds
+type UserPresenceResponse struct {
+	Success bool  `json:"success" example:"true"`
+	UserID  int64 `json:"userId" example:"987654321"`
+	Seen    int64 `json:"seen" example:"1700000000"`
+}
+
+// ========== GDPR RESPONSES ==========
+
+// GDPREraseResponse represents the result of a data erasure
+// @Description Response with the number of removed records per kind
+type GDPREraseResponse struct {
 	Success bool                   `json:"success" example:"true"`
-	Chat    map[string]interface{} `json:"chat"`
+	Removed map[string]interface{} `json:"removed"`
 }
 
-// InviteLinkResponse represents the response with invite link
-// @Description Response with group invite link
-type InviteLinkResponse struct {
-	Success    bool   `json:"success" example:"true"`
-	InviteLink string `json:"inviteLink" example:"https://max.ru/join/abc123"`
+// ResetSessionResponse represents the result of an instance reset
+// @Description Response of a reset. Removed counts the erased records per kind and is omitted with keepData.
+type ResetSessionResponse struct {
+	Success   bool                   `json:"success" example:"true"`
+	Message   string                 `json:"message" example:"Instance reset"`
+	LoggedOut bool                   `json:"loggedOut" example:"true"`
+	Removed   map[string]interface{} `json:"removed,omitempty"`
 }
 
-// ========== WEBHOOK RESPONSES ==========
+// GDPRAuditResponse represents the GDPR audit trail
+// @Description Response with export and erasure requests
+type GDPRAuditResponse struct {
+	Success bool             `json:"success" example:"true"`
+	Entries []GDPRAuditEntry `json:"entries"`
+}
 
-// WebhookResponse represents the response for webhook operations
-// @Description Response with webhook URL
-type WebhookResponse struct {
-	Success bool   `json:"success" example:"true"`
-	Webhook string `json:"webhook" example:"https://example.com/webhook"`
+// ========== CHANGEFEED RESPONSES ==========
+
+// ChangefeedResponse represents a page of the changefeed
+// @Description Response with changes in cursor order. Pass nextCursor as cursor for the following changes.
+type ChangefeedResponse struct {
+	Success    bool     `json:"success" example:"true"`
+	Changes    []Change `json:"changes"`
+	Count      int      `json:"count" example:"1"`
+	NextCursor int64    `json:"nextCursor" example:"1042"`
+	HasMore    bool     `json:"hasMore" example:"false"`
 }
 
-// ========== ADMIN RESPONSES ==========
+// ========== MEDIA RESPONSES ==========
 
-// AddUserResponse represents the response for adding a user
-// @Description Response after creating a new user
-type AddUserResponse struct {
-	Success bool   `json:"success" example:"true"`
-	ID      string `json:"id" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
-	Token   string `json:"token" example:"abc123def456"`
-	Name    string `json:"name" example:"John Doe"`
+// MediaListResponse represents a page of the media index
+// @Description Response with recorded media attachments
+type MediaListResponse struct {
+	Success bool          `json:"success" example:"true"`
+	Media   []MediaRecord `json:"media"`
+	Total   int           `json:"total" example:"120"`
 }
 
-// ListUsersResponse represents the response for listing users
-// @Description Response with list of users
-type ListUsersResponse struct {
-	Success bool           `json:"success" example:"true"`
-	Data    []UserResponse `json:"data"`
+// MediaItemResponse represents a single media index entry
+// @Description Response with one recorded media attachment
+type MediaItemResponse struct {
+	Success bool        `json:"success" example:"true"`
+	Media   MediaRecord `json:"media"`
 }
 
-// AuthRequestBody represents the request body for SMS code request
-type AuthRequestBody struct {
-	Phone    string `json:"phone" example:"79001234567"`
-	Language string `json:"language" example:"ru"`
+// ========== CAMPAIGN RESPONSES ==========
+
+// CampaignResponse represents a campaign with its progress
+// @Description Response with campaign and per-status recipient counters
+type CampaignResponse struct {
+	Success  bool           `json:"success" example:"true"`
+	Campaign Campaign       `json:"campaign"`
+	Total    int            `json:"total" example:"100"`
+	Counts   map[string]int `json:"counts"`
 }
 
-// AuthConfirmBody represents the request body for SMS code confirmation
-type AuthConfirmBody struct {
-	Code string `json:"code" example:"123456"`
+// CampaignListResponse represents the list of campaigns
+// @Description Response with campaigns
+type CampaignListResponse struct {
+	Success   bool       `json:"success" example:"true"`
+	Campaigns []Campaign `json:"campaigns"`
 }
 
-// AuthRegisterBody represents the request body for user registration
-type AuthRegisterBody struct {
-	FirstName string `json:"firstName" example:"John"`
-	LastName  string `json:"lastName" example:"Doe"`
+// ========== HEALTH RESPONSES ==========
+
+// HealthResponse represents the liveness probe result
+// @Description Response while the process is running
+type HealthResponse struct {
+	Status        string `json:"status" example:"ok"`
+	UptimeSeconds int64  `json:"uptimeSeconds" example:"86400"`
 }
 
-// ConnectBody represents the request body for connect
-type ConnectBody struct {
-	Subscribe []string `json:"subscribe" example:"Message,ReadReceipt"`
-	Immediate bool     `json:"immediate" example:"false"`
+// ReadinessResponse represents the readiness probe result
+// @Description Response with the result of every dependency check. A check has status ok, fail or disabled, plus details such as latencyMs or error.
+type ReadinessResponse struct {
+	Status string                            `json:"status" example:"ok"`
+	Checks map[string]map[string]interface{} `json:"checks"`
 }
 
-// MessageBody represents the request body for sending a text message
-type MessageBody struct {
-	ChatID  int64  `json:"chatId" example:"123456789"`
-	Phone   string `json:"phone" example:"79001234567"`
-	Text    string `json:"text" example:"Hello, World!"`
-	ReplyTo int64  `json:"replyTo" example:"0"`
-	Notify  bool   `json:"notify" example:"true"`
+// ========== ADMIN RESPONSES ==========
+
+// CloneUserResponse represents the response for cloning a user
+// @Description Response after creating a user with the settings of another one
+type CloneUserResponse struct {
+	Success  bool   `json:"success" example:"true"`
+	ID       string `json:"id" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
+	Token    string `json:"token" example:"abc123def456"`
+	Name     string `json:"name" example:"Sales 2"`
+	SourceID string `json:"sourceId" example:"a1b2c3"`
 }
 
-// EditMessageBody represents the request body for editing a message
-type EditMessageBody struct {
-	ChatID    int64  `json:"chatId" example:"123456789"`
-	MessageID int64  `json:"messageId" example:"987654321"`
-	Text      string `json:"text" example:"Updated message"`
+// RabbitMQStatsResponse represents RabbitMQ delivery counters
+// @Description Response with RabbitMQ publisher confirm and buffer counters
+type RabbitMQStatsResponse struct {
+	Success   bool  `json:"success" example:"true"`
+	Enabled   bool  `json:"enabled" example:"true"`
+	Connected bool  `json:"connected" example:"true"`
+	Channels  int   `json:"channels" example:"4"`
+	Published int64 `json:"published" example:"1024"`
+	Acked     int64 `json:"acked" example:"1020"`
+	Nacked    int64 `json:"nacked" example:"0"`
+	Buffered  int64 `json:"buffered" example:"4"`
+	Replayed  int64 `json:"replayed" example:"12"`
+	Dropped   int64 `json:"dropped" example:"0"`
+}
+
+// NATSStatsResponse represents NATS delivery counters
+// @Description Response with JetStream publish counters and event stream state
+type NATSStatsResponse struct {
+	Success     bool   `json:"success" example:"true"`
+	Enabled     bool   `json:"enabled" example:"true"`
+	Connected   bool   `json:"connected" example:"true"`
+	Stream      string `json:"stream" example:"MAXAPI_EVENTS"`
+	StreamReady bool   `json:"streamReady" example:"true"`
+	Published   int64  `json:"published" example:"1024"`
+	Acked       int64  `json:"acked" example:"1024"`
+	Duplicates  int64  `json:"duplicates" example:"0"`
+	Failed      int64  `json:"failed" example:"0"`
+	Messages    uint64 `json:"messages" example:"1024"`
+	Bytes       uint64 `json:"bytes" example:"524288"`
+	FirstSeq    uint64 `json:"firstSeq" example:"1"`
+	LastSeq     uint64 `json:"lastSeq" example:"1024"`
+}
+
+// UserConfigResponse represents a user's integration settings
+// @Description Response with the user's RabbitMQ routing, notify, email alert, reply preview, command routing, typing simulation and warm-up settings
+type UserConfigResponse struct {
+	Success      bool               `json:"success" example:"true"`
+	RabbitMQ     RabbitMQConfig     `json:"rabbitmq"`
+	Notify       NotifyConfig       `json:"notify"`
+	Alerts       AlertsConfig       `json:"alerts"`
+	ReplyPreview ReplyPreviewConfig `json:"replyPreview"`
+	Commands     CommandsConfig     `json:"commands"`
+	Typing       TypingConfig       `json:"typing"`
+	Warmup       WarmupConfig       `json:"warmup"`
+}
+
+// WarmupResponse represents the warm-up status of an account
+// @Description Response with the warm-up status: whether it is active, when it ends and the sends of the last hour
+type WarmupResponse struct {
+	Success      bool  `json:"success" example:"true"`
+	Active       bool  `json:"active" example:"true"`
+	EndsAt       int64 `json:"endsAt" example:"1700604800"`
+	SentLastHour int   `json:"sentLastHour" example:"12"`
+	HourlyLimit  int   `json:"hourlyLimit" example:"20"`
+	MinDelay     int   `json:"minDelay" example:"5"`
+	MaxDelay     int   `json:"maxDelay" example:"20"`
+}
+
+// ReconciliationResponse represents the result of a session reconciliation
+// @Description Response with restored, expired and failed sessions
+type ReconciliationResponse struct {
+	Success      bool              `json:"success" example:"true"`
+	StartedAt    int64             `json:"startedAt" example:"1700000000"`
+	FinishedAt   int64             `json:"finishedAt" example:"1700000004"`
+	Running      bool              `json:"running" example:"false"`
+	Reconnected  int               `json:"reconnected" example:"12"`
+	NeedsReauth  int               `json:"needsReauth" example:"1"`
+	Failed       int               `json:"failed" example:"0"`
+	StaleCleared int64             `json:"staleCleared" example:"2"`
+	Pending      []string          `json:"pending"`
+	Results      []ReconcileResult `json:"results"`
+}
+
+// ResourceLimits are the per-instance resource caps (0 = unlimited)
+type ResourceLimits struct {
+	Goroutines        int   `json:"goroutines" example:"32"`
+	PendingEvents     int   `json:"pendingEvents" example:"1000"`
+	PendingMediaBytes int64 `json:"pendingMediaBytes" example:"268435456"`
+}
+
+// ProcessResources are the resource totals of the whole process
+type ProcessResources struct {
+	Goroutines int    `json:"goroutines" example:"140"`
+	HeapAlloc  uint64 `json:"heapAlloc" example:"52428800"`
+	HeapSys    uint64 `json:"heapSys" example:"67108864"`
+}
+
+// ResourcesResponse represents the resource usage of all instances
+// @Description Response with per-instance resource usage, caps and process totals
+type ResourcesResponse struct {
+	Success   bool                    `json:"success" example:"true"`
+	Instances []InstanceResourceStats `json:"instances"`
+	Limits    ResourceLimits          `json:"limits"`
+	Process   ProcessResources        `json:"process"`
+}
+
+// InstanceResourcesResponse represents the resource usage of one instance
+// @Description Response with the resource usage and caps of an instance
+type InstanceResourcesResponse struct {
+	Success   bool                  `json:"success" example:"true"`
+	Resources InstanceResourceStats `json:"resources"`
+	Limits    ResourceLimits        `json:"limits"`
+}
+
+// MaintenanceBody represents the request to enable maintenance mode
+type MaintenanceBody struct {
+	Message    string `json:"message" example:"Migrating database, back at 14:00 UTC"`
+	RetryAfter int    `json:"retryAfter" example:"600"`
+}
+
+// MaintenanceResponse represents the maintenance mode
+// @Description Response with the maintenance mode; message, retryAfter and since are set while it is enabled
+type MaintenanceResponse struct {
+	Success    bool   `json:"success" example:"true"`
+	Enabled    bool   `json:"enabled" example:"true"`
+	Message    string `json:"message,omitempty" example:"Migrating database, back at 14:00 UTC"`
+	RetryAfter int    `json:"retryAfter,omitempty" example:"600"`
+	Since      int64  `json:"since,omitempty" example:"1700000000"`
+}
+
+// ReconnectSettings are the reconnect policy in effect
+type ReconnectSettings struct {
+	MaxAttempts  int `json:"maxAttempts" example:"120"`
+	DelaySeconds int `json:"delaySeconds" example:"5"`
+}
+
+// ConfigResponse represents the reloadable settings in effect
+// @Description Response with the settings that can be changed by reloading the configuration file
+type ConfigResponse struct {
+	Success        bool                     `json:"success" example:"true"`
+	Path           string                   `json:"path" example:"/app/config.json"`
+	LogLevel       string                   `json:"logLevel" example:"info"`
+	GlobalWebhook  string                   `json:"globalWebhook" example:"https://example.com/webhook"`
+	ResourceLimits ResourceLimits           `json:"resourceLimits"`
+	Reconnect      ReconnectSettings        `json:"reconnect"`
+	RabbitSinks    int                      `json:"rabbitSinks" example:"2"`
+	Features       map[string]FeatureConfig `json:"features"`
+}
+
+// FeatureFlagInfo describes a feature flag and its deployment setting
+type FeatureFlagInfo struct {
+	Name        string `json:"name" example:"webhookV2"`
+	Description string `json:"description" example:"Send the user webhook as a JSON body, as with WEBHOOK_FORMAT=json"`
+	Enabled     bool   `json:"enabled" example:"false"`
+	Rollout     int    `json:"rollout" example:"10"`
+}
+
+// FeatureFlagsResponse represents the known feature flags
+// @Description Response with the feature flags and their deployment settings
+type FeatureFlagsResponse struct {
+	Success  bool              `json:"success" example:"true"`
+	Features []FeatureFlagInfo `json:"features"`
+}
+
+// UserFeaturesResponse represents the feature flags in effect for a user
+// @Description Response with the effective feature flags of a user
+type UserFeaturesResponse struct {
+	Success  bool                    `json:"success" example:"true"`
+	UserID   string                  `json:"userID" example:"a1b2c3"`
+	Features map[string]FeatureState `json:"features"`
+}
+
+// AllowedIPsResponse represents the IP allowlist of a user
+// @Description Response with the addresses and CIDR ranges a user's token is accepted from
+type AllowedIPsResponse struct {
+	Success    bool     `json:"success" example:"true"`
+	UserID     string   `json:"userID" example:"a1b2c3"`
+	AllowedIPs []string `json:"allowedIps" example:"203.0.113.7,10.0.0.0/8"`
+}
+
+// ContentPolicyResponse represents the outbound content policy of a user
+// @Description Response with the banned words and patterns, blocked domains and hourly recipient cap of a user
+type ContentPolicyResponse struct {
+	Success              bool     `json:"success" example:"true"`
+	UserID               string   `json:"userID" example:"a1b2c3"`
+	BannedWords          []string `json:"bannedWords" example:"casino"`
+	BannedPatterns       []string `json:"bannedPatterns" example:"(?i)free\\s+money"`
+	BlockedDomains       []string `json:"blockedDomains" example:"spam.example"`
+	MaxRecipientsPerHour int      `json:"maxRecipientsPerHour" example:"100"`
+	RecipientLimitAction string   `json:"recipientLimitAction" example:"queue"`
+}
+
+// AuthBan represents a client address banned after failed authentications
+type AuthBan struct {
+	IP    string `json:"ip" example:"203.0.113.7"`
+	Until int64  `json:"until" example:"1700000900"`
+}
+
+// AuthBansResponse represents the addresses banned after failed authentications
+// @Description Response with the failure limit and the banned client addresses
+type AuthBansResponse struct {
+	Success     bool      `json:"success" example:"true"`
+	MaxFailures int       `json:"maxFailures" example:"10"`
+	Bans        []AuthBan `json:"bans"`
+}
+
+// UserCacheStatsResponse represents the configuration and counters of the user cache
+// @Description Response with user cache size, limits and hit/miss/eviction counters
+type UserCacheStatsResponse struct {
+	Success         bool  `json:"success" example:"true"`
+	TTLSeconds      int64 `json:"ttlSeconds" example:"300"`
+	MaxEntries      int   `json:"maxEntries" example:"10000"`
+	Entries         int   `json:"entries" example:"42"`
+	NegativeEntries int   `json:"negativeEntries" example:"1"`
+	Hits            int64 `json:"hits" example:"15230"`
+	Misses          int64 `json:"misses" example:"57"`
+	NegativeHits    int64 `json:"negativeHits" example:"3"`
+	Evictions       int64 `json:"evictions" example:"12"`
+	Invalidations   int64 `json:"invalidations" example:"2"`
+}
+
+// BatchSendBody represents the request body for sending a message batch.
+// DelayMs and JitterMs default to 1000 and 500.
+type BatchSendBody struct {
+	Messages []chat.MessageBody `json:"messages"`
+	DelayMs  *int               `json:"delayMs" example:"1000"`
+	JitterMs *int               `json:"jitterMs" example:"500"`
+}
+
+// ScheduleMessageBody represents the request body for scheduling a text
+// message: the fields of a text send and the send time in Unix seconds
+type ScheduleMessageBody struct {
+	chat.MessageBody
+	SendAt int64 `json:"sendAt" example:"1700003600"`
+}
+
+// GroupAdminsBody represents the request body for promoting or demoting group admins
+type GroupAdminsBody struct {
+	ChatID      int64   `json:"chatId" example:"123456789"`
+	UserIDs     []int64 `json:"userIds"`
+	Permissions int64   `json:"permissions" example:"0"`
+}
+
+// JoinRequestsDecideBody represents the request body for approving or declining join requests
+type JoinRequestsDecideBody struct {
+	ChatID  int64   `json:"chatId" example:"123456789"`
+	UserIDs []int64 `json:"userIds"`
+	Action  string  `json:"action" example:"approve" enums:"approve,decline"`
 }
 
-// MarkReadBody represents the request body for marking messages as read
-type MarkReadBody struct {
-	ChatID    int64 `json:"chatId" example:"123456789"`
-	MessageID int64 `json:"messageId" example:"987654321"`
+// UserSettingsBody represents the request body for the language and timezone of an instance
+type UserSettingsBody struct {
+	Locale   string `json:"locale" example:"en"`
+	Timezone string `json:"timezone" example:"Europe/Moscow"`
 }
 
-// DeleteMessageBody represents the request body for deleting messages
-type DeleteMessageBody struct {
-	ChatID     int64   `json:"chatId" example:"123456789"`
-	MessageIDs []int64 `json:"messageIds"`
-	ForMe      bool    `json:"forMe" example:"false"`
+// QuietHoursBody represents the request body for quiet hours settings
+type QuietHoursBody struct {
+	Enabled  bool   `json:"enabled" example:"true"`
+	Start    string `json:"start" example:"21:00"`
+	End      string `json:"end" example:"09:00"`
+	Timezone string `json:"timezone" example:"Europe/Moscow"`
 }
 
-// ImageBody represents the request body for sending an image
-type ImageBody struct {
-	ChatID  int64  `json:"chatId" example:"123456789"`
-	Phone   string `json:"phone" example:"79001234567"`
-	Image   string `json:"image" example:"data:image/jpeg;base64,..."`
-	Caption string `json:"caption" example:"Image caption"`
-	Notify  bool   `json:"notify" example:"true"`
+// BlocklistBody represents the request body for blocklist changes
+type BlocklistBody struct {
+	Phones  []string `json:"phones" example:"79001234567"`
+	UserIDs []int64  `json:"userIds" example:"123456789"`
+	Reason  string   `json:"reason" example:"manual"`
 }
 
-// DocumentBody represents the request body for sending a document
-type DocumentBody struct {
-	ChatID   int64  `json:"chatId" example:"123456789"`
-	Phone    string `json:"phone" example:"79001234567"`
-	Document string `json:"document" example:"data:application/pdf;base64,..."`
-	FileName string `json:"fileName" example:"document.pdf"`
-	Caption  string `json:"caption" example:"Document caption"`
-	Notify   bool   `json:"notify" example:"true"`
+// OptOutKeywordsBody represents the request body for opt-out keywords
+type OptOutKeywordsBody struct {
+	Keywords []string `json:"keywords" example:"STOP,СТОП"`
 }
 
-// AudioBody represents the request body for sending audio
-type AudioBody struct {
-	ChatID   int64  `json:"chatId" example:"123456789"`
-	Phone    string `json:"phone" example:"79001234567"`
-	Audio    string `json:"audio" example:"data:audio/mp3;base64,..."`
-	FileName string `json:"fileName" example:"audio.mp3"`
-	Notify   bool   `json:"notify" example:"true"`
+// StorageBody represents the request body for media storage settings
+type StorageBody struct {
+	Enabled        bool   `json:"enabled" example:"true"`
+	Backend        string `json:"backend" example:"s3" enums:"s3,gcs,azure,local"`
+	Endpoint       string `json:"endpoint" example:"https://s3.amazonaws.com"`
+	Region         string `json:"region" example:"us-east-1"`
+	Bucket         string `json:"bucket" example:"maxapi-media"`
+	AccessKey      string `json:"accessKey" example:"AKIA..."`
+	SecretKey      string `json:"secretKey" example:"secret"`
+	PathStyle      bool   `json:"pathStyle" example:"false"`
+	PublicURL      string `json:"publicUrl" example:""`
+	MediaDelivery  string `json:"mediaDelivery" example:"both" enums:"base64,s3,both"`
+	RetentionDays  int    `json:"retentionDays" example:"30"`
+	AzureAccount   string `json:"azureAccount" example:"mystorageaccount"`
+	AzureContainer string `json:"azureContainer" example:"media"`
+	AzureSASToken  string `json:"azureSasToken" example:"sv=2021-08-06&ss=b&srt=co&sp=rwdl&sig=..."`
+	PresignTTL     int    `json:"presignTtl" example:"0"`
 }
 
-// VideoBody represents the request body for sending a video
-type VideoBody struct {
-	ChatID   int64  `json:"chatId" example:"123456789"`
-	Phone    string `json:"phone" example:"79001234567"`
-	Video    string `json:"video" example:"data:video/mp4;base64,..."`
-	Caption  string `json:"caption" example:"Video caption"`
-	FileName string `json:"fileName" example:"video.mp4"`
-	Notify   bool   `json:"notify" example:"true"`
+// UserConfigBody represents the request body for a user's integration settings
+// @Description Integration settings of a user, one optional section per integration
+type UserConfigBody struct {
+	RabbitMQ     *RabbitMQConfig     `json:"rabbitmq,omitempty"`
+	Notify       *NotifyConfig       `json:"notify,omitempty"`
+	Alerts       *AlertsConfig       `json:"alerts,omitempty"`
+	ReplyPreview *ReplyPreviewConfig `json:"replyPreview,omitempty"`
+	Commands     *CommandsConfig     `json:"commands,omitempty"`
+	Typing       *TypingConfig       `json:"typing,omitempty"`
+	Warmup       *WarmupConfig       `json:"warmup,omitempty"`
 }
 
-// CheckUserBody represents the request body for checking users
-type CheckUserBody struct {
-	Phone []string `json:"phone"`
+// UserFeaturesBody represents the request body for per-user feature flag overrides (null removes an override)
+type UserFeaturesBody struct {
+	Features map[string]*bool `json:"features"`
 }
 
-// UserInfoBody represents the request body for getting user info
-type UserInfoBody struct {
-	UserIDs []int64 `json:"userIds"`
+// AllowedIPsBody represents the request body for a user's IP allowlist (empty removes the restriction)
+type AllowedIPsBody struct {
+	AllowedIPs []string `json:"allowedIps" example:"203.0.113.7,10.0.0.0/8"`
 }
 
-// PresenceBody represents the request body for sending presence
-type PresenceBody struct {
-	ChatID int64 `json:"chatId" example:"123456789"`
+// AutoMarkReadBody represents the request body for the auto mark-read setting
+type AutoMarkReadBody struct {
+	Mode  string  `json:"mode" example:"chats" enums:"off,all,chats"`
+	Chats []int64 `json:"chats" example:"123456789"`
 }
 
-// CreateGroupBody represents the request body for creating a group
-type CreateGroupBody struct {
-	Name         string  `json:"name" example:"My Group"`
-	Participants []int64 `json:"participants"`
+// PresenceSubscriptionsBody represents the request body for changing presence subscriptions
+type PresenceSubscriptionsBody struct {
+	Subscribe   []int64 `json:"subscribe" example:"987654321"`
+	Unsubscribe []int64 `json:"unsubscribe" example:"123123123"`
 }
 
-// GroupInfoBody represents the request body for group operations
-type GroupInfoBody struct {
-	ChatID int64 `json:"chatId" example:"123456789"`
+// RedactionBody represents the request body for PII redaction settings
+type RedactionBody struct {
+	History  bool            `json:"history" example:"true"`
+	Webhooks bool            `json:"webhooks" example:"false"`
+	Rules    []string        `json:"rules" example:"phone,card,email"`
+	Custom   []RedactionRule `json:"custom"`
 }
 
-// GroupJoinBody represents the request body for joining a group
-type GroupJoinBody struct {
-	Link string `json:"link" example:"https://max.ru/join/abc123"`
+// GDPREraseBody represents the request body for erasing stored data
+type GDPREraseBody struct {
+	Confirm   bool `json:"confirm" example:"true"`
+	Blocklist bool `json:"blocklist" example:"false"`
 }
 
-// UpdateParticipantsBody represents the request body for updating group participants
-type UpdateParticipantsBody struct {
-	ChatID    int64   `json:"chatId" example:"123456789"`
-	UserIDs   []int64 `json:"userIds"`
-	Operation string  `json:"operation" example:"add" enums:"add,remove"`
+// ResetSessionBody represents the request body for resetting an instance
+type ResetSessionBody struct {
+	Confirm   bool `json:"confirm" example:"true"`
+	Logout    bool `json:"logout" example:"true"`
+	KeepData  bool `json:"keepData" example:"false"`
+	Blocklist bool `json:"blocklist" example:"false"`
 }
 
-// GroupNameBody represents the request body for setting group name
-type GroupNameBody struct {
-	ChatID int64  `json:"chatId" example:"123456789"`
-	Name   string `json:"name" example:"New Group Name"`
+// WebhookSecretBody represents the request body for setting the webhook signing secret
+type WebhookSecretBody struct {
+	Secret string `json:"secret" example:"my-long-shared-secret"`
 }
 
-// GroupTopicBody represents the request body for setting group topic
-type GroupTopicBody struct {
-	ChatID int64  `json:"chatId" example:"123456789"`
-	Topic  string `json:"topic" example:"Group description"`
+// WebhookFailedBody represents the request body for replaying or deleting failed webhooks
+type WebhookFailedBody struct {
+	IDs []int64 `json:"ids" example:"1,2"`
+	All bool    `json:"all" example:"false"`
 }
 
-// WebhookBody represents the request body for setting webhook
-type WebhookBody struct {
-	Webhook string `json:"webhook" example:"https://example.com/webhook"`
+// PresignBody represents the request body for minting a presigned URL
+type PresignBody struct {
+	Key string `json:"key" example:"users/abc/inbox/123/2025/01/15/images/msg1.jpg"`
+	TTL int    `json:"ttl" example:"3600"`
 }
 
-// ChatHistoryBody represents the request body for getting chat history
-type ChatHistoryBody struct {
-	ChatID   int64 `json:"chatId" example:"123456789"`
-	Count    int   `json:"count" example:"50"`
-	FromTime int64 `json:"fromTime" example:"0"`
+// CampaignRecipientBody represents a single campaign recipient
+type CampaignRecipientBody struct {
+	Phone     string            `json:"phone" example:"79001234567"`
+	ChatID    int64             `json:"chatId" example:"0"`
+	Variables map[string]string `json:"variables"`
 }
 
-// ReactBody represents the request body for adding a reaction
-type ReactBody struct {
-	ChatID    int64  `json:"chatId" example:"123456789"`
-	MessageID string `json:"messageId" example:"987654321"`
-	Reaction  string `json:"reaction" example:"👍"`
+// CreateCampaignBody represents the request body for creating a campaign
+type CreateCampaignBody struct {
+	Name       string                  `json:"name" example:"Spring promo"`
+	Template   string                  `json:"template" example:"Hello, {{name}}!"`
+	Recipients []CampaignRecipientBody `json:"recipients"`
+	MinDelay   int                     `json:"minDelay" example:"5"`
+	MaxDelay   int                     `json:"maxDelay" example:"15"`
+	Notify     *bool                   `json:"notify" example:"true"`
 }
 
-// DownloadBody represents the request body for downloading media
-type DownloadBody struct {
-	URL string `json:"url" example:"https://example.com/image.jpg"`
+// FolderBody represents the request body for creating or updating a folder
+type FolderBody struct {
+	Title   string   `json:"title" example:"Work"`
+	Include []int64  `json:"include" example:"123456789,-68123456789"`
+	Filters []string `json:"filters" example:"UNREAD"`
 }
 
-// DownloadFileBody represents the request body for downloading files
-type DownloadFileBody struct {
-	ChatID    int64 `json:"chatId" example:"123456789"`
-	MessageID int64 `json:"messageId" example:"987654321"`
-	FileID    int64 `json:"fileId" example:"111222333"`
-	VideoID   int64 `json:"videoId" example:"111222333"`
+// FolderReorderBody represents the request body for reordering folders
+type FolderReorderBody struct {
+	FolderIDs []string `json:"folderIds" example:"9b2f6a4e-7c1d-4b8e-a39f-2d5c0e8f1a67"`
 }
 
-// UserResponse represents a user in the system
-type UserResponse struct {
-	ID            string `json:"id" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
-	Name          string `json:"name" example:"John Doe"`
-	Token         string `json:"token" example:"abc123def456"`
-	MaxUserID     *int64 `json:"maxUserId" example:"123456789"`
-	Webhook       string `json:"webhook" example:"https://example.com/webhook"`
-	Events        string `json:"events" example:"All"`
-	Connected     int    `json:"connected" example:"1"`
-	Authenticated bool   `json:"authenticated" example:"true"`
+// MuteChatBody represents the request body for muting a chat. Until is a
+// Unix time in seconds; 0 mutes the chat until it is unmuted.
+type MuteChatBody struct {
+	ChatID int64 `json:"chatId" example:"-68123456789"`
+	Until  int64 `json:"until" example:"1700086400"`
 }
 
-// AddUserBody represents the request body for adding a user
-type AddUserBody struct {
-	Name    string `json:"name" example:"John Doe"`
-	Webhook string `json:"webhook" example:"https://example.com/webhook"`
-	Events  string `json:"events" example:"All"`
+// ChatMuteResponse represents the mute state of a chat
+// @Description Response with the mute state after the change. muteUntil is a Unix time, -1 while muted until unmuted and 0 when not muted.
+type ChatMuteResponse struct {
+	Success   bool  `json:"success" example:"true"`
+	ChatID    int64 `json:"chatId" example:"-68123456789"`
+	Muted     bool  `json:"muted" example:"true"`
+	MuteUntil int64 `json:"muteUntil" example:"1700086400"`
+}
+
+// ChatConfirmBody represents the request body for deleting or clearing a chat
+type ChatConfirmBody struct {
+	ChatID  int64 `json:"chatId" example:"123456789"`
+	Confirm bool  `json:"confirm" example:"true"`
 }
 
-// EditUserBody represents the request body for editing a user
-type EditUserBody struct {
+// ChatActionResponse represents the result of deleting or clearing a chat
+// @Description Response with the chat and the action done, delete or clear
+type ChatActionResponse struct {
+	Success bool   `json:"success" example:"true"`
+	ChatID  int64  `json:"chatId" example:"123456789"`
+	Action  string `json:"action" example:"clear"`
+}
+
+// LinkPreviewBody represents the request body for fetching a link preview
+type LinkPreviewBody struct {
+	URL string `json:"url" example:"https://example.com/article"`
+}
+
+// LinkPreviewResponse represents the preview MAX generates for a link
+// @Description Response with the link preview. shareId identifies the preview when it is attached to a message.
+type LinkPreviewResponse struct {
+	Success bool                  `json:"success" example:"true"`
+	Preview maxclient.LinkPreview `json:"preview"`
+}
+
+// BulkUserOperation is one operation of a bulk user request. Action is
+// create, update or delete; ID is required for update and delete.
+type BulkUserOperation struct {
+	Action  string `json:"action" example:"create"`
+	ID      string `json:"id,omitempty" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
 	Name    string `json:"name" example:"John Doe"`
 	Webhook string `json:"webhook" example:"https://example.com/webhook"`
 	Events  string `json:"events" example:"All"`
 }
+
+// BulkUsersBody represents the request body for bulk user operations
+type BulkUsersBody struct {
+	Operations []BulkUserOperation `json:"operations"`
+}
+
+// BulkUserResult represents the outcome of one bulk user operation
+type BulkUserResult struct {
+	Index   int    `json:"index" example:"0"`
+	Action  string `json:"action" example:"create"`
+	ID      string `json:"id,omitempty" example:"a7e5dd6b-8b3e-4035-ba87-3f96a0e3f5c0"`
+	Token   string `json:"token,omitempty" example:"abc123def456"`
+	Success bool   `json:"success" example:"true"`
+	Error   string `json:"error,omitempty" example:"user not found"`
+}
+
+// BulkUsersResponse represents the result of bulk user operations
+type BulkUsersResponse struct {
+	Success   bool             `json:"success" example:"true"`
+	Succeeded int              `json:"succeeded" example:"9"`
+	Failed    int              `json:"failed" example:"1"`
+	Results   []BulkUserResult `json:"results"`
+}
+
+// FleetOperationResponse represents the result of disconnecting or
+// reconnecting all instances
+type FleetOperationResponse struct {
+	Success bool   `json:"success" example:"true"`
+	Stopped int    `json:"stopped" example:"42"`
+	Message string `json:"message,omitempty" example:"Reconnecting, see GET /admin/reconciliation"`
+}
+
+// CloneUserBody represents the request body for cloning a user
+type CloneUserBody struct {
+	Name string `json:"name" example:"Sales 2"`
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"maxapi/api"
+	"maxapi/handlers/chat"
+	"maxapi/maxclient"
+)
+
+// multipartMemory is the part of a multipart upload kept in memory; larger files are spooled to disk
+const multipartMemory = 32 << 20
+
+// multipartSends lists the send routes accepting multipart/form-data, with the
+// form field carrying the file and the body the other fields are decoded into
+var multipartSends = map[string]struct {
+	field string
+	body  func() interface{}
+}{
+	"/chat/send/image":    {"image", func() interface{} { return &chat.ImageBody{} }},
+	"/chat/send/document": {"document", func() interface{} { return &chat.DocumentBody{} }},
+	"/chat/send/audio":    {"audio", func() interface{} { return &chat.AudioBody{} }},
+	"/chat/send/video":    {"video", func() interface{} { return &chat.VideoBody{} }},
+	"/chat/send/voice":    {"voice", func() interface{} { return &chat.VoiceBody{} }},
+}
+
+// isMultipart reports whether the request body is multipart/form-data
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// mediaUpload is a file sent as a multipart form part. A nil upload means the
+// media was given in the JSON body instead.
+type mediaUpload struct {
+	header *multipart.FileHeader
+}
+
+// Name returns the uploaded file name, or def
+func (u *mediaUpload) Name(def string) string {
+	if u != nil && u.header.Filename != "" {
+		return u.header.Filename
+	}
+	return def
+}
+
+// Decode returns the uploaded file read into memory, or decodes value (data URL,
+// URL or base64) for JSON requests. Uploads that are streamable are sent with
+// sendUpload instead.
+func (u *mediaUpload) Decode(value string, def string) ([]byte, string, error) {
+	if u == nil {
+		return api.DecodeMediaData(value, def)
+	}
+
+	f, err := u.header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, u.Name(def), nil
+}
+
+// Streamable reports whether the upload can be sent to MAX straight from the form
+// part, which is spooled to disk when it is large. The file is read into memory
+// instead when a media scanner is configured or the instance copies sent media
+// to its media store, as both need the content as a whole.
+func (u *mediaUpload) Streamable(r *http.Request) bool {
+	if u == nil || scanner != nil {
+		return false
+	}
+	userinfo := r.Context().Value("userinfo").(Values)
+	delivery := userinfo.Get("MediaDelivery")
+	return userinfo.Get("S3Enabled") != "true" || (delivery != "s3" && delivery != "both")
+}
+
+// sendUpload sends a streamable upload as a message without reading the file into
+// memory, and writes the response. recordType is the media index type.
+func (s *server) sendUpload(w http.ResponseWriter, r *http.Request, client *maxclient.Client, chatID int64, caption string,
+	mediaType, recordType string, upload *mediaUpload, filename string, notify bool) {
+
+	txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+	if !s.CheckUploadSize(w, r, client, upload.header.Size) {
+		return
+	}
+
+	f, err := upload.header.Open()
+	if err != nil {
+		s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid %s data: %v", mediaType, err))
+		return
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	mimeType := http.DetectContentType(head[:n])
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	result, checksum, err := s.sendMediaStream(client, txtid, chatID, caption, mediaType, f, upload.header.Size, filename, notify)
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("send failed: %v", err))
+		return
+	}
+
+	s.recordOutgoingStream(txtid, chatID, result, recordType, filename, mimeType, upload.header.Size, checksum)
+
+	response := map[string]interface{}{
+		"success":   true,
+		"messageId": result.ID,
+	}
+
+	s.Respond(w, r, http.StatusOK, response)
+}
+
+// decodeMediaRequest decodes a send request given as JSON or as multipart/form-data.
+// For multipart requests the form fields are decoded into msg by their JSON names
+// and the file part named field is returned.
+func decodeMediaRequest(r *http.Request, msg interface{}, field string) (*mediaUpload, error) {
+	if !isMultipart(r) {
+		return nil, decodeJSON(r, msg)
+	}
+
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		return nil, err
+	}
+	if err := setFormFields(msg, r.MultipartForm.Value); err != nil {
+		return nil, err
+	}
+
+	files := r.MultipartForm.File[field]
+	if len(files) == 0 {
+		files = r.MultipartForm.File["file"]
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("missing file part %q", field)
+	}
+	return &mediaUpload{header: files[0]}, nil
+}
+
+// setFormFields copies form values into the struct fields with the matching JSON name
+func setFormFields(msg interface{}, values map[string][]string) error {
+	v := reflect.ValueOf(msg).Elem()
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		vals, ok := values[name]
+		if !ok || len(vals) == 0 {
+			continue
+		}
+		raw := strings.TrimSpace(vals[0])
+
+		field := v.Field(i)
+		switch field.Kind() {
+		case reflect.String:
+			field.SetString(vals[0])
+		case reflect.Int, reflect.Int64:
+			n, err := strconv.ParseInt(raw, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid %s", name)
+			}
+			field.SetInt(n)
+		case reflect.Bool:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("invalid %s", name)
+			}
+			field.SetBool(b)
+		case reflect.Slice:
+			// Integer lists are given as comma-separated values
+			if field.Type().Elem().Kind() != reflect.Int {
+				continue
+			}
+			parts := strings.Split(raw, ",")
+			list := reflect.MakeSlice(field.Type(), len(parts), len(parts))
+			for j, part := range parts {
+				n, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+				if err != nil {
+					return fmt.Errorf("invalid %s", name)
+				}
+				list.Index(j).SetInt(n)
+			}
+			field.Set(list)
+		case reflect.Ptr:
+			if field.Type().Elem().Kind() != reflect.Bool {
+				continue
+			}
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return fmt.Errorf("invalid %s", name)
+			}
+			field.Set(reflect.ValueOf(&b))
+		}
+	}
+	return nil
+}
+
+// multipartAsJSON renders a decoded multipart send as the equivalent JSON body,
+// with the file embedded as a data URL, so it can be stored in the deferred queue
+func multipartAsJSON(msg interface{}, field string, upload *mediaUpload) ([]byte, error) {
+	data, _, err := upload.Decode("", "")
+	if err != nil {
+		return nil, err
+	}
+
+	contentType := upload.header.Header.Get("Content-Type")
+	if contentType == "" || contentType == "application/octet-stream" {
+		contentType = http.DetectContentType(data)
+	}
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+
+	raw, err := json.Marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]interface{}
+	if err := json.Unmarshal(raw, &body); err != nil {
+		return nil, err
+	}
+	body[field] = "data:" + contentType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	if _, ok := body["fileName"]; ok && body["fileName"] == "" {
+		body["fileName"] = upload.Name("")
+	}
+
+	return json.Marshal(body)
+}
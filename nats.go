@@ -0,0 +1,241 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+	"github.com/nats-io/nuid"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	natsDefaultStream   = "MAXAPI_EVENTS"
+	natsDefaultSubject  = "maxapi.events"
+	natsDefaultMaxAge   = 72 // hours
+	natsPublishTimeout  = 5 * time.Second
+	natsPublishAttempts = 3
+	natsDuplicateWindow = 2 * time.Minute
+)
+
+var (
+	natsConn        *nats.Conn
+	natsJS          jetstream.JetStream
+	natsEnabled     bool
+	natsStreamReady atomic.Bool
+	natsStreamName  string
+	natsSubject     string
+	natsMaxAge      time.Duration
+	natsReplicas    int
+
+	// natsStreamMu serializes stream creation after (re)connects
+	natsStreamMu sync.Mutex
+
+	natsStats struct {
+		Published  atomic.Int64
+		Acked      atomic.Int64
+		Duplicates atomic.Int64
+		Failed     atomic.Int64
+	}
+)
+
+// InitNATS connects to NATS when NATS_URL is set. Events are published to
+// <NATS_SUBJECT_PREFIX>.<userID>.<eventType>, stored in a JetStream stream.
+func InitNATS() {
+	url := os.Getenv("NATS_URL")
+	if url == "" {
+		log.Info().Msg("NATS_URL is not set. NATS publishing disabled.")
+		return
+	}
+
+	natsStreamName = os.Getenv("NATS_STREAM")
+	if natsStreamName == "" {
+		natsStreamName = natsDefaultStream
+	}
+	natsSubject = strings.TrimSuffix(os.Getenv("NATS_SUBJECT_PREFIX"), ".")
+	if natsSubject == "" {
+		natsSubject = natsDefaultSubject
+	}
+	natsMaxAge = time.Duration(envInt("NATS_MAX_AGE_HOURS", natsDefaultMaxAge)) * time.Hour
+	natsReplicas = envInt("NATS_REPLICAS", 1)
+
+	// Connecting is retried in the background, so the gateway starts while NATS is down
+	nc, err := nats.Connect(url,
+		nats.Name("maxapi"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(2*time.Second),
+		nats.ConnectHandler(func(*nats.Conn) {
+			log.Info().Msg("NATS connection established")
+			go ensureNATSStream()
+		}),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			log.Warn().Err(err).Msg("NATS connection lost")
+		}),
+		nats.ReconnectHandler(func(*nats.Conn) {
+			log.Info().Msg("NATS reconnected")
+			go ensureNATSStream()
+		}),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Invalid NATS configuration, NATS publishing disabled")
+		return
+	}
+	js, err := jetstream.New(nc)
+	if err != nil {
+		nc.Close()
+		log.Error().Err(err).Msg("Could not open JetStream context, NATS publishing disabled")
+		return
+	}
+
+	// The stream is created by the connect handler once a connection is up
+	natsConn, natsJS, natsEnabled = nc, js, true
+	if !nc.IsConnected() {
+		log.Warn().Msg("Could not connect to NATS, retrying in the background")
+	}
+}
+
+// ensureNATSStream creates the event stream or updates its settings
+func ensureNATSStream() error {
+	natsStreamMu.Lock()
+	defer natsStreamMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := natsJS.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:       natsStreamName,
+		Subjects:   []string{natsSubject + ".>"},
+		Storage:    jetstream.FileStorage,
+		Retention:  jetstream.LimitsPolicy,
+		MaxAge:     natsMaxAge,
+		Replicas:   natsReplicas,
+		Duplicates: natsDuplicateWindow,
+	})
+	if err != nil {
+		natsStreamReady.Store(false)
+		log.Error().Err(err).Str("stream", natsStreamName).Msg("Could not create NATS stream")
+		return err
+	}
+
+	natsStreamReady.Store(true)
+	log.Info().Str("stream", natsStreamName).Str("subjects", natsSubject+".>").Dur("maxAge", natsMaxAge).Msg("NATS stream ready")
+	return nil
+}
+
+// closeNATS flushes pending publishes on shutdown
+func closeNATS() {
+	if natsConn != nil {
+		natsConn.Drain()
+	}
+}
+
+// natsToken makes a value usable as one subject token
+func natsToken(value string) string {
+	if value == "" {
+		return "_"
+	}
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '*', '>', ' ', '\t', '\r', '\n':
+			return '_'
+		}
+		return r
+	}, value)
+}
+
+// sendToNATS publishes an event and waits for JetStream to store it. Retries
+// carry the same message id, so the stream keeps a single copy.
+func sendToNATS(jsonData []byte, token string, userID string) {
+	if !natsEnabled {
+		return
+	}
+
+	instanceName := ""
+	userinfo, found := userinfocache.Get(token)
+	if found {
+		instanceName = userinfo.(Values).Get("Name")
+	}
+
+	enhancedJSON, err := addJSONFields(jsonData, map[string]string{
+		"userID":       userID,
+		"instanceName": instanceName,
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to add instance fields to JSON data for NATS")
+		return
+	}
+
+	subject := natsSubject + "." + natsToken(userID) + "." + natsToken(jsonEventType(jsonData))
+	msgID := nuid.Next()
+	natsStats.Published.Add(1)
+
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), natsPublishTimeout)
+		ack, err := natsJS.Publish(ctx, subject, enhancedJSON, jetstream.WithMsgID(msgID), jetstream.WithExpectStream(natsStreamName))
+		cancel()
+		if err == nil {
+			if ack.Duplicate {
+				natsStats.Duplicates.Add(1)
+			}
+			natsStats.Acked.Add(1)
+			log.Debug().Str("subject", subject).Uint64("seq", ack.Sequence).Msg("Published event to NATS")
+			return
+		}
+
+		if attempt >= natsPublishAttempts {
+			natsStats.Failed.Add(1)
+			log.Error().Err(err).Str("subject", subject).Str("userID", userID).Msg("Could not publish event to NATS")
+			return
+		}
+		if errors.Is(err, jetstream.ErrNoStreamResponse) {
+			ensureNATSStream()
+		}
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+// NATSStats returns NATS delivery counters
+// @Summary NATS delivery stats
+// @Description Returns JetStream publish counters and the state of the event stream
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} NATSStatsResponse
+// @Security AdminAuth
+// @Router /admin/nats/stats [get]
+func (s *server) NATSStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{
+			"success":     true,
+			"enabled":     natsEnabled,
+			"connected":   natsConn != nil && natsConn.IsConnected(),
+			"stream":      natsStreamName,
+			"streamReady": natsStreamReady.Load(),
+			"published":   natsStats.Published.Load(),
+			"acked":       natsStats.Acked.Load(),
+			"duplicates":  natsStats.Duplicates.Load(),
+			"failed":      natsStats.Failed.Load(),
+		}
+
+		if natsEnabled && natsConn.IsConnected() {
+			ctx, cancel := context.WithTimeout(r.Context(), 3*time.Second)
+			defer cancel()
+			if stream, err := natsJS.Stream(ctx, natsStreamName); err == nil {
+				state := stream.CachedInfo().State
+				response["messages"] = state.Msgs
+				response["bytes"] = state.Bytes
+				response["firstSeq"] = state.FirstSeq
+				response["lastSeq"] = state.LastSeq
+			}
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"time"
+)
+
+// outboundRequest holds the fields shared by all send payloads that the
+// outbound guard needs before the request reaches its handler
+type outboundRequest struct {
+	ChatID  int64  `json:"chatId"`
+	Phone   string `json:"phone"`
+	Urgent  bool   `json:"urgent"`
+	Text    string `json:"text"`
+	Caption string `json:"caption"`
+}
+
+// fanOutSends are the send endpoints that send each of their messages through internalSend
+var fanOutSends = map[string]bool{
+	"/chat/send/batch":   true,
+	"/group/invite-send": true,
+}
+
+// outboundGuard applies per-user sending policies to /chat/send/* requests
+func (s *server) outboundGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if state := currentMaintenance(); state.Enabled {
+			s.respondMaintenance(w, r, state)
+			return
+		}
+		if restriction := s.accountRestriction(r.Context().Value("userinfo").(Values).Get("Id")); restriction != nil {
+			s.respondRestricted(w, r, restriction)
+			return
+		}
+
+		// Sends the handler answers with 200 count as sent messages. Fan-out
+		// sends are counted per message, as each goes through internalSend.
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		defer func() {
+			if rec.status == http.StatusOK && !fanOutSends[r.URL.Path] {
+				metrics.messageSent(r.Context().Value("userinfo").(Values).Get("Id"))
+			}
+		}()
+		w = rec
+
+		if isMultipart(r) {
+			s.guardMultipart(w, r, next)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		// Malformed payloads are rejected by the handler itself
+		var req outboundRequest
+		json.Unmarshal(body, &req)
+
+		if !s.checkOutbound(w, r, req, func() ([]byte, error) { return body, nil }) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// guardMultipart applies the outbound policies to a multipart/form-data media send.
+// The form is parsed once here and reused by the handler.
+func (s *server) guardMultipart(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	route, ok := multipartSends[r.URL.Path]
+	if !ok {
+		s.Respond(w, r, http.StatusBadRequest, errors.New("multipart/form-data is not supported on this endpoint"))
+		return
+	}
+
+	msg := route.body()
+	upload, err := decodeMediaRequest(r, msg, route.field)
+	if r.MultipartForm != nil {
+		defer r.MultipartForm.RemoveAll()
+	}
+	if err != nil {
+		s.RespondPayloadError(w, r, err)
+		return
+	}
+
+	var req outboundRequest
+	raw, _ := json.Marshal(msg)
+	json.Unmarshal(raw, &req)
+
+	if !s.checkOutbound(w, r, req, func() ([]byte, error) { return multipartAsJSON(msg, route.field, upload) }) {
+		return
+	}
+
+	next.ServeHTTP(w, r)
+}
+
+// checkOutbound enforces the blocklist, content policy, quiet hours, recipient
+// limit and warm-up. It responds and returns
+// false when the request must not reach its handler; body is only read when the
+// send is deferred.
+func (s *server) checkOutbound(w http.ResponseWriter, r *http.Request, req outboundRequest, body func() ([]byte, error)) bool {
+	txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+	blocked, err := s.isRecipientBlocked(txtid, req)
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return false
+	}
+	if blocked {
+		s.Respond(w, r, http.StatusForbidden, map[string]interface{}{
+			"success": false,
+			"error":   "recipient is blocked",
+			"code":    errCodeRecipientBlocked,
+		})
+		return false
+	}
+
+	if !s.checkContentPolicy(w, r, txtid, req) {
+		return false
+	}
+
+	// Internal sends (deferred queue, campaigns) handle quiet hours themselves
+	if !req.Urgent && !isInternalSend(r) {
+		if until, quiet := s.quietHoursUntil(txtid, time.Now()); quiet {
+			payload, err := body()
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("could not read payload"))
+				return false
+			}
+			s.respondDeferred(w, r, txtid, payload, until, "quiet_hours")
+			return false
+		}
+	}
+
+	// Fan-out sends are checked per message
+	if !fanOutSends[r.URL.Path] && !s.checkRecipientLimit(w, r, txtid, req, body) {
+		return false
+	}
+
+	// Fan-out sends are counted per message
+	if !fanOutSends[r.URL.Path] {
+		wait, until, capped := s.reserveWarmupSend(txtid, time.Now())
+		if capped {
+			// Internal sends are retried by their caller, so they are refused
+			// rather than queued a second time
+			if isInternalSend(r) {
+				retryAfter := int(time.Until(until).Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				s.Respond(w, r, http.StatusServiceUnavailable, map[string]interface{}{
+					"success":    false,
+					"error":      "warm-up send cap reached",
+					"code":       errCodeWarmupCap,
+					"retryAfter": retryAfter,
+				})
+				return false
+			}
+			payload, err := body()
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("could not read payload"))
+				return false
+			}
+			s.respondDeferred(w, r, txtid, payload, until, "warmup")
+			return false
+		}
+		if wait > 0 {
+			select {
+			case <-r.Context().Done():
+				s.Respond(w, r, http.StatusRequestTimeout, errors.New("request canceled during the warm-up delay"))
+				return false
+			case <-time.After(wait):
+			}
+		}
+	}
+
+	return true
+}
+
+// respondDeferred queues the send request and tells the caller when it will go out
+func (s *server) respondDeferred(w http.ResponseWriter, r *http.Request, txtid string, body []byte, deliverAt time.Time, reason string) {
+	id, err := s.deferSend(txtid, r.URL.Path, body, deliverAt, reason)
+	if err != nil {
+		s.Respond(w, r, http.StatusInternalServerError, err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"success":   true,
+		"queued":    true,
+		"queueId":   id,
+		"deliverAt": deliverAt.Unix(),
+		"reason":    reason,
+	}
+
+	s.Respond(w, r, http.StatusAccepted, response)
+}
+
+// isInternalSend reports whether the request was issued by the server itself
+func isInternalSend(r *http.Request) bool {
+	internal, _ := r.Context().Value("internalSend").(bool)
+	return internal
+}
+
+// InternalSend sends a request through the router as the user with the given
+// stored token
+func (s *server) InternalSend(token, path, body string) *httptest.ResponseRecorder {
+	ctx := context.WithValue(context.Background(), "internalSend", true)
+	ctx = context.WithValue(ctx, "internalToken", token)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, path, bytes.NewReader([]byte(body)))
+	req.Header.Set("Content-Type", "application/json")
+	// Callers read the message ID from the top level
+	req.Header.Set(envelopeHeader, envelopeLegacy)
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// maxPresenceSubscriptions caps the users an instance follows the presence of
+const maxPresenceSubscriptions = 1000
+
+// parsePresenceSubscriptions reads the stored comma-separated user IDs
+func parsePresenceSubscriptions(raw string) []int64 {
+	userIDs := []int64{}
+	for _, item := range splitList(raw, ",") {
+		if userID, err := strconv.ParseInt(item, 10, 64); err == nil {
+			userIDs = append(userIDs, userID)
+		}
+	}
+	return userIDs
+}
+
+// formatPresenceSubscriptions returns the stored form of user IDs
+func formatPresenceSubscriptions(userIDs []int64) string {
+	items := make([]string, len(userIDs))
+	for i, userID := range userIDs {
+		items[i] = strconv.FormatInt(userID, 10)
+	}
+	return strings.Join(items, ",")
+}
+
+// presenceSubscriptions returns the users an instance follows the presence of
+func (s *server) presenceSubscriptions(userID string) ([]int64, error) {
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(presence_subscriptions, '') FROM users WHERE id = $1", userID); err != nil {
+		return nil, err
+	}
+	return parsePresenceSubscriptions(raw), nil
+}
+
+// restorePresenceSubscriptions subscribes again after a login, as MAX only
+// keeps presence subscriptions for the session
+func (mycli *MyClient) restorePresenceSubscriptions(postmap map[string]interface{}) {
+	if eventType, _ := postmap["type"].(string); eventType != "Sync" {
+		return
+	}
+	userIDs, err := mycli.s.presenceSubscriptions(mycli.userID)
+	if err != nil || len(userIDs) == 0 {
+		return
+	}
+
+	client := mycli.MaxClient
+	goTracked(mycli.userID, func() {
+		if _, err := client.SubscribePresence(userIDs); err != nil {
+			log.Warn().Err(err).Str("userID", mycli.userID).Int("users", len(userIDs)).Msg("Failed to restore presence subscriptions")
+		}
+	})
+}
+
+// GetPresenceSubscriptions lists the presence subscriptions
+// @Summary List presence subscriptions
+// @Description Returns the users whose presence the instance follows. MAX sends PresenceUpdate events only for these users and contacts.
+// @Tags User
+// @Produce json
+// @Success 200 {object} PresenceSubscriptionsResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/presence/subscriptions [get]
+func (s *server) GetPresenceSubscriptions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		userIDs, err := s.presenceSubscriptions(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"userIds": userIDs,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// UpdatePresenceSubscriptions subscribes to and unsubscribes from presence
+// @Summary Update presence subscriptions
+// @Description Subscribes to the presence of the users in subscribe and unsubscribes from the users in unsubscribe. Subscribed users send PresenceUpdate events; their current presence is returned in presence, keyed by user ID. Subscriptions are stored and restored after every reconnect, up to 1000 users.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body PresenceSubscriptionsBody true "Users to subscribe to and unsubscribe from"
+// @Success 200 {object} PresenceSubscriptionsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/presence/subscriptions [post]
+func (s *server) UpdatePresenceSubscriptions() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg PresenceSubscriptionsBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if len(msg.Subscribe) == 0 && len(msg.Unsubscribe) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("subscribe or unsubscribe is required"))
+			return
+		}
+		for _, userID := range append(slices.Clone(msg.Subscribe), msg.Unsubscribe...) {
+			if userID <= 0 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("user IDs must be positive"))
+				return
+			}
+		}
+
+		userIDs, err := s.presenceSubscriptions(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		for _, userID := range msg.Unsubscribe {
+			userIDs = slices.DeleteFunc(userIDs, func(id int64) bool { return id == userID })
+		}
+		for _, userID := range msg.Subscribe {
+			if !slices.Contains(userIDs, userID) {
+				userIDs = append(userIDs, userID)
+			}
+		}
+		if len(userIDs) > maxPresenceSubscriptions {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("at most %d presence subscriptions", maxPresenceSubscriptions))
+			return
+		}
+
+		if len(msg.Unsubscribe) > 0 {
+			if err := client.UnsubscribePresence(msg.Unsubscribe); err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("unsubscribe failed: %v", err))
+				return
+			}
+		}
+		presence := map[string]interface{}{}
+		if len(msg.Subscribe) > 0 {
+			current, err := client.SubscribePresence(msg.Subscribe)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("subscribe failed: %v", err))
+				return
+			}
+			for userID, p := range current {
+				presence[strconv.FormatInt(userID, 10)] = p
+			}
+		}
+
+		if _, err := s.db.Exec("UPDATE users SET presence_subscriptions = $1 WHERE id = $2", formatPresenceSubscriptions(userIDs), txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int("subscribed", len(msg.Subscribe)).Int("unsubscribed", len(msg.Unsubscribe)).Int("total", len(userIDs)).Msg("Presence subscriptions updated")
+
+		response := map[string]interface{}{
+			"success":  true,
+			"userIds":  userIDs,
+			"presence": presence,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetUserPresence returns the last-seen time of a user
+// @Summary Get user presence
+// @Description Returns when a MAX user was last seen, as Unix seconds. seen is 0 when MAX does not share it.
+// @Tags User
+// @Produce json
+// @Param userId path string true "MAX user ID"
+// @Success 200 {object} UserPresenceResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/presence/{userId} [get]
+func (s *server) GetUserPresence() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		userID, err := strconv.ParseInt(mux.Vars(r)["userId"], 10, 64)
+		if err != nil || userID <= 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("invalid user ID"))
+			return
+		}
+
+		presence, err := client.GetPresence(userID)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("presence failed: %v", err))
+			return
+		}
+		var seen int64
+		if presence != nil {
+			seen = presence.Seen
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"userId":  userID,
+			"seen":    seen,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+	"maxapi/maxclient"
+)
+
+// profileNames returns the first and last name of a profile
+func profileNames(me *maxclient.Me) (string, string) {
+	if me == nil || len(me.Names) == 0 {
+		return "", ""
+	}
+	return me.Names[0].FirstName, me.Names[0].LastName
+}
+
+// GetProfile returns the profile of the MAX account
+// @Summary Get profile
+// @Description Returns the profile of the MAX account: names, description, photo and link
+// @Tags User
+// @Produce json
+// @Success 200 {object} ProfileResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/profile [get]
+func (s *server) GetProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+		if client.Me == nil {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("profile not loaded"))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"profile": client.Me,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// UpdateProfile updates the name and description of the MAX account
+// @Summary Update profile
+// @Description Sets the first name, last name and description of the MAX account. Fields left out keep their current value. Returns the updated profile.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body ProfileBody true "Profile fields"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/profile [post]
+func (s *server) UpdateProfile() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg ProfileBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		firstName, lastName := profileNames(client.Me)
+		description := ""
+		if client.Me != nil {
+			description = client.Me.Description
+		}
+		if v := strings.TrimSpace(msg.FirstName); v != "" {
+			firstName = v
+		}
+		if v := strings.TrimSpace(msg.LastName); v != "" {
+			lastName = v
+		}
+		if v := strings.TrimSpace(msg.Description); v != "" {
+			description = v
+		}
+
+		if firstName == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("firstName is required"))
+			return
+		}
+
+		profile, err := client.UpdateProfile(firstName, lastName, description)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("profile update failed: %v", err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Msg("Profile updated")
+
+		response := map[string]interface{}{
+			"success": true,
+			"profile": profile,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// UpdateAvatar sets the profile picture of the MAX account
+// @Summary Update profile picture
+// @Description Uploads an image and sets it as the profile picture of the MAX account. image is a data URL, an http(s) URL or plain base64. Returns the updated profile.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body AvatarBody true "Profile picture"
+// @Success 200 {object} ProfileResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 413 {object} api.ErrorResponse "Image larger than the upload limit"
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/avatar [post]
+func (s *server) UpdateAvatar() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		var msg AvatarBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if msg.Image == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("image is required"))
+			return
+		}
+
+		imageData, filename, err := api.DecodeMediaData(msg.Image, "avatar.jpg")
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid image data: %v", err))
+			return
+		}
+		if len(imageData) == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("image is empty"))
+			return
+		}
+
+		if !s.CheckUploadSize(w, r, client, int64(len(imageData))) {
+			return
+		}
+
+		profile, err := client.UpdateAvatar(imageData, filename)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("avatar update failed: %v", err))
+			return
+		}
+
+		log.Info().Str("userID", txtid).Int("size", len(imageData)).Msg("Profile picture updated")
+
+		response := map[string]interface{}{
+			"success": true,
+			"profile": profile,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
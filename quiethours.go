@@ -0,0 +1,228 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// quietHoursConfig is the per-user do-not-disturb window for outgoing messages
+type quietHoursConfig struct {
+	Enabled  bool   `db:"quiet_hours_enabled"`
+	Start    string `db:"quiet_hours_start"`
+	End      string `db:"quiet_hours_end"`
+	Timezone string `db:"quiet_hours_timezone"`
+}
+
+// parseClock parses "HH:MM" into minutes since midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func loadQuietHoursLocation(name string) (*time.Location, error) {
+	if name == "" {
+		return time.Local, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q", name)
+	}
+	return loc, nil
+}
+
+// windowEnd returns the end of the quiet window if now falls inside it.
+// Windows where start is after end span midnight (e.g. 21:00-09:00).
+func (q quietHoursConfig) windowEnd(now time.Time) (time.Time, bool) {
+	if !q.Enabled {
+		return time.Time{}, false
+	}
+
+	start, err := parseClock(q.Start)
+	if err != nil {
+		return time.Time{}, false
+	}
+	end, err := parseClock(q.End)
+	if err != nil || start == end {
+		return time.Time{}, false
+	}
+	loc, err := loadQuietHoursLocation(q.Timezone)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	local := now.In(loc)
+	current := local.Hour()*60 + local.Minute()
+
+	var inside bool
+	if start < end {
+		inside = current >= start && current < end
+	} else {
+		inside = current >= start || current < end
+	}
+	if !inside {
+		return time.Time{}, false
+	}
+
+	until := time.Date(local.Year(), local.Month(), local.Day(), end/60, end%60, 0, 0, loc)
+	if !until.After(local) {
+		until = until.AddDate(0, 0, 1)
+	}
+	return until, true
+}
+
+func (s *server) getQuietHours(txtid string) (quietHoursConfig, error) {
+	var q quietHoursConfig
+	err := s.db.Get(&q, `SELECT COALESCE(quiet_hours_enabled, FALSE) AS quiet_hours_enabled,
+		COALESCE(quiet_hours_start, '') AS quiet_hours_start,
+		COALESCE(quiet_hours_end, '') AS quiet_hours_end,
+		COALESCE(quiet_hours_timezone, '') AS quiet_hours_timezone
+		FROM users WHERE id=$1`, txtid)
+	return q, err
+}
+
+// quietHoursUntil reports whether the user is inside quiet hours and when they end
+func (s *server) quietHoursUntil(txtid string, now time.Time) (time.Time, bool) {
+	q, err := s.getQuietHours(txtid)
+	if err != nil {
+		log.Error().Err(err).Str("userID", txtid).Msg("Failed to load quiet hours")
+		return time.Time{}, false
+	}
+	return s.withUserTimezone(txtid, q).windowEnd(now)
+}
+
+// ========== QUIET HOURS ENDPOINTS ==========
+
+// GetQuietHours returns quiet hours settings
+// @Summary Get quiet hours
+// @Description Returns the do-not-disturb window during which non-urgent sends are queued. Without a timezone the window uses the timezone of /user/settings.
+// @Tags Quiet Hours
+// @Produce json
+// @Success 200 {object} QuietHoursResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/quiethours [get]
+func (s *server) GetQuietHours() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		q, err := s.getQuietHours(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		_, active := s.withUserTimezone(txtid, q).windowEnd(time.Now())
+
+		response := map[string]interface{}{
+			"success":  true,
+			"enabled":  q.Enabled,
+			"start":    q.Start,
+			"end":      q.End,
+			"timezone": q.Timezone,
+			"active":   active,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetQuietHours updates quiet hours settings
+// @Summary Set quiet hours
+// @Description Configures a timezone-aware do-not-disturb window. Non-urgent sends during the window are queued and delivered when it ends. Set "urgent": true on a send request to bypass it. Without a timezone the window uses the timezone of /user/settings.
+// @Tags Quiet Hours
+// @Accept json
+// @Produce json
+// @Param request body QuietHoursBody true "Quiet hours settings"
+// @Success 200 {object} QuietHoursResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/quiethours [post]
+func (s *server) SetQuietHours() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg QuietHoursBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.Enabled {
+			start, err := parseClock(msg.Start)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			end, err := parseClock(msg.End)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			if start == end {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("start and end must differ"))
+				return
+			}
+			if _, err := loadQuietHoursLocation(msg.Timezone); err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+		}
+
+		_, err := s.db.Exec(`UPDATE users SET quiet_hours_enabled=$1, quiet_hours_start=$2, quiet_hours_end=$3, quiet_hours_timezone=$4 WHERE id=$5`,
+			msg.Enabled, msg.Start, msg.End, msg.Timezone, txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		q := quietHoursConfig{Enabled: msg.Enabled, Start: msg.Start, End: msg.End, Timezone: msg.Timezone}
+		_, active := s.withUserTimezone(txtid, q).windowEnd(time.Now())
+
+		response := map[string]interface{}{
+			"success":  true,
+			"enabled":  msg.Enabled,
+			"start":    msg.Start,
+			"end":      msg.End,
+			"timezone": msg.Timezone,
+			"active":   active,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetQuietHoursQueue lists sends waiting for delivery
+// @Summary List queued messages
+// @Description Returns send requests that were deferred and are waiting for delivery
+// @Tags Quiet Hours
+// @Produce json
+// @Success 200 {object} DeferredQueueResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/quiethours/queue [get]
+func (s *server) GetQuietHoursQueue() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		messages, err := s.listDeferred(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"messages": messages,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
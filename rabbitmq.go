@@ -1,25 +1,259 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
-	"encoding/json"
+	"sync/atomic"
+	"time"
+
 	"github.com/rabbitmq/amqp091-go"
 	"github.com/rs/zerolog/log"
 )
 
+const (
+	rabbitConfirmTimeout  = 5 * time.Second
+	rabbitMaxBackoff      = 30 * time.Second
+	rabbitReplayInterval  = 30 * time.Second
+	rabbitDefaultMaxQueue = 100000
+	rabbitDefaultChannels = 4
+
+	// rabbitDefaultUserPrefix keeps the exchanges and queues of user sinks
+	// apart when RABBITMQ_USER_PREFIX is not set
+	rabbitDefaultUserPrefix = "maxapi.user.{{userID}}."
+)
+
 var (
-	rabbitConn    *amqp091.Connection
-	rabbitChannel *amqp091.Channel
-	rabbitEnabled bool
-	rabbitOnce    sync.Once
-	rabbitQueue   string
+	rabbitConn      *amqp091.Connection
+	rabbitPool      []*rabbitPoolChannel
+	rabbitPoolSize  = rabbitDefaultChannels
+	rabbitNext      atomic.Uint64
+	rabbitEnabled   bool
+	rabbitConnected atomic.Bool
+	rabbitQueue     string
+	rabbitURL       string
+	// rabbitUserPrefix is the required prefix of user sink exchanges and queues
+	rabbitUserPrefix string
+
+	// rabbitMu guards the connection and the channel pool
+	rabbitMu       sync.Mutex
+	rabbitDeclared sync.Map // user sinks declared on the current connection
+	rabbitReplayMu sync.Mutex
+	rabbitBuffer   *rabbitDiskBuffer
+
+	rabbitStats struct {
+		Published atomic.Int64
+		Acked     atomic.Int64
+		Nacked    atomic.Int64
+		Replayed  atomic.Int64
+		Dropped   atomic.Int64
+	}
 )
 
+// errRabbitSinkRefused marks a user sink the broker will not declare; retrying
+// its messages cannot succeed, so they are dropped instead of buffered
+var errRabbitSinkRefused = errors.New("sink refused by broker")
+
+// rabbitRefused reports whether the broker rejected a declaration itself,
+// as opposed to the connection failing
+func rabbitRefused(err error) bool {
+	var amqpErr *amqp091.Error
+	if !errors.As(err, &amqpErr) {
+		return false
+	}
+	switch amqpErr.Code {
+	case amqp091.PreconditionFailed, amqp091.AccessRefused, amqp091.NotFound, amqp091.NotAllowed:
+		return true
+	}
+	return false
+}
+
+// rabbitPoolChannel is a pooled channel in confirm mode; publishes on it are serialized
+// so every confirmation belongs to the publish waiting for it
+type rabbitPoolChannel struct {
+	mu sync.Mutex
+	ch *amqp091.Channel
+}
+
+// rabbitMessage is a single publish, kept on disk while the broker is unavailable
+type rabbitMessage struct {
+	Exchange   string      `json:"exchange"`
+	RoutingKey string      `json:"routingKey"`
+	Queue      string      `json:"queue,omitempty"` // declared before publishing
+	Sink       *RabbitSink `json:"sink,omitempty"`  // user sink, declared before publishing
+	Body       []byte      `json:"body"`
+}
+
+// RabbitSink routes a subset of events to an exchange or queue
+type RabbitSink struct {
+	Name         string   `json:"name"`
+	Exchange     string   `json:"exchange"`     // empty = default exchange, publish to Queue
+	ExchangeType string   `json:"exchangeType"` // direct, fanout, topic (default) or headers
+	Queue        string   `json:"queue"`        // optional, declared and bound to Exchange
+	BindingKey   string   `json:"bindingKey"`   // binding for Queue, default "#"
+	RoutingKey   string   `json:"routingKey"`   // supports {{userID}}, {{eventType}}, {{instanceName}}
+	Events       []string `json:"events"`       // empty or "All" = every event
+}
+
+func (sink *RabbitSink) validate() error {
+	if sink.Exchange == "" && sink.Queue == "" {
+		return errors.New("exchange or queue is required")
+	}
+	if sink.ExchangeType == "" {
+		sink.ExchangeType = "topic"
+	}
+	if sink.BindingKey == "" {
+		sink.BindingKey = "#"
+	}
+	for _, event := range sink.Events {
+		if !isValidEventType(event) {
+			return errors.New("unsupported event type " + event)
+		}
+	}
+	return nil
+}
+
+func (sink RabbitSink) matches(eventType string) bool {
+	return len(sink.Events) == 0 || Find(sink.Events, "All") || Find(sink.Events, eventType)
+}
+
+func (sink RabbitSink) routingKey(userID, eventType, instanceName string) string {
+	if sink.Exchange == "" {
+		return sink.Queue
+	}
+	return renderTemplate(sink.RoutingKey, map[string]string{
+		"userID":       userID,
+		"eventType":    eventType,
+		"instanceName": instanceName,
+	})
+}
+
+// setupRabbitSinks declares the default queue and the exchanges and queues of the configured sinks
+func setupRabbitSinks(ch *amqp091.Channel) error {
+	if _, err := ch.QueueDeclare(rabbitQueue, true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	for _, sink := range currentConfig().RabbitMQ.Sinks {
+		if err := declareRabbitSink(ch, sink); err != nil {
+			return err
+		}
+		log.Info().Str("sink", sink.Name).Str("exchange", sink.Exchange).Str("queue", sink.Queue).Strs("events", sink.Events).Msg("RabbitMQ sink configured")
+	}
+	return nil
+}
+
+// declareRabbitSink declares the exchange and queue of a sink and binds them
+func declareRabbitSink(ch *amqp091.Channel, sink RabbitSink) error {
+	if sink.Exchange != "" {
+		if err := ch.ExchangeDeclare(sink.Exchange, sink.ExchangeType, true, false, false, false, nil); err != nil {
+			return err
+		}
+	}
+	if sink.Queue != "" {
+		if _, err := ch.QueueDeclare(sink.Queue, true, false, false, false, nil); err != nil {
+			return err
+		}
+		if sink.Exchange != "" {
+			if err := ch.QueueBind(sink.Queue, sink.BindingKey, sink.Exchange, false, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// declareUserSink declares a user sink once per connection
+func declareUserSink(sink RabbitSink) error {
+	key := strings.Join([]string{sink.Exchange, sink.ExchangeType, sink.Queue, sink.BindingKey}, "\x00")
+	if _, ok := rabbitDeclared.Load(key); ok {
+		return nil
+	}
+	err := withSinkChannel(func(ch *amqp091.Channel) error {
+		return declareRabbitSink(ch, sink)
+	})
+	if err != nil {
+		return err
+	}
+	rabbitDeclared.Store(key, struct{}{})
+	return nil
+}
+
+// withSinkChannel runs fn on a channel of its own, so a declaration the broker
+// refuses (e.g. an exchange that exists with another type) closes that channel
+// and not a pooled one, whose close would reconnect every tenant
+func withSinkChannel(fn func(ch *amqp091.Channel) error) error {
+	rabbitMu.Lock()
+	conn := rabbitConn
+	rabbitMu.Unlock()
+	if conn == nil || !rabbitConnected.Load() {
+		return errors.New("not connected to RabbitMQ")
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return fmt.Errorf("could not open channel: %w", err)
+	}
+	defer ch.Close()
+	return fn(ch)
+}
+
+// checkRabbitSinks declares sinks on a separate channel, so a refused
+// declaration is reported to the user. Without a connection nothing is checked.
+func checkRabbitSinks(sinks []RabbitSink) error {
+	if !rabbitConnected.Load() {
+		return nil
+	}
+	return withSinkChannel(func(ch *amqp091.Channel) error {
+		for i, sink := range sinks {
+			if err := declareRabbitSink(ch, sink); err != nil {
+				return fmt.Errorf("rabbitmq sink %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
+
+// setupLiveRabbitSinks declares the configured sinks on the open connection, used after a configuration reload.
+// Without a connection the sinks are declared when it is established.
+func setupLiveRabbitSinks() error {
+	pc := nextRabbitChannel()
+	if pc == nil {
+		return nil
+	}
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+	return setupRabbitSinks(pc.ch)
+}
+
+// nextRabbitChannel picks a pooled channel round-robin, nil without a connection
+func nextRabbitChannel() *rabbitPoolChannel {
+	rabbitMu.Lock()
+	pool := rabbitPool
+	rabbitMu.Unlock()
+	if len(pool) == 0 {
+		return nil
+	}
+	return pool[rabbitNext.Add(1)%uint64(len(pool))]
+}
+
 // Call this in main() or initialization
 func InitRabbitMQ() {
-	rabbitURL := os.Getenv("RABBITMQ_URL")
+	rabbitURL = os.Getenv("RABBITMQ_URL")
 	rabbitQueue = os.Getenv("RABBITMQ_QUEUE")
+	rabbitUserPrefix = os.Getenv("RABBITMQ_USER_PREFIX")
+	if rabbitUserPrefix == "" {
+		rabbitUserPrefix = rabbitDefaultUserPrefix
+	} else if !strings.Contains(rabbitUserPrefix, "{{userID}}") {
+		log.Warn().Str("prefix", rabbitUserPrefix).Msg("RABBITMQ_USER_PREFIX has no {{userID}}, so users can reach each other's sinks")
+	}
 	if rabbitQueue == "" {
 		rabbitQueue = "max_events" // default queue
 	}
@@ -28,23 +262,259 @@ func InitRabbitMQ() {
 		log.Info().Msg("RABBITMQ_URL is not set. RabbitMQ publishing disabled.")
 		return
 	}
+
+	bufferDir := os.Getenv("RABBITMQ_BUFFER_DIR")
+	if bufferDir == "" {
+		ex, err := os.Executable()
+		if err != nil {
+			log.Error().Err(err).Msg("Could not determine RabbitMQ buffer directory")
+			return
+		}
+		bufferDir = filepath.Join(filepath.Dir(ex), "rabbitmq_buffer")
+	}
+	maxBuffered := rabbitDefaultMaxQueue
+	if v, err := strconv.Atoi(os.Getenv("RABBITMQ_BUFFER_MAX")); err == nil && v > 0 {
+		maxBuffered = v
+	}
+	if v := envInt("RABBITMQ_CHANNELS", rabbitDefaultChannels); v > 0 {
+		rabbitPoolSize = v
+	}
+
 	var err error
-	rabbitConn, err = amqp091.Dial(rabbitURL)
+	rabbitBuffer, err = newRabbitDiskBuffer(bufferDir, maxBuffered)
 	if err != nil {
-		rabbitEnabled = false
-		log.Error().Err(err).Msg("Could not connect to RabbitMQ")
+		log.Error().Err(err).Str("dir", bufferDir).Msg("Could not open RabbitMQ buffer directory")
 		return
 	}
-	rabbitChannel, err = rabbitConn.Channel()
+	rabbitEnabled = true
+
+	if err := rabbitConnect(); err != nil {
+		log.Error().Err(err).Msg("Could not connect to RabbitMQ, events will be buffered until it is available")
+	} else {
+		log.Info().
+			Str("queue", rabbitQueue).
+			Int("channels", rabbitPoolSize).
+			Int("sinks", len(currentConfig().RabbitMQ.Sinks)).
+			Int64("buffered", rabbitBuffer.count.Load()).
+			Msg("RabbitMQ connection established.")
+	}
+
+	go rabbitReconnectLoop()
+	go rabbitReplayLoop()
+}
+
+// rabbitConnect opens a connection and a pool of channels in confirm mode
+func rabbitConnect() error {
+	conn, err := amqp091.Dial(rabbitURL)
 	if err != nil {
-		rabbitEnabled = false
-		log.Error().Err(err).Msg("Could not open RabbitMQ channel")
+		return err
+	}
+
+	pool := make([]*rabbitPoolChannel, 0, rabbitPoolSize)
+	for i := 0; i < rabbitPoolSize; i++ {
+		ch, err := conn.Channel()
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("could not open channel: %w", err)
+		}
+		if err := ch.Confirm(false); err != nil {
+			conn.Close()
+			return fmt.Errorf("could not enable publisher confirms: %w", err)
+		}
+		pool = append(pool, &rabbitPoolChannel{ch: ch})
+	}
+	if err := setupRabbitSinks(pool[0].ch); err != nil {
+		conn.Close()
+		return fmt.Errorf("could not set up sinks: %w", err)
+	}
+
+	rabbitDeclared.Clear()
+	rabbitMu.Lock()
+	rabbitConn = conn
+	rabbitPool = pool
+	rabbitMu.Unlock()
+	rabbitConnected.Store(true)
+	return nil
+}
+
+// rabbitWaitClosed blocks until the connection or one of the pooled channels
+// closes, then closes the connection so the whole pool is reopened
+func rabbitWaitClosed(conn *amqp091.Connection, pool []*rabbitPoolChannel) {
+	closed := make(chan struct{}, len(pool)+1)
+	go func() {
+		if err := <-conn.NotifyClose(make(chan *amqp091.Error, 1)); err != nil {
+			log.Warn().Interface("reason", err).Msg("RabbitMQ connection closed")
+		}
+		closed <- struct{}{}
+	}()
+	for _, pc := range pool {
+		go func(ch *amqp091.Channel) {
+			if err := <-ch.NotifyClose(make(chan *amqp091.Error, 1)); err != nil {
+				log.Warn().Interface("reason", err).Msg("RabbitMQ channel closed")
+			}
+			closed <- struct{}{}
+		}(pc.ch)
+	}
+
+	<-closed
+	conn.Close()
+}
+
+// rabbitReconnectLoop reconnects after the connection or a channel closes and replays the buffer
+func rabbitReconnectLoop() {
+	backoff := time.Second
+	for {
+		rabbitMu.Lock()
+		conn, pool := rabbitConn, rabbitPool
+		rabbitMu.Unlock()
+
+		if conn != nil && rabbitConnected.Load() {
+			rabbitWaitClosed(conn, pool)
+			rabbitConnected.Store(false)
+		}
+
+		if err := rabbitConnect(); err != nil {
+			log.Error().Err(err).Dur("retryIn", backoff).Msg("RabbitMQ reconnect failed")
+			time.Sleep(backoff)
+			backoff *= 2
+			if backoff > rabbitMaxBackoff {
+				backoff = rabbitMaxBackoff
+			}
+			continue
+		}
+
+		backoff = time.Second
+		log.Info().Int64("buffered", rabbitBuffer.count.Load()).Msg("RabbitMQ reconnected")
+		go replayRabbitBuffer()
+	}
+}
+
+// rabbitReplayLoop retries buffered messages that failed while the connection stayed up
+func rabbitReplayLoop() {
+	ticker := time.NewTicker(rabbitReplayInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if rabbitConnected.Load() && rabbitBuffer.count.Load() > 0 {
+			replayRabbitBuffer()
+		}
+	}
+}
+
+// replayRabbitBuffer publishes buffered messages oldest first until one fails
+func replayRabbitBuffer() {
+	rabbitReplayMu.Lock()
+	defer rabbitReplayMu.Unlock()
+
+	files, err := rabbitBuffer.files()
+	if err != nil {
+		log.Error().Err(err).Msg("Could not list RabbitMQ buffer")
 		return
 	}
-	rabbitEnabled = true
-	log.Info().
-		Str("queue", rabbitQueue).
-		Msg("RabbitMQ connection established.")
+
+	replayed := 0
+	for _, file := range files {
+		msg, err := rabbitBuffer.read(file)
+		if err != nil {
+			log.Error().Err(err).Str("file", file).Msg("Dropping unreadable buffered RabbitMQ message")
+			rabbitBuffer.remove(file)
+			rabbitStats.Dropped.Add(1)
+			continue
+		}
+		if err := publishConfirmed(msg); errors.Is(err, errRabbitSinkRefused) {
+			log.Error().Err(err).Str("file", file).Msg("Dropping buffered RabbitMQ message for a refused sink")
+			rabbitBuffer.remove(file)
+			rabbitStats.Dropped.Add(1)
+			continue
+		} else if err != nil {
+			log.Warn().Err(err).Int("replayed", replayed).Msg("RabbitMQ replay interrupted")
+			return
+		}
+		rabbitBuffer.remove(file)
+		rabbitStats.Replayed.Add(1)
+		replayed++
+	}
+
+	if replayed > 0 {
+		log.Info().Int("replayed", replayed).Msg("Replayed buffered RabbitMQ messages")
+	}
+}
+
+// publishConfirmed publishes a persistent message and waits for the broker to confirm it
+func publishConfirmed(msg rabbitMessage) error {
+	pc := nextRabbitChannel()
+	if pc == nil || !rabbitConnected.Load() {
+		return errors.New("not connected to RabbitMQ")
+	}
+
+	// User sinks are declared on a channel of their own, before the pooled one is taken
+	if msg.Sink != nil {
+		if err := declareUserSink(*msg.Sink); err != nil {
+			if rabbitRefused(err) {
+				return fmt.Errorf("could not declare sink %s: %w: %w", msg.Sink.Name, errRabbitSinkRefused, err)
+			}
+			return fmt.Errorf("could not declare sink %s: %w", msg.Sink.Name, err)
+		}
+	}
+
+	pc.mu.Lock()
+	defer pc.mu.Unlock()
+
+	if msg.Queue != "" {
+		if _, err := pc.ch.QueueDeclare(msg.Queue, true, false, false, false, nil); err != nil {
+			return fmt.Errorf("could not declare queue %s: %w", msg.Queue, err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), rabbitConfirmTimeout)
+	defer cancel()
+
+	confirm, err := pc.ch.PublishWithDeferredConfirmWithContext(ctx,
+		msg.Exchange,
+		msg.RoutingKey,
+		false, // mandatory
+		false, // immediate
+		amqp091.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: amqp091.Persistent,
+			Body:         msg.Body,
+		},
+	)
+	if err != nil {
+		return err
+	}
+
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("no confirmation from broker: %w", err)
+	}
+	if !acked {
+		rabbitStats.Nacked.Add(1)
+		return errors.New("message nacked by broker")
+	}
+	rabbitStats.Acked.Add(1)
+	return nil
+}
+
+// publishRabbitMessage publishes with confirmation and buffers the message on disk on failure
+func publishRabbitMessage(msg rabbitMessage) error {
+	rabbitStats.Published.Add(1)
+
+	err := publishConfirmed(msg)
+	if err == nil {
+		log.Debug().Str("exchange", msg.Exchange).Str("routingKey", msg.RoutingKey).Msg("Published message to RabbitMQ")
+		return nil
+	}
+	if errors.Is(err, errRabbitSinkRefused) {
+		rabbitStats.Dropped.Add(1)
+		return err
+	}
+
+	if bufErr := rabbitBuffer.push(msg); bufErr != nil {
+		rabbitStats.Dropped.Add(1)
+		return fmt.Errorf("publish failed (%v) and message could not be buffered: %w", err, bufErr)
+	}
+	log.Warn().Err(err).Int64("buffered", rabbitBuffer.count.Load()).Msg("RabbitMQ publish failed, message buffered")
+	return nil
 }
 
 // Optionally, allow overriding the queue per message
@@ -56,33 +526,19 @@ func PublishToRabbit(data []byte, queueOverride ...string) error {
 	if len(queueOverride) > 0 && queueOverride[0] != "" {
 		queueName = queueOverride[0]
 	}
-	// Declare queue (idempotent)
-	_, err := rabbitChannel.QueueDeclare(
-		queueName,
-		true,  // durable
-		false, // auto-delete
-		false, // exclusive
-		false, // no-wait
-		nil,   // arguments
-	)
-	if err != nil {
-		log.Error().Err(err).Str("queue", queueName).Msg("Could not declare RabbitMQ queue")
-		return err
+
+	msg := rabbitMessage{
+		Exchange:   "", // default
+		RoutingKey: queueName,
+		Body:       data,
 	}
-	err = rabbitChannel.Publish(
-		"",        // exchange (default)
-		queueName, // routing key = queue
-		false,     // mandatory
-		false,     // immediate
-		amqp091.Publishing{
-			ContentType: "application/json",
-			Body:        data,
-		},
-	)
+	if queueName != rabbitQueue {
+		msg.Queue = queueName
+	}
+
+	err := publishRabbitMessage(msg)
 	if err != nil {
 		log.Error().Err(err).Str("queue", queueName).Msg("Could not publish to RabbitMQ")
-	} else {
-		log.Debug().Str("queue", queueName).Msg("Published message to RabbitMQ")
 	}
 	return err
 }
@@ -100,27 +556,160 @@ func sendToGlobalRabbit(jsonData []byte, token string, userID string, queueName
 		instance_name = userinfo.(Values).Get("Name")
 	}
 
-	// Parse the original JSON into a map
-	var originalData map[string]interface{}
-	err := json.Unmarshal(jsonData, &originalData)
+	// Add the new fields to the top level of the original data
+	enhancedJSON, err := addJSONFields(jsonData, map[string]string{
+		"userID":       userID,
+		"instanceName": instance_name,
+	})
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to unmarshal original JSON data for RabbitMQ")
+		log.Error().Err(err).Msg("Failed to add instance fields to JSON data for RabbitMQ")
 		return
 	}
 
-	// Add the new fields directly to the original data
-	originalData["userID"] = userID
-	originalData["instanceName"] = instance_name
+	// A user's own sinks replace the configured ones for its events; without
+	// any sinks everything goes to the single queue
+	sinks := currentConfig().RabbitMQ.Sinks
+	userSinks := userRabbitSinks(userID)
+	if len(userSinks) > 0 {
+		sinks = userSinks
+	}
+	if len(sinks) == 0 || len(queueName) > 0 {
+		err = PublishToRabbit(enhancedJSON, queueName...)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to publish to RabbitMQ")
+		}
+		return
+	}
+
+	eventType := jsonEventType(jsonData)
+	for _, sink := range sinks {
+		if !sink.matches(eventType) {
+			continue
+		}
+		msg := rabbitMessage{
+			Exchange:   sink.Exchange,
+			RoutingKey: sink.routingKey(userID, eventType, instance_name),
+			Body:       enhancedJSON,
+		}
+		if len(userSinks) > 0 {
+			msg.Sink = &sink
+		}
+		err = publishRabbitMessage(msg)
+		if err != nil {
+			log.Error().Err(err).Str("sink", sink.Name).Msg("Failed to publish to RabbitMQ sink")
+		}
+	}
+}
+
+// rabbitDiskBuffer stores unpublished messages as one file per message
+type rabbitDiskBuffer struct {
+	dir   string
+	max   int64
+	seq   atomic.Int64
+	count atomic.Int64
+}
 
-	// Marshal back to JSON
-	enhancedJSON, err := json.Marshal(originalData)
+func newRabbitDiskBuffer(dir string, max int) (*rabbitDiskBuffer, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	b := &rabbitDiskBuffer{dir: dir, max: int64(max)}
+	files, err := b.files()
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal enhanced data for RabbitMQ")
-		return
+		return nil, err
+	}
+	b.count.Store(int64(len(files)))
+	return b, nil
+}
+
+func (b *rabbitDiskBuffer) push(msg rabbitMessage) error {
+	if b.count.Load() >= b.max {
+		return errors.New("buffer is full")
 	}
 
-	err = PublishToRabbit(enhancedJSON, queueName...)
+	data, err := json.Marshal(msg)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to publish to RabbitMQ")
+		return err
+	}
+
+	name := fmt.Sprintf("%020d-%06d.json", time.Now().UnixNano(), b.seq.Add(1)%1000000)
+	tmp := filepath.Join(b.dir, name+".tmp")
+	if err := os.WriteFile(tmp, data, 0640); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(b.dir, name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	b.count.Add(1)
+	return nil
+}
+
+// files returns buffered message files, oldest first
+func (b *rabbitDiskBuffer) files() ([]string, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			files = append(files, entry.Name())
+		}
+	}
+	return files, nil
+}
+
+func (b *rabbitDiskBuffer) read(name string) (rabbitMessage, error) {
+	var msg rabbitMessage
+	data, err := os.ReadFile(filepath.Join(b.dir, name))
+	if err != nil {
+		return msg, err
+	}
+	err = json.Unmarshal(data, &msg)
+	return msg, err
+}
+
+func (b *rabbitDiskBuffer) remove(name string) {
+	if err := os.Remove(filepath.Join(b.dir, name)); err == nil {
+		b.count.Add(-1)
+	}
+}
+
+// RabbitMQStats returns RabbitMQ delivery counters
+// @Summary RabbitMQ delivery stats
+// @Description Returns publisher confirm counters and the number of events buffered on disk while the broker is unavailable
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} RabbitMQStatsResponse
+// @Security AdminAuth
+// @Router /admin/rabbitmq/stats [get]
+func (s *server) RabbitMQStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var buffered int64
+		if rabbitBuffer != nil {
+			buffered = rabbitBuffer.count.Load()
+		}
+		channels := 0
+		if rabbitConnected.Load() {
+			rabbitMu.Lock()
+			channels = len(rabbitPool)
+			rabbitMu.Unlock()
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"enabled":   rabbitEnabled,
+			"connected": rabbitConnected.Load(),
+			"channels":  channels,
+			"published": rabbitStats.Published.Load(),
+			"acked":     rabbitStats.Acked.Load(),
+			"nacked":    rabbitStats.Nacked.Load(),
+			"buffered":  buffered,
+			"replayed":  rabbitStats.Replayed.Load(),
+			"dropped":   rabbitStats.Dropped.Load(),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
 	}
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// errCodeRateLimited is returned for requests over the rate limit of a route
+	errCodeRateLimited = "RATE_LIMITED"
+
+	rateLimitWindow = time.Minute
+)
+
+// rateWindow counts the requests of one instance in the current window
+type rateWindow struct {
+	start time.Time
+	count int
+}
+
+// routeLimiter allows each instance limit requests per minute to one route
+type routeLimiter struct {
+	limit int
+
+	mu      sync.Mutex
+	windows map[string]*rateWindow
+}
+
+func newRouteLimiter(limit int) *routeLimiter {
+	return &routeLimiter{limit: limit, windows: map[string]*rateWindow{}}
+}
+
+// allow counts a request of userID, returning when the window ends if it is over the limit
+func (l *routeLimiter) allow(userID string, now time.Time) (until time.Time, ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	window := l.windows[userID]
+	if window == nil || now.Sub(window.start) >= rateLimitWindow {
+		window = &rateWindow{start: now}
+		l.windows[userID] = window
+	}
+	if window.count >= l.limit {
+		return window.start.Add(rateLimitWindow), false
+	}
+	window.count++
+	return time.Time{}, true
+}
+
+// rateLimit returns the middleware enforcing the rate limit of a route.
+// Requests over the limit get 429 with a Retry-After header.
+func (s *server) rateLimit(limit int) Middleware {
+	limiter := newRouteLimiter(limit)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID := r.Context().Value("userinfo").(Values).Get("Id")
+			if until, ok := limiter.allow(userID, time.Now()); !ok {
+				retryAfter := int(time.Until(until).Seconds()) + 1
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				s.Respond(w, r, http.StatusTooManyRequests, map[string]interface{}{
+					"success":    false,
+					"error":      "rate limit of the endpoint reached",
+					"code":       errCodeRateLimited,
+					"retryAfter": retryAfter,
+				})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
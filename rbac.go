@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// adminRole is the access level of an admin key. Each role includes the
+// rights of the roles below it.
+type adminRole int
+
+const (
+	// roleAuditor can read users, statistics and settings
+	roleAuditor adminRole = iota + 1
+	// roleOperator can also connect instances and run maintenance operations
+	roleOperator
+	// roleSuperadmin can also create, change and delete users
+	roleSuperadmin
+)
+
+var adminRoleNames = map[adminRole]string{
+	roleAuditor:    "auditor",
+	roleOperator:   "operator",
+	roleSuperadmin: "superadmin",
+}
+
+func (role adminRole) String() string {
+	return adminRoleNames[role]
+}
+
+// adminKey is an admin key with its role and the networks it may be used
+// from (none when it may be used from anywhere)
+type adminKey struct {
+	role    adminRole
+	allowed []netip.Prefix
+}
+
+// adminKeys maps the additional admin keys to their role. The admin token
+// itself is always a superadmin key.
+var adminKeys = map[string]adminKey{}
+
+// adminTokenAllowed are the networks the admin token may be used from
+var adminTokenAllowed []netip.Prefix
+
+// initAdminKeys reads the role-bound admin keys from MAXAPI_ADMIN_KEYS, a
+// comma-separated list of key:role pairs, each optionally followed by
+// @ and a ;-separated list of allowed networks, and the allowed networks of
+// the admin token from MAXAPI_ADMIN_ALLOWED_IPS
+func initAdminKeys() error {
+	allowed, err := parseAllowlist(splitList(os.Getenv("MAXAPI_ADMIN_ALLOWED_IPS"), ","))
+	if err != nil {
+		return fmt.Errorf("MAXAPI_ADMIN_ALLOWED_IPS: %w", err)
+	}
+	adminTokenAllowed = allowed
+
+	for _, entry := range splitList(os.Getenv("MAXAPI_ADMIN_KEYS"), ",") {
+		key, rest, ok := strings.Cut(entry, ":")
+		if !ok || key == "" {
+			return fmt.Errorf("MAXAPI_ADMIN_KEYS entries must be key:role")
+		}
+		name, networks, _ := strings.Cut(rest, "@")
+		role := adminRole(0)
+		for r, n := range adminRoleNames {
+			if n == strings.TrimSpace(name) {
+				role = r
+			}
+		}
+		if role == 0 {
+			return fmt.Errorf("unknown admin role %q, must be auditor, operator or superadmin", name)
+		}
+		if key == *adminToken {
+			return fmt.Errorf("MAXAPI_ADMIN_KEYS must not contain the admin token")
+		}
+		allowed, err := parseAllowlist(splitList(networks, ";"))
+		if err != nil {
+			return fmt.Errorf("MAXAPI_ADMIN_KEYS: %w", err)
+		}
+		adminKeys[key] = adminKey{role: role, allowed: allowed}
+	}
+
+	if len(adminKeys) > 0 {
+		log.Info().Int("keys", len(adminKeys)).Msg("Role-based admin keys enabled")
+	}
+	return nil
+}
+
+// adminKeyOf returns the admin key with the given value, a zero role when the
+// key is unknown. Keys are compared in constant time, and configured keys may
+// be given as their hash.
+func adminKeyOf(key string) adminKey {
+	if key == "" {
+		return adminKey{}
+	}
+	if matchesConfiguredToken(key, *adminToken) {
+		return adminKey{role: roleSuperadmin, allowed: adminTokenAllowed}
+	}
+	found := adminKey{}
+	for k, v := range adminKeys {
+		if matchesConfiguredToken(key, k) {
+			found = v
+		}
+	}
+	return found
+}
+
+// withAdminRole stores the role of the authenticated admin key in the request
+func withAdminRole(r *http.Request, role adminRole) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), "adminRole", role))
+}
+
+// requestAdminRole returns the role of the admin key that made the request
+func requestAdminRole(r *http.Request) adminRole {
+	role, _ := r.Context().Value("adminRole").(adminRole)
+	return role
+}
+
+// requireRole lets a request through only when its admin key has at least the given role
+func (s *server) requireRole(role adminRole, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if have := requestAdminRole(r); have < role {
+			log.Warn().Str("adminRole", have.String()).Str("required", role.String()).Str("method", r.Method).Str("path", r.URL.Path).Msg("Admin request denied")
+			s.Respond(w, r, http.StatusForbidden, fmt.Errorf("forbidden: requires the %s role", role))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"maxapi/handlers/admin"
+)
+
+// withAdminKeys replaces the admin keys for one test
+func withAdminKeys(t *testing.T, keys map[string]adminKey) {
+	t.Helper()
+	was := adminKeys
+	adminKeys = keys
+	t.Cleanup(func() { adminKeys = was })
+}
+
+func TestAdminRoles(t *testing.T) {
+	s := newTestServer(t)
+	userID, _ := newTestUser(t, s, "managed")
+	withAdminKeys(t, map[string]adminKey{
+		"auditor-key":    {role: roleAuditor},
+		"operator-key":   {role: roleOperator},
+		"superadmin-key": {role: roleSuperadmin},
+		"office-key":     {role: roleSuperadmin, allowed: []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8")}},
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		remote string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"no key", "", "198.51.100.1:4321", "GET", "/admin/users", "", http.StatusUnauthorized},
+		{"unknown key", "nope", "198.51.100.2:4321", "GET", "/admin/users", "", http.StatusUnauthorized},
+		{"auditor reads", "auditor-key", "192.0.2.1:4321", "GET", "/admin/users/" + userID, "", http.StatusOK},
+		{"auditor cannot operate", "auditor-key", "192.0.2.1:4321", "POST", "/admin/users/" + userID + "/features", `{"features": {}}`, http.StatusForbidden},
+		{"operator operates", "operator-key", "192.0.2.1:4321", "POST", "/admin/users/" + userID + "/features", `{"features": {}}`, http.StatusOK},
+		{"operator cannot edit users", "operator-key", "192.0.2.1:4321", "PUT", "/admin/users/" + userID, `{"name": "renamed"}`, http.StatusForbidden},
+		{"superadmin edits users", "superadmin-key", "192.0.2.1:4321", "PUT", "/admin/users/" + userID, `{"name": "renamed"}`, http.StatusOK},
+		{"key inside its networks", "office-key", "10.0.0.1:4321", "GET", "/admin/users", "", http.StatusOK},
+		{"key outside its networks", "office-key", "192.0.2.1:4321", "GET", "/admin/users", "", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := map[string]string{}
+			if tt.key != "" {
+				header["Authorization"] = tt.key
+			}
+			if rec := serve(s, tt.method, tt.path, tt.remote, header, tt.body); rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+}
+
+// TestAdminUserTokens checks that user tokens are only shown to superadmin keys
+// and never when they are stored hashed
+func TestAdminUserTokens(t *testing.T) {
+	s := newTestServer(t)
+	plainID, plainToken := newTestUser(t, s, "plain")
+	hashedID, _ := newTestUser(t, s, "hashed")
+	if _, err := s.db.Exec("UPDATE users SET token = $1 WHERE id = $2", tokenHashPrefix+"0000", hashedID); err != nil {
+		t.Fatal(err)
+	}
+	withAdminKeys(t, map[string]adminKey{
+		"auditor-key":    {role: roleAuditor},
+		"superadmin-key": {role: roleSuperadmin},
+	})
+
+	tests := []struct {
+		name   string
+		key    string
+		userID string
+		want   string
+	}{
+		{"superadmin sees the token", "superadmin-key", plainID, plainToken},
+		{"auditor does not", "auditor-key", plainID, ""},
+		{"hashed token is hidden", "superadmin-key", hashedID, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(s, "GET", "/admin/users/"+tt.userID, "192.0.2.1:4321", map[string]string{"Authorization": tt.key}, "")
+			if rec.Code != http.StatusOK {
+				t.Fatalf("status %d: %s", rec.Code, rec.Body)
+			}
+			var resp struct {
+				Data admin.UserResponse `json:"data"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if resp.Data.Token != tt.want {
+				t.Errorf("token %q, want %q", resp.Data.Token, tt.want)
+			}
+		})
+	}
+}
+
+// TestAdminRoutesRequireRole checks that no admin route is registered as a user route
+func TestAdminRoutesRequireRole(t *testing.T) {
+	for _, rt := range apiRoutes {
+		if strings.HasPrefix(rt.Path, "/admin/") && rt.Role == 0 {
+			t.Errorf("%s %s has no admin role", rt.Method, rt.Path)
+		}
+		if !strings.HasPrefix(rt.Path, "/admin/") && rt.Role != 0 {
+			t.Errorf("%s %s has an admin role outside /admin", rt.Method, rt.Path)
+		}
+	}
+}
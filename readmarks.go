@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// maxReadMarksPage caps the members returned in one page of read marks
+const maxReadMarksPage = 100
+
+// MemberReadMark is the last-read position of a chat member. ReadMark is the
+// time in milliseconds of the last message the member read, 0 when unknown.
+type MemberReadMark struct {
+	UserID   int64  `json:"userId" example:"987654321"`
+	Name     string `json:"name" example:"Ivan Petrov"`
+	ReadMark int64  `json:"readMark" example:"1700000000000"`
+}
+
+// GetGroupReadMarks returns the read marks of the members of a chat
+// @Summary Member read marks
+// @Description Returns the last-read position of each member of a group or channel, to see who has read a message: a member read every message sent at or before their readMark (milliseconds). count (1-100, default 50) sets the page size; pass the returned marker to get the next page, it is 0 after the last.
+// @Tags Group
+// @Produce json
+// @Param chatId query int true "Chat ID"
+// @Param count query int false "Members per page (default 50, max 100)"
+// @Param marker query int false "Marker returned by the previous page"
+// @Success 200 {object} ReadMarksResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Failure 503 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /group/readmarks [get]
+func (s *server) GetGroupReadMarks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		client := clientManager.GetMaxClient(txtid)
+		if client == nil || !client.IsConnected() {
+			s.Respond(w, r, http.StatusServiceUnavailable, errors.New("not connected"))
+			return
+		}
+
+		chatID, err := strconv.ParseInt(r.URL.Query().Get("chatId"), 10, 64)
+		if err != nil || chatID == 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("missing or invalid chatId"))
+			return
+		}
+
+		count := 50
+		if v := r.URL.Query().Get("count"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxReadMarksPage {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("count must be between 1 and %d", maxReadMarksPage))
+				return
+			}
+			count = n
+		}
+
+		var marker int64
+		if v := r.URL.Query().Get("marker"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil || n < 0 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("invalid marker"))
+				return
+			}
+			marker = n
+		}
+
+		members, next, err := client.GetChatMembers(chatID, marker, count)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("get members failed: %v", err))
+			return
+		}
+
+		readMarks := make([]MemberReadMark, 0, len(members))
+		for _, member := range members {
+			readMark := MemberReadMark{
+				UserID:   member.Contact.ID,
+				ReadMark: member.ReadMark,
+			}
+			if len(member.Contact.Names) > 0 {
+				readMark.Name = member.Contact.Names[0].Name
+			}
+			readMarks = append(readMarks, readMark)
+		}
+
+		var nextMarker int64
+		if next != nil {
+			nextMarker = *next
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"chatId":  chatID,
+			"members": readMarks,
+			"count":   len(readMarks),
+			"marker":  nextMarker,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	reconcileReconnected = "reconnected"
+	reconcileNeedsReauth = "needs_reauth"
+	reconcileFailed      = "failed"
+
+	// reconcileTimeout bounds how long the summary waits for slow logins
+	reconcileTimeout = 2 * time.Minute
+)
+
+// ReconcileResult is the outcome of verifying one account
+type ReconcileResult struct {
+	UserID string `json:"userId" example:"a1b2c3"`
+	Name   string `json:"name" example:"Support"`
+	Status string `json:"status" example:"reconnected"`
+	Error  string `json:"error,omitempty" example:"login.token.invalid"`
+}
+
+// reconciliation tracks a pass that checks the stored sessions against MAX: it
+// clears connected flags of accounts without an auth token, logs in every account
+// that has one and records whether each login succeeded.
+type reconciliation struct {
+	sync.Mutex
+	startedAt  int64
+	finishedAt int64
+	stale      int64
+	names      map[string]string
+	pending    map[string]bool
+	results    []ReconcileResult
+}
+
+var reconciler = &reconciliation{}
+
+// begin starts tracking a pass over the given accounts (userID -> name)
+func (rc *reconciliation) begin(accounts map[string]string, stale int64) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	rc.startedAt = time.Now().Unix()
+	rc.finishedAt = 0
+	rc.stale = stale
+	rc.names = accounts
+	rc.pending = make(map[string]bool, len(accounts))
+	rc.results = []ReconcileResult{}
+	for userID := range accounts {
+		rc.pending[userID] = true
+	}
+
+	if len(rc.pending) == 0 {
+		rc.finishLocked(false)
+		return
+	}
+
+	startedAt := rc.startedAt
+	time.AfterFunc(reconcileTimeout, func() {
+		rc.Lock()
+		defer rc.Unlock()
+		if rc.startedAt == startedAt && rc.finishedAt == 0 {
+			rc.finishLocked(true)
+		}
+	})
+}
+
+// report records the login outcome of an account. Logins of accounts outside
+// the current pass (e.g. /session/connect) are ignored.
+func (rc *reconciliation) report(userID, status string, err error) {
+	rc.Lock()
+	defer rc.Unlock()
+
+	if !rc.pending[userID] {
+		return
+	}
+	delete(rc.pending, userID)
+
+	result := ReconcileResult{UserID: userID, Name: rc.names[userID], Status: status}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	rc.results = append(rc.results, result)
+
+	if len(rc.pending) == 0 {
+		rc.finishLocked(false)
+	}
+}
+
+func (rc *reconciliation) finishLocked(timedOut bool) {
+	rc.finishedAt = time.Now().Unix()
+	counts := rc.countsLocked()
+
+	event := log.Info()
+	if counts[reconcileNeedsReauth] > 0 || counts[reconcileFailed] > 0 || timedOut {
+		event = log.Warn()
+	}
+	event.Int("reconnected", counts[reconcileReconnected]).
+		Int("needsReauth", counts[reconcileNeedsReauth]).
+		Int("failed", counts[reconcileFailed]).
+		Int("pending", len(rc.pending)).
+		Int64("staleCleared", rc.stale).
+		Msg("Session reconciliation finished")
+
+	for _, result := range rc.results {
+		if result.Status != reconcileReconnected {
+			log.Warn().Str("userID", result.UserID).Str("name", result.Name).Str("status", result.Status).Str("error", result.Error).Msg("Session not restored")
+		}
+	}
+}
+
+func (rc *reconciliation) countsLocked() map[string]int {
+	counts := map[string]int{reconcileReconnected: 0, reconcileNeedsReauth: 0, reconcileFailed: 0}
+	for _, result := range rc.results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// summary renders the state of the last pass
+func (rc *reconciliation) summary() map[string]interface{} {
+	rc.Lock()
+	defer rc.Unlock()
+
+	counts := rc.countsLocked()
+	pending := make([]string, 0, len(rc.pending))
+	for userID := range rc.pending {
+		pending = append(pending, userID)
+	}
+
+	return map[string]interface{}{
+		"success":      true,
+		"startedAt":    rc.startedAt,
+		"finishedAt":   rc.finishedAt,
+		"running":      rc.startedAt > 0 && rc.finishedAt == 0,
+		"reconnected":  counts[reconcileReconnected],
+		"needsReauth":  counts[reconcileNeedsReauth],
+		"failed":       counts[reconcileFailed],
+		"staleCleared": rc.stale,
+		"pending":      pending,
+		"results":      rc.results,
+	}
+}
+
+// clearStaleConnections resets the connected flag of accounts that cannot be connected
+func (s *server) clearStaleConnections() int64 {
+	res, err := s.db.Exec("UPDATE users SET connected=0 WHERE connected=1 AND (auth_token IS NULL OR auth_token = '')")
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to clear stale connection flags")
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return n
+}
+
+// ========== RECONCILIATION ENDPOINTS ==========
+
+// GetReconciliation returns the result of the last session reconciliation
+// @Summary Session reconciliation status
+// @Description Returns how many stored sessions were restored at the last reconciliation, which need a new SMS login and which failed
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} ReconciliationResponse
+// @Security AdminAuth
+// @Router /admin/reconciliation [get]
+func (s *server) GetReconciliation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.Respond(w, r, http.StatusOK, reconciler.summary())
+	}
+}
+
+// RunReconciliation starts a new session reconciliation
+// @Summary Run session reconciliation
+// @Description Clears stale connected flags and logs in every account that has an auth token but no running client. Poll GET /admin/reconciliation for the result.
+// @Tags Admin
+// @Produce json
+// @Success 202 {object} ReconciliationResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/reconciliation [post]
+func (s *server) RunReconciliation() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if running, _ := reconciler.summary()["running"].(bool); running {
+			s.Respond(w, r, http.StatusConflict, errors.New("reconciliation already running"))
+			return
+		}
+
+		s.connectOnStartup()
+
+		s.Respond(w, r, http.StatusAccepted, reconciler.summary())
+	}
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Built-in redaction rules, applied in this order after custom rules
+var builtinRedactionRules = []struct {
+	name        string
+	pattern     *regexp.Regexp
+	replacement string
+	valid       func(string) bool
+}{
+	{"email", regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`), "[EMAIL]", nil},
+	{"card", regexp.MustCompile(`\b(?:\d[ \-]?){12,18}\d\b`), "[CARD]", luhnValid},
+	{"phone", regexp.MustCompile(`\+?\d[\d \-()]{8,}\d`), "[PHONE]", nil},
+}
+
+// RedactionRule is a user-defined redaction pattern
+type RedactionRule struct {
+	Name        string `json:"name"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+// redactionConfig holds the per-user redaction settings
+type redactionConfig struct {
+	History  bool            `json:"history"`
+	Webhooks bool            `json:"webhooks"`
+	Rules    []string        `json:"rules"`
+	Custom   []RedactionRule `json:"custom"`
+}
+
+// redactor applies a compiled redaction configuration
+type redactor struct {
+	config  redactionConfig
+	builtin map[string]bool
+	custom  []*regexp.Regexp
+}
+
+// redactors caches the compiled configuration per user
+var redactors sync.Map
+
+// luhnValid reports whether the digits in s pass the Luhn checksum
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// compileRedaction validates a configuration and compiles its custom patterns
+func compileRedaction(config redactionConfig) (*redactor, error) {
+	r := &redactor{config: config, builtin: map[string]bool{}}
+
+	for _, name := range config.Rules {
+		found := false
+		for _, rule := range builtinRedactionRules {
+			if rule.name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown redaction rule: %s", name)
+		}
+		r.builtin[name] = true
+	}
+
+	for i, rule := range config.Custom {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("custom rule %d: %w", i, err)
+		}
+		r.custom = append(r.custom, re)
+	}
+
+	return r, nil
+}
+
+// Redact replaces the configured patterns in text. Custom rules run first so
+// they can match more specific formats than the built-in ones.
+func (r *redactor) Redact(text string) string {
+	if text == "" {
+		return text
+	}
+
+	for i, re := range r.custom {
+		replacement := r.config.Custom[i].Replacement
+		if replacement == "" {
+			replacement = "[REDACTED]"
+		}
+		text = re.ReplaceAllString(text, replacement)
+	}
+
+	for _, rule := range builtinRedactionRules {
+		if !r.builtin[rule.name] {
+			continue
+		}
+		if rule.valid == nil {
+			text = rule.pattern.ReplaceAllString(text, rule.replacement)
+			continue
+		}
+		text = rule.pattern.ReplaceAllStringFunc(text, func(m string) string {
+			if rule.valid(m) {
+				return rule.replacement
+			}
+			return m
+		})
+	}
+
+	return text
+}
+
+// redactValue returns a copy of v with the message text fields redacted
+func (r *redactor) redactValue(key string, v interface{}) interface{} {
+	switch val := v.(type) {
+	case string:
+		if key == "text" {
+			return r.Redact(val)
+		}
+		return val
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			out[k] = r.redactValue(k, item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(val))
+		for i, item := range val {
+			out[i] = r.redactValue(key, item)
+		}
+		return out
+	case json.RawMessage:
+		// Event payloads are carried undecoded and only parsed when rules apply.
+		// Numbers are kept as written so large IDs survive the round trip.
+		var decoded interface{}
+		dec := json.NewDecoder(bytes.NewReader(val))
+		dec.UseNumber()
+		if err := dec.Decode(&decoded); err != nil {
+			return val
+		}
+		return r.redactValue(key, decoded)
+	}
+	return v
+}
+
+// getRedactor returns the compiled redaction settings of a user
+func (s *server) getRedactor(userID string) *redactor {
+	if cached, ok := redactors.Load(userID); ok {
+		return cached.(*redactor)
+	}
+
+	config, err := s.getRedactionConfig(userID)
+	if err != nil {
+		return &redactor{}
+	}
+	r, err := compileRedaction(config)
+	if err != nil {
+		r = &redactor{}
+	}
+	redactors.Store(userID, r)
+	return r
+}
+
+// getRedactionConfig reads the redaction settings of a user
+func (s *server) getRedactionConfig(userID string) (redactionConfig, error) {
+	config := redactionConfig{Rules: []string{}, Custom: []RedactionRule{}}
+
+	var raw string
+	err := s.db.Get(&raw, "SELECT COALESCE(redaction, '') FROM users WHERE id = $1", userID)
+	if err != nil {
+		return config, err
+	}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &config); err != nil {
+			return config, err
+		}
+	}
+	return config, nil
+}
+
+// redactHistoryText applies the user's rules to text stored in message_history
+func (s *server) redactHistoryText(userID, text string) string {
+	r := s.getRedactor(userID)
+	if !r.config.History {
+		return text
+	}
+	return r.Redact(text)
+}
+
+// redactWebhookPayload applies the user's rules to the text fields of an event
+func (s *server) redactWebhookPayload(userID string, postmap map[string]interface{}) map[string]interface{} {
+	r := s.getRedactor(userID)
+	if !r.config.Webhooks {
+		return postmap
+	}
+	return r.redactValue("", postmap).(map[string]interface{})
+}
+
+// GetRedaction returns the PII redaction settings
+// @Summary Get PII redaction
+// @Description Returns the redaction rules applied to stored history and webhook payloads
+// @Tags Redaction
+// @Produce json
+// @Success 200 {object} RedactionResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/redaction [get]
+func (s *server) GetRedaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		config, err := s.getRedactionConfig(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"history":  config.History,
+			"webhooks": config.Webhooks,
+			"rules":    config.Rules,
+			"custom":   config.Custom,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetRedaction updates the PII redaction settings
+// @Summary Set PII redaction
+// @Description Configures regex-based redaction of message text before it is written to history and/or sent to webhooks. Built-in rules: phone, card (Luhn-checked), email.
+// @Tags Redaction
+// @Accept json
+// @Produce json
+// @Param request body RedactionBody true "Redaction settings"
+// @Success 200 {object} RedactionResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/redaction [post]
+func (s *server) SetRedaction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg RedactionBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		config := redactionConfig{
+			History:  msg.History,
+			Webhooks: msg.Webhooks,
+			Rules:    []string{},
+			Custom:   []RedactionRule{},
+		}
+		for _, name := range msg.Rules {
+			if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+				config.Rules = append(config.Rules, name)
+			}
+		}
+		for _, rule := range msg.Custom {
+			if rule.Pattern == "" {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("custom rules need a pattern"))
+				return
+			}
+			config.Custom = append(config.Custom, rule)
+		}
+
+		compiled, err := compileRedaction(config)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		raw, _ := json.Marshal(config)
+		if _, err := s.db.Exec("UPDATE users SET redaction = $1 WHERE id = $2", string(raw), txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		redactors.Store(txtid, compiled)
+
+		response := map[string]interface{}{
+			"success":  true,
+			"history":  config.History,
+			"webhooks": config.Webhooks,
+			"rules":    config.Rules,
+			"custom":   config.Custom,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
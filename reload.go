@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultReconnectAttempts = 120
+	defaultReconnectDelay    = 5 * time.Second
+)
+
+// reconnectPolicy controls how a lost MAX connection is retried
+type reconnectPolicy struct {
+	maxAttempts int
+	delay       time.Duration
+}
+
+var (
+	// startupSettings are the values from the command line and the environment,
+	// restored when the configuration file no longer overrides them
+	startupSettings struct {
+		logLevel      zerolog.Level
+		globalWebhook string
+	}
+
+	globalWebhookValue atomic.Value // string
+	reconnectSettings  atomic.Pointer[reconnectPolicy]
+
+	reloadMu sync.Mutex
+)
+
+// initReloadableSettings records the startup values of the settings the configuration file can override
+func initReloadableSettings() {
+	startupSettings.logLevel = zerolog.GlobalLevel()
+	startupSettings.globalWebhook = *globalWebhook
+	globalWebhookValue.Store(*globalWebhook)
+	reconnectSettings.Store(&reconnectPolicy{maxAttempts: defaultReconnectAttempts, delay: defaultReconnectDelay})
+}
+
+// globalWebhookURL returns the global webhook in effect ("" when disabled)
+func globalWebhookURL() string {
+	url, _ := globalWebhookValue.Load().(string)
+	return url
+}
+
+// currentReconnectPolicy returns the reconnect policy in effect
+func currentReconnectPolicy() reconnectPolicy {
+	return *reconnectSettings.Load()
+}
+
+// applyConfig makes the settings of a configuration in effect. Settings it
+// leaves out fall back to their startup values.
+func applyConfig(cfg *Config) {
+	appConfig.Store(cfg)
+
+	level := startupSettings.logLevel
+	if cfg.LogLevel != "" {
+		level, _ = zerolog.ParseLevel(cfg.LogLevel)
+	}
+	zerolog.SetGlobalLevel(level)
+
+	webhook := startupSettings.globalWebhook
+	if cfg.GlobalWebhook != nil {
+		webhook = *cfg.GlobalWebhook
+	}
+	globalWebhookValue.Store(webhook)
+
+	limits := envResourceLimits
+	if l := cfg.ResourceLimits; l != nil {
+		if l.Goroutines != nil {
+			limits.goroutines = *l.Goroutines
+		}
+		if l.PendingEvents != nil {
+			limits.pendingEvents = *l.PendingEvents
+		}
+		if l.PendingMediaMB != nil {
+			limits.pendingMedia = int64(*l.PendingMediaMB) << 20
+		}
+	}
+	setResourceLimits(limits)
+
+	policy := reconnectPolicy{maxAttempts: defaultReconnectAttempts, delay: defaultReconnectDelay}
+	if rc := cfg.Reconnect; rc != nil {
+		if rc.MaxAttempts != nil {
+			policy.maxAttempts = *rc.MaxAttempts
+		}
+		if rc.DelaySeconds != nil {
+			policy.delay = time.Duration(*rc.DelaySeconds) * time.Second
+		}
+	}
+	reconnectSettings.Store(&policy)
+}
+
+// reloadConfig reads the configuration file again and applies it. Active MAX
+// connections are kept; an invalid file leaves the current settings in place.
+func reloadConfig() error {
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	if *configFile == "" {
+		return errors.New("no configuration file configured")
+	}
+
+	cfg, err := readConfig(*configFile)
+	if err != nil {
+		return err
+	}
+	applyConfig(cfg)
+
+	if err := setupLiveRabbitSinks(); err != nil {
+		log.Error().Err(err).Msg("Failed to declare reloaded RabbitMQ sinks")
+	}
+
+	log.Info().Str("path", *configFile).Msg("Configuration file reloaded")
+	return nil
+}
+
+// watchConfigReload reloads the configuration file on SIGHUP
+func watchConfigReload() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := reloadConfig(); err != nil {
+				log.Error().Err(err).Msg("Configuration reload failed, keeping current settings")
+			}
+		}
+	}()
+}
+
+// effectiveSettings returns the reloadable settings in effect
+func effectiveSettings() map[string]interface{} {
+	policy := currentReconnectPolicy()
+	return map[string]interface{}{
+		"logLevel":       zerolog.GlobalLevel().String(),
+		"globalWebhook":  globalWebhookURL(),
+		"resourceLimits": resourceLimitsMap(),
+		"reconnect": map[string]interface{}{
+			"maxAttempts":  policy.maxAttempts,
+			"delaySeconds": int(policy.delay / time.Second),
+		},
+		"rabbitSinks": len(currentConfig().RabbitMQ.Sinks),
+		"features":    featureSettings(),
+	}
+}
+
+// GetConfig returns the reloadable settings in effect
+// @Summary Get effective configuration
+// @Description Returns the settings that can be changed by reloading the configuration file: log level, global webhook, per-instance resource limits, reconnect policy, the number of RabbitMQ sinks and the feature flags
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} ConfigResponse
+// @Security AdminAuth
+// @Router /admin/config [get]
+func (s *server) GetConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{
+			"success": true,
+			"path":    *configFile,
+		}
+		for key, value := range effectiveSettings() {
+			response[key] = value
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ReloadConfig reloads the configuration file
+// @Summary Reload configuration
+// @Description Reads the configuration file again and applies the log level, global webhook, resource limits, reconnect policy, RabbitMQ sinks and feature flags without dropping MAX connections. Sending SIGHUP to the process does the same. An invalid file is rejected and the current settings stay in effect.
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} ConfigResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/config/reload [post]
+func (s *server) ReloadConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := reloadConfig(); err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"path":    *configFile,
+		}
+		for key, value := range effectiveSettings() {
+			response[key] = value
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
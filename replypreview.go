@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const defaultReplyPreviewLength = 200
+
+// ReplyPreviewConfig adds the quoted message to Message events that reply to
+// another message. Length is the snippet length in characters (0 = 200).
+// @Description Adds the quoted message's sender and a text snippet of length characters (200 by default) to Message events that reply to another message
+type ReplyPreviewConfig struct {
+	Enabled bool `json:"enabled" example:"true"`
+	Length  int  `json:"length" example:"200"`
+}
+
+// withReplyPreview adds a replyPreview to a Message event that replies to
+// another message and sends the event. It returns false when the event needs
+// no preview. When the quoted message or its sender has to be fetched from MAX
+// this happens in the background, as the receive loop must not wait on it. With
+// ordered webhooks the event's slot in its chat is taken right away and the
+// fetch runs in that slot, so the chat's later events are not delivered first.
+func (mycli *MyClient) withReplyPreview(msg *maxclient.Message, postmap map[string]interface{}, path string) bool {
+	if msg == nil || msg.Link == nil || msg.Link.Type != "REPLY" || msg.Link.MessageID == "" {
+		return false
+	}
+	config, err := mycli.s.getUserConfig(mycli.userID)
+	if err != nil || !config.ReplyPreview.Enabled {
+		return false
+	}
+
+	link := msg.Link
+	chatID := link.ChatID
+	if chatID == 0 {
+		chatID = msg.ChatID
+	}
+	quoted := link.Message
+	if quoted != nil && mycli.MaxClient.GetCachedUser(quoted.Sender) != nil {
+		postmap["replyPreview"] = replyPreview(mycli.MaxClient, chatID, link.MessageID, quoted, config.ReplyPreview.Length)
+		sendEventWithWebHook(mycli, postmap, path)
+		return true
+	}
+
+	fetch := func() {
+		if quoted == nil {
+			messageID, err := strconv.ParseInt(link.MessageID, 10, 64)
+			if err == nil {
+				quoted, err = mycli.MaxClient.GetMessage(chatID, messageID)
+			}
+			if err != nil {
+				log.Warn().Err(err).Str("userID", mycli.userID).Str("messageId", link.MessageID).Msg("Failed to fetch quoted message")
+			}
+		}
+		if quoted != nil {
+			if _, err := mycli.MaxClient.GetUser(quoted.Sender); err != nil {
+				log.Debug().Err(err).Int64("sender", quoted.Sender).Msg("Failed to fetch sender of quoted message")
+			}
+			postmap["replyPreview"] = replyPreview(mycli.MaxClient, chatID, link.MessageID, quoted, config.ReplyPreview.Length)
+		}
+	}
+
+	if webhookOrdered && path == "" {
+		dispatcherFor(mycli.userID).dispatch(mycli.userID, eventChatID(postmap), func() {
+			fetch()
+			sendEventInLane(mycli, postmap, path)
+		})
+		return true
+	}
+
+	goTracked(mycli.userID, func() {
+		fetch()
+		sendEventWithWebHook(mycli, postmap, path)
+	})
+	return true
+}
+
+// replyPreview describes the quoted message with a snippet of its text
+func replyPreview(client *maxclient.Client, chatID int64, messageID string, quoted *maxclient.Message, length int) map[string]interface{} {
+	if length <= 0 {
+		length = defaultReplyPreviewLength
+	}
+
+	senderName := ""
+	if user := client.GetCachedUser(quoted.Sender); user != nil {
+		senderName = userDisplayName(user)
+	}
+
+	text := []rune(quoted.Text)
+	truncated := len(text) > length
+	if truncated {
+		text = append([]rune(strings.TrimSpace(string(text[:length]))), '…')
+	}
+
+	attachments := []string{}
+	for _, attach := range quoted.Attaches {
+		attachments = append(attachments, string(attach.Type))
+	}
+
+	return map[string]interface{}{
+		"messageId":   messageID,
+		"chatId":      chatID,
+		"senderId":    quoted.Sender,
+		"senderName":  senderName,
+		"text":        string(text),
+		"truncated":   truncated,
+		"attachments": attachments,
+		"time":        quoted.Time,
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// resetStopTimeout bounds the wait for the connection goroutine to take the
+// kill signal; it checks for the signal about once a second
+const resetStopTimeout = 3 * time.Second
+
+// resettingInstances holds instances whose MAX session is ended by a reset,
+// so the LoggedOut event that MAX sends back does not delete the instance
+var resettingInstances sync.Map
+
+// stopInstance stops the connection of an instance and waits briefly for its
+// goroutine to exit, so it cannot reconnect with the old credentials
+func stopInstance(userID string) {
+	if ch := killchannel[userID]; ch != nil {
+		select {
+		case ch <- true:
+		case <-time.After(resetStopTimeout):
+			log.Warn().Str("userID", userID).Msg("Connection did not take the kill signal, closing it")
+		}
+	}
+	if client := clientManager.GetMaxClient(userID); client != nil {
+		client.Disconnect()
+	}
+	cleanupClient(userID)
+}
+
+// ResetSession returns the instance to the state of a new one
+// @Summary Reset instance
+// @Description Disconnects, clears the MAX credentials and device ID, and by default erases message history, the media index, stored media, queued and scheduled messages and campaigns, so another phone number can be signed in. The instance token, webhook and settings are kept. With logout=true the MAX session is also ended on the MAX server. Requires confirm=true.
+// @Tags Session
+// @Accept json
+// @Produce json
+// @Param request body ResetSessionBody true "Reset options"
+// @Success 200 {object} ResetSessionResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/reset [post]
+func (s *server) ResetSession() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg ResetSessionBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+		if !msg.Confirm {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("confirm must be true"))
+			return
+		}
+
+		loggedOut := false
+		if client := clientManager.GetMaxClient(txtid); msg.Logout && client != nil && client.IsConnected() {
+			resettingInstances.Store(txtid, true)
+			defer resettingInstances.Delete(txtid)
+			if err := client.Logout(); err != nil {
+				log.Warn().Err(err).Str("userID", txtid).Msg("Failed to end MAX session during reset")
+			} else {
+				loggedOut = true
+			}
+		}
+		stopInstance(txtid)
+
+		_, err := s.db.Exec("UPDATE users SET auth_token='', device_id='', temp_token='', connected=0, max_user_id=NULL WHERE id=$1", txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		invalidateUserID(txtid)
+		// Uploads and buffered events belong to the previous MAX account
+		forgetUserUploads(txtid)
+		eventStreams.closeUser(txtid)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"message":   "Instance reset",
+			"loggedOut": loggedOut,
+		}
+
+		if !msg.KeepData {
+			removed, err := s.eraseUserContent(r.Context(), txtid, msg.Blocklist)
+			if err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			s.recordGDPRAudit(txtid, gdprActionErase, r.RemoteAddr, removed)
+			response["removed"] = removed
+		}
+
+		log.Info().Str("userID", txtid).Bool("keepData", msg.KeepData).Bool("loggedOut", loggedOut).Msg("Instance reset")
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
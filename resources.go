@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// errCodeInstanceThrottled is returned when an instance exceeds its resource caps
+	errCodeInstanceThrottled = "INSTANCE_THROTTLED"
+
+	defaultInstanceGoroutines     = 32
+	defaultInstancePendingEvents  = 1000
+	defaultInstancePendingMediaMB = 256
+)
+
+// instanceLimits are the per-instance caps. A zero value disables the cap.
+type instanceLimits struct {
+	goroutines    int
+	pendingEvents int
+	pendingMedia  int64
+}
+
+var (
+	// envResourceLimits are the caps from the environment, used where the configuration file sets none
+	envResourceLimits instanceLimits
+	resourceLimits    atomic.Pointer[instanceLimits]
+)
+
+// resourceSemaphores bound the background work of an instance: queue bounds the
+// jobs accepted (running or waiting) and running bounds the goroutines executing them
+type resourceSemaphores struct {
+	queue   chan struct{}
+	running chan struct{}
+}
+
+// instanceResources tracks the background work and buffered media of one instance.
+// The semaphores are replaced when the caps are reloaded; jobs release the ones they acquired.
+type instanceResources struct {
+	sem atomic.Pointer[resourceSemaphores]
+
+	goroutines atomic.Int64
+	pending    atomic.Int64
+	media      atomic.Int64
+	throttled  atomic.Int64
+}
+
+// InstanceResourceStats is a snapshot of the resources held by an instance
+type InstanceResourceStats struct {
+	UserID          string `json:"userId"`
+	Goroutines      int64  `json:"goroutines"`
+	QueuedEvents    int64  `json:"queuedEvents"`
+	PendingMedia    int64  `json:"pendingMediaBytes"`
+	Throttled       int64  `json:"throttled"`
+	OrderedWebhooks int64  `json:"orderedWebhooks"`
+}
+
+var instanceResourceMap sync.Map
+
+// initResourceLimits reads the per-instance caps from the environment
+func initResourceLimits() {
+	envResourceLimits = instanceLimits{
+		goroutines:    envInt("MAXAPI_INSTANCE_MAX_GOROUTINES", defaultInstanceGoroutines),
+		pendingEvents: envInt("MAXAPI_INSTANCE_MAX_PENDING_EVENTS", defaultInstancePendingEvents),
+		pendingMedia:  int64(envInt("MAXAPI_INSTANCE_MAX_PENDING_MEDIA_MB", defaultInstancePendingMediaMB)) << 20,
+	}
+	setResourceLimits(envResourceLimits)
+}
+
+// currentResourceLimits returns the caps in effect
+func currentResourceLimits() instanceLimits {
+	return *resourceLimits.Load()
+}
+
+// setResourceLimits changes the caps. Instances get new semaphores when the job
+// caps changed; jobs already accepted finish under the old ones.
+func setResourceLimits(limits instanceLimits) {
+	old := resourceLimits.Swap(&limits)
+	if old != nil && *old == limits {
+		return
+	}
+	if old != nil && (old.goroutines != limits.goroutines || old.pendingEvents != limits.pendingEvents) {
+		instanceResourceMap.Range(func(_, value interface{}) bool {
+			value.(*instanceResources).sem.Store(newResourceSemaphores(limits))
+			return true
+		})
+	}
+
+	log.Info().
+		Int("goroutines", limits.goroutines).
+		Int("pendingEvents", limits.pendingEvents).
+		Int64("pendingMediaBytes", limits.pendingMedia).
+		Msg("Per-instance resource limits")
+}
+
+func newResourceSemaphores(limits instanceLimits) *resourceSemaphores {
+	sem := &resourceSemaphores{}
+	if limits.pendingEvents > 0 {
+		sem.queue = make(chan struct{}, limits.pendingEvents)
+	}
+	if limits.goroutines > 0 {
+		sem.running = make(chan struct{}, limits.goroutines)
+	}
+	return sem
+}
+
+// envInt reads a non-negative integer from the environment
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 0 {
+		return def
+	}
+	return v
+}
+
+// resourcesFor returns the resource tracker of an instance
+func resourcesFor(userID string) *instanceResources {
+	if res, ok := instanceResourceMap.Load(userID); ok {
+		return res.(*instanceResources)
+	}
+
+	res := &instanceResources{}
+	res.sem.Store(newResourceSemaphores(currentResourceLimits()))
+	actual, _ := instanceResourceMap.LoadOrStore(userID, res)
+	return actual.(*instanceResources)
+}
+
+// goTracked runs fn in the background on behalf of an instance. When the instance
+// has too many jobs pending, the caller blocks until one finishes, so a noisy
+// account slows itself down instead of growing the process without bound.
+func goTracked(userID string, fn func()) {
+	res := resourcesFor(userID)
+	sem := res.sem.Load()
+
+	if sem.queue != nil {
+		select {
+		case sem.queue <- struct{}{}:
+		default:
+			res.throttled.Add(1)
+			log.Warn().Str("userID", userID).Int("pendingEvents", cap(sem.queue)).Msg("Instance event queue full, throttling")
+			sem.queue <- struct{}{}
+		}
+	}
+	res.pending.Add(1)
+
+	go func() {
+		defer func() {
+			res.pending.Add(-1)
+			if sem.queue != nil {
+				<-sem.queue
+			}
+		}()
+
+		if sem.running != nil {
+			sem.running <- struct{}{}
+			defer func() { <-sem.running }()
+		}
+		res.goroutines.Add(1)
+		defer res.goroutines.Add(-1)
+
+		fn()
+	}()
+}
+
+// holdMedia accounts size bytes of buffered media to an instance. It returns
+// false when the instance is over its pending media cap.
+func (res *instanceResources) holdMedia(size int64) bool {
+	if limit := currentResourceLimits().pendingMedia; limit > 0 && res.media.Load()+size > limit {
+		res.throttled.Add(1)
+		return false
+	}
+	res.media.Add(size)
+	return true
+}
+
+// releaseMedia returns bytes accounted with holdMedia
+func (res *instanceResources) releaseMedia(size int64) {
+	res.media.Add(-size)
+}
+
+// HoldSendMedia accounts media decoded by a send handler. It responds and returns
+// false when the instance is over its cap; otherwise the caller must call the
+// returned release function once the media is no longer buffered.
+func (s *server) HoldSendMedia(w http.ResponseWriter, r *http.Request, data []byte) (func(), bool) {
+	txtid := r.Context().Value("userinfo").(Values).Get("Id")
+	res := resourcesFor(txtid)
+	size := int64(len(data))
+
+	if !res.holdMedia(size) {
+		log.Warn().Str("userID", txtid).Int64("size", size).Msg("Instance pending media limit reached, throttling")
+		s.Respond(w, r, http.StatusTooManyRequests, map[string]interface{}{
+			"success": false,
+			"error":   "too much media pending for this instance",
+			"code":    errCodeInstanceThrottled,
+		})
+		return nil, false
+	}
+	return func() { res.releaseMedia(size) }, true
+}
+
+// stats returns a snapshot of the tracked resources
+func (res *instanceResources) stats(userID string) InstanceResourceStats {
+	stats := InstanceResourceStats{
+		UserID:       userID,
+		Goroutines:   res.goroutines.Load(),
+		QueuedEvents: max(res.pending.Load()-res.goroutines.Load(), 0),
+		PendingMedia: res.media.Load(),
+		Throttled:    res.throttled.Load(),
+	}
+	if d, ok := webhookDispatchers.Load(userID); ok {
+		stats.OrderedWebhooks = int64(d.(*orderedDispatcher).pending())
+	}
+	return stats
+}
+
+// instanceResourceStats returns the tracked resources of every instance
+func instanceResourceStats() []InstanceResourceStats {
+	stats := []InstanceResourceStats{}
+	instanceResourceMap.Range(func(key, value interface{}) bool {
+		stats = append(stats, value.(*instanceResources).stats(key.(string)))
+		return true
+	})
+	sort.Slice(stats, func(i, j int) bool { return stats[i].UserID < stats[j].UserID })
+	return stats
+}
+
+// resourceLimitsMap returns the configured caps for diagnostics
+func resourceLimitsMap() map[string]interface{} {
+	limits := currentResourceLimits()
+	return map[string]interface{}{
+		"goroutines":        limits.goroutines,
+		"pendingEvents":     limits.pendingEvents,
+		"pendingMediaBytes": limits.pendingMedia,
+	}
+}
+
+// GetResources returns per-instance resource usage
+// @Summary Instance resource usage
+// @Description Returns the background goroutines, queued event deliveries and buffered media held by each instance, the per-instance caps and process totals
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} ResourcesResponse
+// @Security AdminAuth
+// @Router /admin/resources [get]
+func (s *server) GetResources() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var mem runtime.MemStats
+		runtime.ReadMemStats(&mem)
+
+		response := map[string]interface{}{
+			"success":   true,
+			"instances": instanceResourceStats(),
+			"limits":    resourceLimitsMap(),
+			"process": map[string]interface{}{
+				"goroutines": runtime.NumGoroutine(),
+				"heapAlloc":  mem.HeapAlloc,
+				"heapSys":    mem.HeapSys,
+			},
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetInstanceResources returns the resource usage of one instance
+// @Summary Instance resource usage by ID
+// @Description Returns the background goroutines, queued event deliveries and buffered media held by an instance
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 200 {object} InstanceResourcesResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/resources [get]
+func (s *server) GetInstanceResources() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		var exists bool
+		if err := s.db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM users WHERE id = $1)", userID); err != nil || !exists {
+			s.Respond(w, r, http.StatusNotFound, errors.New("user not found"))
+			return
+		}
+
+		var stats InstanceResourceStats
+		if res, ok := instanceResourceMap.Load(userID); ok {
+			stats = res.(*instanceResources).stats(userID)
+		} else {
+			stats = InstanceResourceStats{UserID: userID}
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"resources": stats,
+			"limits":    resourceLimitsMap(),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const (
+	// errCodeAccountRestricted is returned for sends rejected while MAX restricts the account
+	errCodeAccountRestricted = "ACCOUNT_RESTRICTED"
+
+	// restrictionRetryInterval is how long queued sends of a restricted account wait
+	// before they are checked again
+	restrictionRetryInterval = time.Minute
+)
+
+// AccountRestriction is a restriction MAX reported for the account. Sending
+// stays paused from Since until the restriction is cleared through the API.
+type AccountRestriction struct {
+	Code    string `json:"code" example:"account.restricted"`
+	Message string `json:"message" example:"Sending messages is temporarily limited"`
+	Opcode  int    `json:"opcode" example:"64"`
+	Since   int64  `json:"since" example:"1700000000"`
+}
+
+// restrictions caches the restriction of each user; a nil entry means none
+var restrictions sync.Map
+
+// accountRestriction returns the restriction in effect for a user, or nil
+func (s *server) accountRestriction(userID string) *AccountRestriction {
+	if cached, ok := restrictions.Load(userID); ok {
+		return cached.(*AccountRestriction)
+	}
+
+	var restriction *AccountRestriction
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(restriction, '') FROM users WHERE id = $1", userID); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to load account restriction")
+		return nil
+	}
+	if raw != "" {
+		restriction = &AccountRestriction{}
+		if err := json.Unmarshal([]byte(raw), restriction); err != nil {
+			restriction = nil
+		}
+	}
+	restrictions.Store(userID, restriction)
+	return restriction
+}
+
+// setAccountRestriction stores the restriction of a user; nil clears it
+func (s *server) setAccountRestriction(userID string, restriction *AccountRestriction) error {
+	raw := ""
+	if restriction != nil {
+		encoded, _ := json.Marshal(restriction)
+		raw = string(encoded)
+	}
+	if _, err := s.db.Exec("UPDATE users SET restriction = $1 WHERE id = $2", raw, userID); err != nil {
+		return err
+	}
+	restrictions.Store(userID, restriction)
+	return nil
+}
+
+// restrictAccount pauses sending for a restricted account and fills in the
+// AccountRestricted event. It returns false when the account was already
+// restricted, so the event is only sent once per restriction.
+func (mycli *MyClient) restrictAccount(event maxclient.Event, postmap map[string]interface{}) bool {
+	var notice maxclient.AccountRestrictedEvent
+	if err := json.Unmarshal(event.RawPayload(), &notice); err != nil {
+		log.Error().Err(err).Str("userID", mycli.userID).Msg("Failed to parse account restriction")
+		return false
+	}
+
+	if mycli.s.accountRestriction(mycli.userID) != nil {
+		log.Debug().Str("userID", mycli.userID).Str("code", notice.Code).Msg("Account already restricted")
+		return false
+	}
+
+	restriction := &AccountRestriction{
+		Code:    notice.Code,
+		Message: notice.Message,
+		Opcode:  notice.Opcode,
+		Since:   time.Now().Unix(),
+	}
+	if err := mycli.s.setAccountRestriction(mycli.userID, restriction); err != nil {
+		log.Error().Err(err).Str("userID", mycli.userID).Msg("Failed to store account restriction")
+	}
+	log.Warn().Str("userID", mycli.userID).Str("code", notice.Code).Str("message", notice.Message).Msg("Account restricted, sending paused")
+
+	postmap["reason"] = notice.Code
+	return true
+}
+
+// respondRestricted rejects a send of a restricted account with 503
+func (s *server) respondRestricted(w http.ResponseWriter, r *http.Request, restriction *AccountRestriction) {
+	s.Respond(w, r, http.StatusServiceUnavailable, map[string]interface{}{
+		"success":     false,
+		"error":       "sending is paused: the account is restricted by MAX",
+		"code":        errCodeAccountRestricted,
+		"restriction": restriction,
+	})
+}
+
+// GetRestriction returns the account restriction
+// @Summary Get account restriction
+// @Description Reports whether sending is paused because MAX restricted the account. restriction is null when sending is allowed.
+// @Tags Session
+// @Produce json
+// @Success 200 {object} RestrictionResponse
+// @Security ApiKeyAuth
+// @Router /session/restriction [get]
+func (s *server) GetRestriction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		restriction := s.accountRestriction(txtid)
+		response := map[string]interface{}{
+			"success":     true,
+			"restricted":  restriction != nil,
+			"restriction": restriction,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ClearRestriction resumes sending after an account restriction
+// @Summary Resume sending after a restriction
+// @Description Clears the account restriction and resumes sending, including queued, scheduled and campaign messages. Use it once the restriction is lifted on the MAX side; sending again while it is in effect can make it worse.
+// @Tags Session
+// @Produce json
+// @Success 200 {object} RestrictionResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /session/restriction [delete]
+func (s *server) ClearRestriction() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		previous := s.accountRestriction(txtid)
+		if err := s.setAccountRestriction(txtid, nil); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if previous != nil {
+			log.Info().Str("userID", txtid).Str("code", previous.Code).Msg("Account restriction cleared, sending resumed")
+		}
+
+		response := map[string]interface{}{
+			"success":     true,
+			"restricted":  false,
+			"restriction": nil,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
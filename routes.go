@@ -6,13 +6,277 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/gorilla/mux"
 	"github.com/justinas/alice"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
+
+	"maxapi/handlers/admin"
+	"maxapi/handlers/auth"
+	"maxapi/handlers/chat"
+	"maxapi/handlers/group"
+	"maxapi/handlers/session"
+	"maxapi/handlers/user"
+	"maxapi/handlers/webhook"
 )
 
 type Middleware = alice.Constructor
 
+// route is an API endpoint with the policy it is served under. Every API
+// endpoint is registered from apiRoutes, so the policy of a route is read
+// in one place. The core endpoints live in one package per domain under
+// handlers/, which reach the server through the interface of their package
+// (see domains.go); feature endpoints stay methods of *server next to the
+// state they use. The OpenAPI spec is generated from the annotations of both
+// and TestRoutesDocumented keeps it in line with the registry.
+type route struct {
+	Method  string
+	Path    string
+	Handler func(*server) http.HandlerFunc
+	// Role is the admin role an admin route requires, 0 for user routes
+	Role adminRole
+	// Outbound routes send messages and go through the outbound policy guard
+	Outbound bool
+	// Media routes may carry a file and get the media body limit
+	Media bool
+	// Viewer routes may be called with a read-only viewer token
+	Viewer bool
+	// RateLimit caps the requests per minute of each instance to a user
+	// route, 0 for no limit
+	RateLimit int
+}
+
+// apiRoutes lists the API endpoints in registration order
+var apiRoutes = []route{
+	// ========== ADMIN ENDPOINTS ==========
+	{Method: "GET", Path: "/admin/users", Handler: adminRoute((*admin.Handlers).ListUsers), Role: roleAuditor},
+	{Method: "GET", Path: "/admin/users/{userid}", Handler: adminRoute((*admin.Handlers).GetAdminUser), Role: roleAuditor},
+	{Method: "POST", Path: "/admin/users", Handler: adminRoute((*admin.Handlers).AddUser), Role: roleSuperadmin},
+	{Method: "POST", Path: "/admin/users/bulk", Handler: (*server).BulkUsers, Role: roleSuperadmin},
+	{Method: "POST", Path: "/admin/users/disconnect-all", Handler: (*server).DisconnectAll, Role: roleOperator},
+	{Method: "POST", Path: "/admin/users/reconnect-all", Handler: (*server).ReconnectAll, Role: roleOperator},
+	{Method: "PUT", Path: "/admin/users/{userid}", Handler: adminRoute((*admin.Handlers).EditUser), Role: roleSuperadmin},
+	{Method: "DELETE", Path: "/admin/users/{userid}", Handler: adminRoute((*admin.Handlers).DeleteUser), Role: roleSuperadmin},
+	{Method: "POST", Path: "/admin/users/{userid}/connect", Handler: (*server).ConnectInstance, Role: roleOperator},
+	{Method: "POST", Path: "/admin/users/{userid}/clone", Handler: (*server).CloneUser, Role: roleSuperadmin},
+	{Method: "GET", Path: "/admin/users/{userid}/resources", Handler: (*server).GetInstanceResources, Role: roleAuditor},
+	{Method: "GET", Path: "/admin/users/{userid}/features", Handler: (*server).GetUserFeatureFlags, Role: roleAuditor},
+	{Method: "POST", Path: "/admin/users/{userid}/features", Handler: (*server).SetUserFeatureFlags, Role: roleOperator},
+	{Method: "GET", Path: "/admin/users/{userid}/allowed-ips", Handler: (*server).GetUserAllowedIPs, Role: roleAuditor},
+	{Method: "POST", Path: "/admin/users/{userid}/allowed-ips", Handler: (*server).SetUserAllowedIPs, Role: roleSuperadmin},
+	{Method: "GET", Path: "/admin/users/{userid}/policy", Handler: (*server).GetUserContentPolicy, Role: roleAuditor},
+	{Method: "POST", Path: "/admin/users/{userid}/policy", Handler: (*server).SetUserContentPolicy, Role: roleSuperadmin},
+	{Method: "GET", Path: "/admin/features", Handler: (*server).GetFeatureFlags, Role: roleAuditor},
+	{Method: "GET", Path: "/admin/resources", Handler: (*server).GetResources, Role: roleAuditor},
+	{Method: "GET", Path: "/admin/authbans", Handler: (*server).GetAuthBans, Role: roleAuditor},
+	{Method: "DELETE", Path: "/admin/authbans/{ip}", Handler: (*server).DeleteAuthBan, Role: roleOperator},
+	{Method: "GET", Path: "/admin/usercache", Handler: (*server).GetUserCacheStats, Role: roleAuditor},
+	{Method: "GET", Path: "/admin/config", Handler: (*server).GetConfig, Role: roleAuditor},
+	{Method: "POST", Path: "/admin/config/reload", Handler: (*server).ReloadConfig, Role: roleOperator},
+	{Method: "GET", Path: "/admin/maintenance", Handler: (*server).GetMaintenance, Role: roleAuditor},
+	{Method: "POST", Path: "/admin/maintenance", Handler: (*server).SetMaintenance, Role: roleOperator},
+	{Method: "DELETE", Path: "/admin/maintenance", Handler: (*server).DeleteMaintenance, Role: roleOperator},
+	{Method: "GET", Path: "/admin/rabbitmq/stats", Handler: (*server).RabbitMQStats, Role: roleAuditor},
+	{Method: "GET", Path: "/admin/nats/stats", Handler: (*server).NATSStats, Role: roleAuditor},
+	{Method: "GET", Path: "/admin/reconciliation", Handler: (*server).GetReconciliation, Role: roleAuditor},
+	{Method: "POST", Path: "/admin/reconciliation", Handler: (*server).RunReconciliation, Role: roleOperator},
+	{Method: "GET", Path: "/admin/changefeed", Handler: (*server).GetAdminChangefeed, Role: roleAuditor},
+
+	// ========== AUTH ENDPOINTS (NEW for MAX) ==========
+	{Method: "POST", Path: "/session/auth/request", Handler: authRoute((*auth.Handlers).AuthRequest)},
+	{Method: "POST", Path: "/session/auth/confirm", Handler: authRoute((*auth.Handlers).AuthConfirm)},
+	{Method: "POST", Path: "/session/auth/register", Handler: authRoute((*auth.Handlers).AuthRegister)},
+	{Method: "POST", Path: "/session/auth/token", Handler: authRoute((*auth.Handlers).AuthToken)},
+
+	// ========== SESSION ENDPOINTS ==========
+	{Method: "POST", Path: "/session/connect", Handler: sessionRoute((*session.Handlers).Connect)},
+	{Method: "POST", Path: "/session/disconnect", Handler: sessionRoute((*session.Handlers).Disconnect)},
+	{Method: "POST", Path: "/session/logout", Handler: sessionRoute((*session.Handlers).Logout)},
+	{Method: "POST", Path: "/session/reset", Handler: (*server).ResetSession},
+	{Method: "GET", Path: "/session/status", Handler: sessionRoute((*session.Handlers).GetStatus), Viewer: true},
+	{Method: "POST", Path: "/session/sync", Handler: sessionRoute((*session.Handlers).RequestSync)},
+	{Method: "GET", Path: "/session/sessions", Handler: sessionRoute((*session.Handlers).GetSessions)},
+	{Method: "POST", Path: "/session/sessions/close", Handler: sessionRoute((*session.Handlers).CloseSessions)},
+	{Method: "GET", Path: "/session/limits", Handler: (*server).GetLimits, Viewer: true},
+	{Method: "GET", Path: "/session/restriction", Handler: (*server).GetRestriction, Viewer: true},
+	{Method: "DELETE", Path: "/session/restriction", Handler: (*server).ClearRestriction},
+	{Method: "GET", Path: "/session/window", Handler: (*server).GetConnectionWindow, Viewer: true},
+	{Method: "POST", Path: "/session/window", Handler: (*server).SetConnectionWindow},
+	// Removed: /session/qr - MAX uses SMS auth
+	// Removed: /session/pairphone - MAX uses SMS auth
+
+	// ========== WEBHOOK ENDPOINTS ==========
+	{Method: "POST", Path: "/webhook", Handler: webhookRoute((*webhook.Handlers).SetWebhook)},
+	{Method: "GET", Path: "/webhook", Handler: webhookRoute((*webhook.Handlers).GetWebhook)},
+	{Method: "DELETE", Path: "/webhook", Handler: webhookRoute((*webhook.Handlers).DeleteWebhook)},
+	{Method: "PUT", Path: "/webhook", Handler: webhookRoute((*webhook.Handlers).UpdateWebhook)},
+	{Method: "GET", Path: "/webhook/failed", Handler: (*server).GetFailedWebhooks},
+	{Method: "DELETE", Path: "/webhook/failed", Handler: (*server).DeleteFailedWebhooks},
+	{Method: "POST", Path: "/webhook/failed/replay", Handler: (*server).ReplayFailedWebhooks},
+	{Method: "GET", Path: "/webhook/secret", Handler: (*server).GetWebhookSecret},
+	{Method: "POST", Path: "/webhook/secret", Handler: (*server).SetWebhookSecret},
+	{Method: "DELETE", Path: "/webhook/secret", Handler: (*server).DeleteWebhookSecret},
+	{Method: "GET", Path: "/ws", Handler: (*server).EventStream},
+	{Method: "GET", Path: "/events/stream", Handler: (*server).GetEventStream},
+
+	// ========== MESSAGE ENDPOINTS ==========
+	{Method: "POST", Path: "/chat/send/text", Handler: chatRoute((*chat.Handlers).SendMessage), Outbound: true},
+	{Method: "POST", Path: "/chat/send/image", Handler: chatRoute((*chat.Handlers).SendImage), Outbound: true, Media: true},
+	{Method: "POST", Path: "/chat/send/audio", Handler: chatRoute((*chat.Handlers).SendAudio), Outbound: true, Media: true},
+	{Method: "POST", Path: "/chat/send/voice", Handler: chatRoute((*chat.Handlers).SendVoice), Outbound: true, Media: true},
+	{Method: "POST", Path: "/chat/send/document", Handler: chatRoute((*chat.Handlers).SendDocument), Outbound: true, Media: true},
+	{Method: "POST", Path: "/chat/send/video", Handler: chatRoute((*chat.Handlers).SendVideo), Outbound: true, Media: true},
+	{Method: "POST", Path: "/chat/send/sticker", Handler: chatRoute((*chat.Handlers).SendSticker), Outbound: true},
+	{Method: "POST", Path: "/chat/send/forward", Handler: chatRoute((*chat.Handlers).ForwardMessages), Outbound: true},
+	{Method: "POST", Path: "/chat/send/batch", Handler: (*server).SendBatch, Outbound: true},
+	{Method: "POST", Path: "/chat/schedule", Handler: (*server).ScheduleMessage},
+	{Method: "GET", Path: "/chat/schedule", Handler: (*server).ListScheduled},
+	{Method: "GET", Path: "/chat/schedule/{id:[0-9]+}", Handler: (*server).GetScheduled},
+	{Method: "DELETE", Path: "/chat/schedule/{id:[0-9]+}", Handler: (*server).CancelScheduled},
+	{Method: "POST", Path: "/chat/send/edit", Handler: chatRoute((*chat.Handlers).SendEditMessage)},
+	{Method: "POST", Path: "/chat/delete", Handler: chatRoute((*chat.Handlers).DeleteMessage)},
+	{Method: "POST", Path: "/chat/react", Handler: chatRoute((*chat.Handlers).React)},
+	{Method: "POST", Path: "/chat/mute", Handler: (*server).MuteChat},
+	{Method: "POST", Path: "/chat/unmute", Handler: (*server).UnmuteChat},
+	{Method: "POST", Path: "/chat/deletechat", Handler: (*server).DeleteChat},
+	{Method: "POST", Path: "/chat/clearhistory", Handler: (*server).ClearChatHistory},
+	{Method: "POST", Path: "/chat/linkpreview", Handler: (*server).GetLinkPreview, RateLimit: 60},
+	{Method: "POST", Path: "/chat/reactions/detailed", Handler: chatRoute((*chat.Handlers).GetDetailedReactions), Viewer: true},
+	{Method: "POST", Path: "/chat/markread", Handler: chatRoute((*chat.Handlers).MarkRead)},
+	{Method: "GET", Path: "/chat/list", Handler: chatRoute((*chat.Handlers).GetChatList), Viewer: true},
+	{Method: "POST", Path: "/chat/history", Handler: chatRoute((*chat.Handlers).GetChatHistory), Viewer: true},
+	{Method: "POST", Path: "/chat/media", Handler: chatRoute((*chat.Handlers).GetChatMedia)},
+	{Method: "POST", Path: "/chat/search", Handler: chatRoute((*chat.Handlers).SearchMessages), Viewer: true},
+	{Method: "POST", Path: "/chat/searchpublic", Handler: chatRoute((*chat.Handlers).SearchPublic), RateLimit: 30},
+	{Method: "GET", Path: "/chat/stickers", Handler: chatRoute((*chat.Handlers).GetStickerSets)},
+	{Method: "GET", Path: "/chat/stickers/info", Handler: chatRoute((*chat.Handlers).GetStickers)},
+	// Not implemented: /chat/send/location - Not supported
+	// Not implemented: /chat/send/contact - Not supported
+	// Not implemented: /chat/send/buttons - Not supported
+	// Not implemented: /chat/send/list - Not supported
+	// Not implemented: /chat/send/poll - Different format
+
+	// ========== MEDIA DOWNLOAD ENDPOINTS ==========
+	{Method: "POST", Path: "/chat/downloadimage", Handler: chatRoute((*chat.Handlers).DownloadImage)},
+	{Method: "POST", Path: "/chat/downloadvideo", Handler: chatRoute((*chat.Handlers).DownloadVideo)},
+	{Method: "POST", Path: "/chat/downloadaudio", Handler: chatRoute((*chat.Handlers).DownloadAudio)},
+	{Method: "POST", Path: "/chat/downloaddocument", Handler: chatRoute((*chat.Handlers).DownloadDocument)},
+
+	// ========== USER ENDPOINTS ==========
+	{Method: "GET", Path: "/user/contacts", Handler: userRoute((*user.Handlers).GetContacts), Viewer: true},
+	{Method: "POST", Path: "/user/check", Handler: userRoute((*user.Handlers).CheckUser), RateLimit: 30},
+	{Method: "POST", Path: "/user/info", Handler: userRoute((*user.Handlers).GetUser)},
+	{Method: "GET", Path: "/user/resolve-link", Handler: userRoute((*user.Handlers).ResolveLink)},
+	{Method: "GET", Path: "/user/profile", Handler: (*server).GetProfile},
+	{Method: "POST", Path: "/user/profile", Handler: (*server).UpdateProfile},
+	{Method: "POST", Path: "/user/avatar", Handler: (*server).UpdateAvatar, Media: true},
+	{Method: "POST", Path: "/user/presence", Handler: userRoute((*user.Handlers).SendPresence)},
+	{Method: "GET", Path: "/user/presence/subscriptions", Handler: (*server).GetPresenceSubscriptions},
+	{Method: "POST", Path: "/user/presence/subscriptions", Handler: (*server).UpdatePresenceSubscriptions},
+	{Method: "GET", Path: "/user/presence/{userId:[0-9]+}", Handler: (*server).GetUserPresence},
+	{Method: "GET", Path: "/user/quiethours", Handler: (*server).GetQuietHours},
+	{Method: "POST", Path: "/user/quiethours", Handler: (*server).SetQuietHours},
+	{Method: "GET", Path: "/user/quiethours/queue", Handler: (*server).GetQuietHoursQueue},
+	{Method: "GET", Path: "/user/blocklist", Handler: (*server).GetBlocklist},
+	{Method: "POST", Path: "/user/blocklist", Handler: (*server).AddToBlocklist},
+	{Method: "DELETE", Path: "/user/blocklist", Handler: (*server).RemoveFromBlocklist},
+	{Method: "POST", Path: "/user/blocklist/keywords", Handler: (*server).SetOptOutKeywords},
+	{Method: "GET", Path: "/user/storage", Handler: (*server).GetStorage},
+	{Method: "POST", Path: "/user/storage", Handler: (*server).SetStorage},
+	{Method: "GET", Path: "/user/redaction", Handler: (*server).GetRedaction},
+	{Method: "POST", Path: "/user/redaction", Handler: (*server).SetRedaction},
+	{Method: "GET", Path: "/user/automarkread", Handler: (*server).GetAutoMarkRead},
+	{Method: "POST", Path: "/user/automarkread", Handler: (*server).SetAutoMarkRead},
+	{Method: "GET", Path: "/user/config", Handler: (*server).GetUserConfig},
+	{Method: "POST", Path: "/user/config", Handler: (*server).SetUserConfig},
+	{Method: "GET", Path: "/user/settings", Handler: (*server).GetUserSettings},
+	{Method: "POST", Path: "/user/settings", Handler: (*server).SetUserSettings},
+	{Method: "GET", Path: "/user/viewertoken", Handler: (*server).GetViewerToken},
+	{Method: "POST", Path: "/user/viewertoken", Handler: (*server).CreateViewerToken},
+	{Method: "DELETE", Path: "/user/viewertoken", Handler: (*server).DeleteViewerToken},
+	{Method: "GET", Path: "/user/uptime", Handler: (*server).GetUptime, Viewer: true},
+	{Method: "GET", Path: "/user/warmup", Handler: (*server).GetWarmup, Viewer: true},
+	{Method: "GET", Path: "/user/policy", Handler: (*server).GetContentPolicy},
+	{Method: "GET", Path: "/user/features", Handler: (*server).GetFeatures},
+	{Method: "GET", Path: "/user/gdpr/export", Handler: (*server).ExportUserData},
+	{Method: "POST", Path: "/user/gdpr/erase", Handler: (*server).EraseUserData},
+	{Method: "GET", Path: "/user/gdpr/audit", Handler: (*server).GetGDPRAudit},
+	{Method: "POST", Path: "/media/presign", Handler: (*server).PresignMedia},
+	{Method: "GET", Path: "/media", Handler: (*server).ListMedia},
+	{Method: "GET", Path: "/media/{mediaid:[0-9]+}", Handler: (*server).GetMedia},
+
+	// ========== GROUP ENDPOINTS ==========
+	{Method: "POST", Path: "/group/create", Handler: groupRoute((*group.Handlers).CreateGroup), Media: true},
+	{Method: "POST", Path: "/group/info", Handler: groupRoute((*group.Handlers).GetGroupInfo)},
+	{Method: "POST", Path: "/group/invitelink", Handler: groupRoute((*group.Handlers).GetGroupInviteLink)},
+	{Method: "POST", Path: "/group/invitelink/revoke", Handler: groupRoute((*group.Handlers).RevokeGroupInviteLink)},
+	{Method: "POST", Path: "/group/invite-send", Handler: groupRoute((*group.Handlers).SendGroupInvite), Outbound: true},
+	{Method: "POST", Path: "/group/checklink", Handler: groupRoute((*group.Handlers).CheckGroupLink)},
+	{Method: "POST", Path: "/group/join", Handler: groupRoute((*group.Handlers).GroupJoin)},
+	{Method: "POST", Path: "/group/leave", Handler: groupRoute((*group.Handlers).GroupLeave)},
+	{Method: "POST", Path: "/group/name", Handler: groupRoute((*group.Handlers).SetGroupName)},
+	{Method: "POST", Path: "/group/topic", Handler: groupRoute((*group.Handlers).SetGroupTopic)},
+	{Method: "POST", Path: "/group/photo", Handler: groupRoute((*group.Handlers).SetGroupPhoto), Media: true},
+	{Method: "POST", Path: "/group/updateparticipants", Handler: groupRoute((*group.Handlers).UpdateGroupParticipants)},
+	{Method: "POST", Path: "/group/promote", Handler: (*server).PromoteGroupAdmins},
+	{Method: "POST", Path: "/group/demote", Handler: (*server).DemoteGroupAdmins},
+	{Method: "GET", Path: "/group/readmarks", Handler: (*server).GetGroupReadMarks, Viewer: true},
+	{Method: "GET", Path: "/group/joinrequests", Handler: (*server).GetJoinRequests},
+	{Method: "POST", Path: "/group/joinrequests/decide", Handler: (*server).DecideJoinRequests},
+	// Not implemented: /group/announce - Different in MAX
+	// Not implemented: /group/locked - Different in MAX
+	// Not implemented: /group/ephemeral - Not supported
+
+	// ========== CHANNEL ENDPOINTS ==========
+	{Method: "GET", Path: "/channel/stats", Handler: (*server).GetChannelStats, Viewer: true},
+
+	// ========== FOLDER ENDPOINTS ==========
+	{Method: "GET", Path: "/folders", Handler: (*server).GetFolders},
+	{Method: "POST", Path: "/folders", Handler: (*server).CreateFolder},
+	{Method: "POST", Path: "/folders/reorder", Handler: (*server).ReorderFolders},
+	{Method: "PUT", Path: "/folders/{folderid}", Handler: (*server).UpdateFolder},
+	{Method: "DELETE", Path: "/folders/{folderid}", Handler: (*server).DeleteFolder},
+
+	// ========== CAMPAIGN ENDPOINTS ==========
+	{Method: "POST", Path: "/campaigns", Handler: (*server).CreateCampaign},
+	{Method: "GET", Path: "/campaigns", Handler: (*server).ListCampaigns, Viewer: true},
+	{Method: "GET", Path: "/campaigns/{campaignid}", Handler: (*server).GetCampaign, Viewer: true},
+	{Method: "POST", Path: "/campaigns/{campaignid}/pause", Handler: (*server).PauseCampaign},
+	{Method: "POST", Path: "/campaigns/{campaignid}/resume", Handler: (*server).ResumeCampaign},
+	{Method: "POST", Path: "/campaigns/{campaignid}/cancel", Handler: (*server).CancelCampaign},
+	{Method: "GET", Path: "/campaigns/{campaignid}/export", Handler: (*server).ExportCampaign, Viewer: true},
+
+	// ========== CHANGEFEED ENDPOINTS ==========
+	{Method: "GET", Path: "/changefeed", Handler: (*server).GetChangefeed},
+
+	// Not implemented: /newsletter/* - Use channels API
+}
+
+// routeIndex finds the registry entry of a route by method and path template
+var routeIndex = indexRoutes(apiRoutes)
+
+func indexRoutes(routes []route) map[string]route {
+	index := make(map[string]route, len(routes))
+	for _, rt := range routes {
+		index[rt.Method+" "+rt.Path] = rt
+	}
+	return index
+}
+
+// currentRoute returns the registry entry of the route matched for r
+func currentRoute(r *http.Request) (route, bool) {
+	matched := mux.CurrentRoute(r)
+	if matched == nil {
+		return route{}, false
+	}
+	tpl, err := matched.GetPathTemplate()
+	if err != nil {
+		return route{}, false
+	}
+	rt, ok := routeIndex[r.Method+" "+tpl]
+	return rt, ok
+}
+
 func (s *server) routes() {
 
 	ex, err := os.Executable()
@@ -43,18 +307,18 @@ func (s *server) routes() {
 			Logger()
 	}
 
-	// Admin routes (require admin token)
-	adminRoutes := s.router.PathPrefix("/admin").Subrouter()
-	adminRoutes.Use(s.authadmin)
-	adminRoutes.Handle("/users", s.ListUsers()).Methods("GET")
-	adminRoutes.Handle("/users/{userid}", s.ListUsers()).Methods("GET")
-	adminRoutes.Handle("/users", s.AddUser()).Methods("POST")
-	adminRoutes.Handle("/users/{userid}", s.EditUser()).Methods("PUT")
-	adminRoutes.Handle("/users/{userid}", s.DeleteUser()).Methods("DELETE")
+	// Request bodies are capped per route before any handler reads them
+	s.router.Use(s.limitBody)
+
+	// Probes for load balancers and Kubernetes, without authentication
+	s.router.Handle("/healthz", s.Healthz()).Methods("GET")
+	s.router.Handle("/readyz", s.Readyz()).Methods("GET")
+	s.router.Handle("/metrics", s.Metrics()).Methods("GET")
 
 	// Setup middleware chain for user routes
 	c := alice.New()
 	c = c.Append(s.authalice)
+	c = c.Append(s.lazyConnectHandler)
 	c = c.Append(hlog.NewHandler(routerLog))
 
 	c = c.Append(hlog.AccessHandler(func(r *http.Request, status, size int, duration time.Duration) {
@@ -73,71 +337,30 @@ func (s *server) routes() {
 	c = c.Append(hlog.RefererHandler("referer"))
 	c = c.Append(hlog.RequestIDHandler("req_id", "Request-Id"))
 
-	// ========== AUTH ENDPOINTS (NEW for MAX) ==========
-	s.router.Handle("/session/auth/request", c.Then(s.AuthRequest())).Methods("POST")
-	s.router.Handle("/session/auth/confirm", c.Then(s.AuthConfirm())).Methods("POST")
-	s.router.Handle("/session/auth/register", c.Then(s.AuthRegister())).Methods("POST")
+	// Send endpoints additionally go through the outbound policy guard
+	outbound := c.Append(s.outboundGuard)
 
-	// ========== SESSION ENDPOINTS ==========
-	s.router.Handle("/session/connect", c.Then(s.Connect())).Methods("POST")
-	s.router.Handle("/session/disconnect", c.Then(s.Disconnect())).Methods("POST")
-	s.router.Handle("/session/logout", c.Then(s.Logout())).Methods("POST")
-	s.router.Handle("/session/status", c.Then(s.GetStatus())).Methods("GET")
-	s.router.Handle("/session/sync", c.Then(s.RequestSync())).Methods("POST")
-	// Removed: /session/qr - MAX uses SMS auth
-	// Removed: /session/pairphone - MAX uses SMS auth
-
-	// ========== WEBHOOK ENDPOINTS ==========
-	s.router.Handle("/webhook", c.Then(s.SetWebhook())).Methods("POST")
-	s.router.Handle("/webhook", c.Then(s.GetWebhook())).Methods("GET")
-	s.router.Handle("/webhook", c.Then(s.DeleteWebhook())).Methods("DELETE")
-	s.router.Handle("/webhook", c.Then(s.UpdateWebhook())).Methods("PUT")
-
-	// ========== MESSAGE ENDPOINTS ==========
-	s.router.Handle("/chat/send/text", c.Then(s.SendMessage())).Methods("POST")
-	s.router.Handle("/chat/send/image", c.Then(s.SendImage())).Methods("POST")
-	s.router.Handle("/chat/send/audio", c.Then(s.SendAudio())).Methods("POST")
-	s.router.Handle("/chat/send/document", c.Then(s.SendDocument())).Methods("POST")
-	s.router.Handle("/chat/send/video", c.Then(s.SendVideo())).Methods("POST")
-	s.router.Handle("/chat/send/edit", c.Then(s.SendEditMessage())).Methods("POST")
-	s.router.Handle("/chat/delete", c.Then(s.DeleteMessage())).Methods("POST")
-	s.router.Handle("/chat/react", c.Then(s.React())).Methods("POST")
-	s.router.Handle("/chat/markread", c.Then(s.MarkRead())).Methods("POST")
-	s.router.Handle("/chat/history", c.Then(s.GetChatHistory())).Methods("POST")
-	// Not implemented: /chat/send/sticker - Different system in MAX
-	// Not implemented: /chat/send/location - Not supported
-	// Not implemented: /chat/send/contact - Not supported
-	// Not implemented: /chat/send/buttons - Not supported
-	// Not implemented: /chat/send/list - Not supported
-	// Not implemented: /chat/send/poll - Different format
-
-	// ========== MEDIA DOWNLOAD ENDPOINTS ==========
-	s.router.Handle("/chat/downloadimage", c.Then(s.DownloadImage())).Methods("POST")
-	s.router.Handle("/chat/downloadvideo", c.Then(s.DownloadVideo())).Methods("POST")
-	s.router.Handle("/chat/downloadaudio", c.Then(s.DownloadAudio())).Methods("POST")
-	s.router.Handle("/chat/downloaddocument", c.Then(s.DownloadDocument())).Methods("POST")
-
-	// ========== USER ENDPOINTS ==========
-	s.router.Handle("/user/contacts", c.Then(s.GetContacts())).Methods("GET")
-	s.router.Handle("/user/check", c.Then(s.CheckUser())).Methods("POST")
-	s.router.Handle("/user/info", c.Then(s.GetUser())).Methods("POST")
-	s.router.Handle("/user/presence", c.Then(s.SendPresence())).Methods("POST")
-
-	// ========== GROUP ENDPOINTS ==========
-	s.router.Handle("/group/create", c.Then(s.CreateGroup())).Methods("POST")
-	s.router.Handle("/group/info", c.Then(s.GetGroupInfo())).Methods("POST")
-	s.router.Handle("/group/invitelink", c.Then(s.GetGroupInviteLink())).Methods("POST")
-	s.router.Handle("/group/join", c.Then(s.GroupJoin())).Methods("POST")
-	s.router.Handle("/group/leave", c.Then(s.GroupLeave())).Methods("POST")
-	s.router.Handle("/group/name", c.Then(s.SetGroupName())).Methods("POST")
-	s.router.Handle("/group/topic", c.Then(s.SetGroupTopic())).Methods("POST")
-	s.router.Handle("/group/updateparticipants", c.Then(s.UpdateGroupParticipants())).Methods("POST")
-	// Not implemented: /group/photo - Use chat update
-	// Not implemented: /group/announce - Different in MAX
-	// Not implemented: /group/locked - Different in MAX
-	// Not implemented: /group/ephemeral - Not supported
+	// API endpoints. Admin routes require an admin key with the role of the
+	// endpoint, user routes a user token.
+	for _, rt := range apiRoutes {
+		var handler http.Handler
+		if rt.Role != 0 {
+			handler = s.authadmin(s.requireRole(rt.Role, rt.Handler(s)))
+		} else {
+			chain := c
+			if rt.Outbound {
+				chain = outbound
+			}
+			if rt.RateLimit > 0 {
+				chain = chain.Append(s.rateLimit(rt.RateLimit))
+			}
+			handler = chain.Then(rt.Handler(s))
+		}
+		s.router.Handle(rt.Path, handler).Methods(rt.Method)
+	}
 
-	// Not implemented: /newsletter/* - Use channels API
+	// Files written by the local storage backend
+	s.router.PathPrefix("/media/").Handler(serveLocalMedia()).Methods("GET", "HEAD")
 
 	// Static files
 	s.router.PathPrefix("/").Handler(http.FileServer(http.Dir(exPath + "/static/")))
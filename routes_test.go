@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// routeVarPattern strips the pattern of a path variable, {id:[0-9]+} -> {id}
+var routeVarPattern = regexp.MustCompile(`\{(\w+):[^}]*\}`)
+
+// specOperations returns the "METHOD /path" operations of the OpenAPI spec
+func specOperations(t *testing.T, specPath string) map[string]bool {
+	t.Helper()
+	data, err := os.ReadFile(specPath)
+	if err != nil {
+		t.Fatalf("read spec: %v", err)
+	}
+
+	// Paths are two-space keys under paths:, their methods four-space keys
+	operations := make(map[string]bool)
+	var inPaths bool
+	var path string
+	for _, line := range strings.Split(string(data), "\n") {
+		switch {
+		case line == "paths:":
+			inPaths = true
+		case !inPaths:
+		case line != "" && !strings.HasPrefix(line, " "):
+			inPaths = false
+		case strings.HasPrefix(line, "  /") && strings.HasSuffix(line, ":"):
+			path = strings.TrimSuffix(strings.TrimSpace(line), ":")
+		case strings.HasPrefix(line, "    ") && !strings.HasPrefix(line, "     ") && strings.HasSuffix(line, ":"):
+			operations[strings.ToUpper(strings.TrimSuffix(strings.TrimSpace(line), ":"))+" "+path] = true
+		}
+	}
+	return operations
+}
+
+// TestRoutesDocumented checks that the OpenAPI spec, generated from the handler
+// annotations with make swagger, has exactly the routes of the registry
+func TestRoutesDocumented(t *testing.T) {
+	documented := specOperations(t, "static/api/spec.yml")
+
+	registered := map[string]bool{
+		// Probes registered outside apiRoutes
+		"GET /healthz": true,
+		"GET /readyz":  true,
+		"GET /metrics": true,
+	}
+	for _, rt := range apiRoutes {
+		key := rt.Method + " " + routeVarPattern.ReplaceAllString(rt.Path, "{$1}")
+		if registered[key] {
+			t.Errorf("%s is registered twice", key)
+		}
+		registered[key] = true
+		if !documented[key] {
+			t.Errorf("%s is missing from the OpenAPI spec", key)
+		}
+	}
+	for key := range documented {
+		if !registered[key] {
+			t.Errorf("%s is documented but not registered", key)
+		}
+	}
+}
+
+func TestRouteLimiter(t *testing.T) {
+	limiter := newRouteLimiter(2)
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if _, ok := limiter.allow("a", now); !ok {
+			t.Fatalf("request %d refused under the limit", i+1)
+		}
+	}
+	until, ok := limiter.allow("a", now.Add(time.Second))
+	if ok {
+		t.Fatal("request over the limit allowed")
+	}
+	if want := now.Add(rateLimitWindow); !until.Equal(want) {
+		t.Errorf("until = %v, want %v", until, want)
+	}
+	if _, ok := limiter.allow("b", now); !ok {
+		t.Error("limit shared between instances")
+	}
+	if _, ok := limiter.allow("a", now.Add(rateLimitWindow)); !ok {
+		t.Error("request refused in the next window")
+	}
+}
@@ -5,58 +5,23 @@ import (
 	"context"
 	"fmt"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
-	"github.com/rs/zerolog/log"
 )
 
-// S3Config holds S3 configuration for a user
-type S3Config struct {
-	Enabled       bool
-	Endpoint      string
-	Region        string
-	Bucket        string
-	AccessKey     string
-	SecretKey     string
-	PathStyle     bool
-	PublicURL     string
-	MediaDelivery string
-	RetentionDays int
+// s3Store stores media in an S3-compatible bucket
+type s3Store struct {
+	client  *s3.Client
+	config  *StorageConfig
+	backend string
 }
 
-// S3Manager manages S3 operations
-type S3Manager struct {
-	mu      sync.RWMutex
-	clients map[string]*s3.Client
-	configs map[string]*S3Config
-}
-
-// Global S3 manager instance
-var s3Manager = &S3Manager{
-	clients: make(map[string]*s3.Client),
-	configs: make(map[string]*S3Config),
-}
-
-// GetS3Manager returns the global S3 manager instance
-func GetS3Manager() *S3Manager {
-	return s3Manager
-}
-
-// InitializeS3Client creates or updates S3 client for a user
-func (m *S3Manager) InitializeS3Client(userID string, config *S3Config) error {
-	if !config.Enabled {
-		m.RemoveClient(userID)
-		return nil
-	}
-
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
+// newS3Store creates an S3 client for the given configuration
+func newS3Store(config *StorageConfig) *s3Store {
 	// Create custom credentials provider
 	credProvider := credentials.NewStaticCredentialsProvider(
 		config.AccessKey,
@@ -88,112 +53,38 @@ func (m *S3Manager) InitializeS3Client(userID string, config *S3Config) error {
 		o.UsePathStyle = config.PathStyle
 	})
 
-	m.clients[userID] = client
-	m.configs[userID] = config
-
-	log.Info().Str("userID", userID).Str("bucket", config.Bucket).Msg("S3 client initialized")
-	return nil
-}
-
-// RemoveClient removes S3 client for a user
-func (m *S3Manager) RemoveClient(userID string) {
-	m.mu.Lock()
-	defer m.mu.Unlock()
-
-	delete(m.clients, userID)
-	delete(m.configs, userID)
+	return &s3Store{client: client, config: config, backend: storageBackendS3}
 }
 
-// GetClient returns S3 client for a user
-func (m *S3Manager) GetClient(userID string) (*s3.Client, *S3Config, bool) {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	client, clientOk := m.clients[userID]
-	config, configOk := m.configs[userID]
+// newGCSStore uses the Google Cloud Storage XML API, which is S3-compatible when
+// the bucket is accessed with HMAC keys
+func newGCSStore(config *StorageConfig) *s3Store {
+	gcsConfig := *config
+	gcsConfig.Endpoint = "https://storage.googleapis.com"
+	gcsConfig.Region = "auto"
+	gcsConfig.PathStyle = true
+
+	client := s3.NewFromConfig(aws.Config{
+		Region:      gcsConfig.Region,
+		Credentials: credentials.NewStaticCredentialsProvider(gcsConfig.AccessKey, gcsConfig.SecretKey, ""),
+	}, func(o *s3.Options) {
+		o.BaseEndpoint = aws.String(gcsConfig.Endpoint)
+		o.UsePathStyle = true
+		// GCS rejects the flexible checksum headers sent by default
+		o.RequestChecksumCalculation = aws.RequestChecksumCalculationWhenRequired
+		o.ResponseChecksumValidation = aws.ResponseChecksumValidationWhenRequired
+	})
 
-	return client, config, clientOk && configOk
+	return &s3Store{client: client, config: &gcsConfig, backend: storageBackendGCS}
 }
 
-// GenerateS3Key generates S3 object key based on message metadata
-func (m *S3Manager) GenerateS3Key(userID, contactJID, messageID string, mimeType string, isIncoming bool) string {
-	// Determine direction
-	direction := "outbox"
-	if isIncoming {
-		direction = "inbox"
-	}
-
-	// Clean contact JID
-	contactJID = strings.ReplaceAll(contactJID, "@", "_")
-	contactJID = strings.ReplaceAll(contactJID, ":", "_")
-
-	// Get current time
-	now := time.Now()
-	year := now.Format("2025")
-	month := now.Format("05")
-	day := now.Format("25")
-
-	// Determine media type folder
-	mediaType := "documents"
-	if strings.HasPrefix(mimeType, "image/") {
-		mediaType = "images"
-	} else if strings.HasPrefix(mimeType, "video/") {
-		mediaType = "videos"
-	} else if strings.HasPrefix(mimeType, "audio/") {
-		mediaType = "audio"
-	}
-
-	// Get file extension
-	ext := ".bin"
-	switch {
-	case strings.Contains(mimeType, "jpeg"), strings.Contains(mimeType, "jpg"):
-		ext = ".jpg"
-	case strings.Contains(mimeType, "png"):
-		ext = ".png"
-	case strings.Contains(mimeType, "gif"):
-		ext = ".gif"
-	case strings.Contains(mimeType, "webp"):
-		ext = ".webp"
-	case strings.Contains(mimeType, "mp4"):
-		ext = ".mp4"
-	case strings.Contains(mimeType, "webm"):
-		ext = ".webm"
-	case strings.Contains(mimeType, "ogg"):
-		ext = ".ogg"
-	case strings.Contains(mimeType, "opus"):
-		ext = ".opus"
-	case strings.Contains(mimeType, "pdf"):
-		ext = ".pdf"
-	case strings.Contains(mimeType, "doc"):
-		if strings.Contains(mimeType, "docx") {
-			ext = ".docx"
-		} else {
-			ext = ".doc"
-		}
-	}
+func (m *s3Store) Backend() string { return m.backend }
 
-	// Build S3 key
-	key := fmt.Sprintf("users/%s/%s/%s/%s/%s/%s/%s/%s%s",
-		userID,
-		direction,
-		contactJID,
-		year,
-		month,
-		day,
-		mediaType,
-		messageID,
-		ext,
-	)
+func (m *s3Store) Location() string { return m.config.Bucket }
 
-	return key
-}
-
-// UploadToS3 uploads file to S3 and returns the key
-func (m *S3Manager) UploadToS3(ctx context.Context, userID string, key string, data []byte, mimeType string) error {
-	client, config, ok := m.GetClient(userID)
-	if !ok {
-		return fmt.Errorf("S3 client not initialized for user %s", userID)
-	}
+// Put uploads file to S3
+func (m *s3Store) Put(ctx context.Context, key string, data []byte, mimeType string) error {
+	config := m.config
 
 	// Set content type and cache headers for preview
 	contentType := mimeType
@@ -214,7 +105,12 @@ func (m *S3Manager) UploadToS3(ctx context.Context, userID string, key string, d
 		Body:         bytes.NewReader(data),
 		ContentType:  aws.String(contentType),
 		CacheControl: aws.String("public, max-age=3600"),
-		ACL:          types.ObjectCannedACLPublicRead,
+	}
+
+	// GCS buckets with uniform access reject object ACLs; public access is granted on the bucket.
+	// Objects served through presigned URLs stay private.
+	if m.backend == storageBackendS3 && config.PresignTTL == 0 {
+		input.ACL = types.ObjectCannedACLPublicRead
 	}
 
 	if expires != nil {
@@ -226,7 +122,7 @@ func (m *S3Manager) UploadToS3(ctx context.Context, userID string, key string, d
 		input.ContentDisposition = aws.String("inline")
 	}
 
-	_, err := client.PutObject(ctx, input)
+	_, err := m.client.PutObject(ctx, input)
 	if err != nil {
 		return fmt.Errorf("failed to upload to S3: %w", err)
 	}
@@ -234,12 +130,9 @@ func (m *S3Manager) UploadToS3(ctx context.Context, userID string, key string, d
 	return nil
 }
 
-// GetPublicURL generates public URL for S3 object
-func (m *S3Manager) GetPublicURL(userID, key string) string {
-	_, config, ok := m.GetClient(userID)
-	if !ok {
-		return ""
-	}
+// URL generates public URL for S3 object
+func (m *s3Store) URL(key string) string {
+	config := m.config
 
 	// Use custom public URL if configured
 	if config.PublicURL != "" {
@@ -268,84 +161,52 @@ func (m *S3Manager) GetPublicURL(userID, key string) string {
 	return fmt.Sprintf("https://%s.%s/%s", config.Bucket, endpoint, key)
 }
 
-// TestConnection tests S3 connection
-func (m *S3Manager) TestConnection(ctx context.Context, userID string) error {
-	client, config, ok := m.GetClient(userID)
-	if !ok {
-		return fmt.Errorf("S3 client not initialized for user %s", userID)
+// Presign generates a signed GET URL for an object that expires after ttl
+func (m *s3Store) Presign(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(m.client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(m.config.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
 	}
+	return req.URL, nil
+}
 
+// Test tests S3 connection
+func (m *s3Store) Test(ctx context.Context) error {
 	// Try to list objects with max 1 result
 	input := &s3.ListObjectsV2Input{
-		Bucket:  aws.String(config.Bucket),
+		Bucket:  aws.String(m.config.Bucket),
 		MaxKeys: aws.Int32(1),
 	}
 
-	_, err := client.ListObjectsV2(ctx, input)
+	_, err := m.client.ListObjectsV2(ctx, input)
 	return err
 }
 
-// ProcessMediaForS3 handles the complete media upload process
-func (m *S3Manager) ProcessMediaForS3(ctx context.Context, userID, contactJID, messageID string,
-	data []byte, mimeType string, fileName string, isIncoming bool) (map[string]interface{}, error) {
-
-	// Generate S3 key
-	key := m.GenerateS3Key(userID, contactJID, messageID, mimeType, isIncoming)
-
-	// Upload to S3
-	err := m.UploadToS3(ctx, userID, key, data, mimeType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to upload to S3: %w", err)
-	}
-
-	// Generate public URL
-	publicURL := m.GetPublicURL(userID, key)
-
-	// Return S3 metadata
-	s3Data := map[string]interface{}{
-		"url":      publicURL,
-		"key":      key,
-		"bucket":   m.configs[userID].Bucket,
-		"size":     len(data),
-		"mimeType": mimeType,
-		"fileName": fileName,
-	}
-
-	return s3Data, nil
-}
-
-// DeleteAllUserObjects deletes all user files from S3
-func (m *S3Manager) DeleteAllUserObjects(ctx context.Context, userID string) error {
-	client, config, ok := m.GetClient(userID)
-	if !ok {
-		return fmt.Errorf("S3 client not initialized for user %s", userID)
-	}
-
-	prefix := fmt.Sprintf("users/%s/", userID)
+// DeletePrefix deletes all objects under prefix
+func (m *s3Store) DeletePrefix(ctx context.Context, prefix string) error {
 	var toDelete []types.ObjectIdentifier
 	var continuationToken *string
 
 	for {
 		input := &s3.ListObjectsV2Input{
-			Bucket:            aws.String(config.Bucket),
+			Bucket:            aws.String(m.config.Bucket),
 			Prefix:            aws.String(prefix),
 			ContinuationToken: continuationToken,
 		}
-		output, err := client.ListObjectsV2(ctx, input)
+		output, err := m.client.ListObjectsV2(ctx, input)
 		if err != nil {
-			return fmt.Errorf("failed to list objects for user %s: %w", userID, err)
+			return fmt.Errorf("failed to list objects: %w", err)
 		}
 
 		for _, obj := range output.Contents {
 			toDelete = append(toDelete, types.ObjectIdentifier{Key: obj.Key})
 			// Delete in batches of 1000 (S3 limit)
 			if len(toDelete) == 1000 {
-				_, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-					Bucket: aws.String(config.Bucket),
-					Delete: &types.Delete{Objects: toDelete},
-				})
-				if err != nil {
-					return fmt.Errorf("failed to delete objects for user %s: %w", userID, err)
+				if err := m.deleteObjects(ctx, toDelete); err != nil {
+					return err
 				}
 				toDelete = nil
 			}
@@ -360,15 +221,32 @@ func (m *S3Manager) DeleteAllUserObjects(ctx context.Context, userID string) err
 
 	// Delete any remaining objects
 	if len(toDelete) > 0 {
-		_, err := client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
-			Bucket: aws.String(config.Bucket),
-			Delete: &types.Delete{Objects: toDelete},
-		})
-		if err != nil {
-			return fmt.Errorf("failed to delete objects for user %s: %w", userID, err)
+		return m.deleteObjects(ctx, toDelete)
+	}
+	return nil
+}
+
+// deleteObjects removes a batch of objects. GCS has no multi-object delete, so objects are removed one by one there.
+func (m *s3Store) deleteObjects(ctx context.Context, objects []types.ObjectIdentifier) error {
+	if m.backend == storageBackendGCS {
+		for _, obj := range objects {
+			_, err := m.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(m.config.Bucket),
+				Key:    obj.Key,
+			})
+			if err != nil {
+				return fmt.Errorf("failed to delete object %s: %w", aws.ToString(obj.Key), err)
+			}
 		}
+		return nil
 	}
 
-	log.Info().Str("userID", userID).Msg("all user files removed from S3")
+	_, err := m.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+		Bucket: aws.String(m.config.Bucket),
+		Delete: &types.Delete{Objects: objects},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete objects: %w", err)
+	}
 	return nil
 }
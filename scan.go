@@ -0,0 +1,298 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// errCodeMediaBlocked is returned when media is rejected by the virus scanner
+	errCodeMediaBlocked = "MEDIA_BLOCKED"
+	// errCodeMediaScanFailed is returned when the scanner is unreachable and MEDIA_SCAN_FAIL_OPEN is not set
+	errCodeMediaScanFailed = "MEDIA_SCAN_FAILED"
+
+	mediaScanTimeout = 30 * time.Second
+	clamdChunkSize   = 64 * 1024
+)
+
+// mediaScanner checks media content for malware
+type mediaScanner interface {
+	// Scan returns the detected signature, or "" when the content is clean
+	Scan(ctx context.Context, data []byte) (string, error)
+}
+
+var (
+	scanner        mediaScanner
+	scanFailOpen   bool
+	scannerAddress string
+)
+
+// initMediaScanner configures the optional scanner from MEDIA_SCAN_URL
+// (clamd://host:3310, unix:///run/clamav/clamd.ctl or icap://host:1344/avscan)
+func initMediaScanner() error {
+	raw := os.Getenv("MEDIA_SCAN_URL")
+	if raw == "" {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("invalid MEDIA_SCAN_URL: %w", err)
+	}
+
+	switch u.Scheme {
+	case "clamd", "tcp":
+		scanner = &clamdScanner{network: "tcp", address: u.Host}
+	case "unix":
+		scanner = &clamdScanner{network: "unix", address: u.Path}
+	case "icap":
+		host := u.Host
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "1344")
+		}
+		scanner = &icapScanner{host: host, service: raw}
+	default:
+		return fmt.Errorf("unsupported MEDIA_SCAN_URL scheme: %s", u.Scheme)
+	}
+
+	scanFailOpen, _ = strconv.ParseBool(os.Getenv("MEDIA_SCAN_FAIL_OPEN"))
+	scannerAddress = u.Redacted()
+	log.Info().Str("scanner", scannerAddress).Bool("failOpen", scanFailOpen).Msg("Media scanning enabled")
+	return nil
+}
+
+// scanMedia runs the configured scanner. It returns the signature of detected
+// malware, or a non-nil error when the content could not be scanned and the
+// scanner is configured to fail closed.
+func scanMedia(ctx context.Context, data []byte) (string, error) {
+	if scanner == nil || len(data) == 0 {
+		return "", nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mediaScanTimeout)
+	defer cancel()
+
+	signature, err := scanner.Scan(ctx, data)
+	if err != nil {
+		log.Error().Err(err).Str("scanner", scannerAddress).Msg("Media scan failed")
+		if scanFailOpen {
+			return "", nil
+		}
+		return "", err
+	}
+	return signature, nil
+}
+
+// emitMediaBlocked notifies the user that media was rejected by the scanner
+func emitMediaBlocked(userID string, event map[string]interface{}) {
+	mycli := clientManager.GetMyClient(userID)
+	if mycli == nil {
+		return
+	}
+
+	postmap := map[string]interface{}{
+		"type":  "MediaBlocked",
+		"event": event,
+	}
+	sendEventWithWebHook(mycli, postmap, "")
+}
+
+// checkMedia scans media passing through the API. It responds and returns false
+// when the content must not be sent or delivered.
+func (s *server) checkMedia(w http.ResponseWriter, r *http.Request, direction string, chatID int64, fileName string, data []byte) bool {
+	signature, err := scanMedia(r.Context(), data)
+	if err != nil {
+		s.Respond(w, r, http.StatusServiceUnavailable, map[string]interface{}{
+			"success": false,
+			"error":   "media scan failed",
+			"code":    errCodeMediaScanFailed,
+		})
+		return false
+	}
+	if signature == "" {
+		return true
+	}
+
+	txtid := r.Context().Value("userinfo").(Values).Get("Id")
+	log.Warn().Str("userID", txtid).Str("direction", direction).Str("signature", signature).Msg("Media blocked by scanner")
+
+	emitMediaBlocked(txtid, map[string]interface{}{
+		"direction": direction,
+		"chatId":    chatID,
+		"fileName":  fileName,
+		"size":      len(data),
+		"checksum":  mediaChecksum(data),
+		"signature": signature,
+	})
+
+	s.Respond(w, r, http.StatusUnprocessableEntity, map[string]interface{}{
+		"success":   false,
+		"error":     "media blocked by virus scan",
+		"code":      errCodeMediaBlocked,
+		"signature": signature,
+	})
+	return false
+}
+
+// clamdScanner talks to clamd using the INSTREAM command
+type clamdScanner struct {
+	network string
+	address string
+}
+
+func (c *clamdScanner) Scan(ctx context.Context, data []byte) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", err
+	}
+
+	size := make([]byte, 4)
+	for off := 0; off < len(data); off += clamdChunkSize {
+		chunk := data[off:min(off+clamdChunkSize, len(data))]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		if _, err := conn.Write(size); err != nil {
+			return "", err
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return "", err
+		}
+	}
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return "", err
+	}
+
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		return "", err
+	}
+	result := strings.TrimSpace(strings.TrimRight(string(reply), "\x00"))
+
+	// Replies look like "stream: OK", "stream: Eicar-Signature FOUND" or "... ERROR"
+	switch {
+	case strings.HasSuffix(result, " OK"):
+		return "", nil
+	case strings.HasSuffix(result, " FOUND"):
+		return strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(result, "stream:"), "FOUND")), nil
+	default:
+		return "", fmt.Errorf("clamd: %s", result)
+	}
+}
+
+// icapScanner submits media to an ICAP antivirus service with RESPMOD
+type icapScanner struct {
+	host    string
+	service string
+}
+
+func (i *icapScanner) Scan(ctx context.Context, data []byte) (string, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", i.host)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	resHdr := fmt.Sprintf("HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nContent-Length: %d\r\n\r\n", len(data))
+
+	var req bytes.Buffer
+	fmt.Fprintf(&req, "RESPMOD %s ICAP/1.0\r\n", i.service)
+	fmt.Fprintf(&req, "Host: %s\r\n", i.host)
+	req.WriteString("Allow: 204\r\n")
+	fmt.Fprintf(&req, "Encapsulated: res-hdr=0, res-body=%d\r\n\r\n", len(resHdr))
+	req.WriteString(resHdr)
+	fmt.Fprintf(&req, "%x\r\n", len(data))
+	req.Write(data)
+	req.WriteString("\r\n0\r\n\r\n")
+
+	if _, err := conn.Write(req.Bytes()); err != nil {
+		return "", err
+	}
+
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(status)
+	if len(fields) < 2 || !strings.HasPrefix(fields[0], "ICAP/") {
+		return "", fmt.Errorf("icap: invalid status line %q", strings.TrimSpace(status))
+	}
+	code, _ := strconv.Atoi(fields[1])
+
+	headers := map[string]string{}
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if k, v, ok := strings.Cut(line, ":"); ok {
+			headers[strings.ToLower(strings.TrimSpace(k))] = strings.TrimSpace(v)
+		}
+	}
+
+	switch {
+	case code == http.StatusNoContent:
+		return "", nil
+	case code != http.StatusOK:
+		return "", fmt.Errorf("icap: %s", strings.TrimSpace(status))
+	}
+
+	for _, h := range []string{"x-infection-found", "x-virus-id", "x-violations-found"} {
+		if v := headers[h]; v != "" {
+			return icapSignature(v), nil
+		}
+	}
+
+	// Without detection headers, a modified response with an error status means the content was blocked
+	httpStatus, err := reader.ReadString('\n')
+	if err != nil {
+		return "", nil
+	}
+	if f := strings.Fields(httpStatus); len(f) >= 2 {
+		if n, _ := strconv.Atoi(f[1]); n >= 400 {
+			return "unknown", nil
+		}
+	}
+	return "", nil
+}
+
+// icapSignature extracts the threat name from an X-Infection-Found style header
+func icapSignature(v string) string {
+	for _, part := range strings.Split(v, ";") {
+		if k, val, ok := strings.Cut(strings.TrimSpace(part), "="); ok && strings.EqualFold(k, "Threat") {
+			return val
+		}
+	}
+	return v
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+
+	"maxapi/api"
+	"maxapi/handlers/chat"
+)
+
+const (
+	schedulePollInterval = 10 * time.Second
+	scheduleSendSpacing  = 1 * time.Second
+	scheduleBatchSize    = 100
+	scheduleMaxAttempts  = 10
+	scheduleBaseDelay    = 30 * time.Second
+	scheduleMaxBackoff   = 1 * time.Hour
+
+	// maxScheduleAhead bounds how far in the future a message can be scheduled
+	maxScheduleAhead = 365 * 24 * time.Hour
+
+	scheduleStatusPending  = "pending"
+	scheduleStatusSent     = "sent"
+	scheduleStatusFailed   = "failed"
+	scheduleStatusCanceled = "canceled"
+)
+
+// ScheduledMessage is a text message that is sent at a set time
+type ScheduledMessage struct {
+	ID            int64           `json:"id" db:"id"`
+	UserID        string          `json:"-" db:"user_id"`
+	Body          string          `json:"-" db:"body"`
+	Message       json.RawMessage `json:"message" swaggertype:"object"`
+	SendAt        int64           `json:"sendAt" db:"send_at"`
+	Status        string          `json:"status" db:"status"`
+	Attempts      int             `json:"attempts" db:"attempts"`
+	NextAttemptAt int64           `json:"nextAttemptAt,omitempty" db:"next_attempt_at"`
+	MessageID     string          `json:"messageId,omitempty" db:"message_id"`
+	LastError     string          `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt     int64           `json:"createdAt" db:"created_at"`
+	SentAt        int64           `json:"sentAt,omitempty" db:"sent_at"`
+}
+
+// scheduledColumns are read for every scheduled message
+const scheduledColumns = "id, user_id, body, send_at, status, attempts, next_attempt_at, message_id, last_error, created_at, sent_at"
+
+// prepare fills the fields that are only part of the JSON form
+func (m *ScheduledMessage) prepare() {
+	m.Message = json.RawMessage(m.Body)
+	if m.Status != scheduleStatusPending {
+		m.NextAttemptAt = 0
+	}
+}
+
+// getScheduled loads a scheduled message of a user
+func (s *server) getScheduled(userID string, id int64) (*ScheduledMessage, error) {
+	var msg ScheduledMessage
+	err := s.db.Get(&msg, "SELECT "+scheduledColumns+" FROM scheduled_messages WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return nil, err
+	}
+	msg.prepare()
+	return &msg, nil
+}
+
+// startScheduler periodically sends scheduled messages that are due and applies
+// the connection windows. Messages that came due while the server was down are
+// sent on the first pass.
+func (s *server) startScheduler() {
+	go func() {
+		ticker := time.NewTicker(schedulePollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.applyConnectionWindows()
+
+			// Scheduled messages wait until maintenance mode ends
+			if !inMaintenance() {
+				s.dispatchScheduled()
+			}
+		}
+	}()
+}
+
+func (s *server) dispatchScheduled() {
+	var due []struct {
+		ScheduledMessage
+		Token string `db:"token"`
+	}
+	err := s.db.Select(&due, `SELECT m.id, m.user_id, m.body, m.send_at, m.status, m.attempts, m.next_attempt_at,
+			m.message_id, m.last_error, m.created_at, m.sent_at, u.token
+		FROM scheduled_messages m JOIN users u ON u.id = m.user_id
+		WHERE m.status = $1 AND m.next_attempt_at <= $2 ORDER BY m.next_attempt_at, m.id LIMIT $3`,
+		scheduleStatusPending, time.Now().Unix(), scheduleBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load scheduled messages")
+		return
+	}
+
+	for _, msg := range due {
+		// Messages of a restricted account wait until sending is resumed
+		if s.accountRestriction(msg.UserID) != nil {
+			s.db.Exec("UPDATE scheduled_messages SET next_attempt_at=$1 WHERE id=$2", time.Now().Add(restrictionRetryInterval).Unix(), msg.ID)
+			continue
+		}
+
+		// A message that comes due in quiet hours waits for their end, unless it is urgent
+		var body chat.MessageBody
+		json.Unmarshal([]byte(msg.Body), &body)
+		if !body.Urgent {
+			if until, quiet := s.quietHoursUntil(msg.UserID, time.Now()); quiet {
+				s.db.Exec("UPDATE scheduled_messages SET next_attempt_at=$1 WHERE id=$2", until.Unix(), msg.ID)
+				continue
+			}
+		}
+		if until, capped := s.warmupUntil(msg.UserID, time.Now()); capped {
+			s.db.Exec("UPDATE scheduled_messages SET next_attempt_at=$1 WHERE id=$2", until.Unix(), msg.ID)
+			continue
+		}
+
+		rec := s.InternalSend(msg.Token, "/chat/send/text", msg.Body)
+
+		var reply struct {
+			MessageID json.RawMessage `json:"messageId"`
+			Error     string          `json:"error"`
+		}
+		json.Unmarshal(rec.Body.Bytes(), &reply)
+		if reply.Error == "" {
+			reply.Error = fmt.Sprintf("status %d", rec.Code)
+		}
+		attempts := msg.Attempts + 1
+
+		switch {
+		case rec.Code < 300:
+			log.Info().Str("userID", msg.UserID).Int64("id", msg.ID).Msg("Scheduled message sent")
+			s.db.Exec("UPDATE scheduled_messages SET status=$1, attempts=$2, message_id=$3, sent_at=$4 WHERE id=$5",
+				scheduleStatusSent, attempts, strings.Trim(string(reply.MessageID), `"`), time.Now().Unix(), msg.ID)
+		case rec.Code >= 500 && attempts < scheduleMaxAttempts:
+			// Not connected or MAX-side failure, try again later
+			backoff := scheduleBaseDelay << uint(msg.Attempts)
+			if backoff > scheduleMaxBackoff {
+				backoff = scheduleMaxBackoff
+			}
+			log.Warn().Str("userID", msg.UserID).Int64("id", msg.ID).Int("status", rec.Code).Dur("retryIn", backoff).Msg("Scheduled message failed, will retry")
+			s.db.Exec("UPDATE scheduled_messages SET attempts=$1, last_error=$2, next_attempt_at=$3 WHERE id=$4",
+				attempts, reply.Error, time.Now().Add(backoff).Unix(), msg.ID)
+		default:
+			log.Error().Str("userID", msg.UserID).Int64("id", msg.ID).Int("status", rec.Code).Str("error", reply.Error).Msg("Scheduled message failed")
+			s.db.Exec("UPDATE scheduled_messages SET status=$1, attempts=$2, last_error=$3 WHERE id=$4",
+				scheduleStatusFailed, attempts, reply.Error, msg.ID)
+		}
+
+		time.Sleep(scheduleSendSpacing)
+	}
+}
+
+// ========== SCHEDULED MESSAGE ENDPOINTS ==========
+
+// ScheduleMessage schedules a text message
+// @Summary Schedule message
+// @Description Stores a text message, with the same fields as /chat/send/text, and sends it at sendAt (Unix seconds, at most a year ahead). Scheduled messages are kept in the database and survive restarts; messages that came due while the server was down are sent when it is back. Sends that fail because the instance is not connected or MAX fails are retried with backoff up to 10 times. A message that comes due in quiet hours is sent when they end, unless it is urgent.
+// @Tags Chat
+// @Accept json
+// @Produce json
+// @Param request body ScheduleMessageBody true "Message and send time"
+// @Success 200 {object} ScheduledMessageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/schedule [post]
+func (s *server) ScheduleMessage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg ScheduleMessageBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		now := time.Now()
+		if msg.SendAt <= now.Unix() {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("sendAt must be in the future"))
+			return
+		}
+		if msg.SendAt > now.Add(maxScheduleAhead).Unix() {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("sendAt must be within a year"))
+			return
+		}
+		if msg.Text == "" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("text is required"))
+			return
+		}
+		// Formatting errors are reported now rather than when the message is due
+		if _, _, err := formatText(msg.Text, msg.Format, msg.Elements); err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		body, _ := json.Marshal(msg.MessageBody)
+		var id int64
+		err := s.db.QueryRow(`INSERT INTO scheduled_messages (user_id, body, send_at, status, next_attempt_at, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`,
+			txtid, string(body), msg.SendAt, scheduleStatusPending, msg.SendAt, now.Unix()).Scan(&id)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, fmt.Errorf("failed to schedule message: %w", err))
+			return
+		}
+		log.Info().Str("userID", txtid).Int64("id", id).Int64("sendAt", msg.SendAt).Msg("Message scheduled")
+
+		scheduled, err := s.getScheduled(txtid, id)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"scheduled": scheduled,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ListScheduled lists scheduled messages
+// @Summary List scheduled messages
+// @Description Returns the scheduled messages of the instance, by send time. Sent, failed and canceled messages are kept with their outcome.
+// @Tags Chat
+// @Produce json
+// @Param status query string false "Only messages with this status" Enums(pending, sent, failed, canceled)
+// @Param limit query int false "Page size, 1-500"
+// @Param cursor query string false "Cursor of the page, from nextCursor"
+// @Param sort query string false "sendAt or createdAt, - for descending"
+// @Param fields query string false "Comma-separated fields to return per message"
+// @Success 200 {object} ScheduledListResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/schedule [get]
+func (s *server) ListScheduled() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		q, err := api.ParseListQuery(r, api.ListOptions{MaxLimit: 500, Sorts: []string{"sendAt", "createdAt"}})
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		query := "SELECT " + scheduledColumns + " FROM scheduled_messages WHERE user_id=$1"
+		args := []interface{}{txtid}
+		if status := r.URL.Query().Get("status"); status != "" {
+			switch status {
+			case scheduleStatusPending, scheduleStatusSent, scheduleStatusFailed, scheduleStatusCanceled:
+			default:
+				s.Respond(w, r, http.StatusBadRequest, errors.New("status must be pending, sent, failed or canceled"))
+				return
+			}
+			query += " AND status=$2"
+			args = append(args, status)
+		}
+
+		// The sort field is one of the allowed columns, so it can go into the query
+		dir := "ASC"
+		if q.Desc {
+			dir = "DESC"
+		}
+		column := "send_at"
+		if q.Sort == "createdAt" {
+			column = "created_at"
+		}
+		query += " ORDER BY " + column + " " + dir + ", id " + dir
+		if q.Limit > 0 {
+			// One extra row tells whether there is a next page
+			query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
+			args = append(args, q.Limit+1, q.Cursor.Offset)
+		}
+
+		messages := []ScheduledMessage{}
+		if err := s.db.Select(&messages, query, args...); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		next := ""
+		if q.Limit > 0 && len(messages) > q.Limit {
+			messages = messages[:q.Limit]
+			next = api.ListCursor{Offset: q.Cursor.Offset + q.Limit}.Encode()
+		}
+		for i := range messages {
+			messages[i].prepare()
+		}
+		api.SetNextCursor(w, next)
+
+		response := map[string]interface{}{
+			"success":    true,
+			"scheduled":  q.SelectFields(messages),
+			"nextCursor": next,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// GetScheduled returns a scheduled message
+// @Summary Get scheduled message
+// @Description Returns a scheduled message with its status and, once sent, the MAX message ID
+// @Tags Chat
+// @Produce json
+// @Param id path int true "Scheduled message ID"
+// @Success 200 {object} ScheduledMessageResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /chat/schedule/{id} [get]
+func (s *server) GetScheduled() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		scheduled, err := s.getScheduled(txtid, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.Respond(w, r, http.StatusNotFound, errors.New("scheduled message not found"))
+			return
+		}
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"scheduled": scheduled,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// CancelScheduled cancels a scheduled message
+// @Summary Cancel scheduled message
+// @Description Cancels a scheduled message that has not been sent yet. The message is kept with status canceled.
+// @Tags Chat
+// @Produce json
+// @Param id path int true "Scheduled message ID"
+// @Success 200 {object} ScheduledMessageResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse "Already sent, failed or canceled"
+// @Security ApiKeyAuth
+// @Router /chat/schedule/{id} [delete]
+func (s *server) CancelScheduled() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+		res, err := s.db.Exec("UPDATE scheduled_messages SET status=$1 WHERE id=$2 AND user_id=$3 AND status=$4",
+			scheduleStatusCanceled, id, txtid, scheduleStatusPending)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		scheduled, err := s.getScheduled(txtid, id)
+		if errors.Is(err, sql.ErrNoRows) {
+			s.Respond(w, r, http.StatusNotFound, errors.New("scheduled message not found"))
+			return
+		}
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			s.Respond(w, r, http.StatusConflict, fmt.Errorf("scheduled message is already %s", scheduled.Status))
+			return
+		}
+		log.Info().Str("userID", txtid).Int64("id", id).Msg("Scheduled message canceled")
+
+		response := map[string]interface{}{
+			"success":   true,
+			"scheduled": scheduled,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
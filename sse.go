@@ -0,0 +1,184 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultEventBufferSize      = 500
+	defaultEventBufferRetention = 10 // minutes
+	sseRetryMs                  = 3000
+	sseHeartbeatInterval        = 15 * time.Second
+)
+
+var (
+	// eventBufferSize is the number of recent events kept per user for SSE resume (0 disables resume)
+	eventBufferSize = defaultEventBufferSize
+	// eventBufferRetention is how long a buffer is kept after the last SSE stream of its user closed
+	eventBufferRetention = defaultEventBufferRetention * time.Minute
+)
+
+// bufferedEvent is an event kept for SSE streams resuming with Last-Event-ID
+type bufferedEvent struct {
+	streamEvent
+	eventType string
+}
+
+// eventBuffer is a ring of the most recent events of a user. Buffers are created
+// by the first SSE stream of a user, so only users consuming SSE are buffered.
+type eventBuffer struct {
+	events    []bufferedEvent
+	next      int
+	since     int64 // events up to this id are not in the buffer
+	idleSince time.Time
+}
+
+// initEventBuffers reads the SSE resume settings and starts expiring unused buffers
+func initEventBuffers() {
+	eventBufferSize = envInt("EVENT_BUFFER_SIZE", defaultEventBufferSize)
+	if minutes := envInt("EVENT_BUFFER_RETENTION_MINUTES", defaultEventBufferRetention); minutes > 0 {
+		eventBufferRetention = time.Duration(minutes) * time.Minute
+	}
+	go eventStreams.expireBuffers()
+}
+
+func (b *eventBuffer) add(ev bufferedEvent) {
+	if len(b.events) < eventBufferSize {
+		b.events = append(b.events, ev)
+		return
+	}
+	b.since = b.events[b.next].id
+	b.events[b.next] = ev
+	b.next = (b.next + 1) % len(b.events)
+}
+
+// after returns the buffered events with an id above lastID, oldest first, and
+// whether the buffer holds every event since lastID
+func (b *eventBuffer) after(lastID int64) ([]bufferedEvent, bool) {
+	if lastID == 0 {
+		return nil, true
+	}
+
+	events := []bufferedEvent{}
+	for i := range b.events {
+		ev := b.events[(b.next+i)%len(b.events)]
+		if ev.id > lastID {
+			events = append(events, ev)
+		}
+	}
+	return events, lastID >= b.since
+}
+
+// GetEventStream streams the user's events as Server-Sent Events
+// @Summary Server-Sent Events stream
+// @Description Streams the same event payloads as the webhook as text/event-stream, one "data:" line per event with an "id:" line. After a reconnect with the Last-Event-ID header (or the lastEventId query parameter), the events missed in between are sent first from the buffer of recent events. When the buffer no longer has all of them, a StreamGap event is sent before the buffered ones. The events query parameter (comma separated) limits the stream to some event types.
+// @Tags Webhook
+// @Produce text/event-stream
+// @Param token query string false "User token"
+// @Param events query string false "Comma separated event types (default All)"
+// @Param lastEventId query string false "Resume after this event id (instead of the Last-Event-ID header)"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 429 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /events/stream [get]
+func (s *server) GetEventStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		events, err := parseStreamEvents(strings.Split(r.URL.Query().Get("events"), ","))
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		lastID := r.Header.Get("Last-Event-ID")
+		if lastID == "" {
+			lastID = r.URL.Query().Get("lastEventId")
+		}
+		var lastEventID int64
+		if lastID != "" {
+			if lastEventID, err = strconv.ParseInt(lastID, 10, 64); err != nil || lastEventID < 0 {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID %q", lastID))
+				return
+			}
+		}
+
+		rc := http.NewResponseController(w)
+		st := &eventStream{
+			userID: txtid,
+			send:   make(chan streamEvent, streamSendBuffer),
+			done:   make(chan struct{}),
+			events: events,
+		}
+		missed, complete, err := eventStreams.add(st, true, lastEventID)
+		if err != nil {
+			s.Respond(w, r, http.StatusTooManyRequests, err)
+			return
+		}
+		defer eventStreams.remove(st)
+
+		// The stream outlives the server write timeout; each write sets its own deadline
+		rc.SetWriteDeadline(time.Time{})
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		write := func(format string, args ...interface{}) error {
+			rc.SetWriteDeadline(time.Now().Add(streamWriteWait))
+			if _, err := fmt.Fprintf(w, format, args...); err != nil {
+				return err
+			}
+			return rc.Flush()
+		}
+		writeEvent := func(ev streamEvent) error {
+			return write("id: %d\ndata: %s\n\n", ev.id, ev.data)
+		}
+
+		if write("retry: %d\n\n", sseRetryMs) != nil {
+			return
+		}
+		if !complete {
+			if write("data: {\"type\":\"StreamGap\",\"lastEventId\":%d}\n\n", lastEventID) != nil {
+				return
+			}
+		}
+		for _, ev := range missed {
+			if st.subscribed(ev.eventType) && writeEvent(ev.streamEvent) != nil {
+				return
+			}
+		}
+
+		log.Info().Str("userID", txtid).Strs("events", events).Int("resumed", len(missed)).Msg("SSE stream opened")
+
+		heartbeat := time.NewTicker(sseHeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				log.Info().Str("userID", txtid).Int64("dropped", st.dropped.Load()).Msg("SSE stream closed")
+				return
+			case <-st.done:
+				return
+			case ev := <-st.send:
+				if writeEvent(ev) != nil {
+					return
+				}
+			case <-heartbeat.C:
+				if write(": ping\n\n") != nil {
+					return
+				}
+			}
+		}
+	}
+}
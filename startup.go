@@ -0,0 +1,171 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/rs/zerolog/log"
+)
+
+// lazyConnectWait bounds how long an API request waits for a lazy instance to connect
+const lazyConnectWait = 15 * time.Second
+
+// startupSlots limits concurrent MAX logins when -maxconcurrentstartups is set
+var startupSlots chan struct{}
+
+func initStartupSlots(n int) {
+	if n > 0 {
+		startupSlots = make(chan struct{}, n)
+	}
+}
+
+func acquireStartupSlot() {
+	if startupSlots != nil {
+		startupSlots <- struct{}{}
+	}
+}
+
+func releaseStartupSlot() {
+	if startupSlots != nil {
+		<-startupSlots
+	}
+}
+
+// lazyStarts holds the client start of instances that connect on first use
+var lazyStarts = struct {
+	sync.Mutex
+	starts map[string]func()
+}{starts: make(map[string]func())}
+
+// deferStartups registers instances to be connected on first use
+func (s *server) deferStartups(starts map[string]func()) {
+	lazyStarts.Lock()
+	for userID, start := range starts {
+		lazyStarts.starts[userID] = start
+	}
+	pending := len(lazyStarts.starts)
+	lazyStarts.Unlock()
+
+	if len(starts) > 0 {
+		if _, err := s.db.Exec("UPDATE users SET connected=0 WHERE auth_token IS NOT NULL AND auth_token != ''"); err != nil {
+			log.Error().Err(err).Msg("Failed to update connected status")
+		}
+	}
+	log.Info().Int("instances", pending).Msg("Lazy connect enabled, instances connect on first use")
+}
+
+// hasDeferred reports whether an instance is waiting for its first use
+func hasDeferred(userID string) bool {
+	lazyStarts.Lock()
+	defer lazyStarts.Unlock()
+	_, ok := lazyStarts.starts[userID]
+	return ok
+}
+
+// startDeferred starts the client of a lazy instance. It returns false when the
+// instance has no pending start.
+func startDeferred(userID string) bool {
+	lazyStarts.Lock()
+	start, ok := lazyStarts.starts[userID]
+	delete(lazyStarts.starts, userID)
+	lazyStarts.Unlock()
+
+	if ok {
+		log.Info().Str("userID", userID).Msg("Connecting lazy instance")
+		start()
+	}
+	return ok
+}
+
+// loginWaiters are closed when the next login attempt of an instance finishes
+var loginWaiters = struct {
+	sync.Mutex
+	waiters map[string]chan struct{}
+}{waiters: make(map[string]chan struct{})}
+
+// awaitLogin returns a channel that is closed when the next login of the instance finishes
+func awaitLogin(userID string) <-chan struct{} {
+	loginWaiters.Lock()
+	defer loginWaiters.Unlock()
+
+	ch, ok := loginWaiters.waiters[userID]
+	if !ok {
+		ch = make(chan struct{})
+		loginWaiters.waiters[userID] = ch
+	}
+	return ch
+}
+
+// loginFinished releases the requests waiting for a login, whatever its outcome
+func loginFinished(userID string) {
+	loginWaiters.Lock()
+	defer loginWaiters.Unlock()
+
+	if ch, ok := loginWaiters.waiters[userID]; ok {
+		close(ch)
+		delete(loginWaiters.waiters, userID)
+	}
+}
+
+// dropDeferred forgets the pending start of an instance that was connected or deleted otherwise
+func dropDeferred(userID string) {
+	lazyStarts.Lock()
+	delete(lazyStarts.starts, userID)
+	lazyStarts.Unlock()
+}
+
+// lazyConnectHandler connects a lazy instance before its first API request is handled
+func (s *server) lazyConnectHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Session endpoints manage the connection themselves
+		if *lazyConnect && !strings.HasPrefix(r.URL.Path, "/session/") {
+			txtid := r.Context().Value("userinfo").(Values).Get("Id")
+			if hasDeferred(txtid) {
+				done := awaitLogin(txtid)
+				startDeferred(txtid)
+				select {
+				case <-done:
+				case <-time.After(lazyConnectWait):
+				}
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ConnectInstance connects a lazy instance on demand
+// @Summary Connect instance
+// @Description Starts the MAX connection of an instance that is waiting for its first use in lazy connect mode
+// @Tags Admin
+// @Produce json
+// @Param userid path string true "User ID"
+// @Success 202 {object} api.MessageResponse
+// @Failure 404 {object} api.ErrorResponse
+// @Failure 409 {object} api.ErrorResponse
+// @Security AdminAuth
+// @Router /admin/users/{userid}/connect [post]
+func (s *server) ConnectInstance() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID := mux.Vars(r)["userid"]
+
+		if clientManager.GetMaxClient(userID) != nil {
+			s.Respond(w, r, http.StatusConflict, errors.New("already connected"))
+			return
+		}
+		if !startDeferred(userID) {
+			s.Respond(w, r, http.StatusNotFound, errors.New("no pending connection for this user"))
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"message": "Connecting to MAX",
+		}
+
+		s.Respond(w, r, http.StatusAccepted, response)
+	}
+}
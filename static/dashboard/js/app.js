@@ -538,7 +538,7 @@ document.addEventListener('DOMContentLoaded', function () {
 async function addInstance(data) {
     console.log('Add Instance...');
     const admintoken = getLocalStorageItem('admintoken');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('authorization', admintoken);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -798,7 +798,7 @@ function deleteInstance(id) {
 async function performDelete(id) {
     console.log('Deleting instance with ID:', id);
     const admintoken = getLocalStorageItem('admintoken');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('authorization', admintoken);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/admin/users/' + id, {
@@ -852,7 +852,7 @@ async function sendTextMessage() {
     const token = getLocalStorageItem('token');
     const sendPhone = document.getElementById('messagesendphone').value.trim();
     const sendBody = document.getElementById('messagesendtext').value;
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     const uuid = generateMessageUUID();
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
@@ -870,7 +870,7 @@ async function deleteMessage() {
         .getElementById('messagedeletephone')
         .value.trim();
     const deleteId = document.getElementById('messagedeleteid').value;
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/chat/delete', {
@@ -890,7 +890,7 @@ async function setWebhook() {
         events.length = 0;
         events.push('All');
     }
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/webhook', {
@@ -993,7 +993,7 @@ async function connect(token = '') {
     }
 
     // First check if user is authenticated
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1038,7 +1038,7 @@ async function disconnect(token) {
     if (token == '') {
         token = getLocalStorageItem('token');
     }
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/session/disconnect', {
@@ -1052,7 +1052,7 @@ async function disconnect(token) {
 async function status() {
     console.log('Get status...');
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/session/status', {
@@ -1067,7 +1067,7 @@ async function status() {
 async function getUsers() {
     console.log('Get users...');
     const admintoken = getLocalStorageItem('admintoken');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('authorization', admintoken);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/admin/users', {
@@ -1083,7 +1083,7 @@ async function getWebhook(token = '') {
     if (token == '') {
         token = getLocalStorageItem('token');
     }
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     try {
@@ -1102,7 +1102,7 @@ async function getWebhook(token = '') {
 async function getContacts() {
     console.log('Getting contacts...');
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     try {
@@ -1133,7 +1133,7 @@ async function getContacts() {
 async function userAvatar(phone) {
     console.log('Requesting user avatar...');
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/user/avatar', {
@@ -1148,7 +1148,7 @@ async function userAvatar(phone) {
 async function userInfo(phone) {
     console.log('Requesting user info...');
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/user/info', {
@@ -1166,7 +1166,7 @@ let tempToken = '';
 async function requestSMSCode(phone) {
     console.log('Requesting SMS code for:', phone);
     const token = smsLoginToken || getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1198,7 +1198,7 @@ async function requestSMSCode(phone) {
 async function confirmSMSCode(code) {
     console.log('Confirming SMS code:', code);
     const token = smsLoginToken || getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1256,7 +1256,7 @@ async function confirmSMSCode(code) {
 async function completeRegistration(firstName, lastName) {
     console.log('Completing registration:', firstName, lastName);
     const token = smsLoginToken || getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1308,7 +1308,7 @@ async function logout(token = '') {
     if (token == '') {
         token = getLocalStorageItem('token');
     }
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     res = await fetch(baseUrl + '/session/logout', {
@@ -1322,7 +1322,7 @@ async function logout(token = '') {
 // getQr function removed - MAX uses SMS authentication instead of QR codes
 
 async function statusRequest() {
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     const token = getLocalStorageItem('token');
     const isAdminLogin = getLocalStorageItem('isAdmin');
     if (token != null && isAdminLogin == null) {
@@ -1732,7 +1732,7 @@ async function loadS3Config() {
 
     // Fallback to API call for regular users or when instance data is not available
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
 
     try {
@@ -1797,7 +1797,7 @@ async function loadS3Config() {
 
 async function saveS3Config() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1841,7 +1841,7 @@ async function saveS3Config() {
 
 async function testS3Connection() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
 
     // Show loading state
@@ -1880,7 +1880,7 @@ async function deleteS3Config() {
     }
 
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
 
     // Show loading state
@@ -1928,7 +1928,7 @@ async function deleteS3Config() {
 // History Configuration Functions
 async function loadHistoryConfig() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
 
     try {
@@ -1954,7 +1954,7 @@ async function loadHistoryConfig() {
 
 async function saveHistoryConfig() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1990,7 +1990,7 @@ async function saveHistoryConfig() {
 // Proxy Configuration Functions
 async function loadProxyConfig() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
 
     try {
@@ -2037,7 +2037,7 @@ async function loadProxyConfig() {
 
 async function saveProxyConfig() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
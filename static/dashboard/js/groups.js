@@ -55,7 +55,7 @@ function getGroupTypeInfo(groupData) {
 // API function to get contacts without automatic download
 async function getContactsForGroups() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
     try {
@@ -1045,7 +1045,7 @@ function extractInviteCode(input) {
 // API Functions
 async function getGroups() {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1059,7 +1059,7 @@ async function getGroups() {
 
 async function getGroupInfo(groupJID) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1080,7 +1080,7 @@ async function getGroupInfo(groupJID) {
 
 async function createGroupAPI(groupData) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1095,7 +1095,7 @@ async function createGroupAPI(groupData) {
 
 async function getGroupInviteInfo(code) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1110,7 +1110,7 @@ async function getGroupInviteInfo(code) {
 
 async function joinGroupAPI(code) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -1268,7 +1268,7 @@ async function getUserInfoAndSetJID() {
     try {
         // Try to get user info from status API to get the user ID
         const token = getLocalStorageItem('token');
-        const myHeaders = new Headers();
+        const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
         myHeaders.append('token', token);
         myHeaders.append('Content-Type', 'application/json');
 
@@ -2241,7 +2241,7 @@ function fileToBase64(file) {
 // API Functions for Group Management
 async function updateGroupName(groupJID, name) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2264,7 +2264,7 @@ async function updateGroupName(groupJID, name) {
 
 async function updateGroupTopic(groupJID, topic) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2287,7 +2287,7 @@ async function updateGroupTopic(groupJID, topic) {
 
 async function updateGroupAnnounce(groupJID, announce) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2310,7 +2310,7 @@ async function updateGroupAnnounce(groupJID, announce) {
 
 async function updateGroupLocked(groupjid, locked) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2333,7 +2333,7 @@ async function updateGroupLocked(groupjid, locked) {
 
 async function updateGroupEphemeral(groupjid, duration) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2356,7 +2356,7 @@ async function updateGroupEphemeral(groupjid, duration) {
 
 async function updateGroupParticipants(groupJID, action, participants) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2380,7 +2380,7 @@ async function updateGroupParticipants(groupJID, action, participants) {
 
 async function getGroupInviteLink(groupJID, reset = false) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2410,7 +2410,7 @@ async function getGroupInviteLink(groupJID, reset = false) {
 
 async function updateGroupPhoto(groupJID, photoBase64) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2497,7 +2497,7 @@ async function updateGroupPhoto(groupJID, photoBase64) {
 
 async function removeGroupPhotoAPI(groupjid) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -2519,7 +2519,7 @@ async function removeGroupPhotoAPI(groupjid) {
 
 async function leaveGroupAPI(groupJID) {
     const token = getLocalStorageItem('token');
-    const myHeaders = new Headers();
+    const myHeaders = new Headers({ 'X-MaxAPI-Envelope': 'legacy' });
     myHeaders.append('token', token);
     myHeaders.append('Content-Type', 'application/json');
 
@@ -0,0 +1,712 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Supported media storage backends
+const (
+	storageBackendS3    = "s3"
+	storageBackendGCS   = "gcs"
+	storageBackendAzure = "azure"
+	storageBackendLocal = "local"
+)
+
+var storageBackends = []string{storageBackendS3, storageBackendGCS, storageBackendAzure, storageBackendLocal}
+
+// BlobStore is a media storage backend
+type BlobStore interface {
+	// Backend returns the backend name
+	Backend() string
+	// Location returns the bucket, container or directory objects are written to
+	Location() string
+	// Put stores an object under key
+	Put(ctx context.Context, key string, data []byte, mimeType string) error
+	// URL returns the public URL of an object
+	URL(key string) string
+	// DeletePrefix removes every object whose key starts with prefix
+	DeletePrefix(ctx context.Context, prefix string) error
+	// Test verifies that the backend is reachable with the configured credentials
+	Test(ctx context.Context) error
+}
+
+// Presigner is implemented by stores that can mint short-lived signed GET URLs
+type Presigner interface {
+	Presign(ctx context.Context, key string, ttl time.Duration) (string, error)
+}
+
+// maxPresignTTL is the longest validity SigV4 presigned URLs support
+const maxPresignTTL = 7 * 24 * time.Hour
+
+// StorageConfig holds media storage configuration for a user
+type StorageConfig struct {
+	Enabled        bool
+	Backend        string
+	Endpoint       string
+	Region         string
+	Bucket         string
+	AccessKey      string
+	SecretKey      string
+	PathStyle      bool
+	PublicURL      string
+	MediaDelivery  string
+	RetentionDays  int
+	AzureAccount   string
+	AzureContainer string
+	AzureSASToken  string
+	PresignTTL     int
+}
+
+// newBlobStore creates the backend selected by config
+func newBlobStore(config *StorageConfig) (BlobStore, error) {
+	switch config.Backend {
+	case "", storageBackendS3:
+		return newS3Store(config), nil
+	case storageBackendGCS:
+		return newGCSStore(config), nil
+	case storageBackendAzure:
+		return newAzureStore(config)
+	case storageBackendLocal:
+		return newLocalStore(config), nil
+	}
+	return nil, fmt.Errorf("unsupported storage backend: %s", config.Backend)
+}
+
+// StorageManager keeps the media store of every user
+type StorageManager struct {
+	mu      sync.RWMutex
+	stores  map[string]BlobStore
+	configs map[string]*StorageConfig
+}
+
+// Global storage manager instance
+var storageManager = &StorageManager{
+	stores:  make(map[string]BlobStore),
+	configs: make(map[string]*StorageConfig),
+}
+
+// GetStorageManager returns the global storage manager instance
+func GetStorageManager() *StorageManager {
+	return storageManager
+}
+
+// InitializeStore creates or updates the media store for a user
+func (m *StorageManager) InitializeStore(userID string, config *StorageConfig) error {
+	if !config.Enabled {
+		m.RemoveStore(userID)
+		return nil
+	}
+
+	store, err := newBlobStore(config)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	m.stores[userID] = store
+	m.configs[userID] = config
+	m.mu.Unlock()
+
+	log.Info().Str("userID", userID).Str("backend", store.Backend()).Str("location", store.Location()).Msg("Media store initialized")
+	return nil
+}
+
+// RemoveStore removes the media store for a user
+func (m *StorageManager) RemoveStore(userID string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.stores, userID)
+	delete(m.configs, userID)
+}
+
+// GetStore returns the media store for a user
+func (m *StorageManager) GetStore(userID string) (BlobStore, *StorageConfig, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	store, storeOk := m.stores[userID]
+	config, configOk := m.configs[userID]
+
+	return store, config, storeOk && configOk
+}
+
+// distinctStores returns one store per backend, endpoint and location, so
+// users sharing a bucket are checked once
+func (m *StorageManager) distinctStores() []BlobStore {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	seen := map[string]bool{}
+	stores := []BlobStore{}
+	for userID, store := range m.stores {
+		key := store.Backend() + "|" + m.configs[userID].Endpoint + "|" + store.Location()
+		if !seen[key] {
+			seen[key] = true
+			stores = append(stores, store)
+		}
+	}
+	return stores
+}
+
+// ProcessMedia uploads media to the user's store and returns its metadata
+func (m *StorageManager) ProcessMedia(ctx context.Context, userID, contactJID, messageID string,
+	data []byte, mimeType string, fileName string, isIncoming bool) (map[string]interface{}, error) {
+
+	store, _, ok := m.GetStore(userID)
+	if !ok {
+		return nil, fmt.Errorf("media store not initialized for user %s", userID)
+	}
+
+	key := GenerateMediaKey(userID, contactJID, messageID, mimeType, isIncoming)
+
+	if err := store.Put(ctx, key, data, mimeType); err != nil {
+		return nil, fmt.Errorf("failed to upload to %s: %w", store.Backend(), err)
+	}
+
+	return m.DescribeMedia(ctx, userID, key, len(data), mimeType, fileName)
+}
+
+// DescribeMedia returns the metadata of an object already in the user's store
+func (m *StorageManager) DescribeMedia(ctx context.Context, userID, key string, size int, mimeType, fileName string) (map[string]interface{}, error) {
+	store, config, ok := m.GetStore(userID)
+	if !ok {
+		return nil, fmt.Errorf("media store not initialized for user %s", userID)
+	}
+
+	mediaData := map[string]interface{}{
+		"url":      store.URL(key),
+		"key":      key,
+		"backend":  store.Backend(),
+		"bucket":   store.Location(),
+		"size":     size,
+		"mimeType": mimeType,
+		"fileName": fileName,
+	}
+
+	// Private buckets get a short-lived signed link instead of the public URL
+	if presigner, ok := store.(Presigner); ok && config.PresignTTL > 0 {
+		ttl := time.Duration(config.PresignTTL) * time.Second
+		signed, err := presigner.Presign(ctx, key, ttl)
+		if err != nil {
+			return nil, fmt.Errorf("failed to presign URL: %w", err)
+		}
+		mediaData["url"] = signed
+		mediaData["expiresAt"] = time.Now().Add(ttl).Unix()
+	}
+
+	return mediaData, nil
+}
+
+// DeleteAllUserObjects deletes all user files from the user's store
+func (m *StorageManager) DeleteAllUserObjects(ctx context.Context, userID string) error {
+	store, _, ok := m.GetStore(userID)
+	if !ok {
+		return fmt.Errorf("media store not initialized for user %s", userID)
+	}
+
+	if err := store.DeletePrefix(ctx, fmt.Sprintf("users/%s/", userID)); err != nil {
+		return fmt.Errorf("failed to delete objects for user %s: %w", userID, err)
+	}
+
+	log.Info().Str("userID", userID).Str("backend", store.Backend()).Msg("all user files removed from media store")
+	return nil
+}
+
+// GenerateMediaKey generates the object key based on message metadata
+func GenerateMediaKey(userID, contactJID, messageID string, mimeType string, isIncoming bool) string {
+	// Determine direction
+	direction := "outbox"
+	if isIncoming {
+		direction = "inbox"
+	}
+
+	// Clean contact JID
+	contactJID = strings.ReplaceAll(contactJID, "@", "_")
+	contactJID = strings.ReplaceAll(contactJID, ":", "_")
+
+	// Get current time
+	now := time.Now()
+	year := now.Format("2025")
+	month := now.Format("05")
+	day := now.Format("25")
+
+	// Determine media type folder
+	mediaType := "documents"
+	if strings.HasPrefix(mimeType, "image/") {
+		mediaType = "images"
+	} else if strings.HasPrefix(mimeType, "video/") {
+		mediaType = "videos"
+	} else if strings.HasPrefix(mimeType, "audio/") {
+		mediaType = "audio"
+	}
+
+	// Get file extension
+	ext := ".bin"
+	switch {
+	case strings.Contains(mimeType, "jpeg"), strings.Contains(mimeType, "jpg"):
+		ext = ".jpg"
+	case strings.Contains(mimeType, "png"):
+		ext = ".png"
+	case strings.Contains(mimeType, "gif"):
+		ext = ".gif"
+	case strings.Contains(mimeType, "webp"):
+		ext = ".webp"
+	case strings.Contains(mimeType, "mp4"):
+		ext = ".mp4"
+	case strings.Contains(mimeType, "webm"):
+		ext = ".webm"
+	case strings.Contains(mimeType, "ogg"):
+		ext = ".ogg"
+	case strings.Contains(mimeType, "opus"):
+		ext = ".opus"
+	case strings.Contains(mimeType, "pdf"):
+		ext = ".pdf"
+	case strings.Contains(mimeType, "doc"):
+		if strings.Contains(mimeType, "docx") {
+			ext = ".docx"
+		} else {
+			ext = ".doc"
+		}
+	}
+
+	// Build object key
+	key := fmt.Sprintf("users/%s/%s/%s/%s/%s/%s/%s/%s%s",
+		userID,
+		direction,
+		contactJID,
+		year,
+		month,
+		day,
+		mediaType,
+		messageID,
+		ext,
+	)
+
+	return key
+}
+
+// localMediaDir returns the directory used by the local storage backend
+func localMediaDir() string {
+	if dir := os.Getenv("MEDIA_LOCAL_DIR"); dir != "" {
+		return dir
+	}
+	ex, err := os.Executable()
+	if err != nil {
+		return "media"
+	}
+	return filepath.Join(filepath.Dir(ex), "files", "media")
+}
+
+// localStore writes media to the server's filesystem. Files are served under /media/.
+type localStore struct {
+	dir       string
+	publicURL string
+}
+
+func newLocalStore(config *StorageConfig) *localStore {
+	publicURL := config.PublicURL
+	if publicURL == "" {
+		publicURL = os.Getenv("MEDIA_PUBLIC_URL")
+	}
+	return &localStore{dir: localMediaDir(), publicURL: strings.TrimRight(publicURL, "/")}
+}
+
+func (l *localStore) Backend() string { return storageBackendLocal }
+
+func (l *localStore) Location() string { return l.dir }
+
+// path maps an object key to a file below the media directory
+func (l *localStore) path(key string) (string, error) {
+	p := filepath.Join(l.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(l.dir)+string(os.PathSeparator)) {
+		return "", fmt.Errorf("invalid object key: %s", key)
+	}
+	return p, nil
+}
+
+func (l *localStore) Put(ctx context.Context, key string, data []byte, mimeType string) error {
+	p, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+func (l *localStore) URL(key string) string {
+	return l.publicURL + "/media/" + key
+}
+
+func (l *localStore) DeletePrefix(ctx context.Context, prefix string) error {
+	p, err := l.path(strings.TrimSuffix(prefix, "/"))
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (l *localStore) Test(ctx context.Context) error {
+	if err := os.MkdirAll(l.dir, 0o755); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(l.dir, ".write-test-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// loadUserStorage reads the storage settings of a user and (re)initializes the media store
+func (s *server) loadUserStorage(userID string) error {
+	config, err := s.getStorageConfig(userID)
+	if err != nil {
+		return err
+	}
+	return GetStorageManager().InitializeStore(userID, config)
+}
+
+// getStorageConfig reads the storage settings of a user
+func (s *server) getStorageConfig(userID string) (*StorageConfig, error) {
+	var row struct {
+		Enabled        bool   `db:"s3_enabled"`
+		Backend        string `db:"storage_backend"`
+		Endpoint       string `db:"s3_endpoint"`
+		Region         string `db:"s3_region"`
+		Bucket         string `db:"s3_bucket"`
+		AccessKey      string `db:"s3_access_key"`
+		SecretKey      string `db:"s3_secret_key"`
+		PathStyle      bool   `db:"s3_path_style"`
+		PublicURL      string `db:"s3_public_url"`
+		MediaDelivery  string `db:"media_delivery"`
+		RetentionDays  int    `db:"s3_retention_days"`
+		AzureAccount   string `db:"azure_account"`
+		AzureContainer string `db:"azure_container"`
+		AzureSASToken  string `db:"azure_sas_token"`
+		PresignTTL     int    `db:"s3_presign_ttl"`
+	}
+
+	err := s.db.Get(&row, `
+		SELECT COALESCE(s3_enabled, FALSE) AS s3_enabled, COALESCE(storage_backend, '') AS storage_backend,
+			   COALESCE(s3_endpoint, '') AS s3_endpoint, COALESCE(s3_region, '') AS s3_region,
+			   COALESCE(s3_bucket, '') AS s3_bucket, COALESCE(s3_access_key, '') AS s3_access_key,
+			   COALESCE(s3_secret_key, '') AS s3_secret_key, COALESCE(s3_path_style, TRUE) AS s3_path_style,
+			   COALESCE(s3_public_url, '') AS s3_public_url, COALESCE(media_delivery, 'base64') AS media_delivery,
+			   COALESCE(s3_retention_days, 30) AS s3_retention_days, COALESCE(azure_account, '') AS azure_account,
+			   COALESCE(azure_container, '') AS azure_container, COALESCE(azure_sas_token, '') AS azure_sas_token,
+			   COALESCE(s3_presign_ttl, 0) AS s3_presign_ttl
+		FROM users WHERE id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := row.Backend
+	if backend == "" {
+		backend = storageBackendS3
+	}
+
+	return &StorageConfig{
+		Enabled:        row.Enabled,
+		Backend:        backend,
+		Endpoint:       row.Endpoint,
+		Region:         row.Region,
+		Bucket:         row.Bucket,
+		AccessKey:      row.AccessKey,
+		SecretKey:      row.SecretKey,
+		PathStyle:      row.PathStyle,
+		PublicURL:      row.PublicURL,
+		MediaDelivery:  row.MediaDelivery,
+		RetentionDays:  row.RetentionDays,
+		AzureAccount:   row.AzureAccount,
+		AzureContainer: row.AzureContainer,
+		AzureSASToken:  row.AzureSASToken,
+		PresignTTL:     row.PresignTTL,
+	}, nil
+}
+
+// storageResponse renders a storage configuration without credentials
+func storageResponse(config *StorageConfig) map[string]interface{} {
+	response := map[string]interface{}{
+		"success":       true,
+		"enabled":       config.Enabled,
+		"backend":       config.Backend,
+		"mediaDelivery": config.MediaDelivery,
+		"retentionDays": config.RetentionDays,
+		"publicUrl":     config.PublicURL,
+	}
+
+	switch config.Backend {
+	case storageBackendS3, storageBackendGCS:
+		response["endpoint"] = config.Endpoint
+		response["region"] = config.Region
+		response["bucket"] = config.Bucket
+		response["pathStyle"] = config.PathStyle
+		response["presignTtl"] = config.PresignTTL
+		response["hasCredentials"] = config.AccessKey != "" && config.SecretKey != ""
+	case storageBackendAzure:
+		response["azureAccount"] = config.AzureAccount
+		response["azureContainer"] = config.AzureContainer
+		response["hasCredentials"] = config.AzureSASToken != ""
+	}
+
+	return response
+}
+
+// GetStorage returns the media storage configuration
+// @Summary Get media storage
+// @Description Returns the media storage backend configuration. Credentials are never returned.
+// @Tags Storage
+// @Produce json
+// @Success 200 {object} StorageResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/storage [get]
+func (s *server) GetStorage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		config, err := s.getStorageConfig(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		s.Respond(w, r, http.StatusOK, storageResponse(config))
+	}
+}
+
+// SetStorage updates the media storage configuration
+// @Summary Set media storage
+// @Description Selects the media storage backend (s3, gcs, azure or local) and its settings. The connection is tested before the settings are saved. Empty credential fields keep the stored values.
+// @Tags Storage
+// @Accept json
+// @Produce json
+// @Param request body StorageBody true "Storage settings"
+// @Success 200 {object} StorageResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/storage [post]
+func (s *server) SetStorage() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		token := r.Context().Value("userinfo").(Values).Get("Token")
+
+		var msg StorageBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		current, err := s.getStorageConfig(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		config := &StorageConfig{
+			Enabled:        msg.Enabled,
+			Backend:        strings.ToLower(strings.TrimSpace(msg.Backend)),
+			Endpoint:       msg.Endpoint,
+			Region:         msg.Region,
+			Bucket:         msg.Bucket,
+			AccessKey:      msg.AccessKey,
+			SecretKey:      msg.SecretKey,
+			PathStyle:      msg.PathStyle,
+			PublicURL:      msg.PublicURL,
+			MediaDelivery:  msg.MediaDelivery,
+			RetentionDays:  msg.RetentionDays,
+			AzureAccount:   msg.AzureAccount,
+			AzureContainer: msg.AzureContainer,
+			AzureSASToken:  msg.AzureSASToken,
+			PresignTTL:     msg.PresignTTL,
+		}
+		if config.Backend == "" {
+			config.Backend = storageBackendS3
+		}
+		if !Find(storageBackends, config.Backend) {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("backend must be one of: %s", strings.Join(storageBackends, ", ")))
+			return
+		}
+		if config.MediaDelivery == "" {
+			config.MediaDelivery = "base64"
+		}
+		if config.MediaDelivery != "base64" && config.MediaDelivery != "s3" && config.MediaDelivery != "both" {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("mediaDelivery must be one of: base64, s3, both"))
+			return
+		}
+		if config.RetentionDays < 0 {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("retentionDays cannot be negative"))
+			return
+		}
+		if config.PresignTTL < 0 || time.Duration(config.PresignTTL)*time.Second > maxPresignTTL {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("presignTtl must be between 0 and %d seconds", int(maxPresignTTL.Seconds())))
+			return
+		}
+		if config.PresignTTL > 0 && config.Backend != storageBackendS3 && config.Backend != storageBackendGCS {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("presignTtl is only supported by the s3 and gcs backends"))
+			return
+		}
+		if config.AccessKey == "" && config.SecretKey == "" {
+			config.AccessKey = current.AccessKey
+			config.SecretKey = current.SecretKey
+		}
+		if config.AzureSASToken == "" {
+			config.AzureSASToken = current.AzureSASToken
+		}
+
+		if config.Enabled {
+			switch config.Backend {
+			case storageBackendS3, storageBackendGCS:
+				if config.Bucket == "" {
+					s.Respond(w, r, http.StatusBadRequest, errors.New("missing bucket in payload"))
+					return
+				}
+			case storageBackendAzure:
+				if config.AzureAccount == "" || config.AzureContainer == "" || config.AzureSASToken == "" {
+					s.Respond(w, r, http.StatusBadRequest, errors.New("azureAccount, azureContainer and azureSasToken are required"))
+					return
+				}
+			}
+
+			store, err := newBlobStore(config)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+			err = store.Test(ctx)
+			cancel()
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("storage connection test failed: %w", err))
+				return
+			}
+		}
+
+		_, err = s.db.Exec(`UPDATE users SET s3_enabled=$1, storage_backend=$2, s3_endpoint=$3, s3_region=$4, s3_bucket=$5,
+			s3_access_key=$6, s3_secret_key=$7, s3_path_style=$8, s3_public_url=$9, media_delivery=$10, s3_retention_days=$11,
+			azure_account=$12, azure_container=$13, azure_sas_token=$14, s3_presign_ttl=$15 WHERE id=$16`,
+			config.Enabled, config.Backend, config.Endpoint, config.Region, config.Bucket,
+			config.AccessKey, config.SecretKey, config.PathStyle, config.PublicURL, config.MediaDelivery, config.RetentionDays,
+			config.AzureAccount, config.AzureContainer, config.AzureSASToken, config.PresignTTL, txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if err := GetStorageManager().InitializeStore(txtid, config); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		v := updateUserInfo(r.Context().Value("userinfo"), "S3Enabled", fmt.Sprintf("%t", config.Enabled))
+		v = updateUserInfo(v, "MediaDelivery", config.MediaDelivery)
+		cacheUserInfo(token, v)
+
+		s.Respond(w, r, http.StatusOK, storageResponse(config))
+	}
+}
+
+// PresignMedia mints a new signed link for a stored object
+// @Summary Presign media URL
+// @Description Returns a short-lived signed GET URL for an object stored in the user's S3 or GCS bucket. The TTL defaults to the configured presignTtl, or one hour.
+// @Tags Storage
+// @Accept json
+// @Produce json
+// @Param request body PresignBody true "Object key and TTL"
+// @Success 200 {object} PresignResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /media/presign [post]
+func (s *server) PresignMedia() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg PresignBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		// Users share buckets, so only keys below the user's own prefix can be signed
+		if !strings.HasPrefix(msg.Key, fmt.Sprintf("users/%s/", txtid)) || strings.Contains(msg.Key, "..") {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("invalid object key"))
+			return
+		}
+
+		store, config, ok := GetStorageManager().GetStore(txtid)
+		if !ok {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("media storage is not enabled"))
+			return
+		}
+		presigner, ok := store.(Presigner)
+		if !ok {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("the %s backend does not support presigned URLs", store.Backend()))
+			return
+		}
+
+		ttl := time.Duration(msg.TTL) * time.Second
+		if ttl == 0 {
+			ttl = time.Duration(config.PresignTTL) * time.Second
+		}
+		if ttl == 0 {
+			ttl = time.Hour
+		}
+		if ttl < 0 || ttl > maxPresignTTL {
+			s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("ttl must be between 1 and %d seconds", int(maxPresignTTL.Seconds())))
+			return
+		}
+
+		signed, err := presigner.Presign(r.Context(), msg.Key, ttl)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":   true,
+			"url":       signed,
+			"key":       msg.Key,
+			"expiresAt": time.Now().Add(ttl).Unix(),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// serveLocalMedia serves files written by the local storage backend. Directory listings are not exposed.
+func serveLocalMedia() http.Handler {
+	dir := localMediaDir()
+	files := http.StripPrefix("/media/", http.FileServer(http.Dir(dir)))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := (&localStore{dir: dir}).path(strings.TrimPrefix(r.URL.Path, "/media/"))
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if info, err := os.Stat(p); err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+		files.ServeHTTP(w, r)
+	})
+}
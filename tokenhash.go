@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// tokenHashOff stores and looks up tokens as they are
+	tokenHashOff = "off"
+	// tokenHashAccept looks up hashed and plain tokens but still stores new
+	// tokens in plain text, so replicas without hashing keep working during a
+	// rollout
+	tokenHashAccept = "accept"
+	// tokenHashOn stores new tokens hashed and hashes the stored ones at startup
+	tokenHashOn = "on"
+
+	// tokenHashPrefix marks a stored token as the HMAC-SHA256 of the token
+	tokenHashPrefix = "h1:"
+
+	minTokenSaltLength = 16
+)
+
+// tokenHashing is the token hashing mode from MAXAPI_TOKEN_HASHING
+var tokenHashing = tokenHashOff
+
+// tokenSalt is the secret key of the token hashes
+var tokenSalt []byte
+
+// initTokenHashing reads MAXAPI_TOKEN_HASHING (off, accept or on) and the
+// secret MAXAPI_TOKEN_SALT the hashes are keyed with
+func initTokenHashing() error {
+	if salt := os.Getenv("MAXAPI_TOKEN_SALT"); salt != "" {
+		if len(salt) < minTokenSaltLength {
+			return fmt.Errorf("MAXAPI_TOKEN_SALT must be at least %d characters", minTokenSaltLength)
+		}
+		tokenSalt = []byte(salt)
+	}
+
+	switch mode := strings.ToLower(os.Getenv("MAXAPI_TOKEN_HASHING")); mode {
+	case "", tokenHashOff:
+		return nil
+	case tokenHashAccept, tokenHashOn:
+		if tokenSalt == nil {
+			return errors.New("MAXAPI_TOKEN_HASHING needs MAXAPI_TOKEN_SALT")
+		}
+		tokenHashing = mode
+	default:
+		return fmt.Errorf("unknown MAXAPI_TOKEN_HASHING %q, use off, accept or on", mode)
+	}
+
+	log.Info().Str("mode", tokenHashing).Msg("User token hashing enabled")
+	return nil
+}
+
+// hashToken returns the stored form of a hashed token
+func hashToken(token string) string {
+	mac := hmac.New(sha256.New, tokenSalt)
+	mac.Write([]byte(token))
+	return tokenHashPrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// isHashedToken reports whether a stored token is a hash
+func isHashedToken(token string) bool {
+	return strings.HasPrefix(token, tokenHashPrefix)
+}
+
+// storedToken returns the form a new token is stored in
+func storedToken(token string) string {
+	if tokenHashing == tokenHashOn {
+		return hashToken(token)
+	}
+	return token
+}
+
+// tokenKeys returns the stored forms a token presented by a client may have.
+// A presented hash never matches itself, so a leaked database does not give
+// usable tokens.
+func tokenKeys(token string) []string {
+	if tokenHashing == tokenHashOff {
+		return []string{token}
+	}
+	keys := []string{hashToken(token)}
+	if !isHashedToken(token) {
+		keys = append(keys, token)
+	}
+	return keys
+}
+
+// matchesConfiguredToken compares a presented admin key in constant time with
+// a configured one, which may be given as its hash
+func matchesConfiguredToken(presented, configured string) bool {
+	if isHashedToken(configured) && tokenSalt != nil {
+		presented = hashToken(presented)
+	}
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(configured)) == 1
+}
+
+// rehashTokens replaces the plain tokens in the database with their hashes.
+// It runs at startup in mode on, before any instance is started.
+func rehashTokens(db *sqlx.DB) error {
+	if tokenHashing != tokenHashOn {
+		return nil
+	}
+
+	var users []struct {
+		ID    string `db:"id"`
+		Token string `db:"token"`
+	}
+	if err := db.Select(&users, "SELECT id, token FROM users WHERE token NOT LIKE 'h1:%'"); err != nil {
+		return err
+	}
+	for _, user := range users {
+		if _, err := db.Exec("UPDATE users SET token=$1 WHERE id=$2 AND token=$3", hashToken(user.Token), user.ID, user.Token); err != nil {
+			return fmt.Errorf("hashing token of user %s: %w", user.ID, err)
+		}
+	}
+	if len(users) > 0 {
+		log.Info().Int("users", len(users)).Msg("Stored user tokens replaced with their hashes")
+	}
+
+	var viewers []struct {
+		ID    string `db:"id"`
+		Token string `db:"viewer_token"`
+	}
+	if err := db.Select(&viewers, "SELECT id, viewer_token FROM users WHERE viewer_token <> '' AND viewer_token NOT LIKE 'h1:%'"); err != nil {
+		return err
+	}
+	for _, viewer := range viewers {
+		if _, err := db.Exec("UPDATE users SET viewer_token=$1 WHERE id=$2 AND viewer_token=$3", hashToken(viewer.Token), viewer.ID, viewer.Token); err != nil {
+			return fmt.Errorf("hashing viewer token of user %s: %w", viewer.ID, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// withTokenHashing sets the token hashing mode for one test
+func withTokenHashing(t *testing.T, mode string) {
+	t.Helper()
+	wasMode, wasSalt := tokenHashing, tokenSalt
+	tokenHashing, tokenSalt = mode, []byte("test-salt-0123456789")
+	userinfocache.Flush()
+	invalidTokenCache.Flush()
+	t.Cleanup(func() {
+		tokenHashing, tokenSalt = wasMode, wasSalt
+		userinfocache.Flush()
+		invalidTokenCache.Flush()
+	})
+}
+
+func TestTokenHashingModes(t *testing.T) {
+	tests := []struct {
+		mode       string
+		storedHash bool
+		hashedRow  bool // a row hashed by another replica is found
+	}{
+		{tokenHashOff, false, false},
+		{tokenHashAccept, false, true},
+		{tokenHashOn, true, true},
+	}
+	for i, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			s := newTestServer(t)
+			withTokenHashing(t, tt.mode)
+			remote := fmt.Sprintf("198.51.100.%d:4321", 10+i)
+			status := func(token string) int {
+				return serve(s, "GET", "/user/blocklist", remote, map[string]string{"token": token}, "").Code
+			}
+
+			userID, token := newTestUser(t, s, "hashing")
+			var stored string
+			if err := s.db.Get(&stored, "SELECT token FROM users WHERE id = $1", userID); err != nil {
+				t.Fatal(err)
+			}
+			if isHashedToken(stored) != tt.storedHash {
+				t.Errorf("stored token %q, want hashed %v", stored, tt.storedHash)
+			}
+			if code := status(token); code != http.StatusOK {
+				t.Errorf("token: status %d", code)
+			}
+			if stored != token {
+				if code := status(stored); code != http.StatusUnauthorized {
+					t.Errorf("stored hash accepted as a token: status %d", code)
+				}
+			}
+
+			otherID, otherToken := newTestUser(t, s, "hashed elsewhere")
+			if _, err := s.db.Exec("UPDATE users SET token = $1 WHERE id = $2", hashToken(otherToken), otherID); err != nil {
+				t.Fatal(err)
+			}
+			want := http.StatusUnauthorized
+			if tt.hashedRow {
+				want = http.StatusOK
+			}
+			if code := status(otherToken); code != want {
+				t.Errorf("token of a hashed row: status %d, want %d", code, want)
+			}
+		})
+	}
+}
+
+func TestRehashTokens(t *testing.T) {
+	s := newTestServer(t)
+	withTokenHashing(t, tokenHashAccept)
+	plainID, plainToken := newTestUser(t, s, "plain")
+	if _, err := s.db.Exec("UPDATE users SET viewer_token = $1 WHERE id = $2", "viewer-"+plainToken, plainID); err != nil {
+		t.Fatal(err)
+	}
+	hashedID, hashedToken := newTestUser(t, s, "hashed")
+	if _, err := s.db.Exec("UPDATE users SET token = $1 WHERE id = $2", hashToken(hashedToken), hashedID); err != nil {
+		t.Fatal(err)
+	}
+
+	withTokenHashing(t, tokenHashOn)
+	for run := 0; run < 2; run++ {
+		if err := rehashTokens(s.db); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		userID string
+		column string
+		want   string
+	}{
+		{plainID, "token", hashToken(plainToken)},
+		{plainID, "viewer_token", hashToken("viewer-" + plainToken)},
+		{hashedID, "token", hashToken(hashedToken)},
+	}
+	for _, tt := range tests {
+		var got string
+		if err := s.db.Get(&got, "SELECT "+tt.column+" FROM users WHERE id = $1", tt.userID); err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("%s of %s = %q, want %q", tt.column, tt.userID, got, tt.want)
+		}
+	}
+
+	if code := serve(s, "GET", "/user/blocklist", "198.51.100.20:4321", map[string]string{"token": plainToken}, "").Code; code != http.StatusOK {
+		t.Errorf("rehashed token: status %d", code)
+	}
+}
+
+func TestMatchesConfiguredToken(t *testing.T) {
+	withTokenHashing(t, tokenHashOn)
+	tests := []struct {
+		presented  string
+		configured string
+		want       bool
+	}{
+		{"secret", "secret", true},
+		{"secret", "other", false},
+		{"secret", hashToken("secret"), true},
+		{hashToken("secret"), hashToken("secret"), false},
+		{"", "secret", false},
+	}
+	for _, tt := range tests {
+		if got := matchesConfiguredToken(tt.presented, tt.configured); got != tt.want {
+			t.Errorf("matchesConfiguredToken(%q, %q) = %v, want %v", tt.presented, tt.configured, got, tt.want)
+		}
+	}
+}
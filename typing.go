@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+const (
+	defaultTypingCharsPerSecond = 15
+	defaultTypingMaxDelay       = 8 // seconds
+	maxTypingDelay              = 30
+	maxTypingCharsPerSecond     = 1000
+
+	// minTypingDelay keeps the indicator visible for very short texts
+	minTypingDelay = 800 * time.Millisecond
+	// typingRefresh resends the indicator before MAX hides it
+	typingRefresh = 4 * time.Second
+)
+
+// TypingConfig simulates typing before text sends: the typing indicator is
+// shown for a time proportional to the text length. Enabled is the default
+// for sends that leave out simulateTyping. CharsPerSecond (0 = 15) sets the
+// typing speed and MaxDelay (0 = 8) caps the delay in seconds.
+// @Description Shows the typing indicator before text sends that leave out simulateTyping, for the text length at charsPerSecond (15 by default) up to maxDelay seconds (8 by default)
+type TypingConfig struct {
+	Enabled        bool `json:"enabled" example:"false"`
+	CharsPerSecond int  `json:"charsPerSecond" example:"15"`
+	MaxDelay       int  `json:"maxDelay" example:"8"`
+}
+
+// validateTyping checks typing simulation settings
+func validateTyping(config TypingConfig) error {
+	if config.CharsPerSecond < 0 || config.CharsPerSecond > maxTypingCharsPerSecond {
+		return fmt.Errorf("typing: charsPerSecond must be between 0 and %d", maxTypingCharsPerSecond)
+	}
+	if config.MaxDelay < 0 || config.MaxDelay > maxTypingDelay {
+		return fmt.Errorf("typing: maxDelay must be between 0 and %d seconds", maxTypingDelay)
+	}
+	return nil
+}
+
+// typingDelay returns how long typing text takes, with up to 20% jitter
+func typingDelay(config TypingConfig, text string) time.Duration {
+	cps := config.CharsPerSecond
+	if cps == 0 {
+		cps = defaultTypingCharsPerSecond
+	}
+	maxDelay := time.Duration(config.MaxDelay) * time.Second
+	if maxDelay == 0 {
+		maxDelay = defaultTypingMaxDelay * time.Second
+	}
+
+	delay := time.Duration(utf8.RuneCountInString(text)) * time.Second / time.Duration(cps)
+	delay += time.Duration(rand.Int63n(int64(delay)/5 + 1))
+	return min(max(delay, minTypingDelay), maxDelay)
+}
+
+// SimulateTyping shows the typing indicator in a chat before a text send and
+// waits until the text would have been typed. The send goes ahead when the
+// indicator fails; it returns false when ctx ends first.
+func (s *server) SimulateTyping(ctx context.Context, userID string, client *maxclient.Client, chatID int64, text string, requested *bool) bool {
+	config, err := s.getUserConfig(userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Could not load user config, using the typing defaults")
+	}
+	enabled := config.Typing.Enabled
+	if requested != nil {
+		enabled = *requested
+	}
+	if !enabled || text == "" {
+		return true
+	}
+
+	delay := typingDelay(config.Typing, text)
+	deadline := time.Now().Add(delay)
+	for {
+		if err := client.SendTyping(chatID); err != nil {
+			log.Warn().Err(err).Str("userID", userID).Int64("chatId", chatID).Msg("Failed to send typing indicator")
+		}
+
+		wait := min(time.Until(deadline), typingRefresh)
+		if wait <= 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+		if !time.Now().Before(deadline) {
+			return true
+		}
+	}
+}
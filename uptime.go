@@ -0,0 +1,282 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	connectionUp   = "up"
+	connectionDown = "down"
+
+	connectionLogRetention  = 90 * 24 * time.Hour
+	uptimeDefaultDays       = 7
+	uptimeRecentDisconnects = 20
+)
+
+// connectionStates caches the last logged state per user, so repeated events
+// of the same state do not add rows
+var connectionStates sync.Map
+
+// ConnectionChange is one state transition of an instance
+type ConnectionChange struct {
+	State     string `db:"state" json:"state" example:"down"`
+	Reason    string `db:"reason" json:"reason" example:"connection_lost"`
+	CreatedAt int64  `db:"created_at" json:"createdAt" example:"1700000000"`
+}
+
+// connectionChange returns the state an event moves an instance to
+func connectionChange(postmap map[string]interface{}) (state, reason string, ok bool) {
+	switch eventType, _ := postmap["type"].(string); eventType {
+	case "Sync", "Connected":
+		return connectionUp, "", true
+	case "Disconnected":
+		reason, _ := postmap["reason"].(string)
+		if reason == "" {
+			reason = "server_disconnect"
+		}
+		return connectionDown, reason, true
+	case "Reconnecting":
+		return connectionDown, "connection_lost", true
+	case "AuthExpired":
+		return connectionDown, "auth_expired", true
+	case "LoggedOut":
+		return connectionDown, "logged_out", true
+	}
+	return "", "", false
+}
+
+// logConnectionEvent records the transition an event stands for
+func (s *server) logConnectionEvent(userID string, postmap map[string]interface{}) {
+	if state, reason, ok := connectionChange(postmap); ok {
+		s.logConnection(userID, state, reason)
+	}
+}
+
+// logConnection records a state transition of an instance; a state equal to the last one is ignored
+func (s *server) logConnection(userID, state, reason string) {
+	last, known := connectionStates.Load(userID)
+	if !known {
+		var lastState string
+		err := s.db.Get(&lastState, "SELECT state FROM connection_log WHERE user_id = $1 ORDER BY id DESC LIMIT 1", userID)
+		if err == nil {
+			last, known = lastState, true
+		}
+	}
+	if known && last == state {
+		return
+	}
+
+	_, err := s.db.Exec("INSERT INTO connection_log (user_id, state, reason, created_at) VALUES ($1, $2, $3, $4)",
+		userID, state, reason, time.Now().Unix())
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Str("state", state).Msg("Failed to log connection state")
+		return
+	}
+	connectionStates.Store(userID, state)
+}
+
+// startConnectionLog closes instances left up by a gateway that did not shut
+// down cleanly and prunes old entries
+func (s *server) startConnectionLog() {
+	var dangling []string
+	err := s.db.Select(&dangling, `SELECT c.user_id FROM connection_log c
+		WHERE c.id = (SELECT MAX(id) FROM connection_log WHERE user_id = c.user_id) AND c.state = $1`, connectionUp)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to load connection states")
+	}
+	for _, userID := range dangling {
+		s.logConnection(userID, connectionDown, "gateway_restart")
+	}
+
+	go func() {
+		for {
+			res, err := s.db.Exec("DELETE FROM connection_log WHERE created_at < $1", time.Now().Add(-connectionLogRetention).Unix())
+			if err != nil {
+				log.Warn().Err(err).Msg("Failed to prune connection log")
+			} else if n, _ := res.RowsAffected(); n > 0 {
+				log.Info().Int64("deleted", n).Msg("Pruned connection log")
+			}
+			time.Sleep(24 * time.Hour)
+		}
+	}()
+}
+
+// closeConnectionLog records every connected instance as down when the gateway stops
+func (s *server) closeConnectionLog() {
+	connectionStates.Range(func(key, value interface{}) bool {
+		if value == connectionUp {
+			s.logConnection(key.(string), connectionDown, "shutdown")
+		}
+		return true
+	})
+}
+
+// DailyUptime is the availability of an instance on one UTC day
+type DailyUptime struct {
+	Date         string  `json:"date" example:"2026-10-14"`
+	Availability float64 `json:"availability" example:"99.52"`
+	UpSeconds    int64   `json:"upSeconds" example:"85987"`
+	DownSeconds  int64   `json:"downSeconds" example:"413"`
+	Disconnects  int     `json:"disconnects" example:"2"`
+}
+
+// Disconnect is one period an instance was down
+type Disconnect struct {
+	At              int64  `json:"at" example:"1700000000"`
+	Reason          string `json:"reason" example:"connection_lost"`
+	DurationSeconds int64  `json:"durationSeconds" example:"35"`
+	Ongoing         bool   `json:"ongoing" example:"false"`
+}
+
+// GetUptime returns the availability history of the instance
+// @Summary Get uptime history
+// @Description Returns the share of each UTC day (newest first) the instance was connected to MAX, with the recent disconnects and their reasons. Days before the first recorded connection are left out. History is kept for 90 days.
+// @Tags User
+// @Produce json
+// @Param days query int false "Days to report, 1-90 (default 7)"
+// @Success 200 {object} UptimeResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/uptime [get]
+func (s *server) GetUptime() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		days := uptimeDefaultDays
+		if v := r.URL.Query().Get("days"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 90 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("days must be between 1 and 90"))
+				return
+			}
+			days = n
+		}
+
+		now := time.Now().UTC()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		start := today.AddDate(0, 0, -(days - 1))
+
+		// The last change before the window gives the state it starts in
+		var changes []ConnectionChange
+		err := s.db.Select(&changes, `SELECT state, reason, created_at FROM connection_log
+			WHERE user_id = $1 AND created_at < $2 ORDER BY created_at DESC, id DESC LIMIT 1`, txtid, start.Unix())
+		if err == nil {
+			var inWindow []ConnectionChange
+			err = s.db.Select(&inWindow, `SELECT state, reason, created_at FROM connection_log
+				WHERE user_id = $1 AND created_at >= $2 ORDER BY created_at, id`, txtid, start.Unix())
+			changes = append(changes, inWindow...)
+		}
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		daily, total := uptimeByDay(changes, start, now, days)
+
+		current := connectionDown
+		if len(changes) > 0 {
+			current = changes[len(changes)-1].State
+		}
+
+		response := map[string]interface{}{
+			"success":           true,
+			"current":           current,
+			"availability":      total,
+			"days":              daily,
+			"recentDisconnects": recentDisconnects(changes, now),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// uptimeByDay splits the time covered by changes into days, newest first, and
+// returns the availability over all of them
+func uptimeByDay(changes []ConnectionChange, start, now time.Time, days int) ([]DailyUptime, float64) {
+	daily := []DailyUptime{}
+	var up, covered int64
+
+	for d := days - 1; d >= 0; d-- {
+		dayStart := start.AddDate(0, 0, d)
+		dayEnd := dayStart.AddDate(0, 0, 1)
+		if dayEnd.After(now) {
+			dayEnd = now
+		}
+
+		var day DailyUptime
+		day.Date = dayStart.Format("2006-01-02")
+		tracked := false
+		for i, c := range changes {
+			from := time.Unix(c.CreatedAt, 0)
+			to := now
+			if i+1 < len(changes) {
+				to = time.Unix(changes[i+1].CreatedAt, 0)
+			}
+			if from.Before(dayStart) {
+				from = dayStart
+			}
+			if to.After(dayEnd) {
+				to = dayEnd
+			}
+			if c.State == connectionDown && c.CreatedAt >= dayStart.Unix() && c.CreatedAt < dayEnd.Unix() {
+				day.Disconnects++
+			}
+			if !to.After(from) {
+				continue
+			}
+			tracked = true
+			seconds := int64(to.Sub(from).Seconds())
+			if c.State == connectionUp {
+				day.UpSeconds += seconds
+			} else {
+				day.DownSeconds += seconds
+			}
+		}
+		if !tracked {
+			continue
+		}
+
+		day.Availability = percentage(day.UpSeconds, day.UpSeconds+day.DownSeconds)
+		up += day.UpSeconds
+		covered += day.UpSeconds + day.DownSeconds
+		daily = append(daily, day)
+	}
+
+	return daily, percentage(up, covered)
+}
+
+// recentDisconnects returns the latest down periods, newest first
+func recentDisconnects(changes []ConnectionChange, now time.Time) []Disconnect {
+	list := []Disconnect{}
+	for i := len(changes) - 1; i >= 0 && len(list) < uptimeRecentDisconnects; i-- {
+		c := changes[i]
+		if c.State != connectionDown {
+			continue
+		}
+		d := Disconnect{At: c.CreatedAt, Reason: c.Reason}
+		if i+1 < len(changes) {
+			d.DurationSeconds = changes[i+1].CreatedAt - c.CreatedAt
+		} else {
+			d.DurationSeconds = now.Unix() - c.CreatedAt
+			d.Ongoing = true
+		}
+		list = append(list, d)
+	}
+	return list
+}
+
+// percentage returns part of total in percent, rounded to two decimals
+func percentage(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(part)*10000/float64(total)) / 100
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultUserCacheTTL        = 300 // seconds
+	defaultUserCacheMaxEntries = 10000
+	invalidTokenTTL            = 30 * time.Second
+)
+
+// userCacheLimits are the configured TTL and entry cap of the user cache
+var userCacheLimits struct {
+	ttl        time.Duration
+	maxEntries int
+}
+
+// userCacheStats counts cache activity since startup
+var userCacheStats struct {
+	hits          atomic.Int64
+	misses        atomic.Int64
+	negativeHits  atomic.Int64
+	evictions     atomic.Int64
+	invalidations atomic.Int64
+}
+
+// userCacheDropping marks tokens that are being invalidated, so the eviction
+// callback can tell invalidations from expiry and size evictions
+var userCacheDropping sync.Map
+
+// invalidTokenCache remembers tokens without a user so repeated requests with a
+// bad token do not reach the database
+var invalidTokenCache = cache.New(invalidTokenTTL, time.Minute)
+
+// userLoads collapses concurrent cache misses for the same token into one query
+var userLoads = struct {
+	sync.Mutex
+	calls map[string]*userLoad
+}{calls: map[string]*userLoad{}}
+
+type userLoad struct {
+	done  chan struct{}
+	v     Values
+	found bool
+	err   error
+}
+
+// initUserCache sets the lifetime (MAXAPI_USER_CACHE_TTL, seconds) and the
+// maximum number of entries (MAXAPI_USER_CACHE_MAX_ENTRIES, 0 = unlimited) of
+// cached user information
+func initUserCache() {
+	ttl := time.Duration(envInt("MAXAPI_USER_CACHE_TTL", defaultUserCacheTTL)) * time.Second
+	if ttl <= 0 {
+		ttl = defaultUserCacheTTL * time.Second
+	}
+	userCacheLimits.ttl = ttl
+	userCacheLimits.maxEntries = envInt("MAXAPI_USER_CACHE_MAX_ENTRIES", defaultUserCacheMaxEntries)
+
+	userinfocache = cache.New(ttl, ttl)
+	userinfocache.OnEvicted(func(token string, _ interface{}) {
+		if _, ok := userCacheDropping.Load(token); ok {
+			userCacheStats.invalidations.Add(1)
+		} else {
+			userCacheStats.evictions.Add(1)
+		}
+	})
+}
+
+// cacheUserInfo stores user information for a token until the cache TTL expires,
+// evicting the entry closest to expiry when the cache is full
+func cacheUserInfo(token string, v interface{}) {
+	invalidTokenCache.Delete(token)
+	if max := userCacheLimits.maxEntries; max > 0 && userinfocache.ItemCount() >= max {
+		if _, cached := userinfocache.Get(token); !cached {
+			evictUserInfo()
+		}
+	}
+	userinfocache.Set(token, v, cache.DefaultExpiration)
+}
+
+// evictUserInfo removes expired entries, or the entry closest to expiry if none expired
+func evictUserInfo() {
+	before := userinfocache.ItemCount()
+	userinfocache.DeleteExpired()
+	if userinfocache.ItemCount() < before {
+		return
+	}
+
+	oldest, oldestExp := "", int64(0)
+	for token, item := range userinfocache.Items() {
+		if oldest == "" || item.Expiration < oldestExp {
+			oldest, oldestExp = token, item.Expiration
+		}
+	}
+	if oldest != "" {
+		userinfocache.Delete(oldest)
+	}
+}
+
+// dropUserInfo removes a cached entry and counts it as an invalidation
+func dropUserInfo(token string) {
+	userCacheDropping.Store(token, true)
+	userinfocache.Delete(token)
+	userCacheDropping.Delete(token)
+}
+
+// invalidateUserToken drops the cached information of a token, e.g. after it was created or deleted
+func invalidateUserToken(token string) {
+	dropUserInfo(token)
+	invalidTokenCache.Delete(token)
+}
+
+// invalidateUserID drops the cached information of a user, e.g. after an admin edited it
+func invalidateUserID(userID string) {
+	for token, item := range userinfocache.Items() {
+		if v, ok := item.Object.(Values); ok && v.Get("Id") == userID {
+			dropUserInfo(token)
+		}
+	}
+}
+
+// userInfo returns the user information of a token in its stored form, as
+// kept by running instances and internal sends
+func (s *server) userInfo(token string) (Values, bool, error) {
+	return s.findUser([]string{token})
+}
+
+// authenticateToken returns the user information of a token presented by a
+// client, which is looked up by its hash when token hashing is on
+func (s *server) authenticateToken(token string) (Values, bool, error) {
+	return s.findUser(tokenKeys(token))
+}
+
+// findUser returns the user information of the first stored token of keys,
+// loading it from the database on a cache miss. Concurrent misses for the
+// same token share one query, and tokens without a user are remembered for a
+// short time.
+func (s *server) findUser(keys []string) (Values, bool, error) {
+	token := keys[0]
+	if token == "" {
+		return Values{}, false, nil
+	}
+	for _, key := range keys {
+		if cached, found := userinfocache.Get(key); found {
+			userCacheStats.hits.Add(1)
+			return cached.(Values), true, nil
+		}
+	}
+	if _, invalid := invalidTokenCache.Get(token); invalid {
+		userCacheStats.negativeHits.Add(1)
+		return Values{}, false, nil
+	}
+	userCacheStats.misses.Add(1)
+
+	userLoads.Lock()
+	if call, ok := userLoads.calls[token]; ok {
+		userLoads.Unlock()
+		<-call.done
+		return call.v, call.found, call.err
+	}
+	call := &userLoad{done: make(chan struct{})}
+	userLoads.calls[token] = call
+	userLoads.Unlock()
+
+	call.v, call.found, call.err = s.loadUserInfo(keys)
+	if call.err == nil {
+		if call.found {
+			key := call.v.Get("Token")
+			if isViewer(call.v) {
+				key = call.v.Get("ViewerToken")
+			}
+			cacheUserInfo(key, call.v)
+		} else {
+			invalidTokenCache.Set(token, true, cache.DefaultExpiration)
+		}
+	}
+
+	userLoads.Lock()
+	delete(userLoads.calls, token)
+	userLoads.Unlock()
+	close(call.done)
+
+	return call.v, call.found, call.err
+}
+
+// loadUserInfo reads the user information of the first matching stored token
+// of keys from the database. A matching viewer token gives the information of
+// its user marked as a viewer.
+func (s *server) loadUserInfo(keys []string) (Values, bool, error) {
+	var row struct {
+		ID            string        `db:"id"`
+		Name          string        `db:"name"`
+		Token         string        `db:"token"`
+		Webhook       string        `db:"webhook"`
+		MaxUserID     sql.NullInt64 `db:"max_user_id"`
+		Events        string        `db:"events"`
+		ProxyURL      string        `db:"proxy_url"`
+		S3Enabled     string        `db:"s3_enabled"`
+		MediaDelivery string        `db:"media_delivery"`
+		History       sql.NullInt64 `db:"history"`
+		ViewerToken   string        `db:"viewer_token"`
+	}
+	// A plain token is only tried after its hash
+	primary, fallback := keys[0], keys[len(keys)-1]
+
+	log.Info().Msg("Looking for user information in DB")
+	err := s.db.Get(&row, `SELECT id, name, token, webhook, max_user_id, events, COALESCE(proxy_url, '') AS proxy_url,
+		CASE WHEN s3_enabled THEN 'true' ELSE 'false' END AS s3_enabled,
+		COALESCE(media_delivery, 'base64') AS media_delivery, history, COALESCE(viewer_token, '') AS viewer_token
+		FROM users WHERE token=$1 OR token=$2 OR viewer_token=$1 OR viewer_token=$2
+		ORDER BY CASE WHEN token=$1 THEN 0 WHEN token=$2 THEN 1 WHEN viewer_token=$1 THEN 2 ELSE 3 END LIMIT 1`, primary, fallback)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Values{}, false, nil
+	}
+	if err != nil {
+		return Values{}, false, err
+	}
+
+	maxUserID := ""
+	if row.MaxUserID.Valid {
+		maxUserID = fmt.Sprintf("%d", row.MaxUserID.Int64)
+	}
+
+	v := Values{map[string]string{
+		"Id":            row.ID,
+		"Name":          row.Name,
+		"MaxUserID":     maxUserID,
+		"Webhook":       row.Webhook,
+		"Token":         row.Token,
+		"Proxy":         row.ProxyURL,
+		"Events":        row.Events,
+		"S3Enabled":     row.S3Enabled,
+		"MediaDelivery": row.MediaDelivery,
+		"History":       fmt.Sprintf("%d", row.History.Int64),
+	}}
+	if row.Token != primary && row.Token != fallback {
+		v.m["Viewer"] = "true"
+		v.m["ViewerToken"] = row.ViewerToken
+	}
+	log.Info().Str("name", row.Name).Msg("User info from DB")
+	return v, true, nil
+}
+
+// GetUserCacheStats returns the configuration and counters of the user cache
+// @Summary User cache statistics
+// @Description Returns the TTL, entry cap and current size of the token auth cache with hits, misses, negative hits (unknown tokens answered from cache), evictions (expired or over the cap) and invalidations since startup
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} UserCacheStatsResponse
+// @Security AdminAuth
+// @Router /admin/usercache [get]
+func (s *server) GetUserCacheStats() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		response := map[string]interface{}{
+			"success":         true,
+			"ttlSeconds":      int64(userCacheLimits.ttl / time.Second),
+			"maxEntries":      userCacheLimits.maxEntries,
+			"entries":         userinfocache.ItemCount(),
+			"negativeEntries": invalidTokenCache.ItemCount(),
+			"hits":            userCacheStats.hits.Load(),
+			"misses":          userCacheStats.misses.Load(),
+			"negativeHits":    userCacheStats.negativeHits.Load(),
+			"evictions":       userCacheStats.evictions.Load(),
+			"invalidations":   userCacheStats.invalidations.Load(),
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
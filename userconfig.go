@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+)
+
+// UserConfig holds a user's integration settings
+type UserConfig struct {
+	RabbitMQ     RabbitMQConfig     `json:"rabbitmq"`
+	Notify       NotifyConfig       `json:"notify"`
+	Alerts       AlertsConfig       `json:"alerts"`
+	ReplyPreview ReplyPreviewConfig `json:"replyPreview"`
+	Commands     CommandsConfig     `json:"commands"`
+	Typing       TypingConfig       `json:"typing"`
+	Warmup       WarmupConfig       `json:"warmup"`
+}
+
+// NotifyConfig sets whether sends notify the recipient. Default applies when
+// a send does not set notify (true when unset); SilentMode makes every send
+// silent, e.g. for night-time automation.
+// @Description Whether sends notify the recipient. default applies to sends that leave out notify; silentMode makes every send silent.
+type NotifyConfig struct {
+	Default    *bool `json:"default" example:"true"`
+	SilentMode bool  `json:"silentMode" example:"false"`
+}
+
+// userConfigs caches the integration settings per user
+var userConfigs sync.Map
+
+// getUserConfig reads the integration settings of a user
+func (s *server) getUserConfig(userID string) (UserConfig, error) {
+	if cached, ok := userConfigs.Load(userID); ok {
+		return cached.(UserConfig), nil
+	}
+
+	config := UserConfig{RabbitMQ: RabbitMQConfig{Sinks: []RabbitSink{}}, Alerts: AlertsConfig{Emails: []string{}}}
+
+	var raw string
+	if err := s.db.Get(&raw, "SELECT COALESCE(user_config, '') FROM users WHERE id = $1", userID); err != nil {
+		return config, err
+	}
+	if raw != "" {
+		if err := json.Unmarshal([]byte(raw), &config); err != nil {
+			return config, err
+		}
+	}
+	userConfigs.Store(userID, config)
+	return config, nil
+}
+
+// userRabbitSinks returns the RabbitMQ sinks of a connected user
+func userRabbitSinks(userID string) []RabbitSink {
+	mycli := clientManager.GetMyClient(userID)
+	if mycli == nil {
+		return nil
+	}
+	config, err := mycli.s.getUserConfig(userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Could not load user config, using the global RabbitMQ routing")
+		return nil
+	}
+	return config.RabbitMQ.Sinks
+}
+
+// defaultNotify returns whether a user's sends that leave out notify notify the recipient
+func (s *server) defaultNotify(userID string) bool {
+	config, err := s.getUserConfig(userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Could not load user config, using the notify default")
+	}
+	if config.Notify.Default != nil {
+		return *config.Notify.Default
+	}
+	return true
+}
+
+// NotifyFor resolves the notify flag of a send: silent mode wins, then the
+// value of the request, then the user's default
+func (s *server) NotifyFor(userID string, notify *bool) bool {
+	if config, err := s.getUserConfig(userID); err == nil && config.Notify.SilentMode {
+		return false
+	}
+	if notify != nil {
+		return *notify
+	}
+	return s.defaultNotify(userID)
+}
+
+// validateUserSinks checks user sinks like configured ones and keeps their
+// exchanges and queues under the user prefix, so a user cannot bind to the
+// default queue or to the sinks of another user
+func validateUserSinks(userID string, sinks []RabbitSink) error {
+	prefix := renderTemplate(rabbitUserPrefix, map[string]string{"userID": userID})
+	for i := range sinks {
+		sink := &sinks[i]
+		if err := sink.validate(); err != nil {
+			return fmt.Errorf("rabbitmq sink %d: %w", i, err)
+		}
+		if sink.Exchange == "" && sink.RoutingKey != "" {
+			return fmt.Errorf("rabbitmq sink %d: routingKey needs an exchange", i)
+		}
+		for _, name := range []string{sink.Exchange, sink.Queue} {
+			if name != "" && !strings.HasPrefix(name, prefix) {
+				return fmt.Errorf("rabbitmq sink %d: %s must start with %s", i, name, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// GetUserConfig returns the integration settings
+// @Summary Get user config
+// @Description Returns the user's RabbitMQ routing, notify, email alert, reply preview, command routing, typing simulation and warm-up settings. Without sinks the user's events follow the routing of the configuration file.
+// @Tags User
+// @Produce json
+// @Success 200 {object} UserConfigResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/config [get]
+func (s *server) GetUserConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		config, err := s.getUserConfig(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":      true,
+			"rabbitmq":     config.RabbitMQ,
+			"notify":       config.Notify,
+			"alerts":       config.Alerts,
+			"replyPreview": config.ReplyPreview,
+			"commands":     config.Commands,
+			"typing":       config.Typing,
+			"warmup":       config.Warmup,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetUserConfig updates the integration settings
+// @Summary Set user config
+// @Description Sets the user's integration settings: RabbitMQ sinks, notify defaults, alert emails, reply previews, bot commands, typing simulation and warm-up. Sections left out of the request are kept; the UserConfigBody schema describes each one.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body UserConfigBody true "User config"
+// @Success 200 {object} UserConfigResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/config [post]
+func (s *server) SetUserConfig() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg UserConfigBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		config, err := s.getUserConfig(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		if msg.RabbitMQ != nil {
+			sinks := msg.RabbitMQ.Sinks
+			if sinks == nil {
+				sinks = []RabbitSink{}
+			}
+			if err := validateUserSinks(txtid, sinks); err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			if err := checkRabbitSinks(sinks); err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			config.RabbitMQ = RabbitMQConfig{Sinks: sinks}
+		}
+		if msg.Notify != nil {
+			config.Notify = *msg.Notify
+		}
+		if msg.Alerts != nil {
+			emails, err := parseAlertEmails(msg.Alerts.Emails)
+			if err != nil {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("alerts: %w", err))
+				return
+			}
+			config.Alerts = AlertsConfig{Emails: emails}
+		}
+		if msg.ReplyPreview != nil {
+			if msg.ReplyPreview.Length < 0 || msg.ReplyPreview.Length > 4000 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("replyPreview: length must be between 0 and 4000"))
+				return
+			}
+			config.ReplyPreview = *msg.ReplyPreview
+		}
+		if msg.Commands != nil {
+			commands := *msg.Commands
+			if err := validateCommands(&commands); err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			config.Commands = commands
+		}
+		if msg.Typing != nil {
+			if err := validateTyping(*msg.Typing); err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			config.Typing = *msg.Typing
+		}
+		if msg.Warmup != nil {
+			if err := validateWarmup(*msg.Warmup); err != nil {
+				s.Respond(w, r, http.StatusBadRequest, err)
+				return
+			}
+			config.Warmup = *msg.Warmup
+		}
+
+		raw, _ := json.Marshal(config)
+		if _, err := s.db.Exec("UPDATE users SET user_config = $1 WHERE id = $2", string(raw), txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		userConfigs.Store(txtid, config)
+
+		log.Info().Str("userID", txtid).Int("rabbitSinks", len(config.RabbitMQ.Sinks)).Bool("silentMode", config.Notify.SilentMode).Msg("User config updated")
+
+		response := map[string]interface{}{
+			"success":      true,
+			"rabbitmq":     config.RabbitMQ,
+			"notify":       config.Notify,
+			"alerts":       config.Alerts,
+			"replyPreview": config.ReplyPreview,
+			"commands":     config.Commands,
+			"typing":       config.Typing,
+			"warmup":       config.Warmup,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import "testing"
+
+func TestValidateUserSinks(t *testing.T) {
+	if rabbitUserPrefix != rabbitDefaultUserPrefix {
+		t.Fatalf("rabbitUserPrefix = %q, want the default %q", rabbitUserPrefix, rabbitDefaultUserPrefix)
+	}
+
+	tests := []struct {
+		name string
+		sink RabbitSink
+		ok   bool
+	}{
+		{"own exchange and queue", RabbitSink{Exchange: "maxapi.user.u1.events", Queue: "maxapi.user.u1.crm"}, true},
+		{"own queue", RabbitSink{Queue: "maxapi.user.u1.crm"}, true},
+		{"default queue", RabbitSink{Queue: "max_events"}, false},
+		{"unprefixed exchange", RabbitSink{Exchange: "events"}, false},
+		{"exchange of another user", RabbitSink{Exchange: "maxapi.user.u2.events"}, false},
+		{"queue of another user", RabbitSink{Exchange: "maxapi.user.u1.events", Queue: "maxapi.user.u2.crm"}, false},
+		{"routing key without exchange", RabbitSink{Queue: "maxapi.user.u1.crm", RoutingKey: "x"}, false},
+		{"neither exchange nor queue", RabbitSink{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateUserSinks("u1", []RabbitSink{tt.sink})
+			if (err == nil) != tt.ok {
+				t.Errorf("validateUserSinks() = %v, want ok %v", err, tt.ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/rs/zerolog/log"
+
+	"maxapi/maxclient"
+)
+
+// localePattern accepts language tags like "ru", "en" or "en-US"
+var localePattern = regexp.MustCompile(`^[a-z]{2,3}([-_][A-Za-z]{2,4})?$`)
+
+// userSettings are the default language and timezone of an instance
+type userSettings struct {
+	Locale   string `db:"locale"`
+	Timezone string `db:"timezone"`
+}
+
+func (s *server) getUserSettings(txtid string) (userSettings, error) {
+	var settings userSettings
+	err := s.db.Get(&settings, `SELECT COALESCE(locale, '') AS locale, COALESCE(timezone, '') AS timezone
+		FROM users WHERE id=$1`, txtid)
+	return settings, err
+}
+
+// userLocation returns the timezone of the user, the server timezone if none is set
+func (s *server) userLocation(txtid string) *time.Location {
+	settings, err := s.getUserSettings(txtid)
+	if err != nil {
+		log.Error().Err(err).Str("userID", txtid).Msg("Failed to load user settings")
+		return time.Local
+	}
+	loc, err := loadQuietHoursLocation(settings.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// formatLocalTime formats a Unix time in seconds for exports, empty for 0
+func formatLocalTime(ts int64, loc *time.Location) string {
+	if ts == 0 {
+		return ""
+	}
+	return time.Unix(ts, 0).In(loc).Format(time.RFC3339)
+}
+
+// UserAgent returns the user agent sent to MAX, with the language and
+// timezone of the user when they are set
+func (s *server) UserAgent(txtid string) *maxclient.UserAgent {
+	ua := maxclient.DefaultUserAgent()
+	settings, err := s.getUserSettings(txtid)
+	if err != nil {
+		log.Error().Err(err).Str("userID", txtid).Msg("Failed to load user settings")
+		return ua
+	}
+	if settings.Locale != "" {
+		ua.Locale = settings.Locale
+		ua.DeviceLocale = settings.Locale
+	}
+	ua.Timezone = settings.Timezone
+	return ua
+}
+
+// withUserTimezone uses the timezone of the user for quiet hours that have none
+func (s *server) withUserTimezone(txtid string, q quietHoursConfig) quietHoursConfig {
+	if q.Timezone == "" {
+		q.Timezone = s.userLocation(txtid).String()
+	}
+	return q
+}
+
+// ========== USER SETTINGS ENDPOINTS ==========
+
+// GetUserSettings returns the language and timezone of the instance
+// @Summary Get user settings
+// @Description Returns the default language and timezone of the instance. Empty values use the defaults: ru and the server timezone.
+// @Tags User
+// @Produce json
+// @Success 200 {object} UserSettingsResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/settings [get]
+func (s *server) GetUserSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		settings, err := s.getUserSettings(txtid)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success":  true,
+			"locale":   settings.Locale,
+			"timezone": settings.Timezone,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetUserSettings updates the language and timezone of the instance
+// @Summary Set user settings
+// @Description Sets the default language and timezone of the instance. Both are sent to MAX as the locale and timezone of the device on the next connect. The timezone is also used for quiet hours without a timezone of their own and for the timestamps of exports. Empty values restore the defaults.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param request body UserSettingsBody true "Language and timezone"
+// @Success 200 {object} UserSettingsResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/settings [post]
+func (s *server) SetUserSettings() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg UserSettingsBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		if msg.Locale != "" && !localePattern.MatchString(msg.Locale) {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("invalid locale, expected a language code like ru or en-US"))
+			return
+		}
+		if _, err := loadQuietHoursLocation(msg.Timezone); err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		if _, err := s.db.Exec("UPDATE users SET locale=$1, timezone=$2 WHERE id=$3", msg.Locale, msg.Timezone, txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		log.Info().Str("userID", txtid).Str("locale", msg.Locale).Str("timezone", msg.Timezone).Msg("User settings updated")
+		s.recordChange(txtid, changeEntityUser, "updated", txtid, map[string]interface{}{
+			"locale":   msg.Locale,
+			"timezone": msg.Timezone,
+		})
+
+		response := map[string]interface{}{
+			"success":  true,
+			"locale":   msg.Locale,
+			"timezone": msg.Timezone,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/rs/zerolog/log"
+)
+
+// isViewer reports whether the request was authenticated with a viewer token
+func isViewer(userinfo Values) bool {
+	return userinfo.Get("Viewer") == "true"
+}
+
+// viewerAllowed reports whether a viewer token may call the matched route:
+// status, history, contacts and statistics, nothing that sends messages or
+// changes settings (see the Viewer routes of apiRoutes)
+func viewerAllowed(r *http.Request) bool {
+	rt, ok := currentRoute(r)
+	return ok && rt.Viewer
+}
+
+// ========== VIEWER TOKEN ENDPOINTS ==========
+
+// GetViewerToken reports whether the instance has a viewer token
+// @Summary Get viewer token status
+// @Description Reports whether a read-only viewer token is set. The token itself is only returned when it is created.
+// @Tags User
+// @Produce json
+// @Success 200 {object} ViewerTokenResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/viewertoken [get]
+func (s *server) GetViewerToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var stored string
+		if err := s.db.Get(&stored, "SELECT COALESCE(viewer_token, '') FROM users WHERE id=$1", txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"enabled": stored != "",
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// CreateViewerToken creates a read-only token for the instance
+// @Summary Create viewer token
+// @Description Creates a read-only viewer token for analytics tools, replacing the previous one. It can read status, chat history, contacts and statistics but cannot send messages or change settings; other endpoints return 403. The token is only returned in this response.
+// @Tags User
+// @Produce json
+// @Success 200 {object} ViewerTokenResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/viewertoken [post]
+func (s *server) CreateViewerToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		token := uuid.New().String()
+		if _, err := s.db.Exec("UPDATE users SET viewer_token=$1 WHERE id=$2", storedToken(token), txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		// Drops the cached previous viewer token
+		invalidateUserID(txtid)
+
+		log.Info().Str("userID", txtid).Msg("Viewer token created")
+
+		response := map[string]interface{}{
+			"success": true,
+			"enabled": true,
+			"token":   token,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteViewerToken revokes the read-only token of the instance
+// @Summary Revoke viewer token
+// @Description Revokes the viewer token; requests with it fail with 401 from then on
+// @Tags User
+// @Produce json
+// @Success 200 {object} ViewerTokenResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /user/viewertoken [delete]
+func (s *server) DeleteViewerToken() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		if _, err := s.db.Exec("UPDATE users SET viewer_token='' WHERE id=$1", txtid); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		invalidateUserID(txtid)
+
+		log.Info().Str("userID", txtid).Msg("Viewer token revoked")
+
+		response := map[string]interface{}{
+			"success": true,
+			"enabled": false,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestViewerToken(t *testing.T) {
+	s := newTestServer(t)
+	_, token := newTestUser(t, s, "viewed")
+
+	rec := serve(s, "POST", "/user/viewertoken", "192.0.2.10:4321", map[string]string{"token": token}, "")
+	var created struct {
+		Data struct {
+			Token string `json:"token"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil || rec.Code != http.StatusOK || created.Data.Token == "" {
+		t.Fatalf("create viewer token: status %d: %s", rec.Code, rec.Body)
+	}
+	viewer := created.Data.Token
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"viewer reads campaigns", viewer, "GET", "/campaigns", "", http.StatusOK},
+		{"viewer reads warm-up", viewer, "GET", "/user/warmup", "", http.StatusOK},
+		{"viewer cannot read settings", viewer, "GET", "/user/blocklist", "", http.StatusForbidden},
+		{"viewer cannot change settings", viewer, "POST", "/user/blocklist", `{"userIds": [1]}`, http.StatusForbidden},
+		{"viewer cannot send", viewer, "POST", "/chat/send/text", `{"chatId": 1, "text": "hi"}`, http.StatusForbidden},
+		{"viewer cannot replace itself", viewer, "POST", "/user/viewertoken", "", http.StatusForbidden},
+		{"viewer cannot revoke itself", viewer, "DELETE", "/user/viewertoken", "", http.StatusForbidden},
+		{"user token reads settings", token, "GET", "/user/blocklist", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(s, tt.method, tt.path, "192.0.2.10:4321", map[string]string{"token": tt.token}, tt.body)
+			if rec.Code != tt.want {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.want, rec.Body)
+			}
+		})
+	}
+
+	if rec := serve(s, "DELETE", "/user/viewertoken", "192.0.2.10:4321", map[string]string{"token": token}, ""); rec.Code != http.StatusOK {
+		t.Fatalf("revoke viewer token: status %d", rec.Code)
+	}
+	if rec := serve(s, "GET", "/campaigns", "192.0.2.10:4321", map[string]string{"token": viewer}, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("revoked viewer token: status %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+// TestViewerRoutesAreReadOnly checks that no route a viewer may call sends or
+// needs an admin role
+func TestViewerRoutesAreReadOnly(t *testing.T) {
+	for _, rt := range apiRoutes {
+		if rt.Viewer && (rt.Outbound || rt.Media || rt.Role != 0) {
+			t.Errorf("viewer route %s %s sends, uploads or needs an admin role", rt.Method, rt.Path)
+		}
+	}
+}
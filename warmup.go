@@ -0,0 +1,239 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	defaultWarmupDays        = 7
+	defaultWarmupHourlyLimit = 20
+	defaultWarmupMinDelay    = 5  // seconds
+	defaultWarmupMaxDelay    = 20 // seconds
+
+	maxWarmupDays        = 90
+	maxWarmupHourlyLimit = 1000
+	maxWarmupDelay       = 600
+
+	// errCodeWarmupCap is returned for internal sends over the warm-up hourly cap
+	errCodeWarmupCap = "WARMUP_CAP"
+)
+
+// warmupDefault turns warm-up on for users whose config leaves enabled out
+var warmupDefault bool
+
+// initWarmup reads MAXAPI_WARMUP
+func initWarmup() {
+	warmupDefault, _ = strconv.ParseBool(os.Getenv("MAXAPI_WARMUP"))
+	if warmupDefault {
+		log.Info().Msg("Warm-up is enabled for newly authenticated accounts")
+	}
+}
+
+// WarmupConfig limits the sends of a newly authenticated account. For Days
+// (0 = 7) after authentication at most HourlyLimit (0 = 20) sends go out per
+// hour, spaced by a random delay between MinDelay (0 = 5) and MaxDelay (0 = 20)
+// seconds. Enabled nil follows MAXAPI_WARMUP.
+// @Description Caps the sends of a newly authenticated account: for days (7 by default) after authentication at most hourlyLimit sends (20 by default) go out per hour, spaced by minDelay to maxDelay seconds (5 and 20 by default). Sends over the cap are queued; enabled left out follows MAXAPI_WARMUP.
+type WarmupConfig struct {
+	Enabled     *bool `json:"enabled" example:"true"`
+	Days        int   `json:"days" example:"7"`
+	HourlyLimit int   `json:"hourlyLimit" example:"20"`
+	MinDelay    int   `json:"minDelay" example:"5"`
+	MaxDelay    int   `json:"maxDelay" example:"20"`
+}
+
+// validateWarmup checks warm-up settings
+func validateWarmup(config WarmupConfig) error {
+	if config.Days < 0 || config.Days > maxWarmupDays {
+		return fmt.Errorf("warmup: days must be between 0 and %d", maxWarmupDays)
+	}
+	if config.HourlyLimit < 0 || config.HourlyLimit > maxWarmupHourlyLimit {
+		return fmt.Errorf("warmup: hourlyLimit must be between 0 and %d", maxWarmupHourlyLimit)
+	}
+	if config.MinDelay < 0 || config.MinDelay > maxWarmupDelay || config.MaxDelay < 0 || config.MaxDelay > maxWarmupDelay {
+		return fmt.Errorf("warmup: delays must be between 0 and %d seconds", maxWarmupDelay)
+	}
+	if config.MaxDelay > 0 && config.MinDelay > config.MaxDelay {
+		return fmt.Errorf("warmup: minDelay must not be greater than maxDelay")
+	}
+	return nil
+}
+
+// withDefaults fills in the defaults of the settings left zero
+func (c WarmupConfig) withDefaults() WarmupConfig {
+	if c.Days == 0 {
+		c.Days = defaultWarmupDays
+	}
+	if c.HourlyLimit == 0 {
+		c.HourlyLimit = defaultWarmupHourlyLimit
+	}
+	if c.MinDelay == 0 {
+		c.MinDelay = defaultWarmupMinDelay
+	}
+	if c.MaxDelay == 0 {
+		c.MaxDelay = max(defaultWarmupMaxDelay, c.MinDelay)
+	}
+	return c
+}
+
+// warmupState tracks the sends of a user during warm-up
+type warmupState struct {
+	mu              sync.Mutex
+	loaded          bool
+	authenticatedAt int64
+	sent            []time.Time
+	next            time.Time
+}
+
+// warmupStates holds the warm-up state of each user
+var warmupStates sync.Map
+
+func warmupStateFor(userID string) *warmupState {
+	state, _ := warmupStates.LoadOrStore(userID, &warmupState{})
+	return state.(*warmupState)
+}
+
+// MarkAuthenticated records when an account was authenticated, which starts its warm-up
+func (s *server) MarkAuthenticated(userID string) {
+	if _, err := s.db.Exec("UPDATE users SET authenticated_at=$1 WHERE id=$2", time.Now().Unix(), userID); err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to save authentication time")
+	}
+	warmupStates.Delete(userID)
+}
+
+// warmupPolicy returns the warm-up settings of a user and when the warm-up
+// ends; active is false once it is over or when it is off. The caller holds
+// state.mu.
+func (s *server) warmupPolicy(userID string, state *warmupState, now time.Time) (config WarmupConfig, ends time.Time, active bool) {
+	userConfig, err := s.getUserConfig(userID)
+	if err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Could not load user config, using the warm-up defaults")
+	}
+	config = userConfig.Warmup.withDefaults()
+	enabled := warmupDefault
+	if config.Enabled != nil {
+		enabled = *config.Enabled
+	}
+	if !enabled {
+		return config, time.Time{}, false
+	}
+
+	if !state.loaded {
+		if err := s.db.Get(&state.authenticatedAt, "SELECT COALESCE(authenticated_at, 0) FROM users WHERE id = $1", userID); err != nil {
+			log.Error().Err(err).Str("userID", userID).Msg("Failed to load authentication time")
+			return config, time.Time{}, false
+		}
+		state.loaded = true
+	}
+	// Accounts authenticated before the authentication time was recorded are not warmed up
+	if state.authenticatedAt == 0 {
+		return config, time.Time{}, false
+	}
+
+	ends = time.Unix(state.authenticatedAt, 0).AddDate(0, 0, config.Days)
+	return config, ends, now.Before(ends)
+}
+
+// prune drops the sends older than an hour
+func (st *warmupState) prune(now time.Time) {
+	i := 0
+	for i < len(st.sent) && !st.sent[i].After(now.Add(-time.Hour)) {
+		i++
+	}
+	st.sent = st.sent[i:]
+}
+
+// warmupUntil reports whether a user in warm-up reached the hourly cap and
+// when the next send is allowed
+func (s *server) warmupUntil(userID string, now time.Time) (time.Time, bool) {
+	state := warmupStateFor(userID)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	config, _, active := s.warmupPolicy(userID, state, now)
+	if !active {
+		return time.Time{}, false
+	}
+	state.prune(now)
+	if len(state.sent) < config.HourlyLimit {
+		return time.Time{}, false
+	}
+	return state.sent[0].Add(time.Hour), true
+}
+
+// reserveWarmupSend counts a send against the warm-up cap of a user. It
+// returns how long the send has to wait for the random delay since the
+// previous send, or capped and when the next send is allowed.
+func (s *server) reserveWarmupSend(userID string, now time.Time) (wait time.Duration, until time.Time, capped bool) {
+	state := warmupStateFor(userID)
+	state.mu.Lock()
+	defer state.mu.Unlock()
+
+	config, _, active := s.warmupPolicy(userID, state, now)
+	if !active {
+		return 0, time.Time{}, false
+	}
+	state.prune(now)
+	if len(state.sent) >= config.HourlyLimit {
+		return 0, state.sent[0].Add(time.Hour), true
+	}
+
+	at := now
+	if state.next.After(at) {
+		at = state.next
+	}
+	delay := time.Duration(config.MinDelay) * time.Second
+	if config.MaxDelay > config.MinDelay {
+		delay += time.Duration(rand.Int63n(int64(config.MaxDelay-config.MinDelay)*int64(time.Second) + 1))
+	}
+	state.sent = append(state.sent, at)
+	state.next = at.Add(delay)
+	return at.Sub(now), time.Time{}, false
+}
+
+// GetWarmup returns the warm-up status
+// @Summary Get warm-up status
+// @Description Reports whether the account is in warm-up, when it ends, and the sends of the last hour against the hourly cap. Warm-up is configured in the warmup section of POST /user/config.
+// @Tags User
+// @Produce json
+// @Success 200 {object} WarmupResponse
+// @Security ApiKeyAuth
+// @Router /user/warmup [get]
+func (s *server) GetWarmup() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		now := time.Now()
+		state := warmupStateFor(txtid)
+		state.mu.Lock()
+		config, ends, active := s.warmupPolicy(txtid, state, now)
+		state.prune(now)
+		sent := len(state.sent)
+		state.mu.Unlock()
+
+		var endsAt int64
+		if active {
+			endsAt = ends.Unix()
+		}
+
+		response := map[string]interface{}{
+			"success":      true,
+			"active":       active,
+			"endsAt":       endsAt,
+			"sentLastHour": sent,
+			"hourlyLimit":  config.HourlyLimit,
+			"minDelay":     config.MinDelay,
+			"maxDelay":     config.MaxDelay,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+const defaultWebhookOrderParallelism = 8
+
+// orderedRetryDelays are the pauses between the in-place attempts of an
+// ordered delivery before it goes to the retry queue
+var orderedRetryDelays = []time.Duration{1 * time.Second, 5 * time.Second}
+
+var (
+	// webhookOrdered delivers the webhooks of a chat one after the other
+	webhookOrdered bool
+	// webhookOrderParallelism is how many chats of a user are delivered at
+	// the same time in ordered mode
+	webhookOrderParallelism = defaultWebhookOrderParallelism
+)
+
+// webhookDispatchers holds the ordered dispatcher of each user
+var webhookDispatchers sync.Map
+
+// initWebhookOrdering reads WEBHOOK_ORDERED and WEBHOOK_ORDER_PARALLELISM
+func initWebhookOrdering() {
+	webhookOrdered, _ = strconv.ParseBool(os.Getenv("WEBHOOK_ORDERED"))
+	if v := envInt("WEBHOOK_ORDER_PARALLELISM", defaultWebhookOrderParallelism); v > 0 {
+		webhookOrderParallelism = v
+	}
+	if webhookOrdered {
+		log.Info().Int("parallelism", webhookOrderParallelism).Msg("Webhooks are delivered in order per chat")
+	}
+}
+
+// orderedDispatcher runs the webhook deliveries of a user in order per chat.
+// A chat with pending deliveries has one worker, and at most parallelism
+// chats are delivered at the same time.
+type orderedDispatcher struct {
+	mu    sync.Mutex
+	lanes map[int64][]func()
+	slots chan struct{}
+}
+
+// dispatcherFor returns the ordered dispatcher of a user
+func dispatcherFor(userID string) *orderedDispatcher {
+	if d, ok := webhookDispatchers.Load(userID); ok {
+		return d.(*orderedDispatcher)
+	}
+	d, _ := webhookDispatchers.LoadOrStore(userID, &orderedDispatcher{
+		lanes: map[int64][]func(){},
+		slots: make(chan struct{}, webhookOrderParallelism),
+	})
+	return d.(*orderedDispatcher)
+}
+
+// dispatch queues a delivery behind the pending deliveries of its chat
+func (d *orderedDispatcher) dispatch(userID string, chatID int64, fn func()) {
+	d.mu.Lock()
+	queue, running := d.lanes[chatID]
+	d.lanes[chatID] = append(queue, fn)
+	d.mu.Unlock()
+
+	if !running {
+		goTracked(userID, func() { d.drain(chatID) })
+	}
+}
+
+// drain runs the deliveries of a chat until none are left
+func (d *orderedDispatcher) drain(chatID int64) {
+	d.slots <- struct{}{}
+	defer func() { <-d.slots }()
+
+	for {
+		d.mu.Lock()
+		queue := d.lanes[chatID]
+		if len(queue) == 0 {
+			delete(d.lanes, chatID)
+			d.mu.Unlock()
+			return
+		}
+		fn := queue[0]
+		queue[0] = nil
+		d.lanes[chatID] = queue[1:]
+		d.mu.Unlock()
+
+		fn()
+	}
+}
+
+// pending returns the number of deliveries waiting in the dispatcher
+func (d *orderedDispatcher) pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	n := 0
+	for _, queue := range d.lanes {
+		n += len(queue)
+	}
+	return n
+}
+
+// eventChatID returns the chat an event belongs to, 0 for events without one.
+// Events from MAX carry their payload as raw JSON, events built by the gateway
+// itself as a map.
+func eventChatID(postmap map[string]interface{}) int64 {
+	switch event := postmap["event"].(type) {
+	case json.RawMessage:
+		return rawEventChatID(event)
+	case map[string]interface{}:
+		if id := chatIDValue(event["chatId"]); id != 0 {
+			return id
+		}
+		if chat, ok := event["chat"].(map[string]interface{}); ok {
+			return chatIDValue(chat["id"])
+		}
+		if message, ok := event["message"].(map[string]interface{}); ok {
+			return chatIDValue(message["chatId"])
+		}
+	}
+	return 0
+}
+
+// rawEventChatID reads the chat of an event payload as received from MAX
+func rawEventChatID(raw json.RawMessage) int64 {
+	var event struct {
+		ChatID int64 `json:"chatId"`
+		Chat   *struct {
+			ID int64 `json:"id"`
+		} `json:"chat"`
+		Message *struct {
+			ChatID int64 `json:"chatId"`
+		} `json:"message"`
+	}
+	if err := json.Unmarshal(raw, &event); err != nil {
+		return 0
+	}
+	switch {
+	case event.ChatID != 0:
+		return event.ChatID
+	case event.Chat != nil:
+		return event.Chat.ID
+	case event.Message != nil:
+		return event.Message.ChatID
+	}
+	return 0
+}
+
+// chatIDValue converts a chat ID stored in an event map
+func chatIDValue(v interface{}) int64 {
+	switch id := v.(type) {
+	case int64:
+		return id
+	case int:
+		return int64(id)
+	case float64:
+		return int64(id)
+	case json.Number:
+		n, _ := id.Int64()
+		return n
+	case string:
+		n, _ := strconv.ParseInt(id, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// callHookOrdered delivers a webhook like callHook, but retries a failed
+// delivery in place first, so the next events of the chat wait for it. An
+// event that still fails goes to the retry queue and may arrive late.
+func callHookOrdered(myurl string, payload map[string]string, id string, secret string, format string) {
+	client := clientManager.GetHTTPClient(id)
+	if client == nil {
+		log.Warn().Str("userID", id).Msg("HTTP client not found, skipping webhook")
+		return
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = postHook(client, myurl, payload, secret, format)
+		metrics.webhookDelivery(id, err)
+		if err == nil || attempt == len(orderedRetryDelays) {
+			break
+		}
+		time.Sleep(orderedRetryDelays[attempt])
+	}
+	if err != nil {
+		log.Warn().Err(err).Str("url", myurl).Str("userID", id).Msg("Ordered webhook delivery failed, queueing retry")
+		queueWebhookRetry(id, myurl, payload, err)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	webhookRetryPollInterval  = 10 * time.Second
+	webhookRetryBaseDelay     = 30 * time.Second
+	webhookRetryMaxBackoff    = 1 * time.Hour
+	webhookRetryBatchSize     = 100
+	defaultWebhookMaxAttempts = 8
+
+	webhookStatusPending = "pending"
+	webhookStatusFailed  = "failed"
+)
+
+// webhookMaxAttempts is the number of delivery attempts before an event is dead-lettered
+var webhookMaxAttempts = defaultWebhookMaxAttempts
+
+// webhookRetryClient delivers retries of instances that have no HTTP client (e.g. disconnected)
+var webhookRetryClient = resty.New().SetTimeout(30 * time.Second)
+
+// WebhookDelivery is a webhook event waiting for a retry or dead-lettered
+type WebhookDelivery struct {
+	ID            int64  `json:"id" db:"id"`
+	UserID        string `json:"-" db:"user_id"`
+	URL           string `json:"url" db:"url"`
+	Payload       string `json:"-" db:"payload"`
+	Status        string `json:"status" db:"status"`
+	Attempts      int    `json:"attempts" db:"attempts"`
+	NextAttemptAt int64  `json:"nextAttemptAt" db:"next_attempt_at"`
+	LastError     string `json:"lastError,omitempty" db:"last_error"`
+	CreatedAt     int64  `json:"createdAt" db:"created_at"`
+}
+
+// initWebhookQueue reads the retry settings from the environment
+func initWebhookQueue() {
+	if v := envInt("WEBHOOK_MAX_ATTEMPTS", defaultWebhookMaxAttempts); v > 0 {
+		webhookMaxAttempts = v
+	}
+}
+
+// webhookBackoff returns the delay after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	backoff := webhookRetryBaseDelay << uint(max(attempts-1, 0))
+	if backoff <= 0 || backoff > webhookRetryMaxBackoff {
+		backoff = webhookRetryMaxBackoff
+	}
+	return backoff
+}
+
+// queueWebhookRetry stores a webhook whose first delivery attempt failed
+func queueWebhookRetry(userID, url string, payload map[string]string, cause error) {
+	mycli := clientManager.GetMyClient(userID)
+	if mycli == nil {
+		log.Error().Str("userID", userID).Str("url", url).Msg("Cannot queue webhook retry without a client, event lost")
+		return
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to encode webhook for retry")
+		return
+	}
+
+	now := time.Now()
+	status, next := webhookStatusPending, now.Add(webhookBackoff(1)).Unix()
+	if webhookMaxAttempts <= 1 {
+		status, next = webhookStatusFailed, 0
+	}
+
+	_, err = mycli.db.Exec(`INSERT INTO webhook_queue (user_id, url, payload, status, attempts, next_attempt_at, last_error, created_at)
+		VALUES ($1, $2, $3, $4, 1, $5, $6, $7)`,
+		userID, url, string(raw), status, next, cause.Error(), now.Unix())
+	if err != nil {
+		log.Error().Err(err).Str("userID", userID).Msg("Failed to queue webhook retry, event lost")
+	}
+}
+
+// startWebhookRetries periodically retries queued webhook deliveries that are due
+func (s *server) startWebhookRetries() {
+	go func() {
+		ticker := time.NewTicker(webhookRetryPollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			s.retryWebhooks()
+		}
+	}()
+}
+
+func (s *server) retryWebhooks() {
+	var due []WebhookDelivery
+	err := s.db.Select(&due, `SELECT * FROM webhook_queue WHERE status = $1 AND next_attempt_at <= $2
+		ORDER BY next_attempt_at, id LIMIT $3`, webhookStatusPending, time.Now().Unix(), webhookRetryBatchSize)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to load webhook retries")
+		return
+	}
+
+	for _, d := range due {
+		var payload map[string]string
+		if err := json.Unmarshal([]byte(d.Payload), &payload); err != nil {
+			log.Error().Err(err).Int64("id", d.ID).Msg("Dropping undecodable webhook retry")
+			s.db.Exec("DELETE FROM webhook_queue WHERE id = $1", d.ID)
+			continue
+		}
+
+		client := clientManager.GetHTTPClient(d.UserID)
+		if client == nil {
+			client = webhookRetryClient
+		}
+
+		// Retries are signed with the current secret and encoded in the current format.
+		// The global webhook is shared by all users and never carries a user signature.
+		secret, format := "", globalWebhookFormat()
+		if d.URL != globalWebhookURL() {
+			secret, format = s.WebhookSecret(d.UserID), s.WebhookFormat(d.UserID)
+		}
+
+		err := postHook(client, d.URL, payload, secret, format)
+		metrics.webhookDelivery(d.UserID, err)
+		if err == nil {
+			log.Info().Str("userID", d.UserID).Int64("id", d.ID).Int("attempts", d.Attempts+1).Msg("Webhook retry delivered")
+			s.db.Exec("DELETE FROM webhook_queue WHERE id = $1", d.ID)
+			continue
+		}
+
+		attempts := d.Attempts + 1
+		if attempts >= webhookMaxAttempts {
+			log.Error().Err(err).Str("userID", d.UserID).Int64("id", d.ID).Int("attempts", attempts).Msg("Webhook delivery failed permanently, moved to dead letters")
+			s.db.Exec("UPDATE webhook_queue SET status = $1, attempts = $2, last_error = $3 WHERE id = $4",
+				webhookStatusFailed, attempts, err.Error(), d.ID)
+			continue
+		}
+
+		backoff := webhookBackoff(attempts)
+		log.Warn().Err(err).Str("userID", d.UserID).Int64("id", d.ID).Int("attempts", attempts).Dur("retryIn", backoff).Msg("Webhook retry failed")
+		s.db.Exec("UPDATE webhook_queue SET attempts = $1, last_error = $2, next_attempt_at = $3 WHERE id = $4",
+			attempts, err.Error(), time.Now().Add(backoff).Unix(), d.ID)
+	}
+}
+
+// webhookDeliveryJSON renders a queued delivery with its event decoded
+func webhookDeliveryJSON(d WebhookDelivery) map[string]interface{} {
+	item := map[string]interface{}{
+		"id":            d.ID,
+		"url":           d.URL,
+		"status":        d.Status,
+		"attempts":      d.Attempts,
+		"nextAttemptAt": d.NextAttemptAt,
+		"lastError":     d.LastError,
+		"createdAt":     d.CreatedAt,
+	}
+
+	var payload map[string]string
+	if json.Unmarshal([]byte(d.Payload), &payload) == nil {
+		if raw := payload["jsonData"]; json.Valid([]byte(raw)) {
+			item["event"] = json.RawMessage(raw)
+		}
+	}
+	return item
+}
+
+// selectWebhookDeliveries builds the condition matching the deliveries named in a replay or delete request
+func selectWebhookDeliveries(userID string, msg WebhookFailedBody) (string, []interface{}, error) {
+	args := []interface{}{userID, webhookStatusFailed}
+	if msg.All {
+		return "user_id = $1 AND status = $2", args, nil
+	}
+	if len(msg.IDs) == 0 {
+		return "", nil, errors.New("missing ids or all")
+	}
+
+	placeholders := make([]string, len(msg.IDs))
+	for i, id := range msg.IDs {
+		args = append(args, id)
+		placeholders[i] = fmt.Sprintf("$%d", len(args))
+	}
+	return "user_id = $1 AND status = $2 AND id IN (" + strings.Join(placeholders, ", ") + ")", args, nil
+}
+
+// GetFailedWebhooks lists dead-lettered or pending webhook deliveries
+// @Summary List failed webhooks
+// @Description Returns webhook events whose delivery failed, newest first. status=failed (default) lists dead-lettered events that ran out of attempts, status=pending lists events waiting for a retry.
+// @Tags Webhook
+// @Produce json
+// @Param status query string false "failed or pending"
+// @Param limit query int false "Page size (default 50, max 500)"
+// @Param offset query int false "Number of entries to skip"
+// @Success 200 {object} WebhookDeliveriesResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook/failed [get]
+func (s *server) GetFailedWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+		q := r.URL.Query()
+
+		status := q.Get("status")
+		if status == "" {
+			status = webhookStatusFailed
+		}
+		if status != webhookStatusFailed && status != webhookStatusPending {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("status must be failed or pending"))
+			return
+		}
+
+		limit, offset := defaultMediaListLimit, 0
+		if v := q.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > maxMediaListLimit {
+				s.Respond(w, r, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxMediaListLimit))
+				return
+			}
+			limit = n
+		}
+		if v := q.Get("offset"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 0 {
+				s.Respond(w, r, http.StatusBadRequest, errors.New("invalid offset"))
+				return
+			}
+			offset = n
+		}
+
+		var total int
+		if err := s.db.Get(&total, "SELECT COUNT(*) FROM webhook_queue WHERE user_id = $1 AND status = $2", txtid, status); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		var deliveries []WebhookDelivery
+		query := fmt.Sprintf("SELECT * FROM webhook_queue WHERE user_id = $1 AND status = $2 ORDER BY created_at DESC, id DESC LIMIT %d OFFSET %d", limit, offset)
+		if err := s.db.Select(&deliveries, query, txtid, status); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		items := make([]map[string]interface{}, 0, len(deliveries))
+		for _, d := range deliveries {
+			items = append(items, webhookDeliveryJSON(d))
+		}
+
+		response := map[string]interface{}{
+			"success":    true,
+			"deliveries": items,
+			"total":      total,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// ReplayFailedWebhooks queues dead-lettered webhooks for delivery again
+// @Summary Replay failed webhooks
+// @Description Moves dead-lettered webhook events back to the retry queue with a fresh attempt count. They are delivered on the next retry pass.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param request body WebhookFailedBody true "Deliveries to replay"
+// @Success 200 {object} WebhookFailedResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook/failed/replay [post]
+func (s *server) ReplayFailedWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg WebhookFailedBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		cond, args, err := selectWebhookDeliveries(txtid, msg)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		args = append(args, webhookStatusPending, time.Now().Unix())
+		query := fmt.Sprintf("UPDATE webhook_queue SET status = $%d, attempts = 0, next_attempt_at = $%d WHERE %s", len(args)-1, len(args), cond)
+		res, err := s.db.Exec(query, args...)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		n, _ := res.RowsAffected()
+
+		response := map[string]interface{}{
+			"success": true,
+			"count":   n,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteFailedWebhooks discards dead-lettered webhooks
+// @Summary Delete failed webhooks
+// @Description Permanently removes dead-lettered webhook events
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param request body WebhookFailedBody true "Deliveries to delete"
+// @Success 200 {object} WebhookFailedResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook/failed [delete]
+func (s *server) DeleteFailedWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg WebhookFailedBody
+		if err := decodeJSON(r, &msg); err != nil {
+			s.RespondPayloadError(w, r, err)
+			return
+		}
+
+		cond, args, err := selectWebhookDeliveries(txtid, msg)
+		if err != nil {
+			s.Respond(w, r, http.StatusBadRequest, err)
+			return
+		}
+
+		res, err := s.db.Exec("DELETE FROM webhook_queue WHERE "+cond, args...)
+		if err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		n, _ := res.RowsAffected()
+
+		response := map[string]interface{}{
+			"success": true,
+			"count":   n,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/rs/zerolog/log"
+)
+
+const (
+	// webhookSignatureHeader carries the HMAC-SHA256 of the request body as "sha256=<hex>"
+	webhookSignatureHeader = "X-MaxAPI-Signature"
+
+	webhookSecretBytes     = 32
+	minWebhookSecretLength = 16
+)
+
+// webhookSecrets caches the signing secret per user ("" when signing is off)
+var webhookSecrets sync.Map
+
+// webhookSignature returns the signature header value for a body
+func webhookSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// signWebhook adds the signature header to a webhook request when a secret is set
+func signWebhook(req *resty.Request, secret string, body []byte) {
+	if secret != "" {
+		req.SetHeader(webhookSignatureHeader, webhookSignature(secret, body))
+	}
+}
+
+// WebhookSecret returns the signing secret of a user's webhook
+func (s *server) WebhookSecret(userID string) string {
+	if cached, ok := webhookSecrets.Load(userID); ok {
+		return cached.(string)
+	}
+
+	var secret string
+	if err := s.db.Get(&secret, "SELECT COALESCE(webhook_secret, '') FROM users WHERE id = $1", userID); err != nil {
+		log.Warn().Err(err).Str("userID", userID).Msg("Could not load webhook secret, sending unsigned")
+		return ""
+	}
+	webhookSecrets.Store(userID, secret)
+	return secret
+}
+
+// userWebhookSecret returns the signing secret of a connected user's webhook
+func userWebhookSecret(userID string) string {
+	mycli := clientManager.GetMyClient(userID)
+	if mycli == nil {
+		return ""
+	}
+	return mycli.s.WebhookSecret(userID)
+}
+
+// setWebhookSecret stores a user's signing secret; an empty secret disables signing
+func (s *server) setWebhookSecret(userID, secret string) error {
+	if _, err := s.db.Exec("UPDATE users SET webhook_secret = $1 WHERE id = $2", secret, userID); err != nil {
+		return err
+	}
+	webhookSecrets.Store(userID, secret)
+	return nil
+}
+
+// GetWebhookSecret reports whether webhook signing is enabled
+// @Summary Get webhook signing status
+// @Description Reports whether webhook requests are signed. The secret itself is not returned.
+// @Tags Webhook
+// @Produce json
+// @Success 200 {object} WebhookSecretResponse
+// @Security ApiKeyAuth
+// @Router /webhook/secret [get]
+func (s *server) GetWebhookSecret() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		response := map[string]interface{}{
+			"success": true,
+			"enabled": s.WebhookSecret(txtid) != "",
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// SetWebhookSecret sets or rotates the webhook signing secret
+// @Summary Set or rotate webhook secret
+// @Description Sets the secret used to sign webhook requests with HMAC-SHA256 in the X-MaxAPI-Signature header ("sha256=<hex of the raw body>"). Without a secret in the body a random one is generated. The previous secret stops working immediately, also for queued retries.
+// @Tags Webhook
+// @Accept json
+// @Produce json
+// @Param request body WebhookSecretBody false "Secret (optional)"
+// @Success 200 {object} WebhookSecretResponse
+// @Failure 400 {object} api.ErrorResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook/secret [post]
+func (s *server) SetWebhookSecret() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		var msg WebhookSecretBody
+		if r.ContentLength != 0 {
+			if err := decodeJSON(r, &msg); err != nil {
+				s.RespondPayloadError(w, r, err)
+				return
+			}
+		}
+
+		secret := msg.Secret
+		if secret == "" {
+			buf := make([]byte, webhookSecretBytes)
+			if _, err := rand.Read(buf); err != nil {
+				s.Respond(w, r, http.StatusInternalServerError, err)
+				return
+			}
+			secret = hex.EncodeToString(buf)
+		} else if len(secret) < minWebhookSecretLength {
+			s.Respond(w, r, http.StatusBadRequest, errors.New("secret must be at least 16 characters"))
+			return
+		}
+
+		if err := s.setWebhookSecret(txtid, secret); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+		log.Info().Str("userID", txtid).Msg("Webhook secret set")
+
+		response := map[string]interface{}{
+			"success": true,
+			"enabled": true,
+			"secret":  secret,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}
+
+// DeleteWebhookSecret turns off webhook signing
+// @Summary Delete webhook secret
+// @Description Removes the signing secret; webhook requests are sent without a signature
+// @Tags Webhook
+// @Produce json
+// @Success 200 {object} WebhookSecretResponse
+// @Failure 500 {object} api.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhook/secret [delete]
+func (s *server) DeleteWebhookSecret() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		txtid := r.Context().Value("userinfo").(Values).Get("Id")
+
+		if err := s.setWebhookSecret(txtid, ""); err != nil {
+			s.Respond(w, r, http.StatusInternalServerError, err)
+			return
+		}
+
+		response := map[string]interface{}{
+			"success": true,
+			"enabled": false,
+		}
+
+		s.Respond(w, r, http.StatusOK, response)
+	}
+}